@@ -8,153 +8,197 @@
 //
 //	go run ./analyze-conditions -c my-cluster -n default
 //	go run ./analyze-conditions -A --format json
+//	go run ./analyze-conditions -c my-cluster -w --interval 5s
+//	go run ./analyze-conditions -c my-cluster --no-explain
+//	go run ./analyze-conditions -A --conditions-version v1beta2
+//	go run ./analyze-conditions -c my-cluster --tree
 package main
 
 import (
+	_ "embed"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
+	"syscall"
+	"time"
 
+	"k8s-cluster-api-tools/internal/conditions"
 	"k8s-cluster-api-tools/internal/kubectl"
+
+	"gopkg.in/yaml.v3"
 )
 
-type conditionInfo struct {
-	ResourceKind      string
-	ResourceName      string
-	ResourceNamespace string
-	ConditionType     string
-	Status            string
-	Reason            string
-	Message           string
-	LastTransition    string
+//go:embed knowledge.yaml
+var embeddedKnowledge []byte
+
+// knowledgeEntry explains an unhealthy condition and suggests next steps.
+// See knowledge.yaml for the meaning of each field.
+type knowledgeEntry struct {
+	Type        string   `yaml:"type"`
+	Reason      string   `yaml:"reason"`
+	Kinds       []string `yaml:"kinds"`
+	Explanation string   `yaml:"explanation"`
+	Steps       []string `yaml:"steps"`
 }
 
-func (c *conditionInfo) isHealthy() bool {
-	positive := map[string]bool{
-		"Ready": true, "Available": true, "InfrastructureReady": true,
-		"ControlPlaneReady": true, "BootstrapReady": true,
-		"Provisioned": true, "Initialized": true, "UpToDate": true,
-	}
-	negative := map[string]bool{
-		"Stalled": true, "Deleting": true, "Paused": true,
-	}
-	if positive[c.ConditionType] {
-		return c.Status == "True"
-	}
-	if negative[c.ConditionType] {
-		return c.Status == "False"
-	}
-	return true
-}
+var knowledge []knowledgeEntry
 
-func (c *conditionInfo) toRow() []string {
-	icons := map[string]string{"True": "✓", "False": "✗", "Unknown": "?"}
-	icon := icons[c.Status]
-	if icon == "" {
-		icon = "?"
-	}
-	reason := c.Reason
-	if reason == "" {
-		reason = "-"
+func loadKnowledge() error {
+	var kb struct {
+		Entries []knowledgeEntry `yaml:"entries"`
 	}
-	return []string{
-		c.ResourceKind,
-		c.ResourceNamespace + "/" + c.ResourceName,
-		c.ConditionType,
-		icon + " " + c.Status,
-		reason,
+	if err := yaml.Unmarshal(embeddedKnowledge, &kb); err != nil {
+		return fmt.Errorf("embedded knowledge base: %w", err)
 	}
+	knowledge = kb.Entries
+	return nil
 }
 
-func extractConditions(item map[string]interface{}) []conditionInfo {
-	kind := getString(item, "kind", "Unknown")
-	metadata := getMap(item, "metadata")
-	name := getString(metadata, "name", "unknown")
-	namespace := getString(metadata, "namespace", "default")
-	status := getMap(item, "status")
-
-	conds := getSlice(status, "conditions")
-	if len(conds) == 0 {
-		v1b2 := getMap(status, "v1beta2")
-		conds = getSlice(v1b2, "conditions")
-	}
-
-	var result []conditionInfo
-	for _, c := range conds {
-		cm, ok := c.(map[string]interface{})
-		if !ok {
+// explain returns the most specific knowledge base entry for a condition:
+// one matching type and reason, then reason only, then type only.
+func explain(c *conditions.Info) *knowledgeEntry {
+	var best *knowledgeEntry
+	bestScore := 0
+	for i := range knowledge {
+		e := &knowledge[i]
+		if (e.Type != "" && e.Type != c.ConditionType) || (e.Reason != "" && e.Reason != c.Reason) {
 			continue
 		}
-		result = append(result, conditionInfo{
-			ResourceKind:      kind,
-			ResourceName:      name,
-			ResourceNamespace: namespace,
-			ConditionType:     getString(cm, "type", ""),
-			Status:            getString(cm, "status", "Unknown"),
-			Reason:            getString(cm, "reason", ""),
-			Message:           getString(cm, "message", ""),
-			LastTransition:    getString(cm, "lastTransitionTime", ""),
-		})
-	}
-	return result
+		if len(e.Kinds) > 0 {
+			found := false
+			for _, k := range e.Kinds {
+				found = found || k == c.ResourceKind
+			}
+			if !found {
+				continue
+			}
+		}
+		score := 0
+		if e.Reason != "" {
+			score += 4
+		}
+		if e.Type != "" {
+			score += 2
+		}
+		if len(e.Kinds) > 0 {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = e, score
+		}
+	}
+	return best
 }
 
-func collectAllConditions(namespace, clusterName string, allNamespaces bool) []conditionInfo {
-	resources := []string{
-		"clusters.cluster.x-k8s.io",
-		"machines.cluster.x-k8s.io",
-		"machinesets.cluster.x-k8s.io",
-		"machinedeployments.cluster.x-k8s.io",
-		"machinepools.cluster.x-k8s.io",
-		"machinehealthchecks.cluster.x-k8s.io",
-		"kubeadmconfigs.bootstrap.cluster.x-k8s.io",
-		"kubeadmcontrolplanes.controlplane.cluster.x-k8s.io",
+// nextSteps fills the entry's commands in for the given resource.
+func (e *knowledgeEntry) nextSteps(c *conditions.Info) []string {
+	cluster := c.ClusterName
+	if cluster == "" {
+		cluster = "<cluster>"
 	}
-
-	labelSel := ""
-	if clusterName != "" {
-		labelSel = "cluster.x-k8s.io/cluster-name=" + clusterName
+	r := strings.NewReplacer("{kind}", strings.ToLower(c.ResourceKind), "{name}", c.ResourceName,
+		"{namespace}", c.ResourceNamespace, "{cluster}", cluster)
+	steps := make([]string, len(e.Steps))
+	for i, s := range e.Steps {
+		steps[i] = r.Replace(s)
 	}
+	return steps
+}
 
-	var all []conditionInfo
-	ns := namespace
-	allNS := allNamespaces && namespace == ""
-
-	for _, res := range resources {
-		items, err := kubectl.RunJSON(res, ns, labelSel, allNS)
-		if err != nil {
+// printTriage explains each group of unhealthy conditions that share a
+// kind, type, status and reason, with commands for the first resource.
+func printTriage(conds []conditions.Info) {
+	type group struct {
+		entry     *knowledgeEntry
+		resources []*conditions.Info
+	}
+	groups := map[string]*group{}
+	var keys []string
+	for i := range conds {
+		c := &conds[i]
+		if c.IsHealthy() {
+			continue
+		}
+		e := explain(c)
+		if e == nil {
 			continue
 		}
-		for _, item := range items {
-			all = append(all, extractConditions(item)...)
+		key := fmt.Sprintf("%s %s=%s (%s)", c.ResourceKind, c.ConditionType, c.Status, c.Reason)
+		if c.Reason == "" {
+			key = fmt.Sprintf("%s %s=%s", c.ResourceKind, c.ConditionType, c.Status)
 		}
+		if groups[key] == nil {
+			groups[key] = &group{entry: e}
+			keys = append(keys, key)
+		}
+		groups[key].resources = append(groups[key].resources, c)
+	}
+	if len(keys) == 0 {
+		return
 	}
+	sort.Strings(keys)
 
-	// Also get Cluster directly if filtering
-	if clusterName != "" {
-		items, err := kubectl.RunJSON("clusters.cluster.x-k8s.io/"+clusterName, ns, "", false)
-		if err == nil {
-			for _, item := range items {
-				if getString(item, "kind", "") == "Cluster" {
-					all = append(all, extractConditions(item)...)
-				}
+	fmt.Printf("\n%s\n", strings.Repeat("=", 50))
+	fmt.Println("TRIAGE")
+	fmt.Println(strings.Repeat("=", 50))
+	for _, key := range keys {
+		g := groups[key]
+		names := make([]string, len(g.resources))
+		for i, c := range g.resources {
+			names[i] = c.ResourceNamespace + "/" + c.ResourceName
+		}
+		fmt.Printf("\n✗ %s\n", key)
+		fmt.Printf("  Affects: %s\n", strings.Join(names, ", "))
+		fmt.Printf("  %s\n", g.entry.Explanation)
+		if len(g.entry.Steps) > 0 {
+			first := g.resources[0]
+			if len(g.resources) > 1 {
+				fmt.Printf("  Next steps (for %s/%s):\n", first.ResourceNamespace, first.ResourceName)
+			} else {
+				fmt.Println("  Next steps:")
+			}
+			for _, s := range g.entry.nextSteps(first) {
+				fmt.Printf("    $ %s\n", s)
 			}
 		}
 	}
+}
 
-	return all
+func toRow(c *conditions.Info) []string {
+	// The icon shows health rather than status: a True Deleting or a False
+	// Paused condition is marked by what it means.
+	icon := "✓"
+	switch {
+	case c.IsHealthy():
+	case c.Status == "Unknown" || c.Status == "":
+		icon = "?"
+	default:
+		icon = "✗"
+	}
+	reason := c.Reason
+	if reason == "" {
+		reason = "-"
+	}
+	return []string{
+		c.ResourceKind,
+		c.ResourceNamespace + "/" + c.ResourceName,
+		c.ConditionType,
+		icon + " " + c.Status,
+		reason,
+	}
 }
 
-func printTable(conditions []conditionInfo, showAll bool) {
-	filtered := conditions
+func printTable(conds []conditions.Info, showAll bool) {
+	filtered := conds
 	if !showAll {
 		filtered = nil
-		for i := range conditions {
-			if !conditions[i].isHealthy() {
-				filtered = append(filtered, conditions[i])
+		for i := range conds {
+			if !conds[i].IsHealthy() {
+				filtered = append(filtered, conds[i])
 			}
 		}
 	}
@@ -167,7 +211,7 @@ func printTable(conditions []conditionInfo, showAll bool) {
 	headers := []string{"KIND", "RESOURCE", "CONDITION", "STATUS", "REASON"}
 	rows := make([][]string, len(filtered))
 	for i := range filtered {
-		rows[i] = filtered[i].toRow()
+		rows[i] = toRow(&filtered[i])
 	}
 
 	widths := make([]int, len(headers))
@@ -200,22 +244,142 @@ func printTable(conditions []conditionInfo, showAll bool) {
 	}
 }
 
-func printSummary(conditions []conditionInfo) {
-	total := len(conditions)
+// treeOrder sorts siblings the way clusterctl describe does: control plane
+// first, then workers, then the rest.
+var treeOrder = map[string]int{
+	"KubeadmControlPlane": 1, "MachineDeployment": 2, "MachinePool": 3, "MachineSet": 4,
+	"Machine": 5, "KubeadmConfig": 6, "MachineHealthCheck": 7,
+}
+
+// printTree prints resources under their controlling owners, Cluster →
+// KubeadmControlPlane/MachineDeployment → MachineSet → Machine. Resources
+// whose owner was not collected hang off their Cluster. Each resource lists
+// its unhealthy conditions (all with showAll) and how many unhealthy
+// conditions its descendants have.
+func printTree(resources []conditions.Resource, showAll bool) {
+	key := func(kind, ns, name string) string { return kind + "/" + ns + "/" + name }
+	byKey := map[string]*conditions.Resource{}
+	for i := range resources {
+		r := &resources[i]
+		byKey[key(r.Kind, r.Namespace, r.Name)] = r
+	}
+	children := map[string][]*conditions.Resource{}
+	var roots []*conditions.Resource
+	for i := range resources {
+		r := &resources[i]
+		parent := ""
+		if r.OwnerKind != "" && byKey[key(r.OwnerKind, r.Namespace, r.OwnerName)] != nil {
+			parent = key(r.OwnerKind, r.Namespace, r.OwnerName)
+		} else if r.Kind != "Cluster" && byKey[key("Cluster", r.Namespace, r.ClusterName)] != nil {
+			parent = key("Cluster", r.Namespace, r.ClusterName)
+		}
+		if parent == "" {
+			roots = append(roots, r)
+		} else {
+			children[parent] = append(children[parent], r)
+		}
+	}
+	less := func(list []*conditions.Resource) func(i, j int) bool {
+		return func(i, j int) bool {
+			a, b := list[i], list[j]
+			if treeOrder[a.Kind] != treeOrder[b.Kind] {
+				return treeOrder[a.Kind] < treeOrder[b.Kind]
+			}
+			if a.Namespace != b.Namespace {
+				return a.Namespace < b.Namespace
+			}
+			return a.Name < b.Name
+		}
+	}
+	sort.Slice(roots, less(roots))
+	for _, list := range children {
+		sort.Slice(list, less(list))
+	}
+
+	unhealthy := func(r *conditions.Resource) int {
+		n := 0
+		for i := range r.Conditions {
+			if !r.Conditions[i].IsHealthy() {
+				n++
+			}
+		}
+		return n
+	}
+	var below func(r *conditions.Resource) int
+	below = func(r *conditions.Resource) int {
+		n := 0
+		for _, c := range children[key(r.Kind, r.Namespace, r.Name)] {
+			n += unhealthy(c) + below(c)
+		}
+		return n
+	}
+
+	var walk func(r *conditions.Resource, prefix, branch, indent string)
+	walk = func(r *conditions.Resource, prefix, branch, indent string) {
+		mark := "✓"
+		switch {
+		case len(r.Conditions) == 0:
+			mark = "·"
+		case unhealthy(r) > 0:
+			mark = "✗"
+		}
+		name := r.Name
+		if branch == "" {
+			name = r.Namespace + "/" + r.Name
+		}
+		line := fmt.Sprintf("%s%s%s %s %s", prefix, branch, mark, r.Kind, name)
+		if n := below(r); n > 0 {
+			line += fmt.Sprintf("  [%d unhealthy below]", n)
+		}
+		fmt.Println(line)
+
+		kids := children[key(r.Kind, r.Namespace, r.Name)]
+		inner := prefix + indent
+		for i := range r.Conditions {
+			c := &r.Conditions[i]
+			if !showAll && c.IsHealthy() {
+				continue
+			}
+			guide := "  "
+			if len(kids) > 0 {
+				guide = "│ "
+			}
+			icon := toRow(c)[3]
+			fmt.Printf("%s%s    %s: %s", inner, guide, c.ConditionType, icon)
+			if c.Reason != "" {
+				fmt.Printf(" (%s)", c.Reason)
+			}
+			fmt.Println()
+		}
+		for i, k := range kids {
+			if i == len(kids)-1 {
+				walk(k, inner, "└─", "  ")
+			} else {
+				walk(k, inner, "├─", "│ ")
+			}
+		}
+	}
+	for _, r := range roots {
+		walk(r, "", "", "")
+	}
+}
+
+func printSummary(conds []conditions.Info) {
+	total := len(conds)
 	healthy := 0
-	for i := range conditions {
-		if conditions[i].isHealthy() {
+	for i := range conds {
+		if conds[i].IsHealthy() {
 			healthy++
 		}
 	}
 	unhealthy := total - healthy
 
 	byKind := map[string][3]int{} // total, healthy, unhealthy
-	for i := range conditions {
-		k := conditions[i].ResourceKind
+	for i := range conds {
+		k := conds[i].ResourceKind
 		counts := byKind[k]
 		counts[0]++
-		if conditions[i].isHealthy() {
+		if conds[i].IsHealthy() {
 			counts[1]++
 		} else {
 			counts[2]++
@@ -230,6 +394,19 @@ func printSummary(conditions []conditionInfo) {
 	fmt.Printf("  Healthy: %d ✓\n", healthy)
 	fmt.Printf("  Unhealthy: %d ✗\n", unhealthy)
 
+	flavors := map[string]int{}
+	for i := range conds {
+		flavors[conds[i].Version]++
+	}
+	if len(flavors) > 1 {
+		fmt.Printf("Condition semantics: %d %s, %d %s\n",
+			flavors[conditions.V1Beta1], conditions.V1Beta1, flavors[conditions.V1Beta2], conditions.V1Beta2)
+	} else {
+		for v := range flavors {
+			fmt.Printf("Condition semantics: %s\n", v)
+		}
+	}
+
 	fmt.Println("\nBy resource type:")
 	kinds := make([]string, 0, len(byKind))
 	for k := range byKind {
@@ -246,9 +423,9 @@ func printSummary(conditions []conditionInfo) {
 	}
 
 	unhealthyTypes := map[string]bool{}
-	for i := range conditions {
-		if !conditions[i].isHealthy() {
-			unhealthyTypes[conditions[i].ConditionType] = true
+	for i := range conds {
+		if !conds[i].IsHealthy() {
+			unhealthyTypes[conds[i].ConditionType] = true
 		}
 	}
 	if len(unhealthyTypes) > 0 {
@@ -264,26 +441,137 @@ func printSummary(conditions []conditionInfo) {
 	}
 }
 
-// helpers
-func getString(m map[string]interface{}, key, def string) string {
-	if v, ok := m[key].(string); ok {
-		return v
+// conditionKey identifies a condition across polls.
+func conditionKey(c *conditions.Info) string {
+	return c.ResourceKind + "/" + c.ResourceNamespace + "/" + c.ResourceName + "/" + c.ConditionType
+}
+
+func statusText(c *conditions.Info) string {
+	if c.Reason == "" {
+		return c.Status
 	}
-	return def
+	return c.Status + " (" + c.Reason + ")"
 }
 
-func getMap(m map[string]interface{}, key string) map[string]interface{} {
-	if v, ok := m[key].(map[string]interface{}); ok {
-		return v
+// colorEnabled reports whether watch output should use ANSI colors: only on
+// a terminal, and never with --no-color or NO_COLOR set.
+func colorEnabled(disabled bool) bool {
+	if disabled || os.Getenv("NO_COLOR") != "" {
+		return false
 	}
-	return map[string]interface{}{}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// transition is a condition that appeared, disappeared or changed status or
+// reason between two polls. Message-only changes are ignored, since progress
+// messages change on almost every reconcile.
+type transition struct {
+	Before, After *conditions.Info
 }
 
-func getSlice(m map[string]interface{}, key string) []interface{} {
-	if v, ok := m[key].([]interface{}); ok {
-		return v
+func diffConditions(prev, cur map[string]conditions.Info) []transition {
+	var out []transition
+	for k, c := range cur {
+		c := c
+		if p, ok := prev[k]; !ok {
+			out = append(out, transition{nil, &c})
+		} else if p.Status != c.Status || p.Reason != c.Reason {
+			out = append(out, transition{&p, &c})
+		}
+	}
+	for k, p := range prev {
+		p := p
+		if _, ok := cur[k]; !ok {
+			out = append(out, transition{&p, nil})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].After, out[j].After
+		if a == nil {
+			a = out[i].Before
+		}
+		if b == nil {
+			b = out[j].Before
+		}
+		return conditionKey(a) < conditionKey(b)
+	})
+	return out
+}
+
+// printTransition prints a transition diff-style: + for new conditions, -
+// for removed ones and ~ for changes, green when the condition became healthy
+// and red when it became unhealthy.
+func printTransition(t transition, now time.Time, color bool) {
+	c := t.After
+	if c == nil {
+		c = t.Before
+	}
+	resource := fmt.Sprintf("%s %s/%s %s", c.ResourceKind, c.ResourceNamespace, c.ResourceName, c.ConditionType)
+	var line, code string
+	switch {
+	case t.Before == nil:
+		line = fmt.Sprintf("+ %s: %s", resource, statusText(c))
+		code = "31"
+		if c.IsHealthy() {
+			code = "32"
+		}
+	case t.After == nil:
+		line = fmt.Sprintf("- %s (removed)", resource)
+		code = "90"
+	default:
+		line = fmt.Sprintf("~ %s: %s → %s", resource, statusText(t.Before), statusText(t.After))
+		switch {
+		case t.After.IsHealthy() && !t.Before.IsHealthy():
+			code = "32"
+		case !t.After.IsHealthy() && t.Before.IsHealthy():
+			code = "31"
+		default:
+			code = "33"
+		}
+	}
+	if color {
+		line = "\033[" + code + "m" + line + "\033[0m"
+	}
+	fmt.Printf("%s %s\n", now.Format("15:04:05"), line)
+}
+
+// watch prints the current conditions once, then only the transitions seen
+// on each poll until interrupted.
+func watch(namespace, cluster string, allNamespaces, showAll bool, version string, interval time.Duration, color bool) {
+	snapshot := func() map[string]conditions.Info {
+		state := map[string]conditions.Info{}
+		for _, c := range conditions.Collect(namespace, cluster, allNamespaces, version) {
+			state[conditionKey(&c)] = c
+		}
+		return state
+	}
+
+	prev := snapshot()
+	initial := make([]conditions.Info, 0, len(prev))
+	for _, c := range prev {
+		initial = append(initial, c)
+	}
+	sort.Slice(initial, func(i, j int) bool { return conditionKey(&initial[i]) < conditionKey(&initial[j]) })
+	printTable(initial, showAll)
+	fmt.Printf("\nWatching for condition transitions every %s (Ctrl-C to stop)\n", interval)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	for {
+		select {
+		case <-stop:
+			fmt.Println("Stopping")
+			return
+		case <-time.After(interval):
+		}
+		cur := snapshot()
+		now := time.Now()
+		for _, t := range diffConditions(prev, cur) {
+			printTransition(t, now, color)
+		}
+		prev = cur
 	}
-	return nil
 }
 
 func main() {
@@ -292,6 +580,12 @@ func main() {
 	allNamespaces := flag.Bool("A", false, "Analyze all namespaces")
 	showAll := flag.Bool("a", false, "Show all conditions, not just unhealthy")
 	format := flag.String("format", "table", "Output format: table, json, summary")
+	tree := flag.Bool("tree", false, "Show conditions in an ownership tree instead of a table")
+	watchMode := flag.Bool("w", false, "Watch and print condition transitions until interrupted")
+	interval := flag.Duration("interval", 10*time.Second, "Polling interval for -w")
+	noColor := flag.Bool("no-color", false, "Disable colored -w output")
+	noExplain := flag.Bool("no-explain", false, "Do not explain unhealthy conditions or suggest next steps")
+	version := flag.String("conditions-version", "auto", "Condition semantics: auto (per object), v1beta1, v1beta2")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nAnalyze conditions from CAPI resources.\n\nFlags:\n", os.Args[0])
@@ -299,15 +593,51 @@ func main() {
 	}
 	flag.Parse()
 
+	switch *version {
+	case "auto":
+		*version = ""
+	case conditions.V1Beta1, conditions.V1Beta2:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown --conditions-version %q (expected auto, v1beta1 or v1beta2)\n", *version)
+		os.Exit(1)
+	}
+
+	if *tree && (*format != "table" || *watchMode) {
+		fmt.Fprintln(os.Stderr, "Error: --tree only supports --format table and cannot be combined with -w")
+		os.Exit(1)
+	}
+
 	if kubectl.Find() == "" {
 		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
 		os.Exit(1)
 	}
 
+	if err := loadKnowledge(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *watchMode {
+		if *format != "table" {
+			fmt.Fprintln(os.Stderr, "Error: -w only supports --format table")
+			os.Exit(1)
+		}
+		if *interval <= 0 {
+			fmt.Fprintln(os.Stderr, "Error: --interval must be positive")
+			os.Exit(1)
+		}
+		watch(*namespace, *cluster, *allNamespaces, *showAll, *version, *interval, colorEnabled(*noColor))
+		return
+	}
+
 	fmt.Println("Collecting conditions from CAPI resources...")
-	conditions := collectAllConditions(*namespace, *cluster, *allNamespaces)
+	resources := conditions.CollectResources(*namespace, *cluster, *allNamespaces, *version)
+	var conds []conditions.Info
+	for _, r := range resources {
+		conds = append(conds, r.Conditions...)
+	}
 
-	if len(conditions) == 0 {
+	if len(resources) == 0 {
 		fmt.Println("No CAPI resources found")
 		os.Exit(0)
 	}
@@ -315,27 +645,43 @@ func main() {
 	switch *format {
 	case "json":
 		var output []map[string]interface{}
-		for _, c := range conditions {
-			output = append(output, map[string]interface{}{
+		for _, c := range conds {
+			entry := map[string]interface{}{
 				"resource":  c.ResourceKind + "/" + c.ResourceNamespace + "/" + c.ResourceName,
 				"condition": c.ConditionType,
 				"status":    c.Status,
 				"reason":    c.Reason,
 				"message":   c.Message,
-				"healthy":   c.isHealthy(),
-			})
+				"version":   c.Version,
+				"healthy":   c.IsHealthy(),
+			}
+			if e := explain(&c); e != nil && !c.IsHealthy() && !*noExplain {
+				entry["explanation"] = e.Explanation
+				entry["next_steps"] = e.nextSteps(&c)
+			}
+			output = append(output, entry)
 		}
 		data, _ := json.MarshalIndent(output, "", "  ")
 		fmt.Println(string(data))
 	case "summary":
-		printSummary(conditions)
+		printSummary(conds)
+		if !*noExplain {
+			printTriage(conds)
+		}
 	default:
-		printTable(conditions, *showAll)
-		printSummary(conditions)
+		if *tree {
+			printTree(resources, *showAll)
+		} else {
+			printTable(conds, *showAll)
+		}
+		printSummary(conds)
+		if !*noExplain {
+			printTriage(conds)
+		}
 	}
 
-	for _, c := range conditions {
-		if !c.isHealthy() {
+	for _, c := range conds {
+		if !c.IsHealthy() {
 			os.Exit(1)
 		}
 	}
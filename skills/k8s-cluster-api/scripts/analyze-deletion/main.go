@@ -0,0 +1,507 @@
+// analyze-deletion explains why a cluster is stuck in Deleting.
+//
+// It walks the cluster's ownership graph (every namespaced object of the
+// cluster.x-k8s.io API groups plus Secrets and ConfigMaps), lists the objects
+// that still exist with their finalizers, maps each finalizer to the provider
+// controller that owns it and reports whether that controller is running.
+// Objects whose finalizer owner is not installed are orphaned: nothing will
+// ever remove the finalizer. With --generate-patches, kubectl commands that
+// strip the finalizers of orphaned objects are printed; they are never
+// applied automatically because removing a finalizer can leak cloud resources.
+//
+// Usage:
+//
+//	go run ./analyze-deletion [flags] <cluster-name>
+//	go run ./analyze-deletion -A [flags]
+//
+// Examples:
+//
+//	go run ./analyze-deletion -n default my-cluster
+//	go run ./analyze-deletion -A
+//	go run ./analyze-deletion --generate-patches my-cluster
+//	go run ./analyze-deletion --format json -o deletion.json my-cluster
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const (
+	clusterNameLabel = "cluster.x-k8s.io/cluster-name"
+	providerLabel    = "cluster.x-k8s.io/provider"
+)
+
+type controller struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Provider  string `json:"provider"`
+	Status    string `json:"status"` // healthy, degraded, scaled-down, not-installed, builtin, unknown
+}
+
+type finalizer struct {
+	Name       string     `json:"name"`
+	Controller controller `json:"controller"`
+}
+
+type object struct {
+	Kind        string      `json:"kind"`
+	Name        string      `json:"name"`
+	Resource    string      `json:"resource"`
+	UID         string      `json:"uid"`
+	Deleting    bool        `json:"deleting"`
+	DeletingFor string      `json:"deleting_for,omitempty"`
+	Finalizers  []finalizer `json:"finalizers,omitempty"`
+	Children    int         `json:"remaining_children"`
+	Orphaned    bool        `json:"orphaned"`
+	Depth       int         `json:"depth"`
+	Reason      string      `json:"reason,omitempty"`
+
+	owners []string
+	item   map[string]interface{}
+}
+
+func (o *object) String() string { return o.Kind + "/" + o.Name }
+
+type analysis struct {
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	Deleting  bool      `json:"deleting"`
+	Paused    bool      `json:"paused"`
+	Objects   []*object `json:"objects"`
+	Blockers  []string  `json:"blockers"`
+	Patches   []string  `json:"patches,omitempty"`
+}
+
+// finalizerOwners maps finalizer domains to the provider label prefix of the
+// controller expected to remove them. More specific domains come first.
+var finalizerOwners = []struct {
+	suffix string
+	prefix string
+}{
+	{"infrastructure.cluster.x-k8s.io", "infrastructure-"},
+	{"controlplane.cluster.x-k8s.io", "control-plane-"},
+	{"bootstrap.cluster.x-k8s.io", "bootstrap-"},
+	{"ipam.cluster.x-k8s.io", "ipam-"},
+	{"addons.cluster.x-k8s.io", "cluster-api"},
+	{"cluster.x-k8s.io", "cluster-api"},
+}
+
+var builtinFinalizers = map[string]bool{
+	"kubernetes":         true,
+	"foregroundDeletion": true,
+	"orphan":             true,
+}
+
+// controllers returns provider controller health keyed by provider label.
+func controllers() map[string][]controller {
+	out := map[string][]controller{}
+	deployments, _ := kubectl.RunJSON("deployments", "", providerLabel, true)
+	for _, d := range deployments {
+		c := controller{
+			Name:      kubectl.GetString(d, "metadata.name"),
+			Namespace: kubectl.GetString(d, "metadata.namespace"),
+			Provider:  kubectl.Labels(d)[providerLabel],
+		}
+		desired, _ := kubectl.GetNested(d, "spec.replicas").(float64)
+		ready, _ := kubectl.GetNested(d, "status.readyReplicas").(float64)
+		switch {
+		case desired == 0:
+			c.Status = "scaled-down"
+		case ready < desired:
+			c.Status = "degraded"
+		default:
+			c.Status = "healthy"
+		}
+		out[c.Provider] = append(out[c.Provider], c)
+	}
+	return out
+}
+
+// ownerOf picks the controller responsible for a finalizer on an object.
+func ownerOf(name, kind string, ctrls map[string][]controller) controller {
+	if builtinFinalizers[name] || !strings.Contains(name, ".") {
+		return controller{Name: "kube-controller-manager", Provider: "kubernetes", Status: "builtin"}
+	}
+	domain := name
+	if i := strings.Index(domain, "/"); i >= 0 {
+		domain = domain[:i]
+	}
+	prefix := ""
+	for _, fo := range finalizerOwners {
+		if strings.HasSuffix(domain, fo.suffix) {
+			prefix = fo.prefix
+			break
+		}
+	}
+	if prefix == "" {
+		return controller{Provider: domain, Status: "unknown"}
+	}
+	if len(ctrls) == 0 {
+		// no provider deployments visible at all (likely RBAC); never treat
+		// that as proof a controller is missing
+		return controller{Provider: strings.TrimSuffix(prefix, "-"), Status: "unknown"}
+	}
+
+	var candidates []string
+	for provider := range ctrls {
+		if provider == prefix || (strings.HasSuffix(prefix, "-") && strings.HasPrefix(provider, prefix)) {
+			candidates = append(candidates, provider)
+		}
+	}
+	sort.Strings(candidates)
+	pick := ""
+	if len(candidates) == 1 {
+		pick = candidates[0]
+	}
+	lowerKind := strings.ToLower(kind)
+	for _, p := range candidates {
+		short := strings.ReplaceAll(strings.TrimPrefix(p, prefix), "-", "")
+		if short != "" && (strings.Contains(lowerKind, short) || strings.Contains(domain, short)) {
+			pick = p
+			break
+		}
+	}
+	if pick == "" {
+		return controller{Provider: strings.TrimSuffix(prefix, "-"), Status: "not-installed"}
+	}
+	// a provider may run several deployments; report the least healthy one
+	best := ctrls[pick][0]
+	for _, c := range ctrls[pick] {
+		if c.Status != "healthy" {
+			best = c
+		}
+	}
+	return best
+}
+
+func ownerUIDs(item map[string]interface{}) []string {
+	var uids []string
+	for _, r := range kubectl.GetSlice(kubectl.GetMap(item, "metadata"), "ownerReferences") {
+		if m, ok := r.(map[string]interface{}); ok {
+			if uid, _ := m["uid"].(string); uid != "" {
+				uids = append(uids, uid)
+			}
+		}
+	}
+	return uids
+}
+
+func resources() []string {
+	var res []string
+	crds, _ := kubectl.RunJSON("customresourcedefinitions", "", "", false)
+	for _, crd := range crds {
+		group := kubectl.GetString(crd, "spec.group")
+		if strings.HasSuffix(group, "cluster.x-k8s.io") && kubectl.GetString(crd, "spec.scope") == "Namespaced" {
+			res = append(res, kubectl.GetString(crd, "metadata.name"))
+		}
+	}
+	sort.Strings(res)
+	return append(res, "secrets", "configmaps")
+}
+
+func analyze(cluster, namespace string, res []string, ctrls map[string][]controller) (*analysis, error) {
+	a := &analysis{Cluster: cluster, Namespace: namespace, Blockers: []string{}}
+
+	var all []*object
+	byUID := map[string]*object{}
+	for _, r := range res {
+		items, _ := kubectl.RunJSON(r, namespace, "", false)
+		for _, item := range items {
+			o := &object{
+				Kind:     kubectl.GetString(item, "kind"),
+				Name:     kubectl.GetString(item, "metadata.name"),
+				Resource: r,
+				UID:      kubectl.GetString(item, "metadata.uid"),
+				owners:   ownerUIDs(item),
+				item:     item,
+			}
+			all = append(all, o)
+			byUID[o.UID] = o
+		}
+	}
+
+	var root *object
+	member := map[string]bool{}
+	for _, o := range all {
+		switch {
+		case o.Kind == "Cluster" && o.Resource == "clusters.cluster.x-k8s.io" && o.Name == cluster:
+			root = o
+			member[o.UID] = true
+		case kubectl.Labels(o.item)[clusterNameLabel] == cluster,
+			kubectl.GetString(o.item, "spec.clusterName") == cluster:
+			member[o.UID] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, o := range all {
+			if member[o.UID] {
+				continue
+			}
+			for _, uid := range o.owners {
+				if member[uid] {
+					member[o.UID] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	if root == nil && len(member) == 0 {
+		return nil, fmt.Errorf("cluster %s/%s not found and no objects reference it", namespace, cluster)
+	}
+	if root != nil {
+		a.Deleting = kubectl.GetString(root.item, "metadata.deletionTimestamp") != ""
+		paused, _ := kubectl.GetNested(root.item, "spec.paused").(bool)
+		_, annotated := kubectl.GetMap(kubectl.GetMap(root.item, "metadata"), "annotations")["cluster.x-k8s.io/paused"]
+		a.Paused = paused || annotated
+	}
+
+	for _, o := range all {
+		if member[o.UID] {
+			a.Objects = append(a.Objects, o)
+		}
+	}
+	for _, o := range a.Objects {
+		for _, uid := range o.owners {
+			if owner, ok := byUID[uid]; ok && member[uid] {
+				owner.Children++
+			}
+		}
+	}
+	for _, o := range a.Objects {
+		o.Depth = depth(o, byUID, map[string]bool{})
+		describe(o, ctrls)
+	}
+	sort.SliceStable(a.Objects, func(i, j int) bool {
+		if a.Objects[i].Depth != a.Objects[j].Depth {
+			return a.Objects[i].Depth < a.Objects[j].Depth
+		}
+		return a.Objects[i].String() < a.Objects[j].String()
+	})
+
+	if a.Paused {
+		a.Blockers = append(a.Blockers, "Cluster is paused: CAPI controllers will not process the deletion until it is unpaused")
+	}
+	for _, o := range a.Objects {
+		if o.Reason != "" {
+			a.Blockers = append(a.Blockers, fmt.Sprintf("%s: %s", o, o.Reason))
+		}
+	}
+	return a, nil
+}
+
+func depth(o *object, byUID map[string]*object, seen map[string]bool) int {
+	if seen[o.UID] {
+		return 0
+	}
+	seen[o.UID] = true
+	d := 0
+	for _, uid := range o.owners {
+		if owner, ok := byUID[uid]; ok {
+			if od := depth(owner, byUID, seen) + 1; od > d {
+				d = od
+			}
+		}
+	}
+	return d
+}
+
+// describe resolves finalizer owners and decides whether the object is the
+// point where deletion is blocked.
+func describe(o *object, ctrls map[string][]controller) {
+	if ts := kubectl.GetString(o.item, "metadata.deletionTimestamp"); ts != "" {
+		o.Deleting = true
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			o.DeletingFor = time.Since(t).Round(time.Second).String()
+		}
+	}
+	for _, f := range kubectl.GetSlice(kubectl.GetMap(o.item, "metadata"), "finalizers") {
+		name, _ := f.(string)
+		o.Finalizers = append(o.Finalizers, finalizer{Name: name, Controller: ownerOf(name, o.Kind, ctrls)})
+	}
+	if !o.Deleting || len(o.Finalizers) == 0 {
+		return
+	}
+
+	var missing, unhealthy []string
+	for _, f := range o.Finalizers {
+		switch f.Controller.Status {
+		case "not-installed":
+			missing = append(missing, fmt.Sprintf("%s (provider %s not installed)", f.Name, f.Controller.Provider))
+		case "scaled-down", "degraded":
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (%s/%s is %s)", f.Name, f.Controller.Namespace, f.Controller.Name, f.Controller.Status))
+		}
+	}
+	switch {
+	case len(missing) > 0:
+		o.Orphaned = o.Children == 0
+		o.Reason = "finalizer owner missing: " + strings.Join(missing, ", ")
+	case len(unhealthy) > 0:
+		o.Reason = "finalizer owner not running: " + strings.Join(unhealthy, ", ")
+	case o.Children > 0:
+		// waiting on children is expected; the blocker is further down
+	default:
+		names := make([]string, 0, len(o.Finalizers))
+		for _, f := range o.Finalizers {
+			names = append(names, f.Name)
+		}
+		o.Reason = fmt.Sprintf("waiting on finalizers %s; check the owning controller's logs and the object's conditions", strings.Join(names, ", "))
+	}
+}
+
+func patches(a *analysis) []string {
+	var out []string
+	for _, o := range a.Objects {
+		if !o.Orphaned {
+			continue
+		}
+		out = append(out, fmt.Sprintf("kubectl patch %s %s -n %s --type json -p '[{\"op\":\"remove\",\"path\":\"/metadata/finalizers\"}]'",
+			o.Resource, o.Name, a.Namespace))
+	}
+	return out
+}
+
+func printAnalysis(a *analysis) {
+	sep := strings.Repeat("=", 60)
+	state := "not deleting"
+	if a.Deleting {
+		state = "deleting"
+	}
+	fmt.Printf("\n%s\nDELETION ANALYSIS: %s/%s (%s)\n%s\n", sep, a.Namespace, a.Cluster, state, sep)
+
+	fmt.Printf("\nRemaining objects (%d):\n", len(a.Objects))
+	for _, o := range a.Objects {
+		icon := "  "
+		switch {
+		case o.Orphaned:
+			icon = "❌"
+		case o.Reason != "":
+			icon = "⚠️"
+		case o.Deleting:
+			icon = "⏳"
+		}
+		fmt.Printf("%s %s%s", icon, strings.Repeat("  ", o.Depth), o)
+		if o.Deleting {
+			fmt.Printf(" (deleting for %s)", o.DeletingFor)
+		}
+		if o.Children > 0 {
+			fmt.Printf(" [%d children]", o.Children)
+		}
+		fmt.Println()
+		for _, f := range o.Finalizers {
+			where := f.Controller.Provider
+			if f.Controller.Name != "" && f.Controller.Namespace != "" {
+				where = f.Controller.Namespace + "/" + f.Controller.Name
+			}
+			fmt.Printf("   %s  finalizer %s → %s (%s)\n", strings.Repeat("  ", o.Depth), f.Name, where, f.Controller.Status)
+		}
+	}
+
+	if len(a.Blockers) > 0 {
+		fmt.Println("\n🔴 Blockers:")
+		for _, b := range a.Blockers {
+			fmt.Printf("  - %s\n", b)
+		}
+	} else if a.Deleting {
+		fmt.Println("\n✅ No blockers found; deletion is progressing")
+	}
+
+	if len(a.Patches) > 0 {
+		fmt.Println("\n⚠️  Finalizer removal for orphaned objects (review first; may leak infrastructure):")
+		for _, p := range a.Patches {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace of the cluster")
+	allNS := flag.Bool("A", false, "Analyze every deleting cluster in all namespaces")
+	genPatches := flag.Bool("generate-patches", false, "Print finalizer-removal commands for orphaned objects")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <cluster-name>\n       %s -A [flags]\n\nExplain why a cluster is stuck deleting: remaining objects, finalizers and their controllers.\n\nFlags:\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if (flag.NArg() < 1) != *allNS {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	type target struct{ name, namespace string }
+	var targets []target
+	if *allNS {
+		clusters, err := kubectl.RunJSON("clusters.cluster.x-k8s.io", "", "", true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, c := range clusters {
+			if kubectl.GetString(c, "metadata.deletionTimestamp") != "" {
+				targets = append(targets, target{kubectl.GetString(c, "metadata.name"), kubectl.GetString(c, "metadata.namespace")})
+			}
+		}
+		if len(targets) == 0 {
+			fmt.Println("No clusters are being deleted")
+			return
+		}
+	} else {
+		targets = append(targets, target{flag.Arg(0), *namespace})
+	}
+
+	res := resources()
+	ctrls := controllers()
+	var results []*analysis
+	for _, t := range targets {
+		a, err := analyze(t.name, t.namespace, res, ctrls)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *genPatches {
+			a.Patches = patches(a)
+		}
+		results = append(results, a)
+	}
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		for _, a := range results {
+			printAnalysis(a)
+		}
+	}
+
+	for _, a := range results {
+		if len(a.Blockers) > 0 {
+			os.Exit(1)
+		}
+	}
+}
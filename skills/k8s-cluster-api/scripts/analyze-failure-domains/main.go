@@ -0,0 +1,369 @@
+// analyze-failure-domains reports how cluster machines are spread across failure domains.
+//
+// For each Cluster it reads the failure domains published in
+// Cluster.status.failureDomains and counts control plane and worker Machines
+// per domain. It flags control planes confined to a single domain, control
+// plane machines in domains not eligible for control plane, imbalanced
+// spreads, machines in unknown domains and MachineDeployments pinned to one
+// domain, and suggests rebalancing actions.
+//
+// Usage:
+//
+//	go run ./analyze-failure-domains [flags]
+//
+// Examples:
+//
+//	go run ./analyze-failure-domains -n default
+//	go run ./analyze-failure-domains -n default -c my-cluster
+//	go run ./analyze-failure-domains -A --format json -o fd.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const unassigned = "(none)"
+
+type finding struct {
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+type domain struct {
+	Name         string `json:"name"`
+	ControlPlane bool   `json:"control_plane_eligible"`
+	CPMachines   int    `json:"control_plane_machines"`
+	Workers      int    `json:"worker_machines"`
+	Known        bool   `json:"known"`
+}
+
+type clusterReport struct {
+	Namespace    string    `json:"namespace"`
+	Name         string    `json:"name"`
+	ControlPlane string    `json:"control_plane,omitempty"`
+	Domains      []*domain `json:"failure_domains"`
+	Findings     []finding `json:"findings,omitempty"`
+}
+
+func (c *clusterReport) add(sev, suggestion, format string, args ...interface{}) {
+	c.Findings = append(c.Findings, finding{sev, fmt.Sprintf(format, args...), suggestion})
+}
+
+func (c *clusterReport) domain(name string) *domain {
+	for _, d := range c.Domains {
+		if d.Name == name {
+			return d
+		}
+	}
+	d := &domain{Name: name}
+	c.Domains = append(c.Domains, d)
+	return d
+}
+
+// spread returns the min and max count over the given domains.
+func spread(domains []*domain, count func(*domain) int) (int, int, *domain, *domain) {
+	var lo, hi *domain
+	for _, d := range domains {
+		if lo == nil || count(d) < count(lo) {
+			lo = d
+		}
+		if hi == nil || count(d) > count(hi) {
+			hi = d
+		}
+	}
+	if lo == nil {
+		return 0, 0, nil, nil
+	}
+	return count(lo), count(hi), lo, hi
+}
+
+// failureDomains returns the failure domains a Cluster publishes and whether
+// each is eligible for control plane Machines. v1beta1 Clusters publish a map
+// keyed by name, v1beta2 Clusters a list of {name, controlPlane} entries.
+func failureDomains(cluster map[string]interface{}) map[string]bool {
+	fds := map[string]bool{}
+	switch v := kubectl.GetNested(cluster, "status.failureDomains").(type) {
+	case map[string]interface{}:
+		for name, fd := range v {
+			fm, _ := fd.(map[string]interface{})
+			fds[name], _ = fm["controlPlane"].(bool)
+		}
+	case []interface{}:
+		for _, fd := range v {
+			fm, _ := fd.(map[string]interface{})
+			if name, _ := fm["name"].(string); name != "" {
+				fds[name], _ = fm["controlPlane"].(bool)
+			}
+		}
+	}
+	return fds
+}
+
+func analyzeCluster(cluster map[string]interface{}, machines, mds []map[string]interface{}) *clusterReport {
+	c := &clusterReport{
+		Namespace: kubectl.GetString(cluster, "metadata.namespace"),
+		Name:      kubectl.GetString(cluster, "metadata.name"),
+	}
+	if kind := kubectl.GetString(cluster, "spec.controlPlaneRef.kind"); kind != "" {
+		c.ControlPlane = kind + "/" + kubectl.GetString(cluster, "spec.controlPlaneRef.name")
+	}
+
+	fds := failureDomains(cluster)
+	names := make([]string, 0, len(fds))
+	for n := range fds {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		d := c.domain(n)
+		d.Known = true
+		d.ControlPlane = fds[n]
+	}
+
+	cpTotal := 0
+	for _, m := range machines {
+		if kubectl.GetString(m, "spec.clusterName") != c.Name {
+			continue
+		}
+		fd := kubectl.GetString(m, "spec.failureDomain")
+		if fd == "" {
+			fd = unassigned
+		}
+		d := c.domain(fd)
+		if _, ok := kubectl.Labels(m)["cluster.x-k8s.io/control-plane"]; ok {
+			d.CPMachines++
+			cpTotal++
+		} else {
+			d.Workers++
+		}
+	}
+
+	var cpEligible, known []*domain
+	for _, d := range c.Domains {
+		if d.Known {
+			known = append(known, d)
+			if d.ControlPlane {
+				cpEligible = append(cpEligible, d)
+			}
+		}
+	}
+
+	// Control plane.
+	switch {
+	case len(fds) == 0:
+		c.add("warning", "Check that the infrastructure cluster publishes status.failureDomains (e.g. list subnets/zones in its spec)",
+			"Cluster publishes no failure domains; machines are placed without zone awareness")
+	case len(cpEligible) == 0 && cpTotal > 0:
+		c.add("error", "Mark at least three zones as controlPlane in the infrastructure cluster spec",
+			"No failure domain is eligible for control plane machines")
+	case len(cpEligible) == 1 && cpTotal > 1:
+		c.add("warning", "Add control-plane-eligible failure domains so etcd quorum survives a zone outage",
+			"Single-AZ control plane: all %d control plane machines can only go to %s", cpTotal, cpEligible[0].Name)
+	}
+	for _, d := range c.Domains {
+		if d.CPMachines == 0 {
+			continue
+		}
+		if !d.Known && d.Name != unassigned {
+			c.add("warning", "The domain may have been removed from the infrastructure cluster; roll out the control plane to move machines",
+				"%d control plane machines in unknown failure domain %s", d.CPMachines, d.Name)
+		} else if d.Known && !d.ControlPlane {
+			c.add("error", "Roll out the control plane so machines are recreated in eligible domains",
+				"%d control plane machines in %s, which is not eligible for control plane", d.CPMachines, d.Name)
+		}
+	}
+	if len(cpEligible) > 1 && cpTotal > 1 {
+		lo, hi, loD, hiD := spread(cpEligible, func(d *domain) int { return d.CPMachines })
+		usable := len(cpEligible)
+		if cpTotal < usable {
+			usable = cpTotal
+		}
+		used := 0
+		for _, d := range cpEligible {
+			if d.CPMachines > 0 {
+				used++
+			}
+		}
+		rollout := "Roll out the control plane (e.g. set spec.rolloutAfter on " + c.ControlPlane + "); KCP places new machines in the least-used domain"
+		switch {
+		case used == 1:
+			c.add("error", rollout, "All %d control plane machines are in %s although %d eligible domains exist", cpTotal, hiD.Name, len(cpEligible))
+		case hi*2 > cpTotal && cpTotal >= 3:
+			c.add("error", rollout, "%s holds %d of %d control plane machines; losing it loses etcd quorum", hiD.Name, hi, cpTotal)
+		case used < usable:
+			c.add("warning", rollout, "Control plane uses %d of %d eligible domains", used, usable)
+		case hi-lo > 1:
+			c.add("warning", rollout, "Control plane imbalance: %d machines in %s, %d in %s", hi, hiD.Name, lo, loD.Name)
+		}
+	}
+
+	// Workers.
+	workersTotal := 0
+	for _, d := range c.Domains {
+		workersTotal += d.Workers
+	}
+	if len(known) > 1 && workersTotal > 1 {
+		lo, hi, loD, hiD := spread(known, func(d *domain) int { return d.Workers })
+		if hi == workersTotal {
+			c.add("warning", "Create one MachineDeployment per failure domain (spec.template.spec.failureDomain) or spread the existing ones",
+				"All %d worker machines are in %s", workersTotal, hiD.Name)
+		} else if hi-lo > 1 {
+			c.add("info", fmt.Sprintf("Move about %d replicas from %s to %s", (hi-lo)/2, hiD.Name, loD.Name),
+				"Worker imbalance: %d machines in %s, %d in %s", hi, hiD.Name, lo, loD.Name)
+		}
+	}
+	for _, d := range c.Domains {
+		if d.Workers > 0 && !d.Known && d.Name != unassigned && len(fds) > 0 {
+			c.add("warning", "Update the MachineDeployment failureDomain to a domain listed in Cluster.status.failureDomains",
+				"%d worker machines in unknown failure domain %s", d.Workers, d.Name)
+		}
+	}
+	if len(known) > 1 {
+		perFD := map[string][]string{}
+		for _, md := range mds {
+			if kubectl.GetString(md, "spec.clusterName") != c.Name {
+				continue
+			}
+			fd := kubectl.GetString(md, "spec.template.spec.failureDomain")
+			perFD[fd] = append(perFD[fd], kubectl.GetString(md, "metadata.name"))
+		}
+		if len(perFD) == 1 {
+			for fd, list := range perFD {
+				if fd != "" {
+					c.add("warning", "Add MachineDeployments for the other failure domains",
+						"All MachineDeployments (%s) are pinned to %s", strings.Join(list, ", "), fd)
+				}
+			}
+		}
+		if list := perFD[""]; len(list) > 0 {
+			c.add("info", "Set spec.template.spec.failureDomain to control zone placement",
+				"MachineDeployments without failureDomain (placement left to the provider): %s", strings.Join(list, ", "))
+		}
+	}
+
+	sort.Slice(c.Domains, func(i, j int) bool { return c.Domains[i].Name < c.Domains[j].Name })
+	return c
+}
+
+func printReport(reports []*clusterReport) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nFAILURE DOMAIN SPREAD\n%s\n", sep, sep)
+	icons := map[string]string{"error": "🔴", "warning": "⚠️", "info": "ℹ️"}
+	for _, c := range reports {
+		icon := "✅"
+		for _, f := range c.Findings {
+			if f.Severity == "error" {
+				icon = "❌"
+				break
+			}
+			if f.Severity == "warning" {
+				icon = "⚠️"
+			}
+		}
+		fmt.Printf("\n%s Cluster %s/%s\n", icon, c.Namespace, c.Name)
+		if len(c.Domains) > 0 {
+			fmt.Printf("   %-24s %-4s %-14s %s\n", "FAILURE DOMAIN", "CP", "CONTROL PLANE", "WORKERS")
+			for _, d := range c.Domains {
+				eligible := "-"
+				if d.ControlPlane {
+					eligible = "yes"
+				}
+				name := d.Name
+				if !d.Known && d.Name != unassigned {
+					name += " (unknown)"
+				}
+				fmt.Printf("   %-24s %-4s %-14d %d\n", name, eligible, d.CPMachines, d.Workers)
+			}
+		}
+		for _, f := range c.Findings {
+			fmt.Printf("   %s %s\n", icons[f.Severity], f.Message)
+			if f.Suggestion != "" {
+				fmt.Printf("      → %s\n", f.Suggestion)
+			}
+		}
+	}
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace")
+	allNS := flag.Bool("A", false, "All namespaces")
+	cluster := flag.String("c", "", "Only analyze this cluster")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nReport control plane and worker spread across failure domains and suggest rebalancing.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	clusters, err := kubectl.RunJSON("clusters.cluster.x-k8s.io", *namespace, "", *allNS)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	machines, _ := kubectl.RunJSON("machines.cluster.x-k8s.io", *namespace, "", *allNS)
+	mds, _ := kubectl.RunJSON("machinedeployments.cluster.x-k8s.io", *namespace, "", *allNS)
+
+	byNS := func(items []map[string]interface{}, ns string) []map[string]interface{} {
+		var out []map[string]interface{}
+		for _, item := range items {
+			if kubectl.GetString(item, "metadata.namespace") == ns {
+				out = append(out, item)
+			}
+		}
+		return out
+	}
+
+	var reports []*clusterReport
+	failed := false
+	for _, cl := range clusters {
+		if *cluster != "" && kubectl.GetString(cl, "metadata.name") != *cluster {
+			continue
+		}
+		ns := kubectl.GetString(cl, "metadata.namespace")
+		r := analyzeCluster(cl, byNS(machines, ns), byNS(mds, ns))
+		for _, f := range r.Findings {
+			if f.Severity == "error" {
+				failed = true
+			}
+		}
+		reports = append(reports, r)
+	}
+	if len(reports) == 0 {
+		fmt.Println("No Clusters found")
+		return
+	}
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(reports, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(reports)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
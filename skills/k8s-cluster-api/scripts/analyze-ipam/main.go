@@ -0,0 +1,538 @@
+// analyze-ipam reports IP address pool utilization for CAPI IPAM providers.
+//
+// It relates IPAddressClaims and IPAddresses to the pools they reference,
+// reports per-pool utilization and the clusters consuming each pool, flags
+// pools nearing exhaustion, orphaned or unbound claims, leaked addresses,
+// duplicate allocations and address ranges that overlap other pools or the
+// pod/service networks of any cluster.
+//
+// Usage:
+//
+//	go run ./analyze-ipam [flags]
+//
+// Examples:
+//
+//	go run ./analyze-ipam -A
+//	go run ./analyze-ipam -n default -c my-cluster
+//	go run ./analyze-ipam -A --warn 70 --format json -o ipam.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const (
+	claimResource   = "ipaddressclaims.ipam.cluster.x-k8s.io"
+	addressResource = "ipaddresses.ipam.cluster.x-k8s.io"
+	clusterResource = "clusters.cluster.x-k8s.io"
+)
+
+type ipRange struct {
+	Start netip.Addr
+	End   netip.Addr
+}
+
+func (r ipRange) String() string {
+	if r.Start == r.End {
+		return r.Start.String()
+	}
+	return r.Start.String() + "-" + r.End.String()
+}
+
+func (r ipRange) overlaps(o ipRange) bool {
+	if r.Start.Is4() != o.Start.Is4() {
+		return false
+	}
+	return r.Start.Compare(o.End) <= 0 && o.Start.Compare(r.End) <= 0
+}
+
+func (r ipRange) size() *big.Int {
+	s := new(big.Int).SetBytes(r.Start.AsSlice())
+	e := new(big.Int).SetBytes(r.End.AsSlice())
+	return e.Sub(e, s).Add(e, big.NewInt(1))
+}
+
+// parseRange accepts a CIDR, an "a-b" range or a single address.
+func parseRange(s string) (ipRange, bool) {
+	s = strings.TrimSpace(s)
+	if p, err := netip.ParsePrefix(s); err == nil {
+		p = p.Masked()
+		start := p.Addr()
+		end := start
+		bits := start.BitLen() - p.Bits()
+		b := end.AsSlice()
+		for i := len(b) - 1; i >= 0 && bits > 0; i-- {
+			n := bits
+			if n > 8 {
+				n = 8
+			}
+			b[i] |= byte(1<<n - 1)
+			bits -= n
+		}
+		end, _ = netip.AddrFromSlice(b)
+		return ipRange{start, end}, true
+	}
+	if a, b, ok := strings.Cut(s, "-"); ok {
+		start, err1 := netip.ParseAddr(strings.TrimSpace(a))
+		end, err2 := netip.ParseAddr(strings.TrimSpace(b))
+		if err1 == nil && err2 == nil && start.Compare(end) <= 0 {
+			return ipRange{start, end}, true
+		}
+		return ipRange{}, false
+	}
+	if a, err := netip.ParseAddr(s); err == nil {
+		return ipRange{a, a}, true
+	}
+	return ipRange{}, false
+}
+
+type poolReport struct {
+	Kind        string   `json:"kind"`
+	Namespace   string   `json:"namespace,omitempty"`
+	Name        string   `json:"name"`
+	Ranges      []string `json:"ranges,omitempty"`
+	Total       int64    `json:"total"`
+	Used        int      `json:"used"`
+	Free        int64    `json:"free"`
+	Utilization float64  `json:"utilization_percent"`
+	Claims      int      `json:"claims"`
+	Pending     int      `json:"pending_claims"`
+	Clusters    []string `json:"clusters"`
+	Status      string   `json:"status"`
+
+	ranges []ipRange
+}
+
+type issue struct {
+	Severity string `json:"severity"`
+	Type     string `json:"type"`
+	Resource string `json:"resource"`
+	Message  string `json:"message"`
+}
+
+type ipamReport struct {
+	Pools  []poolReport `json:"pools"`
+	Issues []issue      `json:"issues"`
+}
+
+func poolKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func resourceFor(kind, group string) string {
+	if group == "" {
+		return strings.ToLower(kind)
+	}
+	return strings.ToLower(kind) + "." + group
+}
+
+func groupOf(apiVersion string) string {
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		return apiVersion[:i]
+	}
+	return ""
+}
+
+func clusterOf(item map[string]interface{}) string {
+	if c := kubectl.GetString(item, "spec.clusterName"); c != "" {
+		return c
+	}
+	labels := kubectl.GetMap(kubectl.GetMap(item, "metadata"), "labels")
+	c, _ := labels["cluster.x-k8s.io/cluster-name"].(string)
+	return c
+}
+
+// poolRanges extracts address ranges from the in-cluster provider
+// (spec.addresses), Metal3 (spec.pools) and generic (spec.subnet/cidr) pools.
+func poolRanges(pool map[string]interface{}) []ipRange {
+	spec := kubectl.GetMap(pool, "spec")
+	var ranges []ipRange
+	for _, a := range kubectl.GetSlice(spec, "addresses") {
+		if s, ok := a.(string); ok {
+			if r, ok := parseRange(s); ok {
+				ranges = append(ranges, r)
+			}
+		}
+	}
+	for _, p := range kubectl.GetSlice(spec, "pools") {
+		pm, _ := p.(map[string]interface{})
+		start, _ := pm["start"].(string)
+		end, _ := pm["end"].(string)
+		subnet, _ := pm["subnet"].(string)
+		switch {
+		case start != "" && end != "":
+			if r, ok := parseRange(start + "-" + end); ok {
+				ranges = append(ranges, r)
+			}
+		case subnet != "":
+			if r, ok := parseRange(subnet); ok {
+				ranges = append(ranges, r)
+			}
+		}
+	}
+	for _, key := range []string{"subnet", "cidr"} {
+		if s, ok := spec[key].(string); ok {
+			if r, ok := parseRange(s); ok {
+				ranges = append(ranges, r)
+			}
+		}
+	}
+	return ranges
+}
+
+func poolTotal(pool map[string]interface{}, ranges []ipRange) int64 {
+	if f, ok := kubectl.GetNested(pool, "status.ipAddresses.total").(float64); ok {
+		return int64(f)
+	}
+	total := new(big.Int)
+	for _, r := range ranges {
+		total.Add(total, r.size())
+	}
+	if !total.IsInt64() {
+		return 1<<63 - 1
+	}
+	return total.Int64()
+}
+
+type analyzer struct {
+	namespace string
+	allNS     bool
+	cluster   string
+	warn      float64
+	critical  float64
+
+	pools   map[string]*poolReport
+	issues  []issue
+	objects map[string]map[string]bool
+}
+
+func (a *analyzer) addIssue(sev, typ, resource, format string, args ...interface{}) {
+	a.issues = append(a.issues, issue{sev, typ, resource, fmt.Sprintf(format, args...)})
+}
+
+// exists reports whether the referenced object exists, listing each
+// resource type once per namespace.
+func (a *analyzer) exists(resource, namespace, name string) bool {
+	key := resource + "/" + namespace
+	if a.objects[key] == nil {
+		a.objects[key] = map[string]bool{}
+		items, _ := kubectl.RunJSON(resource, namespace, "", false)
+		for _, item := range items {
+			a.objects[key][kubectl.GetString(item, "metadata.name")] = true
+		}
+	}
+	return a.objects[key][name]
+}
+
+func (a *analyzer) pool(ref map[string]interface{}, claimNS string) *poolReport {
+	kind, _ := ref["kind"].(string)
+	name, _ := ref["name"].(string)
+	group, _ := ref["apiGroup"].(string)
+	ns := claimNS
+	if strings.HasPrefix(kind, "Global") {
+		ns = ""
+	}
+	key := poolKey(kind, ns, name)
+	if p := a.pools[key]; p != nil {
+		return p
+	}
+	p := &poolReport{Kind: kind, Namespace: ns, Name: name}
+	items, err := kubectl.RunJSON(resourceFor(kind, group)+"/"+name, ns, "", false)
+	if err != nil || len(items) == 0 {
+		p.Status = "missing"
+		a.addIssue("error", "missing-pool", key, "pool referenced by claims does not exist")
+	} else {
+		p.ranges = poolRanges(items[0])
+		p.Total = poolTotal(items[0], p.ranges)
+		for _, r := range p.ranges {
+			p.Ranges = append(p.Ranges, r.String())
+		}
+	}
+	a.pools[key] = p
+	return p
+}
+
+func (a *analyzer) run() ipamReport {
+	claims, err := kubectl.RunJSON(claimResource, a.namespace, "", a.allNS)
+	if err != nil {
+		kubectl.Errorf("Error listing IPAddressClaims: %v", err)
+	}
+	addresses, _ := kubectl.RunJSON(addressResource, a.namespace, "", a.allNS)
+	clusters, _ := kubectl.RunJSON(clusterResource, a.namespace, "", a.allNS)
+
+	clusterNames := map[string]bool{}
+	for _, c := range clusters {
+		clusterNames[kubectl.GetString(c, "metadata.namespace")+"/"+kubectl.GetString(c, "metadata.name")] = true
+	}
+
+	claimNames := map[string]bool{}
+	poolClusters := map[*poolReport]map[string]bool{}
+	for _, claim := range claims {
+		ns := kubectl.GetString(claim, "metadata.namespace")
+		name := kubectl.GetString(claim, "metadata.name")
+		cluster := clusterOf(claim)
+		if a.cluster != "" && cluster != a.cluster {
+			continue
+		}
+		res := "IPAddressClaim " + ns + "/" + name
+		claimNames[ns+"/"+name] = true
+
+		p := a.pool(kubectl.GetMap(kubectl.GetMap(claim, "spec"), "poolRef"), ns)
+		p.Claims++
+		if poolClusters[p] == nil {
+			poolClusters[p] = map[string]bool{}
+		}
+		if cluster != "" {
+			poolClusters[p][cluster] = true
+		}
+		if kubectl.GetString(claim, "status.addressRef.name") == "" {
+			p.Pending++
+			a.addIssue("warning", "unbound-claim", res, "claim has no allocated address (pool %s)", p.Name)
+		}
+
+		if cluster != "" && !clusterNames[ns+"/"+cluster] {
+			a.addIssue("warning", "orphaned-claim", res, "cluster %s no longer exists", cluster)
+			continue
+		}
+		owners := kubectl.GetSlice(kubectl.GetMap(claim, "metadata"), "ownerReferences")
+		if len(owners) == 0 {
+			a.addIssue("warning", "orphaned-claim", res, "claim has no owner references")
+		}
+		for _, o := range owners {
+			om, _ := o.(map[string]interface{})
+			kind, _ := om["kind"].(string)
+			ownerName, _ := om["name"].(string)
+			apiVersion, _ := om["apiVersion"].(string)
+			if !a.exists(resourceFor(kind, groupOf(apiVersion)), ns, ownerName) {
+				a.addIssue("warning", "orphaned-claim", res, "owner %s/%s no longer exists", kind, ownerName)
+			}
+		}
+	}
+
+	seen := map[string]string{}
+	for _, addr := range addresses {
+		ns := kubectl.GetString(addr, "metadata.namespace")
+		name := kubectl.GetString(addr, "metadata.name")
+		res := "IPAddress " + ns + "/" + name
+		ref := kubectl.GetMap(kubectl.GetMap(addr, "spec"), "poolRef")
+
+		// Utilization counts every allocation in a pool, but with -c only the
+		// pools used by that cluster are reported.
+		if len(ref) > 0 {
+			kind, _ := ref["kind"].(string)
+			poolName, _ := ref["name"].(string)
+			poolNS := ns
+			if strings.HasPrefix(kind, "Global") {
+				poolNS = ""
+			}
+			if p := a.pools[poolKey(kind, poolNS, poolName)]; p != nil || a.cluster == "" {
+				a.pool(ref, ns).Used++
+			}
+		}
+		if a.cluster != "" && clusterOf(addr) != a.cluster {
+			continue
+		}
+
+		claim := kubectl.GetString(addr, "spec.claimRef.name")
+		if claim != "" && !claimNames[ns+"/"+claim] {
+			a.addIssue("warning", "leaked-address", res, "claim %s no longer exists", claim)
+		}
+		ip := kubectl.GetString(addr, "spec.address")
+		poolName, _ := ref["name"].(string)
+		dupKey := poolName + "|" + ip
+		if other, dup := seen[dupKey]; dup && ip != "" {
+			a.addIssue("error", "duplicate-address", res, "address %s is also allocated to %s", ip, other)
+		} else {
+			seen[dupKey] = ns + "/" + name
+		}
+	}
+
+	keys := make([]string, 0, len(a.pools))
+	for k := range a.pools {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pools []poolReport
+	for _, k := range keys {
+		p := a.pools[k]
+		for c := range poolClusters[p] {
+			p.Clusters = append(p.Clusters, c)
+		}
+		sort.Strings(p.Clusters)
+		if p.Clusters == nil {
+			p.Clusters = []string{}
+		}
+		if p.Status == "missing" {
+			pools = append(pools, *p)
+			continue
+		}
+		if p.Total > 0 {
+			p.Free = p.Total - int64(p.Used)
+			p.Utilization = float64(p.Used) * 100 / float64(p.Total)
+		}
+		res := p.Kind + " " + strings.TrimPrefix(p.Namespace+"/"+p.Name, "/")
+		switch {
+		case p.Total == 0:
+			p.Status = "unknown"
+		case p.Free <= 0 && p.Pending > 0:
+			p.Status = "exhausted"
+			a.addIssue("error", "pool-exhausted", res, "no free addresses and %d claim(s) pending", p.Pending)
+		case p.Utilization >= a.critical:
+			p.Status = "critical"
+			a.addIssue("error", "pool-near-exhaustion", res, "%.0f%% used (%d free) — clusters: %s", p.Utilization, p.Free, strings.Join(p.Clusters, ", "))
+		case p.Utilization >= a.warn:
+			p.Status = "warning"
+			a.addIssue("warning", "pool-near-exhaustion", res, "%.0f%% used (%d free) — clusters: %s", p.Utilization, p.Free, strings.Join(p.Clusters, ", "))
+		default:
+			p.Status = "ok"
+		}
+		pools = append(pools, *p)
+	}
+
+	a.checkConflicts(pools, clusters)
+
+	if pools == nil {
+		pools = []poolReport{}
+	}
+	if a.issues == nil {
+		a.issues = []issue{}
+	}
+	return ipamReport{Pools: pools, Issues: a.issues}
+}
+
+// checkConflicts reports pool ranges overlapping each other and pool ranges
+// overlapping any cluster's pod or service CIDRs.
+func (a *analyzer) checkConflicts(pools []poolReport, clusters []map[string]interface{}) {
+	for i := range pools {
+		for j := i + 1; j < len(pools); j++ {
+			for _, r1 := range pools[i].ranges {
+				for _, r2 := range pools[j].ranges {
+					if r1.overlaps(r2) {
+						a.addIssue("error", "cidr-conflict", pools[i].Kind+" "+pools[i].Name,
+							"range %s overlaps %s %s range %s (clusters: %s / %s)", r1, pools[j].Kind, pools[j].Name, r2,
+							strings.Join(pools[i].Clusters, ","), strings.Join(pools[j].Clusters, ","))
+					}
+				}
+			}
+		}
+	}
+
+	for _, c := range clusters {
+		name := kubectl.GetString(c, "metadata.name")
+		network := kubectl.GetMap(kubectl.GetMap(c, "spec"), "clusterNetwork")
+		for _, netType := range []string{"pods", "services"} {
+			for _, b := range kubectl.GetSlice(kubectl.GetMap(network, netType), "cidrBlocks") {
+				s, _ := b.(string)
+				cr, ok := parseRange(s)
+				if !ok {
+					continue
+				}
+				for _, p := range pools {
+					for _, r := range p.ranges {
+						if cr.overlaps(r) {
+							a.addIssue("error", "cidr-conflict", "Cluster "+name,
+								"%s CIDR %s overlaps %s %s range %s", netType, s, p.Kind, p.Name, r)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func printReport(rep ipamReport) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("%s\nIPAM UTILIZATION\n%s\n", sep, sep)
+
+	if len(rep.Pools) == 0 {
+		fmt.Println("No IP pools referenced by IPAddressClaims")
+	} else {
+		icons := map[string]string{"ok": "✅", "warning": "⚠️", "critical": "❌", "exhausted": "❌", "missing": "❌", "unknown": "❓"}
+		fmt.Printf("\n   %-40s %7s %7s %7s %6s %8s  %s\n", "POOL", "TOTAL", "USED", "FREE", "USE%", "PENDING", "CLUSTERS")
+		for _, p := range rep.Pools {
+			name := p.Kind + " " + strings.TrimPrefix(p.Namespace+"/"+p.Name, "/")
+			total, free, pct := "-", "-", "-"
+			if p.Total > 0 {
+				total = fmt.Sprint(p.Total)
+				free = fmt.Sprint(p.Free)
+				pct = fmt.Sprintf("%.0f%%", p.Utilization)
+			}
+			fmt.Printf("%s %-40s %7s %7d %7s %6s %8d  %s\n", icons[p.Status], name, total, p.Used, free, pct, p.Pending, strings.Join(p.Clusters, ", "))
+		}
+	}
+
+	if len(rep.Issues) > 0 {
+		fmt.Printf("\n%s\nISSUES (%d)\n%s\n", sep, len(rep.Issues), sep)
+		for _, i := range rep.Issues {
+			icon := "⚠️"
+			if i.Severity == "error" {
+				icon = "❌"
+			}
+			fmt.Printf("%s [%s] %s: %s\n", icon, i.Type, i.Resource, i.Message)
+		}
+	} else {
+		fmt.Println("\n✅ No IPAM issues found")
+	}
+}
+
+func main() {
+	namespace := flag.String("n", "", "Namespace to analyze")
+	allNS := flag.Bool("A", false, "Analyze all namespaces")
+	cluster := flag.String("c", "", "Only consider claims of this cluster")
+	warn := flag.Float64("warn", 80, "Utilization percentage that triggers a warning")
+	critical := flag.Float64("critical", 95, "Utilization percentage that triggers an error")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nAnalyze IPAM pool utilization, orphaned claims and CIDR conflicts.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	a := &analyzer{
+		namespace: *namespace,
+		allNS:     *allNS,
+		cluster:   *cluster,
+		warn:      *warn,
+		critical:  *critical,
+		pools:     map[string]*poolReport{},
+		objects:   map[string]map[string]bool{},
+	}
+	rep := a.run()
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(rep, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(rep)
+	}
+
+	for _, i := range rep.Issues {
+		if i.Severity == "error" {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,599 @@
+// analyze-rollout inspects in-progress MachineDeployment and KubeadmControlPlane rollouts.
+//
+// For each rollout it reports old vs new MachineSets, per-machine phase
+// durations, surge/unavailable budget consumption and a completion estimate,
+// and flags machines that have been stuck longer than --stuck-after together
+// with the conditions blocking them.
+//
+// Usage:
+//
+//	go run ./analyze-rollout [flags] [md/<name> | kcp/<name>]
+//
+// Examples:
+//
+//	go run ./analyze-rollout -n default md/my-cluster-md-0
+//	go run ./analyze-rollout -n default kcp/my-cluster-control-plane
+//	go run ./analyze-rollout -c my-cluster -n default
+//	go run ./analyze-rollout -c my-cluster --stuck-after 20m --format json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s-cluster-api-tools/internal/health"
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const (
+	mdResource  = "machinedeployments.cluster.x-k8s.io"
+	msResource  = "machinesets.cluster.x-k8s.io"
+	kcpResource = "kubeadmcontrolplanes.controlplane.cluster.x-k8s.io"
+	mResource   = "machines.cluster.x-k8s.io"
+
+	revisionAnnotation = "machinedeployment.clusters.x-k8s.io/revision"
+)
+
+type phaseDurations struct {
+	Bootstrap      string `json:"bootstrap,omitempty"`
+	Infrastructure string `json:"infrastructure,omitempty"`
+	Node           string `json:"node,omitempty"`
+	Ready          string `json:"ready,omitempty"`
+	Deleting       string `json:"deleting,omitempty"`
+}
+
+type blockingCondition struct {
+	Type    string `json:"type"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type machineInfo struct {
+	Name       string              `json:"name"`
+	MachineSet string              `json:"machine_set,omitempty"`
+	Phase      string              `json:"phase"`
+	Version    string              `json:"version,omitempty"`
+	New        bool                `json:"new"`
+	Age        string              `json:"age"`
+	Durations  phaseDurations      `json:"durations"`
+	Stuck      bool                `json:"stuck"`
+	Blocking   []blockingCondition `json:"blocking,omitempty"`
+
+	readyAfter time.Duration
+	age        time.Duration
+}
+
+type machineSetInfo struct {
+	Name     string `json:"name"`
+	Revision string `json:"revision,omitempty"`
+	Replicas int    `json:"replicas"`
+	Ready    int    `json:"ready"`
+	Machines int    `json:"machines"`
+}
+
+type budget struct {
+	MaxSurge           int  `json:"max_surge"`
+	MaxUnavailable     int  `json:"max_unavailable"`
+	SurgeUsed          int  `json:"surge_used"`
+	UnavailableUsed    int  `json:"unavailable_used"`
+	SurgeExhausted     bool `json:"surge_exhausted"`
+	UnavailableExceeds bool `json:"unavailable_exceeds"`
+}
+
+type rolloutReport struct {
+	Kind          string           `json:"kind"`
+	Name          string           `json:"name"`
+	Namespace     string           `json:"namespace"`
+	TargetVersion string           `json:"target_version,omitempty"`
+	Desired       int              `json:"desired"`
+	Updated       int              `json:"updated"`
+	Ready         int              `json:"ready"`
+	Total         int              `json:"total"`
+	InProgress    bool             `json:"in_progress"`
+	Budget        budget           `json:"budget"`
+	NewMachineSet *machineSetInfo  `json:"new_machine_set,omitempty"`
+	OldMachineSet []machineSetInfo `json:"old_machine_sets,omitempty"`
+	Machines      []machineInfo    `json:"machines"`
+	StuckCount    int              `json:"stuck_count"`
+	AvgProvision  string           `json:"avg_provision,omitempty"`
+	ETA           string           `json:"eta,omitempty"`
+}
+
+func parseTime(s string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, s)
+	return t, err == nil
+}
+
+func shortDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.Round(time.Second).String()
+}
+
+// resolveBudget converts an int-or-percent rolling update value into machines,
+// rounding surge up and unavailability down like the CAPI controllers do.
+func resolveBudget(v interface{}, desired int, roundUp bool, def int) int {
+	switch val := v.(type) {
+	case float64:
+		return int(val)
+	case string:
+		if strings.HasSuffix(val, "%") {
+			pct, err := strconv.Atoi(strings.TrimSuffix(val, "%"))
+			if err != nil {
+				return def
+			}
+			f := float64(desired) * float64(pct) / 100
+			if roundUp {
+				return int(math.Ceil(f))
+			}
+			return int(math.Floor(f))
+		}
+		if n, err := strconv.Atoi(val); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// analyzeMachine derives phase durations from condition transition times and
+// marks the machine stuck if it has not become ready (or finished deleting)
+// within stuckAfter.
+func analyzeMachine(m map[string]interface{}, now time.Time, stuckAfter time.Duration) machineInfo {
+	info := machineInfo{
+		Name:    kubectl.GetString(m, "metadata.name"),
+		Phase:   kubectl.GetString(m, "status.phase"),
+		Version: kubectl.GetString(m, "spec.version"),
+	}
+	for _, ref := range kubectl.GetSlice(kubectl.GetMap(m, "metadata"), "ownerReferences") {
+		rm, _ := ref.(map[string]interface{})
+		if kind, _ := rm["kind"].(string); kind == "MachineSet" {
+			info.MachineSet, _ = rm["name"].(string)
+		}
+	}
+
+	created, ok := parseTime(kubectl.GetString(m, "metadata.creationTimestamp"))
+	if !ok {
+		created = now
+	}
+	info.age = now.Sub(created)
+	info.Age = shortDuration(info.age)
+
+	ready := false
+	var blocking []blockingCondition
+	for _, c := range health.GetConditions(m) {
+		cm, _ := c.(map[string]interface{})
+		condType, _ := cm["type"].(string)
+		status, _ := cm["status"].(string)
+		reason, _ := cm["reason"].(string)
+		message, _ := cm["message"].(string)
+		ltt, _ := cm["lastTransitionTime"].(string)
+		t, hasTime := parseTime(ltt)
+
+		if status == "True" && hasTime {
+			d := shortDuration(t.Sub(created))
+			switch condType {
+			case "BootstrapReady", "BootstrapConfigReady":
+				info.Durations.Bootstrap = d
+			case "InfrastructureReady":
+				info.Durations.Infrastructure = d
+			case "NodeHealthy", "NodeReady":
+				info.Durations.Node = d
+			case "Ready", "Available":
+				if info.Durations.Ready == "" {
+					info.Durations.Ready = d
+					info.readyAfter = t.Sub(created)
+				}
+			}
+		}
+		if (condType == "Ready" || condType == "Available") && status == "True" {
+			ready = true
+		}
+		if status == "False" {
+			blocking = append(blocking, blockingCondition{Type: condType, Reason: reason, Message: message})
+		}
+	}
+
+	if ts := kubectl.GetString(m, "metadata.deletionTimestamp"); ts != "" {
+		if t, ok := parseTime(ts); ok {
+			deleting := now.Sub(t)
+			info.Durations.Deleting = shortDuration(deleting)
+			if deleting > stuckAfter {
+				info.Stuck = true
+			}
+		}
+		if info.Phase == "" {
+			info.Phase = "Deleting"
+		}
+	} else if !ready && info.age > stuckAfter {
+		info.Stuck = true
+	}
+	if info.Stuck {
+		info.Blocking = blocking
+	}
+	return info
+}
+
+func estimate(report *rolloutReport, machines []machineInfo) {
+	var total time.Duration
+	samples := 0
+	for _, m := range machines {
+		if m.New && m.readyAfter > 0 {
+			total += m.readyAfter
+			samples++
+		}
+	}
+	if samples == 0 {
+		return
+	}
+	avg := total / time.Duration(samples)
+	report.AvgProvision = shortDuration(avg)
+	if !report.InProgress {
+		return
+	}
+
+	remaining := report.Desired - report.Updated
+	if remaining <= 0 {
+		remaining = 0
+	}
+	concurrency := report.Budget.MaxSurge + report.Budget.MaxUnavailable
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	waves := (remaining + concurrency - 1) / concurrency
+
+	// Credit the wave already in flight with the time it has been running.
+	var inFlight time.Duration
+	for _, m := range machines {
+		if m.New && m.readyAfter == 0 && m.Durations.Deleting == "" && m.age > inFlight {
+			inFlight = m.age
+		}
+	}
+	eta := time.Duration(waves)*avg - inFlight
+	if eta < 0 {
+		eta = 0
+	}
+	report.ETA = shortDuration(eta)
+	if report.ETA == "" {
+		report.ETA = "imminent"
+	}
+}
+
+func analyzeMachineDeployment(md map[string]interface{}, namespace string, stuckAfter time.Duration) rolloutReport {
+	now := time.Now()
+	name := kubectl.GetString(md, "metadata.name")
+	desired := kubectl.GetInt(md, "spec.replicas")
+	report := rolloutReport{
+		Kind:          "MachineDeployment",
+		Name:          name,
+		Namespace:     namespace,
+		TargetVersion: kubectl.GetString(md, "spec.template.spec.version"),
+		Desired:       desired,
+		Updated:       kubectl.GetInt(md, "status.updatedReplicas"),
+		Ready:         kubectl.GetInt(md, "status.readyReplicas"),
+		Total:         kubectl.GetInt(md, "status.replicas"),
+	}
+
+	ru := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(md, "spec"), "strategy"), "rollingUpdate")
+	report.Budget.MaxSurge = resolveBudget(ru["maxSurge"], desired, true, 1)
+	report.Budget.MaxUnavailable = resolveBudget(ru["maxUnavailable"], desired, false, 0)
+
+	label := "cluster.x-k8s.io/deployment-name=" + name
+	machineSets, _ := kubectl.RunJSON(msResource, namespace, label, false)
+	machines, _ := kubectl.RunJSON(mResource, namespace, label, false)
+
+	newest, newestRev := "", -1
+	sets := map[string]*machineSetInfo{}
+	for _, ms := range machineSets {
+		info := &machineSetInfo{
+			Name:     kubectl.GetString(ms, "metadata.name"),
+			Replicas: kubectl.GetInt(ms, "spec.replicas"),
+			Ready:    kubectl.GetInt(ms, "status.readyReplicas"),
+		}
+		annotations := kubectl.GetMap(kubectl.GetMap(ms, "metadata"), "annotations")
+		info.Revision, _ = annotations[revisionAnnotation].(string)
+		if rev, err := strconv.Atoi(info.Revision); err == nil && rev > newestRev {
+			newest, newestRev = info.Name, rev
+		}
+		sets[info.Name] = info
+	}
+
+	for _, m := range machines {
+		mi := analyzeMachine(m, now, stuckAfter)
+		mi.New = mi.MachineSet != "" && mi.MachineSet == newest
+		if ms := sets[mi.MachineSet]; ms != nil {
+			ms.Machines++
+		}
+		report.Machines = append(report.Machines, mi)
+	}
+
+	names := make([]string, 0, len(sets))
+	for n := range sets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if n == newest {
+			report.NewMachineSet = sets[n]
+		} else if sets[n].Replicas > 0 || sets[n].Machines > 0 {
+			report.OldMachineSet = append(report.OldMachineSet, *sets[n])
+		}
+	}
+
+	report.InProgress = len(report.OldMachineSet) > 0 || report.Updated < desired || report.Total != desired
+	finish(&report)
+	return report
+}
+
+func analyzeKCP(kcp map[string]interface{}, namespace string, stuckAfter time.Duration) rolloutReport {
+	now := time.Now()
+	name := kubectl.GetString(kcp, "metadata.name")
+	desired := kubectl.GetInt(kcp, "spec.replicas")
+	target := kubectl.GetString(kcp, "spec.version")
+	report := rolloutReport{
+		Kind:          "KubeadmControlPlane",
+		Name:          name,
+		Namespace:     namespace,
+		TargetVersion: target,
+		Desired:       desired,
+		Updated:       kubectl.GetInt(kcp, "status.updatedReplicas"),
+		Ready:         kubectl.GetInt(kcp, "status.readyReplicas"),
+		Total:         kubectl.GetInt(kcp, "status.replicas"),
+	}
+
+	// KCP never reduces availability during a rollout; only surge is tunable.
+	ru := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(kcp, "spec"), "rolloutStrategy"), "rollingUpdate")
+	report.Budget.MaxSurge = resolveBudget(ru["maxSurge"], desired, true, 1)
+
+	machines, _ := kubectl.RunJSON(mResource, namespace, "cluster.x-k8s.io/control-plane-name="+name, false)
+	for _, m := range machines {
+		mi := analyzeMachine(m, now, stuckAfter)
+		mi.New = mi.Version == target
+		report.Machines = append(report.Machines, mi)
+	}
+
+	report.InProgress = report.Updated < desired || report.Total != desired
+	finish(&report)
+	return report
+}
+
+func finish(report *rolloutReport) {
+	sort.Slice(report.Machines, func(i, j int) bool {
+		if report.Machines[i].New != report.Machines[j].New {
+			return !report.Machines[i].New
+		}
+		return report.Machines[i].Name < report.Machines[j].Name
+	})
+
+	b := &report.Budget
+	if report.Total > report.Desired {
+		b.SurgeUsed = report.Total - report.Desired
+	}
+	if report.Ready < report.Desired {
+		b.UnavailableUsed = report.Desired - report.Ready
+	}
+	b.SurgeExhausted = report.InProgress && b.SurgeUsed >= b.MaxSurge
+	b.UnavailableExceeds = b.UnavailableUsed > b.MaxUnavailable
+
+	for _, m := range report.Machines {
+		if m.Stuck {
+			report.StuckCount++
+		}
+	}
+	estimate(report, report.Machines)
+	if report.Machines == nil {
+		report.Machines = []machineInfo{}
+	}
+}
+
+func collect(cluster, namespace, target string, stuckAfter time.Duration) ([]rolloutReport, error) {
+	var reports []rolloutReport
+	if target != "" {
+		kind, name, ok := strings.Cut(target, "/")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("target must be md/<name> or kcp/<name>, got %q", target)
+		}
+		switch strings.ToLower(kind) {
+		case "md", "machinedeployment":
+			items, err := kubectl.RunJSON(mdResource+"/"+name, namespace, "", false)
+			if err != nil {
+				return nil, err
+			}
+			for _, md := range items {
+				reports = append(reports, analyzeMachineDeployment(md, namespace, stuckAfter))
+			}
+		case "kcp", "kubeadmcontrolplane":
+			items, err := kubectl.RunJSON(kcpResource+"/"+name, namespace, "", false)
+			if err != nil {
+				return nil, err
+			}
+			for _, kcp := range items {
+				reports = append(reports, analyzeKCP(kcp, namespace, stuckAfter))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported kind %q (use md or kcp)", kind)
+		}
+		return reports, nil
+	}
+
+	clusters, err := kubectl.RunJSON("clusters.cluster.x-k8s.io/"+cluster, namespace, "", false)
+	if err != nil {
+		return nil, err
+	}
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("cluster %s/%s not found", namespace, cluster)
+	}
+	cpRef := kubectl.GetMap(kubectl.GetMap(clusters[0], "spec"), "controlPlaneRef")
+	if kind, _ := cpRef["kind"].(string); kind == "KubeadmControlPlane" {
+		cpName, _ := cpRef["name"].(string)
+		kcps, _ := kubectl.RunJSON(kcpResource+"/"+cpName, namespace, "", false)
+		for _, kcp := range kcps {
+			reports = append(reports, analyzeKCP(kcp, namespace, stuckAfter))
+		}
+	}
+
+	label := "cluster.x-k8s.io/cluster-name=" + cluster
+	mds, err := kubectl.RunJSON(mdResource, namespace, label, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, md := range mds {
+		reports = append(reports, analyzeMachineDeployment(md, namespace, stuckAfter))
+	}
+	return reports, nil
+}
+
+func printReport(r rolloutReport) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\n%s %s/%s\n%s\n", sep, r.Kind, r.Namespace, r.Name, sep)
+
+	status := "✅ Rollout complete"
+	if r.InProgress {
+		status = "🔄 Rollout in progress"
+	}
+	fmt.Println(status)
+	if r.TargetVersion != "" {
+		fmt.Printf("  Target version: %s\n", r.TargetVersion)
+	}
+	fmt.Printf("  Replicas: desired=%d total=%d updated=%d ready=%d\n", r.Desired, r.Total, r.Updated, r.Ready)
+
+	surgeIcon, unavailIcon := "", ""
+	if r.Budget.SurgeExhausted {
+		surgeIcon = " ⚠️ exhausted"
+	}
+	if r.Budget.UnavailableExceeds {
+		unavailIcon = " ❌ over budget"
+	}
+	fmt.Printf("  Surge budget:       %d/%d%s\n", r.Budget.SurgeUsed, r.Budget.MaxSurge, surgeIcon)
+	fmt.Printf("  Unavailable budget: %d/%d%s\n", r.Budget.UnavailableUsed, r.Budget.MaxUnavailable, unavailIcon)
+
+	if r.NewMachineSet != nil || len(r.OldMachineSet) > 0 {
+		fmt.Println("\nMachineSets:")
+		if ms := r.NewMachineSet; ms != nil {
+			fmt.Printf("  [new] %s (rev %s) replicas=%d ready=%d machines=%d\n", ms.Name, ms.Revision, ms.Replicas, ms.Ready, ms.Machines)
+		}
+		for _, ms := range r.OldMachineSet {
+			fmt.Printf("  [old] %s (rev %s) replicas=%d ready=%d machines=%d\n", ms.Name, ms.Revision, ms.Replicas, ms.Ready, ms.Machines)
+		}
+	}
+
+	if len(r.Machines) > 0 {
+		fmt.Println("\nMachines:")
+		fmt.Printf("  %-40s %-4s %-12s %-8s %-10s %-10s %-10s %s\n", "NAME", "REV", "PHASE", "AGE", "BOOTSTRAP", "INFRA", "READY", "DELETING")
+		for _, m := range r.Machines {
+			rev := "old"
+			if m.New {
+				rev = "new"
+			}
+			name := m.Name
+			if m.Stuck {
+				name = "⚠️ " + name
+			}
+			fmt.Printf("  %-40s %-4s %-12s %-8s %-10s %-10s %-10s %s\n", name, rev, m.Phase, m.Age,
+				dash(m.Durations.Bootstrap), dash(m.Durations.Infrastructure), dash(m.Durations.Ready), dash(m.Durations.Deleting))
+		}
+	}
+
+	if r.StuckCount > 0 {
+		fmt.Printf("\n❌ Stuck machines: %d\n", r.StuckCount)
+		for _, m := range r.Machines {
+			if !m.Stuck {
+				continue
+			}
+			fmt.Printf("  %s (%s, age %s)\n", m.Name, m.Phase, m.Age)
+			for _, b := range m.Blocking {
+				line := "    - " + b.Type
+				if b.Reason != "" {
+					line += ": " + b.Reason
+				}
+				if b.Message != "" {
+					line += " — " + b.Message
+				}
+				fmt.Println(line)
+			}
+		}
+	}
+
+	if r.AvgProvision != "" {
+		fmt.Printf("\nAverage time to ready: %s\n", r.AvgProvision)
+	}
+	if r.InProgress {
+		if r.ETA != "" {
+			fmt.Printf("Predicted completion: ~%s\n", r.ETA)
+		} else {
+			fmt.Println("Predicted completion: unknown (no new machine has become ready yet)")
+		}
+	}
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func main() {
+	cluster := flag.String("c", "", "Analyze all rollouts of this cluster")
+	namespace := flag.String("n", "default", "Namespace")
+	stuckAfter := flag.Duration("stuck-after", 15*time.Minute, "Flag machines not ready (or not deleted) after this long")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [md/<name> | kcp/<name>]\n\nAnalyze in-progress MachineDeployment and KubeadmControlPlane rollouts.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	target := flag.Arg(0)
+	if target == "" && *cluster == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	reports, err := collect(*cluster, *namespace, target, *stuckAfter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(reports) == 0 {
+		fmt.Println("No rollouts found")
+		os.Exit(0)
+	}
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(reports, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		for _, r := range reports {
+			printReport(r)
+		}
+	}
+
+	for _, r := range reports {
+		if r.StuckCount > 0 {
+			os.Exit(1)
+		}
+	}
+}
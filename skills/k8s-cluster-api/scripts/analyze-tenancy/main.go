@@ -0,0 +1,446 @@
+// analyze-tenancy checks whether tenants of a shared management cluster are isolated.
+//
+// A tenant is a namespace holding Clusters. The tool inspects the namespace
+// layout, cross-namespace references (ClusterClass classNamespace and
+// infrastructure/control plane refs), RBAC bindings that grant lifecycle
+// verbs on Clusters and read access to Secrets (which hold workload
+// kubeconfigs), and reports which principals can read or affect which
+// tenants. Provider controllers and system principals are excluded.
+//
+// Usage:
+//
+//	go run ./analyze-tenancy [flags]
+//
+// Examples:
+//
+//	go run ./analyze-tenancy
+//	go run ./analyze-tenancy -n team-a
+//	go run ./analyze-tenancy --format json -o tenancy.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+var lifecycleVerbs = []string{"create", "update", "patch", "delete"}
+var readVerbs = []string{"get", "list", "watch"}
+
+type finding struct {
+	Severity string `json:"severity"`
+	Category string `json:"category"`
+	Tenant   string `json:"tenant,omitempty"`
+	Message  string `json:"message"`
+}
+
+type tenant struct {
+	Namespace     string   `json:"namespace"`
+	Clusters      []string `json:"clusters"`
+	LifecycleBy   []string `json:"lifecycle_access"`
+	SecretReadBy  []string `json:"secret_read_access"`
+	SharedClasses []string `json:"shared_classes,omitempty"`
+	Isolated      bool     `json:"isolated"`
+}
+
+type report struct {
+	Tenants  []*tenant `json:"tenants"`
+	Findings []finding `json:"findings"`
+}
+
+func (r *report) add(sev, cat, t, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, finding{sev, cat, t, fmt.Sprintf(format, args...)})
+}
+
+// grant is one subject's access through one binding.
+type grant struct {
+	subject   string
+	namespace string // "" for cluster-wide
+	binding   string
+	rules     []interface{}
+}
+
+func contains(list []interface{}, values ...string) bool {
+	for _, v := range list {
+		s, _ := v.(string)
+		for _, want := range values {
+			if s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allows reports whether rules grant any of verbs on group/resource without a
+// resourceNames restriction.
+func allows(rules []interface{}, group, resource string, verbs []string) bool {
+	for _, r := range rules {
+		rm, _ := r.(map[string]interface{})
+		if len(kubectl.GetSlice(rm, "resourceNames")) > 0 {
+			continue
+		}
+		if !contains(kubectl.GetSlice(rm, "apiGroups"), group, "*") {
+			continue
+		}
+		if !contains(kubectl.GetSlice(rm, "resources"), resource, "*") {
+			continue
+		}
+		if contains(kubectl.GetSlice(rm, "verbs"), append(verbs, "*")...) {
+			return true
+		}
+	}
+	return false
+}
+
+func subjectKey(s map[string]interface{}, bindingNS string) string {
+	kind, _ := s["kind"].(string)
+	name, _ := s["name"].(string)
+	if kind == "ServiceAccount" {
+		ns, _ := s["namespace"].(string)
+		if ns == "" {
+			ns = bindingNS
+		}
+		return "ServiceAccount:" + ns + "/" + name
+	}
+	return kind + ":" + name
+}
+
+// systemSubject filters principals that legitimately manage every tenant.
+func systemSubject(key string, systemNS map[string]bool) bool {
+	switch {
+	case strings.HasPrefix(key, "User:system:"), strings.HasPrefix(key, "Group:system:"):
+		return true
+	case strings.HasPrefix(key, "ServiceAccount:"):
+		ns := strings.SplitN(strings.TrimPrefix(key, "ServiceAccount:"), "/", 2)[0]
+		return systemNS[ns]
+	}
+	return false
+}
+
+func loadGrants() []grant {
+	roles := map[string][]interface{}{}
+	crs, _ := kubectl.RunJSON("clusterroles", "", "", false)
+	for _, r := range crs {
+		roles["ClusterRole/"+kubectl.GetString(r, "metadata.name")] = kubectl.GetSlice(r, "rules")
+	}
+	rs, _ := kubectl.RunJSON("roles", "", "", true)
+	for _, r := range rs {
+		roles["Role/"+kubectl.GetString(r, "metadata.namespace")+"/"+kubectl.GetString(r, "metadata.name")] = kubectl.GetSlice(r, "rules")
+	}
+
+	var grants []grant
+	add := func(b map[string]interface{}, ns string) {
+		refKind := kubectl.GetString(b, "roleRef.kind")
+		refName := kubectl.GetString(b, "roleRef.name")
+		key := "ClusterRole/" + refName
+		if refKind == "Role" {
+			key = "Role/" + ns + "/" + refName
+		}
+		rules := roles[key]
+		if len(rules) == 0 {
+			return
+		}
+		bname := kubectl.GetString(b, "kind") + "/" + kubectl.GetString(b, "metadata.name")
+		if ns != "" {
+			bname = kubectl.GetString(b, "kind") + "/" + ns + "/" + kubectl.GetString(b, "metadata.name")
+		}
+		for _, s := range kubectl.GetSlice(b, "subjects") {
+			sm, _ := s.(map[string]interface{})
+			grants = append(grants, grant{subject: subjectKey(sm, ns), namespace: ns, binding: bname, rules: rules})
+		}
+	}
+	crbs, _ := kubectl.RunJSON("clusterrolebindings", "", "", false)
+	for _, b := range crbs {
+		add(b, "")
+	}
+	rbs, _ := kubectl.RunJSON("rolebindings", "", "", true)
+	for _, b := range rbs {
+		add(b, kubectl.GetString(b, "metadata.namespace"))
+	}
+	return grants
+}
+
+// systemNamespaces are namespaces running provider controllers plus the
+// usual platform namespaces.
+func systemNamespaces() map[string]bool {
+	ns := map[string]bool{"kube-system": true, "cert-manager": true}
+	deployments, _ := kubectl.RunJSON("deployments", "", "cluster.x-k8s.io/provider", true)
+	for _, d := range deployments {
+		ns[kubectl.GetString(d, "metadata.namespace")] = true
+	}
+	return ns
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func analyze(onlyNS string) (*report, error) {
+	r := &report{Findings: []finding{}}
+	clusters, err := kubectl.RunJSON("clusters.cluster.x-k8s.io", "", "", true)
+	if err != nil {
+		return nil, err
+	}
+	systemNS := systemNamespaces()
+
+	tenants := map[string]*tenant{}
+	for _, c := range clusters {
+		ns := kubectl.GetString(c, "metadata.namespace")
+		name := kubectl.GetString(c, "metadata.name")
+		t := tenants[ns]
+		if t == nil {
+			t = &tenant{Namespace: ns}
+			tenants[ns] = t
+		}
+		t.Clusters = append(t.Clusters, name)
+
+		if classNS := kubectl.GetString(c, "spec.topology.classNamespace"); classNS != "" && classNS != ns {
+			ref := classNS + "/" + kubectl.GetString(c, "spec.topology.class")
+			if !containsString(t.SharedClasses, ref) {
+				t.SharedClasses = append(t.SharedClasses, ref)
+			}
+		}
+		for _, refPath := range []string{"spec.infrastructureRef", "spec.controlPlaneRef"} {
+			if refNS := kubectl.GetString(c, refPath+".namespace"); refNS != "" && refNS != ns {
+				r.add("error", "References", ns, "Cluster %s references %s in namespace %s via %s", name, kubectl.GetString(c, refPath+".name"), refNS, refPath)
+			}
+		}
+	}
+
+	for ns, t := range tenants {
+		switch {
+		case systemNS[ns]:
+			r.add("error", "Layout", ns, "Clusters live in system namespace %s next to provider controllers", ns)
+		case ns == "default":
+			r.add("warning", "Layout", ns, "Clusters in the default namespace are hard to isolate; give each tenant its own namespace")
+		}
+		for _, ref := range t.SharedClasses {
+			classNS := strings.SplitN(ref, "/", 2)[0]
+			if other, ok := tenants[classNS]; ok && classNS != ns {
+				r.add("warning", "ClusterClass", ns, "Uses ClusterClass %s owned by tenant %s; that tenant can change this tenant's clusters", ref, other.Namespace)
+			} else {
+				r.add("info", "ClusterClass", ns, "Uses shared ClusterClass %s; whoever can edit it affects this tenant", ref)
+			}
+		}
+	}
+
+	grants := loadGrants()
+	// namespaces each non-system principal has lifecycle access in
+	lifecycleNS := map[string]map[string]bool{}
+	for _, g := range grants {
+		if systemSubject(g.subject, systemNS) {
+			continue
+		}
+		lifecycle := allows(g.rules, "cluster.x-k8s.io", "clusters", lifecycleVerbs)
+		secrets := allows(g.rules, "", "secrets", readVerbs)
+		if !lifecycle && !secrets {
+			continue
+		}
+		var scope []*tenant
+		if g.namespace == "" {
+			for _, t := range tenants {
+				scope = append(scope, t)
+			}
+			if lifecycle {
+				r.add("error", "RBAC", "", "%s can create/update/delete Clusters in every namespace via %s", g.subject, g.binding)
+			}
+			if secrets {
+				r.add("error", "Secrets", "", "%s can read Secrets (workload kubeconfigs) in every namespace via %s", g.subject, g.binding)
+			}
+		} else if t, ok := tenants[g.namespace]; ok {
+			scope = append(scope, t)
+			if strings.HasPrefix(g.subject, "ServiceAccount:") {
+				saNS := strings.SplitN(strings.TrimPrefix(g.subject, "ServiceAccount:"), "/", 2)[0]
+				if _, other := tenants[saNS]; other && saNS != g.namespace {
+					r.add("warning", "RBAC", g.namespace, "ServiceAccount of tenant %s (%s) has access here via %s", saNS, g.subject, g.binding)
+				}
+			}
+		}
+		for _, t := range scope {
+			if lifecycle {
+				t.LifecycleBy = appendUnique(t.LifecycleBy, g.subject)
+				if lifecycleNS[g.subject] == nil {
+					lifecycleNS[g.subject] = map[string]bool{}
+				}
+				lifecycleNS[g.subject][t.Namespace] = true
+			}
+			if secrets {
+				t.SecretReadBy = appendUnique(t.SecretReadBy, g.subject)
+			}
+		}
+	}
+
+	for subject, nss := range lifecycleNS {
+		if len(nss) > 1 && len(nss) < len(tenants) {
+			r.add("info", "RBAC", "", "%s manages clusters in several tenants: %s", subject, strings.Join(sortedKeys(nss), ", "))
+		}
+	}
+
+	var names []string
+	for ns := range tenants {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	for _, ns := range names {
+		if onlyNS != "" && ns != onlyNS {
+			continue
+		}
+		t := tenants[ns]
+		sort.Strings(t.Clusters)
+		sort.Strings(t.LifecycleBy)
+		sort.Strings(t.SecretReadBy)
+		t.Isolated = true
+		r.Tenants = append(r.Tenants, t)
+	}
+
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		if r.Findings[i].Tenant != r.Findings[j].Tenant {
+			return r.Findings[i].Tenant < r.Findings[j].Tenant
+		}
+		return r.Findings[i].Message < r.Findings[j].Message
+	})
+
+	// a tenant is isolated when no finding scoped to it or to everyone is
+	// an error or warning
+	for _, f := range r.Findings {
+		if f.Severity == "info" {
+			continue
+		}
+		for _, t := range r.Tenants {
+			if f.Tenant == "" || f.Tenant == t.Namespace {
+				t.Isolated = false
+			}
+		}
+	}
+	if onlyNS != "" {
+		var kept []finding
+		for _, f := range r.Findings {
+			if f.Tenant == "" || f.Tenant == onlyNS {
+				kept = append(kept, f)
+			}
+		}
+		r.Findings = append([]finding{}, kept...)
+	}
+	return r, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(list []string, s string) []string {
+	if containsString(list, s) {
+		return list
+	}
+	return append(list, s)
+}
+
+func printReport(r *report) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nTENANCY ISOLATION REPORT\n%s\n", sep, sep)
+
+	for _, t := range r.Tenants {
+		icon := "✅"
+		if !t.Isolated {
+			icon = "❌"
+		}
+		fmt.Printf("\n%s Tenant %s (%d clusters: %s)\n", icon, t.Namespace, len(t.Clusters), strings.Join(t.Clusters, ", "))
+		fmt.Printf("  Cluster lifecycle access: %s\n", orNone(t.LifecycleBy))
+		fmt.Printf("  Secret read access:       %s\n", orNone(t.SecretReadBy))
+		if len(t.SharedClasses) > 0 {
+			fmt.Printf("  Shared ClusterClasses:    %s\n", strings.Join(t.SharedClasses, ", "))
+		}
+	}
+
+	icons := map[string]string{"error": "🔴", "warning": "⚠️", "info": "ℹ️"}
+	for _, sev := range []string{"error", "warning", "info"} {
+		var filtered []finding
+		for _, f := range r.Findings {
+			if f.Severity == sev {
+				filtered = append(filtered, f)
+			}
+		}
+		if len(filtered) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s %s (%d)\n", icons[sev], strings.ToUpper(sev), len(filtered))
+		for _, f := range filtered {
+			scope := "all tenants"
+			if f.Tenant != "" {
+				scope = f.Tenant
+			}
+			fmt.Printf("  [%s] (%s) %s\n", f.Category, scope, f.Message)
+		}
+	}
+}
+
+func orNone(list []string) string {
+	if len(list) == 0 {
+		return "none (besides system principals)"
+	}
+	return strings.Join(list, ", ")
+}
+
+func main() {
+	namespace := flag.String("n", "", "Only report on this tenant namespace")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nCheck whether tenants in a shared management cluster can read or affect each other's clusters.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	r, err := analyze(*namespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(r.Tenants) == 0 {
+		fmt.Println("No Clusters found")
+		return
+	}
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(r, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(r)
+	}
+
+	for _, t := range r.Tenants {
+		if !t.Isolated {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+// analyze-webhooks checks the health of CAPI and provider admission webhooks.
+//
+// For every validating and mutating webhook that intercepts a
+// *cluster.x-k8s.io group (or belongs to a provider) it verifies that the
+// backing Service exists and has ready endpoints, that the caBundle and the
+// serving certificate mounted by the webhook Deployment are valid, match each
+// other and are not about to expire, and that failurePolicy/timeoutSeconds do
+// not let a broken webhook block the API server. Admission latency is then
+// measured with timed server-side dry-run updates of an existing object,
+// compared against a plain GET of the same object.
+//
+// Usage:
+//
+//	go run ./analyze-webhooks [flags]
+//
+// Examples:
+//
+//	go run ./analyze-webhooks
+//	go run ./analyze-webhooks --no-probe --warn-days 60
+//	go run ./analyze-webhooks --samples 5 --format json -o webhooks.json
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+type finding struct {
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type webhook struct {
+	Configuration  string    `json:"configuration"`
+	Type           string    `json:"type"` // validating, mutating
+	Name           string    `json:"name"`
+	Target         string    `json:"target"`
+	FailurePolicy  string    `json:"failure_policy"`
+	TimeoutSeconds int       `json:"timeout_seconds"`
+	SideEffects    string    `json:"side_effects"`
+	Resources      []string  `json:"resources"`
+	ReadyEndpoints int       `json:"ready_endpoints"`
+	CAExpires      string    `json:"ca_expires,omitempty"`
+	CertExpires    string    `json:"serving_cert_expires,omitempty"`
+	ProbedObject   string    `json:"probed_object,omitempty"`
+	LatencyMs      int64     `json:"latency_ms,omitempty"`
+	OverheadMs     int64     `json:"overhead_ms,omitempty"`
+	Findings       []finding `json:"findings,omitempty"`
+}
+
+func (w *webhook) add(sev, format string, args ...interface{}) {
+	w.Findings = append(w.Findings, finding{sev, fmt.Sprintf(format, args...)})
+}
+
+func (w *webhook) worst() string {
+	worst := ""
+	for _, f := range w.Findings {
+		if f.Severity == "error" {
+			return "error"
+		}
+		if f.Severity == "warning" {
+			worst = "warning"
+		}
+	}
+	return worst
+}
+
+func parseCerts(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if c, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, c)
+		}
+	}
+}
+
+func getJSON(args ...string) map[string]interface{} {
+	ok, out, _ := kubectl.Run(append([]string{"get"}, append(args, "-o", "json")...), kubectl.DefaultTimeout)
+	if !ok {
+		return nil
+	}
+	var obj map[string]interface{}
+	if json.Unmarshal([]byte(out), &obj) != nil {
+		return nil
+	}
+	return obj
+}
+
+func nested(item map[string]interface{}, path string) map[string]interface{} {
+	m, _ := kubectl.GetNested(item, path).(map[string]interface{})
+	return m
+}
+
+// servingCert finds the TLS certificate mounted by the workload behind a
+// Service, following the Service selector to a Deployment's secret volumes.
+func servingCert(namespace string, selector map[string]interface{}) ([]*x509.Certificate, string) {
+	if len(selector) == 0 {
+		return nil, ""
+	}
+	deployments, _ := kubectl.RunJSON("deployments", namespace, "", false)
+	for _, d := range deployments {
+		labels := map[string]string{}
+		for k, v := range nested(d, "spec.template.metadata.labels") {
+			labels[k], _ = v.(string)
+		}
+		match := true
+		for k, v := range selector {
+			if s, _ := v.(string); labels[k] != s {
+				match = false
+			}
+		}
+		if !match {
+			continue
+		}
+		for _, v := range kubectl.GetSlice(nested(d, "spec.template.spec"), "volumes") {
+			vm, _ := v.(map[string]interface{})
+			name := kubectl.GetString(vm, "secret.secretName")
+			if name == "" {
+				continue
+			}
+			secret := getJSON("secret", name, "-n", namespace)
+			raw, _ := nested(secret, "data")["tls.crt"].(string)
+			data, err := base64.StdEncoding.DecodeString(raw)
+			if err != nil || len(data) == 0 {
+				continue
+			}
+			if certs := parseCerts(data); len(certs) > 0 {
+				return certs, namespace + "/" + name
+			}
+		}
+	}
+	return nil, ""
+}
+
+func checkCerts(w *webhook, caBundle string, serving []*x509.Certificate, secret string, warnDays int) {
+	now := time.Now()
+	expiry := func(what string, c *x509.Certificate) string {
+		days := int(c.NotAfter.Sub(now).Hours() / 24)
+		switch {
+		case now.After(c.NotAfter):
+			w.add("error", "%s expired on %s", what, c.NotAfter.Format("2006-01-02"))
+		case days < warnDays:
+			w.add("warning", "%s expires in %d days (%s)", what, days, c.NotAfter.Format("2006-01-02"))
+		}
+		return c.NotAfter.Format(time.RFC3339)
+	}
+
+	var cas []*x509.Certificate
+	if data, err := base64.StdEncoding.DecodeString(caBundle); err == nil {
+		cas = parseCerts(data)
+	}
+	if len(cas) == 0 {
+		w.add("error", "caBundle is empty or invalid; the API server cannot verify the webhook (is cert-manager's CA injector running?)")
+	} else {
+		w.CAExpires = expiry("caBundle certificate", cas[0])
+	}
+
+	if len(serving) == 0 {
+		if strings.HasPrefix(w.Target, "service ") {
+			w.add("info", "Serving certificate not found in the webhook Deployment's secret volumes; expiry not checked")
+		}
+		return
+	}
+	w.CertExpires = expiry("Serving certificate "+secret, serving[0])
+	if len(cas) > 0 {
+		pool := x509.NewCertPool()
+		for _, c := range cas {
+			pool.AddCert(c)
+		}
+		intermediates := x509.NewCertPool()
+		for _, c := range serving[1:] {
+			intermediates.AddCert(c)
+		}
+		if _, err := serving[0].Verify(x509.VerifyOptions{Roots: pool, Intermediates: intermediates, CurrentTime: now}); err != nil {
+			w.add("error", "Serving certificate %s is not signed by the caBundle: %v", secret, err)
+		}
+	}
+}
+
+// probeTarget finds an existing object a webhook intercepts on UPDATE.
+func probeTarget(rules []interface{}) (string, string) {
+	for _, r := range rules {
+		rm, _ := r.(map[string]interface{})
+		ops := strings.Join(stringList(kubectl.GetSlice(rm, "operations")), ",")
+		if !strings.Contains(ops, "UPDATE") && !strings.Contains(ops, "*") {
+			continue
+		}
+		for _, g := range stringList(kubectl.GetSlice(rm, "apiGroups")) {
+			for _, res := range stringList(kubectl.GetSlice(rm, "resources")) {
+				if strings.Contains(res, "/") || res == "*" || g == "*" {
+					continue
+				}
+				resource := res
+				if g != "" {
+					resource += "." + g
+				}
+				items, _ := kubectl.RunJSON(resource, "", "", true)
+				if len(items) > 0 {
+					ns := kubectl.GetString(items[0], "metadata.namespace")
+					return resource + "/" + kubectl.GetString(items[0], "metadata.name"), ns
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+func stringList(list []interface{}) []string {
+	var out []string
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func timed(args []string, samples int) (time.Duration, bool) {
+	var durations []time.Duration
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		ok, _, _ := kubectl.Run(args, kubectl.DefaultTimeout)
+		if !ok {
+			return 0, false
+		}
+		durations = append(durations, time.Since(start))
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations[len(durations)/2], true
+}
+
+func probe(w *webhook, object, namespace string, samples int) {
+	w.ProbedObject = object
+	nsArgs := []string{}
+	if namespace != "" {
+		nsArgs = []string{"-n", namespace}
+	}
+	baseline, ok := timed(append([]string{"get", object, "-o", "name"}, nsArgs...), samples)
+	if !ok {
+		return
+	}
+	args := append([]string{"annotate", object, "--overwrite", "--dry-run=server",
+		fmt.Sprintf("capi-tools/webhook-probe=%d", time.Now().Unix())}, nsArgs...)
+	latency, ok := timed(args, samples)
+	if !ok {
+		_, _, errMsg := kubectl.Run(args, kubectl.DefaultTimeout)
+		w.add("error", "Dry-run update of %s failed: %s", object, strings.TrimSpace(errMsg))
+		return
+	}
+	w.LatencyMs = latency.Milliseconds()
+	w.OverheadMs = (latency - baseline).Milliseconds()
+	if w.OverheadMs < 0 {
+		w.OverheadMs = 0
+	}
+	if w.TimeoutSeconds > 0 && w.OverheadMs > int64(w.TimeoutSeconds)*500 {
+		w.add("warning", "Admission overhead %dms is more than half of timeoutSeconds=%d", w.OverheadMs, w.TimeoutSeconds)
+	} else if w.OverheadMs > 1000 {
+		w.add("warning", "Admission overhead %dms", w.OverheadMs)
+	}
+}
+
+func relevant(hook map[string]interface{}, config map[string]interface{}) bool {
+	if kubectl.Labels(config)["cluster.x-k8s.io/provider"] != "" {
+		return true
+	}
+	for _, r := range kubectl.GetSlice(hook, "rules") {
+		rm, _ := r.(map[string]interface{})
+		for _, g := range stringList(kubectl.GetSlice(rm, "apiGroups")) {
+			if strings.HasSuffix(g, "cluster.x-k8s.io") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func analyze(all, doProbe bool, samples, warnDays int) []*webhook {
+	var result []*webhook
+	certCache := map[string][]*x509.Certificate{}
+	secretCache := map[string]string{}
+	endpointsCache := map[string]int{}
+	probed := map[string]bool{}
+
+	for _, kind := range []struct{ resource, typ string }{
+		{"validatingwebhookconfigurations", "validating"},
+		{"mutatingwebhookconfigurations", "mutating"},
+	} {
+		configs, _ := kubectl.RunJSON(kind.resource, "", "", false)
+		for _, cfg := range configs {
+			for _, h := range kubectl.GetSlice(cfg, "webhooks") {
+				hook, _ := h.(map[string]interface{})
+				if !all && !relevant(hook, cfg) {
+					continue
+				}
+				timeout, _ := hook["timeoutSeconds"].(float64)
+				w := &webhook{
+					Configuration:  kubectl.GetString(cfg, "metadata.name"),
+					Type:           kind.typ,
+					Name:           kubectl.GetString(hook, "name"),
+					FailurePolicy:  kubectl.GetString(hook, "failurePolicy"),
+					TimeoutSeconds: int(timeout),
+					SideEffects:    kubectl.GetString(hook, "sideEffects"),
+				}
+				for _, r := range kubectl.GetSlice(hook, "rules") {
+					rm, _ := r.(map[string]interface{})
+					w.Resources = append(w.Resources, stringList(kubectl.GetSlice(rm, "resources"))...)
+				}
+				checkWebhook(w, hook, certCache, secretCache, endpointsCache, warnDays)
+
+				if doProbe && w.ReadyEndpoints > 0 {
+					if w.SideEffects != "None" && w.SideEffects != "NoneOnDryRun" {
+						w.add("info", "sideEffects=%s; dry-run requests skip this webhook, latency not measured", w.SideEffects)
+					} else if object, ns := probeTarget(kubectl.GetSlice(hook, "rules")); object != "" && !probed[w.Configuration+object] {
+						probed[w.Configuration+object] = true
+						probe(w, object, ns, samples)
+					}
+				}
+				result = append(result, w)
+			}
+		}
+	}
+	return result
+}
+
+func checkWebhook(w *webhook, hook map[string]interface{}, certCache map[string][]*x509.Certificate,
+	secretCache map[string]string, endpointsCache map[string]int, warnDays int) {
+	client := nested(hook, "clientConfig")
+	caBundle := kubectl.GetString(client, "caBundle")
+	var serving []*x509.Certificate
+	secret := ""
+
+	if url := kubectl.GetString(client, "url"); url != "" {
+		w.Target = "url " + url
+		w.ReadyEndpoints = -1
+	} else {
+		ns := kubectl.GetString(client, "service.namespace")
+		name := kubectl.GetString(client, "service.name")
+		w.Target = "service " + ns + "/" + name
+		key := ns + "/" + name
+		svc := getJSON("service", name, "-n", ns)
+		if svc == nil {
+			w.add("error", "Service %s not found", key)
+		} else {
+			ready, ok := endpointsCache[key]
+			if !ok {
+				ep := getJSON("endpoints", name, "-n", ns)
+				for _, s := range kubectl.GetSlice(ep, "subsets") {
+					sm, _ := s.(map[string]interface{})
+					ready += len(kubectl.GetSlice(sm, "addresses"))
+				}
+				endpointsCache[key] = ready
+			}
+			w.ReadyEndpoints = ready
+			if ready == 0 {
+				w.add("error", "Service %s has no ready endpoints; the webhook controller is down", key)
+			} else if ready == 1 {
+				w.add("info", "Only one ready endpoint; a controller restart makes the webhook unavailable briefly")
+			}
+			if _, ok := certCache[key]; !ok {
+				certCache[key], secretCache[key] = servingCert(ns, nested(svc, "spec.selector"))
+			}
+			serving, secret = certCache[key], secretCache[key]
+		}
+	}
+	checkCerts(w, caBundle, serving, secret, warnDays)
+
+	if w.FailurePolicy == "" {
+		w.FailurePolicy = "Fail"
+	}
+	if w.FailurePolicy == "Fail" {
+		if w.ReadyEndpoints == 0 {
+			w.add("error", "failurePolicy=Fail with an unavailable backend blocks all create/update of %s", strings.Join(w.Resources, ", "))
+		}
+		for _, r := range w.Resources {
+			if r == "*" || r == "*/*" || r == "namespaces" || r == "pods" {
+				w.add("warning", "failurePolicy=Fail on %q reaches beyond CAPI objects and can block unrelated API traffic", r)
+				break
+			}
+		}
+	}
+	if w.TimeoutSeconds > 10 {
+		w.add("warning", "timeoutSeconds=%d; a hung webhook stalls API requests that long", w.TimeoutSeconds)
+	}
+}
+
+func printReport(hooks []*webhook) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nWEBHOOK HEALTH\n%s\n", sep, sep)
+	icons := map[string]string{"error": "🔴", "warning": "⚠️", "info": "ℹ️"}
+	config := ""
+	for _, w := range hooks {
+		if w.Configuration != config {
+			config = w.Configuration
+			fmt.Printf("\n%s (%s)\n", config, w.Type)
+		}
+		icon := map[string]string{"": "✅", "warning": "⚠️", "error": "❌"}[w.worst()]
+		fmt.Printf("  %s %s\n", icon, w.Name)
+		fmt.Printf("     Target: %s, failurePolicy=%s, timeout=%ds", w.Target, w.FailurePolicy, w.TimeoutSeconds)
+		if w.ReadyEndpoints >= 0 {
+			fmt.Printf(", endpoints=%d", w.ReadyEndpoints)
+		}
+		fmt.Println()
+		if w.CertExpires != "" {
+			fmt.Printf("     Serving cert expires: %s\n", w.CertExpires)
+		}
+		if w.ProbedObject != "" && w.LatencyMs > 0 {
+			fmt.Printf("     Latency: %dms (overhead %dms) on %s\n", w.LatencyMs, w.OverheadMs, w.ProbedObject)
+		}
+		for _, f := range w.Findings {
+			fmt.Printf("     %s %s\n", icons[f.Severity], f.Message)
+		}
+	}
+}
+
+func main() {
+	all := flag.Bool("all", false, "Include webhooks unrelated to Cluster API")
+	noProbe := flag.Bool("no-probe", false, "Skip dry-run latency measurement")
+	samples := flag.Int("samples", 3, "Dry-run samples per webhook (median is reported)")
+	warnDays := flag.Int("warn-days", 30, "Warn when certificates expire within this many days")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nCheck CAPI/provider webhook backends, certificates, failure policies and admission latency.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *samples < 1 {
+		*samples = 1
+	}
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	hooks := analyze(*all, !*noProbe, *samples, *warnDays)
+	if len(hooks) == 0 {
+		fmt.Println("No Cluster API webhooks found")
+		return
+	}
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(hooks, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(hooks)
+	}
+
+	for _, w := range hooks {
+		if w.worst() == "error" {
+			os.Exit(1)
+		}
+	}
+}
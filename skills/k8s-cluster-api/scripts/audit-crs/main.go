@@ -0,0 +1,415 @@
+// audit-crs audits ClusterResourceSet bindings per cluster.
+//
+// For every cluster it reports which ClusterResourceSets select it and, per
+// addon resource, whether it was applied successfully, failed or was never
+// applied. It also lists clusters that match no ClusterResourceSet and CRS
+// resources that do not exist. With --drift the payload objects in the CRS
+// ConfigMaps/Secrets are compared against the workload clusters.
+//
+// Usage:
+//
+//	go run ./audit-crs [flags]
+//
+// Examples:
+//
+//	go run ./audit-crs -n default
+//	go run ./audit-crs -A
+//	go run ./audit-crs -n default -c my-cluster --drift
+//	go run ./audit-crs -A --format json -o crs.json
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const (
+	crsResource     = "clusterresourcesets.addons.cluster.x-k8s.io"
+	bindingResource = "clusterresourcesetbindings.addons.cluster.x-k8s.io"
+	clusterResource = "clusters.cluster.x-k8s.io"
+
+	maxDriftPaths = 10
+)
+
+type resourceStatus struct {
+	Kind        string   `json:"kind"`
+	Name        string   `json:"name"`
+	Status      string   `json:"status"` // applied, failed, not-applied, missing
+	LastApplied string   `json:"last_applied,omitempty"`
+	Drift       []string `json:"drift,omitempty"`
+}
+
+type crsStatus struct {
+	Name      string           `json:"name"`
+	Strategy  string           `json:"strategy"`
+	Resources []resourceStatus `json:"resources"`
+}
+
+type clusterAudit struct {
+	Cluster   string      `json:"cluster"`
+	Namespace string      `json:"namespace"`
+	Sets      []crsStatus `json:"cluster_resource_sets"`
+	DriftNote string      `json:"drift_note,omitempty"`
+}
+
+type auditReport struct {
+	Clusters  []clusterAudit `json:"clusters"`
+	Unmatched []string       `json:"clusters_without_crs"`
+	Missing   []string       `json:"missing_resources"`
+}
+
+type bindingEntry struct {
+	Applied     bool
+	LastApplied string
+}
+
+// bindingsFor indexes a ClusterResourceSetBinding by "crs/kind/name".
+func bindingsFor(binding map[string]interface{}) map[string]bindingEntry {
+	out := map[string]bindingEntry{}
+	for _, b := range kubectl.GetSlice(kubectl.GetMap(binding, "spec"), "bindings") {
+		bm, _ := b.(map[string]interface{})
+		crs, _ := bm["clusterResourceSetName"].(string)
+		for _, r := range kubectl.GetSlice(bm, "resources") {
+			rm, _ := r.(map[string]interface{})
+			kind, _ := rm["kind"].(string)
+			name, _ := rm["name"].(string)
+			applied, _ := rm["applied"].(bool)
+			last, _ := rm["lastAppliedTime"].(string)
+			out[crs+"/"+kind+"/"+name] = bindingEntry{applied, last}
+		}
+	}
+	return out
+}
+
+// payloadObjects decodes the Kubernetes objects stored in a CRS ConfigMap or
+// Secret; every data value may hold a multi-document YAML or JSON stream.
+func payloadObjects(res map[string]interface{}) []map[string]interface{} {
+	isSecret := kubectl.GetString(res, "kind") == "Secret"
+	var objects []map[string]interface{}
+	data := kubectl.GetMap(res, "data")
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		raw, _ := data[k].(string)
+		if isSecret {
+			decoded, err := base64.StdEncoding.DecodeString(raw)
+			if err != nil {
+				continue
+			}
+			raw = string(decoded)
+		}
+		decoder := yaml.NewDecoder(strings.NewReader(raw))
+		for {
+			var doc map[string]interface{}
+			if err := decoder.Decode(&doc); err != nil {
+				break
+			}
+			if doc != nil {
+				objects = append(objects, doc)
+			}
+		}
+	}
+	return objects
+}
+
+// diffSubset reports paths where the live object differs from the desired
+// payload. Fields absent from the payload are ignored.
+func diffSubset(path string, want, got interface{}, out *[]string) {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			*out = append(*out, path+": missing")
+			return
+		}
+		for k, v := range w {
+			diffSubset(strings.TrimPrefix(path+"."+k, "."), v, g[k], out)
+		}
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			*out = append(*out, fmt.Sprintf("%s: list length %d in payload, %d in cluster", path, len(w), len(g)))
+			return
+		}
+		for i := range w {
+			diffSubset(fmt.Sprintf("%s[%d]", path, i), w[i], g[i], out)
+		}
+	default:
+		if fmt.Sprint(want) != fmt.Sprint(got) {
+			*out = append(*out, fmt.Sprintf("%s: payload %v, cluster %v", path, want, got))
+		}
+	}
+}
+
+func driftFor(res map[string]interface{}, kubeconfig string) []string {
+	var drift []string
+	for _, obj := range payloadObjects(res) {
+		kind := kubectl.GetString(obj, "kind")
+		apiVersion := kubectl.GetString(obj, "apiVersion")
+		name := kubectl.GetString(obj, "metadata.name")
+		ns := kubectl.GetString(obj, "metadata.namespace")
+
+		// Core objects (apiVersion "v1") have no group; kubectl would read a
+		// "Kind.v1" suffix as an API group named v1.
+		resource := kind
+		if i := strings.Index(apiVersion, "/"); i >= 0 {
+			resource = kind + "." + apiVersion[i+1:] + "." + apiVersion[:i]
+		}
+		args := []string{"--kubeconfig", kubeconfig, "get", resource, name, "-o", "json"}
+		if ns != "" {
+			args = append(args, "-n", ns)
+		}
+		id := kind + "/" + strings.TrimPrefix(ns+"/"+name, "/")
+		ok, out, _ := kubectl.Run(args, 0)
+		if !ok {
+			drift = append(drift, id+": missing in workload cluster")
+			continue
+		}
+		items, err := kubectl.ParseItems(out)
+		if err != nil || len(items) == 0 {
+			continue
+		}
+
+		var diffs []string
+		for _, section := range []string{"spec", "data", "stringData", "rules", "roleRef", "subjects", "webhooks"} {
+			if want, ok := obj[section]; ok {
+				diffSubset(section, want, items[0][section], &diffs)
+			}
+		}
+		for _, d := range diffs {
+			drift = append(drift, id+" "+d)
+		}
+	}
+	if len(drift) > maxDriftPaths {
+		drift = append(drift[:maxDriftPaths], fmt.Sprintf("... and %d more", len(drift)-maxDriftPaths))
+	}
+	return drift
+}
+
+func audit(namespace string, allNS bool, clusterFilter string, drift bool) auditReport {
+	rep := auditReport{Unmatched: []string{}, Missing: []string{}}
+
+	sets, err := kubectl.RunJSON(crsResource, namespace, "", allNS)
+	if err != nil {
+		kubectl.Errorf("Error listing ClusterResourceSets: %v", err)
+	}
+	bindings, _ := kubectl.RunJSON(bindingResource, namespace, "", allNS)
+	clusters, _ := kubectl.RunJSON(clusterResource, namespace, "", allNS)
+
+	bindingByCluster := map[string]map[string]bindingEntry{}
+	for _, b := range bindings {
+		ns := kubectl.GetString(b, "metadata.namespace")
+		cluster := kubectl.GetString(b, "spec.clusterName")
+		if cluster == "" {
+			cluster = kubectl.GetString(b, "metadata.name")
+		}
+		bindingByCluster[ns+"/"+cluster] = bindingsFor(b)
+	}
+
+	// Resolve every CRS resource once so missing ones are reported a single time.
+	payloads := map[string]map[string]interface{}{}
+	missing := map[string]bool{}
+	for _, crs := range sets {
+		ns := kubectl.GetString(crs, "metadata.namespace")
+		for _, r := range kubectl.GetSlice(kubectl.GetMap(crs, "spec"), "resources") {
+			rm, _ := r.(map[string]interface{})
+			kind, _ := rm["kind"].(string)
+			name, _ := rm["name"].(string)
+			key := ns + "/" + kind + "/" + name
+			if _, seen := payloads[key]; seen || missing[key] {
+				continue
+			}
+			items, err := kubectl.RunJSON(strings.ToLower(kind)+"/"+name, ns, "", false)
+			if err != nil || len(items) == 0 {
+				missing[key] = true
+				rep.Missing = append(rep.Missing, fmt.Sprintf("%s %s/%s (ClusterResourceSet %s)", kind, ns, name, kubectl.GetString(crs, "metadata.name")))
+				continue
+			}
+			payloads[key] = items[0]
+		}
+	}
+
+	for _, cluster := range clusters {
+		ns := kubectl.GetString(cluster, "metadata.namespace")
+		name := kubectl.GetString(cluster, "metadata.name")
+		if clusterFilter != "" && name != clusterFilter {
+			continue
+		}
+		labels := kubectl.Labels(cluster)
+		ca := clusterAudit{Cluster: name, Namespace: ns, Sets: []crsStatus{}}
+		applied := bindingByCluster[ns+"/"+name]
+
+		var kubeconfig string
+		if drift {
+			path, err := kubectl.WorkloadKubeconfig(name, ns)
+			if err != nil {
+				ca.DriftNote = "drift not checked: " + err.Error()
+			} else {
+				kubeconfig = path
+			}
+		}
+
+		for _, crs := range sets {
+			if kubectl.GetString(crs, "metadata.namespace") != ns {
+				continue
+			}
+			// An empty clusterSelector selects no clusters.
+			selector := kubectl.GetMap(kubectl.GetMap(crs, "spec"), "clusterSelector")
+			if len(selector) == 0 || !kubectl.MatchesSelector(selector, labels) {
+				continue
+			}
+			crsName := kubectl.GetString(crs, "metadata.name")
+			cs := crsStatus{Name: crsName, Strategy: kubectl.GetString(crs, "spec.strategy")}
+			if cs.Strategy == "" {
+				cs.Strategy = "ApplyOnce"
+			}
+			for _, r := range kubectl.GetSlice(kubectl.GetMap(crs, "spec"), "resources") {
+				rm, _ := r.(map[string]interface{})
+				kind, _ := rm["kind"].(string)
+				resName, _ := rm["name"].(string)
+				rs := resourceStatus{Kind: kind, Name: resName}
+				key := ns + "/" + kind + "/" + resName
+				entry, bound := applied[crsName+"/"+kind+"/"+resName]
+				switch {
+				case missing[key]:
+					rs.Status = "missing"
+				case !bound:
+					rs.Status = "not-applied"
+				case entry.Applied:
+					rs.Status = "applied"
+					rs.LastApplied = entry.LastApplied
+				default:
+					rs.Status = "failed"
+				}
+				if kubeconfig != "" && payloads[key] != nil {
+					rs.Drift = driftFor(payloads[key], kubeconfig)
+				}
+				cs.Resources = append(cs.Resources, rs)
+			}
+			ca.Sets = append(ca.Sets, cs)
+		}
+		if kubeconfig != "" {
+			os.Remove(kubeconfig)
+		}
+
+		if len(ca.Sets) == 0 {
+			rep.Unmatched = append(rep.Unmatched, ns+"/"+name)
+		}
+		rep.Clusters = append(rep.Clusters, ca)
+	}
+	if rep.Clusters == nil {
+		rep.Clusters = []clusterAudit{}
+	}
+	return rep
+}
+
+func printReport(rep auditReport) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("%s\nCLUSTERRESOURCESET AUDIT\n%s\n", sep, sep)
+
+	icons := map[string]string{"applied": "✅", "failed": "❌", "not-applied": "⏳", "missing": "❌"}
+	for _, c := range rep.Clusters {
+		if len(c.Sets) == 0 {
+			continue
+		}
+		fmt.Printf("\n🖥️  %s/%s\n", c.Namespace, c.Cluster)
+		if c.DriftNote != "" {
+			fmt.Printf("   ⚠️  %s\n", c.DriftNote)
+		}
+		for _, s := range c.Sets {
+			fmt.Printf("   📦 %s (%s)\n", s.Name, s.Strategy)
+			for _, r := range s.Resources {
+				line := fmt.Sprintf("      %s %s/%s: %s", icons[r.Status], r.Kind, r.Name, r.Status)
+				if r.LastApplied != "" {
+					line += " at " + r.LastApplied
+				}
+				fmt.Println(line)
+				for _, d := range r.Drift {
+					fmt.Printf("         ↳ drift: %s\n", d)
+				}
+			}
+		}
+	}
+
+	if len(rep.Unmatched) > 0 {
+		fmt.Printf("\n⚠️  Clusters matching no ClusterResourceSet (%d):\n", len(rep.Unmatched))
+		for _, c := range rep.Unmatched {
+			fmt.Printf("   - %s\n", c)
+		}
+	}
+	if len(rep.Missing) > 0 {
+		fmt.Printf("\n❌ Resources referenced by ClusterResourceSets that do not exist (%d):\n", len(rep.Missing))
+		for _, m := range rep.Missing {
+			fmt.Printf("   - %s\n", m)
+		}
+	}
+}
+
+func hasProblems(rep auditReport) bool {
+	if len(rep.Missing) > 0 {
+		return true
+	}
+	for _, c := range rep.Clusters {
+		for _, s := range c.Sets {
+			for _, r := range s.Resources {
+				if r.Status == "failed" || len(r.Drift) > 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func main() {
+	namespace := flag.String("n", "", "Namespace to audit")
+	allNS := flag.Bool("A", false, "Audit all namespaces")
+	cluster := flag.String("c", "", "Only audit this cluster")
+	drift := flag.Bool("drift", false, "Compare CRS payloads with the workload clusters")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nAudit ClusterResourceSet bindings, failures and payload drift per cluster.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	rep := audit(*namespace, *allNS, *cluster, *drift)
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(rep, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(rep)
+	}
+
+	if hasProblems(rep) {
+		os.Exit(1)
+	}
+}
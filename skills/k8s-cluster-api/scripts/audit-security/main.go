@@ -8,19 +8,46 @@
 //
 //	go run ./audit-security -c my-cluster -n default
 //	go run ./audit-security -A --format json -o report.json
+//	go run ./audit-security -c my-cluster -n default --workload
+//	go run ./audit-security -A --rules org-rules.yaml
+//	go run ./audit-security -A --cert-window 60
+//	go run ./audit-security -A --format sarif -o audit.sarif
+//	go run ./audit-security -A --format html -o audit.html
+//	go run ./audit-security -A --concurrency 16
+//	go run ./audit-security -A --compare last-report.json
+//	go run ./audit-security -A --fail-on medium --ignore-file .audit-ignore
+//	go run ./audit-security -A --releases k8s-releases.yaml --max-patch-lag 2
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"flag"
 	"fmt"
+	"html"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
 
 	"k8s-cluster-api-tools/internal/kubectl"
 )
 
 type finding struct {
+	ID             string `json:"id"`
 	Severity       string `json:"severity"`
 	Category       string `json:"category"`
 	Resource       string `json:"resource"`
@@ -34,7 +61,56 @@ type auditReport struct {
 }
 
 func (r *auditReport) add(sev, cat, res, msg, rec string) {
-	r.Findings = append(r.Findings, finding{sev, cat, res, msg, rec})
+	r.Findings = append(r.Findings, finding{findingID(r.ClusterName, cat, res, msg), sev, cat, res, msg, rec})
+}
+
+// findingID derives a stable identifier from what a finding is about, so it
+// can be listed in an --ignore-file across runs.
+func findingID(cluster, cat, res, msg string) string {
+	sum := sha256.Sum256([]byte(cluster + "|" + cat + "|" + res + "|" + msg))
+	return "AUD-" + hex.EncodeToString(sum[:])[:10]
+}
+
+// severityRank orders severities; findings at or above --fail-on fail the run.
+var severityRank = map[string]int{"info": 0, "low": 1, "medium": 2, "high": 3}
+
+// loadIgnoreFile reads finding IDs to suppress, one per line. Blank lines and
+// text after # are ignored.
+func loadIgnoreFile(path string) (map[string]bool, error) {
+	ids := map[string]bool{}
+	if path == "" {
+		return ids, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if id := strings.TrimSpace(line); id != "" {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
+
+// suppress drops ignored findings and returns how many were dropped.
+func suppress(reports []auditReport, ignored map[string]bool) int {
+	n := 0
+	for i := range reports {
+		kept := reports[i].Findings[:0]
+		for _, f := range reports[i].Findings {
+			if ignored[f.ID] {
+				n++
+				continue
+			}
+			kept = append(kept, f)
+		}
+		reports[i].Findings = kept
+	}
+	return n
 }
 
 func (r *auditReport) highCount() int {
@@ -223,76 +299,978 @@ func checkReplicas(cluster map[string]interface{}, report *auditReport) {
 	}
 }
 
-func runAudit(clusterFilter, namespace string, allNamespaces bool) []auditReport {
-	var reports []auditReport
+// systemNamespaces are exempt from workload Pod Security Admission checks.
+var systemNamespaces = map[string]bool{"kube-system": true, "kube-public": true, "kube-node-lease": true}
 
-	var clusters []map[string]interface{}
-	if clusterFilter != "" {
-		items, _ := kubectl.RunJSON("clusters.cluster.x-k8s.io/"+clusterFilter, namespace, "", false)
-		clusters = items
-	} else {
-		items, _ := kubectl.RunJSON("clusters.cluster.x-k8s.io", namespace, "", allNamespaces)
-		clusters = items
+// workloadGet lists resources in the workload cluster behind kubeconfig.
+func workloadGet(kubeconfig string, args ...string) ([]map[string]interface{}, error) {
+	ok, out, errMsg := kubectl.Run(append([]string{"--kubeconfig", kubeconfig, "get"}, append(args, "-o", "json")...), 0)
+	if !ok {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(errMsg))
 	}
+	return kubectl.ParseItems(out)
+}
 
-	for _, cluster := range clusters {
-		meta := kubectl.GetMap(cluster, "metadata")
-		cName, _ := meta["name"].(string)
-		cNS, _ := meta["namespace"].(string)
-		if cName == "" {
-			cName = "unknown"
+// checkAnonymousAccess flags RBAC bindings that grant permissions to
+// unauthenticated users, beyond the defaults Kubernetes ships with.
+func checkAnonymousAccess(kubeconfig string, report *auditReport) {
+	defaults := map[string]bool{"system:public-info-viewer": true, "system:discovery": true, "system:basic-user": true}
+	for _, kind := range []string{"clusterrolebindings", "rolebindings"} {
+		bindings, _ := workloadGet(kubeconfig, kind, "--all-namespaces")
+		for _, b := range bindings {
+			name := kubectl.GetString(b, "metadata.name")
+			if defaults[name] {
+				continue
+			}
+			for _, s := range kubectl.GetSlice(b, "subjects") {
+				subject, _ := s.(map[string]interface{})
+				if sn, _ := subject["name"].(string); sn == "system:anonymous" || sn == "system:unauthenticated" {
+					res := fmt.Sprintf("workload/%s/%s", kubectl.GetString(b, "kind"), name)
+					report.add("high", "Authentication", res,
+						fmt.Sprintf("Binding grants %s to %s", kubectl.GetString(b, "roleRef.name"), sn),
+						"Remove anonymous and unauthenticated subjects from RBAC bindings")
+					break
+				}
+			}
 		}
-		if cNS == "" {
-			cNS = "default"
+	}
+}
+
+// checkNamespacePSA flags workload namespaces without a Pod Security
+// Admission enforce label, or that enforce the privileged level.
+func checkNamespacePSA(kubeconfig string, report *auditReport) {
+	namespaces, _ := workloadGet(kubeconfig, "namespaces")
+	for _, ns := range namespaces {
+		name := kubectl.GetString(ns, "metadata.name")
+		if systemNamespaces[name] {
+			continue
 		}
+		res := "workload/Namespace/" + name
+		switch level := kubectl.Labels(ns)["pod-security.kubernetes.io/enforce"]; level {
+		case "":
+			report.add("medium", "Pod Security", res, "Namespace has no pod-security.kubernetes.io/enforce label", "Label the namespace with enforce=baseline or restricted")
+		case "privileged":
+			report.add("low", "Pod Security", res, "Namespace enforces the privileged Pod Security level", "Use baseline or restricted unless the workloads require host access")
+		}
+	}
+}
 
-		report := auditReport{ClusterName: cNS + "/" + cName}
+// checkNodeComponents reads kube-proxy's configuration and each kubelet's
+// live configuration through the node configz endpoint.
+func checkNodeComponents(kubeconfig string, report *auditReport) {
+	if cms, _ := workloadGet(kubeconfig, "configmap", "kube-proxy", "-n", "kube-system"); len(cms) > 0 {
+		conf, _ := kubectl.GetMap(cms[0], "data")["config.conf"].(string)
+		if m := regexp.MustCompile(`(?m)^metricsBindAddress:\s*"?([^"\s]+)`).FindStringSubmatch(conf); m != nil && strings.HasPrefix(m[1], "0.0.0.0") {
+			report.add("low", "Network", "workload/ConfigMap/kube-system/kube-proxy",
+				fmt.Sprintf("kube-proxy exposes metrics on %s", m[1]), "Bind kube-proxy metrics to 127.0.0.1 unless scraped remotely")
+		}
+	}
 
-		checkPSS(cluster, &report)
-		checkNetworkSecurity(cluster, &report)
-		checkReplicas(cluster, &report)
+	nodes, _ := workloadGet(kubeconfig, "nodes")
+	for _, n := range nodes {
+		name := kubectl.GetString(n, "metadata.name")
+		ok, out, _ := kubectl.Run([]string{"--kubeconfig", kubeconfig, "get", "--raw", "/api/v1/nodes/" + name + "/proxy/configz"}, 0)
+		if !ok {
+			continue
+		}
+		var configz map[string]interface{}
+		if json.Unmarshal([]byte(out), &configz) != nil {
+			continue
+		}
+		cfg := kubectl.GetMap(configz, "kubeletconfig")
+		res := "workload/Node/" + name
+		if anon, _ := kubectl.GetNested(cfg, "authentication.anonymous.enabled").(bool); anon {
+			report.add("high", "Authentication", res, "Kubelet allows anonymous requests", "Set authentication.anonymous.enabled=false in KubeletConfiguration")
+		}
+		if kubectl.GetString(cfg, "authorization.mode") == "AlwaysAllow" {
+			report.add("high", "Authorization", res, "Kubelet authorization mode is AlwaysAllow", "Set authorization.mode=Webhook in KubeletConfiguration")
+		}
+		if port, _ := cfg["readOnlyPort"].(float64); port != 0 {
+			report.add("medium", "Network", res, fmt.Sprintf("Kubelet read-only port %d is open", int(port)), "Set readOnlyPort=0")
+		}
+	}
+}
 
-		// KubeadmControlPlane
-		kcps, _ := kubectl.RunJSON("kubeadmcontrolplanes.controlplane.cluster.x-k8s.io", cNS, "", false)
-		for _, kcp := range kcps {
-			ownerRefs := kubectl.GetSlice(kubectl.GetMap(kcp, "metadata"), "ownerReferences")
-			for _, ref := range ownerRefs {
-				rm, ok := ref.(map[string]interface{})
-				if !ok {
+// checkDefaultServiceAccounts flags default service accounts that mount API
+// tokens into every pod, and long-lived token secrets bound to them.
+func checkDefaultServiceAccounts(kubeconfig string, report *auditReport) {
+	accounts, _ := workloadGet(kubeconfig, "serviceaccounts", "--all-namespaces", "--field-selector", "metadata.name=default")
+	for _, sa := range accounts {
+		ns := kubectl.GetString(sa, "metadata.namespace")
+		if systemNamespaces[ns] {
+			continue
+		}
+		if mount, ok := sa["automountServiceAccountToken"].(bool); !ok || mount {
+			report.add("low", "Service Accounts", "workload/ServiceAccount/"+ns+"/default",
+				"Default service account automounts its API token", "Set automountServiceAccountToken: false on the default service account")
+		}
+	}
+	secrets, _ := workloadGet(kubeconfig, "secrets", "--all-namespaces", "--field-selector", "type=kubernetes.io/service-account-token")
+	for _, s := range secrets {
+		annotations := kubectl.GetMap(kubectl.GetMap(s, "metadata"), "annotations")
+		if sa, _ := annotations["kubernetes.io/service-account.name"].(string); sa == "default" {
+			report.add("medium", "Service Accounts", resName(s, "workload/Secret"),
+				"Long-lived token secret for the default service account", "Delete it and use projected, time-bound tokens")
+		}
+	}
+}
+
+// auditWorkload connects to the workload cluster through its kubeconfig
+// secret and audits its in-cluster posture.
+func auditWorkload(cluster, namespace string, report *auditReport) {
+	kubeconfig, err := kubectl.WorkloadKubeconfig(cluster, namespace)
+	if err != nil {
+		report.add("info", "Workload", "Cluster/"+namespace+"/"+cluster, fmt.Sprintf("Workload cluster not audited: %v", err), "")
+		return
+	}
+	defer os.Remove(kubeconfig)
+
+	checkAnonymousAccess(kubeconfig, report)
+	checkNamespacePSA(kubeconfig, report)
+	checkNodeComponents(kubeconfig, report)
+	checkDefaultServiceAccounts(kubeconfig, report)
+}
+
+// policyRule is a user-defined check from a --rules file. A rule matches
+// resources of one kind and either compares the value at Path using Operator
+// and Value, or evaluates the Rego module at Rego with opa. A field check
+// reports a finding when it does not hold; a Rego module reports one for every
+// message in its deny set. Rego paths are relative to the rules file:
+//
+//	rules:
+//	  - id: ha-control-plane
+//	    resource: KubeadmControlPlane
+//	    path: spec.replicas
+//	    operator: gte
+//	    value: 3
+//	    message: Control plane is not highly available
+//	  - id: team-label
+//	    resource: Cluster
+//	    rego: policies/team-label.rego
+//
+// where team-label.rego is evaluated with each Cluster as input:
+//
+//	package capi.team_label
+//
+//	deny contains msg if {
+//		not input.metadata.labels.team
+//		msg := "Cluster has no team label"
+//	}
+type policyRule struct {
+	ID             string      `yaml:"id"`
+	Resource       string      `yaml:"resource"`
+	Path           string      `yaml:"path"`
+	Operator       string      `yaml:"operator"`
+	Value          interface{} `yaml:"value"`
+	Rego           string      `yaml:"rego"`
+	Severity       string      `yaml:"severity"`
+	Category       string      `yaml:"category"`
+	Message        string      `yaml:"message"`
+	Recommendation string      `yaml:"recommendation"`
+
+	regoPackage string
+}
+
+var regoPackage = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)`)
+
+func loadRules(path string) ([]policyRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Rules []policyRule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, r := range file.Rules {
+		if r.ID == "" {
+			r.ID = fmt.Sprintf("rule-%d", i+1)
+		}
+		if r.Resource == "" || (r.Path == "" && r.Rego == "") {
+			return nil, fmt.Errorf("rule %s: resource and one of path or rego are required", r.ID)
+		}
+		if r.Path != "" && r.Rego != "" {
+			return nil, fmt.Errorf("rule %s: path and rego are mutually exclusive", r.ID)
+		}
+		if r.Operator == "" {
+			r.Operator = "equals"
+		}
+		if r.Severity == "" {
+			r.Severity = "medium"
+		}
+		if r.Category == "" {
+			r.Category = "Policy"
+		}
+		if r.Rego != "" {
+			if err := loadRego(&r, filepath.Dir(path)); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+			}
+		}
+		file.Rules[i] = r
+	}
+	return file.Rules, nil
+}
+
+// loadRego resolves the rule's Rego module relative to the rules file, checks
+// it with opa and records its package.
+func loadRego(r *policyRule, dir string) error {
+	if !filepath.IsAbs(r.Rego) {
+		r.Rego = filepath.Join(dir, r.Rego)
+	}
+	module, err := os.ReadFile(r.Rego)
+	if err != nil {
+		return err
+	}
+	m := regoPackage.FindSubmatch(module)
+	if m == nil {
+		return fmt.Errorf("%s: no package declaration", r.Rego)
+	}
+	r.regoPackage = string(m[1])
+	if _, err := exec.LookPath("opa"); err != nil {
+		return fmt.Errorf("opa not found in PATH (needed to evaluate %s)", r.Rego)
+	}
+	if out, err := exec.Command("opa", "check", r.Rego).CombinedOutput(); err != nil {
+		return fmt.Errorf("opa check %s: %s", r.Rego, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// evalRego evaluates the rule's deny set with opa, once per object as input
+// (the conftest convention) but in a single opa run, and returns the deny
+// messages by object index. Messages may be strings or objects with a msg
+// field.
+func evalRego(r policyRule, objs []map[string]interface{}) (map[int][]string, error) {
+	input, err := json.Marshal(map[string]interface{}{"objects": objs})
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("[[i, msg] | obj := input.objects[i]; msg := data.%s.deny[_] with input as obj]", r.regoPackage)
+	cmd := exec.Command("opa", "eval", "--format", "json", "--stdin-input", "--data", r.Rego, query)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+
+	var out struct {
+		Result []struct {
+			Expressions []struct {
+				Value [][]interface{} `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("opa eval: %v: %s", runErr, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("opa eval: %w", err)
+	}
+	if len(out.Errors) > 0 {
+		return nil, fmt.Errorf("opa eval: %s", out.Errors[0].Message)
+	}
+
+	denied := map[int][]string{}
+	for _, res := range out.Result {
+		for _, e := range res.Expressions {
+			for _, pair := range e.Value {
+				if len(pair) != 2 {
 					continue
 				}
-				if rn, _ := rm["name"].(string); rn == cName {
-					checkKubeadmSecurity(kcp, &report)
-					break
+				i, _ := toFloat(pair[0])
+				msg, ok := pair[1].(string)
+				if m, isMap := pair[1].(map[string]interface{}); isMap {
+					msg, ok = m["msg"].(string)
 				}
+				if !ok {
+					msg = fmt.Sprint(pair[1])
+				}
+				denied[int(i)] = append(denied[int(i)], msg)
 			}
 		}
+	}
+	return denied, nil
+}
 
-		// Machines
-		machines, _ := kubectl.RunJSON("machines.cluster.x-k8s.io", cNS, "", false)
-		for _, machine := range machines {
-			labels := kubectl.GetMap(kubectl.GetMap(machine, "metadata"), "labels")
-			if cn, _ := labels["cluster.x-k8s.io/cluster-name"].(string); cn == cName {
-				checkMachineSecurity(machine, &report)
+// splitPath splits a field path on dots, keeping bracketed segments such as
+// metadata.labels[cluster.x-k8s.io/cluster-name] intact.
+func splitPath(path string) []string {
+	var parts []string
+	for path != "" {
+		if strings.HasPrefix(path, "[") {
+			end := strings.Index(path, "]")
+			if end < 0 {
+				end = len(path)
 			}
+			parts = append(parts, strings.Trim(path[1:end], `"'`))
+			path = strings.TrimPrefix(path[min(end+1, len(path)):], ".")
+			continue
 		}
+		end := strings.IndexAny(path, ".[")
+		if end < 0 {
+			parts = append(parts, path)
+			break
+		}
+		parts = append(parts, path[:end])
+		path = strings.TrimPrefix(path[end:], ".")
+	}
+	return parts
+}
+
+func lookup(obj interface{}, path string) (interface{}, bool) {
+	current := obj
+	for _, key := range splitPath(path) {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
 
-		// Secrets
-		secrets, _ := kubectl.RunJSON("secrets", cNS, "", false)
-		var clusterSecrets []map[string]interface{}
-		for _, s := range secrets {
-			labels := kubectl.GetMap(kubectl.GetMap(s, "metadata"), "labels")
-			if cn, _ := labels["cluster.x-k8s.io/cluster-name"].(string); cn == cName {
-				clusterSecrets = append(clusterSecrets, s)
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// equal compares values loosely, so YAML ints match JSON floats.
+func equal(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			return fa == fb
+		}
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func checkField(r policyRule, obj map[string]interface{}) (bool, error) {
+	v, found := lookup(obj, r.Path)
+	switch r.Operator {
+	case "exists":
+		return found, nil
+	case "absent":
+		return !found, nil
+	case "equals":
+		return found && equal(v, r.Value), nil
+	case "notEquals":
+		return !found || !equal(v, r.Value), nil
+	case "in":
+		values, _ := r.Value.([]interface{})
+		for _, want := range values {
+			if found && equal(v, want) {
+				return true, nil
 			}
 		}
-		checkSecretExposure(clusterSecrets, &report)
+		return false, nil
+	case "matches":
+		re, err := regexp.Compile(fmt.Sprint(r.Value))
+		if err != nil {
+			return false, err
+		}
+		return found && re.MatchString(fmt.Sprint(v)), nil
+	case "gte", "lte":
+		got, ok1 := toFloat(v)
+		want, ok2 := toFloat(r.Value)
+		if !found || !ok1 || !ok2 {
+			return false, nil
+		}
+		if r.Operator == "gte" {
+			return got >= want, nil
+		}
+		return got <= want, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", r.Operator)
+}
 
-		reports = append(reports, report)
+// applyRules evaluates the rules for kind against objs and records a finding
+// for every rule that does not hold.
+func applyRules(rules []policyRule, kind string, objs []map[string]interface{}, report *auditReport) {
+	for _, r := range rules {
+		if r.Resource != kind || len(objs) == 0 {
+			continue
+		}
+		if r.Rego != "" {
+			denied, err := evalRego(r, objs)
+			if err != nil {
+				report.add("info", r.Category, kind, fmt.Sprintf("[%s] rule could not be evaluated: %v", r.ID, err), "")
+				continue
+			}
+			for i, obj := range objs {
+				for _, msg := range denied[i] {
+					report.add(r.Severity, r.Category, resName(obj, kind), fmt.Sprintf("[%s] %s", r.ID, msg), r.Recommendation)
+				}
+			}
+			continue
+		}
+		for _, obj := range objs {
+			ok, err := checkField(r, obj)
+			res := resName(obj, kind)
+			if err != nil {
+				report.add("info", r.Category, res, fmt.Sprintf("[%s] rule could not be evaluated: %v", r.ID, err), "")
+				continue
+			}
+			if !ok {
+				msg := r.Message
+				if msg == "" {
+					msg = "Rule " + r.ID + " failed"
+				}
+				report.add(r.Severity, r.Category, res, fmt.Sprintf("[%s] %s", r.ID, msg), r.Recommendation)
+			}
+		}
+	}
+}
+
+// k8sRelease describes the support status of a Kubernetes minor release.
+type k8sRelease struct {
+	EOL         string `yaml:"eol" json:"eol"`
+	LatestPatch int    `yaml:"latestPatch" json:"latestPatch"`
+}
+
+// k8sReleases is the built-in release table. It goes stale; refresh it with
+// --releases, a YAML or JSON file of the same shape keyed by minor version.
+// Entries without latestPatch are only checked for end of life.
+var k8sReleases = map[string]k8sRelease{
+	"1.25": {EOL: "2023-10-28", LatestPatch: 16},
+	"1.26": {EOL: "2024-02-28", LatestPatch: 15},
+	"1.27": {EOL: "2024-06-28", LatestPatch: 16},
+	"1.28": {EOL: "2024-10-28", LatestPatch: 15},
+	"1.29": {EOL: "2025-02-28", LatestPatch: 15},
+	"1.30": {EOL: "2025-06-28", LatestPatch: 14},
+	"1.31": {EOL: "2025-10-28"},
+	"1.32": {EOL: "2026-02-28"},
+	"1.33": {EOL: "2026-06-28"},
+	"1.34": {EOL: "2026-10-27"},
+	"1.35": {EOL: "2027-02-28"},
+}
+
+func loadReleases(path string) (map[string]k8sRelease, error) {
+	releases := map[string]k8sRelease{}
+	for minor, r := range k8sReleases {
+		releases[minor] = r
+	}
+	if path == "" {
+		return releases, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var extra map[string]k8sRelease
+	if err := yaml.Unmarshal(data, &extra); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for minor, r := range extra {
+		if _, err := time.Parse("2006-01-02", r.EOL); err != nil {
+			return nil, fmt.Errorf("%s: release %s: bad eol date %q", path, minor, r.EOL)
+		}
+		releases[minor] = r
+	}
+	return releases, nil
+}
+
+var kubeVersionPattern = regexp.MustCompile(`\bv?(1\.\d{2})\.(\d+)\b`)
+
+// checkVersion flags a Kubernetes version that is past end of life, close to
+// it, or more than maxPatchLag patch releases behind.
+func checkVersion(version, res, what string, opts auditOptions, report *auditReport) {
+	m := kubeVersionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return
+	}
+	rel, ok := opts.releases[m[1]]
+	if !ok {
+		report.add("info", "Versions", res, fmt.Sprintf("%s %s is not in the release table", what, version), "Refresh the table with --releases")
+		return
+	}
+	eol, _ := time.Parse("2006-01-02", rel.EOL)
+	now := time.Now()
+	switch {
+	case now.After(eol):
+		report.add("high", "Versions", res, fmt.Sprintf("%s %s is end of life since %s", what, version, rel.EOL),
+			"Upgrade to a supported Kubernetes minor release")
+	case now.Add(60 * 24 * time.Hour).After(eol):
+		report.add("medium", "Versions", res, fmt.Sprintf("%s %s reaches end of life on %s", what, version, rel.EOL),
+			"Plan the upgrade to the next minor release")
+	}
+	patch, _ := strconv.Atoi(m[2])
+	if rel.LatestPatch > 0 && rel.LatestPatch-patch > opts.maxPatchLag {
+		report.add("high", "Versions", res,
+			fmt.Sprintf("%s %s is %d patch releases behind v%s.%d", what, version, rel.LatestPatch-patch, m[1], rel.LatestPatch),
+			"Apply the latest patch release for security fixes")
+	}
+}
+
+// imageVersions returns the Kubernetes versions embedded in the image
+// references of an infrastructure machine, such as ubuntu-2204-kube-v1.30.2.
+func imageVersions(obj interface{}, key string) []string {
+	var out []string
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			out = append(out, imageVersions(child, k)...)
+		}
+	case []interface{}:
+		for _, child := range v {
+			out = append(out, imageVersions(child, key)...)
+		}
+	case string:
+		k := strings.ToLower(key)
+		if strings.Contains(k, "image") || strings.Contains(k, "ami") || k == "template" {
+			if m := kubeVersionPattern.FindString(v); m != "" {
+				out = append(out, m)
+			}
+		}
+	}
+	return out
+}
+
+// checkVersions checks the cluster's Kubernetes version and the versions run
+// by its machines and baked into their images, once per distinct version.
+func checkVersions(cluster, kcp map[string]interface{}, machines, infraMachines []map[string]interface{}, opts auditOptions, report *auditReport) {
+	res := resName(cluster, "Cluster")
+	version := kubectl.GetString(cluster, "spec.topology.version")
+	if version == "" && kcp != nil {
+		version = kubectl.GetString(kcp, "spec.version")
+	}
+	if version != "" {
+		checkVersion(version, res, "Kubernetes version", opts, report)
+	}
+
+	seen := map[string]bool{version: true}
+	images := map[string]bool{}
+	for _, m := range machines {
+		if v := kubectl.GetString(m, "spec.version"); !seen[v] {
+			seen[v] = true
+			checkVersion(v, resName(m, "Machine"), "Machine version", opts, report)
+		}
+	}
+	for _, infra := range infraMachines {
+		for _, v := range imageVersions(kubectl.GetMap(infra, "spec"), "") {
+			if !images[v] {
+				images[v] = true
+				checkVersion(v, resName(infra, kubectl.GetString(infra, "kind")), "Machine image", opts, report)
+			}
+		}
+	}
+}
+
+// getRef fetches the object an ObjectReference points to, or nil.
+func getRef(ref map[string]interface{}, namespace string) map[string]interface{} {
+	kind, _ := ref["kind"].(string)
+	name, _ := ref["name"].(string)
+	apiVersion, _ := ref["apiVersion"].(string)
+	if kind == "" || name == "" {
+		return nil
+	}
+	resource := strings.ToLower(kind)
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		resource += "." + apiVersion[:i]
+	}
+	if ns, _ := ref["namespace"].(string); ns != "" {
+		namespace = ns
+	}
+	items, _ := kubectl.RunJSON(resource+"/"+name, namespace, "", false)
+	if len(items) == 0 {
+		return nil
+	}
+	return items[0]
+}
+
+// providerCheck audits one provider kind; templates are checked through
+// their spec.template.spec.
+type providerCheck func(spec map[string]interface{}, res string, report *auditReport)
+
+// providerChecks registers provider-specific audits by infrastructure kind.
+// Kinds of providers that are not installed are simply never seen.
+var providerChecks = map[string]providerCheck{
+	"AWSCluster":     checkAWSCluster,
+	"AWSMachine":     checkAWSMachine,
+	"AzureCluster":   checkAzureCluster,
+	"AzureMachine":   checkAzureMachine,
+	"VSphereCluster": checkVSphereCluster,
+}
+
+func openCIDR(v interface{}) bool {
+	for _, c := range toStrings(v) {
+		if c == "0.0.0.0/0" || c == "::/0" || c == "*" || c == "Internet" {
+			return true
+		}
+	}
+	return false
+}
+
+func toStrings(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var out []string
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func toSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
+
+func checkAWSCluster(spec map[string]interface{}, res string, report *auditReport) {
+	// An enabled bastion with no allowedCIDRBlocks is open to 0.0.0.0/0.
+	blocks := kubectl.GetNested(spec, "bastion.allowedCIDRBlocks")
+	if enabled, _ := kubectl.GetNested(spec, "bastion.enabled").(bool); enabled && (len(toStrings(blocks)) == 0 || openCIDR(blocks)) {
+		report.add("high", "Network", res, "Bastion allows SSH from 0.0.0.0/0", "Restrict spec.bastion.allowedCIDRBlocks to trusted ranges")
+	}
+	for _, path := range []string{"controlPlaneLoadBalancer.ingressRules", "network.additionalControlPlaneIngressRules", "network.cni.cniIngressRules"} {
+		for _, r := range toSlice(kubectl.GetNested(spec, path)) {
+			rule, _ := r.(map[string]interface{})
+			if openCIDR(rule["cidrBlocks"]) || openCIDR(rule["ipv6CidrBlocks"]) {
+				desc, _ := rule["description"].(string)
+				report.add("high", "Network", res, fmt.Sprintf("Ingress rule %q in spec.%s is open to the internet", desc, path),
+					"Limit cidrBlocks to the ranges that need access")
+			}
+		}
+	}
+	if scheme := kubectl.GetString(spec, "controlPlaneLoadBalancer.scheme"); scheme == "" || scheme == "internet-facing" {
+		report.add("low", "Network", res, "API server load balancer is internet-facing", "Use scheme internal for private clusters")
+	}
+}
+
+func checkAWSMachine(spec map[string]interface{}, res string, report *auditReport) {
+	if public, _ := spec["publicIP"].(bool); public {
+		report.add("high", "Network", res, "Machines get a public IP address", "Set spec.publicIP=false and reach nodes through a bastion or SSM")
+	}
+	if tokens := kubectl.GetString(spec, "instanceMetadataOptions.httpTokens"); tokens != "required" {
+		report.add("high", "Metadata", res, "IMDSv1 is allowed (httpTokens is not required)", "Set spec.instanceMetadataOptions.httpTokens=required")
+	}
+	if enc, ok := kubectl.GetNested(spec, "rootVolume.encrypted").(bool); ok && !enc {
+		report.add("medium", "Encryption", res, "Root volume is not encrypted", "Set spec.rootVolume.encrypted=true")
+	}
+	for _, v := range toSlice(spec["nonRootVolumes"]) {
+		vol, _ := v.(map[string]interface{})
+		if enc, ok := vol["encrypted"].(bool); ok && !enc {
+			device, _ := vol["deviceName"].(string)
+			report.add("medium", "Encryption", res, fmt.Sprintf("Volume %s is not encrypted", device), "Set encrypted=true on every volume")
+		}
 	}
+}
+
+func checkAzureCluster(spec map[string]interface{}, res string, report *auditReport) {
+	for _, s := range toSlice(kubectl.GetNested(spec, "networkSpec.subnets")) {
+		subnet, _ := s.(map[string]interface{})
+		for _, r := range toSlice(kubectl.GetNested(subnet, "securityGroup.securityRules")) {
+			rule, _ := r.(map[string]interface{})
+			direction, _ := rule["direction"].(string)
+			action, _ := rule["action"].(string)
+			if direction == "Inbound" && action != "Deny" && (openCIDR(rule["source"]) || openCIDR(rule["sources"])) {
+				name, _ := rule["name"].(string)
+				report.add("high", "Network", res, fmt.Sprintf("Security rule %q on subnet %v allows inbound traffic from any source", name, subnet["name"]),
+					"Restrict the rule source to trusted ranges")
+			}
+		}
+	}
+	if kubectl.GetString(spec, "networkSpec.apiServerLB.type") != "Internal" {
+		report.add("low", "Network", res, "API server load balancer is public", "Use apiServerLB.type Internal for private clusters")
+	}
+}
+
+func checkAzureMachine(spec map[string]interface{}, res string, report *auditReport) {
+	if public, _ := spec["allocatePublicIP"].(bool); public {
+		report.add("high", "Network", res, "Machines get a public IP address", "Set spec.allocatePublicIP=false")
+	}
+	if enc, _ := kubectl.GetNested(spec, "securityProfile.encryptionAtHost").(bool); !enc {
+		report.add("medium", "Encryption", res, "Encryption at host is not enabled", "Set spec.securityProfile.encryptionAtHost=true")
+	}
+}
+
+func checkVSphereCluster(spec map[string]interface{}, res string, report *auditReport) {
+	if insecure, _ := spec["insecure"].(bool); insecure {
+		report.add("high", "TLS", res, "vCenter TLS verification is disabled", "Remove spec.insecure and set spec.thumbprint")
+	} else if kubectl.GetString(spec, "thumbprint") == "" {
+		report.add("low", "TLS", res, "vCenter certificate thumbprint is not pinned", "Set spec.thumbprint to the vCenter certificate SHA-1 thumbprint")
+	}
+	if len(kubectl.GetMap(spec, "identityRef")) == 0 {
+		report.add("low", "Secrets", res, "No identityRef; the provider's global vCenter credentials are used", "Use a VSphereClusterIdentity scoped to this cluster")
+	}
+}
+
+// checkProviderSecurity runs the registered provider checks on each distinct
+// infrastructure object.
+func checkProviderSecurity(objects []map[string]interface{}, report *auditReport) {
+	seen := map[string]bool{}
+	for _, obj := range objects {
+		kind := kubectl.GetString(obj, "kind")
+		check, ok := providerChecks[strings.TrimSuffix(kind, "Template")]
+		res := resName(obj, kind)
+		if !ok || seen[res] {
+			continue
+		}
+		seen[res] = true
+		spec := kubectl.GetMap(obj, "spec")
+		if strings.HasSuffix(kind, "Template") {
+			spec = kubectl.GetMap(kubectl.GetMap(spec, "template"), "spec")
+		}
+		check(spec, res, report)
+	}
+}
+
+// clusterCertSecrets are the certificate secrets CAPI keeps per cluster,
+// named <cluster>-<suffix>.
+var clusterCertSecrets = []string{"ca", "etcd", "proxy"}
+
+// certExpiry decodes the tls.crt of a secret and returns its expiry.
+func certExpiry(secret map[string]interface{}) (time.Time, error) {
+	encoded, _ := kubectl.GetMap(secret, "data")["tls.crt"].(string)
+	if encoded == "" {
+		return time.Time{}, fmt.Errorf("no tls.crt")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return time.Time{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("tls.crt is not PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+func daysUntil(t time.Time) int {
+	return int(time.Until(t).Hours() / 24)
+}
+
+// checkCertificates flags cluster CA, etcd and front-proxy certificates and
+// control plane machine certificates expiring within window days, and a
+// KubeadmControlPlane without automatic certificate rotation. Days left go in
+// the recommendation so the finding ID stays stable from day to day.
+func checkCertificates(cluster, kcp map[string]interface{}, machines, secrets []map[string]interface{}, window int, report *auditReport) {
+	name := kubectl.GetString(cluster, "metadata.name")
+	byName := map[string]map[string]interface{}{}
+	for _, s := range secrets {
+		byName[kubectl.GetString(s, "metadata.name")] = s
+	}
+	for _, suffix := range clusterCertSecrets {
+		secret, ok := byName[name+"-"+suffix]
+		if !ok {
+			continue
+		}
+		res := resName(secret, "Secret")
+		notAfter, err := certExpiry(secret)
+		if err != nil {
+			report.add("info", "Certificates", res, fmt.Sprintf("Could not read certificate: %v", err), "")
+			continue
+		}
+		if days := daysUntil(notAfter); days <= window {
+			report.add("high", "Certificates", res,
+				fmt.Sprintf("%s certificate expires on %s", suffix, notAfter.Format("2006-01-02")),
+				fmt.Sprintf("Rotate the certificate within %d days", days))
+		}
+	}
+
+	if kcp == nil {
+		return
+	}
+	if v, _ := kubectl.GetNested(kcp, "spec.rolloutBefore.certificatesExpiryDays").(float64); v == 0 {
+		report.add("medium", "Certificates", resName(kcp, "KubeadmControlPlane"),
+			"Automatic certificate rotation not configured",
+			"Set spec.rolloutBefore.certificatesExpiryDays so control plane machines roll out before their certificates expire")
+	}
+	for _, m := range machines {
+		expiry := kubectl.GetString(m, "status.certificatesExpiryDate")
+		if expiry == "" {
+			continue
+		}
+		notAfter, err := time.Parse(time.RFC3339, expiry)
+		if err != nil {
+			continue
+		}
+		if days := daysUntil(notAfter); days <= window {
+			report.add("high", "Certificates", resName(m, "Machine"),
+				fmt.Sprintf("Control plane certificates expire on %s", notAfter.Format("2006-01-02")),
+				fmt.Sprintf("Roll out the machine or renew its certificates within %d days", days))
+		}
+	}
+}
+
+// auditOptions selects the optional checks of an audit run.
+type auditOptions struct {
+	workload    bool
+	rules       []policyRule
+	releases    map[string]k8sRelease
+	maxPatchLag int
+	certWindow  int
+	concurrency int
+}
+
+// nsLister caches namespace-wide lists, so clusters sharing a namespace
+// fetch its machines, control planes and secrets once. It is safe for
+// concurrent use.
+type nsLister struct {
+	mu      sync.Mutex
+	entries map[string]*nsEntry
+}
+
+type nsEntry struct {
+	once  sync.Once
+	items []map[string]interface{}
+}
+
+func (l *nsLister) list(resource, namespace string) []map[string]interface{} {
+	l.mu.Lock()
+	e, ok := l.entries[resource+"/"+namespace]
+	if !ok {
+		e = &nsEntry{}
+		l.entries[resource+"/"+namespace] = e
+	}
+	l.mu.Unlock()
+	e.once.Do(func() { e.items, _ = kubectl.RunJSON(resource, namespace, "", false) })
+	return e.items
+}
+
+func runAudit(clusterFilter, namespace string, allNamespaces bool, opts auditOptions) []auditReport {
+	var clusters []map[string]interface{}
+	if clusterFilter != "" {
+		items, _ := kubectl.RunJSON("clusters.cluster.x-k8s.io/"+clusterFilter, namespace, "", false)
+		clusters = items
+	} else {
+		items, _ := kubectl.RunJSON("clusters.cluster.x-k8s.io", namespace, "", allNamespaces)
+		clusters = items
+	}
+
+	// Audit clusters on a pool of workers; reports keep the cluster order.
+	reports := make([]auditReport, len(clusters))
+	lister := &nsLister{entries: map[string]*nsEntry{}}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(opts.concurrency, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				reports[i] = auditCluster(clusters[i], opts, lister)
+			}
+		}()
+	}
+	for i := range clusters {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 	return reports
 }
 
+// auditCluster runs every check against one cluster and its objects.
+func auditCluster(cluster map[string]interface{}, opts auditOptions, lister *nsLister) auditReport {
+	meta := kubectl.GetMap(cluster, "metadata")
+	cName, _ := meta["name"].(string)
+	cNS, _ := meta["namespace"].(string)
+	if cName == "" {
+		cName = "unknown"
+	}
+	if cNS == "" {
+		cNS = "default"
+	}
+
+	report := auditReport{ClusterName: cNS + "/" + cName}
+
+	checkPSS(cluster, &report)
+	checkNetworkSecurity(cluster, &report)
+	checkReplicas(cluster, &report)
+	applyRules(opts.rules, "Cluster", []map[string]interface{}{cluster}, &report)
+
+	// KubeadmControlPlane
+	kcps := lister.list("kubeadmcontrolplanes.controlplane.cluster.x-k8s.io", cNS)
+	var clusterKCP map[string]interface{}
+	for _, kcp := range kcps {
+		ownerRefs := kubectl.GetSlice(kubectl.GetMap(kcp, "metadata"), "ownerReferences")
+		for _, ref := range ownerRefs {
+			rm, ok := ref.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if rn, _ := rm["name"].(string); rn == cName {
+				clusterKCP = kcp
+				checkKubeadmSecurity(kcp, &report)
+				applyRules(opts.rules, "KubeadmControlPlane", []map[string]interface{}{kcp}, &report)
+				break
+			}
+		}
+	}
+
+	// Machines
+	machines := lister.list("machines.cluster.x-k8s.io", cNS)
+	var clusterMachines []map[string]interface{}
+	for _, machine := range machines {
+		labels := kubectl.GetMap(kubectl.GetMap(machine, "metadata"), "labels")
+		if cn, _ := labels["cluster.x-k8s.io/cluster-name"].(string); cn == cName {
+			clusterMachines = append(clusterMachines, machine)
+			checkMachineSecurity(machine, &report)
+		}
+	}
+	applyRules(opts.rules, "Machine", clusterMachines, &report)
+	var infraMachines []map[string]interface{}
+	for _, m := range clusterMachines {
+		if obj := getRef(kubectl.GetMap(kubectl.GetMap(m, "spec"), "infrastructureRef"), cNS); obj != nil {
+			infraMachines = append(infraMachines, obj)
+		}
+	}
+	checkVersions(cluster, clusterKCP, clusterMachines, infraMachines, opts, &report)
+
+	// Provider-specific settings of the cluster, its machines and the
+	// control plane machine template.
+	infra := infraMachines
+	if obj := getRef(kubectl.GetMap(kubectl.GetMap(cluster, "spec"), "infrastructureRef"), cNS); obj != nil {
+		infra = append(infra, obj)
+	}
+	if clusterKCP != nil {
+		if obj := getRef(kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(clusterKCP, "spec"), "machineTemplate"), "infrastructureRef"), cNS); obj != nil {
+			infra = append(infra, obj)
+		}
+	}
+	checkProviderSecurity(infra, &report)
+
+	// Secrets
+	secrets := lister.list("secrets", cNS)
+	var clusterSecrets []map[string]interface{}
+	for _, s := range secrets {
+		labels := kubectl.GetMap(kubectl.GetMap(s, "metadata"), "labels")
+		if cn, _ := labels["cluster.x-k8s.io/cluster-name"].(string); cn == cName {
+			clusterSecrets = append(clusterSecrets, s)
+		}
+	}
+	checkSecretExposure(clusterSecrets, &report)
+	checkCertificates(cluster, clusterKCP, clusterMachines, secrets, opts.certWindow, &report)
+
+	if opts.workload {
+		auditWorkload(cName, cNS, &report)
+	}
+
+	return report
+}
+
 func printReport(report auditReport) {
 	sep := strings.Repeat("=", 60)
 	fmt.Printf("\n%s\nSecurity Audit: %s\n%s\n", sep, report.ClusterName, sep)
@@ -320,7 +1298,7 @@ func printReport(report auditReport) {
 
 		fmt.Printf("\n%s %s (%d)\n%s\n", icons[sev], strings.ToUpper(sev), len(filtered), strings.Repeat("-", 40))
 		for _, f := range filtered {
-			fmt.Printf("\n  [%s] %s\n    %s\n", f.Category, f.Resource, f.Message)
+			fmt.Printf("\n  [%s] %s (%s)\n    %s\n", f.Category, f.Resource, f.ID, f.Message)
 			if f.Recommendation != "" {
 				fmt.Printf("    → %s\n", f.Recommendation)
 			}
@@ -353,12 +1331,290 @@ func exportJSON(reports []auditReport) string {
 	return string(data)
 }
 
+// findingKey identifies a finding across runs; reports written before
+// finding IDs existed get their ID derived the same way add does.
+func findingKey(cluster string, f finding) string {
+	if f.ID != "" {
+		return f.ID
+	}
+	return findingID(cluster, f.Category, f.Resource, f.Message)
+}
+
+// loadPreviousReport reads a report written by --format json, keyed by ID.
+func loadPreviousReport(path string) (map[string]finding, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []struct {
+		Cluster  string    `json:"cluster"`
+		Findings []finding `json:"findings"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	findings := map[string]finding{}
+	clusters := map[string]string{}
+	for _, e := range entries {
+		for _, f := range e.Findings {
+			key := findingKey(e.Cluster, f)
+			findings[key] = f
+			clusters[key] = e.Cluster
+		}
+	}
+	return findings, clusters, nil
+}
+
+// auditDiff splits findings into those introduced since the previous report,
+// those resolved since, and those present in both.
+type auditDiff struct {
+	added, resolved, persisting []finding
+	clusters                    map[string]string
+}
+
+func compareReports(reports []auditReport, previous map[string]finding, prevClusters map[string]string) auditDiff {
+	diff := auditDiff{clusters: map[string]string{}}
+	current := map[string]bool{}
+	for _, r := range reports {
+		for _, f := range r.Findings {
+			key := findingKey(r.ClusterName, f)
+			current[key] = true
+			diff.clusters[key] = r.ClusterName
+			if _, ok := previous[key]; ok {
+				diff.persisting = append(diff.persisting, f)
+			} else {
+				diff.added = append(diff.added, f)
+			}
+		}
+	}
+	var resolved []string
+	for key := range previous {
+		if !current[key] {
+			resolved = append(resolved, key)
+		}
+	}
+	sort.Strings(resolved)
+	for _, key := range resolved {
+		f := previous[key]
+		f.ID = key
+		diff.resolved = append(diff.resolved, f)
+		diff.clusters[key] = prevClusters[key]
+	}
+	return diff
+}
+
+func printDiff(w io.Writer, diff auditDiff) {
+	sep := strings.Repeat("=", 60)
+	fmt.Fprintf(w, "\n%s\nComparison with previous report\n%s\n", sep, sep)
+	fmt.Fprintf(w, "New: %d, resolved: %d, persisting: %d\n", len(diff.added), len(diff.resolved), len(diff.persisting))
+	for _, section := range []struct {
+		title    string
+		findings []finding
+	}{{"➕ NEW", diff.added}, {"✅ RESOLVED", diff.resolved}} {
+		if len(section.findings) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s (%d)\n%s\n", section.title, len(section.findings), strings.Repeat("-", 40))
+		for _, f := range section.findings {
+			fmt.Fprintf(w, "  [%s] %s: %s in %s (%s)\n    %s\n", f.Severity, f.Category, f.Resource, diff.clusters[f.ID], f.ID, f.Message)
+		}
+	}
+}
+
+// sarifLevels maps audit severities to SARIF result levels.
+var sarifLevels = map[string]string{"high": "error", "medium": "warning", "low": "note", "info": "note"}
+
+// exportSARIF renders findings as SARIF 2.1.0 for code-scanning upload. Each
+// category becomes a rule; the resource is the result's location.
+func exportSARIF(reports []auditReport) string {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+		} `json:"physicalLocation"`
+		LogicalLocations []map[string]string `json:"logicalLocations"`
+	}
+	type result struct {
+		RuleID              string            `json:"ruleId"`
+		Level               string            `json:"level"`
+		Message             message           `json:"message"`
+		Locations           []location        `json:"locations"`
+		PartialFingerprints map[string]string `json:"partialFingerprints"`
+		Properties          map[string]string `json:"properties"`
+	}
+	type rule struct {
+		ID               string  `json:"id"`
+		Name             string  `json:"name"`
+		ShortDescription message `json:"shortDescription"`
+	}
+
+	var rules []rule
+	seen := map[string]bool{}
+	results := []result{}
+	for _, r := range reports {
+		for _, f := range r.Findings {
+			ruleID := strings.ToLower(strings.ReplaceAll(f.Category, " ", "-"))
+			if !seen[ruleID] {
+				seen[ruleID] = true
+				rules = append(rules, rule{ruleID, strings.ReplaceAll(f.Category, " ", ""), message{f.Category + " findings"}})
+			}
+			var loc location
+			loc.PhysicalLocation.ArtifactLocation.URI = "clusters/" + r.ClusterName + "/" + f.Resource
+			loc.LogicalLocations = []map[string]string{{"fullyQualifiedName": r.ClusterName + "/" + f.Resource, "kind": "resource"}}
+			text := f.Message
+			if f.Recommendation != "" {
+				text += ". " + f.Recommendation
+			}
+			results = append(results, result{
+				RuleID:              ruleID,
+				Level:               sarifLevels[f.Severity],
+				Message:             message{text},
+				Locations:           []location{loc},
+				PartialFingerprints: map[string]string{"auditFindingId": f.ID},
+				Properties:          map[string]string{"severity": f.Severity, "cluster": r.ClusterName},
+			})
+		}
+	}
+
+	doc := map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{map[string]interface{}{
+			"tool": map[string]interface{}{"driver": map[string]interface{}{
+				"name":           "audit-security",
+				"informationUri": "https://cluster-api.sigs.k8s.io/",
+				"rules":          rules,
+			}},
+			"results": results,
+		}},
+	}
+	data, _ := json.MarshalIndent(doc, "", "  ")
+	return string(data)
+}
+
+func mdCell(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "|", "\\|"), "\n", " ")
+}
+
+// exportMarkdown renders a summary table and per-cluster findings, suitable
+// for a pull request comment.
+func exportMarkdown(reports []auditReport) string {
+	var b strings.Builder
+	b.WriteString("# Security Audit\n\n")
+	b.WriteString("| Cluster | High | Medium | Low |\n|---|---:|---:|---:|\n")
+	for _, r := range reports {
+		fmt.Fprintf(&b, "| %s | %d | %d | %d |\n", mdCell(r.ClusterName), r.highCount(), r.mediumCount(), r.lowCount())
+	}
+	for _, r := range reports {
+		fmt.Fprintf(&b, "\n## %s\n\n", r.ClusterName)
+		if len(r.Findings) == 0 {
+			b.WriteString("No security findings.\n")
+			continue
+		}
+		b.WriteString("| Severity | Category | Resource | Finding | Recommendation | ID |\n|---|---|---|---|---|---|\n")
+		for _, sev := range []string{"high", "medium", "low", "info"} {
+			for _, f := range r.Findings {
+				if f.Severity == sev {
+					fmt.Fprintf(&b, "| %s | %s | `%s` | %s | %s | `%s` |\n", f.Severity, mdCell(f.Category),
+						mdCell(f.Resource), mdCell(f.Message), mdCell(f.Recommendation), f.ID)
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// exportHTML renders a self-contained HTML report with CSS bar charts of
+// findings per severity and per cluster; it needs no scripts or assets.
+func exportHTML(reports []auditReport) string {
+	colors := map[string]string{"high": "#d73a49", "medium": "#f66a0a", "low": "#dbab09", "info": "#0366d6"}
+	severities := []string{"high", "medium", "low", "info"}
+	totals := map[string]int{}
+	maxCluster := 1
+	for _, r := range reports {
+		for _, f := range r.Findings {
+			totals[f.Severity]++
+		}
+		if len(r.Findings) > maxCluster {
+			maxCluster = len(r.Findings)
+		}
+	}
+	maxSev := 1
+	for _, n := range totals {
+		if n > maxSev {
+			maxSev = n
+		}
+	}
+	bar := func(b *strings.Builder, label string, n, max int, color string) {
+		fmt.Fprintf(b, "<div class=\"row\"><span class=\"label\">%s</span><span class=\"bar\" style=\"width:%d%%;background:%s\"></span><span>%d</span></div>\n",
+			html.EscapeString(label), n*70/max, color, n)
+	}
+
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Security Audit</title>
+<style>
+body{font-family:sans-serif;margin:2em;color:#24292e}
+table{border-collapse:collapse;width:100%;margin-bottom:2em}
+th,td{border:1px solid #d1d5da;padding:4px 8px;text-align:left;vertical-align:top}
+.row{display:flex;align-items:center;margin:2px 0}
+.label{width:16em}
+.bar{display:inline-block;height:1em;margin-right:.5em}
+.sev{color:#fff;padding:0 4px;border-radius:3px}
+</style></head><body>
+<h1>Security Audit</h1>
+`)
+	fmt.Fprintf(&b, "<p>Generated %s</p>\n<h2>Findings by severity</h2>\n", time.Now().Format("2006-01-02 15:04:05"))
+	for _, sev := range severities {
+		bar(&b, sev, totals[sev], maxSev, colors[sev])
+	}
+	b.WriteString("<h2>Findings by cluster</h2>\n")
+	for _, r := range reports {
+		bar(&b, r.ClusterName, len(r.Findings), maxCluster, "#6f42c1")
+	}
+	for _, r := range reports {
+		fmt.Fprintf(&b, "<h2>%s</h2>\n", html.EscapeString(r.ClusterName))
+		if len(r.Findings) == 0 {
+			b.WriteString("<p>No security findings.</p>\n")
+			continue
+		}
+		b.WriteString("<table><tr><th>Severity</th><th>Category</th><th>Resource</th><th>Finding</th><th>Recommendation</th><th>ID</th></tr>\n")
+		for _, sev := range severities {
+			for _, f := range r.Findings {
+				if f.Severity != sev {
+					continue
+				}
+				fmt.Fprintf(&b, "<tr><td><span class=\"sev\" style=\"background:%s\">%s</span></td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+					colors[sev], sev, html.EscapeString(f.Category), html.EscapeString(f.Resource),
+					html.EscapeString(f.Message), html.EscapeString(f.Recommendation), f.ID)
+			}
+		}
+		b.WriteString("</table>\n")
+	}
+	b.WriteString("</body></html>\n")
+	return b.String()
+}
+
 func main() {
 	cluster := flag.String("c", "", "Specific cluster to audit")
 	namespace := flag.String("n", "", "Namespace to audit")
 	allNS := flag.Bool("A", false, "Audit all namespaces")
-	output := flag.String("o", "", "Write JSON report to file")
-	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write report to file (JSON unless --format is given)")
+	format := flag.String("format", "text", "Output format: text, json, sarif, markdown, html")
+	rulesFile := flag.String("rules", "", "YAML file of additional policy rules (field checks or Rego modules evaluated with opa)")
+	releasesFile := flag.String("releases", "", "YAML/JSON Kubernetes release table (minor -> eol, latestPatch) overriding the built-in one")
+	certWindow := flag.Int("cert-window", 30, "Flag certificates expiring within this many days")
+	maxPatchLag := flag.Int("max-patch-lag", 3, "Patch releases a cluster may fall behind before it is flagged")
+	workload := flag.Bool("workload", false, "Also audit each workload cluster's in-cluster posture via its kubeconfig secret")
+	failOn := flag.String("fail-on", "high", "Exit non-zero on findings at or above this severity: high, medium, low, none")
+	maxFindings := flag.Int("max-findings", -1, "Exit non-zero when more than N non-info findings remain (-1 disables)")
+	concurrency := flag.Int("concurrency", 8, "Number of clusters to audit in parallel")
+	compare := flag.String("compare", "", "Previous JSON report; print new, resolved and persisting findings and fail only on new ones")
+	ignoreFile := flag.String("ignore-file", "", "File of finding IDs to suppress, one per line")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nAudit security posture of CAPI clusters.\n\nFlags:\n", os.Args[0])
@@ -371,39 +1627,118 @@ func main() {
 		os.Exit(1)
 	}
 
+	switch *format {
+	case "text", "json", "sarif", "markdown", "html":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown --format %q (expected text, json, sarif, markdown or html)\n", *format)
+		os.Exit(1)
+	}
+	threshold, ok := severityRank[*failOn]
+	if *failOn == "none" {
+		threshold, ok = len(severityRank), true
+	}
+	if !ok || threshold == 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --fail-on %q (expected high, medium, low or none)\n", *failOn)
+		os.Exit(1)
+	}
+	ignored, err := loadIgnoreFile(*ignoreFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var previous map[string]finding
+	var prevClusters map[string]string
+	if *compare != "" {
+		if previous, prevClusters, err = loadPreviousReport(*compare); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	opts := auditOptions{workload: *workload, maxPatchLag: *maxPatchLag, certWindow: *certWindow, concurrency: *concurrency}
+	if *rulesFile != "" {
+		if opts.rules, err = loadRules(*rulesFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if opts.releases, err = loadReleases(*releasesFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	fmt.Println("Running security audit...")
-	reports := runAudit(*cluster, *namespace, *allNS)
+	reports := runAudit(*cluster, *namespace, *allNS, opts)
+	if n := suppress(reports, ignored); n > 0 {
+		fmt.Printf("Suppressed %d finding(s) listed in %s\n", n, *ignoreFile)
+	}
 
 	if len(reports) == 0 {
 		fmt.Println("No clusters found to audit")
 		os.Exit(0)
 	}
 
-	if *format == "json" || *output != "" {
-		jsonOut := exportJSON(reports)
+	var out string
+	switch *format {
+	case "json":
+		out = exportJSON(reports)
+	case "sarif":
+		out = exportSARIF(reports)
+	case "markdown":
+		out = exportMarkdown(reports)
+	case "html":
+		out = exportHTML(reports)
+	default:
 		if *output != "" {
-			if err := os.WriteFile(*output, []byte(jsonOut), 0o644); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Printf("Report written to: %s\n", *output)
-		} else {
-			fmt.Println(jsonOut)
+			out = exportJSON(reports)
 		}
-	} else {
+	}
+	switch {
+	case *output != "":
+		if err := os.WriteFile(*output, []byte(out), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Report written to: %s\n", *output)
+	case out != "":
+		fmt.Println(out)
+	default:
 		for _, r := range reports {
 			printReport(r)
 		}
 	}
 
-	hasHigh := false
-	for _, r := range reports {
-		if r.highCount() > 0 {
-			hasHigh = true
-			break
+	gated := reports
+	if *compare != "" {
+		diff := compareReports(reports, previous, prevClusters)
+		w := io.Writer(os.Stdout)
+		if *format != "text" && *output == "" {
+			w = os.Stderr
 		}
+		printDiff(w, diff)
+		// Only regressions count towards the exit code.
+		gated = []auditReport{{Findings: diff.added}}
+	}
+
+	failing, total := 0, 0
+	for _, r := range gated {
+		for _, f := range r.Findings {
+			if f.Severity == "info" {
+				continue
+			}
+			total++
+			if severityRank[f.Severity] >= threshold {
+				failing++
+			}
+		}
+	}
+	if failing > 0 {
+		fmt.Fprintf(os.Stderr, "%d finding(s) at or above %s severity\n", failing, *failOn)
+		os.Exit(1)
 	}
-	if hasHigh {
+	if *maxFindings >= 0 && total > *maxFindings {
+		fmt.Fprintf(os.Stderr, "%d findings exceed --max-findings %d\n", total, *maxFindings)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,497 @@
+// chaos-verify runs a remediation fire-drill against a CAPI cluster.
+//
+// It deliberately breaks one Machine (by deleting it, requesting remediation,
+// or injecting an unhealthy Node condition) and then verifies that
+// MachineHealthCheck remediation and the owning controller restore capacity
+// within an SLO, producing a pass/fail report. An injected Node condition is
+// removed again when the drill ends or is interrupted.
+//
+// Usage:
+//
+//	go run ./chaos-verify [flags] <cluster-name>
+//
+// Examples:
+//
+//	go run ./chaos-verify -n default --dry-run my-cluster
+//	go run ./chaos-verify -n default --md my-cluster-md-0 --yes my-cluster
+//	go run ./chaos-verify --action remediate --machine my-cluster-md-0-abcde --slo 20m --yes my-cluster
+//	go run ./chaos-verify --action node-condition --format json -o drill.json --yes my-cluster
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"k8s-cluster-api-tools/internal/health"
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const (
+	machineResource = "machines.cluster.x-k8s.io"
+	mhcResource     = "machinehealthchecks.cluster.x-k8s.io"
+
+	remediateAnnotation = "cluster.x-k8s.io/remediate-machine"
+	chaosConditionType  = "ChaosVerifyInjected"
+)
+
+var actions = map[string]string{
+	"delete":         "Delete the Machine and wait for its owner to replace it",
+	"remediate":      "Annotate the Machine for MachineHealthCheck remediation",
+	"node-condition": "Inject an unhealthy condition on the workload Node",
+}
+
+type owner struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Resource string `json:"-"`
+	Label    string `json:"-"`
+}
+
+type drillResult struct {
+	Cluster        string   `json:"cluster"`
+	Namespace      string   `json:"namespace"`
+	Action         string   `json:"action"`
+	Machine        string   `json:"machine"`
+	Node           string   `json:"node,omitempty"`
+	Owner          owner    `json:"owner"`
+	HealthCheck    string   `json:"machine_health_check,omitempty"`
+	DesiredReady   int      `json:"desired_ready"`
+	SLO            string   `json:"slo"`
+	StartedAt      string   `json:"started_at"`
+	DetectedAfter  string   `json:"detected_after,omitempty"`
+	RecoveredAfter string   `json:"recovered_after,omitempty"`
+	Replacements   []string `json:"replacements,omitempty"`
+	Passed         bool     `json:"passed"`
+	Message        string   `json:"message"`
+}
+
+func isReady(m map[string]interface{}) bool {
+	for _, c := range health.GetConditions(m) {
+		cm, _ := c.(map[string]interface{})
+		if t, _ := cm["type"].(string); t == "Ready" || t == "Available" {
+			if s, _ := cm["status"].(string); s == "True" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ownerOf resolves the controller that is expected to replace the machine.
+func ownerOf(machine map[string]interface{}) (owner, error) {
+	labels := kubectl.Labels(machine)
+	if cp := labels["cluster.x-k8s.io/control-plane-name"]; cp != "" {
+		return owner{"KubeadmControlPlane", cp, "kubeadmcontrolplanes.controlplane.cluster.x-k8s.io",
+			"cluster.x-k8s.io/control-plane-name=" + cp}, nil
+	}
+	if md := labels["cluster.x-k8s.io/deployment-name"]; md != "" {
+		return owner{"MachineDeployment", md, "machinedeployments.cluster.x-k8s.io",
+			"cluster.x-k8s.io/deployment-name=" + md}, nil
+	}
+	if ms := labels["cluster.x-k8s.io/set-name"]; ms != "" {
+		return owner{"MachineSet", ms, "machinesets.cluster.x-k8s.io",
+			"cluster.x-k8s.io/set-name=" + ms}, nil
+	}
+	return owner{}, fmt.Errorf("machine %s has no replicating owner; nothing would replace it",
+		kubectl.GetString(machine, "metadata.name"))
+}
+
+func findHealthCheck(cluster, namespace string, machine map[string]interface{}) map[string]interface{} {
+	mhcs, _ := kubectl.RunJSON(mhcResource, namespace, "", false)
+	labels := kubectl.Labels(machine)
+	for _, mhc := range mhcs {
+		if kubectl.GetString(mhc, "spec.clusterName") != cluster {
+			continue
+		}
+		if kubectl.MatchesSelector(kubectl.GetMap(kubectl.GetMap(mhc, "spec"), "selector"), labels) {
+			return mhc
+		}
+	}
+	return nil
+}
+
+// pickMachine chooses a healthy worker machine, optionally restricted to a
+// MachineDeployment. Control plane machines are only used when named.
+func pickMachine(cluster, namespace, md, name string) (map[string]interface{}, error) {
+	if name != "" {
+		items, err := kubectl.RunJSON(machineResource+"/"+name, namespace, "", false)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			return nil, fmt.Errorf("machine %s/%s not found", namespace, name)
+		}
+		return items[0], nil
+	}
+	label := "cluster.x-k8s.io/cluster-name=" + cluster
+	if md != "" {
+		label += ",cluster.x-k8s.io/deployment-name=" + md
+	}
+	items, err := kubectl.RunJSON(machineResource, namespace, label, false)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return kubectl.GetString(items[i], "metadata.name") < kubectl.GetString(items[j], "metadata.name")
+	})
+	for _, m := range items {
+		if _, isCP := kubectl.Labels(m)["cluster.x-k8s.io/control-plane"]; isCP {
+			continue
+		}
+		if kubectl.GetString(m, "metadata.deletionTimestamp") == "" && isReady(m) {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("no healthy worker machine found for cluster %s", cluster)
+}
+
+func readyCount(o owner, namespace string) (int, []map[string]interface{}) {
+	machines, _ := kubectl.RunJSON(machineResource, namespace, o.Label, false)
+	ready := 0
+	for _, m := range machines {
+		if kubectl.GetString(m, "metadata.deletionTimestamp") == "" && isReady(m) {
+			ready++
+		}
+	}
+	return ready, machines
+}
+
+// injectNodeCondition appends a condition matching the MachineHealthCheck's
+// first unhealthy condition so that the MHC marks the machine for remediation.
+// The returned func removes the condition again if the Node still exists.
+func injectNodeCondition(cluster, namespace, node string, mhc map[string]interface{}) (func(), error) {
+	condType, condStatus := chaosConditionType, "True"
+	for _, c := range kubectl.GetSlice(kubectl.GetMap(mhc, "spec"), "unhealthyConditions") {
+		cm, _ := c.(map[string]interface{})
+		if t, _ := cm["type"].(string); t != "" && t != "Ready" {
+			condType = t
+			condStatus, _ = cm["status"].(string)
+			break
+		}
+	}
+	if condType == chaosConditionType {
+		return nil, fmt.Errorf("MachineHealthCheck %s has no unhealthyConditions other than Ready; kubelet would overwrite an injected Ready condition",
+			kubectl.GetString(mhc, "metadata.name"))
+	}
+
+	kubeconfig, err := kubectl.WorkloadKubeconfig(cluster, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	patch, _ := json.Marshal([]map[string]interface{}{{
+		"op":   "add",
+		"path": "/status/conditions/-",
+		"value": map[string]interface{}{
+			"type": condType, "status": condStatus, "reason": "ChaosVerify",
+			"message":            "Injected by chaos-verify",
+			"lastTransitionTime": now, "lastHeartbeatTime": now,
+		},
+	}})
+	ok, _, errMsg := kubectl.Run([]string{"--kubeconfig", kubeconfig, "patch", "node", node,
+		"--subresource=status", "--type", "json", "-p", string(patch)}, 0)
+	if !ok {
+		os.Remove(kubeconfig)
+		return nil, fmt.Errorf("patch node %s: %s", node, strings.TrimSpace(errMsg))
+	}
+	return func() {
+		defer os.Remove(kubeconfig)
+		if err := removeNodeCondition(kubeconfig, node); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; remove the %s condition from node %s by hand\n", err, condType, node)
+		}
+	}, nil
+}
+
+// removeNodeCondition drops the condition injected by chaos-verify from the
+// Node. A Node that was already deleted by remediation is left alone.
+func removeNodeCondition(kubeconfig, node string) error {
+	ok, out, errMsg := kubectl.Run([]string{"--kubeconfig", kubeconfig, "get", "node", node, "-o", "json"}, 0)
+	if !ok {
+		if strings.Contains(errMsg, "NotFound") {
+			return nil
+		}
+		return fmt.Errorf("get node %s: %s", node, strings.TrimSpace(errMsg))
+	}
+	items, err := kubectl.ParseItems(out)
+	if err != nil || len(items) == 0 {
+		return fmt.Errorf("get node %s: %v", node, err)
+	}
+	for i, c := range health.GetConditions(items[0]) {
+		cm, _ := c.(map[string]interface{})
+		if reason, _ := cm["reason"].(string); reason != "ChaosVerify" {
+			continue
+		}
+		// The test op guards against the list shifting between get and patch.
+		path := fmt.Sprintf("/status/conditions/%d", i)
+		patch, _ := json.Marshal([]map[string]interface{}{
+			{"op": "test", "path": path + "/reason", "value": "ChaosVerify"},
+			{"op": "remove", "path": path},
+		})
+		ok, _, errMsg := kubectl.Run([]string{"--kubeconfig", kubeconfig, "patch", "node", node,
+			"--subresource=status", "--type", "json", "-p", string(patch)}, 0)
+		if !ok {
+			return fmt.Errorf("patch node %s: %s", node, strings.TrimSpace(errMsg))
+		}
+		return nil
+	}
+	return nil
+}
+
+// inject breaks the machine. The returned func, if any, undoes changes that
+// remediation does not clean up by itself.
+func inject(action, cluster, namespace, machine, node string, mhc map[string]interface{}) (func(), error) {
+	switch action {
+	case "delete":
+		ok, _, errMsg := kubectl.Run([]string{"delete", machineResource, machine, "-n", namespace, "--wait=false"}, 0)
+		if !ok {
+			return nil, fmt.Errorf("delete machine %s: %s", machine, strings.TrimSpace(errMsg))
+		}
+	case "remediate":
+		ok, _, errMsg := kubectl.Run([]string{"annotate", machineResource, machine, "-n", namespace,
+			remediateAnnotation + "=", "--overwrite"}, 0)
+		if !ok {
+			return nil, fmt.Errorf("annotate machine %s: %s", machine, strings.TrimSpace(errMsg))
+		}
+	case "node-condition":
+		return injectNodeCondition(cluster, namespace, node, mhc)
+	}
+	return nil, nil
+}
+
+// observe waits for the broken machine to be taken out of service and for the
+// owner to be back at full ready capacity with a replacement machine.
+func observe(res *drillResult, before map[string]bool, slo, interval time.Duration, progress io.Writer) {
+	start := time.Now()
+	deadline := start.Add(slo)
+	var detected time.Duration
+	for {
+		ready, machines := readyCount(res.Owner, res.Namespace)
+
+		gone := true
+		var replacements []string
+		for _, m := range machines {
+			name := kubectl.GetString(m, "metadata.name")
+			if name == res.Machine && kubectl.GetString(m, "metadata.deletionTimestamp") == "" {
+				gone = false
+			}
+			if !before[name] {
+				replacements = append(replacements, name)
+			}
+		}
+		if gone && detected == 0 {
+			detected = time.Since(start)
+			res.DetectedAfter = detected.Round(time.Second).String()
+			fmt.Fprintf(progress, "   %s machine %s taken out of service\n", time.Now().Format("15:04:05"), res.Machine)
+		}
+		res.Replacements = replacements
+
+		if gone && ready >= res.DesiredReady && len(replacements) > 0 {
+			res.RecoveredAfter = time.Since(start).Round(time.Second).String()
+			res.Passed = true
+			res.Message = fmt.Sprintf("capacity restored in %s (SLO %s)", res.RecoveredAfter, res.SLO)
+			return
+		}
+		if time.Now().After(deadline) {
+			switch {
+			case !gone:
+				res.Message = "machine was never remediated within the SLO"
+			case len(replacements) == 0:
+				res.Message = "no replacement machine was created within the SLO"
+			default:
+				res.Message = fmt.Sprintf("only %d/%d machines ready when the SLO expired", ready, res.DesiredReady)
+			}
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+func printResult(r drillResult) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nCHAOS DRILL: %s/%s\n%s\n", sep, r.Namespace, r.Cluster, sep)
+	fmt.Printf("  Action:       %s\n", r.Action)
+	fmt.Printf("  Machine:      %s\n", r.Machine)
+	if r.Node != "" {
+		fmt.Printf("  Node:         %s\n", r.Node)
+	}
+	fmt.Printf("  Owner:        %s/%s (desired ready: %d)\n", r.Owner.Kind, r.Owner.Name, r.DesiredReady)
+	if r.HealthCheck != "" {
+		fmt.Printf("  HealthCheck:  %s\n", r.HealthCheck)
+	}
+	fmt.Printf("  SLO:          %s\n", r.SLO)
+	if r.DetectedAfter != "" {
+		fmt.Printf("  Detected:     %s\n", r.DetectedAfter)
+	}
+	if r.RecoveredAfter != "" {
+		fmt.Printf("  Recovered:    %s\n", r.RecoveredAfter)
+	}
+	if len(r.Replacements) > 0 {
+		fmt.Printf("  Replacements: %s\n", strings.Join(r.Replacements, ", "))
+	}
+	if r.Passed {
+		fmt.Printf("\n✅ PASS: %s\n", r.Message)
+	} else {
+		fmt.Printf("\n❌ FAIL: %s\n", r.Message)
+	}
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace of the cluster")
+	machineName := flag.String("machine", "", "Machine to break (default: first healthy worker)")
+	md := flag.String("md", "", "Pick the machine from this MachineDeployment")
+	action := flag.String("action", "delete", "Fault to inject: delete, remediate, node-condition")
+	slo := flag.Duration("slo", 15*time.Minute, "Time allowed to restore capacity")
+	interval := flag.Duration("interval", 15*time.Second, "Polling interval")
+	dryRun := flag.Bool("dry-run", false, "Show what would be broken and exit")
+	yes := flag.Bool("yes", false, "Run without confirmation")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <cluster-name>\n\nBreak a Machine on purpose and verify CAPI remediation restores capacity within an SLO.\n\nActions:\n", os.Args[0])
+		names := make([]string, 0, len(actions))
+		for a := range actions {
+			names = append(names, a)
+		}
+		sort.Strings(names)
+		for _, a := range names {
+			fmt.Fprintf(os.Stderr, "  %-15s %s\n", a, actions[a])
+		}
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	cluster := flag.Arg(0)
+	if _, ok := actions[*action]; !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown action %q\n", *action)
+		os.Exit(1)
+	}
+
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown --format %q (expected text or json)\n", *format)
+		os.Exit(1)
+	}
+	// Progress goes to stderr unless printing text, so the report can be piped.
+	progress := os.Stdout
+	if *format != "text" {
+		progress = os.Stderr
+	}
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	machine, err := pickMachine(cluster, *namespace, *md, *machineName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	o, err := ownerOf(machine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	res := drillResult{
+		Cluster:   cluster,
+		Namespace: *namespace,
+		Action:    *action,
+		Machine:   kubectl.GetString(machine, "metadata.name"),
+		Node:      kubectl.GetString(machine, "status.nodeRef.name"),
+		Owner:     o,
+		SLO:       slo.String(),
+	}
+
+	mhc := findHealthCheck(cluster, *namespace, machine)
+	if mhc != nil {
+		res.HealthCheck = kubectl.GetString(mhc, "metadata.name")
+	} else if *action != "delete" {
+		fmt.Fprintf(os.Stderr, "Error: no MachineHealthCheck covers machine %s; action %q relies on MHC remediation\n", res.Machine, *action)
+		os.Exit(1)
+	}
+	if *action == "node-condition" && res.Node == "" {
+		fmt.Fprintf(os.Stderr, "Error: machine %s has no nodeRef\n", res.Machine)
+		os.Exit(1)
+	}
+
+	ready, machines := readyCount(o, *namespace)
+	res.DesiredReady = ready
+	before := map[string]bool{}
+	for _, m := range machines {
+		before[kubectl.GetString(m, "metadata.name")] = true
+	}
+
+	fmt.Fprintf(progress, "Fire-drill: %s machine %s (owner %s/%s, %d ready)\n", *action, res.Machine, o.Kind, o.Name, ready)
+	if *dryRun {
+		fmt.Fprintln(progress, "Dry run: no changes made")
+		return
+	}
+	if !*yes {
+		fmt.Fprint(progress, "\nThis will disrupt a live machine. Continue? [y/N]: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Fprintln(progress, "Aborted")
+			os.Exit(1)
+		}
+	}
+
+	res.StartedAt = time.Now().Format(time.RFC3339)
+	undo, err := inject(*action, cluster, *namespace, res.Machine, res.Node, mhc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if undo == nil {
+		undo = func() {}
+	}
+	// The fault is undone once, after observing or on interrupt, so the drill
+	// leaves nothing behind.
+	undo = sync.OnceFunc(undo)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		fmt.Fprintln(os.Stderr, "\nInterrupted")
+		undo()
+		os.Exit(130)
+	}()
+	fmt.Fprintf(progress, "Fault injected at %s; waiting up to %s for recovery...\n", res.StartedAt, res.SLO)
+	observe(&res, before, *slo, *interval, progress)
+	undo()
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(res, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(progress, "Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printResult(res)
+	}
+
+	if !res.Passed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,458 @@
+// check-autoscaler verifies the Cluster Autoscaler integration for node pools.
+//
+// For every MachineDeployment and MachinePool it validates the
+// cluster-api-autoscaler-node-group-min-size/max-size annotations, flags pools
+// that pin replicas while also being autoscaled (explicit replicas in the
+// Cluster topology or in last-applied configuration), checks that a
+// cluster-autoscaler deployment with the clusterapi provider discovers the
+// pool's namespace and cluster, and reports scale-from-zero pools whose
+// infrastructure template exposes no capacity (status.capacity or
+// capacity.cluster-autoscaler.kubernetes.io/* annotations).
+//
+// Usage:
+//
+//	go run ./check-autoscaler [flags]
+//
+// Examples:
+//
+//	go run ./check-autoscaler -n default
+//	go run ./check-autoscaler -A -c my-cluster
+//	go run ./check-autoscaler -A --format json -o autoscaler.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const (
+	minSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"
+	maxSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+	capacityPrefix    = "capacity.cluster-autoscaler.kubernetes.io/"
+)
+
+type finding struct {
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type pool struct {
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace"`
+	Name       string    `json:"name"`
+	Cluster    string    `json:"cluster"`
+	Replicas   int       `json:"replicas"`
+	MinSize    *int      `json:"min_size,omitempty"`
+	MaxSize    *int      `json:"max_size,omitempty"`
+	Autoscaled bool      `json:"autoscaled"`
+	Autoscaler string    `json:"autoscaler,omitempty"`
+	Findings   []finding `json:"findings,omitempty"`
+}
+
+func (p *pool) add(sev, format string, args ...interface{}) {
+	p.Findings = append(p.Findings, finding{sev, fmt.Sprintf(format, args...)})
+}
+
+// discovery is one --node-group-auto-discovery=clusterapi:... spec.
+type discovery struct {
+	namespace string
+	cluster   string
+	labels    map[string]string
+}
+
+type autoscaler struct {
+	Name          string   `json:"name"`
+	Provider      string   `json:"cloud_provider"`
+	Discovery     []string `json:"auto_discovery"`
+	ReadyReplicas int      `json:"ready_replicas"`
+	specs         []discovery
+}
+
+type report struct {
+	Autoscalers []*autoscaler `json:"autoscalers"`
+	Pools       []*pool       `json:"pools"`
+	Findings    []finding     `json:"findings,omitempty"`
+}
+
+func (d discovery) matches(p *pool, labels map[string]string) bool {
+	if d.namespace != "" && d.namespace != p.Namespace {
+		return false
+	}
+	if d.cluster != "" && d.cluster != p.Cluster {
+		return false
+	}
+	for k, v := range d.labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func parseDiscovery(value string) (discovery, bool) {
+	if !strings.HasPrefix(value, "clusterapi:") {
+		return discovery{}, false
+	}
+	d := discovery{labels: map[string]string{}}
+	for _, kv := range strings.Split(strings.TrimPrefix(value, "clusterapi:"), ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		switch k {
+		case "namespace":
+			d.namespace = v
+		case "clusterName":
+			d.cluster = v
+		case "":
+		default:
+			d.labels[k] = v
+		}
+	}
+	return d, true
+}
+
+func findAutoscalers() []*autoscaler {
+	var result []*autoscaler
+	deployments, _ := kubectl.RunJSON("deployments", "", "", true)
+	for _, dep := range deployments {
+		for _, c := range kubectl.GetSlice(nestedMap(dep, "spec.template.spec"), "containers") {
+			cm, _ := c.(map[string]interface{})
+			image, _ := cm["image"].(string)
+			if !strings.Contains(image, "cluster-autoscaler") {
+				continue
+			}
+			readyReplicas, _ := kubectl.GetNested(dep, "status.readyReplicas").(float64)
+			a := &autoscaler{
+				Name:          kubectl.GetString(dep, "metadata.namespace") + "/" + kubectl.GetString(dep, "metadata.name"),
+				ReadyReplicas: int(readyReplicas),
+			}
+			var args []string
+			for _, field := range []string{"command", "args"} {
+				for _, arg := range kubectl.GetSlice(cm, field) {
+					if s, ok := arg.(string); ok {
+						args = append(args, s)
+					}
+				}
+			}
+			for i, arg := range args {
+				name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+				if !strings.HasPrefix(arg, "--") {
+					continue
+				}
+				if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+					value = args[i+1]
+				}
+				switch name {
+				case "cloud-provider":
+					a.Provider = value
+				case "node-group-auto-discovery":
+					a.Discovery = append(a.Discovery, value)
+					if d, ok := parseDiscovery(value); ok {
+						a.specs = append(a.specs, d)
+					}
+				}
+			}
+			result = append(result, a)
+			break
+		}
+	}
+	return result
+}
+
+func nestedMap(item map[string]interface{}, path string) map[string]interface{} {
+	m, _ := kubectl.GetNested(item, path).(map[string]interface{})
+	if m == nil {
+		return map[string]interface{}{}
+	}
+	return m
+}
+
+func parseSize(annotations map[string]interface{}, key string, p *pool) *int {
+	raw, ok := annotations[key].(string)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		p.add("error", "Annotation %s=%q is not a non-negative integer", key[strings.LastIndex(key, "/")+1:], raw)
+		return nil
+	}
+	return &n
+}
+
+// lastAppliedReplicas reports whether the last applied configuration sets
+// spec.replicas, which a later apply would use to undo autoscaler decisions.
+func lastAppliedReplicas(annotations map[string]interface{}) bool {
+	raw, _ := annotations["kubectl.kubernetes.io/last-applied-configuration"].(string)
+	if raw == "" {
+		return false
+	}
+	var obj map[string]interface{}
+	if json.Unmarshal([]byte(raw), &obj) != nil {
+		return false
+	}
+	_, ok := kubectl.GetMap(obj, "spec")["replicas"]
+	return ok
+}
+
+// topologyReplicas returns the topology worker names that set replicas
+// explicitly, keyed by cluster namespace/name.
+func topologyReplicas(clusters []map[string]interface{}) map[string]bool {
+	pinned := map[string]bool{}
+	for _, c := range clusters {
+		key := kubectl.GetString(c, "metadata.namespace") + "/" + kubectl.GetString(c, "metadata.name")
+		for _, field := range []string{"machineDeployments", "machinePools"} {
+			for _, w := range kubectl.GetSlice(nestedMap(c, "spec.topology.workers"), field) {
+				wm, _ := w.(map[string]interface{})
+				if _, ok := wm["replicas"]; ok {
+					name, _ := wm["name"].(string)
+					pinned[key+"/"+name] = true
+				}
+			}
+		}
+	}
+	return pinned
+}
+
+// hasCapacity reports whether the autoscaler can learn a node's size without
+// an existing node: capacity annotations on the pool, or status.capacity on
+// the infrastructure template.
+func hasCapacity(item map[string]interface{}, infraKind, infraName, namespace string) (bool, string) {
+	annotations := nestedMap(item, "metadata.annotations")
+	if annotations[capacityPrefix+"cpu"] != nil && annotations[capacityPrefix+"memory"] != nil {
+		return true, ""
+	}
+	if infraKind == "" || infraName == "" {
+		return false, "no infrastructure reference"
+	}
+	ok, out, _ := kubectl.Run([]string{"get", strings.ToLower(infraKind), infraName, "-n", namespace, "-o", "json"}, kubectl.DefaultTimeout)
+	if !ok {
+		return false, fmt.Sprintf("%s %s not readable", infraKind, infraName)
+	}
+	var tmpl map[string]interface{}
+	if json.Unmarshal([]byte(out), &tmpl) != nil {
+		return false, fmt.Sprintf("%s %s not readable", infraKind, infraName)
+	}
+	capacity := nestedMap(tmpl, "status.capacity")
+	if capacity["cpu"] != nil && capacity["memory"] != nil {
+		return true, ""
+	}
+	tmplAnnotations := nestedMap(tmpl, "metadata.annotations")
+	if tmplAnnotations[capacityPrefix+"cpu"] != nil && tmplAnnotations[capacityPrefix+"memory"] != nil {
+		return true, ""
+	}
+	return false, fmt.Sprintf("%s %s has no status.capacity cpu/memory", infraKind, infraName)
+}
+
+func analyze(namespace, clusterFilter string, allNS bool) *report {
+	r := &report{Autoscalers: findAutoscalers()}
+	clusters, _ := kubectl.RunJSON("clusters", namespace, "", allNS)
+	pinned := topologyReplicas(clusters)
+
+	if len(r.Autoscalers) == 0 {
+		r.Findings = append(r.Findings, finding{"warning", "No cluster-autoscaler deployment visible in this cluster (it may run in the workload clusters)"})
+	}
+	for _, a := range r.Autoscalers {
+		if a.Provider != "clusterapi" {
+			r.Findings = append(r.Findings, finding{"warning", fmt.Sprintf("Autoscaler %s uses --cloud-provider=%q, not clusterapi", a.Name, a.Provider)})
+		}
+		if len(a.specs) == 0 {
+			r.Findings = append(r.Findings, finding{"warning", fmt.Sprintf("Autoscaler %s has no clusterapi --node-group-auto-discovery and will consider every annotated pool it can see", a.Name)})
+		}
+		if a.ReadyReplicas == 0 {
+			r.Findings = append(r.Findings, finding{"error", fmt.Sprintf("Autoscaler %s has no ready replicas", a.Name)})
+		}
+	}
+
+	for _, res := range []struct{ resource, kind string }{{"machinedeployments", "MachineDeployment"}, {"machinepools", "MachinePool"}} {
+		items, _ := kubectl.RunJSON(res.resource, namespace, "", allNS)
+		for _, item := range items {
+			replicas, _ := kubectl.GetNested(item, "spec.replicas").(float64)
+			p := &pool{
+				Kind:      res.kind,
+				Namespace: kubectl.GetString(item, "metadata.namespace"),
+				Name:      kubectl.GetString(item, "metadata.name"),
+				Cluster:   kubectl.GetString(item, "spec.clusterName"),
+				Replicas:  int(replicas),
+			}
+			if clusterFilter != "" && p.Cluster != clusterFilter {
+				continue
+			}
+			checkPool(p, item, r.Autoscalers, pinned)
+			r.Pools = append(r.Pools, p)
+		}
+	}
+	return r
+}
+
+func checkPool(p *pool, item map[string]interface{}, autoscalers []*autoscaler, pinned map[string]bool) {
+	annotations := nestedMap(item, "metadata.annotations")
+	p.MinSize = parseSize(annotations, minSizeAnnotation, p)
+	p.MaxSize = parseSize(annotations, maxSizeAnnotation, p)
+	_, hasMin := annotations[minSizeAnnotation]
+	_, hasMax := annotations[maxSizeAnnotation]
+	p.Autoscaled = hasMin || hasMax
+	if !p.Autoscaled {
+		return
+	}
+	if hasMin != hasMax {
+		p.add("error", "Only one of min-size/max-size is set; the autoscaler ignores the pool")
+	}
+	if p.MinSize != nil && p.MaxSize != nil {
+		if *p.MinSize > *p.MaxSize {
+			p.add("error", "min-size %d is greater than max-size %d", *p.MinSize, *p.MaxSize)
+		}
+		if *p.MaxSize == 0 {
+			p.add("warning", "max-size is 0; the pool can never scale up")
+		}
+		if p.Replicas < *p.MinSize || p.Replicas > *p.MaxSize {
+			p.add("warning", "Current replicas %d outside [%d, %d]; the autoscaler will not act until it is back in range", p.Replicas, *p.MinSize, *p.MaxSize)
+		}
+	}
+
+	topologyName := kubectl.Labels(item)["topology.cluster.x-k8s.io/deployment-name"]
+	if topologyName == "" {
+		topologyName = kubectl.Labels(item)["topology.cluster.x-k8s.io/pool-name"]
+	}
+	if topologyName != "" && pinned[p.Namespace+"/"+p.Cluster+"/"+topologyName] {
+		p.add("error", "Cluster topology sets replicas for worker %q; the topology controller will fight the autoscaler", topologyName)
+	}
+	if lastAppliedReplicas(annotations) {
+		p.add("warning", "Last applied configuration sets spec.replicas; re-applying the manifest will reset the autoscaler's decision")
+	}
+
+	labels := kubectl.Labels(item)
+	for _, a := range autoscalers {
+		if len(a.specs) == 0 {
+			p.Autoscaler = a.Name
+			break
+		}
+		for _, d := range a.specs {
+			if d.matches(p, labels) {
+				p.Autoscaler = a.Name
+				break
+			}
+		}
+		if p.Autoscaler != "" {
+			break
+		}
+	}
+	if p.Autoscaler == "" && len(autoscalers) > 0 {
+		p.add("error", "No cluster-autoscaler auto-discovery matches namespace %q / cluster %q", p.Namespace, p.Cluster)
+	}
+
+	if p.MinSize != nil && *p.MinSize == 0 {
+		infraKind := kubectl.GetString(item, "spec.template.spec.infrastructureRef.kind")
+		infraName := kubectl.GetString(item, "spec.template.spec.infrastructureRef.name")
+		if ok, why := hasCapacity(item, infraKind, infraName, p.Namespace); !ok {
+			p.add("error", "Scale from zero needs node capacity: %s; set status.capacity in the provider or %scpu/memory annotations on the %s", why, capacityPrefix, p.Kind)
+		}
+	}
+}
+
+func printReport(r *report) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nCLUSTER AUTOSCALER INTEGRATION\n%s\n", sep, sep)
+
+	fmt.Printf("\nAutoscalers: %d\n", len(r.Autoscalers))
+	for _, a := range r.Autoscalers {
+		discovery := "all pools"
+		if len(a.Discovery) > 0 {
+			discovery = strings.Join(a.Discovery, " ")
+		}
+		fmt.Printf("  %s (provider=%s, ready=%d): %s\n", a.Name, a.Provider, a.ReadyReplicas, discovery)
+	}
+	icons := map[string]string{"error": "❌", "warning": "⚠️"}
+	for _, f := range r.Findings {
+		fmt.Printf("  %s %s\n", icons[f.Severity], f.Message)
+	}
+
+	fmt.Printf("\nPools: %d\n", len(r.Pools))
+	for _, p := range r.Pools {
+		icon := "✅"
+		for _, f := range p.Findings {
+			if f.Severity == "error" {
+				icon = "❌"
+				break
+			}
+			icon = "⚠️"
+		}
+		if !p.Autoscaled {
+			fmt.Printf("\n➖ %s %s/%s (cluster %s): not autoscaled, replicas=%d\n", p.Kind, p.Namespace, p.Name, p.Cluster, p.Replicas)
+			continue
+		}
+		size := func(v *int) string {
+			if v == nil {
+				return "?"
+			}
+			return strconv.Itoa(*v)
+		}
+		fmt.Printf("\n%s %s %s/%s (cluster %s): replicas=%d, min=%s, max=%s\n", icon, p.Kind, p.Namespace, p.Name, p.Cluster, p.Replicas, size(p.MinSize), size(p.MaxSize))
+		if p.Autoscaler != "" {
+			fmt.Printf("   Managed by: %s\n", p.Autoscaler)
+		}
+		for _, f := range p.Findings {
+			fmt.Printf("   %s %s\n", icons[f.Severity], f.Message)
+		}
+	}
+}
+
+func (r *report) hasErrors() bool {
+	for _, f := range r.Findings {
+		if f.Severity == "error" {
+			return true
+		}
+	}
+	for _, p := range r.Pools {
+		for _, f := range p.Findings {
+			if f.Severity == "error" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace")
+	allNS := flag.Bool("A", false, "All namespaces")
+	cluster := flag.String("c", "", "Only check pools of this cluster")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nCheck Cluster Autoscaler annotations, discovery and scale-from-zero readiness of MachineDeployments/MachinePools.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	r := analyze(*namespace, *cluster, *allNS)
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(r, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(r)
+	}
+
+	if r.hasErrors() {
+		os.Exit(1)
+	}
+}
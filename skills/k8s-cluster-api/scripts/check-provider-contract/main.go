@@ -8,327 +8,639 @@
 //
 //	go run ./check-provider-contract -p aws
 //	go run ./check-provider-contract -t infrastructure --format json
+//	go run ./check-provider-contract -p aws --runtime
+//	go run ./check-provider-contract -p aws --rbac
+//	go run ./check-provider-contract -p aws --clusterctl --metadata metadata.yaml
+//	go run ./check-provider-contract -f crds.yaml
+//	go run ./check-provider-contract -d ./config/crd/bases -p mycloud
+//	go run ./check-provider-contract -d ./config/crd/bases --contract-version v1beta2
 package main
 
 import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"regexp"
+	goruntime "runtime"
 	"strings"
+	"sync"
 
+	"gopkg.in/yaml.v3"
+
+	"k8s-cluster-api-tools/internal/contract"
 	"k8s-cluster-api-tools/internal/kubectl"
 )
 
-type contractSpec struct {
-	RequiredSpec    []string
-	RequiredStatus  []string
-	OptionalSpec    []string
-	OptionalStatus  []string
-	Behaviors       []string
-}
+// fileList collects repeated -f flags.
+type fileList []string
 
-var infraClusterContract = contractSpec{
-	RequiredSpec:   []string{"controlPlaneEndpoint"},
-	RequiredStatus: []string{"ready", "failureReason", "failureMessage"},
-	Behaviors: []string{
-		"Must set OwnerReference to Cluster",
-		"Must set status.ready=true when infrastructure is ready",
-		"Must populate spec.controlPlaneEndpoint when available",
-		"Must report failureReason/failureMessage on terminal errors",
-	},
-}
+func (f *fileList) String() string     { return strings.Join(*f, ",") }
+func (f *fileList) Set(v string) error { *f = append(*f, v); return nil }
 
-var infraMachineContract = contractSpec{
-	RequiredSpec:   []string{"providerID"},
-	RequiredStatus: []string{"ready", "addresses"},
-	Behaviors: []string{
-		"Must set spec.providerID for node correlation",
-		"Must set status.ready=true when machine is provisioned",
-		"Must report status.addresses for node registration",
-	},
+// crdCache holds the cluster's CAPI provider CRDs, fetched once per run.
+var crdCache struct {
+	once sync.Once
+	crds []map[string]interface{}
 }
 
-var bootstrapConfigContract = contractSpec{
-	RequiredStatus: []string{"ready", "dataSecretName"},
-	Behaviors: []string{
-		"Must set status.ready=true when bootstrap data is generated",
-		"Must populate status.dataSecretName pointing to Secret",
-	},
+// getCRDs returns the provider CRDs of all API groups. The CRD list is
+// fetched once and cached; schemas are decoded concurrently, and CRDs outside
+// the provider groups are dropped before their schemas are decoded, which
+// matters on clusters with hundreds of CRDs.
+func getCRDs() []map[string]interface{} {
+	crdCache.once.Do(func() { crdCache.crds = fetchCRDs() })
+	return crdCache.crds
 }
 
-var controlPlaneContract = contractSpec{
-	RequiredSpec:   []string{"replicas", "version", "machineTemplate"},
-	RequiredStatus: []string{"ready", "initialized", "replicas", "updatedReplicas", "readyReplicas", "conditions"},
-	Behaviors: []string{
-		"Must set OwnerReference to Cluster",
-		"Must manage control plane Machines",
-		"Must report initialized=true after first control plane node",
-		"Must populate kubeconfig Secret",
-		"Must support rolling updates",
-	},
-}
+func fetchCRDs() []map[string]interface{} {
+	ok, stdout, _ := kubectl.Run([]string{"get", "crds", "-o", "json"}, 0)
+	if !ok {
+		return nil
+	}
+	var list struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &list); err != nil {
+		return nil
+	}
 
-type violation struct {
-	Severity    string `json:"severity"`
-	Category    string `json:"category"`
-	CRD         string `json:"crd"`
-	Message     string `json:"message"`
-	Requirement string `json:"requirement,omitempty"`
+	parsed := make([]map[string]interface{}, len(list.Items))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < goruntime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var head struct {
+					Spec struct {
+						Group string `json:"group"`
+					} `json:"spec"`
+				}
+				if json.Unmarshal(list.Items[i], &head) != nil || !providerGroup(head.Spec.Group) {
+					continue
+				}
+				var crd map[string]interface{}
+				if json.Unmarshal(list.Items[i], &crd) == nil {
+					parsed[i] = crd
+				}
+			}
+		}()
+	}
+	for i := range list.Items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var crds []map[string]interface{}
+	for _, crd := range parsed {
+		if crd != nil {
+			crds = append(crds, crd)
+		}
+	}
+	return crds
 }
 
-type contractReport struct {
-	Provider     string      `json:"provider"`
-	ProviderType string      `json:"type"`
-	Violations   []violation `json:"violations"`
-	CheckedCRDs  []string    `json:"crds"`
+func providerGroup(group string) bool {
+	for _, g := range contract.APIGroups {
+		if strings.HasSuffix(group, g) {
+			return true
+		}
+	}
+	return false
 }
 
-func (r *contractReport) addViolation(sev, cat, crd, msg, req string) {
-	r.Violations = append(r.Violations, violation{sev, cat, crd, msg, req})
+// parseDocs decodes a multi-document YAML (or JSON) file, unwrapping List
+// objects such as the output of "kubectl get crds -o yaml".
+func parseDocs(data []byte) ([]map[string]interface{}, error) {
+	var docs []map[string]interface{}
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	for {
+		var doc map[string]interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return docs, err
+		}
+		if doc == nil {
+			continue
+		}
+		if kind, _ := doc["kind"].(string); strings.HasSuffix(kind, "List") {
+			for _, item := range kubectl.GetSlice(doc, "items") {
+				if m, ok := item.(map[string]interface{}); ok {
+					docs = append(docs, m)
+				}
+			}
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
 }
 
-func (r *contractReport) errorCount() int {
-	n := 0
-	for _, v := range r.Violations {
-		if v.Severity == "error" {
-			n++
+// loadCRDFiles reads CRDs from the given files and from every .yaml, .yml and
+// .json file under dir, so contracts can be checked without a cluster.
+func loadCRDFiles(files []string, dir string) ([]map[string]interface{}, error) {
+	paths := append([]string{}, files...)
+	if dir != "" {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".yaml", ".yml", ".json":
+				if !d.IsDir() {
+					paths = append(paths, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var crds []map[string]interface{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		docs, err := parseDocs(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, doc := range docs {
+			if kind, _ := doc["kind"].(string); kind == "CustomResourceDefinition" {
+				crds = append(crds, doc)
+			}
 		}
 	}
-	return n
+	return crds, nil
 }
 
-func (r *contractReport) isCompliant() bool {
-	return r.errorCount() == 0
+// expectedOwners lists the CAPI kinds that must own each provider object type.
+var expectedOwners = map[string][]string{
+	"infrastructure-cluster": {"Cluster"},
+	"infrastructure-machine": {"Machine", "MachinePool"},
+	"bootstrap":              {"Machine", "MachinePool"},
+	"controlplane":           {"Cluster"},
 }
 
-func getCRDs(apiGroup string) []map[string]interface{} {
-	ok, stdout, _ := kubectl.Run([]string{"get", "crds", "-o", "json"}, 0)
-	if !ok {
-		return nil
-	}
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(stdout), &data); err != nil {
-		return nil
+// readyFields are the status fields CAPI reads for readiness, per contract
+// version and object type.
+var readyFields = map[string]map[string]string{
+	"v1beta1": {
+		"infrastructure-cluster": "ready",
+		"infrastructure-machine": "ready",
+		"bootstrap":              "ready",
+		"controlplane":           "ready",
+	},
+	"v1beta2": {
+		"infrastructure-cluster": "initialization.provisioned",
+		"infrastructure-machine": "initialization.provisioned",
+		"bootstrap":              "initialization.dataSecretCreated",
+		"controlplane":           "initialization.controlPlaneInitialized",
+	},
+}
+
+// readyCondition returns the status of the Ready condition, if present.
+func readyCondition(obj map[string]interface{}) (string, bool) {
+	for _, c := range kubectl.GetSlice(kubectl.GetMap(obj, "status"), "conditions") {
+		cond, _ := c.(map[string]interface{})
+		if t, _ := cond["type"].(string); t == "Ready" {
+			status, _ := cond["status"].(string)
+			return status, true
+		}
 	}
-	items, _ := data["items"].([]interface{})
-	var result []map[string]interface{}
-	for _, item := range items {
-		crd, ok := item.(map[string]interface{})
-		if !ok {
+	return "", false
+}
+
+// ownerNamed returns the name of the first owner of one of the given kinds.
+func ownerNamed(obj map[string]interface{}, kinds []string) string {
+	for _, o := range kubectl.GetSlice(kubectl.GetMap(obj, "metadata"), "ownerReferences") {
+		ref, _ := o.(map[string]interface{})
+		kind, _ := ref["kind"].(string)
+		apiVersion, _ := ref["apiVersion"].(string)
+		if !strings.HasPrefix(apiVersion, "cluster.x-k8s.io/") {
 			continue
 		}
-		spec := kubectl.GetMap(crd, "spec")
-		group, _ := spec["group"].(string)
-		if strings.HasSuffix(group, apiGroup) {
-			result = append(result, crd)
+		for _, k := range kinds {
+			if kind == k {
+				name, _ := ref["name"].(string)
+				return name
+			}
 		}
 	}
-	return result
+	return ""
 }
 
-func getCRDSchema(crd map[string]interface{}) map[string]interface{} {
-	spec := kubectl.GetMap(crd, "spec")
-	versions := kubectl.GetSlice(spec, "versions")
-	for _, v := range versions {
-		vm, ok := v.(map[string]interface{})
-		if !ok {
+// checkConversionServices verifies that the Service behind each CRD's
+// conversion webhook exists, adding violations to that CRD's report.
+func checkConversionServices(crds []map[string]interface{}, reports []contract.Report) {
+	byCRD := map[string]*contract.Report{}
+	for i := range reports {
+		for _, name := range reports[i].CheckedCRDs {
+			byCRD[name] = &reports[i]
+		}
+	}
+	for _, crd := range crds {
+		crdName := kubectl.GetString(crd, "metadata.name")
+		report := byCRD[crdName]
+		ns, name := contract.ConversionService(crd)
+		if report == nil || name == "" {
 			continue
 		}
-		if served, _ := vm["served"].(bool); served {
-			schema := kubectl.GetMap(vm, "schema")
-			return kubectl.GetMap(schema, "openAPIV3Schema")
+		ok, _, _ := kubectl.Run([]string{"get", "service", name, "-n", ns, "-o", "name"}, 0)
+		if !ok {
+			report.AddViolation("error", "Conversion", crdName,
+				fmt.Sprintf("Conversion webhook service %s/%s does not exist", ns, name),
+				"Conversion requests fail, so reads of non-storage versions break")
 		}
 	}
-	return nil
 }
 
-func checkSchemaFields(schema map[string]interface{}, required []string, path string) []string {
-	current := schema
-	if path != "" {
-		for _, part := range strings.Split(path, ".") {
-			if part == "" {
-				continue
-			}
-			props := kubectl.GetMap(current, "properties")
-			next, ok := props[part].(map[string]interface{})
-			if !ok {
-				return required // path not found
-			}
-			current = next
+func secretExists(namespace, name string) bool {
+	ok, _, _ := kubectl.Run([]string{"get", "secret", name, "-n", namespace, "-o", "name"}, 0)
+	return ok
+}
+
+// checkRuntimeObject verifies the behaviors of one live provider object:
+// owner references, the readiness field agreeing with the Ready condition,
+// providerID on ready machines, bootstrap data and kubeconfig secrets.
+func checkRuntimeObject(obj map[string]interface{}, version, crdType, crdName string, report *contract.Report) {
+	ns := kubectl.GetString(obj, "metadata.namespace")
+	kind := kubectl.GetString(obj, "kind")
+	id := fmt.Sprintf("%s %s/%s", kind, ns, kubectl.GetString(obj, "metadata.name"))
+	if kubectl.GetString(obj, "metadata.deletionTimestamp") != "" {
+		return
+	}
+	status := kubectl.GetMap(obj, "status")
+	readyField := readyFields[version][crdType]
+	ready, _ := kubectl.GetNested(status, readyField).(bool)
+
+	if owners := expectedOwners[crdType]; ownerNamed(obj, owners) == "" {
+		report.AddViolation("error", "Runtime", crdName,
+			fmt.Sprintf("%s has no OwnerReference to a %s", id, strings.Join(owners, " or ")),
+			"Contract requires the CAPI owner to be set so the object is adopted and garbage-collected")
+	}
+
+	if cond, ok := readyCondition(obj); ok {
+		switch {
+		case ready && cond == "False":
+			report.AddViolation("error", "Runtime", crdName,
+				fmt.Sprintf("%s has status.%s=true but Ready condition False", id, readyField), "")
+		case !ready && cond == "True":
+			report.AddViolation("warning", "Runtime", crdName,
+				fmt.Sprintf("%s has Ready condition True but status.%s is not true", id, readyField),
+				fmt.Sprintf("CAPI reads status.%s, not the Ready condition", readyField))
 		}
 	}
 
-	props := kubectl.GetMap(current, "properties")
-	var missing []string
-	for _, field := range required {
-		parts := strings.SplitN(field, ".", 2)
-		if _, ok := props[parts[0]]; !ok {
-			missing = append(missing, field)
+	clusterName := kubectl.Labels(obj)["cluster.x-k8s.io/cluster-name"]
+	switch crdType {
+	case "infrastructure-machine":
+		// Machine pools report spec.providerIDList instead.
+		if ready && !strings.HasSuffix(kind, "MachinePool") && kubectl.GetString(obj, "spec.providerID") == "" {
+			report.AddViolation("error", "Runtime", crdName,
+				fmt.Sprintf("%s is ready but spec.providerID is empty", id),
+				"Contract requires spec.providerID once the machine is provisioned")
+		}
+	case "bootstrap":
+		if ready {
+			secret, _ := status["dataSecretName"].(string)
+			if secret == "" {
+				report.AddViolation("error", "Runtime", crdName,
+					fmt.Sprintf("%s is ready but status.dataSecretName is empty", id), "")
+			} else if !secretExists(ns, secret) {
+				report.AddViolation("error", "Runtime", crdName,
+					fmt.Sprintf("%s references missing bootstrap secret %s", id, secret), "")
+			}
+		}
+	case "controlplane":
+		initialized, _ := status["initialized"].(bool)
+		initialized = initialized || (version == "v1beta2" && ready)
+		if clusterName == "" {
+			clusterName = ownerNamed(obj, []string{"Cluster"})
+		}
+		if (initialized || ready) && clusterName != "" && !secretExists(ns, clusterName+"-kubeconfig") {
+			report.AddViolation("error", "Runtime", crdName,
+				fmt.Sprintf("%s is initialized but secret %s-kubeconfig does not exist", id, clusterName),
+				"Contract requires the control plane to populate the kubeconfig Secret")
 		}
 	}
-	return missing
 }
 
-func checkInfraCluster(crd map[string]interface{}, report *contractReport) {
-	crdName, _ := kubectl.GetMap(crd, "metadata")["name"].(string)
-	schema := getCRDSchema(crd)
-	if schema == nil {
-		report.addViolation("error", "Schema", crdName, "No OpenAPI schema found in CRD", "")
-		return
-	}
+// runRuntimeCheck lists the live objects of every provider CRD and checks
+// their behavior. Template CRDs are skipped: templates have no status.
+func runRuntimeCheck(crds []map[string]interface{}, version, providerFilter, typeFilter string) []contract.Report {
+	var reports []contract.Report
+	for _, crd := range crds {
+		crdName := kubectl.GetString(crd, "metadata.name")
+		group := kubectl.GetString(crd, "spec.group")
+		inScope := false
+		for _, g := range contract.APIGroups {
+			inScope = inScope || contract.InGroup(crd, g)
+		}
+		plural := kubectl.GetString(crd, "spec.names.plural")
+		if !inScope || strings.HasSuffix(plural, "templates") {
+			continue
+		}
+		crdType := contract.DetectType(crdName)
+		if _, ok := expectedOwners[crdType]; !ok {
+			continue
+		}
+		providerName := strings.ToLower(kubectl.GetString(crd, "spec.names.kind"))
+		for _, s := range []string{"cluster", "machine", "config", "controlplane"} {
+			providerName = strings.ReplaceAll(providerName, s, "")
+		}
+		if providerFilter != "" && !strings.Contains(providerName, strings.ToLower(providerFilter)) {
+			continue
+		}
+		if typeFilter != "" && !strings.Contains(crdType, typeFilter) {
+			continue
+		}
 
-	missing := checkSchemaFields(schema, infraClusterContract.RequiredSpec, "spec")
-	for _, f := range missing {
-		report.addViolation("error", "Spec", crdName, "Missing required spec field: "+f, "Contract requires spec."+f)
+		report := contract.Report{Provider: providerName, ProviderType: crdType + "/runtime", CheckedCRDs: []string{crdName}}
+		items, err := kubectl.RunJSON(plural+"."+group, "", "", true)
+		if err != nil {
+			report.AddViolation("warning", "Runtime", crdName, fmt.Sprintf("Could not list objects: %v", err), "")
+		}
+		if len(items) == 0 && err == nil {
+			report.AddViolation("info", "Runtime", crdName, "No objects found; behavior not verified", "")
+		}
+		for _, obj := range items {
+			checkRuntimeObject(obj, version, crdType, crdName, &report)
+		}
+		reports = append(reports, report)
 	}
+	return reports
+}
 
-	missing = checkSchemaFields(schema, infraClusterContract.RequiredStatus, "status")
-	for _, f := range missing {
-		report.addViolation("error", "Status", crdName, "Missing required status field: "+f, "Contract requires status."+f)
-	}
+// permission is a set of verbs a provider manager needs on one resource.
+type permission struct {
+	group    string
+	resource string
+	verbs    []string
+}
 
-	statusProps := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(schema, "properties"), "status"), "properties")
-	if _, ok := statusProps["conditions"]; !ok {
-		report.addViolation("warning", "Conditions", crdName, "No conditions field in status", "Conditions recommended for observability")
-	}
+// corePermissions are needed by every provider manager, whatever its CRDs.
+var corePermissions = []permission{
+	{"cluster.x-k8s.io", "clusters", []string{"get", "list", "watch"}},
+	{"cluster.x-k8s.io", "machines", []string{"get", "list", "watch"}},
+	{"", "secrets", []string{"get"}},
 }
 
-func checkInfraMachine(crd map[string]interface{}, report *contractReport) {
-	crdName, _ := kubectl.GetMap(crd, "metadata")["name"].(string)
-	schema := getCRDSchema(crd)
-	if schema == nil {
-		report.addViolation("error", "Schema", crdName, "No OpenAPI schema found in CRD", "")
-		return
+func stringsOf(rule map[string]interface{}, key string) []string {
+	var out []string
+	for _, v := range kubectl.GetSlice(rule, key) {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
 	}
+	return out
+}
 
-	specProps := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(schema, "properties"), "spec"), "properties")
-	if _, ok := specProps["providerID"]; !ok {
-		report.addViolation("error", "Spec", crdName, "Missing providerID field in spec", "Contract requires spec.providerID for node correlation")
+func matches(values []string, want string) bool {
+	for _, v := range values {
+		if v == want || v == "*" {
+			return true
+		}
 	}
+	return false
+}
 
-	statusProps := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(schema, "properties"), "status"), "properties")
-	if _, ok := statusProps["ready"]; !ok {
-		report.addViolation("error", "Status", crdName, "Missing ready field in status", "")
-	}
-	if _, ok := statusProps["addresses"]; !ok {
-		report.addViolation("error", "Status", crdName, "Missing addresses field in status", "Contract requires status.addresses for node registration")
-	}
+// ruleAllows reports whether a PolicyRule grants verb on group/resource for
+// all objects; rules limited by resourceNames do not count.
+func ruleAllows(rule map[string]interface{}, group, resource, verb string) bool {
+	return len(stringsOf(rule, "resourceNames")) == 0 &&
+		matches(stringsOf(rule, "apiGroups"), group) &&
+		matches(stringsOf(rule, "resources"), resource) &&
+		matches(stringsOf(rule, "verbs"), verb)
 }
 
-func checkBootstrap(crd map[string]interface{}, report *contractReport) {
-	crdName, _ := kubectl.GetMap(crd, "metadata")["name"].(string)
-	schema := getCRDSchema(crd)
-	if schema == nil {
-		report.addViolation("error", "Schema", crdName, "No OpenAPI schema found in CRD", "")
-		return
+// managerRoles returns the ClusterRoles that can write the given resource,
+// which identifies the provider's manager role without relying on its name.
+func managerRoles(roles []map[string]interface{}, group, resource string) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, role := range roles {
+		name := kubectl.GetString(role, "metadata.name")
+		if strings.HasPrefix(name, "system:") || name == "cluster-admin" || name == "admin" || name == "edit" {
+			continue
+		}
+		for _, r := range kubectl.GetSlice(role, "rules") {
+			rule, _ := r.(map[string]interface{})
+			if !matches(stringsOf(rule, "apiGroups"), "*") && !matches(stringsOf(rule, "resources"), "*") &&
+				(ruleAllows(rule, group, resource, "patch") || ruleAllows(rule, group, resource, "update")) {
+				out = append(out, role)
+				break
+			}
+		}
 	}
+	return out
+}
 
-	statusProps := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(schema, "properties"), "status"), "properties")
-	if _, ok := statusProps["ready"]; !ok {
-		report.addViolation("error", "Status", crdName, "Missing ready field in status", "")
+// runRBACCheck verifies that each provider's manager ClusterRole grants the
+// verbs the contract relies on and flags cluster-wide wildcard secret access.
+func runRBACCheck(crds []map[string]interface{}, reports []contract.Report) []contract.Report {
+	roles, err := kubectl.RunJSON("clusterroles", "", "", false)
+	if err != nil {
+		report := contract.Report{Provider: "rbac", ProviderType: "rbac"}
+		report.AddViolation("warning", "RBAC", "", fmt.Sprintf("Could not list ClusterRoles: %v", err), "")
+		return []contract.Report{report}
 	}
-	if _, ok := statusProps["dataSecretName"]; !ok {
-		report.addViolation("error", "Status", crdName, "Missing dataSecretName field in status", "Contract requires status.dataSecretName pointing to bootstrap data Secret")
+	byName := map[string]map[string]interface{}{}
+	for _, crd := range crds {
+		byName[kubectl.GetString(crd, "metadata.name")] = crd
 	}
-}
 
-func checkControlPlane(crd map[string]interface{}, report *contractReport) {
-	crdName, _ := kubectl.GetMap(crd, "metadata")["name"].(string)
-	schema := getCRDSchema(crd)
-	if schema == nil {
-		report.addViolation("error", "Schema", crdName, "No OpenAPI schema found in CRD", "")
-		return
-	}
+	var providers []string
+	crdsOf := map[string][]string{}
+	for _, r := range reports {
+		if _, seen := crdsOf[r.Provider]; !seen {
+			providers = append(providers, r.Provider)
+		}
+		crdsOf[r.Provider] = append(crdsOf[r.Provider], r.CheckedCRDs...)
+	}
+
+	var out []contract.Report
+	for _, provider := range providers {
+		report := contract.Report{Provider: provider, ProviderType: "rbac", CheckedCRDs: crdsOf[provider]}
+		needed := append([]permission{}, corePermissions...)
+		var rules []interface{}
+		seen := map[string]bool{}
+		for _, crdName := range crdsOf[provider] {
+			crd := byName[crdName]
+			group := kubectl.GetString(crd, "spec.group")
+			plural := kubectl.GetString(crd, "spec.names.plural")
+			needed = append(needed,
+				permission{group, plural, []string{"get", "list", "watch", "patch"}},
+				permission{group, plural + "/status", []string{"patch"}})
+			for _, role := range managerRoles(roles, group, plural) {
+				if name := kubectl.GetString(role, "metadata.name"); !seen[name] {
+					seen[name] = true
+					rules = append(rules, kubectl.GetSlice(role, "rules")...)
+				}
+			}
+		}
+		if len(seen) == 0 {
+			report.AddViolation("warning", "RBAC", "", "No ClusterRole grants write access to the provider CRDs; manager role not found", "")
+			out = append(out, report)
+			continue
+		}
 
-	specProps := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(schema, "properties"), "spec"), "properties")
-	for _, f := range controlPlaneContract.RequiredSpec {
-		if _, ok := specProps[f]; !ok {
-			report.addViolation("error", "Spec", crdName, "Missing required spec field: "+f, "")
+		for _, p := range needed {
+			var missing []string
+			for _, verb := range p.verbs {
+				allowed := false
+				for _, r := range rules {
+					rule, _ := r.(map[string]interface{})
+					allowed = allowed || ruleAllows(rule, p.group, p.resource, verb) ||
+						// Status may be written with update instead of patch.
+						(verb == "patch" && ruleAllows(rule, p.group, p.resource, "update"))
+				}
+				if !allowed {
+					missing = append(missing, verb)
+				}
+			}
+			if len(missing) > 0 {
+				group := p.group
+				if group == "" {
+					group = "core"
+				}
+				report.AddViolation("error", "RBAC", "",
+					fmt.Sprintf("Manager role lacks %s on %s/%s", strings.Join(missing, ","), group, p.resource),
+					"The controller needs these verbs to fulfil the contract")
+			}
 		}
-	}
 
-	statusProps := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(schema, "properties"), "status"), "properties")
-	for _, f := range controlPlaneContract.RequiredStatus {
-		if _, ok := statusProps[f]; !ok {
-			report.addViolation("error", "Status", crdName, "Missing required status field: "+f, "")
+		for _, r := range rules {
+			rule, _ := r.(map[string]interface{})
+			if ruleAllows(rule, "", "secrets", "*") {
+				report.AddViolation("warning", "RBAC", "",
+					"Manager role grants * on secrets cluster-wide",
+					"Grant only the verbs needed, e.g. get, list, watch, create, patch")
+				break
+			}
 		}
+		out = append(out, report)
 	}
+	return out
 }
 
-func detectProviderType(crdName string) string {
-	lower := strings.ToLower(crdName)
-	switch {
-	case strings.Contains(lower, "cluster") && strings.Contains(lower, "infrastructure"):
-		return "infrastructure-cluster"
-	case strings.Contains(lower, "machine") && strings.Contains(lower, "infrastructure"):
-		return "infrastructure-machine"
-	case strings.Contains(lower, "bootstrap"):
-		return "bootstrap"
-	case strings.Contains(lower, "controlplane"):
-		return "controlplane"
-	}
-	return "unknown"
+// providerLabelPrefixes maps clusterctl provider types to the prefix of their
+// cluster.x-k8s.io/provider label value.
+var providerLabelPrefixes = map[string]string{
+	"CoreProvider":             "",
+	"InfrastructureProvider":   "infrastructure-",
+	"BootstrapProvider":        "bootstrap-",
+	"ControlPlaneProvider":     "control-plane-",
+	"IPAMProvider":             "ipam-",
+	"AddonProvider":            "addon-",
+	"RuntimeExtensionProvider": "runtime-extension-",
 }
 
-func runComplianceCheck(providerFilter, typeFilter string) []contractReport {
-	var reports []contractReport
+func providerLabel(providerType, name string) string {
+	if providerType == "CoreProvider" {
+		return "cluster-api"
+	}
+	return providerLabelPrefixes[providerType] + name
+}
 
-	apiGroups := []string{
-		"infrastructure.cluster.x-k8s.io",
-		"bootstrap.cluster.x-k8s.io",
-		"controlplane.cluster.x-k8s.io",
+// checkReleaseSeries verifies that metadata.yaml maps the installed version's
+// minor release to the expected contract.
+func checkReleaseSeries(meta map[string]interface{}, version, contractVersion, source string, report *contract.Report) {
+	m := regexp.MustCompile(`^v?(\d+)\.(\d+)`).FindStringSubmatch(version)
+	if m == nil {
+		report.AddViolation("warning", "Metadata", source, fmt.Sprintf("Cannot parse installed version %q", version), "")
+		return
+	}
+	for _, s := range kubectl.GetSlice(meta, "releaseSeries") {
+		sm, _ := s.(map[string]interface{})
+		if fmt.Sprint(sm["major"]) != m[1] || fmt.Sprint(sm["minor"]) != m[2] {
+			continue
+		}
+		if c, _ := sm["contract"].(string); c != contractVersion {
+			report.AddViolation("error", "Metadata", source,
+				fmt.Sprintf("releaseSeries v%s.%s declares contract %q, expected %s", m[1], m[2], c, contractVersion),
+				"clusterctl refuses upgrades to releases whose contract does not match the management cluster")
+		}
+		return
 	}
+	report.AddViolation("error", "Metadata", source,
+		fmt.Sprintf("No releaseSeries entry for v%s.%s (installed %s)", m[1], m[2], version),
+		"clusterctl upgrade cannot resolve the contract of a release missing from metadata.yaml")
+}
 
-	for _, group := range apiGroups {
-		crds := getCRDs(group)
-		for _, crd := range crds {
-			crdName, _ := kubectl.GetMap(crd, "metadata")["name"].(string)
-			spec := kubectl.GetMap(crd, "spec")
-			names := kubectl.GetMap(spec, "names")
-			kind, _ := names["kind"].(string)
-
-			providerName := strings.ToLower(kind)
-			for _, s := range []string{"cluster", "machine", "config", "controlplane"} {
-				providerName = strings.ReplaceAll(providerName, s, "")
+// runClusterctlCheck checks the clusterctl inventory of each installed
+// provider: the cluster.x-k8s.io/provider label on its namespace, deployments
+// and CRDs, and, given metadata.yaml, the release series of its version.
+func runClusterctlCheck(crds []map[string]interface{}, meta map[string]interface{}, contractVersion, providerFilter string) []contract.Report {
+	providers, err := kubectl.RunJSON("providers.clusterctl.cluster.x-k8s.io", "", "", true)
+	if err != nil || len(providers) == 0 {
+		report := contract.Report{Provider: "clusterctl", ProviderType: "inventory"}
+		report.AddViolation("warning", "Inventory", "", "No clusterctl Provider inventory found; providers were not installed with clusterctl", "")
+		return []contract.Report{report}
+	}
+
+	var reports []contract.Report
+	for _, p := range providers {
+		name := kubectl.GetString(p, "providerName")
+		providerType := kubectl.GetString(p, "type")
+		namespace := kubectl.GetString(p, "metadata.namespace")
+		version := kubectl.GetString(p, "version")
+		if providerFilter != "" && !strings.Contains(name, strings.ToLower(providerFilter)) {
+			continue
+		}
+		want := providerLabel(providerType, name)
+		report := contract.Report{Provider: name, ProviderType: "clusterctl " + providerType}
+
+		if ns, err := kubectl.RunJSON("namespace/"+namespace, "", "", false); err == nil && len(ns) > 0 {
+			if got := kubectl.Labels(ns[0])["cluster.x-k8s.io/provider"]; got != want {
+				report.AddViolation("error", "Labels", "namespace/"+namespace,
+					fmt.Sprintf("Namespace %s has cluster.x-k8s.io/provider=%q, expected %q", namespace, got, want),
+					"clusterctl finds provider components by this label")
 			}
-			if providerFilter != "" && !strings.Contains(providerName, strings.ToLower(providerFilter)) {
-				continue
+		}
+		deployments, _ := kubectl.RunJSON("deployments", namespace, "", false)
+		for _, d := range deployments {
+			dName := kubectl.GetString(d, "metadata.name")
+			if got := kubectl.Labels(d)["cluster.x-k8s.io/provider"]; got != want {
+				report.AddViolation("error", "Labels", "deployment/"+dName,
+					fmt.Sprintf("Deployment %s/%s has cluster.x-k8s.io/provider=%q, expected %q", namespace, dName, got, want),
+					"clusterctl upgrade and delete only touch components carrying the provider label")
 			}
-
-			crdType := detectProviderType(crdName)
-			if typeFilter != "" && !strings.Contains(crdType, typeFilter) {
+		}
+		for _, crd := range crds {
+			if kubectl.Labels(crd)["cluster.x-k8s.io/provider"] != want {
 				continue
 			}
-
-			report := contractReport{
-				Provider:     providerName,
-				ProviderType: crdType,
-				CheckedCRDs:  []string{crdName},
-			}
-
-			switch crdType {
-			case "infrastructure-cluster":
-				checkInfraCluster(crd, &report)
-			case "infrastructure-machine":
-				checkInfraMachine(crd, &report)
-			case "bootstrap":
-				checkBootstrap(crd, &report)
-			case "controlplane":
-				checkControlPlane(crd, &report)
-			}
-
-			if len(report.CheckedCRDs) > 0 {
-				reports = append(reports, report)
+			crdName := kubectl.GetString(crd, "metadata.name")
+			report.CheckedCRDs = append(report.CheckedCRDs, crdName)
+			if _, ok := kubectl.Labels(crd)["cluster.x-k8s.io/"+contractVersion]; !ok {
+				report.AddViolation("error", "Labels", crdName, "Missing contract label cluster.x-k8s.io/"+contractVersion, "")
 			}
 		}
+		if len(report.CheckedCRDs) == 0 && providerType != "CoreProvider" {
+			report.AddViolation("warning", "Labels", "", "No CRDs carry cluster.x-k8s.io/provider="+want, "")
+		}
+		if meta != nil && providerType != "CoreProvider" {
+			checkReleaseSeries(meta, version, contractVersion, "metadata.yaml", &report)
+		}
+		reports = append(reports, report)
 	}
 	return reports
 }
 
-func printContractReport(r contractReport) {
+func printContractReport(r contract.Report) {
 	status := "✓ COMPLIANT"
-	if !r.isCompliant() {
+	if !r.IsCompliant() {
 		status = "✗ NON-COMPLIANT"
 	}
 	sep := strings.Repeat("=", 60)
@@ -346,7 +658,7 @@ func printContractReport(r contractReport) {
 
 	icons := map[string]string{"error": "🔴", "warning": "⚠️", "info": "ℹ️"}
 	for _, sev := range []string{"error", "warning", "info"} {
-		var filtered []violation
+		var filtered []contract.Violation
 		for _, v := range r.Violations {
 			if v.Severity == sev {
 				filtered = append(filtered, v)
@@ -365,11 +677,11 @@ func printContractReport(r contractReport) {
 	}
 }
 
-func printContractSummary(reports []contractReport) {
+func printContractSummary(reports []contract.Report) {
 	total := len(reports)
 	compliant := 0
 	for _, r := range reports {
-		if r.isCompliant() {
+		if r.IsCompliant() {
 			compliant++
 		}
 	}
@@ -383,8 +695,8 @@ func printContractSummary(reports []contractReport) {
 	if total-compliant > 0 {
 		fmt.Println("\nNon-compliant providers:")
 		for _, r := range reports {
-			if !r.isCompliant() {
-				fmt.Printf("  - %s (%s): %d errors\n", r.Provider, r.ProviderType, r.errorCount())
+			if !r.IsCompliant() {
+				fmt.Printf("  - %s (%s): %d errors\n", r.Provider, r.ProviderType, r.ErrorCount())
 			}
 		}
 	}
@@ -395,6 +707,14 @@ func main() {
 	providerType := flag.String("t", "", "Filter by provider type: infrastructure, bootstrap, controlplane")
 	format := flag.String("format", "text", "Output format: text, json")
 	output := flag.String("o", "", "Write output to file")
+	var files fileList
+	flag.Var(&files, "f", "Read CRDs from a YAML/JSON file instead of the cluster (repeatable)")
+	contractVersion := flag.String("contract-version", "v1beta1", "Contract rule set to check against: v1beta1, v1beta2")
+	clusterctlCheck := flag.Bool("clusterctl", false, "Also check clusterctl provider labels and inventory (live cluster only)")
+	metadataFile := flag.String("metadata", "", "Provider metadata.yaml to check releaseSeries against the installed version (with --clusterctl)")
+	rbac := flag.Bool("rbac", false, "Also check the provider manager ClusterRole grants the contract's verbs (live cluster only)")
+	runtime := flag.Bool("runtime", false, "Also verify live provider objects (owner references, readiness, providerID, secrets)")
+	dir := flag.String("d", "", "Read CRDs from all YAML/JSON files in a directory (e.g. config/crd/bases)")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nVerify provider CRD compliance with CAPI contracts.\n\nFlags:\n", os.Args[0])
@@ -402,13 +722,59 @@ func main() {
 	}
 	flag.Parse()
 
-	if kubectl.Find() == "" {
-		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+	rules, ok := contract.Contracts[*contractVersion]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown --contract-version %q (expected v1beta1 or v1beta2)\n", *contractVersion)
 		os.Exit(1)
 	}
 
-	fmt.Println("Checking provider contract compliance...")
-	reports := runComplianceCheck(*provider, *providerType)
+	offline := len(files) > 0 || *dir != ""
+	if offline && (*runtime || *clusterctlCheck || *rbac) {
+		fmt.Fprintln(os.Stderr, "Error: --runtime, --clusterctl and --rbac need a cluster and cannot be combined with -f or -d")
+		os.Exit(1)
+	}
+	var meta map[string]interface{}
+	if *metadataFile != "" {
+		data, err := os.ReadFile(*metadataFile)
+		if err == nil {
+			err = yaml.Unmarshal(data, &meta)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", *metadataFile, err)
+			os.Exit(1)
+		}
+	}
+
+	var crds []map[string]interface{}
+	if offline {
+		var err error
+		crds, err = loadCRDFiles(files, *dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		if kubectl.Find() == "" {
+			fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH (use -f or -d to check CRD files offline)")
+			os.Exit(1)
+		}
+		crds = getCRDs()
+	}
+
+	fmt.Printf("Checking provider contract compliance (%s)...\n", rules.Version)
+	reports := contract.CheckCRDsAgainst(rules, crds, *provider, *providerType)
+	if !offline {
+		checkConversionServices(crds, reports)
+	}
+	if *rbac {
+		reports = append(reports, runRBACCheck(crds, reports)...)
+	}
+	if *clusterctlCheck {
+		reports = append(reports, runClusterctlCheck(crds, meta, rules.Version, *provider)...)
+	}
+	if *runtime {
+		reports = append(reports, runRuntimeCheck(crds, rules.Version, *provider, *providerType)...)
+	}
 
 	if len(reports) == 0 {
 		fmt.Println("No provider CRDs found to check")
@@ -417,17 +783,17 @@ func main() {
 
 	if *format == "json" || *output != "" {
 		type jsonReport struct {
-			Provider   string      `json:"provider"`
-			Type       string      `json:"type"`
-			Compliant  bool        `json:"compliant"`
-			CRDs       []string    `json:"crds"`
-			Violations []violation `json:"violations"`
+			Provider   string               `json:"provider"`
+			Type       string               `json:"type"`
+			Compliant  bool                 `json:"compliant"`
+			CRDs       []string             `json:"crds"`
+			Violations []contract.Violation `json:"violations"`
 		}
 		var out []jsonReport
 		for _, r := range reports {
-			jr := jsonReport{r.Provider, r.ProviderType, r.isCompliant(), r.CheckedCRDs, r.Violations}
+			jr := jsonReport{r.Provider, r.ProviderType, r.IsCompliant(), r.CheckedCRDs, r.Violations}
 			if jr.Violations == nil {
-				jr.Violations = []violation{}
+				jr.Violations = []contract.Violation{}
 			}
 			out = append(out, jr)
 		}
@@ -449,7 +815,7 @@ func main() {
 	}
 
 	for _, r := range reports {
-		if !r.isCompliant() {
+		if !r.IsCompliant() {
 			os.Exit(1)
 		}
 	}
@@ -4,21 +4,39 @@
 //
 //	go run ./compare-versions <from> <to> [flags]
 //	go run ./compare-versions --list
+//	go run ./compare-versions --refresh
 //
 // Examples:
 //
 //	go run ./compare-versions v1.6.0 v1.12.0
 //	go run ./compare-versions v1.6.0 v1.12.0 --checklist
+//	go run ./compare-versions --refresh --list
+//	go run ./compare-versions --checklist --format yaml v1.10.0 v1.12.0
+//	go run ./compare-versions --state upgrade.yaml --done pre-backup v1.10.0 v1.12.0
+//	go run ./compare-versions --workload-k8s prod=v1.27.3 v1.6.0 v1.12.0
+//	go run ./compare-versions --live v1.10.0 v1.12.0
+//	go run ./compare-versions --kind Cluster,Machine v1.10.0 v1.12.0
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"k8s-cluster-api-tools/internal/kubectl"
 )
 
 type versionInfo struct {
@@ -29,14 +47,22 @@ type versionInfo struct {
 	Features    []string
 	Deprecations []string
 	Breaking    []string
+	ReleaseNotes string `json:",omitempty"`
 }
 
+// stringList collects repeated string flags.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
 type apiChange struct {
 	Type        string `json:"type"`
 	Kind        string `json:"kind"`
 	Old         string `json:"old"`
 	New         string `json:"new"`
 	Description string `json:"description"`
+	Since       string `json:"since"`
 }
 
 type comparison struct {
@@ -83,12 +109,210 @@ var versionDB = map[string]versionInfo{
 }
 
 var apiChangesDB = []apiChange{
-	{Type: "field_rename", Kind: "Cluster", Old: "spec.infrastructureRef", New: "spec.infrastructureRef (TypedObjectReference)", Description: "InfrastructureRef now uses TypedObjectReference type"},
-	{Type: "field_rename", Kind: "Cluster", Old: "spec.controlPlaneRef", New: "spec.controlPlaneRef (TypedObjectReference)", Description: "ControlPlaneRef now uses TypedObjectReference type"},
-	{Type: "field_change", Kind: "Machine", Old: "status.phase", New: "status.conditions", Description: "Phase deprecated; use conditions for state"},
-	{Type: "field_add", Kind: "Cluster", Old: "", New: "status.v1beta2.conditions", Description: "New v1beta2 conditions location"},
-	{Type: "field_add", Kind: "MachineDeployment", Old: "", New: "spec.strategy.rollingUpdate.deletePolicy", Description: "New delete policy for rollouts"},
-	{Type: "behavior_change", Kind: "All", Old: "Integer durations (seconds)", New: "String durations (e.g., '10m')", Description: "Duration fields now use string format"},
+	{Type: "field_rename", Kind: "Cluster", Old: "spec.infrastructureRef", New: "spec.infrastructureRef (TypedObjectReference)", Description: "InfrastructureRef now uses TypedObjectReference type", Since: "v1.11.0"},
+	{Type: "field_rename", Kind: "Cluster", Old: "spec.controlPlaneRef", New: "spec.controlPlaneRef (TypedObjectReference)", Description: "ControlPlaneRef now uses TypedObjectReference type", Since: "v1.11.0"},
+	{Type: "field_change", Kind: "Machine", Old: "status.phase", New: "status.conditions", Description: "Phase deprecated; use conditions for state", Since: "v1.11.0"},
+	{Type: "field_add", Kind: "Cluster", Old: "", New: "status.v1beta2.conditions", Description: "New v1beta2 conditions location", Since: "v1.8.0"},
+	{Type: "field_add", Kind: "MachineDeployment", Old: "", New: "spec.strategy.rollingUpdate.deletePolicy", Description: "New delete policy for rollouts", Since: "v1.11.0"},
+	{Type: "behavior_change", Kind: "All", Old: "Integer durations (seconds)", New: "String durations (e.g., '10m')", Description: "Duration fields now use string format", Since: "v1.11.0"},
+}
+
+const releasesAPI = "https://api.github.com/repos/kubernetes-sigs/cluster-api/releases"
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// defaultCachePath is where --refresh stores fetched release metadata.
+func defaultCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "k8s-cluster-api-tools", "capi-versions.json")
+}
+
+// githubGet fetches url, authenticating with GITHUB_TOKEN when set to avoid
+// the anonymous API rate limit.
+func githubGet(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+var (
+	minorReleaseTag = regexp.MustCompile(`^v\d+\.\d+\.0$`)
+	goDirective     = regexp.MustCompile(`(?m)^go (\d+\.\d+)`)
+	k8sAPIModule    = regexp.MustCompile(`(?m)^\s*k8s\.io/api v0\.(\d+)\.`)
+	k8sVersion      = regexp.MustCompile(`^v?\d+\.\d+(\.\d+)?$`)
+)
+
+// noteSections extracts bullet points under release-note headings whose
+// title contains one of the keywords, at most limit per section kind.
+func noteSections(body string, keywords []string, limit int) []string {
+	var out []string
+	in := false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			lower := strings.ToLower(line)
+			in = false
+			for _, k := range keywords {
+				in = in || strings.Contains(lower, k)
+			}
+			continue
+		}
+		if in && (strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ")) && len(out) < limit {
+			item := strings.TrimSpace(line[2:])
+			// Drop trailing PR references such as "(#12345)".
+			if i := strings.LastIndex(item, " (#"); i > 0 {
+				item = item[:i]
+			}
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// fetchReleases pulls the minor releases of Cluster API from GitHub, with
+// the Go and Kubernetes versions read from go.mod at each tag.
+func fetchReleases() (map[string]versionInfo, error) {
+	type release struct {
+		TagName     string `json:"tag_name"`
+		Body        string `json:"body"`
+		HTMLURL     string `json:"html_url"`
+		PublishedAt string `json:"published_at"`
+		Draft       bool   `json:"draft"`
+		Prerelease  bool   `json:"prerelease"`
+	}
+	var releases []release
+	for page := 1; page <= 5; page++ {
+		data, err := githubGet(fmt.Sprintf("%s?per_page=100&page=%d", releasesAPI, page))
+		if err != nil {
+			return nil, err
+		}
+		var batch []release
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, fmt.Errorf("parse releases: %w", err)
+		}
+		releases = append(releases, batch...)
+		if len(batch) < 100 {
+			break
+		}
+	}
+
+	out := map[string]versionInfo{}
+	for _, r := range releases {
+		if r.Draft || r.Prerelease || !minorReleaseTag.MatchString(r.TagName) {
+			continue
+		}
+		info := versionInfo{
+			ReleaseNotes: r.HTMLURL,
+			Features:     noteSections(r.Body, []string{"feature"}, 10),
+			Deprecations: noteSections(r.Body, []string{"deprecat"}, 10),
+			Breaking:     noteSections(r.Body, []string{"breaking"}, 10),
+		}
+		if len(r.PublishedAt) >= 10 {
+			info.ReleaseDate = r.PublishedAt[:10]
+		}
+		gomod, err := githubGet("https://raw.githubusercontent.com/kubernetes-sigs/cluster-api/" + r.TagName + "/go.mod")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", r.TagName, err)
+		}
+		if m := goDirective.FindSubmatch(gomod); m != nil {
+			info.GoVersion = string(m[1])
+		}
+		if m := k8sAPIModule.FindSubmatch(gomod); m != nil {
+			info.Kubernetes.Max = "v1." + string(m[1]) + ".x"
+		}
+		out[r.TagName] = info
+	}
+	return out, nil
+}
+
+// estimateRanges fills what GitHub does not publish: the minimum Kubernetes
+// version and API version are carried over from the closest earlier release,
+// shifting the minimum by as many minors as the maximum moved.
+func estimateRanges(fetched map[string]versionInfo) {
+	all := map[string]versionInfo{}
+	for v, info := range fetched {
+		all[v] = info
+	}
+	for v, info := range versionDB {
+		all[v] = info
+	}
+	keys := make([]string, 0, len(all))
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return versionLess(keys[i], keys[j]) })
+	for i, v := range keys {
+		info, ok := fetched[v]
+		if !ok || i == 0 {
+			continue
+		}
+		prev := all[keys[i-1]]
+		if info.APIVersion == "" {
+			info.APIVersion = prev.APIVersion
+		}
+		if info.Kubernetes.Min == "" && prev.Kubernetes.Min != "" {
+			shift := parseVersion(info.Kubernetes.Max)[1] - parseVersion(prev.Kubernetes.Max)[1]
+			if info.Kubernetes.Max == "" || shift < 0 {
+				shift = 0
+			}
+			pm := parseVersion(prev.Kubernetes.Min)
+			info.Kubernetes.Min = fmt.Sprintf("v%d.%d.0", pm[0], pm[1]+shift)
+		}
+		fetched[v] = info
+		all[v] = info
+	}
+}
+
+// refreshVersions fetches release metadata and writes it to the cache.
+func refreshVersions(path string) (int, error) {
+	fetched, err := fetchReleases()
+	if err != nil {
+		return 0, err
+	}
+	estimateRanges(fetched)
+	data, _ := json.MarshalIndent(fetched, "", "  ")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	return len(fetched), os.WriteFile(path, data, 0o644)
+}
+
+// loadCachedVersions adds cached releases missing from the embedded
+// versionDB; curated embedded entries take precedence.
+func loadCachedVersions(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var cached map[string]versionInfo
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for v, info := range cached {
+		if _, ok := versionDB[v]; !ok {
+			versionDB[v] = info
+		}
+	}
+	return nil
 }
 
 func parseVersion(v string) [3]int {
@@ -133,7 +357,7 @@ func getVersionsBetween(from, to string) []string {
 	return result
 }
 
-func compare(from, to string) comparison {
+func compare(from, to string, kinds []string) comparison {
 	c := comparison{
 		From:            from,
 		To:              to,
@@ -159,10 +383,33 @@ func compare(from, to string) comparison {
 		c.GoChange["from"] = fromInfo.GoVersion
 		c.GoChange["to"] = toInfo.GoVersion
 	}
-	c.APIChanges = apiChangesDB
+	c.APIChanges = apiChangesBetween(from, to, kinds)
 	return c
 }
 
+// apiChangesBetween returns the API changes introduced after from and up to
+// and including to, limited to kinds when given. Changes to "All" kinds
+// always match the kind filter.
+func apiChangesBetween(from, to string, kinds []string) []apiChange {
+	var out []apiChange
+	for _, ch := range apiChangesDB {
+		if !versionLess(from, ch.Since) || versionLess(to, ch.Since) {
+			continue
+		}
+		if len(kinds) > 0 && ch.Kind != "All" {
+			match := false
+			for _, k := range kinds {
+				match = match || strings.EqualFold(k, ch.Kind)
+			}
+			if !match {
+				continue
+			}
+		}
+		out = append(out, ch)
+	}
+	return out
+}
+
 func printComparison(c comparison) {
 	sep := strings.Repeat("=", 60)
 	fmt.Printf("\n%s\n", sep)
@@ -184,6 +431,17 @@ func printComparison(c comparison) {
 		fmt.Printf("   %s → %s\n", c.GoChange["from"], c.GoChange["to"])
 	}
 
+	var notes []string
+	for _, v := range c.VersionsBetween {
+		if url := versionDB[v].ReleaseNotes; url != "" {
+			notes = append(notes, fmt.Sprintf("   %s: %s", v, url))
+		}
+	}
+	if len(notes) > 0 {
+		fmt.Println("\n📄 Release Notes:")
+		fmt.Println(strings.Join(notes, "\n"))
+	}
+
 	if len(c.BreakingChanges) > 0 {
 		fmt.Println("\n🔴 Breaking Changes:")
 		for _, ch := range c.BreakingChanges {
@@ -206,7 +464,7 @@ func printComparison(c comparison) {
 	}
 
 	if len(c.APIChanges) > 0 {
-		fmt.Println("\n📝 API Changes (v1beta1 → v1beta2):")
+		fmt.Println("\n📝 API Changes:")
 		icons := map[string]string{
 			"field_rename":    "↔️",
 			"field_change":    "🔄",
@@ -219,7 +477,7 @@ func printComparison(c comparison) {
 			if icon == "" {
 				icon = "·"
 			}
-			fmt.Printf("\n   %s [%s] %s\n", icon, ch.Kind, ch.Description)
+			fmt.Printf("\n   %s [%s] %s (%s)\n", icon, ch.Kind, ch.Description, ch.Since)
 			if ch.Old != "" {
 				fmt.Printf("      Old: %s\n", ch.Old)
 			}
@@ -230,41 +488,246 @@ func printComparison(c comparison) {
 	}
 }
 
-func printChecklist(c comparison) {
+// checklistStep is one migration step. IDs are stable across runs: fixed
+// steps have fixed IDs and derived steps hash their text, so a --state file
+// keeps matching as long as the step itself is unchanged.
+type checklistStep struct {
+	ID    string `json:"id" yaml:"id"`
+	Phase string `json:"phase" yaml:"phase"`
+	Title string `json:"title" yaml:"title"`
+	Done  bool   `json:"done" yaml:"done"`
+}
+
+// checklistState records completed step IDs between runs.
+type checklistState struct {
+	Completed []string `json:"completed" yaml:"completed"`
+}
+
+func stepID(prefix, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return prefix + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+func buildChecklist(c comparison, done map[string]bool) []checklistStep {
+	var steps []checklistStep
+	add := func(id, phase, title string) {
+		steps = append(steps, checklistStep{ID: id, Phase: phase, Title: title, Done: done[id]})
+	}
+	if toMin, ok := c.KubernetesChange["to_min"]; ok {
+		add("pre-kubernetes-version", "pre-migration", fmt.Sprintf("Verify Kubernetes version meets %s+ requirement", toMin))
+	}
+	if c.GoChange["from"] != c.GoChange["to"] {
+		add("pre-go-version", "pre-migration", fmt.Sprintf("Update Go to %s", c.GoChange["to"]))
+	}
+	add("pre-backup", "pre-migration", "Backup cluster state (clusterctl move or export)")
+	add("pre-release-notes", "pre-migration", "Review release notes for all versions in range")
+	for _, ch := range c.BreakingChanges {
+		add(stepID("breaking", ch), "breaking-changes", ch)
+	}
+	for _, d := range c.Deprecations {
+		add(stepID("deprecation", d), "deprecations", d)
+	}
+	for _, ch := range c.APIChanges {
+		add(stepID("api", ch.Kind+" "+ch.Old+" "+ch.New), "api-changes", fmt.Sprintf("[%s] %s", ch.Kind, ch.Description))
+	}
+	add("post-upgrade-plan", "post-migration", "Run clusterctl upgrade plan")
+	add("post-clusters-ready", "post-migration", "Verify all clusters Ready")
+	add("post-conditions", "post-migration", "Check conditions for any warnings")
+	add("post-providers", "post-migration", "Update provider versions if needed")
+	return steps
+}
+
+func loadState(path string) (checklistState, error) {
+	var state checklistState
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("%s: %w", path, err)
+	}
+	return state, nil
+}
+
+func saveState(path string, state checklistState) error {
+	sort.Strings(state.Completed)
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+var phaseTitles = []struct{ phase, title string }{
+	{"pre-migration", "Pre-migration"},
+	{"breaking-changes", "Breaking changes to address"},
+	{"deprecations", "Deprecated features to migrate"},
+	{"api-changes", "API changes to adopt"},
+	{"post-migration", "Post-migration"},
+}
+
+func printChecklist(steps []checklistStep) {
 	sep := strings.Repeat("=", 60)
 	fmt.Printf("\n%s\n", sep)
 	fmt.Println("MIGRATION CHECKLIST")
 	fmt.Println(sep)
 
-	fmt.Println("\n□ Pre-migration:")
-	if toMin, ok := c.KubernetesChange["to_min"]; ok {
-		fmt.Printf("   □ Verify Kubernetes version meets %s+ requirement\n", toMin)
+	remaining := 0
+	for _, p := range phaseTitles {
+		header := false
+		for _, st := range steps {
+			if st.Phase != p.phase {
+				continue
+			}
+			if !header {
+				fmt.Printf("\n□ %s:\n", p.title)
+				header = true
+			}
+			box := "□"
+			if st.Done {
+				box = "☑"
+			} else {
+				remaining++
+			}
+			fmt.Printf("   %s %s  (%s)\n", box, st.Title, st.ID)
+		}
 	}
-	if c.GoChange["from"] != c.GoChange["to"] {
-		fmt.Printf("   □ Update Go to %s\n", c.GoChange["to"])
+	fmt.Printf("\nRemaining: %d of %d steps\n", remaining, len(steps))
+}
+
+// maxCAPIMinorJump is how many Cluster API minor releases a single upgrade
+// may skip; larger jumps go through intermediate releases.
+const maxCAPIMinorJump = 3
+
+// workloadVersion is the Kubernetes version of one workload cluster.
+type workloadVersion struct {
+	Cluster string `json:"cluster"`
+	Version string `json:"version"`
+}
+
+// skewResult is the verdict for one workload cluster against the upgrade path.
+type skewResult struct {
+	Cluster  string `json:"cluster"`
+	Version  string `json:"version"`
+	Status   string `json:"status"` // ok, upgrade-first, unsupported, invalid
+	BlockAt  string `json:"block_at,omitempty"`
+	Required string `json:"required,omitempty"`
+	Detail   string `json:"detail"`
+}
+
+// upgradePath returns the CAPI releases to upgrade through from from to to,
+// each step at most maxCAPIMinorJump minors ahead of the previous one.
+func upgradePath(from, to string) []string {
+	var path []string
+	current := from
+	between := getVersionsBetween(from, to)
+	for i := 0; i < len(between); {
+		next := -1
+		for j := i; j < len(between); j++ {
+			if parseVersion(between[j])[1]-parseVersion(current)[1] <= maxCAPIMinorJump {
+				next = j
+			}
+		}
+		if next < 0 {
+			next = i
+		}
+		current = between[next]
+		path = append(path, current)
+		i = next + 1
 	}
-	fmt.Println("   □ Backup cluster state (clusterctl move or export)")
-	fmt.Println("   □ Review release notes for all versions in range")
+	return path
+}
 
-	if len(c.BreakingChanges) > 0 {
-		fmt.Println("\n□ Breaking changes to address:")
-		for i, ch := range c.BreakingChanges {
-			fmt.Printf("   □ %d. %s\n", i+1, ch)
+// checkSkew verifies each workload cluster's Kubernetes version against the
+// supported range of every CAPI release on the upgrade path.
+func checkSkew(workloads []workloadVersion, path []string) []skewResult {
+	var results []skewResult
+	for _, w := range workloads {
+		r := skewResult{Cluster: w.Cluster, Version: w.Version, Status: "ok"}
+		if !k8sVersion.MatchString(w.Version) {
+			r.Status = "invalid"
+			r.Detail = fmt.Sprintf("Cannot parse Kubernetes version %q (expected vMAJOR.MINOR[.PATCH])", w.Version)
+			results = append(results, r)
+			continue
 		}
+		v := parseVersion(w.Version)
+		for _, step := range path {
+			info, ok := versionDB[step]
+			if !ok || info.Kubernetes.Min == "" {
+				continue
+			}
+			minV, maxV := parseVersion(info.Kubernetes.Min), parseVersion(info.Kubernetes.Max)
+			switch {
+			case v[0] == minV[0] && v[1] < minV[1]:
+				r.Status, r.BlockAt, r.Required = "upgrade-first", step, info.Kubernetes.Min
+				r.Detail = fmt.Sprintf("Upgrade Kubernetes %s → %s (%d minor upgrade(s), one minor at a time) before upgrading CAPI to %s",
+					w.Version, info.Kubernetes.Min, minV[1]-v[1], step)
+			case info.Kubernetes.Max != "" && v[0] == maxV[0] && v[1] > maxV[1]:
+				r.Status, r.BlockAt = "unsupported", step
+				r.Detail = fmt.Sprintf("Kubernetes %s is newer than %s supported by CAPI %s", w.Version, info.Kubernetes.Max, step)
+			}
+			if r.Status != "ok" {
+				break
+			}
+		}
+		if r.Status == "ok" {
+			r.Detail = "Within the supported range at every upgrade step"
+		}
+		results = append(results, r)
 	}
+	return results
+}
 
-	if len(c.Deprecations) > 0 {
-		fmt.Println("\n□ Deprecated features to migrate:")
-		for i, d := range c.Deprecations {
-			fmt.Printf("   □ %d. %s\n", i+1, d)
+// discoverWorkloads reads the Kubernetes version of every workload cluster
+// from the management cluster: the topology version, or the control plane's.
+func discoverWorkloads() ([]workloadVersion, error) {
+	clusters, err := kubectl.RunJSON("clusters.cluster.x-k8s.io", "", "", true)
+	if err != nil {
+		return nil, err
+	}
+	var out []workloadVersion
+	for _, c := range clusters {
+		name := kubectl.GetString(c, "metadata.namespace") + "/" + kubectl.GetString(c, "metadata.name")
+		version := kubectl.GetString(c, "spec.topology.version")
+		if version == "" {
+			ref := kubectl.GetMap(kubectl.GetMap(c, "spec"), "controlPlaneRef")
+			kind, _ := ref["kind"].(string)
+			cpName, _ := ref["name"].(string)
+			apiVersion, _ := ref["apiVersion"].(string)
+			resource := strings.ToLower(kind)
+			if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+				resource += "." + apiVersion[:i]
+			}
+			if kind != "" && cpName != "" {
+				cps, _ := kubectl.RunJSON(resource+"/"+cpName, kubectl.GetString(c, "metadata.namespace"), "", false)
+				if len(cps) > 0 {
+					version = kubectl.GetString(cps[0], "status.version")
+					if version == "" {
+						version = kubectl.GetString(cps[0], "spec.version")
+					}
+				}
+			}
+		}
+		if version != "" {
+			out = append(out, workloadVersion{Cluster: name, Version: version})
 		}
 	}
+	return out, nil
+}
 
-	fmt.Println("\n□ Post-migration:")
-	fmt.Println("   □ Run clusterctl upgrade plan")
-	fmt.Println("   □ Verify all clusters Ready")
-	fmt.Println("   □ Check conditions for any warnings")
-	fmt.Println("   □ Update provider versions if needed")
+func printSkew(path []string, results []skewResult) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\n", sep)
+	fmt.Println("WORKLOAD KUBERNETES VERSION SKEW")
+	fmt.Println(sep)
+	fmt.Printf("\nCAPI upgrade path (max %d minors per step): %s\n", maxCAPIMinorJump, strings.Join(path, " → "))
+	icons := map[string]string{"ok": "✅", "upgrade-first": "🔴", "unsupported": "⚠️ ", "invalid": "❌"}
+	for _, r := range results {
+		fmt.Printf("\n   %s %s (%s)\n      %s\n", icons[r.Status], r.Cluster, r.Version, r.Detail)
+	}
 }
 
 func listVersions() {
@@ -281,8 +744,16 @@ func listVersions() {
 func main() {
 	listFlag := flag.Bool("list", false, "List all known versions")
 	checklist := flag.Bool("checklist", false, "Include migration checklist")
-	format := flag.String("format", "text", "Output format: text, json")
+	format := flag.String("format", "text", "Output format: text, json, yaml")
 	output := flag.String("o", "", "Write output to file")
+	var workloadK8s stringList
+	flag.Var(&workloadK8s, "workload-k8s", "Workload cluster Kubernetes version to check for skew, as [name=]version (repeatable)")
+	live := flag.Bool("live", false, "Discover workload cluster Kubernetes versions from the management cluster")
+	statePath := flag.String("state", "", "Checklist state file (YAML) recording completed step IDs")
+	doneIDs := flag.String("done", "", "Mark checklist step IDs as completed in --state (comma-separated)")
+	kindFilter := flag.String("kind", "", "Only show API changes for these kinds (comma-separated, e.g. Cluster,Machine)")
+	refresh := flag.Bool("refresh", false, "Fetch release metadata from GitHub into the local cache (uses GITHUB_TOKEN if set)")
+	cacheFile := flag.String("cache", defaultCachePath(), "Release metadata cache written by --refresh")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s <from-version> <to-version> [flags]\n\nCompare CAPI version specifications.\n\nFlags:\n", os.Args[0])
@@ -290,6 +761,21 @@ func main() {
 	}
 	flag.Parse()
 
+	if *refresh {
+		n, err := refreshVersions(*cacheFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error refreshing release metadata: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Cached %d releases in %s\n", n, *cacheFile)
+		if !*listFlag && flag.NArg() == 0 {
+			os.Exit(0)
+		}
+	}
+	if err := loadCachedVersions(*cacheFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring release cache: %v\n", err)
+	}
+
 	if *listFlag {
 		listVersions()
 		os.Exit(0)
@@ -317,9 +803,81 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Warning: Version %s not in database\n", toV)
 	}
 
-	comp := compare(fromV, toV)
+	var kinds []string
+	for _, k := range strings.Split(*kindFilter, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			kinds = append(kinds, k)
+		}
+	}
+	comp := compare(fromV, toV, kinds)
+
+	var path []string
+	var skew []skewResult
+	if len(workloadK8s) > 0 || *live {
+		var workloads []workloadVersion
+		for i, w := range workloadK8s {
+			name, version, ok := strings.Cut(w, "=")
+			if !ok {
+				name, version = fmt.Sprintf("workload-%d", i+1), w
+			}
+			workloads = append(workloads, workloadVersion{Cluster: name, Version: version})
+		}
+		if *live {
+			discovered, err := discoverWorkloads()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error discovering workload clusters: %v\n", err)
+				os.Exit(1)
+			}
+			workloads = append(workloads, discovered...)
+		}
+		path = upgradePath(fromV, toV)
+		skew = checkSkew(workloads, path)
+	}
+
+	var steps []checklistStep
+	if *checklist || *statePath != "" {
+		var state checklistState
+		if *statePath != "" {
+			var err error
+			if state, err = loadState(*statePath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		done := map[string]bool{}
+		for _, id := range state.Completed {
+			done[id] = true
+		}
+		steps = buildChecklist(comp, done)
+		if *doneIDs != "" {
+			if *statePath == "" {
+				fmt.Fprintln(os.Stderr, "Error: --done requires --state")
+				os.Exit(1)
+			}
+			known := map[string]bool{}
+			for _, st := range steps {
+				known[st.ID] = true
+			}
+			for _, id := range strings.Split(*doneIDs, ",") {
+				id = strings.TrimSpace(id)
+				if !known[id] {
+					fmt.Fprintf(os.Stderr, "Error: unknown checklist step %q\n", id)
+					os.Exit(1)
+				}
+				if !done[id] {
+					done[id] = true
+					state.Completed = append(state.Completed, id)
+				}
+			}
+			if err := saveState(*statePath, state); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			steps = buildChecklist(comp, done)
+		}
+	}
 
-	if *format == "json" || *output != "" {
+	if *format == "json" || *format == "yaml" || *output != "" {
 		data := map[string]interface{}{
 			"from_version":     comp.From,
 			"to_version":       comp.To,
@@ -331,7 +889,19 @@ func main() {
 			"new_features":     comp.NewFeatures,
 			"api_changes":      comp.APIChanges,
 		}
-		out, _ := json.MarshalIndent(data, "", "  ")
+		if steps != nil {
+			data["checklist"] = steps
+		}
+		if skew != nil {
+			data["upgrade_path"] = path
+			data["workload_skew"] = skew
+		}
+		var out []byte
+		if *format == "yaml" {
+			out, _ = yaml.Marshal(data)
+		} else {
+			out, _ = json.MarshalIndent(data, "", "  ")
+		}
 		if *output != "" {
 			if err := os.WriteFile(*output, out, 0o644); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -343,8 +913,17 @@ func main() {
 		}
 	} else {
 		printComparison(comp)
-		if *checklist {
-			printChecklist(comp)
+		if skew != nil {
+			printSkew(path, skew)
+		}
+		if steps != nil {
+			printChecklist(steps)
+		}
+	}
+
+	for _, r := range skew {
+		if r.Status != "ok" {
+			os.Exit(1)
 		}
 	}
 }
@@ -0,0 +1,695 @@
+// diff-template compares two CAPI manifest sets semantically.
+//
+// Objects are matched by API group, kind, namespace and name, so apiVersion
+// bumps show up as changes rather than remove/add pairs. Server-populated
+// fields are dropped, well-known defaults are filled in on both sides and
+// lists of named items are matched by name, leaving only meaningful changes:
+// version bumps, replica changes, machine template changes and so on.
+// Replaced machine/bootstrap templates are paired through their references
+// and diffed against each other.
+//
+// Usage:
+//
+//	go run ./diff-template [flags] <old> <new>
+//
+// Examples:
+//
+//	go run ./diff-template cluster-v1.yaml cluster-v2.yaml
+//	go run ./diff-template -r ./templates/release-1.7 ./templates/release-1.8
+//	go run ./diff-template --format json old/ new/
+//	go run ./diff-template --exit-code old.yaml new.yaml
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Change categories, in report order.
+const (
+	catVersion  = "version"
+	catReplicas = "replicas"
+	catTemplate = "machine-template"
+	catImage    = "image"
+	catNetwork  = "network"
+	catOther    = "other"
+)
+
+var categoryOrder = []string{catVersion, catReplicas, catTemplate, catImage, catNetwork, catOther}
+
+// ignoredPaths are server-populated or otherwise irrelevant for review.
+var ignoredPaths = []string{
+	"status",
+	"metadata.uid",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.creationTimestamp",
+	"metadata.managedFields",
+	"metadata.selfLink",
+	"metadata.ownerReferences",
+	"metadata.finalizers",
+	"metadata.annotations.kubectl.kubernetes.io/last-applied-configuration",
+}
+
+type fieldDefault struct {
+	kind  string
+	path  string
+	value interface{}
+}
+
+// defaults mirrors the CAPI webhook defaults, so omitting a field and setting
+// it to its default value compare equal.
+var defaults = []fieldDefault{
+	{"", "metadata.namespace", "default"},
+	{"Cluster", "spec.clusterNetwork.serviceDomain", "cluster.local"},
+	{"MachineDeployment", "spec.replicas", 1},
+	{"MachineDeployment", "spec.minReadySeconds", 0},
+	{"MachineDeployment", "spec.revisionHistoryLimit", 1},
+	{"MachineDeployment", "spec.strategy.type", "RollingUpdate"},
+	{"MachineDeployment", "spec.strategy.rollingUpdate.maxSurge", 1},
+	{"MachineDeployment", "spec.strategy.rollingUpdate.maxUnavailable", 0},
+	{"MachineDeployment", "spec.strategy.remediation.maxInFlight", "100%"},
+	{"MachineSet", "spec.replicas", 1},
+	{"MachineSet", "spec.deletePolicy", "Random"},
+	{"KubeadmControlPlane", "spec.replicas", 1},
+	{"KubeadmControlPlane", "spec.rolloutStrategy.type", "RollingUpdate"},
+	{"KubeadmControlPlane", "spec.rolloutStrategy.rollingUpdate.maxSurge", 1},
+	{"MachineHealthCheck", "spec.maxUnhealthy", "100%"},
+	{"MachineHealthCheck", "spec.nodeStartupTimeout", "10m0s"},
+}
+
+// rolloutTriggers are path prefixes whose change rolls machines.
+var rolloutTriggers = map[string][]string{
+	"MachineDeployment":   {"spec.template"},
+	"MachineSet":          {"spec.template"},
+	"KubeadmControlPlane": {"spec.version", "spec.kubeadmConfigSpec", "spec.machineTemplate"},
+	"Cluster":             {"spec.topology.version", "spec.topology.class", "spec.topology.variables"},
+}
+
+type object struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	Doc        map[string]interface{}
+}
+
+func (o object) group() string {
+	if i := strings.LastIndex(o.APIVersion, "/"); i >= 0 {
+		return o.APIVersion[:i]
+	}
+	return ""
+}
+
+func (o object) key() string {
+	return o.group() + "/" + o.Kind + "/" + o.Namespace + "/" + o.Name
+}
+
+type change struct {
+	Path     string      `json:"path"`
+	Category string      `json:"category"`
+	Old      interface{} `json:"old,omitempty"`
+	New      interface{} `json:"new,omitempty"`
+}
+
+type objectDiff struct {
+	Kind           string   `json:"kind"`
+	Namespace      string   `json:"namespace"`
+	Name           string   `json:"name"`
+	Status         string   `json:"status"` // added, removed, changed, replaced
+	ReplacedBy     string   `json:"replaced_by,omitempty"`
+	TriggerRollout bool     `json:"triggers_rollout,omitempty"`
+	Changes        []change `json:"changes,omitempty"`
+}
+
+type report struct {
+	Old        string         `json:"old"`
+	New        string         `json:"new"`
+	Objects    []objectDiff   `json:"objects"`
+	Categories map[string]int `json:"categories"`
+	Unchanged  int            `json:"unchanged"`
+}
+
+func findYAMLFiles(root string, recursive bool) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+	var files []string
+	if recursive {
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			ext := filepath.Ext(path)
+			if ext == ".yaml" || ext == ".yml" {
+				files = append(files, path)
+			}
+			return nil
+		})
+	} else {
+		for _, ext := range []string{"*.yaml", "*.yml"} {
+			matches, _ := filepath.Glob(filepath.Join(root, ext))
+			files = append(files, matches...)
+		}
+	}
+	sort.Strings(files)
+	return files, err
+}
+
+func loadObjects(root string, recursive bool) (map[string]object, error) {
+	files, err := findYAMLFiles(root, recursive)
+	if err != nil {
+		return nil, err
+	}
+	objects := map[string]object{}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		for {
+			var doc map[string]interface{}
+			if err := decoder.Decode(&doc); err != nil {
+				if err.Error() != "EOF" {
+					return nil, fmt.Errorf("%s: %w", path, err)
+				}
+				break
+			}
+			if doc == nil {
+				continue
+			}
+			if kind, _ := doc["kind"].(string); strings.HasSuffix(kind, "List") {
+				for _, item := range asSlice(doc["items"]) {
+					if m, ok := item.(map[string]interface{}); ok {
+						addObject(objects, m)
+					}
+				}
+				continue
+			}
+			addObject(objects, doc)
+		}
+	}
+	return objects, nil
+}
+
+func addObject(objects map[string]object, doc map[string]interface{}) {
+	normalize(doc)
+	meta, _ := doc["metadata"].(map[string]interface{})
+	o := object{Doc: doc}
+	o.APIVersion, _ = doc["apiVersion"].(string)
+	o.Kind, _ = doc["kind"].(string)
+	o.Name, _ = meta["name"].(string)
+	o.Namespace, _ = meta["namespace"].(string)
+	objects[o.key()] = o
+}
+
+func asSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
+
+func normalize(doc map[string]interface{}) {
+	for _, p := range ignoredPaths {
+		deletePath(doc, p)
+	}
+	kind, _ := doc["kind"].(string)
+	for _, d := range defaults {
+		if d.kind == "" || d.kind == kind {
+			setDefault(doc, d.path, d.value)
+		}
+	}
+	pruneEmpty(doc)
+}
+
+// splitPath splits a dotted path, keeping annotation keys that contain dots
+// intact after the "annotations"/"labels" segment.
+func splitPath(path string) []string {
+	parts := strings.Split(path, ".")
+	for i, p := range parts {
+		if (p == "annotations" || p == "labels") && i+1 < len(parts) {
+			return append(parts[:i+1], strings.Join(parts[i+1:], "."))
+		}
+	}
+	return parts
+}
+
+func deletePath(doc map[string]interface{}, path string) {
+	parts := splitPath(path)
+	m := doc
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = next
+	}
+	delete(m, parts[len(parts)-1])
+}
+
+func setDefault(doc map[string]interface{}, path string, value interface{}) {
+	parts := splitPath(path)
+	m := doc
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]interface{})
+		if !ok {
+			if m[p] != nil {
+				return
+			}
+			next = map[string]interface{}{}
+			m[p] = next
+		}
+		m = next
+	}
+	if _, ok := m[parts[len(parts)-1]]; !ok {
+		m[parts[len(parts)-1]] = value
+	}
+}
+
+// pruneEmpty removes empty maps, lists and nulls so that "{}" and an absent
+// field compare equal.
+func pruneEmpty(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		for k, child := range val {
+			if pruneEmpty(child) {
+				delete(val, k)
+			}
+		}
+		return len(val) == 0
+	case []interface{}:
+		for _, child := range val {
+			pruneEmpty(child)
+		}
+		return len(val) == 0
+	}
+	return false
+}
+
+func listItemName(v interface{}) (string, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	name, ok := m["name"].(string)
+	return name, ok && name != ""
+}
+
+func namedList(list []interface{}) (map[string]interface{}, []string, bool) {
+	byName := map[string]interface{}{}
+	var order []string
+	for _, item := range list {
+		name, ok := listItemName(item)
+		if !ok {
+			return nil, nil, false
+		}
+		if _, dup := byName[name]; dup {
+			return nil, nil, false
+		}
+		byName[name] = item
+		order = append(order, name)
+	}
+	return byName, order, true
+}
+
+func equalScalar(a, b interface{}) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// diffValues walks both trees and records leaf-level changes.
+func diffValues(path string, a, b interface{}, out *[]change) {
+	am, aIsMap := a.(map[string]interface{})
+	bm, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffValues(joinPath(path, k), am[k], bm[k], out)
+		}
+		return
+	}
+
+	al, aIsList := a.([]interface{})
+	bl, bIsList := b.([]interface{})
+	if aIsList && bIsList {
+		an, aOrder, aNamed := namedList(al)
+		bn, bOrder, bNamed := namedList(bl)
+		if aNamed && bNamed {
+			seen := map[string]bool{}
+			for _, name := range append(aOrder, bOrder...) {
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				diffValues(fmt.Sprintf("%s[%s]", path, name), an[name], bn[name], out)
+			}
+			return
+		}
+		if allScalars(al) && allScalars(bl) {
+			if !reflect.DeepEqual(al, bl) {
+				*out = append(*out, change{Path: path, Old: a, New: b})
+			}
+			return
+		}
+		n := len(al)
+		if len(bl) > n {
+			n = len(bl)
+		}
+		for i := 0; i < n; i++ {
+			var av, bv interface{}
+			if i < len(al) {
+				av = al[i]
+			}
+			if i < len(bl) {
+				bv = bl[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), av, bv, out)
+		}
+		return
+	}
+
+	if a == nil && b == nil {
+		return
+	}
+	if a != nil && b != nil && !aIsMap && !bIsMap && !aIsList && !bIsList && equalScalar(a, b) {
+		return
+	}
+	*out = append(*out, change{Path: path, Old: a, New: b})
+}
+
+func allScalars(list []interface{}) bool {
+	for _, v := range list {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+func joinPath(base, key string) string {
+	if base == "" {
+		return key
+	}
+	if strings.ContainsAny(key, "./") {
+		return fmt.Sprintf("%s[%q]", base, key)
+	}
+	return base + "." + key
+}
+
+func categorize(kind, path string) string {
+	leaf := path
+	if i := strings.LastIndexAny(path, ".]"); i >= 0 {
+		leaf = path[i+1:]
+	}
+	lower := strings.ToLower(path)
+	switch {
+	case path == "apiVersion" || leaf == "version" || strings.HasSuffix(leaf, "Version"):
+		return catVersion
+	case leaf == "replicas" || strings.Contains(lower, "replicas"):
+		return catReplicas
+	case strings.Contains(lower, "image") || leaf == "ami" || strings.Contains(lower, ".ami."):
+		return catImage
+	case strings.HasSuffix(kind, "MachineTemplate") || strings.HasSuffix(kind, "ConfigTemplate") ||
+		strings.Contains(lower, "infrastructureref") || strings.Contains(lower, "machinetemplate") ||
+		strings.Contains(lower, "configref") || strings.Contains(lower, "instancetype") ||
+		strings.Contains(lower, "vmsize") || strings.Contains(lower, "machinetype"):
+		return catTemplate
+	case strings.Contains(lower, "clusternetwork") || strings.Contains(lower, "cidr") ||
+		strings.Contains(lower, "controlplaneendpoint"):
+		return catNetwork
+	}
+	return catOther
+}
+
+func triggersRollout(kind string, changes []change) bool {
+	for _, c := range changes {
+		for _, prefix := range rolloutTriggers[kind] {
+			if c.Path == prefix || strings.HasPrefix(c.Path, prefix+".") || strings.HasPrefix(c.Path, prefix+"[") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func diffObjects(kind string, a, b map[string]interface{}) []change {
+	var changes []change
+	diffValues("", a, b, &changes)
+	for i := range changes {
+		changes[i].Category = categorize(kind, changes[i].Path)
+	}
+	return changes
+}
+
+// pairReplacements matches removed templates to added ones when a reference
+// (infrastructureRef, configRef, ...) was renamed from one to the other,
+// which is how immutable machine templates are rotated.
+func pairReplacements(diffs []objectDiff, removed, added map[string]object) map[string]string {
+	pairs := map[string]string{}
+	for _, d := range diffs {
+		for _, c := range d.Changes {
+			if !strings.HasSuffix(c.Path, "Ref.name") && !strings.HasSuffix(c.Path, "ref.name") {
+				continue
+			}
+			oldName, ok1 := c.Old.(string)
+			newName, ok2 := c.New.(string)
+			if !ok1 || !ok2 {
+				continue
+			}
+			for rk, r := range removed {
+				if r.Name != oldName || r.Namespace != d.Namespace {
+					continue
+				}
+				for ak, a := range added {
+					if a.Name == newName && a.Kind == r.Kind && a.Namespace == r.Namespace {
+						pairs[rk] = ak
+					}
+				}
+			}
+		}
+	}
+	return pairs
+}
+
+func compare(oldSet, newSet map[string]object) report {
+	rep := report{Categories: map[string]int{}}
+	removed := map[string]object{}
+	added := map[string]object{}
+
+	keys := map[string]bool{}
+	for k := range oldSet {
+		keys[k] = true
+	}
+	for k := range newSet {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var diffs []objectDiff
+	for _, k := range sorted {
+		o, inOld := oldSet[k]
+		n, inNew := newSet[k]
+		switch {
+		case !inOld:
+			added[k] = n
+		case !inNew:
+			removed[k] = o
+		default:
+			changes := diffObjects(o.Kind, o.Doc, n.Doc)
+			if len(changes) == 0 {
+				rep.Unchanged++
+				continue
+			}
+			diffs = append(diffs, objectDiff{
+				Kind: n.Kind, Namespace: n.Namespace, Name: n.Name, Status: "changed",
+				TriggerRollout: triggersRollout(n.Kind, changes), Changes: changes,
+			})
+		}
+	}
+
+	for rk, ak := range pairReplacements(diffs, removed, added) {
+		r, a := removed[rk], added[ak]
+		changes := diffObjects(r.Kind, r.Doc, a.Doc)
+		var filtered []change
+		for _, c := range changes {
+			if c.Path != "metadata.name" {
+				filtered = append(filtered, c)
+			}
+		}
+		diffs = append(diffs, objectDiff{
+			Kind: r.Kind, Namespace: r.Namespace, Name: r.Name, Status: "replaced",
+			ReplacedBy: a.Name, Changes: filtered,
+		})
+		delete(removed, rk)
+		delete(added, ak)
+	}
+	for _, o := range removed {
+		diffs = append(diffs, objectDiff{Kind: o.Kind, Namespace: o.Namespace, Name: o.Name, Status: "removed"})
+	}
+	for _, o := range added {
+		diffs = append(diffs, objectDiff{Kind: o.Kind, Namespace: o.Namespace, Name: o.Name, Status: "added"})
+	}
+
+	sort.SliceStable(diffs, func(i, j int) bool {
+		if diffs[i].Kind != diffs[j].Kind {
+			return diffs[i].Kind < diffs[j].Kind
+		}
+		return diffs[i].Namespace+"/"+diffs[i].Name < diffs[j].Namespace+"/"+diffs[j].Name
+	})
+	for _, d := range diffs {
+		for _, c := range d.Changes {
+			rep.Categories[c.Category]++
+		}
+	}
+	rep.Objects = diffs
+	if rep.Objects == nil {
+		rep.Objects = []objectDiff{}
+	}
+	return rep
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<unset>"
+	}
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		s := string(data)
+		if len(s) > 80 {
+			s = s[:77] + "..."
+		}
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func printReport(rep report) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("%s\nTEMPLATE DIFF: %s → %s\n%s\n", sep, rep.Old, rep.New, sep)
+
+	if len(rep.Objects) == 0 {
+		fmt.Printf("\n✅ No semantic differences (%d objects compared)\n", rep.Unchanged)
+		return
+	}
+
+	icons := map[string]string{"added": "➕", "removed": "➖", "changed": "✏️", "replaced": "🔁"}
+	for _, d := range rep.Objects {
+		title := fmt.Sprintf("%s %s %s/%s", icons[d.Status], d.Kind, d.Namespace, d.Name)
+		if d.ReplacedBy != "" {
+			title += " → " + d.ReplacedBy
+		}
+		if d.TriggerRollout {
+			title += "  (triggers rollout)"
+		}
+		fmt.Printf("\n%s\n", title)
+		for _, cat := range categoryOrder {
+			for _, c := range d.Changes {
+				if c.Category != cat {
+					continue
+				}
+				switch {
+				case c.Old == nil:
+					fmt.Printf("  [%s] %s: + %s\n", c.Category, c.Path, formatValue(c.New))
+				case c.New == nil:
+					fmt.Printf("  [%s] %s: - %s\n", c.Category, c.Path, formatValue(c.Old))
+				default:
+					fmt.Printf("  [%s] %s: %s → %s\n", c.Category, c.Path, formatValue(c.Old), formatValue(c.New))
+				}
+			}
+		}
+	}
+
+	fmt.Printf("\n%s\nSUMMARY\n%s\n", sep, sep)
+	counts := map[string]int{}
+	for _, d := range rep.Objects {
+		counts[d.Status]++
+	}
+	fmt.Printf("  Objects: %d changed, %d replaced, %d added, %d removed, %d unchanged\n",
+		counts["changed"], counts["replaced"], counts["added"], counts["removed"], rep.Unchanged)
+	for _, cat := range categoryOrder {
+		if n := rep.Categories[cat]; n > 0 {
+			fmt.Printf("  %-18s %d\n", cat+":", n)
+		}
+	}
+}
+
+func main() {
+	recursive := flag.Bool("r", false, "Search directories recursively")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+	exitCode := flag.Bool("exit-code", false, "Exit with status 1 when differences are found")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <old> <new>\n\nSemantically compare two CAPI manifest sets (files or directories).\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	oldSet, err := loadObjects(flag.Arg(0), *recursive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	newSet, err := loadObjects(flag.Arg(1), *recursive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	rep := compare(oldSet, newSet)
+	rep.Old, rep.New = flag.Arg(0), flag.Arg(1)
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(rep, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(rep)
+	}
+
+	if *exitCode && len(rep.Objects) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,720 @@
+// estimate-cost estimates the monthly infrastructure cost of CAPI clusters.
+//
+// Usage:
+//
+//	go run ./estimate-cost [flags] [files...]
+//
+// Examples:
+//
+//	go run ./estimate-cost cluster.yaml
+//	go run ./estimate-cost --live -c my-cluster -n default
+//	go run ./estimate-cost --compare proposed.yaml current.yaml
+//	go run ./estimate-cost --pricing ./pricing.yaml --format json cluster.yaml
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+
+	"gopkg.in/yaml.v3"
+)
+
+// providerPricing holds hourly prices for a single infrastructure provider.
+// Instance prices take precedence; per-unit prices are used for providers
+// whose machine templates specify CPU and memory instead of an instance type.
+type providerPricing struct {
+	Instances     map[string]float64 `yaml:"instances" json:"instances"`
+	VCPUHour      float64            `yaml:"vcpuHour" json:"vcpuHour"`
+	MemoryGiBHour float64            `yaml:"memoryGiBHour" json:"memoryGiBHour"`
+}
+
+type pricingTable struct {
+	Currency      string                      `yaml:"currency" json:"currency"`
+	HoursPerMonth float64                     `yaml:"hoursPerMonth" json:"hoursPerMonth"`
+	Providers     map[string]*providerPricing `yaml:"providers" json:"providers"`
+}
+
+// defaultPricing contains indicative on-demand list prices (USD/hour).
+// Override or extend it with --pricing for real contract rates.
+var defaultPricing = pricingTable{
+	Currency:      "USD",
+	HoursPerMonth: 730,
+	Providers: map[string]*providerPricing{
+		"aws": {Instances: map[string]float64{
+			"t3.medium": 0.0416, "t3.large": 0.0832, "t3.xlarge": 0.1664,
+			"m5.large": 0.096, "m5.xlarge": 0.192, "m5.2xlarge": 0.384,
+			"m6i.large": 0.096, "m6i.xlarge": 0.192, "m6i.2xlarge": 0.384,
+			"c5.large": 0.085, "c5.xlarge": 0.17, "r5.large": 0.126, "r5.xlarge": 0.252,
+		}},
+		"azure": {Instances: map[string]float64{
+			"Standard_B2s": 0.0416, "Standard_B2ms": 0.0832,
+			"Standard_D2s_v3": 0.096, "Standard_D4s_v3": 0.192, "Standard_D8s_v3": 0.384,
+			"Standard_D2s_v5": 0.096, "Standard_D4s_v5": 0.192, "Standard_D8s_v5": 0.384,
+		}},
+		"gcp": {Instances: map[string]float64{
+			"e2-standard-2": 0.067, "e2-standard-4": 0.134, "e2-standard-8": 0.268,
+			"n2-standard-2": 0.0971, "n2-standard-4": 0.1942, "n2-standard-8": 0.3885,
+		}},
+		"hetzner": {Instances: map[string]float64{
+			"cx22": 0.0071, "cx32": 0.0113, "cx42": 0.0273, "cpx31": 0.0242, "ccx23": 0.0395,
+		}},
+		"digitalocean": {Instances: map[string]float64{
+			"s-2vcpu-4gb": 0.0357, "s-4vcpu-8gb": 0.0714, "g-2vcpu-8gb": 0.0938,
+		}},
+		"docker": {Instances: map[string]float64{"default": 0}},
+	},
+}
+
+// machineTemplateFields maps provider machine template kinds to the provider
+// key used for pricing and the template spec field holding the instance type.
+var machineTemplateFields = map[string]struct {
+	Provider string
+	Field    string
+}{
+	"AWSMachineTemplate":           {"aws", "instanceType"},
+	"AWSMachinePool":               {"aws", "awsLaunchTemplate.instanceType"},
+	"AWSManagedMachinePool":        {"aws", "instanceType"},
+	"AzureMachineTemplate":         {"azure", "vmSize"},
+	"AzureMachinePool":             {"azure", "template.vmSize"},
+	"GCPMachineTemplate":           {"gcp", "instanceType"},
+	"HCloudMachineTemplate":        {"hetzner", "type"},
+	"DOMachineTemplate":            {"digitalocean", "size"},
+	"OpenStackMachineTemplate":     {"openstack", "flavor"},
+	"VSphereMachineTemplate":       {"vsphere", ""},
+	"ProxmoxMachineTemplate":       {"proxmox", ""},
+	"NutanixMachineTemplate":       {"nutanix", ""},
+	"DockerMachineTemplate":        {"docker", ""},
+	"DockerMachinePool":            {"docker", ""},
+	"DockerMachinePoolTemplate":    {"docker", ""},
+	"Metal3MachineTemplate":        {"metal3", ""},
+	"OpenStackMachinePoolTemplate": {"openstack", "flavor"},
+}
+
+type poolEstimate struct {
+	Cluster      string  `json:"cluster"`
+	Pool         string  `json:"pool"`
+	Role         string  `json:"role"`
+	Replicas     int     `json:"replicas"`
+	Provider     string  `json:"provider"`
+	TemplateKind string  `json:"template_kind"`
+	InstanceType string  `json:"instance_type"`
+	HourlyUnit   float64 `json:"hourly_per_machine"`
+	Monthly      float64 `json:"monthly"`
+	Priced       bool    `json:"priced"`
+	Note         string  `json:"note,omitempty"`
+}
+
+type clusterEstimate struct {
+	Cluster string         `json:"cluster"`
+	Pools   []poolEstimate `json:"pools"`
+	Monthly float64        `json:"monthly"`
+	Missing int            `json:"unpriced_pools"`
+}
+
+// objectStore resolves objects by kind, namespace and name, either from a
+// set of parsed manifests or from the live management cluster.
+type objectStore interface {
+	list(kind string) []map[string]interface{}
+	get(kind, apiVersion, namespace, name string) map[string]interface{}
+}
+
+type manifestStore struct {
+	objects []map[string]interface{}
+}
+
+func (s *manifestStore) list(kind string) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, o := range s.objects {
+		if k, _ := o["kind"].(string); k == kind {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+func (s *manifestStore) get(kind, _, namespace, name string) map[string]interface{} {
+	for _, o := range s.list(kind) {
+		meta := kubectl.GetMap(o, "metadata")
+		n, _ := meta["name"].(string)
+		ns, _ := meta["namespace"].(string)
+		if n == name && (ns == "" || namespace == "" || ns == namespace) {
+			return o
+		}
+	}
+	return nil
+}
+
+type liveStore struct {
+	namespace     string
+	allNamespaces bool
+	clusterName   string
+	cache         map[string]map[string]interface{}
+}
+
+var liveResources = map[string]string{
+	"Cluster":             "clusters.cluster.x-k8s.io",
+	"ClusterClass":        "clusterclasses.cluster.x-k8s.io",
+	"KubeadmControlPlane": "kubeadmcontrolplanes.controlplane.cluster.x-k8s.io",
+	"MachineDeployment":   "machinedeployments.cluster.x-k8s.io",
+	"MachinePool":         "machinepools.cluster.x-k8s.io",
+}
+
+func (s *liveStore) list(kind string) []map[string]interface{} {
+	resource, ok := liveResources[kind]
+	if !ok {
+		return nil
+	}
+	if kind == "Cluster" && s.clusterName != "" {
+		items, _ := kubectl.RunJSON(resource+"/"+s.clusterName, s.namespace, "", false)
+		return items
+	}
+	label := ""
+	if s.clusterName != "" && kind != "ClusterClass" {
+		label = "cluster.x-k8s.io/cluster-name=" + s.clusterName
+	}
+	items, _ := kubectl.RunJSON(resource, s.namespace, label, s.allNamespaces)
+	return items
+}
+
+// liveResource names the kubectl resource for a kind. Known CAPI kinds use
+// their full plural name; anything else is addressed as <kind>.<group>, which
+// kubectl resolves without guessing the plural. apiVersion may also be a bare
+// API group, as refOf returns for v1beta2 references.
+func liveResource(kind, apiVersion string) string {
+	if r, ok := liveResources[kind]; ok {
+		return r
+	}
+	group := ""
+	if i := strings.Index(apiVersion, "/"); i >= 0 {
+		group = apiVersion[:i]
+	} else if strings.Contains(apiVersion, ".") {
+		group = apiVersion
+	}
+	if group == "" {
+		return strings.ToLower(kind)
+	}
+	return strings.ToLower(kind) + "." + group
+}
+
+func (s *liveStore) get(kind, apiVersion, namespace, name string) map[string]interface{} {
+	key := kind + "/" + namespace + "/" + name
+	if obj, ok := s.cache[key]; ok {
+		return obj
+	}
+	items, _ := kubectl.RunJSON(liveResource(kind, apiVersion)+"/"+name, namespace, "", false)
+	var obj map[string]interface{}
+	if len(items) > 0 {
+		obj = items[0]
+	}
+	s.cache[key] = obj
+	return obj
+}
+
+func loadManifests(paths []string) ([]map[string]interface{}, error) {
+	var objects []map[string]interface{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		for {
+			var doc map[string]interface{}
+			if err := decoder.Decode(&doc); err != nil {
+				if err.Error() != "EOF" {
+					return nil, fmt.Errorf("%s: %w", path, err)
+				}
+				break
+			}
+			if doc != nil {
+				objects = append(objects, doc)
+			}
+		}
+	}
+	return objects, nil
+}
+
+func loadPricing(paths []string) (pricingTable, error) {
+	table := pricingTable{
+		Currency:      defaultPricing.Currency,
+		HoursPerMonth: defaultPricing.HoursPerMonth,
+		Providers:     map[string]*providerPricing{},
+	}
+	for name, p := range defaultPricing.Providers {
+		cp := &providerPricing{Instances: map[string]float64{}, VCPUHour: p.VCPUHour, MemoryGiBHour: p.MemoryGiBHour}
+		for k, v := range p.Instances {
+			cp.Instances[k] = v
+		}
+		table.Providers[name] = cp
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return table, err
+		}
+		var override pricingTable
+		if err := yaml.Unmarshal(data, &override); err != nil {
+			return table, fmt.Errorf("%s: %w", path, err)
+		}
+		if override.Currency != "" {
+			table.Currency = override.Currency
+		}
+		if override.HoursPerMonth > 0 {
+			table.HoursPerMonth = override.HoursPerMonth
+		}
+		for name, p := range override.Providers {
+			if p == nil {
+				continue
+			}
+			existing, ok := table.Providers[name]
+			if !ok {
+				existing = &providerPricing{Instances: map[string]float64{}}
+				table.Providers[name] = existing
+			}
+			for k, v := range p.Instances {
+				existing.Instances[k] = v
+			}
+			if p.VCPUHour > 0 {
+				existing.VCPUHour = p.VCPUHour
+			}
+			if p.MemoryGiBHour > 0 {
+				existing.MemoryGiBHour = p.MemoryGiBHour
+			}
+		}
+	}
+	return table, nil
+}
+
+func toInt(v interface{}, def int) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return def
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// priceTemplate resolves the instance type of a machine template (or machine
+// pool infrastructure object) and looks up its hourly price.
+func priceTemplate(obj map[string]interface{}, pricing pricingTable, est *poolEstimate) {
+	kind, _ := obj["kind"].(string)
+	est.TemplateKind = kind
+
+	fields, ok := machineTemplateFields[kind]
+	if !ok {
+		est.Provider = strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(kind, "MachineTemplate"), "MachinePool"))
+		est.Note = "unknown machine template kind"
+		return
+	}
+	est.Provider = fields.Provider
+
+	// Machine templates nest the machine spec under spec.template.spec;
+	// machine pool infrastructure objects carry it directly under spec.
+	spec := kubectl.GetMap(obj, "spec")
+	if tmpl := kubectl.GetMap(kubectl.GetMap(spec, "template"), "spec"); len(tmpl) > 0 && strings.HasSuffix(kind, "Template") {
+		spec = tmpl
+	}
+
+	prices := pricing.Providers[fields.Provider]
+	if prices == nil {
+		est.Note = "no pricing data for provider " + fields.Provider
+		return
+	}
+
+	if fields.Field != "" {
+		est.InstanceType = kubectl.GetString(spec, fields.Field)
+		if est.InstanceType == "" {
+			est.Note = "instance type not set (spec." + fields.Field + ")"
+			return
+		}
+		if p, ok := prices.Instances[est.InstanceType]; ok {
+			est.HourlyUnit = p
+			est.Priced = true
+			return
+		}
+		est.Note = "no price for instance type " + est.InstanceType
+		return
+	}
+
+	cpus := toFloat(spec["numCPUs"])
+	if cpus == 0 {
+		cpus = toFloat(spec["vcpusPerSocket"]) * toFloat(spec["vcpuSockets"])
+	}
+	if cpus == 0 {
+		cpus = toFloat(spec["numCores"]) * float64(toInt(spec["numSockets"], 1))
+	}
+	memMiB := toFloat(spec["memoryMiB"])
+	if memMiB == 0 {
+		if s, ok := spec["memorySize"].(string); ok {
+			memMiB = parseMemoryMiB(s)
+		}
+	}
+	if cpus > 0 || memMiB > 0 {
+		est.InstanceType = fmt.Sprintf("%gvCPU/%gGiB", cpus, memMiB/1024)
+		if prices.VCPUHour > 0 || prices.MemoryGiBHour > 0 {
+			est.HourlyUnit = cpus*prices.VCPUHour + memMiB/1024*prices.MemoryGiBHour
+			est.Priced = true
+			return
+		}
+		est.Note = "no per-unit pricing for provider " + fields.Provider
+		return
+	}
+
+	if p, ok := prices.Instances["default"]; ok {
+		est.InstanceType = "default"
+		est.HourlyUnit = p
+		est.Priced = true
+		return
+	}
+	est.Note = "template has no sizing information"
+}
+
+func parseMemoryMiB(s string) float64 {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		factor float64
+	}{{"Ti", 1024 * 1024}, {"Gi", 1024}, {"Mi", 1}, {"T", 1e12 / (1 << 20)}, {"G", 1e9 / (1 << 20)}, {"M", 1e6 / (1 << 20)}}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			var v float64
+			if _, err := fmt.Sscanf(strings.TrimSuffix(s, u.suffix), "%g", &v); err == nil {
+				return v * u.factor
+			}
+		}
+	}
+	return 0
+}
+
+func refOf(m map[string]interface{}) (kind, apiVersion, name string) {
+	kind, _ = m["kind"].(string)
+	apiVersion, _ = m["apiVersion"].(string)
+	if apiVersion == "" {
+		apiVersion, _ = m["apiGroup"].(string)
+	}
+	name, _ = m["name"].(string)
+	return kind, apiVersion, name
+}
+
+func ownedBy(obj map[string]interface{}, clusterName string) bool {
+	if kubectl.GetString(obj, "spec.clusterName") == clusterName {
+		return true
+	}
+	labels := kubectl.GetMap(kubectl.GetMap(obj, "metadata"), "labels")
+	cn, _ := labels["cluster.x-k8s.io/cluster-name"].(string)
+	return cn == clusterName
+}
+
+func estimateCluster(cluster map[string]interface{}, store objectStore, pricing pricingTable) clusterEstimate {
+	meta := kubectl.GetMap(cluster, "metadata")
+	name, _ := meta["name"].(string)
+	ns, _ := meta["namespace"].(string)
+	label := name
+	if ns != "" {
+		label = ns + "/" + name
+	}
+	est := clusterEstimate{Cluster: label}
+
+	addPool := func(pool, role string, replicas int, ref map[string]interface{}) {
+		p := poolEstimate{Cluster: label, Pool: pool, Role: role, Replicas: replicas}
+		kind, av, refName := refOf(ref)
+		if kind == "" || refName == "" {
+			p.Note = "no infrastructure reference"
+		} else if obj := store.get(kind, av, ns, refName); obj == nil {
+			p.TemplateKind = kind
+			p.Note = fmt.Sprintf("%s %s not found", kind, refName)
+		} else {
+			priceTemplate(obj, pricing, &p)
+		}
+		p.Monthly = p.HourlyUnit * float64(p.Replicas) * pricing.HoursPerMonth
+		est.Pools = append(est.Pools, p)
+	}
+
+	spec := kubectl.GetMap(cluster, "spec")
+	if topo := kubectl.GetMap(spec, "topology"); len(topo) > 0 {
+		estimateTopology(name, ns, topo, store, addPool)
+	} else {
+		cpKind, cpAV, cpName := refOf(kubectl.GetMap(spec, "controlPlaneRef"))
+		if cpKind != "" {
+			if cp := store.get(cpKind, cpAV, ns, cpName); cp != nil {
+				cpSpec := kubectl.GetMap(cp, "spec")
+				ref := kubectl.GetMap(kubectl.GetMap(cpSpec, "machineTemplate"), "infrastructureRef")
+				if len(ref) == 0 {
+					ref = kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(cpSpec, "machineTemplate"), "spec"), "infrastructureRef")
+				}
+				addPool(cpName, "control-plane", toInt(cpSpec["replicas"], 1), ref)
+			}
+		}
+
+		for _, md := range store.list("MachineDeployment") {
+			if !ownedBy(md, name) {
+				continue
+			}
+			mdSpec := kubectl.GetMap(md, "spec")
+			ref := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(mdSpec, "template"), "spec"), "infrastructureRef")
+			addPool(kubectl.GetString(md, "metadata.name"), "worker", toInt(mdSpec["replicas"], 1), ref)
+		}
+
+		for _, mp := range store.list("MachinePool") {
+			if !ownedBy(mp, name) {
+				continue
+			}
+			mpSpec := kubectl.GetMap(mp, "spec")
+			ref := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(mpSpec, "template"), "spec"), "infrastructureRef")
+			addPool(kubectl.GetString(mp, "metadata.name"), "machinepool", toInt(mpSpec["replicas"], 1), ref)
+		}
+	}
+
+	for _, p := range est.Pools {
+		est.Monthly += p.Monthly
+		if !p.Priced {
+			est.Missing++
+		}
+	}
+	return est
+}
+
+// estimateTopology resolves pools of a ClusterClass-based cluster through the
+// referenced ClusterClass, which must be present in the manifest set (or live).
+func estimateTopology(name, ns string, topo map[string]interface{}, store objectStore, addPool func(string, string, int, map[string]interface{})) {
+	className, _ := topo["class"].(string)
+	if className == "" {
+		className = kubectl.GetString(topo, "classRef.name")
+	}
+	cc := store.get("ClusterClass", "cluster.x-k8s.io/v1beta1", ns, className)
+	if cc == nil {
+		addPool(name+"-control-plane", "control-plane", toInt(kubectl.GetMap(topo, "controlPlane")["replicas"], 1), nil)
+		return
+	}
+	ccSpec := kubectl.GetMap(cc, "spec")
+
+	cpRef := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(ccSpec, "controlPlane"), "machineInfrastructure"), "ref")
+	if len(cpRef) == 0 {
+		cpRef = kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(ccSpec, "controlPlane"), "machineInfrastructure"), "templateRef")
+	}
+	addPool(name+"-control-plane", "control-plane", toInt(kubectl.GetMap(topo, "controlPlane")["replicas"], 1), cpRef)
+
+	classes := map[string]map[string]interface{}{}
+	for _, w := range kubectl.GetSlice(kubectl.GetMap(ccSpec, "workers"), "machineDeployments") {
+		wm, ok := w.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		cls, _ := wm["class"].(string)
+		ref := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(wm, "template"), "infrastructure"), "ref")
+		if len(ref) == 0 {
+			ref = kubectl.GetMap(kubectl.GetMap(wm, "infrastructure"), "templateRef")
+		}
+		classes[cls] = ref
+	}
+
+	for _, md := range kubectl.GetSlice(kubectl.GetMap(topo, "workers"), "machineDeployments") {
+		mm, ok := md.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		cls, _ := mm["class"].(string)
+		mdName, _ := mm["name"].(string)
+		addPool(mdName, "worker", toInt(mm["replicas"], 1), classes[cls])
+	}
+}
+
+func estimateAll(store objectStore, pricing pricingTable) []clusterEstimate {
+	var results []clusterEstimate
+	for _, c := range store.list("Cluster") {
+		results = append(results, estimateCluster(c, store, pricing))
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Cluster < results[j].Cluster })
+	return results
+}
+
+func printEstimates(estimates []clusterEstimate, pricing pricingTable) {
+	sep := strings.Repeat("=", 70)
+	cur := pricing.Currency
+	var total float64
+	for _, e := range estimates {
+		fmt.Printf("\n%s\nCluster: %s\n%s\n", sep, e.Cluster, sep)
+		fmt.Printf("%-28s %-14s %4s %-18s %10s %12s\n", "POOL", "ROLE", "REPL", "INSTANCE", "HOURLY", "MONTHLY")
+		fmt.Println(strings.Repeat("-", 70))
+		for _, p := range e.Pools {
+			inst := p.InstanceType
+			if inst == "" {
+				inst = "-"
+			}
+			if p.Priced {
+				fmt.Printf("%-28s %-14s %4d %-18s %10.4f %12.2f\n", p.Pool, p.Role, p.Replicas, inst, p.HourlyUnit, p.Monthly)
+			} else {
+				fmt.Printf("%-28s %-14s %4d %-18s %10s %12s\n", p.Pool, p.Role, p.Replicas, inst, "?", "?")
+				fmt.Printf("  ⚠️  %s\n", p.Note)
+			}
+		}
+		fmt.Printf("\nEstimated monthly cost: %.2f %s\n", e.Monthly, cur)
+		if e.Missing > 0 {
+			fmt.Printf("  (%d pool(s) without pricing data excluded)\n", e.Missing)
+		}
+		total += e.Monthly
+	}
+	if len(estimates) > 1 {
+		fmt.Printf("\n%s\nTOTAL (%d clusters): %.2f %s/month\n", sep, len(estimates), total, cur)
+	}
+}
+
+type costDelta struct {
+	Cluster  string  `json:"cluster"`
+	Baseline float64 `json:"baseline_monthly"`
+	Proposed float64 `json:"proposed_monthly"`
+	Delta    float64 `json:"delta_monthly"`
+}
+
+func compareEstimates(baseline, proposed []clusterEstimate) []costDelta {
+	byName := map[string]*costDelta{}
+	var order []string
+	for _, e := range baseline {
+		byName[e.Cluster] = &costDelta{Cluster: e.Cluster, Baseline: e.Monthly}
+		order = append(order, e.Cluster)
+	}
+	for _, e := range proposed {
+		d, ok := byName[e.Cluster]
+		if !ok {
+			d = &costDelta{Cluster: e.Cluster}
+			byName[e.Cluster] = d
+			order = append(order, e.Cluster)
+		}
+		d.Proposed = e.Monthly
+	}
+	var out []costDelta
+	for _, name := range order {
+		d := byName[name]
+		d.Delta = d.Proposed - d.Baseline
+		out = append(out, *d)
+	}
+	return out
+}
+
+func printComparison(deltas []costDelta, pricing pricingTable) {
+	sep := strings.Repeat("=", 70)
+	fmt.Printf("\n%s\nWHAT-IF COMPARISON (%s/month)\n%s\n", sep, pricing.Currency, sep)
+	fmt.Printf("%-30s %12s %12s %12s\n", "CLUSTER", "BASELINE", "PROPOSED", "DELTA")
+	fmt.Println(strings.Repeat("-", 70))
+	var tb, tp float64
+	for _, d := range deltas {
+		fmt.Printf("%-30s %12.2f %12.2f %+12.2f\n", d.Cluster, d.Baseline, d.Proposed, d.Delta)
+		tb += d.Baseline
+		tp += d.Proposed
+	}
+	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("%-30s %12.2f %12.2f %+12.2f\n", "TOTAL", tb, tp, tp-tb)
+}
+
+func main() {
+	live := flag.Bool("live", false, "Estimate clusters from the live management cluster")
+	cluster := flag.String("c", "", "Cluster name (live mode)")
+	namespace := flag.String("n", "", "Namespace (live mode)")
+	allNS := flag.Bool("A", false, "All namespaces (live mode)")
+	pricingFiles := flag.String("pricing", "", "Comma-separated pricing data files (YAML/JSON) merged over built-in prices")
+	compareFile := flag.String("compare", "", "Proposed template to compare against the baseline (what-if)")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [files...]\n\nEstimate monthly cost of CAPI clusters from templates or a live cluster.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if !*live && flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var paths []string
+	if *pricingFiles != "" {
+		paths = strings.Split(*pricingFiles, ",")
+	}
+	pricing, err := loadPricing(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading pricing: %v\n", err)
+		os.Exit(1)
+	}
+
+	var store objectStore
+	if *live {
+		if kubectl.Find() == "" {
+			fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+			os.Exit(1)
+		}
+		store = &liveStore{namespace: *namespace, allNamespaces: *allNS, clusterName: *cluster, cache: map[string]map[string]interface{}{}}
+	} else {
+		objects, err := loadManifests(flag.Args())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		store = &manifestStore{objects: objects}
+	}
+
+	estimates := estimateAll(store, pricing)
+	if len(estimates) == 0 {
+		fmt.Println("No clusters found to estimate")
+		os.Exit(0)
+	}
+
+	var deltas []costDelta
+	if *compareFile != "" {
+		objects, err := loadManifests([]string{*compareFile})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		deltas = compareEstimates(estimates, estimateAll(&manifestStore{objects: objects}, pricing))
+	}
+
+	if *format == "json" || *output != "" {
+		out := map[string]interface{}{
+			"currency":        pricing.Currency,
+			"hours_per_month": pricing.HoursPerMonth,
+			"clusters":        estimates,
+		}
+		if deltas != nil {
+			out["comparison"] = deltas
+		}
+		data, _ := json.MarshalIndent(out, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+		return
+	}
+
+	printEstimates(estimates, pricing)
+	if deltas != nil {
+		printComparison(deltas, pricing)
+	}
+}
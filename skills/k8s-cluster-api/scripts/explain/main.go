@@ -0,0 +1,572 @@
+// explain renders field-level documentation for CAPI and provider kinds.
+//
+// It reads CRDs from the cluster or from a bundle (a YAML/JSON file, a
+// directory of them, or a URL such as a provider components.yaml) and walks
+// the openAPIV3Schema recursively, like `kubectl explain --recursive` but with
+// descriptions, defaults and enums for every field. Output is a text tree,
+// Markdown tables for template authors, or JSON. With --diff-from, fields of
+// the selected kinds are compared against another source or API version,
+// reporting added and removed fields and type or requiredness changes.
+//
+// Usage:
+//
+//	go run ./explain [flags] [kind[.field.path]]
+//
+// Examples:
+//
+//	go run ./explain
+//	go run ./explain DockerMachineTemplate.spec.template.spec
+//	go run ./explain -f infrastructure-components.yaml --format markdown AWSCluster > awscluster.md
+//	go run ./explain --diff-from https://github.com/kubernetes-sigs/cluster-api/releases/download/v1.6.0/cluster-api-components.yaml MachineDeployment
+//	go run ./explain --from-version v1beta1 --api-version v1beta2 Cluster.spec
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+type field struct {
+	Path        string   `json:"path"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	depth       int
+}
+
+type kindDoc struct {
+	Kind    string   `json:"kind"`
+	Group   string   `json:"group"`
+	Version string   `json:"version"`
+	CRD     string   `json:"crd"`
+	Fields  []*field `json:"fields"`
+}
+
+type change struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Change string `json:"change"` // added, removed, type, required
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+func loadSource(src string) ([]map[string]interface{}, error) {
+	if src == "" {
+		ok, stdout, errMsg := kubectl.Run([]string{"get", "crds", "-o", "json"}, 0)
+		if !ok {
+			return nil, fmt.Errorf("list CRDs: %s", strings.TrimSpace(errMsg))
+		}
+		return kubectl.ParseItems(stdout)
+	}
+	var files [][]byte
+	switch info, err := os.Stat(src); {
+	case strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://"):
+		resp, err := httpClient.Get(src)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %s", src, resp.Status)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, data)
+	case err != nil:
+		return nil, err
+	case info.IsDir():
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			ext := filepath.Ext(e.Name())
+			if e.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(src, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, data)
+		}
+	default:
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, data)
+	}
+
+	var crds []map[string]interface{}
+	for _, data := range files {
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		for {
+			var doc map[string]interface{}
+			if err := decoder.Decode(&doc); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("%s: %w", src, err)
+			}
+			if doc == nil {
+				continue
+			}
+			// kubectl -o json / yaml list output
+			if items, ok := doc["items"].([]interface{}); ok {
+				for _, item := range items {
+					if m, ok := item.(map[string]interface{}); ok && m["kind"] == "CustomResourceDefinition" {
+						crds = append(crds, m)
+					}
+				}
+				continue
+			}
+			if doc["kind"] == "CustomResourceDefinition" {
+				crds = append(crds, doc)
+			}
+		}
+	}
+	return crds, nil
+}
+
+// pickVersion returns the requested version entry, or the storage version.
+func pickVersion(crd map[string]interface{}, want string) map[string]interface{} {
+	var storage map[string]interface{}
+	for _, v := range kubectl.GetSlice(kubectl.GetMap(crd, "spec"), "versions") {
+		vm, _ := v.(map[string]interface{})
+		name, _ := vm["name"].(string)
+		if want != "" && name == want {
+			return vm
+		}
+		if s, _ := vm["storage"].(bool); s {
+			storage = vm
+		}
+	}
+	if want != "" {
+		return nil
+	}
+	return storage
+}
+
+func findCRD(crds []map[string]interface{}, name, group string) ([]map[string]interface{}, error) {
+	var matches []map[string]interface{}
+	lname := strings.ToLower(name)
+	for _, crd := range crds {
+		if group != "" && kubectl.GetString(crd, "spec.group") != group {
+			continue
+		}
+		if strings.ToLower(kubectl.GetString(crd, "spec.names.kind")) == lname ||
+			kubectl.GetString(crd, "spec.names.plural") == lname ||
+			kubectl.GetString(crd, "metadata.name") == lname {
+			matches = append(matches, crd)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("kind %q not found", name)
+	}
+	if len(matches) > 1 {
+		var groups []string
+		for _, m := range matches {
+			groups = append(groups, kubectl.GetString(m, "spec.group"))
+		}
+		return nil, fmt.Errorf("kind %q exists in several groups (%s); use --group", name, strings.Join(groups, ", "))
+	}
+	return matches, nil
+}
+
+func typeOf(schema map[string]interface{}) string {
+	t, _ := schema["type"].(string)
+	if f, _ := schema["format"].(string); f != "" {
+		t += "(" + f + ")"
+	}
+	switch {
+	case t == "array":
+		items, _ := schema["items"].(map[string]interface{})
+		return "[]" + typeOf(items)
+	case t == "object" && schema["properties"] == nil:
+		if add, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+			return "map[string]" + typeOf(add)
+		}
+		if p, _ := schema["x-kubernetes-preserve-unknown-fields"].(bool); p {
+			return "object(any)"
+		}
+	case t == "" && schema["x-kubernetes-int-or-string"] == true:
+		return "int-or-string"
+	case t == "":
+		return "any"
+	}
+	return t
+}
+
+func scalar(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	default:
+		data, _ := json.Marshal(t)
+		return string(data)
+	}
+}
+
+// walk flattens a schema into fields in depth-first order.
+func walk(schema map[string]interface{}, path string, depth, maxDepth int, out *[]*field) {
+	props, _ := schema["properties"].(map[string]interface{})
+	if props == nil {
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			props, _ = items["properties"].(map[string]interface{})
+			schema = items
+		}
+	}
+	if props == nil || (maxDepth > 0 && depth >= maxDepth) {
+		return
+	}
+	required := map[string]bool{}
+	for _, r := range kubectl.GetSlice(schema, "required") {
+		if s, ok := r.(string); ok {
+			required[s] = true
+		}
+	}
+	names := make([]string, 0, len(props))
+	for n := range props {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		child, _ := props[n].(map[string]interface{})
+		f := &field{
+			Path:        strings.TrimPrefix(path+"."+n, "."),
+			Type:        typeOf(child),
+			Required:    required[n],
+			Description: strings.TrimSpace(scalar(child["description"])),
+			Default:     scalar(child["default"]),
+			depth:       depth,
+		}
+		for _, e := range kubectl.GetSlice(child, "enum") {
+			f.Enum = append(f.Enum, scalar(e))
+		}
+		*out = append(*out, f)
+		walk(child, f.Path, depth+1, maxDepth, out)
+	}
+}
+
+// subSchema descends to the schema at a dot path, through array items.
+func subSchema(schema map[string]interface{}, path string) (map[string]interface{}, error) {
+	for _, part := range strings.Split(path, ".") {
+		if part == "" {
+			continue
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok && schema["properties"] == nil {
+			schema = items
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		next, ok := props[part].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("field %q not found", path)
+		}
+		schema = next
+	}
+	return schema, nil
+}
+
+func explain(crds []map[string]interface{}, target, group, version string, maxDepth int) ([]*kindDoc, error) {
+	kind, path, _ := strings.Cut(target, ".")
+	var selected []map[string]interface{}
+	if kind == "" {
+		for _, crd := range crds {
+			g := kubectl.GetString(crd, "spec.group")
+			if (group == "" && strings.Contains(g, "cluster.x-k8s.io")) || (group != "" && g == group) {
+				selected = append(selected, crd)
+			}
+		}
+	} else {
+		var err error
+		if selected, err = findCRD(crds, kind, group); err != nil {
+			return nil, err
+		}
+	}
+
+	var docs []*kindDoc
+	for _, crd := range selected {
+		v := pickVersion(crd, version)
+		if v == nil {
+			if kind != "" {
+				return nil, fmt.Errorf("%s has no version %q", kubectl.GetString(crd, "metadata.name"), version)
+			}
+			continue
+		}
+		schema, _ := kubectl.GetNested(v, "schema.openAPIV3Schema").(map[string]interface{})
+		if schema == nil {
+			continue
+		}
+		root, err := subSchema(schema, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", kubectl.GetString(crd, "spec.names.kind"), err)
+		}
+		d := &kindDoc{
+			Kind:    kubectl.GetString(crd, "spec.names.kind"),
+			Group:   kubectl.GetString(crd, "spec.group"),
+			Version: kubectl.GetString(v, "name"),
+			CRD:     kubectl.GetString(crd, "metadata.name"),
+		}
+		walk(root, path, 0, maxDepth, &d.Fields)
+		docs = append(docs, d)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Group != docs[j].Group {
+			return docs[i].Group < docs[j].Group
+		}
+		return docs[i].Kind < docs[j].Kind
+	})
+	return docs, nil
+}
+
+func diff(oldDocs, newDocs []*kindDoc) []change {
+	var changes []change
+	oldByKind := map[string]*kindDoc{}
+	for _, d := range oldDocs {
+		oldByKind[d.Group+"/"+d.Kind] = d
+	}
+	for _, nd := range newDocs {
+		od, ok := oldByKind[nd.Group+"/"+nd.Kind]
+		if !ok {
+			changes = append(changes, change{Kind: nd.Kind, Change: "added", New: nd.Version})
+			continue
+		}
+		delete(oldByKind, nd.Group+"/"+nd.Kind)
+		oldFields := map[string]*field{}
+		for _, f := range od.Fields {
+			oldFields[f.Path] = f
+		}
+		for _, f := range nd.Fields {
+			of, ok := oldFields[f.Path]
+			if !ok {
+				changes = append(changes, change{Kind: nd.Kind, Path: f.Path, Change: "added", New: f.Type})
+				continue
+			}
+			delete(oldFields, f.Path)
+			if of.Type != f.Type {
+				changes = append(changes, change{Kind: nd.Kind, Path: f.Path, Change: "type", Old: of.Type, New: f.Type})
+			}
+			if of.Required != f.Required {
+				changes = append(changes, change{Kind: nd.Kind, Path: f.Path, Change: "required",
+					Old: fmt.Sprint(of.Required), New: fmt.Sprint(f.Required)})
+			}
+		}
+		for _, f := range od.Fields {
+			if _, ok := oldFields[f.Path]; ok {
+				changes = append(changes, change{Kind: nd.Kind, Path: f.Path, Change: "removed", Old: f.Type})
+			}
+		}
+	}
+	for _, od := range oldByKind {
+		changes = append(changes, change{Kind: od.Kind, Change: "removed", Old: od.Version})
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func firstSentence(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if i := strings.Index(s, ". "); i >= 0 {
+		return s[:i+1]
+	}
+	return s
+}
+
+func printText(docs []*kindDoc, full bool) {
+	for _, d := range docs {
+		fmt.Printf("KIND:     %s\nGROUP:    %s\nVERSION:  %s\n\n", d.Kind, d.Group, d.Version)
+		for _, f := range d.Fields {
+			name := f.Path[strings.LastIndex(f.Path, ".")+1:]
+			req := ""
+			if f.Required {
+				req = " -required-"
+			}
+			fmt.Printf("%s%s\t<%s>%s\n", strings.Repeat("  ", f.depth+1), name, f.Type, req)
+			desc := firstSentence(f.Description)
+			if full {
+				desc = strings.Join(strings.Fields(f.Description), " ")
+			}
+			indent := strings.Repeat("  ", f.depth+3)
+			if desc != "" {
+				fmt.Printf("%s%s\n", indent, desc)
+			}
+			if f.Default != "" {
+				fmt.Printf("%sDefault: %s\n", indent, f.Default)
+			}
+			if len(f.Enum) > 0 {
+				fmt.Printf("%sOne of: %s\n", indent, strings.Join(f.Enum, ", "))
+			}
+		}
+		fmt.Println()
+	}
+}
+
+func mdEscape(s string) string {
+	return strings.ReplaceAll(strings.Join(strings.Fields(s), " "), "|", "\\|")
+}
+
+func printMarkdown(docs []*kindDoc) {
+	for _, d := range docs {
+		fmt.Printf("## %s\n\n`%s/%s` (CRD `%s`)\n\n", d.Kind, d.Group, d.Version, d.CRD)
+		fmt.Println("| Field | Type | Required | Description |")
+		fmt.Println("|-------|------|----------|-------------|")
+		for _, f := range d.Fields {
+			req := ""
+			if f.Required {
+				req = "yes"
+			}
+			desc := mdEscape(f.Description)
+			if f.Default != "" {
+				desc += " Default: `" + mdEscape(f.Default) + "`."
+			}
+			if len(f.Enum) > 0 {
+				desc += " One of: `" + mdEscape(strings.Join(f.Enum, "`, `")) + "`."
+			}
+			fmt.Printf("| `%s` | `%s` | %s | %s |\n", f.Path, mdEscape(f.Type), req, strings.TrimSpace(desc))
+		}
+		fmt.Println()
+	}
+}
+
+func printDiff(changes []change) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nSCHEMA DIFF\n%s\n", sep, sep)
+	if len(changes) == 0 {
+		fmt.Println("\n✅ No field changes")
+		return
+	}
+	icons := map[string]string{"added": "+", "removed": "-", "type": "~", "required": "!"}
+	kind := ""
+	for _, c := range changes {
+		if c.Kind != kind {
+			kind = c.Kind
+			fmt.Printf("\n%s\n", kind)
+		}
+		target := c.Path
+		if target == "" {
+			target = "(kind)"
+		}
+		switch c.Change {
+		case "added":
+			fmt.Printf("  %s %s <%s>\n", icons[c.Change], target, c.New)
+		case "removed":
+			fmt.Printf("  %s %s <%s>\n", icons[c.Change], target, c.Old)
+		default:
+			fmt.Printf("  %s %s %s: %s → %s\n", icons[c.Change], target, c.Change, c.Old, c.New)
+		}
+	}
+	fmt.Printf("\n%d changes\n", len(changes))
+}
+
+func main() {
+	file := flag.String("f", "", "Read CRDs from a file, directory or URL instead of the cluster")
+	group := flag.String("group", "", "API group (default: all *cluster.x-k8s.io groups)")
+	version := flag.String("api-version", "", "API version to document (default: storage version)")
+	depth := flag.Int("depth", 0, "Maximum field depth (0 = unlimited)")
+	full := flag.Bool("full", false, "Print full descriptions in text output")
+	diffFrom := flag.String("diff-from", "", "Compare against CRDs from this file, directory or URL (\"cluster\" for the live cluster)")
+	fromVersion := flag.String("from-version", "", "API version on the old side of a diff (default: storage version)")
+	format := flag.String("format", "text", "Output format: text, markdown, json")
+	output := flag.String("o", "", "Write JSON output to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [kind[.field.path]]\n\nRender recursive field documentation for CAPI and provider CRDs, or diff it between versions.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *file == "" || *diffFrom == "cluster" {
+		if kubectl.Find() == "" {
+			fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+			os.Exit(1)
+		}
+	}
+
+	crds, err := loadSource(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	target := flag.Arg(0)
+	docs, err := explain(crds, target, *group, *version, *depth)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(docs) == 0 {
+		fmt.Println("No matching CRDs found")
+		return
+	}
+
+	var result interface{} = docs
+	var changes []change
+	diffing := *diffFrom != "" || *fromVersion != ""
+	if diffing {
+		oldCRDs := crds
+		if *diffFrom != "" {
+			src := *diffFrom
+			if src == "cluster" {
+				src = ""
+			}
+			if oldCRDs, err = loadSource(src); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		oldDocs, err := explain(oldCRDs, target, *group, *fromVersion, *depth)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: old side: %v\n", err)
+			os.Exit(1)
+		}
+		changes = diff(oldDocs, docs)
+		result = changes
+	}
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+		return
+	}
+	switch {
+	case diffing:
+		printDiff(changes)
+	case *format == "markdown":
+		printMarkdown(docs)
+	default:
+		printText(docs, *full)
+	}
+}
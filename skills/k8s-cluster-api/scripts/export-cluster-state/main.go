@@ -9,15 +9,48 @@
 //	go run ./export-cluster-state -n my-cluster
 //	go run ./export-cluster-state -n my-cluster -o ./backup/ --include-secrets
 //	go run ./export-cluster-state --all-clusters -o ./backup/
+//	go run ./export-cluster-state -n my-cluster -o ./backup/ --pause
+//	go run ./export-cluster-state -n my-cluster -o ./backup/ --include-secrets --encrypt-age age1...
+//	CAPI_EXPORT_PASSPHRASE=... go run ./export-cluster-state -n my-cluster --include-secrets --encrypt-passphrase
+//	go run ./export-cluster-state --all -o ./backup-2/ --since-export ./backup-1/
+//	go run ./export-cluster-state -n my-cluster --archive my-cluster.tar.gz
+//	go run ./export-cluster-state -n my-cluster --include-secrets --secret-types kubeconfig,ca --exclude-kinds MachineSet
+//	go run ./export-cluster-state --all --selector env=prod --include-kinds Cluster,KubeadmControlPlane
+//	go run ./export-cluster-state --all -o s3://backups/capi --archive capi.tar.gz --keep-last 14
+//	go run ./export-cluster-state --all --watch --interval 6h -o /var/backups/capi --keep-last 28
+//	go run ./export-cluster-state --restore ./backup/ --dry-run
+//	go run ./export-cluster-state --restore ./backup/ --kubeconfig target.kubeconfig --wait
+//	go run ./export-cluster-state --restore ./backup/ --age-identity key.txt
+//	go run ./export-cluster-state --restore my-cluster.tar.gz --dry-run
 package main
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	kubectl "k8s-cluster-api-tools/internal/kubectl"
@@ -46,7 +79,50 @@ var managedFieldAnnotations = []string{
 	"kubectl.kubernetes.io/last-applied-configuration",
 }
 
+// resourceVersions records the resourceVersion of every exported object by
+// objectKey, before cleanResource strips it, for the export manifest.
+var resourceVersions = map[string]string{}
+
+// ownerKeys records the owners of every exported object by objectKey,
+// before cleanResource strips ownerReferences, for dependency ordering.
+var ownerKeys = map[string][]string{}
+
+// objectKey identifies an object across exports independently of its API
+// version, e.g. Cluster.cluster.x-k8s.io/prod/my-cluster.
+func objectKey(obj map[string]interface{}) string {
+	kind, _ := obj["kind"].(string)
+	av, _ := obj["apiVersion"].(string)
+	return refKey(av, kind, kubectl.GetString(obj, "metadata.namespace"), kubectl.GetString(obj, "metadata.name"))
+}
+
+// refKey builds an objectKey from a reference; groupOrAPIVersion may be an
+// apiVersion (group/version) or a v1beta2 apiGroup.
+func refKey(groupOrAPIVersion, kind, namespace, name string) string {
+	group := groupOrAPIVersion
+	if i := strings.Index(group, "/"); i >= 0 {
+		group = group[:i]
+	} else if strings.HasPrefix(group, "v1") {
+		group = "" // core apiVersion such as v1
+	}
+	if group != "" {
+		kind += "." + group
+	}
+	return kind + "/" + namespace + "/" + name
+}
+
 func cleanResource(resource map[string]interface{}) map[string]interface{} {
+	key := objectKey(resource)
+	if rv := kubectl.GetString(resource, "metadata.resourceVersion"); rv != "" {
+		resourceVersions[key] = rv
+	}
+	for _, ref := range kubectl.GetSlice(kubectl.GetMap(resource, "metadata"), "ownerReferences") {
+		if m, ok := ref.(map[string]interface{}); ok {
+			av, _ := m["apiVersion"].(string)
+			kind, _ := m["kind"].(string)
+			name, _ := m["name"].(string)
+			ownerKeys[key] = append(ownerKeys[key], refKey(av, kind, kubectl.GetString(resource, "metadata.namespace"), name))
+		}
+	}
 	cleaned := deepCopy(resource)
 
 	// Remove server-generated metadata
@@ -84,18 +160,39 @@ func deepCopy(in map[string]interface{}) map[string]interface{} {
 	return out
 }
 
-func getResources(resourceType, namespace, kubeconfig, clusterFilter string) []map[string]interface{} {
+// runKubectl runs kubectl against the given kubeconfig (or the current
+// context) and returns stdout, or stderr as the error.
+func runKubectl(kubeconfig string, timeout time.Duration, args ...string) (string, error) {
+	if kubeconfig != "" {
+		args = append(args, "--kubeconfig", kubeconfig)
+	}
+	ok, out, errMsg := kubectl.Run(args, timeout)
+	if !ok {
+		return out, fmt.Errorf("%s", strings.TrimSpace(errMsg))
+	}
+	return out, nil
+}
+
+func listJSON(kubeconfig string, args ...string) ([]map[string]interface{}, error) {
+	out, err := runKubectl(kubeconfig, kubectl.DefaultTimeout, args...)
+	if err != nil {
+		return nil, err
+	}
+	return kubectl.ParseItems(out)
+}
+
+func getResources(resourceType, namespace, kubeconfig, clusterFilter, selector string) []map[string]interface{} {
 	args := []string{"get", resourceType, "-o", "json"}
 	if namespace != "" {
 		args = append(args, "-n", namespace)
 	} else {
 		args = append(args, "--all-namespaces")
 	}
-	if kubeconfig != "" {
-		args = append(args, "--kubeconfig", kubeconfig)
+	if selector != "" {
+		args = append(args, "-l", selector)
 	}
 
-	items, err := kubectl.RunJSON(args...)
+	items, err := listJSON(kubeconfig, args...)
 	if err != nil {
 		return nil
 	}
@@ -106,14 +203,13 @@ func getResources(resourceType, namespace, kubeconfig, clusterFilter string) []m
 
 	var filtered []map[string]interface{}
 	for _, item := range items {
-		labels := kubectl.GetMap(item, "metadata", "labels")
-		clusterName, _ := labels["cluster.x-k8s.io/cluster-name"].(string)
+		clusterName := kubectl.Labels(item)["cluster.x-k8s.io/cluster-name"]
 
 		// Also check spec.clusterName for core resources
-		specCluster := kubectl.GetString(item, "spec", "clusterName")
+		specCluster := kubectl.GetString(item, "spec.clusterName")
 
 		// Check metadata.name for Cluster resources
-		name := kubectl.GetString(item, "metadata", "name")
+		name := kubectl.GetString(item, "metadata.name")
 		kind := kubectl.GetString(item, "kind")
 
 		if clusterName == clusterFilter || specCluster == clusterFilter ||
@@ -125,11 +221,8 @@ func getResources(resourceType, namespace, kubeconfig, clusterFilter string) []m
 }
 
 func discoverProviderTypes(namespace, kubeconfig string) []string {
-	args := []string{"api-resources", "--api-group=infrastructure.cluster.x-k8s.io", "-o", "name"}
-	if kubeconfig != "" {
-		args = append(args, "--kubeconfig", kubeconfig)
-	}
-	out, err := kubectl.Run(args...)
+	out, err := runKubectl(kubeconfig, kubectl.DefaultTimeout,
+		"api-resources", "--api-group=infrastructure.cluster.x-k8s.io", "-o", "name")
 	if err != nil {
 		return nil
 	}
@@ -144,28 +237,77 @@ func discoverProviderTypes(namespace, kubeconfig string) []string {
 	return types
 }
 
-func exportSecrets(namespace, kubeconfig, clusterName string, includeSecrets bool) []map[string]interface{} {
+// secretTypes are the classes accepted by --secret-types. CAPI names
+// cluster secrets <cluster>-<class>; bootstrap data secrets are owned by a
+// bootstrap config.
+var secretTypes = []string{"kubeconfig", "ca", "etcd", "sa", "proxy", "bootstrap", "other"}
+
+func secretType(secret map[string]interface{}) string {
+	name := kubectl.GetString(secret, "metadata.name")
+	for _, t := range []string{"kubeconfig", "ca", "etcd", "sa", "proxy"} {
+		if strings.HasSuffix(name, "-"+t) {
+			return t
+		}
+	}
+	for _, ref := range kubectl.GetSlice(kubectl.GetMap(secret, "metadata"), "ownerReferences") {
+		if m, ok := ref.(map[string]interface{}); ok {
+			if av, _ := m["apiVersion"].(string); strings.HasPrefix(av, "bootstrap.cluster.x-k8s.io/") {
+				return "bootstrap"
+			}
+		}
+	}
+	return "other"
+}
+
+// exportFilter narrows what is exported: --selector is passed to kubectl,
+// kinds and secret types are matched after listing. Empty sets allow all.
+type exportFilter struct {
+	Selector     string
+	IncludeKinds map[string]bool
+	ExcludeKinds map[string]bool
+	SecretTypes  map[string]bool
+}
+
+func (f exportFilter) kindAllowed(kind string) bool {
+	kind = strings.ToLower(kind)
+	if len(f.IncludeKinds) > 0 && !f.IncludeKinds[kind] {
+		return false
+	}
+	return !f.ExcludeKinds[kind]
+}
+
+// splitSet parses a comma-separated flag into a lowercase set.
+func splitSet(list string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
+
+func exportSecrets(namespace, kubeconfig, clusterName string, includeSecrets bool, enc *secretCipher, filter exportFilter) ([]map[string]interface{}, error) {
 	args := []string{"get", "secrets", "-o", "json"}
 	if namespace != "" {
 		args = append(args, "-n", namespace)
 	} else {
 		args = append(args, "--all-namespaces")
 	}
-	if kubeconfig != "" {
-		args = append(args, "--kubeconfig", kubeconfig)
+	if filter.Selector != "" {
+		args = append(args, "-l", filter.Selector)
 	}
 
-	items, err := kubectl.RunJSON(args...)
+	items, err := listJSON(kubeconfig, args...)
 	if err != nil {
-		return nil
+		return nil, nil
 	}
 
 	var secrets []map[string]interface{}
 	for _, item := range items {
-		labels := kubectl.GetMap(item, "metadata", "labels")
-		clusterLabel, _ := labels["cluster.x-k8s.io/cluster-name"].(string)
+		clusterLabel := kubectl.Labels(item)["cluster.x-k8s.io/cluster-name"]
 
-		ownerRefs := kubectl.GetSlice(item, "metadata", "ownerReferences")
+		ownerRefs := kubectl.GetSlice(kubectl.GetMap(item, "metadata"), "ownerReferences")
 		isCapiOwned := false
 		for _, ref := range ownerRefs {
 			if refMap, ok := ref.(map[string]interface{}); ok {
@@ -177,6 +319,10 @@ func exportSecrets(namespace, kubeconfig, clusterName string, includeSecrets boo
 			}
 		}
 
+		if len(filter.SecretTypes) > 0 && !filter.SecretTypes[secretType(item)] {
+			continue
+		}
+
 		if clusterLabel == clusterName || isCapiOwned {
 			cleaned := cleanResource(item)
 
@@ -186,11 +332,232 @@ func exportSecrets(namespace, kubeconfig, clusterName string, includeSecrets boo
 						data[k] = "REDACTED"
 					}
 				}
+			} else if enc != nil {
+				if err := enc.encryptSecret(cleaned); err != nil {
+					return nil, fmt.Errorf("encrypting %s: %w", objectRef(cleaned), err)
+				}
 			}
 			secrets = append(secrets, cleaned)
 		}
 	}
-	return secrets
+	return secrets, nil
+}
+
+// Encrypted Secret values are written as ENC[<scheme>,...] strings. kubectl
+// rejects them as invalid base64, so an encrypted export cannot be applied
+// without going through --restore.
+const (
+	encAge        = "ENC[age,"
+	encPassphrase = "ENC[pbkdf2-sha256-aes256gcm,"
+	pbkdf2Rounds  = 600000
+)
+
+// passphraseEnv names the environment variable read for --encrypt-passphrase
+// and when restoring passphrase-encrypted exports.
+const passphraseEnv = "CAPI_EXPORT_PASSPHRASE"
+
+// secretCipher encrypts Secret data on export, with age recipients or a
+// passphrase, and decrypts it again on restore.
+type secretCipher struct {
+	recipients []string
+	identity   string
+	passphrase string
+	salt       []byte
+	keys       map[string][]byte
+}
+
+func newPassphraseCipher(passphrase string) (*secretCipher, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &secretCipher{passphrase: passphrase, salt: salt, keys: map[string][]byte{}}, nil
+}
+
+func readPassphrase() (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+	fmt.Fprintf(os.Stderr, "Passphrase (or set %s): ", passphraseEnv)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if p := strings.TrimRight(line, "\r\n"); p != "" {
+		return p, nil
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return "", fmt.Errorf("empty passphrase")
+}
+
+// pbkdf2Key derives a 32-byte key with PBKDF2-HMAC-SHA256.
+func pbkdf2Key(passphrase string, salt []byte) []byte {
+	prf := hmac.New(sha256.New, []byte(passphrase))
+	prf.Write(salt)
+	prf.Write([]byte{0, 0, 0, 1})
+	u := prf.Sum(nil)
+	key := append([]byte(nil), u...)
+	for i := 1; i < pbkdf2Rounds; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+func (c *secretCipher) key(salt []byte) []byte {
+	k := string(salt)
+	if c.keys[k] == nil {
+		c.keys[k] = pbkdf2Key(c.passphrase, salt)
+	}
+	return c.keys[k]
+}
+
+// runTool runs an external CLI and returns its stdout, or stderr as the
+// error.
+func runTool(name string, input []byte, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, fmt.Errorf("%s not found in PATH", name)
+	}
+	cmd := exec.Command(name, args...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func runAge(input []byte, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("age"); err != nil {
+		return nil, fmt.Errorf("age not found in PATH (https://age-encryption.org)")
+	}
+	return runTool("age", input, args...)
+}
+
+func (c *secretCipher) encrypt(plain []byte) (string, error) {
+	b64 := base64.StdEncoding.EncodeToString
+	if len(c.recipients) > 0 {
+		var args []string
+		for _, r := range c.recipients {
+			args = append(args, "-r", r)
+		}
+		out, err := runAge(plain, args...)
+		if err != nil {
+			return "", err
+		}
+		return encAge + b64(out) + "]", nil
+	}
+	block, err := aes.NewCipher(c.key(c.salt))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, nonce, plain, nil)
+	return encPassphrase + b64(c.salt) + "," + b64(nonce) + "," + b64(sealed) + "]", nil
+}
+
+func (c *secretCipher) decrypt(value string) ([]byte, error) {
+	b64 := base64.StdEncoding.DecodeString
+	switch {
+	case strings.HasPrefix(value, encAge):
+		if c.identity == "" {
+			return nil, fmt.Errorf("encrypted with age, pass --age-identity")
+		}
+		data, err := b64(strings.TrimSuffix(strings.TrimPrefix(value, encAge), "]"))
+		if err != nil {
+			return nil, err
+		}
+		return runAge(data, "-d", "-i", c.identity)
+	case strings.HasPrefix(value, encPassphrase):
+		parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, encPassphrase), "]"), ",")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("malformed encrypted value")
+		}
+		var raw [3][]byte
+		for i, p := range parts {
+			b, err := b64(p)
+			if err != nil {
+				return nil, err
+			}
+			raw[i] = b
+		}
+		if c.passphrase == "" {
+			p, err := readPassphrase()
+			if err != nil {
+				return nil, err
+			}
+			c.passphrase = p
+		}
+		block, err := aes.NewCipher(c.key(raw[0]))
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		plain, err := gcm.Open(nil, raw[1], raw[2], nil)
+		if err != nil {
+			return nil, fmt.Errorf("wrong passphrase or corrupted value")
+		}
+		return plain, nil
+	}
+	return nil, fmt.Errorf("unknown encryption scheme")
+}
+
+func (c *secretCipher) encryptSecret(secret map[string]interface{}) error {
+	data := kubectl.GetMap(secret, "data")
+	for k, v := range data {
+		plain, err := base64.StdEncoding.DecodeString(fmt.Sprint(v))
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		enc, err := c.encrypt(plain)
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		data[k] = enc
+	}
+	return nil
+}
+
+func isEncrypted(secret map[string]interface{}) bool {
+	for _, v := range kubectl.GetMap(secret, "data") {
+		if s, _ := v.(string); strings.HasPrefix(s, "ENC[") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *secretCipher) decryptSecret(secret map[string]interface{}) error {
+	data := kubectl.GetMap(secret, "data")
+	for k, v := range data {
+		s, _ := v.(string)
+		if !strings.HasPrefix(s, "ENC[") {
+			continue
+		}
+		plain, err := c.decrypt(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		data[k] = base64.StdEncoding.EncodeToString(plain)
+	}
+	return nil
 }
 
 func exportReferencedResources(items []map[string]interface{}, namespace, kubeconfig string) []map[string]interface{} {
@@ -250,10 +617,7 @@ func exportReferencedResources(items []map[string]interface{}, namespace, kubeco
 			if ns != "" {
 				getArgs = append(getArgs, "-n", ns)
 			}
-			if kubeconfig != "" {
-				getArgs = append(getArgs, "--kubeconfig", kubeconfig)
-			}
-			out, err := kubectl.Run(getArgs...)
+			out, err := runKubectl(kubeconfig, kubectl.DefaultTimeout, getArgs...)
 			if err != nil {
 				continue
 			}
@@ -285,124 +649,1503 @@ func writeManifest(resources []map[string]interface{}, filePath string) error {
 	return os.WriteFile(filePath, []byte(content), 0644)
 }
 
-func main() {
-	clusterName := flag.String("n", "", "Cluster name to export (required unless --all)")
-	namespace := flag.String("ns", "", "Namespace to search")
-	kubeconfig := flag.String("kubeconfig", "", "Path to kubeconfig")
-	outputDir := flag.String("o", "", "Output directory (default: cluster-state-<timestamp>)")
-	allClusters := flag.Bool("all", false, "Export all clusters")
-	includeSecrets := flag.Bool("include-secrets", false, "Include secret data (default: redacted)")
-	includeRefs := flag.Bool("include-refs", true, "Include referenced infra/bootstrap objects")
-	singleFile := flag.Bool("single-file", false, "Write everything to one file")
+// Restore tiers, applied in order. Clusters are applied paused so that no
+// controller acts on a half-restored set; secrets go last because CAPI
+// controllers would otherwise regenerate CA and kubeconfig secrets.
+const (
+	tierNamespace = iota
+	tierClusterClass
+	tierTemplate
+	tierCluster
+	tierOwned
+	tierSecret
+)
 
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "CAPI Cluster State Exporter\nUsage: %s [flags]\n\nFlags:\n", os.Args[0])
-		flag.PrintDefaults()
-	}
-	flag.Parse()
+var tierNames = []string{"namespaces", "ClusterClasses", "templates", "Clusters", "owned objects", "secrets"}
 
-	if *clusterName == "" && !*allClusters {
-		fmt.Fprintln(os.Stderr, "Error: -n (cluster name) or --all required")
-		flag.Usage()
-		os.Exit(1)
+func restoreTier(obj map[string]interface{}) int {
+	kind, _ := obj["kind"].(string)
+	switch {
+	case kind == "Namespace":
+		return tierNamespace
+	case kind == "ClusterClass":
+		return tierClusterClass
+	case strings.HasSuffix(kind, "Template"):
+		return tierTemplate
+	case kind == "Cluster":
+		return tierCluster
+	case kind == "Secret":
+		return tierSecret
 	}
+	return tierOwned
+}
 
-	clusterFilter := *clusterName
-	if *allClusters {
-		clusterFilter = ""
-	}
+// refPaths lists where CAPI objects reference other objects; [] walks every
+// list item. ClusterClass topology references are handled separately.
+var refPaths = []string{
+	"spec.infrastructureRef",
+	"spec.controlPlaneRef",
+	"spec.bootstrap.configRef",
+	"spec.template.spec.infrastructureRef",
+	"spec.template.spec.bootstrap.configRef",
+	"spec.machineTemplate.infrastructureRef",
+	"spec.machineTemplate.spec.infrastructureRef",
+	"spec.remediationTemplate",
+	"spec.remediation.templateRef",
+	"spec.infrastructure.ref",
+	"spec.infrastructure.templateRef",
+	"spec.controlPlane.ref",
+	"spec.controlPlane.templateRef",
+	"spec.controlPlane.machineInfrastructure.ref",
+	"spec.controlPlane.machineInfrastructure.templateRef",
+	"spec.workers.machineDeployments[].template.bootstrap.ref",
+	"spec.workers.machineDeployments[].template.infrastructure.ref",
+	"spec.workers.machineDeployments[].bootstrap.templateRef",
+	"spec.workers.machineDeployments[].infrastructure.templateRef",
+	"spec.workers.machinePools[].template.bootstrap.ref",
+	"spec.workers.machinePools[].template.infrastructure.ref",
+	"spec.workers.machinePools[].bootstrap.templateRef",
+	"spec.workers.machinePools[].infrastructure.templateRef",
+}
 
-	if *outputDir == "" {
-		*outputDir = fmt.Sprintf("cluster-state-%s", time.Now().Format("20060102-150405"))
+// refsAt returns the reference maps found at path.
+func refsAt(obj interface{}, path string) []map[string]interface{} {
+	head, rest, _ := strings.Cut(path, ".")
+	m, ok := obj.(map[string]interface{})
+	if !ok {
+		return nil
 	}
-
-	fmt.Println("=== CAPI Cluster State Export ===")
-	if *allClusters {
-		fmt.Println("Mode: all clusters")
-	} else {
-		fmt.Printf("Cluster: %s\n", *clusterName)
+	if strings.HasSuffix(head, "[]") {
+		var out []map[string]interface{}
+		items, _ := m[strings.TrimSuffix(head, "[]")].([]interface{})
+		for _, item := range items {
+			out = append(out, refsAt(item, rest)...)
+		}
+		return out
 	}
+	if rest == "" {
+		if ref, ok := m[head].(map[string]interface{}); ok {
+			return []map[string]interface{}{ref}
+		}
+		return nil
+	}
+	return refsAt(m[head], rest)
+}
 
-	var allResources []map[string]interface{}
-
-	// Export CAPI resources
-	for _, rt := range capiResourceTypes {
-		items := getResources(rt, *namespace, *kubeconfig, clusterFilter)
-		if len(items) == 0 {
+// orderResources sorts resources topologically so that re-applying them in
+// order never creates an object before what it depends on: owners before
+// the objects they own, ClusterClasses and templates before the objects
+// that use them, and a referring object (Cluster, Machine) before the
+// instance it references (infrastructure cluster, bootstrap config), which
+// it owns once reconciled. Ties and cycles fall back to the restore tier,
+// then kind, namespace and name. Duplicate objects are dropped.
+func orderResources(resources []map[string]interface{}) []map[string]interface{} {
+	byKey := map[string]map[string]interface{}{}
+	var keys []string
+	for _, r := range resources {
+		key := objectKey(r)
+		if _, dup := byKey[key]; dup {
 			continue
 		}
-		fmt.Printf("  Found %d %s\n", len(items), rt)
-		for _, item := range items {
-			allResources = append(allResources, cleanResource(item))
+		byKey[key] = r
+		keys = append(keys, key)
+	}
+
+	after := map[string][]string{}
+	blockers := map[string]int{}
+	edges := map[[2]string]bool{}
+	addEdge := func(first, then string) {
+		e := [2]string{first, then}
+		if first == then || edges[e] || byKey[first] == nil {
+			return
+		}
+		edges[e] = true
+		after[first] = append(after[first], then)
+		blockers[then]++
+	}
+	for _, key := range keys {
+		obj := byKey[key]
+		ns := kubectl.GetString(obj, "metadata.namespace")
+		for _, owner := range ownerKeys[key] {
+			addEdge(owner, key)
+		}
+		if class := kubectl.GetString(obj, "spec.topology.class") + kubectl.GetString(obj, "spec.topology.classRef.name"); class != "" {
+			classNS := kubectl.GetString(obj, "spec.topology.classNamespace") + kubectl.GetString(obj, "spec.topology.classRef.namespace")
+			if classNS == "" {
+				classNS = ns
+			}
+			addEdge(refKey("cluster.x-k8s.io", "ClusterClass", classNS, class), key)
+		}
+		for _, path := range refPaths {
+			for _, ref := range refsAt(obj, path) {
+				kind, _ := ref["kind"].(string)
+				name, _ := ref["name"].(string)
+				group, _ := ref["apiVersion"].(string)
+				if group == "" {
+					group, _ = ref["apiGroup"].(string)
+				}
+				refNS, _ := ref["namespace"].(string)
+				if refNS == "" {
+					refNS = ns
+				}
+				target := refKey(group, kind, refNS, name)
+				if byKey[target] == nil {
+					continue
+				}
+				// An owned template is created after its owner even though
+				// the owner references it (ClusterClass and its templates).
+				if strings.HasSuffix(kind, "Template") || kind == "ClusterClass" {
+					owned := false
+					for _, o := range ownerKeys[target] {
+						owned = owned || o == key
+					}
+					if !owned {
+						addEdge(target, key)
+					}
+					continue
+				}
+				addEdge(key, target)
+			}
 		}
 	}
 
-	// Export provider resources
-	providerTypes := discoverProviderTypes(*namespace, *kubeconfig)
-	for _, pt := range providerTypes {
-		items := getResources(pt, *namespace, *kubeconfig, clusterFilter)
-		if len(items) == 0 {
-			continue
+	less := func(a, b string) bool {
+		ta, tb := restoreTier(byKey[a]), restoreTier(byKey[b])
+		if ta != tb {
+			return ta < tb
 		}
-		fmt.Printf("  Found %d %s (provider)\n", len(items), pt)
-		for _, item := range items {
-			allResources = append(allResources, cleanResource(item))
+		return a < b
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	done := map[string]bool{}
+	ordered := make([]map[string]interface{}, 0, len(keys))
+	for len(ordered) < len(keys) {
+		// Pick the first ready object; if a cycle blocks everything, take
+		// the first remaining one.
+		next := ""
+		for _, key := range keys {
+			if done[key] {
+				continue
+			}
+			if next == "" {
+				next = key
+			}
+			if blockers[key] == 0 {
+				next = key
+				break
+			}
+		}
+		done[next] = true
+		ordered = append(ordered, byKey[next])
+		for _, then := range after[next] {
+			blockers[then]--
 		}
 	}
+	return ordered
+}
 
-	// Export referenced resources
-	if *includeRefs {
-		refs := exportReferencedResources(allResources, *namespace, *kubeconfig)
-		if len(refs) > 0 {
-			fmt.Printf("  Found %d referenced resources\n", len(refs))
-			allResources = append(allResources, refs...)
+// readExport loads every YAML document from an export directory.
+func readExport(dir string) ([]map[string]interface{}, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.yaml files in %s", dir)
+	}
+	var objs []map[string]interface{}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var obj map[string]interface{}
+			if err := dec.Decode(&obj); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("%s: %w", f, err)
+			}
+			if obj["kind"] != nil {
+				objs = append(objs, obj)
+			}
 		}
 	}
+	return objs, nil
+}
 
-	// Export secrets
-	cn := clusterFilter
-	if cn == "" {
-		cn = ""
+func isRedacted(secret map[string]interface{}) bool {
+	for _, v := range kubectl.GetMap(secret, "data") {
+		if v == "REDACTED" {
+			return true
+		}
 	}
-	secrets := exportSecrets(*namespace, *kubeconfig, cn, *includeSecrets)
-	if len(secrets) > 0 {
-		fmt.Printf("  Found %d CAPI secrets\n", len(secrets))
-		allResources = append(allResources, secrets...)
+	return false
+}
+
+func objectRef(obj map[string]interface{}) string {
+	kind, _ := obj["kind"].(string)
+	name := kubectl.GetString(obj, "metadata.name")
+	if ns := kubectl.GetString(obj, "metadata.namespace"); ns != "" {
+		return fmt.Sprintf("%s %s/%s", kind, ns, name)
 	}
+	return fmt.Sprintf("%s %s", kind, name)
+}
 
-	if len(allResources) == 0 {
-		fmt.Println("\nNo resources found to export.")
-		os.Exit(0)
+// restore re-applies an export directory in dependency order. Clusters are
+// created paused and unpaused once everything else is in place, unless they
+// were paused when exported or keepPaused is set.
+func restore(dir, kubeconfig string, dryRun, keepPaused, wait bool, timeout time.Duration, ageIdentity string) error {
+	objs, err := readExport(dir)
+	if err != nil {
+		return err
 	}
 
-	// Write output
-	if *singleFile {
-		outFile := filepath.Join(*outputDir, "cluster-state.yaml")
-		if err := writeManifest(allResources, outFile); err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing file: %v\n", err)
-			os.Exit(1)
+	// Exports carry their dependency order in manifest.json; tiers below
+	// keep it within each tier.
+	if m, err := loadManifest(dir); err == nil {
+		pos := map[string]int{}
+		for i, key := range m.Order {
+			pos[key] = i + 1
 		}
-		fmt.Printf("\nExported %d resources to %s\n", len(allResources), outFile)
-	} else {
-		// Group by kind
-		groups := map[string][]map[string]interface{}{}
-		for _, r := range allResources {
-			kind, _ := r["kind"].(string)
-			if kind == "" {
-				kind = "unknown"
+		rank := func(obj map[string]interface{}) int {
+			if p := pos[objectKey(obj)]; p > 0 {
+				return p
 			}
-			groups[kind] = append(groups[kind], r)
+			return len(pos) + 1
 		}
+		sort.SliceStable(objs, func(i, j int) bool { return rank(objs[i]) < rank(objs[j]) })
+	}
 
-		for kind, items := range groups {
-			fileName := strings.ToLower(kind) + "s.yaml"
-			outFile := filepath.Join(*outputDir, fileName)
-			if err := writeManifest(items, outFile); err != nil {
-				fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", outFile, err)
+	secrets := &secretCipher{identity: ageIdentity, keys: map[string][]byte{}}
+	tiers := make([][]map[string]interface{}, len(tierNames))
+	namespaces := map[string]bool{}
+	var clusters []map[string]interface{}
+	var unpause []map[string]interface{}
+	for _, obj := range objs {
+		if ns := kubectl.GetString(obj, "metadata.namespace"); ns != "" {
+			namespaces[ns] = true
+		}
+		t := restoreTier(obj)
+		switch t {
+		case tierNamespace:
+			delete(namespaces, kubectl.GetString(obj, "metadata.name"))
+		case tierSecret:
+			if isRedacted(obj) {
+				fmt.Fprintf(os.Stderr, "Warning: skipping %s: data was redacted at export (use --include-secrets)\n", objectRef(obj))
 				continue
 			}
-			fmt.Printf("  Wrote %d %s → %s\n", len(items), kind, outFile)
+			if isEncrypted(obj) && !dryRun {
+				if err := secrets.decryptSecret(obj); err != nil {
+					return fmt.Errorf("decrypting %s: %w", objectRef(obj), err)
+				}
+			}
+		case tierCluster:
+			clusters = append(clusters, obj)
+			spec := kubectl.GetMap(obj, "spec")
+			if paused, _ := spec["paused"].(bool); !paused && !keepPaused {
+				unpause = append(unpause, obj)
+			}
+			spec["paused"] = true
+			obj["spec"] = spec
+		}
+		tiers[t] = append(tiers[t], obj)
+	}
+	var nsNames []string
+	for ns := range namespaces {
+		nsNames = append(nsNames, ns)
+	}
+	sort.Strings(nsNames)
+	for _, ns := range nsNames {
+		if _, err := runKubectl(kubeconfig, kubectl.DefaultTimeout, "get", "namespace", ns); err == nil {
+			continue
+		}
+		tiers[tierNamespace] = append(tiers[tierNamespace], map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": ns},
+		})
+	}
+
+	if dryRun {
+		fmt.Println("Dry run, nothing is applied. Restore plan:")
+	}
+	total := 0
+	for t, items := range tiers {
+		if len(items) == 0 {
+			continue
+		}
+		total += len(items)
+		fmt.Printf("\n[%d/%d] %s (%d)\n", t+1, len(tiers), tierNames[t], len(items))
+		if dryRun {
+			for _, obj := range items {
+				fmt.Printf("  %s\n", objectRef(obj))
+			}
+			continue
+		}
+		f, err := os.CreateTemp("", "restore-*.yaml")
+		if err != nil {
+			return err
+		}
+		err = writeManifest(items, f.Name())
+		f.Close()
+		if err == nil {
+			var out string
+			out, err = runKubectl(kubeconfig, 2*time.Minute, "apply", "-f", f.Name())
+			for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+				if line != "" {
+					fmt.Printf("  %s\n", line)
+				}
+			}
+		}
+		os.Remove(f.Name())
+		if err != nil {
+			if len(clusters) > 0 && t > tierCluster {
+				fmt.Fprintln(os.Stderr, "Restored Clusters are left paused.")
+			}
+			return fmt.Errorf("applying %s: %w", tierNames[t], err)
+		}
+	}
+	if dryRun {
+		if len(unpause) > 0 {
+			fmt.Printf("\nClusters would be created paused and unpaused afterwards: %d\n", len(unpause))
+		}
+		return nil
+	}
+
+	if len(unpause) > 0 {
+		fmt.Println("\nUnpausing Clusters")
+		for _, c := range unpause {
+			if _, err := runKubectl(kubeconfig, kubectl.DefaultTimeout, "patch", "clusters.cluster.x-k8s.io",
+				kubectl.GetString(c, "metadata.name"), "-n", kubectl.GetString(c, "metadata.namespace"),
+				"--type=merge", "-p", `{"spec":{"paused":false}}`); err != nil {
+				return fmt.Errorf("unpausing %s: %w", objectRef(c), err)
+			}
+			fmt.Printf("  %s unpaused\n", objectRef(c))
+		}
+	}
+
+	if wait {
+		fmt.Printf("\nWaiting up to %s for Clusters to become Ready\n", timeout)
+		failed := 0
+		for _, c := range unpause {
+			_, err := runKubectl(kubeconfig, timeout+30*time.Second, "wait", "--for=condition=Ready",
+				"clusters.cluster.x-k8s.io/"+kubectl.GetString(c, "metadata.name"),
+				"-n", kubectl.GetString(c, "metadata.namespace"), fmt.Sprintf("--timeout=%s", timeout))
+			if err != nil {
+				fmt.Printf("  %s not ready: %v\n", objectRef(c), err)
+				failed++
+				continue
+			}
+			fmt.Printf("  %s ready\n", objectRef(c))
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d cluster(s) not ready", failed)
+		}
+	}
+	fmt.Printf("\nRestored %d resources from %s\n", total, dir)
+	return nil
+}
+
+// manifestFile is written into every export and lets a later
+// --since-export run skip objects that did not change.
+const manifestFile = "manifest.json"
+
+type manifestEntry struct {
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	SHA256          string `json:"sha256"`
+}
+
+type exportManifest struct {
+	ExportedAt string                   `json:"exportedAt"`
+	Since      string                   `json:"since,omitempty"`
+	Objects    map[string]manifestEntry `json:"objects"`
+	Order      []string                 `json:"order"`
+}
+
+// exportChanges is written to changes.json by --since-export.
+type exportChanges struct {
+	Since     string   `json:"since"`
+	SinceTime string   `json:"sinceExportedAt"`
+	Added     []string `json:"added"`
+	Modified  []string `json:"modified"`
+	Deleted   []string `json:"deleted"`
+	Unchanged int      `json:"unchanged"`
+}
+
+func buildManifest(resources []map[string]interface{}) exportManifest {
+	m := exportManifest{ExportedAt: time.Now().UTC().Format(time.RFC3339), Objects: map[string]manifestEntry{}}
+	for _, r := range resources {
+		data, _ := json.Marshal(r)
+		sum := sha256.Sum256(data)
+		key := objectKey(r)
+		m.Objects[key] = manifestEntry{ResourceVersion: resourceVersions[key], SHA256: hex.EncodeToString(sum[:])}
+		m.Order = append(m.Order, key)
+	}
+	return m
+}
+
+func loadManifest(dir string) (exportManifest, error) {
+	var m exportManifest
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return m, fmt.Errorf("read previous export manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("parse %s: %w", filepath.Join(dir, manifestFile), err)
+	}
+	return m, nil
+}
+
+// diffManifest keeps the resources that are new or changed since prev. An
+// object is unchanged when its resourceVersion or its content hash matches;
+// the hash catches status-only updates, the resourceVersion re-encrypted
+// secrets whose ciphertext differs on every run.
+func diffManifest(prev, cur exportManifest, resources []map[string]interface{}) ([]map[string]interface{}, exportChanges) {
+	changes := exportChanges{SinceTime: prev.ExportedAt, Added: []string{}, Modified: []string{}, Deleted: []string{}}
+	var changed []map[string]interface{}
+	seen := map[string]bool{}
+	for _, r := range resources {
+		key := objectKey(r)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		old, ok := prev.Objects[key]
+		now := cur.Objects[key]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, key)
+		case old.SHA256 == now.SHA256 || (now.ResourceVersion != "" && old.ResourceVersion == now.ResourceVersion):
+			changes.Unchanged++
+			continue
+		default:
+			changes.Modified = append(changes.Modified, key)
+		}
+		changed = append(changed, r)
+	}
+	for key := range prev.Objects {
+		if _, ok := cur.Objects[key]; !ok {
+			changes.Deleted = append(changes.Deleted, key)
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Modified)
+	sort.Strings(changes.Deleted)
+	return changed, changes
+}
+
+func writeJSON(v interface{}, filePath string) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, append(data, '\n'), 0644)
+}
+
+// toolVersion is recorded in archive index.json files.
+const toolVersion = "v0.2.0"
+
+// archiveIndex is written as index.json into --archive tarballs.
+type archiveIndex struct {
+	Cluster     string            `json:"cluster,omitempty"`
+	Clusters    []string          `json:"clusters"`
+	ExportedAt  string            `json:"exportedAt"`
+	ToolVersion string            `json:"toolVersion"`
+	Since       string            `json:"since,omitempty"`
+	Resources   map[string]int    `json:"resources"`
+	Files       map[string]string `json:"files"`
+}
+
+func isArchive(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// writeArchive packs the files of an export directory together with
+// index.json and a SHA256SUMS file (sha256sum -c format) into a gzipped
+// tarball. It returns the number of files archived.
+func writeArchive(dir, archivePath string, index archiveIndex) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	files := map[string][]byte{}
+	var names []string
+	index.Files = map[string]string{}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return 0, err
+		}
+		sum := sha256.Sum256(data)
+		index.Files[e.Name()] = hex.EncodeToString(sum[:])
+		files[e.Name()] = data
+		names = append(names, e.Name())
+	}
+	indexData, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	files["index.json"] = append(indexData, '\n')
+	names = append(names, "index.json")
+
+	var sums strings.Builder
+	for _, name := range names {
+		sum := sha256.Sum256(files[name])
+		fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+	files["SHA256SUMS"] = []byte(sums.String())
+	names = append(names, "SHA256SUMS")
+
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(archivePath), ".archive-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			tmp.Close()
+			return 0, err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			tmp.Close()
+			return 0, err
+		}
+	}
+	for _, c := range []io.Closer{tw, gz, tmp} {
+		if err := c.Close(); err != nil {
+			return 0, err
+		}
+	}
+	return len(names), os.Rename(tmp.Name(), archivePath)
+}
+
+// extractArchive unpacks an --archive tarball into a temporary directory
+// and verifies every file against SHA256SUMS.
+func extractArchive(archivePath string) (string, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "cluster-state-restore-*")
+	if err != nil {
+		return "", err
+	}
+	fail := func(err error) (string, error) {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	tr := tar.NewReader(gz)
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Base(hdr.Name)
+		if name != hdr.Name {
+			return fail(fmt.Errorf("unexpected path %q in archive", hdr.Name))
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fail(err)
+		}
+		files[name] = data
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			return fail(err)
+		}
+	}
+
+	sums, ok := files["SHA256SUMS"]
+	if !ok {
+		return fail(fmt.Errorf("%s has no SHA256SUMS", archivePath))
+	}
+	listed := map[string]bool{"SHA256SUMS": true}
+	for _, line := range strings.Split(strings.TrimSpace(string(sums)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fail(fmt.Errorf("malformed SHA256SUMS line %q", line))
+		}
+		data, ok := files[fields[1]]
+		if !ok {
+			return fail(fmt.Errorf("%s listed in SHA256SUMS is missing", fields[1]))
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != fields[0] {
+			return fail(fmt.Errorf("checksum mismatch for %s", fields[1]))
+		}
+		listed[fields[1]] = true
+	}
+	for name := range files {
+		if !listed[name] {
+			return fail(fmt.Errorf("%s is not listed in SHA256SUMS", name))
+		}
+	}
+	return dir, nil
+}
+
+// snapshotPrefix names the snapshots uploaded to remote targets; --keep-last
+// only rotates entries with this prefix.
+const snapshotPrefix = "cluster-state-"
+
+// remoteTarget is an -o destination in object storage (s3://bucket/prefix,
+// gs://bucket/prefix or az://container/prefix). It drives the provider CLI
+// (aws, gcloud, az), so credentials are discovered the way that CLI does:
+// AWS_PROFILE or AWS_ACCESS_KEY_ID, GOOGLE_APPLICATION_CREDENTIALS or gcloud
+// auth, AZURE_STORAGE_ACCOUNT with a key, SAS token or az login.
+type remoteTarget struct {
+	Scheme string
+	Bucket string
+	Prefix string
+}
+
+func parseRemoteTarget(out string) (*remoteTarget, error) {
+	scheme, rest, ok := strings.Cut(out, "://")
+	if !ok {
+		return nil, nil
+	}
+	switch scheme {
+	case "s3", "gs", "az":
+	default:
+		return nil, fmt.Errorf("unsupported output URL scheme %q (use s3://, gs:// or az://)", scheme)
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("missing bucket in %s", out)
+	}
+	t := &remoteTarget{Scheme: scheme, Bucket: bucket, Prefix: strings.Trim(prefix, "/")}
+	tool := map[string]string{"s3": "aws", "gs": "gcloud", "az": "az"}[scheme]
+	if _, err := exec.LookPath(tool); err != nil {
+		return nil, fmt.Errorf("%s:// targets need the %s CLI in PATH", scheme, tool)
+	}
+	if scheme == "az" && os.Getenv("AZURE_STORAGE_ACCOUNT") == "" && os.Getenv("AZURE_STORAGE_CONNECTION_STRING") == "" {
+		return nil, fmt.Errorf("az:// targets need AZURE_STORAGE_ACCOUNT or AZURE_STORAGE_CONNECTION_STRING")
+	}
+	return t, nil
+}
+
+// key returns the object key of name below the target prefix.
+func (t *remoteTarget) key(name string) string {
+	if t.Prefix == "" {
+		return name
+	}
+	return t.Prefix + "/" + name
+}
+
+func (t *remoteTarget) url(name string) string {
+	return t.Scheme + "://" + t.Bucket + "/" + t.key(name)
+}
+
+func (t *remoteTarget) az(args ...string) ([]byte, error) {
+	args = append(args, "--only-show-errors")
+	if os.Getenv("AZURE_STORAGE_KEY") == "" && os.Getenv("AZURE_STORAGE_SAS_TOKEN") == "" &&
+		os.Getenv("AZURE_STORAGE_CONNECTION_STRING") == "" {
+		args = append(args, "--auth-mode", "login")
+	}
+	return runTool("az", nil, append([]string{"storage", "blob"}, args...)...)
+}
+
+func (t *remoteTarget) uploadFile(local, name string) error {
+	var err error
+	switch t.Scheme {
+	case "s3":
+		_, err = runTool("aws", nil, "s3", "cp", "--only-show-errors", local, t.url(name))
+	case "gs":
+		_, err = runTool("gcloud", nil, "storage", "cp", local, t.url(name))
+	case "az":
+		_, err = t.az("upload", "--container-name", t.Bucket, "--name", t.key(name), "--file", local, "--overwrite")
+	}
+	return err
+}
+
+// upload copies a file, or every file of a directory, to name.
+func (t *remoteTarget) upload(local, name string) (int, error) {
+	info, err := os.Stat(local)
+	if err != nil {
+		return 0, err
+	}
+	if !info.IsDir() {
+		return 1, t.uploadFile(local, name)
+	}
+	entries, err := os.ReadDir(local)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if err := t.uploadFile(filepath.Join(local, e.Name()), name+"/"+e.Name()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// list returns the entries directly below the prefix; directories end in /.
+func (t *remoteTarget) list() ([]string, error) {
+	var names []string
+	switch t.Scheme {
+	case "s3":
+		out, err := runTool("aws", nil, "s3", "ls", t.url("")+"/")
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				names = append(names, fields[len(fields)-1])
+			}
+		}
+	case "gs":
+		out, err := runTool("gcloud", nil, "storage", "ls", t.url("")+"/")
+		if err != nil {
+			return nil, err
+		}
+		base := strings.TrimSuffix(t.url(""), "/") + "/"
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			if name := strings.TrimPrefix(strings.TrimSpace(line), base); name != "" {
+				names = append(names, name)
+			}
+		}
+	case "az":
+		out, err := t.az("list", "--container-name", t.Bucket, "--prefix", t.key(""), "--delimiter", "/",
+			"--query", "[].name", "-o", "tsv")
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			if name := strings.TrimPrefix(strings.TrimSpace(line), t.key("")); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// remove deletes an entry returned by list.
+func (t *remoteTarget) remove(name string) error {
+	dir := strings.HasSuffix(name, "/")
+	var err error
+	switch t.Scheme {
+	case "s3":
+		args := []string{"s3", "rm", "--only-show-errors", t.url(name)}
+		if dir {
+			args = append(args, "--recursive")
+		}
+		_, err = runTool("aws", nil, args...)
+	case "gs":
+		args := []string{"storage", "rm", t.url(name)}
+		if dir {
+			args = []string{"storage", "rm", "-r", t.url(name)}
+		}
+		_, err = runTool("gcloud", nil, args...)
+	case "az":
+		pattern := t.key(name)
+		if dir {
+			pattern += "*"
+		}
+		_, err = t.az("delete-batch", "--source", t.Bucket, "--pattern", pattern)
+	}
+	return err
+}
+
+// rotate keeps the newest keep snapshots below the target and deletes the
+// rest. Snapshot names embed their timestamp, so name order is age order.
+func (t *remoteTarget) rotate(keep int) ([]string, error) {
+	names, err := t.list()
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []string
+	for _, name := range names {
+		if strings.HasPrefix(name, snapshotPrefix) {
+			snapshots = append(snapshots, name)
+		}
+	}
+	sort.Strings(snapshots)
+	var removed []string
+	for len(snapshots) > keep {
+		if err := t.remove(snapshots[0]); err != nil {
+			return removed, err
+		}
+		removed = append(removed, snapshots[0])
+		snapshots = snapshots[1:]
+	}
+	return removed, nil
+}
+
+// rotateLocal keeps the newest keep snapshots (directories or files named
+// cluster-state-<timestamp>...) in dir and removes the rest.
+func rotateLocal(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), snapshotPrefix) {
+			snapshots = append(snapshots, e.Name())
+		}
+	}
+	sort.Strings(snapshots)
+	var removed []string
+	for len(snapshots) > keep {
+		path := filepath.Join(dir, snapshots[0])
+		if err := os.RemoveAll(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+		snapshots = snapshots[1:]
+	}
+	return removed, nil
+}
+
+// watchMetrics is served on /metrics in --watch mode, in the Prometheus
+// text format.
+type watchMetrics struct {
+	mu          sync.Mutex
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastOK      bool
+	duration    time.Duration
+	successes   int
+	failures    int
+}
+
+func (m *watchMetrics) record(start time.Time, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastRun, m.lastOK, m.duration = start, ok, time.Since(start)
+	if ok {
+		m.lastSuccess = start
+		m.successes++
+	} else {
+		m.failures++
+	}
+}
+
+func (m *watchMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	unix := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.Unix()
+	}
+	ok := 0
+	if m.lastOK {
+		ok = 1
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP capi_export_last_success_timestamp_seconds Start time of the last successful export.\n")
+	fmt.Fprintf(w, "# TYPE capi_export_last_success_timestamp_seconds gauge\n")
+	fmt.Fprintf(w, "capi_export_last_success_timestamp_seconds %d\n", unix(m.lastSuccess))
+	fmt.Fprintf(w, "# HELP capi_export_last_run_timestamp_seconds Start time of the last export.\n")
+	fmt.Fprintf(w, "# TYPE capi_export_last_run_timestamp_seconds gauge\n")
+	fmt.Fprintf(w, "capi_export_last_run_timestamp_seconds %d\n", unix(m.lastRun))
+	fmt.Fprintf(w, "# HELP capi_export_last_run_success Whether the last export succeeded.\n")
+	fmt.Fprintf(w, "# TYPE capi_export_last_run_success gauge\n")
+	fmt.Fprintf(w, "capi_export_last_run_success %d\n", ok)
+	fmt.Fprintf(w, "# HELP capi_export_last_duration_seconds Duration of the last export.\n")
+	fmt.Fprintf(w, "# TYPE capi_export_last_duration_seconds gauge\n")
+	fmt.Fprintf(w, "capi_export_last_duration_seconds %.3f\n", m.duration.Seconds())
+	fmt.Fprintf(w, "# HELP capi_export_runs_total Exports run, by result.\n")
+	fmt.Fprintf(w, "# TYPE capi_export_runs_total counter\n")
+	fmt.Fprintf(w, "capi_export_runs_total{result=\"success\"} %d\n", m.successes)
+	fmt.Fprintf(w, "capi_export_runs_total{result=\"failure\"} %d\n", m.failures)
+}
+
+// watchOptions configures --watch mode.
+type watchOptions struct {
+	Interval    time.Duration
+	Root        string // local snapshot directory or remote URL
+	ArchiveDir  string
+	KeepLast    int
+	MetricsAddr string
+}
+
+// watch runs an export every interval until interrupted. Each run is a
+// child process of this binary with the same flags, so a failed or paused
+// export behaves exactly like a one-off run; snapshots are written to
+// <root>/cluster-state-<timestamp> (or <archive-dir>/...tar.gz) and rotated
+// with --keep-last.
+func watch(opts watchOptions) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	skip := map[string]bool{"watch": true, "interval": true, "metrics-addr": true, "o": true, "archive": true}
+	remote, err := parseRemoteTarget(opts.Root)
+	if err != nil {
+		return err
+	}
+	if remote == nil {
+		skip["keep-last"] = true // rotated here
+	}
+	var base []string
+	flag.Visit(func(f *flag.Flag) {
+		if !skip[f.Name] {
+			base = append(base, fmt.Sprintf("-%s=%s", f.Name, f.Value.String()))
+		}
+	})
+
+	env := os.Environ()
+	if isSet("encrypt-passphrase") && os.Getenv(passphraseEnv) == "" {
+		pass, err := readPassphrase()
+		if err != nil {
+			return err
+		}
+		env = append(env, passphraseEnv+"="+pass)
+	}
+
+	metrics := &watchMetrics{}
+	if opts.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		ln, err := net.Listen("tcp", opts.MetricsAddr)
+		if err != nil {
+			return fmt.Errorf("metrics listener: %w", err)
+		}
+		go http.Serve(ln, mux)
+		fmt.Printf("Serving metrics on http://%s/metrics\n", ln.Addr())
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	for {
+		start := time.Now()
+		snapshot := snapshotPrefix + start.Format("20060102-150405")
+		args := append([]string{}, base...)
+		if remote != nil {
+			args = append(args, "-o", opts.Root)
+		} else {
+			args = append(args, "-o", filepath.Join(opts.Root, snapshot))
+		}
+		if opts.ArchiveDir != "" {
+			args = append(args, "--archive", filepath.Join(opts.ArchiveDir, snapshot+".tar.gz"))
+		}
+		fmt.Printf("\n=== %s: snapshot %s ===\n", start.Format(time.RFC3339), snapshot)
+
+		cmd := exec.Command(self, args...)
+		cmd.Stdout, cmd.Stderr, cmd.Env = os.Stdout, os.Stderr, env
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		var runErr error
+		select {
+		case runErr = <-done:
+		case sig := <-sigs:
+			// Let the running export unpause and clean up before exiting.
+			cmd.Process.Signal(sig)
+			<-done
+			return nil
+		}
+		metrics.record(start, runErr == nil)
+		if runErr != nil {
+			fmt.Fprintf(os.Stderr, "Snapshot %s failed: %v\n", snapshot, runErr)
+		} else if remote == nil && opts.KeepLast > 0 {
+			for _, dir := range []string{opts.Root, opts.ArchiveDir} {
+				if dir == "" {
+					continue
+				}
+				removed, err := rotateLocal(dir, opts.KeepLast)
+				for _, r := range removed {
+					fmt.Printf("  Removed old snapshot %s\n", r)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error rotating snapshots in %s: %v\n", dir, err)
+				}
+			}
+		}
+
+		next := start.Add(opts.Interval)
+		fmt.Printf("Next snapshot at %s\n", next.Format(time.RFC3339))
+		select {
+		case <-time.After(time.Until(next)):
+		case <-sigs:
+			return nil
+		}
+	}
+}
+
+// isSet reports whether a flag was given on the command line.
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// setPaused patches spec.paused on a Cluster.
+func setPaused(kubeconfig string, cluster map[string]interface{}, paused bool) error {
+	_, err := runKubectl(kubeconfig, kubectl.DefaultTimeout, "patch", "clusters.cluster.x-k8s.io",
+		kubectl.GetString(cluster, "metadata.name"), "-n", kubectl.GetString(cluster, "metadata.namespace"),
+		"--type=merge", "-p", fmt.Sprintf(`{"spec":{"paused":%t}}`, paused))
+	return err
+}
+
+// pauseClusters pauses every Cluster selected for export that is not paused
+// yet, as clusterctl move does, so controllers stop changing objects while
+// they are read. It returns the Clusters it paused, also on error.
+func pauseClusters(namespace, kubeconfig, clusterFilter string) ([]map[string]interface{}, error) {
+	var paused []map[string]interface{}
+	for _, c := range getResources("clusters.cluster.x-k8s.io", namespace, kubeconfig, clusterFilter, "") {
+		if p, _ := kubectl.GetNested(c, "spec.paused").(bool); p {
+			continue
+		}
+		if err := setPaused(kubeconfig, c, true); err != nil {
+			return paused, fmt.Errorf("pausing %s: %w", objectRef(c), err)
+		}
+		fmt.Printf("  Paused %s\n", objectRef(c))
+		paused = append(paused, c)
+	}
+	return paused, nil
+}
+
+func main() {
+	clusterName := flag.String("n", "", "Cluster name to export (required unless --all)")
+	namespace := flag.String("ns", "", "Namespace to search")
+	kubeconfig := flag.String("kubeconfig", "", "Path to kubeconfig")
+	outputDir := flag.String("o", "", "Output directory or s3://, gs://, az:// URL (default: cluster-state-<timestamp>)")
+	allClusters := flag.Bool("all", false, "Export all clusters")
+	includeSecrets := flag.Bool("include-secrets", false, "Include secret data (default: redacted)")
+	includeRefs := flag.Bool("include-refs", true, "Include referenced infra/bootstrap objects")
+	singleFile := flag.Bool("single-file", false, "Write everything to one file")
+	restoreDir := flag.String("restore", "", "Re-apply an export directory instead of exporting")
+	dryRun := flag.Bool("dry-run", false, "With --restore, print the restore plan without applying")
+	keepPaused := flag.Bool("keep-paused", false, "With --restore, leave restored Clusters paused")
+	wait := flag.Bool("wait", false, "With --restore, wait for restored Clusters to become Ready")
+	timeout := flag.Duration("timeout", 15*time.Minute, "How long --wait waits for each Cluster")
+	pause := flag.Bool("pause", false, "Pause exported Clusters while exporting and unpause afterwards")
+	skipUnpause := flag.Bool("skip-unpause-on-error", false, "With --pause, leave Clusters paused if the export fails")
+	encryptAge := flag.String("encrypt-age", "", "With --include-secrets, encrypt secret data to these age recipients (comma-separated)")
+	encryptPassphrase := flag.Bool("encrypt-passphrase", false, "With --include-secrets, encrypt secret data with a passphrase (read from $"+passphraseEnv+" or stdin)")
+	keepLast := flag.Int("keep-last", 0, "With --watch or an s3://, gs:// or az:// -o, keep only the newest N snapshots")
+	archive := flag.String("archive", "", "Also pack the export into this .tar.gz with index.json and SHA256SUMS (with --watch: a directory for timestamped archives)")
+	watchMode := flag.Bool("watch", false, "Export every --interval into timestamped snapshots under -o")
+	interval := flag.Duration("interval", 6*time.Hour, "Time between --watch snapshots")
+	metricsAddr := flag.String("metrics-addr", ":9090", "With --watch, serve /metrics on this address (empty disables)")
+	includeKinds := flag.String("include-kinds", "", "Only export these kinds (comma-separated, e.g. Cluster,KubeadmControlPlane)")
+	excludeKinds := flag.String("exclude-kinds", "", "Do not export these kinds (comma-separated)")
+	selector := flag.String("selector", "", "Label selector passed to kubectl when listing resources and secrets")
+	secretTypesFlag := flag.String("secret-types", "", "Only export these secret classes: "+strings.Join(secretTypes, ","))
+	sinceExport := flag.String("since-export", "", "Only write objects changed since the export in this directory")
+	ageIdentity := flag.String("age-identity", "", "With --restore, age identity file to decrypt secrets")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "CAPI Cluster State Exporter\nUsage: %s [flags]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *restoreDir != "" {
+		fmt.Println("=== CAPI Cluster State Restore ===")
+		tempRestore := ""
+		if isArchive(*restoreDir) {
+			dir, err := extractArchive(*restoreDir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			tempRestore = dir
+			fmt.Printf("Verified checksums of %s\n", *restoreDir)
+			*restoreDir = dir
+		}
+		err := restore(*restoreDir, *kubeconfig, *dryRun, *keepPaused, *wait, *timeout, *ageIdentity)
+		if tempRestore != "" {
+			os.RemoveAll(tempRestore)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *clusterName == "" && !*allClusters {
+		fmt.Fprintln(os.Stderr, "Error: -n (cluster name) or --all required")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	filter := exportFilter{
+		Selector:     *selector,
+		IncludeKinds: splitSet(*includeKinds),
+		ExcludeKinds: splitSet(*excludeKinds),
+		SecretTypes:  splitSet(*secretTypesFlag),
+	}
+	for t := range filter.SecretTypes {
+		valid := false
+		for _, st := range secretTypes {
+			valid = valid || t == st
+		}
+		if !valid {
+			fmt.Fprintf(os.Stderr, "Error: unknown secret type %q (valid: %s)\n", t, strings.Join(secretTypes, ", "))
+			os.Exit(1)
+		}
+	}
+
+	if *watchMode {
+		if *interval <= 0 {
+			fmt.Fprintln(os.Stderr, "Error: --interval must be positive")
+			os.Exit(1)
+		}
+		root := *outputDir
+		if root == "" {
+			root = "snapshots"
+		}
+		err := watch(watchOptions{
+			Interval:    *interval,
+			Root:        root,
+			ArchiveDir:  *archive,
+			KeepLast:    *keepLast,
+			MetricsAddr: *metricsAddr,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var secretEnc *secretCipher
+	if *encryptAge != "" || *encryptPassphrase {
+		if !*includeSecrets {
+			fmt.Fprintln(os.Stderr, "Error: --encrypt-age and --encrypt-passphrase require --include-secrets")
+			os.Exit(1)
+		}
+		if *encryptAge != "" && *encryptPassphrase {
+			fmt.Fprintln(os.Stderr, "Error: use either --encrypt-age or --encrypt-passphrase")
+			os.Exit(1)
+		}
+		if *encryptAge != "" {
+			secretEnc = &secretCipher{}
+			for _, r := range strings.Split(*encryptAge, ",") {
+				if r = strings.TrimSpace(r); r != "" {
+					secretEnc.recipients = append(secretEnc.recipients, r)
+				}
+			}
+		} else {
+			pass, err := readPassphrase()
+			if err == nil {
+				secretEnc, err = newPassphraseCipher(pass)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	clusterFilter := *clusterName
+	if *allClusters {
+		clusterFilter = ""
+	}
+
+	// Remote targets, and --archive without -o, stage the export in a
+	// temporary directory.
+	remote, err := parseRemoteTarget(*outputDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *keepLast > 0 && remote == nil {
+		fmt.Fprintln(os.Stderr, "Error: --keep-last needs an s3://, gs:// or az:// output")
+		os.Exit(1)
+	}
+	snapshot := snapshotPrefix + time.Now().Format("20060102-150405")
+	tempOutput := ""
+	if remote != nil {
+		*outputDir = ""
+	}
+	if (*archive != "" || remote != nil) && *outputDir == "" {
+		dir, err := os.MkdirTemp("", "cluster-state-*")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		tempOutput, *outputDir = dir, dir
+	}
+	if *outputDir == "" {
+		*outputDir = fmt.Sprintf("cluster-state-%s", time.Now().Format("20060102-150405"))
+	}
+
+	fmt.Println("=== CAPI Cluster State Export ===")
+	if *allClusters {
+		fmt.Println("Mode: all clusters")
+	} else {
+		fmt.Printf("Cluster: %s\n", *clusterName)
+	}
+
+	// With --pause every exit path goes through exit so Clusters are
+	// unpaused again, unless the export failed and --skip-unpause-on-error
+	// asks to keep them paused for inspection.
+	var paused []map[string]interface{}
+	pausedByExport := map[string]bool{}
+	exit := func(code int) {
+		if tempOutput != "" {
+			os.RemoveAll(tempOutput)
+		}
+		if len(paused) > 0 {
+			if code != 0 && *skipUnpause {
+				fmt.Fprintf(os.Stderr, "Leaving %d Cluster(s) paused (--skip-unpause-on-error)\n", len(paused))
+				for _, c := range paused {
+					fmt.Fprintf(os.Stderr, "  kubectl patch cluster %s -n %s --type=merge -p '{\"spec\":{\"paused\":false}}'\n",
+						kubectl.GetString(c, "metadata.name"), kubectl.GetString(c, "metadata.namespace"))
+				}
+			} else {
+				for _, c := range paused {
+					if err := setPaused(*kubeconfig, c, false); err != nil {
+						fmt.Fprintf(os.Stderr, "Error unpausing %s: %v\n", objectRef(c), err)
+						code = 1
+						continue
+					}
+					fmt.Printf("  Unpaused %s\n", objectRef(c))
+				}
+			}
+		}
+		os.Exit(code)
+	}
+	if *pause {
+		var err error
+		paused, err = pauseClusters(*namespace, *kubeconfig, clusterFilter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		for _, c := range paused {
+			pausedByExport[kubectl.GetString(c, "metadata.namespace")+"/"+kubectl.GetString(c, "metadata.name")] = true
+		}
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			fmt.Fprintln(os.Stderr, "\nInterrupted")
+			exit(130)
+		}()
+	}
+
+	var allResources []map[string]interface{}
+
+	// Export CAPI resources
+	for _, rt := range capiResourceTypes {
+		items := getResources(rt, *namespace, *kubeconfig, clusterFilter, filter.Selector)
+		if len(items) == 0 {
+			continue
+		}
+		fmt.Printf("  Found %d %s\n", len(items), rt)
+		for _, item := range items {
+			cleaned := cleanResource(item)
+			// Record the Cluster as it was before --pause touched it.
+			if cleaned["kind"] == "Cluster" && pausedByExport[kubectl.GetString(cleaned, "metadata.namespace")+"/"+kubectl.GetString(cleaned, "metadata.name")] {
+				delete(kubectl.GetMap(cleaned, "spec"), "paused")
+			}
+			allResources = append(allResources, cleaned)
+		}
+	}
+
+	// Export provider resources
+	providerTypes := discoverProviderTypes(*namespace, *kubeconfig)
+	for _, pt := range providerTypes {
+		items := getResources(pt, *namespace, *kubeconfig, clusterFilter, filter.Selector)
+		if len(items) == 0 {
+			continue
+		}
+		fmt.Printf("  Found %d %s (provider)\n", len(items), pt)
+		for _, item := range items {
+			allResources = append(allResources, cleanResource(item))
+		}
+	}
+
+	// Export referenced resources
+	if *includeRefs {
+		refs := exportReferencedResources(allResources, *namespace, *kubeconfig)
+		if len(refs) > 0 {
+			fmt.Printf("  Found %d referenced resources\n", len(refs))
+			allResources = append(allResources, refs...)
+		}
+	}
+
+	// Export secrets
+	cn := clusterFilter
+	if cn == "" {
+		cn = ""
+	}
+	var secrets []map[string]interface{}
+	if filter.kindAllowed("Secret") {
+		secrets, err = exportSecrets(*namespace, *kubeconfig, cn, *includeSecrets, secretEnc, filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	}
+	if len(secrets) > 0 {
+		fmt.Printf("  Found %d CAPI secrets\n", len(secrets))
+		allResources = append(allResources, secrets...)
+	}
+
+	if len(filter.IncludeKinds) > 0 || len(filter.ExcludeKinds) > 0 {
+		kept := allResources[:0]
+		for _, r := range allResources {
+			if kind, _ := r["kind"].(string); filter.kindAllowed(kind) {
+				kept = append(kept, r)
+			}
+		}
+		if dropped := len(allResources) - len(kept); dropped > 0 {
+			fmt.Printf("  Skipped %d resources by kind filter\n", dropped)
+		}
+		allResources = kept
+	}
+
+	if len(allResources) == 0 {
+		fmt.Println("\nNo resources found to export.")
+		exit(0)
+	}
+
+	allResources = orderResources(allResources)
+	manifest := buildManifest(allResources)
+	if *sinceExport != "" {
+		prev, err := loadManifest(*sinceExport)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		var changes exportChanges
+		allResources, changes = diffManifest(prev, manifest, allResources)
+		changes.Since = *sinceExport
+		manifest.Since = *sinceExport
+		fmt.Printf("\nSince %s: %d added, %d modified, %d deleted, %d unchanged\n", *sinceExport,
+			len(changes.Added), len(changes.Modified), len(changes.Deleted), changes.Unchanged)
+		if err := writeJSON(changes, filepath.Join(*outputDir, "changes.json")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing changes.json: %v\n", err)
+			exit(1)
+		}
+	}
+	if err := writeJSON(manifest, filepath.Join(*outputDir, manifestFile)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", manifestFile, err)
+		exit(1)
+	}
+	// Write output
+	if len(allResources) == 0 {
+		fmt.Printf("\nNo changes, wrote %s\n", filepath.Join(*outputDir, manifestFile))
+	} else if *singleFile {
+		outFile := filepath.Join(*outputDir, "cluster-state.yaml")
+		if err := writeManifest(allResources, outFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing file: %v\n", err)
+			exit(1)
+		}
+		fmt.Printf("\nExported %d resources to %s\n", len(allResources), outFile)
+	} else {
+		// Group by kind; files are numbered by the position of each kind's
+		// first object in dependency order, so applying them in name order
+		// (kubectl apply -f <dir>) respects the ordering.
+		groups := map[string][]map[string]interface{}{}
+		var kinds []string
+		for _, r := range allResources {
+			kind, _ := r["kind"].(string)
+			if kind == "" {
+				kind = "unknown"
+			}
+			if groups[kind] == nil {
+				kinds = append(kinds, kind)
+			}
+			groups[kind] = append(groups[kind], r)
+		}
+
+		writeErrors := 0
+		for i, kind := range kinds {
+			items := groups[kind]
+			fileName := fmt.Sprintf("%02d-%ss.yaml", i+1, strings.ToLower(kind))
+			outFile := filepath.Join(*outputDir, fileName)
+			if err := writeManifest(items, outFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", outFile, err)
+				writeErrors++
+				continue
+			}
+			fmt.Printf("  Wrote %d %s → %s\n", len(items), kind, outFile)
 		}
 		fmt.Printf("\nExported %d resources to %s/\n", len(allResources), *outputDir)
+		if writeErrors > 0 {
+			exit(1)
+		}
+	}
+
+	if *archive != "" {
+		index := archiveIndex{
+			Cluster:     *clusterName,
+			Clusters:    []string{},
+			ExportedAt:  manifest.ExportedAt,
+			ToolVersion: toolVersion,
+			Since:       manifest.Since,
+			Resources:   map[string]int{},
+		}
+		for _, r := range allResources {
+			kind, _ := r["kind"].(string)
+			index.Resources[kind]++
+			if kind == "Cluster" {
+				index.Clusters = append(index.Clusters, kubectl.GetString(r, "metadata.namespace")+"/"+kubectl.GetString(r, "metadata.name"))
+			}
+		}
+		files, err := writeArchive(*outputDir, *archive, index)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing archive: %v\n", err)
+			exit(1)
+		}
+		fmt.Printf("Archived %d files to %s\n", files, *archive)
+	}
+
+	if remote != nil {
+		// With --archive only the archive is uploaded.
+		src, name := *outputDir, snapshot
+		if *archive != "" {
+			src, name = *archive, snapshot+".tar.gz"
+		}
+		n, err := remote.upload(src, name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error uploading to %s: %v\n", remote.url(name), err)
+			exit(1)
+		}
+		fmt.Printf("Uploaded %d file(s) to %s\n", n, remote.url(name))
+		if *keepLast > 0 {
+			removed, err := remote.rotate(*keepLast)
+			for _, r := range removed {
+				fmt.Printf("  Removed old snapshot %s\n", remote.url(r))
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error rotating snapshots: %v\n", err)
+				exit(1)
+			}
+		}
 	}
+	exit(0)
 }
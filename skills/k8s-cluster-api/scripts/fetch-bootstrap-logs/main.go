@@ -0,0 +1,422 @@
+// fetch-bootstrap-logs retrieves cloud-init/ignition output for failing Machines.
+//
+// Bootstrap failures often never produce a Node, so the only evidence is on
+// the machine itself. This tool tries a chain of backends for each Machine
+// and saves whatever they return next to the Machine's conditions:
+//
+//   - node:   kubelet log endpoint through the workload API server (when the node registered)
+//   - docker: docker exec/logs on the CAPD container
+//   - aws:    EC2 console output via the aws CLI
+//   - azure:  boot diagnostics log via the az CLI
+//
+// Files are written to <out>/<namespace>/<machine>/ together with
+// machine.json (spec, status and conditions), and the last error lines found
+// in the logs are printed.
+//
+// Usage:
+//
+//	go run ./fetch-bootstrap-logs [flags] <machine-name>
+//	go run ./fetch-bootstrap-logs [flags] -c <cluster-name>
+//
+// Examples:
+//
+//	go run ./fetch-bootstrap-logs -n default my-cluster-md-0-abcde-xyz
+//	go run ./fetch-bootstrap-logs -n default -c my-cluster
+//	go run ./fetch-bootstrap-logs --backend aws --out /tmp/logs my-cluster-control-plane-x7k2p
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+// machineInfo carries what the backends need to locate a machine.
+type machineInfo struct {
+	Namespace  string
+	Name       string
+	Cluster    string
+	InfraKind  string
+	InfraName  string
+	ProviderID string
+	Node       string
+	item       map[string]interface{}
+	infra      map[string]interface{}
+}
+
+type logFile struct {
+	Name    string
+	Content string
+}
+
+// backend fetches bootstrap logs from one source.
+type backend interface {
+	Name() string
+	Supports(m *machineInfo) bool
+	Fetch(m *machineInfo) ([]logFile, error)
+}
+
+var backends = []backend{nodeBackend{}, dockerBackend{}, awsBackend{}, azureBackend{}}
+
+func runCLI(timeout time.Duration, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	done := make(chan struct{})
+	var out []byte
+	var err error
+	go func() {
+		out, err = cmd.CombinedOutput()
+		close(done)
+	}()
+	select {
+	case <-done:
+		if err != nil {
+			return string(out), fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(string(out)))
+		}
+		return string(out), nil
+	case <-time.After(timeout):
+		_ = cmd.Process.Kill()
+		return "", fmt.Errorf("%s timed out", name)
+	}
+}
+
+// nodeBackend reads /var/log through the kubelet log handler of the
+// workload cluster's node proxy.
+type nodeBackend struct{}
+
+func (nodeBackend) Name() string                 { return "node" }
+func (nodeBackend) Supports(m *machineInfo) bool { return m.Node != "" }
+
+func (nodeBackend) Fetch(m *machineInfo) ([]logFile, error) {
+	kubeconfig, err := kubectl.WorkloadKubeconfig(m.Cluster, m.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(kubeconfig)
+	var files []logFile
+	var lastErr string
+	for _, f := range []string{"cloud-init-output.log", "cloud-init.log", "ignition.log"} {
+		ok, out, errMsg := kubectl.Run([]string{"--kubeconfig", kubeconfig, "get", "--raw",
+			"/api/v1/nodes/" + m.Node + "/proxy/logs/" + f}, kubectl.DefaultTimeout)
+		if ok && out != "" {
+			files = append(files, logFile{f, out})
+		} else {
+			lastErr = strings.TrimSpace(errMsg)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no logs via node proxy: %s", lastErr)
+	}
+	return files, nil
+}
+
+// dockerBackend reads logs from the CAPD container.
+type dockerBackend struct{}
+
+func (dockerBackend) Name() string { return "docker" }
+func (dockerBackend) Supports(m *machineInfo) bool {
+	_, err := exec.LookPath("docker")
+	return err == nil && strings.HasPrefix(m.InfraKind, "DockerMachine")
+}
+
+func (dockerBackend) Fetch(m *machineInfo) ([]logFile, error) {
+	var container string
+	for _, name := range []string{m.InfraName, m.Name} {
+		if _, err := runCLI(kubectl.DefaultTimeout, "docker", "inspect", "--format", "{{.Id}}", name); err == nil {
+			container = name
+			break
+		}
+	}
+	if container == "" {
+		return nil, fmt.Errorf("no docker container found for %s", m.InfraName)
+	}
+	var files []logFile
+	if out, err := runCLI(kubectl.DefaultTimeout, "docker", "logs", container); err == nil {
+		files = append(files, logFile{"container.log", out})
+	}
+	for _, f := range []string{"/var/log/cloud-init-output.log", "/var/log/cloud-init.log"} {
+		if out, err := runCLI(kubectl.DefaultTimeout, "docker", "exec", container, "cat", f); err == nil {
+			files = append(files, logFile{filepath.Base(f), out})
+		}
+	}
+	if out, err := runCLI(kubectl.DefaultTimeout, "docker", "exec", container,
+		"journalctl", "--no-pager", "-u", "kubelet", "-u", "containerd", "-n", "500"); err == nil {
+		files = append(files, logFile{"journal.log", out})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("container %s returned no logs", container)
+	}
+	return files, nil
+}
+
+// awsBackend reads the EC2 serial console output.
+type awsBackend struct{}
+
+func (awsBackend) Name() string { return "aws" }
+func (awsBackend) Supports(m *machineInfo) bool {
+	_, err := exec.LookPath("aws")
+	return err == nil && awsInstanceID(m) != ""
+}
+
+func awsInstanceID(m *machineInfo) string {
+	if id := kubectl.GetString(m.infra, "spec.instanceID"); id != "" {
+		return id
+	}
+	if strings.HasPrefix(m.ProviderID, "aws://") {
+		return m.ProviderID[strings.LastIndex(m.ProviderID, "/")+1:]
+	}
+	return ""
+}
+
+func (awsBackend) Fetch(m *machineInfo) ([]logFile, error) {
+	args := []string{"ec2", "get-console-output", "--instance-id", awsInstanceID(m), "--latest", "--output", "text", "--query", "Output"}
+	if region := regionFromProviderID(m.ProviderID); region != "" {
+		args = append(args, "--region", region)
+	}
+	out, err := runCLI(2*time.Minute, "aws", args...)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(out) == "None" || strings.TrimSpace(out) == "" {
+		return nil, fmt.Errorf("console output not available yet")
+	}
+	return []logFile{{"console.log", out}}, nil
+}
+
+// regionFromProviderID extracts the region from aws:///<az>/<instance>.
+func regionFromProviderID(providerID string) string {
+	parts := strings.Split(strings.TrimPrefix(providerID, "aws:///"), "/")
+	if len(parts) < 2 || len(parts[0]) < 2 {
+		return ""
+	}
+	return strings.TrimRight(parts[0], "abcdefghijklmnopqrstuvwxyz")
+}
+
+// azureBackend reads the VM boot diagnostics log.
+type azureBackend struct{}
+
+func (azureBackend) Name() string { return "azure" }
+func (azureBackend) Supports(m *machineInfo) bool {
+	_, err := exec.LookPath("az")
+	return err == nil && strings.HasPrefix(m.ProviderID, "azure://")
+}
+
+func (azureBackend) Fetch(m *machineInfo) ([]logFile, error) {
+	id := strings.TrimPrefix(m.ProviderID, "azure://")
+	out, err := runCLI(2*time.Minute, "az", "vm", "boot-diagnostics", "get-boot-log", "--ids", id)
+	if err != nil {
+		return nil, err
+	}
+	return []logFile{{"boot-diagnostics.log", out}}, nil
+}
+
+func loadMachine(item map[string]interface{}) *machineInfo {
+	m := &machineInfo{
+		Namespace:  kubectl.GetString(item, "metadata.namespace"),
+		Name:       kubectl.GetString(item, "metadata.name"),
+		Cluster:    kubectl.GetString(item, "spec.clusterName"),
+		InfraKind:  kubectl.GetString(item, "spec.infrastructureRef.kind"),
+		InfraName:  kubectl.GetString(item, "spec.infrastructureRef.name"),
+		ProviderID: kubectl.GetString(item, "spec.providerID"),
+		Node:       kubectl.GetString(item, "status.nodeRef.name"),
+		item:       item,
+	}
+	if m.InfraKind != "" {
+		ok, out, _ := kubectl.Run([]string{"get", strings.ToLower(m.InfraKind), m.InfraName, "-n", m.Namespace, "-o", "json"}, kubectl.DefaultTimeout)
+		if ok {
+			_ = json.Unmarshal([]byte(out), &m.infra)
+		}
+		if m.ProviderID == "" {
+			m.ProviderID = kubectl.GetString(m.infra, "spec.providerID")
+		}
+	}
+	return m
+}
+
+// failing reports whether a machine never finished bootstrapping.
+func failing(item map[string]interface{}) bool {
+	switch kubectl.GetString(item, "status.phase") {
+	case "Running", "Deleting", "Deleted":
+		return kubectl.GetString(item, "status.failureReason") != ""
+	}
+	return true
+}
+
+// errorLines returns the last n lines that look like failures.
+func errorLines(files []logFile, n int) []string {
+	var lines []string
+	for _, f := range files {
+		for _, line := range strings.Split(f.Content, "\n") {
+			l := strings.ToLower(line)
+			if strings.Contains(l, "error") || strings.Contains(l, "failed") || strings.Contains(l, "fatal") {
+				lines = append(lines, f.Name+": "+strings.TrimSpace(line))
+			}
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+func save(dir string, m *machineInfo, files []logFile, source string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	summary := map[string]interface{}{
+		"machine":     m.Name,
+		"namespace":   m.Namespace,
+		"cluster":     m.Cluster,
+		"phase":       kubectl.GetString(m.item, "status.phase"),
+		"provider_id": m.ProviderID,
+		"node":        m.Node,
+		"log_source":  source,
+		"spec":        kubectl.GetMap(m.item, "spec"),
+		"status":      kubectl.GetMap(m.item, "status"),
+	}
+	if m.infra != nil {
+		summary["infrastructure_status"] = kubectl.GetMap(m.infra, "status")
+	}
+	data, _ := json.MarshalIndent(summary, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, "machine.json"), data, 0o644); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.Name), []byte(f.Content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fetch(m *machineInfo, selected map[string]bool, outDir string, tail int) bool {
+	fmt.Printf("\n📦 Machine %s/%s (phase %s, infra %s/%s)\n", m.Namespace, m.Name,
+		kubectl.GetString(m.item, "status.phase"), m.InfraKind, m.InfraName)
+	for _, c := range kubectl.GetSlice(kubectl.GetMap(m.item, "status"), "conditions") {
+		cm, _ := c.(map[string]interface{})
+		if cm["status"] != "True" {
+			fmt.Printf("   ⚠️  %v=%v %v: %v\n", cm["type"], cm["status"], cm["reason"], cm["message"])
+		}
+	}
+
+	var files []logFile
+	source := ""
+	for _, b := range backends {
+		if len(selected) > 0 && !selected[b.Name()] {
+			continue
+		}
+		if !b.Supports(m) {
+			continue
+		}
+		got, err := b.Fetch(m)
+		if err != nil {
+			fmt.Printf("   ❌ %s: %v\n", b.Name(), err)
+			continue
+		}
+		files, source = got, b.Name()
+		break
+	}
+
+	dir := filepath.Join(outDir, m.Namespace, m.Name)
+	if err := save(dir, m, files, source); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return false
+	}
+	if source == "" {
+		fmt.Printf("   ❌ No backend could retrieve logs; conditions saved to %s\n", filepath.Join(dir, "machine.json"))
+		return false
+	}
+	fmt.Printf("   ✅ %d log files from %s saved to %s\n", len(files), source, dir)
+	if lines := errorLines(files, tail); len(lines) > 0 {
+		fmt.Println("   Last error lines:")
+		for _, l := range lines {
+			fmt.Printf("     %s\n", l)
+		}
+	}
+	return true
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace")
+	cluster := flag.String("c", "", "Fetch logs for every failing machine of this cluster")
+	backendList := flag.String("backend", "", "Comma-separated backends to try: node, docker, aws, azure (default: all in that order)")
+	outDir := flag.String("out", "bootstrap-logs", "Directory to write logs to")
+	tail := flag.Int("tail", 20, "Number of error lines to print per machine")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <machine-name> | -c <cluster-name>\n\nRetrieve cloud-init/ignition bootstrap logs for failing Machines.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if (flag.NArg() < 1) == (*cluster == "") {
+		flag.Usage()
+		os.Exit(1)
+	}
+	selected := map[string]bool{}
+	for _, b := range strings.Split(*backendList, ",") {
+		if b = strings.TrimSpace(b); b == "" {
+			continue
+		}
+		known := false
+		for _, kb := range backends {
+			known = known || kb.Name() == b
+		}
+		if !known {
+			fmt.Fprintf(os.Stderr, "Error: unknown backend %q\n", b)
+			os.Exit(1)
+		}
+		selected[b] = true
+	}
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	var machines []map[string]interface{}
+	if *cluster != "" {
+		items, err := kubectl.RunJSON("machines", *namespace, "cluster.x-k8s.io/cluster-name="+*cluster, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, item := range items {
+			if failing(item) {
+				machines = append(machines, item)
+			}
+		}
+		if len(machines) == 0 {
+			fmt.Printf("No failing machines in cluster %s/%s\n", *namespace, *cluster)
+			return
+		}
+	} else {
+		ok, out, errMsg := kubectl.Run([]string{"get", "machines.cluster.x-k8s.io", flag.Arg(0), "-n", *namespace, "-o", "json"}, kubectl.DefaultTimeout)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", strings.TrimSpace(errMsg))
+			os.Exit(1)
+		}
+		items, err := kubectl.ParseItems(out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		machines = items
+	}
+
+	failed := false
+	for _, item := range machines {
+		if !fetch(loadMachine(item), selected, *outDir, *tail) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
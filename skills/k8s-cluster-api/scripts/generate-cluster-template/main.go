@@ -9,28 +9,47 @@
 //
 //	go run ./generate-cluster-template -n my-cluster --class default
 //	go run ./generate-cluster-template -n my-cluster --from-scratch --infra docker
+//	go run ./generate-cluster-template -n my-cluster --from-scratch --infra aws --machinepool
+//	go run ./generate-cluster-template -n my-cluster --from-scratch --infra foo --infra-custom kind=FooCluster,version=v1alpha1
+//	go run ./generate-cluster-template -n my-cluster --class default --md name=md-0,replicas=3 --md name=gpu,replicas=2,class=gpu-worker
+//	go run ./generate-cluster-template -n my-cluster --from-scratch --workers-spec workers.yaml
+//	go run ./generate-cluster-template -n my-cluster --from-scratch --with-mhc --with-crs cni=calico
+//	go run ./generate-cluster-template -n my-cluster --class default --output-format kustomize -o ./clusters/my-cluster
+//	go run ./generate-cluster-template -n my-cluster --use-clusterctl --infra aws --flavor eks --vars AWS_REGION=eu-west-1
+//	go run ./generate-cluster-template --from-existing prod-eu -ns clusters -o clone-template.yaml
 //	go run ./generate-cluster-template --list-classes
 //	go run ./generate-cluster-template --class default --info
+//	go run ./generate-cluster-template -n my-cluster --class default --vars region=us-east-1 --interactive
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 
 	kubectl "k8s-cluster-api-tools/internal/kubectl"
 )
 
 type clusterClassInfo struct {
-	Name       string
-	Namespace  string
-	InfraKind  string
-	CPKind     string
-	Workers    []workerClass
-	Variables  []classVariable
+	Name      string
+	Namespace string
+	InfraKind string
+	CPKind    string
+	Workers   []workerClass
+	Variables []classVariable
 }
 
 type workerClass struct {
@@ -39,45 +58,242 @@ type workerClass struct {
 	BootKind  string
 }
 
+// workerSpec describes one worker MachineDeployment (or MachinePool with
+// --machinepool). Class is the ClusterClass worker class and is ignored by
+// --from-scratch, where each worker gets its own templates instead.
+type workerSpec struct {
+	Name     string `yaml:"name"`
+	Class    string `yaml:"class"`
+	Replicas int    `yaml:"replicas"`
+}
+
+// workerFlags collects repeated --md flags.
+type workerFlags []workerSpec
+
+func (w *workerFlags) String() string {
+	parts := make([]string, 0, len(*w))
+	for _, spec := range *w {
+		parts = append(parts, spec.Name)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set parses name=gpu,replicas=2,class=gpu-worker. Replicas defaults to -1
+// so --worker-replicas can fill it in later.
+func (w *workerFlags) Set(value string) error {
+	spec := workerSpec{Replicas: -1}
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected key=value, got %q", pair)
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "name":
+			spec.Name = strings.TrimSpace(kv[1])
+		case "class":
+			spec.Class = strings.TrimSpace(kv[1])
+		case "replicas":
+			n, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid replicas %q", kv[1])
+			}
+			spec.Replicas = n
+		default:
+			return fmt.Errorf("unknown key %q (expected name, replicas, class)", kv[0])
+		}
+	}
+	if spec.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	*w = append(*w, spec)
+	return nil
+}
+
+// loadWorkersSpec reads a YAML list of workers, each with name, class and
+// replicas keys. Omitted replicas fall back to --worker-replicas.
+func loadWorkersSpec(path string) ([]workerSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		Name     string `yaml:"name"`
+		Class    string `yaml:"class"`
+		Replicas *int   `yaml:"replicas"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	workers := make([]workerSpec, 0, len(raw))
+	for i, r := range raw {
+		if r.Name == "" {
+			return nil, fmt.Errorf("%s: worker %d has no name", path, i)
+		}
+		spec := workerSpec{Name: r.Name, Class: r.Class, Replicas: -1}
+		if r.Replicas != nil {
+			if *r.Replicas < 0 {
+				return nil, fmt.Errorf("%s: worker %s has negative replicas", path, r.Name)
+			}
+			spec.Replicas = *r.Replicas
+		}
+		workers = append(workers, spec)
+	}
+	return workers, nil
+}
+
+// resolveWorkers fills in defaults and rejects duplicate names. Without any
+// --md or --workers-spec a single worker named md-0 (mp-0 for MachinePools)
+// is generated, as before.
+func resolveWorkers(workers []workerSpec, defaultReplicas int, machinePool bool) ([]workerSpec, error) {
+	if len(workers) == 0 {
+		name := "md-0"
+		if machinePool {
+			name = "mp-0"
+		}
+		workers = []workerSpec{{Name: name, Replicas: -1}}
+	}
+	seen := map[string]bool{}
+	resolved := make([]workerSpec, 0, len(workers))
+	for _, w := range workers {
+		if seen[w.Name] {
+			return nil, fmt.Errorf("duplicate worker name %q", w.Name)
+		}
+		seen[w.Name] = true
+		if w.Class == "" {
+			w.Class = "default-worker"
+		}
+		if w.Replicas < 0 {
+			w.Replicas = defaultReplicas
+		}
+		resolved = append(resolved, w)
+	}
+	return resolved, nil
+}
+
 type classVariable struct {
 	Name     string
 	Required bool
-	Schema   string
+	Schema   string                 // top-level OpenAPI type
+	OpenAPI  map[string]interface{} // full openAPIV3Schema, used for validation
+}
+
+// infraKinds names the kinds an infrastructure provider contributes.
+type infraKinds struct {
+	ClusterKind     string
+	MachineKind     string
+	TemplateKind    string
+	MachinePoolKind string // empty if the provider has no machine pool support
+	APIGroup        string
+	APIVersion      string
 }
 
-var infraProviderTemplates = map[string]struct {
-	ClusterKind   string
-	MachineKind   string
-	TemplateKind  string
-	APIGroup      string
-	APIVersion    string
-}{
+var infraProviderTemplates = map[string]infraKinds{
 	"docker": {
-		"DockerCluster", "DockerMachine", "DockerMachineTemplate",
+		"DockerCluster", "DockerMachine", "DockerMachineTemplate", "DockerMachinePool",
 		"infrastructure.cluster.x-k8s.io", "v1beta1",
 	},
 	"aws": {
-		"AWSCluster", "AWSMachine", "AWSMachineTemplate",
+		"AWSCluster", "AWSMachine", "AWSMachineTemplate", "AWSMachinePool",
 		"infrastructure.cluster.x-k8s.io", "v1beta2",
 	},
 	"azure": {
-		"AzureCluster", "AzureMachine", "AzureMachineTemplate",
+		"AzureCluster", "AzureMachine", "AzureMachineTemplate", "AzureMachinePool",
+		"infrastructure.cluster.x-k8s.io", "v1beta1",
+	},
+	"gcp": {
+		"GCPCluster", "GCPMachine", "GCPMachineTemplate", "GCPMachinePool",
 		"infrastructure.cluster.x-k8s.io", "v1beta1",
 	},
 	"vsphere": {
-		"VSphereCluster", "VSphereMachine", "VSphereMachineTemplate",
+		"VSphereCluster", "VSphereMachine", "VSphereMachineTemplate", "",
 		"infrastructure.cluster.x-k8s.io", "v1beta1",
 	},
 	"metal3": {
-		"Metal3Cluster", "Metal3Machine", "Metal3MachineTemplate",
+		"Metal3Cluster", "Metal3Machine", "Metal3MachineTemplate", "",
 		"infrastructure.cluster.x-k8s.io", "v1beta1",
 	},
 	"openstack": {
-		"OpenStackCluster", "OpenStackMachine", "OpenStackMachineTemplate",
+		"OpenStackCluster", "OpenStackMachine", "OpenStackMachineTemplate", "",
+		"infrastructure.cluster.x-k8s.io", "v1beta1",
+	},
+	"hetzner": {
+		"HetznerCluster", "HCloudMachine", "HCloudMachineTemplate", "",
+		"infrastructure.cluster.x-k8s.io", "v1beta1",
+	},
+	"proxmox": {
+		"ProxmoxCluster", "ProxmoxMachine", "ProxmoxMachineTemplate", "",
+		"infrastructure.cluster.x-k8s.io", "v1alpha1",
+	},
+	"nutanix": {
+		"NutanixCluster", "NutanixMachine", "NutanixMachineTemplate", "",
 		"infrastructure.cluster.x-k8s.io", "v1beta1",
 	},
 }
 
+// parseInfraCustom parses --infra-custom, e.g.
+// kind=FooCluster,group=infrastructure.cluster.x-k8s.io,version=v1alpha1.
+// Machine and template kinds default to the Foo prefix of the cluster kind and
+// can be overridden with machine= and template=. There is no machine pool kind
+// unless machinepool= names one.
+func parseInfraCustom(value string) (infraKinds, error) {
+	var k infraKinds
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return k, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		switch kv[0] {
+		case "kind":
+			k.ClusterKind = kv[1]
+		case "machine":
+			k.MachineKind = kv[1]
+		case "template":
+			k.TemplateKind = kv[1]
+		case "machinepool":
+			k.MachinePoolKind = kv[1]
+		case "group":
+			k.APIGroup = kv[1]
+		case "version":
+			k.APIVersion = kv[1]
+		default:
+			return k, fmt.Errorf("unknown key %q (expected kind, machine, template, machinepool, group, version)", kv[0])
+		}
+	}
+	if k.ClusterKind == "" || k.APIVersion == "" {
+		return k, fmt.Errorf("kind and version are required")
+	}
+	if k.APIGroup == "" {
+		k.APIGroup = "infrastructure.cluster.x-k8s.io"
+	}
+	prefix := strings.TrimSuffix(k.ClusterKind, "Cluster")
+	if k.MachineKind == "" {
+		k.MachineKind = prefix + "Machine"
+	}
+	if k.TemplateKind == "" {
+		k.TemplateKind = k.MachineKind + "Template"
+	}
+	return k, nil
+}
+
+func runKubectl(kubeconfig string, timeout time.Duration, args ...string) (string, error) {
+	if kubeconfig != "" {
+		args = append(args, "--kubeconfig", kubeconfig)
+	}
+	ok, out, errMsg := kubectl.Run(args, timeout)
+	if !ok {
+		return out, fmt.Errorf("%s", strings.TrimSpace(errMsg))
+	}
+	return out, nil
+}
+
+func listJSON(kubeconfig string, args ...string) ([]map[string]interface{}, error) {
+	out, err := runKubectl(kubeconfig, kubectl.DefaultTimeout, args...)
+	if err != nil {
+		return nil, err
+	}
+	return kubectl.ParseItems(out)
+}
+
 func listClusterClasses(namespace, kubeconfig string) {
 	args := []string{"get", "clusterclasses.cluster.x-k8s.io", "-o", "json"}
 	if namespace != "" {
@@ -85,11 +301,8 @@ func listClusterClasses(namespace, kubeconfig string) {
 	} else {
 		args = append(args, "--all-namespaces")
 	}
-	if kubeconfig != "" {
-		args = append(args, "--kubeconfig", kubeconfig)
-	}
 
-	items, err := kubectl.RunJSON(args...)
+	items, err := listJSON(kubeconfig, args...)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error listing ClusterClasses:", err)
 		os.Exit(1)
@@ -104,13 +317,9 @@ func listClusterClasses(namespace, kubeconfig string) {
 	fmt.Println(strings.Repeat("-", 60))
 	fmt.Printf("%-25s %-20s %s\n", "NAME", "NAMESPACE", "INFRASTRUCTURE")
 	for _, item := range items {
-		name := kubectl.GetString(item, "metadata", "name")
-		ns := kubectl.GetString(item, "metadata", "namespace")
-		infraRef := kubectl.GetMap(item, "spec", "infrastructure")
-		infraKind := ""
-		if ref, ok := infraRef["ref"].(map[string]interface{}); ok {
-			infraKind, _ = ref["kind"].(string)
-		}
+		name := kubectl.GetString(item, "metadata.name")
+		ns := kubectl.GetString(item, "metadata.namespace")
+		infraKind := classRefKind(kubectl.GetMap(item, "spec"), "infrastructure")
 		fmt.Printf("%-25s %-20s %s\n", name, ns, infraKind)
 	}
 }
@@ -120,11 +329,8 @@ func getClusterClassInfo(className, namespace, kubeconfig string) *clusterClassI
 	if namespace != "" {
 		args = append(args, "-n", namespace)
 	}
-	if kubeconfig != "" {
-		args = append(args, "--kubeconfig", kubeconfig)
-	}
 
-	out, err := kubectl.Run(args...)
+	out, err := runKubectl(kubeconfig, kubectl.DefaultTimeout, args...)
 	if err != nil {
 		return nil
 	}
@@ -144,19 +350,9 @@ func getClusterClassInfo(className, namespace, kubeconfig string) *clusterClassI
 		return info
 	}
 
-	// Infrastructure
-	if infra, ok := spec["infrastructure"].(map[string]interface{}); ok {
-		if ref, ok := infra["ref"].(map[string]interface{}); ok {
-			info.InfraKind, _ = ref["kind"].(string)
-		}
-	}
-
-	// Control plane
-	if cp, ok := spec["controlPlane"].(map[string]interface{}); ok {
-		if ref, ok := cp["ref"].(map[string]interface{}); ok {
-			info.CPKind, _ = ref["kind"].(string)
-		}
-	}
+	// Infrastructure and control plane; v1beta2 renamed ref to templateRef.
+	info.InfraKind = classRefKind(spec, "infrastructure")
+	info.CPKind = classRefKind(spec, "controlPlane")
 
 	// Workers
 	if workers, ok := spec["workers"].(map[string]interface{}); ok {
@@ -166,18 +362,14 @@ func getClusterClassInfo(className, namespace, kubeconfig string) *clusterClassI
 				if !ok {
 					continue
 				}
-				wc := workerClass{Name: mdMap["class"].(string)}
+				wc := workerClass{Name: kubectl.GetString(mdMap, "class")}
 				if tmpl, ok := mdMap["template"].(map[string]interface{}); ok {
-					if infra, ok := tmpl["infrastructure"].(map[string]interface{}); ok {
-						if ref, ok := infra["ref"].(map[string]interface{}); ok {
-							wc.InfraKind, _ = ref["kind"].(string)
-						}
-					}
-					if boot, ok := tmpl["bootstrap"].(map[string]interface{}); ok {
-						if ref, ok := boot["ref"].(map[string]interface{}); ok {
-							wc.BootKind, _ = ref["kind"].(string)
-						}
-					}
+					wc.InfraKind = classRefKind(tmpl, "infrastructure")
+					wc.BootKind = classRefKind(tmpl, "bootstrap")
+				} else {
+					// v1beta2 moved the templates up to the class itself.
+					wc.InfraKind = classRefKind(mdMap, "infrastructure")
+					wc.BootKind = classRefKind(mdMap, "bootstrap")
 				}
 				info.Workers = append(info.Workers, wc)
 			}
@@ -201,6 +393,7 @@ func getClusterClassInfo(className, namespace, kubeconfig string) *clusterClassI
 				if oas, ok := schema["openAPIV3Schema"].(map[string]interface{}); ok {
 					t, _ := oas["type"].(string)
 					cv.Schema = t
+					cv.OpenAPI = oas
 				}
 			}
 			info.Variables = append(info.Variables, cv)
@@ -210,6 +403,15 @@ func getClusterClassInfo(className, namespace, kubeconfig string) *clusterClassI
 	return info
 }
 
+// classRefKind returns the template kind of a ClusterClass section, reading
+// ref (v1beta1) or templateRef (v1beta2).
+func classRefKind(m map[string]interface{}, section string) string {
+	if kind := kubectl.GetString(m, section+".ref.kind"); kind != "" {
+		return kind
+	}
+	return kubectl.GetString(m, section+".templateRef.kind")
+}
+
 func printClassInfo(info *clusterClassInfo) {
 	fmt.Printf("ClusterClass: %s\n", info.Name)
 	fmt.Printf("Namespace: %s\n", info.Namespace)
@@ -231,7 +433,681 @@ func printClassInfo(info *clusterClassInfo) {
 	}
 }
 
-func generateFromClass(clusterName, className, namespace, k8sVersion string, cpReplicas, workerReplicas int, vars map[string]string) string {
+// parseVarValue decodes a --vars value for the given schema. Strings are taken
+// verbatim; every other type is parsed as JSON (YAML flow syntax also works).
+func parseVarValue(raw string, schema map[string]interface{}) (interface{}, error) {
+	if t, _ := schema["type"].(string); t == "string" {
+		return raw, nil
+	}
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(raw), &v); err != nil {
+		return nil, fmt.Errorf("cannot parse %q: %v", raw, err)
+	}
+	return v, nil
+}
+
+// validateValue checks a decoded value against the subset of OpenAPI v3 that
+// ClusterClass variables commonly use: type, enum, pattern, length and range
+// bounds, required/properties for objects and items for arrays.
+func validateValue(path string, schema map[string]interface{}, v interface{}) []string {
+	var errs []string
+	switch t, _ := schema["type"].(string); t {
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected string, got %v", path, v)}
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(s) {
+				errs = append(errs, fmt.Sprintf("%s: %q does not match pattern %s", path, s, p))
+			}
+		}
+		if n, ok := schemaNumber(schema, "minLength"); ok && float64(len(s)) < n {
+			errs = append(errs, fmt.Sprintf("%s: %q is shorter than minLength %v", path, s, n))
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && float64(len(s)) > n {
+			errs = append(errs, fmt.Sprintf("%s: %q is longer than maxLength %v", path, s, n))
+		}
+	case "integer", "number":
+		var f float64
+		switch n := v.(type) {
+		case int:
+			f = float64(n)
+		case float64:
+			f = n
+		default:
+			return []string{fmt.Sprintf("%s: expected %s, got %v", path, t, v)}
+		}
+		if t == "integer" && f != float64(int64(f)) {
+			return []string{fmt.Sprintf("%s: expected integer, got %v", path, v)}
+		}
+		if n, ok := schemaNumber(schema, "minimum"); ok && f < n {
+			errs = append(errs, fmt.Sprintf("%s: %v is less than minimum %v", path, v, n))
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && f > n {
+			errs = append(errs, fmt.Sprintf("%s: %v is greater than maximum %v", path, v, n))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{fmt.Sprintf("%s: expected boolean, got %v", path, v)}
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %v", path, v)}
+		}
+		if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range items {
+				errs = append(errs, validateValue(fmt.Sprintf("%s[%d]", path, i), itemSchema, item)...)
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %v", path, v)}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		if req, ok := schema["required"].([]interface{}); ok {
+			for _, r := range req {
+				name, _ := r.(string)
+				if _, ok := obj[name]; !ok {
+					errs = append(errs, fmt.Sprintf("%s.%s: required field missing", path, name))
+				}
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if propSchema, ok := props[k].(map[string]interface{}); ok {
+				errs = append(errs, validateValue(path+"."+k, propSchema, obj[k])...)
+			}
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !inEnum(v, enum) {
+		errs = append(errs, fmt.Sprintf("%s: %v is not one of %v", path, v, enum))
+	}
+	return errs
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	switch n := schema[key].(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func inEnum(v interface{}, enum []interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVars splits --vars on top-level commas so array and object values
+// such as zones=[a,b] or proxy={http: x, port: 3128} stay intact.
+func parseVars(value string) map[string]string {
+	vars := map[string]string{}
+	depth, start := 0, 0
+	var quote rune
+	add := func(pair string) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) != "" {
+			vars[strings.TrimSpace(kv[0])] = kv[1]
+		}
+	}
+	for i, r := range value {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case depth > 0 && (r == '"' || r == '\''):
+			quote = r
+		case r == '[' || r == '{':
+			depth++
+		case r == ']' || r == '}':
+			depth--
+		case r == ',' && depth == 0:
+			add(value[start:i])
+			start = i + 1
+		}
+	}
+	add(value[start:])
+	return vars
+}
+
+// formatVarValue renders a --vars value for the Cluster topology. String
+// variables are quoted so values like 3.5 or true keep their declared type;
+// everything else is emitted as given (JSON or YAML flow syntax).
+func formatVarValue(raw string, cv classVariable) string {
+	if cv.Schema == "string" {
+		b, _ := json.Marshal(raw)
+		return string(b)
+	}
+	return raw
+}
+
+// validateVars checks --vars against the ClusterClass variable schemas and
+// returns one message per problem: unknown variables, missing required
+// variables without a schema default, and values that violate their schema.
+func validateVars(info *clusterClassInfo, vars map[string]string) []string {
+	var errs []string
+	defined := map[string]classVariable{}
+	for _, cv := range info.Variables {
+		defined[cv.Name] = cv
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cv, ok := defined[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: not a variable of ClusterClass %s", name, info.Name))
+			continue
+		}
+		if cv.OpenAPI == nil {
+			continue
+		}
+		v, err := parseVarValue(vars[name], cv.OpenAPI)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		errs = append(errs, validateValue(name, cv.OpenAPI, v)...)
+	}
+
+	for _, name := range missingRequired(info, vars) {
+		errs = append(errs, fmt.Sprintf("%s: required variable not set", name))
+	}
+	return errs
+}
+
+// missingRequired lists required variables that have neither a value nor a
+// schema default.
+func missingRequired(info *clusterClassInfo, vars map[string]string) []string {
+	var missing []string
+	for _, cv := range info.Variables {
+		if !cv.Required {
+			continue
+		}
+		if _, ok := vars[cv.Name]; ok {
+			continue
+		}
+		if _, ok := cv.OpenAPI["default"]; ok {
+			continue
+		}
+		missing = append(missing, cv.Name)
+	}
+	return missing
+}
+
+// promptMissingVars asks for each missing required variable on stdin,
+// re-prompting until the value passes schema validation.
+func promptMissingVars(info *clusterClassInfo, vars map[string]string) {
+	reader := bufio.NewReader(os.Stdin)
+	for _, name := range missingRequired(info, vars) {
+		var cv classVariable
+		for _, v := range info.Variables {
+			if v.Name == name {
+				cv = v
+			}
+		}
+		hint := cv.Schema
+		if enum, ok := cv.OpenAPI["enum"].([]interface{}); ok {
+			hint = fmt.Sprintf("%s, one of %v", hint, enum)
+		}
+		if desc, ok := cv.OpenAPI["description"].(string); ok {
+			fmt.Fprintf(os.Stderr, "# %s\n", desc)
+		}
+		for {
+			fmt.Fprintf(os.Stderr, "%s (%s): ", name, hint)
+			answer, err := reader.ReadString('\n')
+			answer = strings.TrimSpace(answer)
+			if answer == "" {
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "\nError: no value for required variable %s\n", name)
+					os.Exit(1)
+				}
+				continue
+			}
+			v, perr := parseVarValue(answer, cv.OpenAPI)
+			var errs []string
+			if perr != nil {
+				errs = []string{fmt.Sprintf("%s: %v", name, perr)}
+			} else if cv.OpenAPI != nil {
+				errs = validateValue(name, cv.OpenAPI, v)
+			}
+			if len(errs) == 0 {
+				vars[name] = answer
+				break
+			}
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "  ✗ %s\n", e)
+			}
+		}
+	}
+}
+
+// getObjects runs "kubectl get <args> -o json" and returns the items.
+func getObjects(kubeconfig string, args ...string) ([]map[string]interface{}, error) {
+	args = append([]string{"get"}, args...)
+	args = append(args, "-o", "json")
+	items, err := listJSON(kubeconfig, args...)
+	if err != nil {
+		return nil, fmt.Errorf("kubectl %s: %w", strings.Join(args, " "), err)
+	}
+	return items, nil
+}
+
+// getRef fetches the object an ObjectReference points to. Refs without a
+// namespace resolve in the referencing object's namespace. v1beta2 refs carry
+// apiGroup instead of apiVersion.
+func getRef(ref map[string]interface{}, namespace, kubeconfig string) (map[string]interface{}, error) {
+	apiVersion, _ := ref["apiVersion"].(string)
+	group, _ := ref["apiGroup"].(string)
+	kind, _ := ref["kind"].(string)
+	name, _ := ref["name"].(string)
+	if kind == "" || name == "" {
+		return nil, fmt.Errorf("incomplete reference %v", ref)
+	}
+	if ns, _ := ref["namespace"].(string); ns != "" {
+		namespace = ns
+	}
+	if i := strings.Index(apiVersion, "/"); i > 0 && group == "" {
+		group = apiVersion[:i]
+	}
+	resource := strings.ToLower(kind)
+	if group != "" {
+		resource += "." + group
+	}
+	items, err := getObjects(kubeconfig, resource, name, "-n", namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%s %s/%s not found", kind, namespace, name)
+	}
+	return items[0], nil
+}
+
+// templateParams replaces cluster-specific values with clusterctl variables.
+type templateParams struct {
+	ClusterName string
+	Namespace   string
+	Version     string
+}
+
+// serverManagedMetadata is dropped from every exported object.
+var serverManagedMetadata = []string{
+	"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp",
+	"managedFields", "ownerReferences", "finalizers", "selfLink",
+}
+
+// controllerAnnotationPrefixes marks annotations written by kubectl or the
+// CAPI controllers, which must not be copied into a new cluster.
+var controllerAnnotationPrefixes = []string{
+	"kubectl.kubernetes.io/", "cluster.x-k8s.io/", "controlplane.cluster.x-k8s.io/",
+	"machinedeployment.clusters.x-k8s.io/",
+}
+
+// cleanObject strips status and server-managed metadata so the object can be
+// re-applied as a new resource.
+func cleanObject(obj map[string]interface{}) {
+	delete(obj, "status")
+	meta, _ := obj["metadata"].(map[string]interface{})
+	for _, key := range serverManagedMetadata {
+		delete(meta, key)
+	}
+	if ann, ok := meta["annotations"].(map[string]interface{}); ok {
+		for key := range ann {
+			for _, prefix := range controllerAnnotationPrefixes {
+				if strings.HasPrefix(key, prefix) {
+					delete(ann, key)
+				}
+			}
+		}
+		if len(ann) == 0 {
+			delete(meta, "annotations")
+		}
+	}
+	// The endpoint is assigned per cluster by the infrastructure provider.
+	if spec, ok := obj["spec"].(map[string]interface{}); ok {
+		delete(spec, "controlPlaneEndpoint")
+	}
+}
+
+// parameterize rewrites names, namespaces and versions in place.
+func parameterize(v interface{}, key string, p templateParams) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if k == "uid" || k == "resourceVersion" {
+				delete(t, k) // stale fields inside object references
+				continue
+			}
+			t[k] = parameterize(child, k, p)
+		}
+		return t
+	case []interface{}:
+		for i, child := range t {
+			t[i] = parameterize(child, key, p)
+		}
+		return t
+	case string:
+		switch {
+		case key == "namespace" && t == p.Namespace:
+			return "${NAMESPACE}"
+		case key == "version" && t == p.Version:
+			return "${KUBERNETES_VERSION}"
+		case t == p.ClusterName:
+			return "${CLUSTER_NAME}"
+		case strings.HasPrefix(t, p.ClusterName+"-"):
+			return "${CLUSTER_NAME}" + strings.TrimPrefix(t, p.ClusterName)
+		}
+	}
+	return v
+}
+
+// countVar turns a worker name into a WORKER_MACHINE_COUNT_<NAME> variable.
+func countVar(clusterName, workerName string) string {
+	suffix := strings.TrimPrefix(workerName, clusterName+"-")
+	suffix = regexp.MustCompile(`[^A-Za-z0-9]+`).ReplaceAllString(suffix, "_")
+	return "WORKER_MACHINE_COUNT_" + strings.ToUpper(suffix)
+}
+
+// setReplicas replaces spec.replicas (or the topology replicas map) with a
+// variable, keeping the live value as its default.
+func setReplicas(m map[string]interface{}, variable string) {
+	if r, ok := m["replicas"]; ok {
+		m["replicas"] = fmt.Sprintf("${%s:=%v}", variable, r)
+	}
+}
+
+// generateFromExisting exports a live Cluster and the objects it references
+// as a clusterctl-style template. Names, namespace, Kubernetes version and
+// replica counts become ${VARIABLES} so the template can be used to clone the
+// cluster with "clusterctl generate cluster --from".
+func generateFromExisting(clusterName, namespace, kubeconfig string) (string, error) {
+	clusters, err := getObjects(kubeconfig, "clusters.cluster.x-k8s.io", clusterName, "-n", namespace)
+	if err != nil {
+		return "", err
+	}
+	if len(clusters) == 0 {
+		return "", fmt.Errorf("cluster %s/%s not found", namespace, clusterName)
+	}
+	cluster := clusters[0]
+	spec, _ := cluster["spec"].(map[string]interface{})
+
+	objects := []map[string]interface{}{cluster}
+	seen := map[string]bool{}
+	// addRef fetches a referenced object once; templates may be shared.
+	addRef := func(ref interface{}) (map[string]interface{}, error) {
+		refMap, ok := ref.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		key := fmt.Sprintf("%v/%v", refMap["kind"], refMap["name"])
+		if seen[key] {
+			return nil, nil
+		}
+		seen[key] = true
+		obj, err := getRef(refMap, namespace, kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+		return obj, nil
+	}
+
+	version := ""
+	topology, _ := spec["topology"].(map[string]interface{})
+	if topology != nil {
+		// ClusterClass-based: the topology is the whole template.
+		version, _ = topology["version"].(string)
+		if cp, ok := topology["controlPlane"].(map[string]interface{}); ok {
+			setReplicas(cp, "CONTROL_PLANE_MACHINE_COUNT")
+		}
+		if workers, ok := topology["workers"].(map[string]interface{}); ok {
+			mds, _ := workers["machineDeployments"].([]interface{})
+			for _, md := range mds {
+				mdMap, _ := md.(map[string]interface{})
+				name, _ := mdMap["name"].(string)
+				variable := "WORKER_MACHINE_COUNT"
+				if len(mds) > 1 {
+					variable = countVar(clusterName, name)
+				}
+				setReplicas(mdMap, variable)
+			}
+		}
+	} else {
+		if _, err := addRef(spec["infrastructureRef"]); err != nil {
+			return "", err
+		}
+		cp, err := addRef(spec["controlPlaneRef"])
+		if err != nil {
+			return "", err
+		}
+		if cp != nil {
+			version = kubectl.GetString(cp, "spec.version")
+			setReplicas(kubectl.GetMap(cp, "spec"), "CONTROL_PLANE_MACHINE_COUNT")
+			infraRef := kubectl.GetNested(cp, "spec.machineTemplate.infrastructureRef")
+			if infraRef == nil {
+				infraRef = kubectl.GetNested(cp, "spec.machineTemplate.spec.infrastructureRef") // v1beta2
+			}
+			if _, err := addRef(infraRef); err != nil {
+				return "", err
+			}
+		}
+
+		selector := "cluster.x-k8s.io/cluster-name=" + clusterName
+		var workers []map[string]interface{}
+		for _, resource := range []string{"machinedeployments.cluster.x-k8s.io", "machinepools.cluster.x-k8s.io"} {
+			items, err := getObjects(kubeconfig, resource, "-n", namespace, "-l", selector)
+			if err != nil && resource == "machinedeployments.cluster.x-k8s.io" {
+				return "", err
+			}
+			workers = append(workers, items...) // MachinePool CRD may not be installed
+		}
+		for _, w := range workers {
+			objects = append(objects, w)
+			variable := "WORKER_MACHINE_COUNT"
+			if len(workers) > 1 {
+				variable = countVar(clusterName, kubectl.GetString(w, "metadata.name"))
+			}
+			setReplicas(kubectl.GetMap(w, "spec"), variable)
+			if _, err := addRef(kubectl.GetNested(w, "spec.template.spec.bootstrap.configRef")); err != nil {
+				return "", err
+			}
+			if _, err := addRef(kubectl.GetNested(w, "spec.template.spec.infrastructureRef")); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	params := templateParams{ClusterName: clusterName, Namespace: namespace, Version: version}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Generated from cluster %s/%s by generate-cluster-template --from-existing.\n", namespace, clusterName))
+	sb.WriteString("# Variables: CLUSTER_NAME, NAMESPACE, KUBERNETES_VERSION and the *_MACHINE_COUNT\n")
+	sb.WriteString("# replica counts (defaulting to the source cluster's values).\n")
+	for i, obj := range objects {
+		cleanObject(obj)
+		parameterize(obj, "", params)
+		if i > 0 {
+			sb.WriteString("---\n")
+		}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(obj); err != nil {
+			return "", err
+		}
+		enc.Close()
+		sb.Write(buf.Bytes())
+	}
+	return sb.String(), nil
+}
+
+// addon is one ClusterResourceSet-delivered add-on, e.g. cni=calico.
+type addon struct {
+	Name   string // label key and CRS suffix, e.g. cni
+	Flavor string // e.g. calico
+}
+
+// addonSources hints where to get the manifest for well-known add-ons.
+var addonSources = map[string]string{
+	"calico":  "https://raw.githubusercontent.com/projectcalico/calico/v3.27.0/manifests/calico.yaml",
+	"flannel": "https://github.com/flannel-io/flannel/releases/latest/download/kube-flannel.yml",
+	"cilium":  "helm template cilium cilium/cilium --namespace kube-system",
+	"kindnet": "https://raw.githubusercontent.com/aojea/kindnet/main/install-kindnet.yaml",
+}
+
+// parseAddons parses --with-crs values like cni=calico,csi=aws-ebs.
+func parseAddons(value string) ([]addon, error) {
+	var addons []addon
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid add-on %q (expected name=flavor, e.g. cni=calico)", pair)
+		}
+		addons = append(addons, addon{Name: kv[0], Flavor: kv[1]})
+	}
+	return addons, nil
+}
+
+// addonLabels returns the Cluster labels selected by the generated
+// ClusterResourceSets.
+func addonLabels(clusterName string, addons []addon) map[string]string {
+	labels := map[string]string{}
+	for _, a := range addons {
+		labels[a.Name] = clusterName + "-" + a.Flavor
+	}
+	return labels
+}
+
+func writeLabels(sb *strings.Builder, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	sb.WriteString("  labels:\n")
+	for _, k := range keys {
+		sb.WriteString(fmt.Sprintf("    %s: %s\n", k, labels[k]))
+	}
+}
+
+// generateMHCs returns MachineHealthChecks for the control plane and every
+// MachineDeployment worker. Unhealthy means Ready=False/Unknown for 5m; workers
+// stop remediating once 40% of machines are unhealthy, while the control
+// plane relies on KubeadmControlPlane's own remediation safeguards.
+func generateMHCs(clusterName, namespace string, workers []workerSpec, classBased, machinePool bool) string {
+	var sb strings.Builder
+	write := func(name string, selector map[string]string, maxUnhealthy string) {
+		sb.WriteString("---\n")
+		sb.WriteString("apiVersion: cluster.x-k8s.io/v1beta1\n")
+		sb.WriteString("kind: MachineHealthCheck\n")
+		sb.WriteString("metadata:\n")
+		sb.WriteString(fmt.Sprintf("  name: %s\n", name))
+		if namespace != "" {
+			sb.WriteString(fmt.Sprintf("  namespace: %s\n", namespace))
+		}
+		sb.WriteString("spec:\n")
+		sb.WriteString(fmt.Sprintf("  clusterName: %s\n", clusterName))
+		if maxUnhealthy != "" {
+			sb.WriteString(fmt.Sprintf("  maxUnhealthy: %s\n", maxUnhealthy))
+		}
+		sb.WriteString("  nodeStartupTimeout: 10m\n")
+		sb.WriteString("  selector:\n")
+		sb.WriteString("    matchLabels:\n")
+		for k, v := range selector {
+			sb.WriteString(fmt.Sprintf("      %s: %q\n", k, v))
+		}
+		sb.WriteString("  unhealthyConditions:\n")
+		sb.WriteString("  - type: Ready\n")
+		sb.WriteString("    status: Unknown\n")
+		sb.WriteString("    timeout: 300s\n")
+		sb.WriteString("  - type: Ready\n")
+		sb.WriteString("    status: \"False\"\n")
+		sb.WriteString("    timeout: 300s\n")
+	}
+
+	write(clusterName+"-control-plane-mhc", map[string]string{"cluster.x-k8s.io/control-plane": ""}, "")
+	if machinePool {
+		// MachinePool instances are replaced by the provider's scaling group.
+		return sb.String()
+	}
+	for _, w := range workers {
+		mdName := clusterName + "-" + w.Name
+		// Topology-owned MachineDeployments get generated names; match the
+		// topology name instead.
+		label := "cluster.x-k8s.io/deployment-name"
+		if classBased {
+			label = "topology.cluster.x-k8s.io/deployment-name"
+		}
+		write(mdName+"-mhc", map[string]string{label: mdName}, "40%")
+	}
+	return sb.String()
+}
+
+// generateCRS returns a ConfigMap placeholder and ClusterResourceSet per add-on.
+// The ConfigMap only carries a comment pointing at the upstream manifest; the
+// real manifest must be pasted in before applying.
+func generateCRS(clusterName, namespace string, addons []addon) string {
+	var sb strings.Builder
+	nsLine := ""
+	if namespace != "" {
+		nsLine = fmt.Sprintf("  namespace: %s\n", namespace)
+	}
+	for _, a := range addons {
+		cmName := fmt.Sprintf("%s-%s-%s", clusterName, a.Name, a.Flavor)
+		source := addonSources[a.Flavor]
+		if source == "" {
+			source = "the " + a.Flavor + " installation manifest"
+		}
+
+		sb.WriteString("---\n")
+		sb.WriteString("apiVersion: v1\n")
+		sb.WriteString("kind: ConfigMap\n")
+		sb.WriteString("metadata:\n")
+		sb.WriteString(fmt.Sprintf("  name: %s\n", cmName))
+		sb.WriteString(nsLine)
+		sb.WriteString("data:\n")
+		sb.WriteString(fmt.Sprintf("  %s.yaml: |\n", a.Flavor))
+		sb.WriteString(fmt.Sprintf("    # TODO: replace with the contents of %s\n", source))
+
+		sb.WriteString("---\n")
+		sb.WriteString("apiVersion: addons.cluster.x-k8s.io/v1beta1\n")
+		sb.WriteString("kind: ClusterResourceSet\n")
+		sb.WriteString("metadata:\n")
+		sb.WriteString(fmt.Sprintf("  name: %s-%s\n", clusterName, a.Name))
+		sb.WriteString(nsLine)
+		sb.WriteString("spec:\n")
+		sb.WriteString("  strategy: ApplyOnce\n")
+		sb.WriteString("  clusterSelector:\n")
+		sb.WriteString("    matchLabels:\n")
+		sb.WriteString(fmt.Sprintf("      %s: %s-%s\n", a.Name, clusterName, a.Flavor))
+		sb.WriteString("  resources:\n")
+		sb.WriteString(fmt.Sprintf("  - name: %s\n", cmName))
+		sb.WriteString("    kind: ConfigMap\n")
+	}
+	return sb.String()
+}
+
+func generateFromClass(clusterName, className, namespace, k8sVersion string, cpReplicas int, workers []workerSpec, vars, labels map[string]string, info *clusterClassInfo) string {
 	var sb strings.Builder
 
 	sb.WriteString("apiVersion: cluster.x-k8s.io/v1beta1\n")
@@ -241,6 +1117,7 @@ func generateFromClass(clusterName, className, namespace, k8sVersion string, cpR
 	if namespace != "" {
 		sb.WriteString(fmt.Sprintf("  namespace: %s\n", namespace))
 	}
+	writeLabels(&sb, labels)
 	sb.WriteString("spec:\n")
 	sb.WriteString("  topology:\n")
 	sb.WriteString(fmt.Sprintf("    class: %s\n", className))
@@ -249,29 +1126,180 @@ func generateFromClass(clusterName, className, namespace, k8sVersion string, cpR
 	sb.WriteString(fmt.Sprintf("      replicas: %d\n", cpReplicas))
 	sb.WriteString("    workers:\n")
 	sb.WriteString("      machineDeployments:\n")
-	sb.WriteString("      - class: default-worker\n")
-	sb.WriteString(fmt.Sprintf("        name: %s-md-0\n", clusterName))
-	sb.WriteString(fmt.Sprintf("        replicas: %d\n", workerReplicas))
+	for _, w := range workers {
+		sb.WriteString(fmt.Sprintf("      - class: %s\n", w.Class))
+		sb.WriteString(fmt.Sprintf("        name: %s-%s\n", clusterName, w.Name))
+		sb.WriteString(fmt.Sprintf("        replicas: %d\n", w.Replicas))
+	}
 
 	if len(vars) > 0 {
+		defined := map[string]classVariable{}
+		if info != nil {
+			for _, cv := range info.Variables {
+				defined[cv.Name] = cv
+			}
+		}
+		names := make([]string, 0, len(vars))
+		for k := range vars {
+			names = append(names, k)
+		}
+		sort.Strings(names)
 		sb.WriteString("    variables:\n")
-		for k, v := range vars {
+		for _, k := range names {
 			sb.WriteString(fmt.Sprintf("    - name: %s\n", k))
-			sb.WriteString(fmt.Sprintf("      value: %s\n", v))
+			sb.WriteString(fmt.Sprintf("      value: %s\n", formatVarValue(vars[k], defined[k])))
 		}
 	}
 
 	return sb.String()
 }
 
-func generateFromScratch(clusterName, infraProvider, namespace, k8sVersion string, cpReplicas, workerReplicas int) string {
+// findClusterctl returns the path to the clusterctl binary, or "" if missing.
+func findClusterctl() string {
+	path, err := exec.LookPath("clusterctl")
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// generateWithClusterctl renders the provider's own cluster template through
+// "clusterctl generate cluster". --vars are exported as environment
+// variables so clusterctl can substitute them.
+func generateWithClusterctl(clusterName, infraProvider, flavor, namespace, k8sVersion, kubeconfig string, cpReplicas, workerReplicas int, vars map[string]string) (string, error) {
+	clusterctl := findClusterctl()
+	if clusterctl == "" {
+		return "", fmt.Errorf("clusterctl not found in PATH")
+	}
+	args := []string{"generate", "cluster", clusterName,
+		"--infrastructure", infraProvider,
+		"--kubernetes-version", k8sVersion,
+		"--control-plane-machine-count", strconv.Itoa(cpReplicas),
+		"--worker-machine-count", strconv.Itoa(workerReplicas),
+	}
+	if flavor != "" {
+		args = append(args, "--flavor", flavor)
+	}
+	if namespace != "" {
+		args = append(args, "--target-namespace", namespace)
+	}
+	if kubeconfig != "" {
+		args = append(args, "--kubeconfig", kubeconfig)
+	}
+
+	cmd := exec.Command(clusterctl, args...)
+	cmd.Env = os.Environ()
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("clusterctl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// templateVarPattern matches ${VAR} and ${VAR:=default} left in a template.
+var templateVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::=([^}]*))?\}`)
+
+// postProcessClusterctl substitutes leftover variables from --vars (or their
+// inline defaults), sets the namespace on objects that lack one and adds
+// labels to the Cluster. It returns the names of variables that could not be
+// resolved.
+func postProcessClusterctl(manifest, namespace string, vars, labels map[string]string) (string, []string, error) {
+	unresolved := map[string]bool{}
+	manifest = templateVarPattern.ReplaceAllStringFunc(manifest, func(m string) string {
+		sub := templateVarPattern.FindStringSubmatch(m)
+		if v, ok := vars[sub[1]]; ok {
+			return v
+		}
+		if strings.Contains(m, ":=") {
+			return sub[2]
+		}
+		unresolved[sub[1]] = true
+		return m
+	})
+
+	var sb strings.Builder
+	dec := yaml.NewDecoder(strings.NewReader(manifest))
+	first := true
+	for {
+		var obj map[string]interface{}
+		if err := dec.Decode(&obj); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", nil, fmt.Errorf("parsing clusterctl output: %w", err)
+		}
+		if obj == nil {
+			continue
+		}
+		meta, _ := obj["metadata"].(map[string]interface{})
+		if meta == nil {
+			meta = map[string]interface{}{}
+			obj["metadata"] = meta
+		}
+		if _, ok := meta["namespace"]; !ok && namespace != "" && obj["kind"] != "Namespace" {
+			meta["namespace"] = namespace
+		}
+		if obj["kind"] == "Cluster" && len(labels) > 0 {
+			objLabels, _ := meta["labels"].(map[string]interface{})
+			if objLabels == nil {
+				objLabels = map[string]interface{}{}
+				meta["labels"] = objLabels
+			}
+			for k, v := range labels {
+				objLabels[k] = v
+			}
+		}
+
+		if !first {
+			sb.WriteString("---\n")
+		}
+		first = false
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(obj); err != nil {
+			return "", nil, err
+		}
+		enc.Close()
+		sb.Write(buf.Bytes())
+	}
+
+	missing := make([]string, 0, len(unresolved))
+	for name := range unresolved {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	return sb.String(), missing, nil
+}
+
+// nsField returns a namespace line at the given indent, or nothing when no
+// namespace is set.
+func nsField(namespace string, indent int) string {
+	if namespace == "" {
+		return ""
+	}
+	return fmt.Sprintf("%snamespace: %s\n", strings.Repeat(" ", indent), namespace)
+}
+
+func generateFromScratch(clusterName, infraProvider, namespace, k8sVersion string, cpReplicas int, workers []workerSpec, machinePool bool, labels map[string]string) string {
 	infra, ok := infraProviderTemplates[infraProvider]
 	if !ok {
-		fmt.Fprintf(os.Stderr, "Unknown infra provider: %s\nAvailable: ", infraProvider)
+		names := make([]string, 0, len(infraProviderTemplates))
 		for k := range infraProviderTemplates {
-			fmt.Fprintf(os.Stderr, "%s ", k)
+			names = append(names, k)
 		}
-		fmt.Fprintln(os.Stderr)
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "Unknown infra provider: %s\nAvailable: %s\n", infraProvider, strings.Join(names, " "))
+		fmt.Fprintln(os.Stderr, "Describe other providers with --infra-custom kind=FooCluster,group=...,version=...")
+		os.Exit(1)
+	}
+	if machinePool && infra.MachinePoolKind == "" {
+		fmt.Fprintf(os.Stderr, "Infra provider %s has no machine pool kind; use MachineDeployment workers instead\n", infraProvider)
+		fmt.Fprintln(os.Stderr, "For a custom provider, name the kind with --infra-custom ...,machinepool=FooMachinePool")
 		os.Exit(1)
 	}
 
@@ -287,6 +1315,7 @@ func generateFromScratch(clusterName, infraProvider, namespace, k8sVersion strin
 	sb.WriteString("metadata:\n")
 	sb.WriteString(fmt.Sprintf("  name: %s\n", clusterName))
 	sb.WriteString(nsLine)
+	writeLabels(&sb, labels)
 	sb.WriteString("spec:\n")
 	sb.WriteString("  clusterNetwork:\n")
 	sb.WriteString("    pods:\n")
@@ -299,12 +1328,12 @@ func generateFromScratch(clusterName, infraProvider, namespace, k8sVersion strin
 	sb.WriteString(fmt.Sprintf("    apiVersion: %s/%s\n", infra.APIGroup, infra.APIVersion))
 	sb.WriteString(fmt.Sprintf("    kind: %s\n", infra.ClusterKind))
 	sb.WriteString(fmt.Sprintf("    name: %s\n", clusterName))
-	sb.WriteString(nsLine)
+	sb.WriteString(nsField(namespace, 4))
 	sb.WriteString("  controlPlaneRef:\n")
 	sb.WriteString("    apiVersion: controlplane.cluster.x-k8s.io/v1beta1\n")
 	sb.WriteString("    kind: KubeadmControlPlane\n")
 	sb.WriteString(fmt.Sprintf("    name: %s-control-plane\n", clusterName))
-	sb.WriteString(nsLine)
+	sb.WriteString(nsField(namespace, 4))
 
 	// Infra cluster
 	sb.WriteString("---\n")
@@ -330,7 +1359,7 @@ func generateFromScratch(clusterName, infraProvider, namespace, k8sVersion strin
 	sb.WriteString(fmt.Sprintf("      apiVersion: %s/%s\n", infra.APIGroup, infra.APIVersion))
 	sb.WriteString(fmt.Sprintf("      kind: %s\n", infra.TemplateKind))
 	sb.WriteString(fmt.Sprintf("      name: %s-control-plane\n", clusterName))
-	sb.WriteString(nsLine)
+	sb.WriteString(nsField(namespace, 6))
 	sb.WriteString("  kubeadmConfigSpec:\n")
 	sb.WriteString("    initConfiguration:\n")
 	sb.WriteString("      nodeRegistration:\n")
@@ -350,18 +1379,84 @@ func generateFromScratch(clusterName, infraProvider, namespace, k8sVersion strin
 	sb.WriteString("  template:\n")
 	sb.WriteString("    spec: {}\n")
 
-	// MachineDeployment
+	for _, w := range workers {
+		workerName := clusterName + "-" + w.Name
+		if machinePool {
+			writeMachinePoolWorker(&sb, clusterName, workerName, namespace, k8sVersion, w.Replicas, infra.APIGroup+"/"+infra.APIVersion, infra.MachinePoolKind)
+			continue
+		}
+
+		// MachineDeployment
+		sb.WriteString("---\n")
+		sb.WriteString("apiVersion: cluster.x-k8s.io/v1beta1\n")
+		sb.WriteString("kind: MachineDeployment\n")
+		sb.WriteString("metadata:\n")
+		sb.WriteString(fmt.Sprintf("  name: %s\n", workerName))
+		sb.WriteString(nsLine)
+		sb.WriteString("spec:\n")
+		sb.WriteString(fmt.Sprintf("  clusterName: %s\n", clusterName))
+		sb.WriteString(fmt.Sprintf("  replicas: %d\n", w.Replicas))
+		sb.WriteString("  selector:\n")
+		sb.WriteString("    matchLabels: {}\n")
+		sb.WriteString("  template:\n")
+		sb.WriteString("    spec:\n")
+		sb.WriteString(fmt.Sprintf("      clusterName: %s\n", clusterName))
+		sb.WriteString(fmt.Sprintf("      version: %s\n", k8sVersion))
+		sb.WriteString("      bootstrap:\n")
+		sb.WriteString("        configRef:\n")
+		sb.WriteString("          apiVersion: bootstrap.cluster.x-k8s.io/v1beta1\n")
+		sb.WriteString("          kind: KubeadmConfigTemplate\n")
+		sb.WriteString(fmt.Sprintf("          name: %s\n", workerName))
+		sb.WriteString(nsField(namespace, 10))
+		sb.WriteString("      infrastructureRef:\n")
+		sb.WriteString(fmt.Sprintf("        apiVersion: %s/%s\n", infra.APIGroup, infra.APIVersion))
+		sb.WriteString(fmt.Sprintf("        kind: %s\n", infra.TemplateKind))
+		sb.WriteString(fmt.Sprintf("        name: %s\n", workerName))
+		sb.WriteString(nsField(namespace, 8))
+
+		// Worker machine template
+		sb.WriteString("---\n")
+		sb.WriteString(fmt.Sprintf("apiVersion: %s/%s\n", infra.APIGroup, infra.APIVersion))
+		sb.WriteString(fmt.Sprintf("kind: %s\n", infra.TemplateKind))
+		sb.WriteString("metadata:\n")
+		sb.WriteString(fmt.Sprintf("  name: %s\n", workerName))
+		sb.WriteString(nsLine)
+		sb.WriteString("spec:\n")
+		sb.WriteString("  template:\n")
+		sb.WriteString("    spec: {}\n")
+
+		// KubeadmConfigTemplate
+		sb.WriteString("---\n")
+		sb.WriteString("apiVersion: bootstrap.cluster.x-k8s.io/v1beta1\n")
+		sb.WriteString("kind: KubeadmConfigTemplate\n")
+		sb.WriteString("metadata:\n")
+		sb.WriteString(fmt.Sprintf("  name: %s\n", workerName))
+		sb.WriteString(nsLine)
+		sb.WriteString("spec:\n")
+		sb.WriteString("  template:\n")
+		sb.WriteString("    spec:\n")
+		sb.WriteString("      joinConfiguration:\n")
+		sb.WriteString("        nodeRegistration:\n")
+		sb.WriteString("          kubeletExtraArgs: {}\n")
+	}
+
+	return sb.String()
+}
+
+// writeMachinePoolWorker emits one worker as a MachinePool backed by the
+// provider's machine pool kind and a KubeadmConfig.
+func writeMachinePoolWorker(sb *strings.Builder, clusterName, workerName, namespace, k8sVersion string, workerReplicas int, infraAPIVersion, poolKind string) {
+	nsLine := nsField(namespace, 2)
+	// MachinePool
 	sb.WriteString("---\n")
 	sb.WriteString("apiVersion: cluster.x-k8s.io/v1beta1\n")
-	sb.WriteString("kind: MachineDeployment\n")
+	sb.WriteString("kind: MachinePool\n")
 	sb.WriteString("metadata:\n")
-	sb.WriteString(fmt.Sprintf("  name: %s-md-0\n", clusterName))
+	sb.WriteString(fmt.Sprintf("  name: %s\n", workerName))
 	sb.WriteString(nsLine)
 	sb.WriteString("spec:\n")
 	sb.WriteString(fmt.Sprintf("  clusterName: %s\n", clusterName))
 	sb.WriteString(fmt.Sprintf("  replicas: %d\n", workerReplicas))
-	sb.WriteString("  selector:\n")
-	sb.WriteString("    matchLabels: {}\n")
 	sb.WriteString("  template:\n")
 	sb.WriteString("    spec:\n")
 	sb.WriteString(fmt.Sprintf("      clusterName: %s\n", clusterName))
@@ -369,41 +1464,220 @@ func generateFromScratch(clusterName, infraProvider, namespace, k8sVersion strin
 	sb.WriteString("      bootstrap:\n")
 	sb.WriteString("        configRef:\n")
 	sb.WriteString("          apiVersion: bootstrap.cluster.x-k8s.io/v1beta1\n")
-	sb.WriteString("          kind: KubeadmConfigTemplate\n")
-	sb.WriteString(fmt.Sprintf("          name: %s-md-0\n", clusterName))
-	sb.WriteString(nsLine)
+	sb.WriteString("          kind: KubeadmConfig\n")
+	sb.WriteString(fmt.Sprintf("          name: %s\n", workerName))
+	sb.WriteString(nsField(namespace, 10))
 	sb.WriteString("      infrastructureRef:\n")
-	sb.WriteString(fmt.Sprintf("        apiVersion: %s/%s\n", infra.APIGroup, infra.APIVersion))
-	sb.WriteString(fmt.Sprintf("        kind: %s\n", infra.TemplateKind))
-	sb.WriteString(fmt.Sprintf("        name: %s-md-0\n", clusterName))
-	sb.WriteString(nsLine)
+	sb.WriteString(fmt.Sprintf("        apiVersion: %s\n", infraAPIVersion))
+	sb.WriteString(fmt.Sprintf("        kind: %s\n", poolKind))
+	sb.WriteString(fmt.Sprintf("        name: %s\n", workerName))
+	sb.WriteString(nsField(namespace, 8))
 
-	// Worker machine template
+	// Infra machine pool
 	sb.WriteString("---\n")
-	sb.WriteString(fmt.Sprintf("apiVersion: %s/%s\n", infra.APIGroup, infra.APIVersion))
-	sb.WriteString(fmt.Sprintf("kind: %s\n", infra.TemplateKind))
+	sb.WriteString(fmt.Sprintf("apiVersion: %s\n", infraAPIVersion))
+	sb.WriteString(fmt.Sprintf("kind: %s\n", poolKind))
 	sb.WriteString("metadata:\n")
-	sb.WriteString(fmt.Sprintf("  name: %s-md-0\n", clusterName))
+	sb.WriteString(fmt.Sprintf("  name: %s\n", workerName))
 	sb.WriteString(nsLine)
-	sb.WriteString("spec:\n")
-	sb.WriteString("  template:\n")
-	sb.WriteString("    spec: {}\n")
+	sb.WriteString("spec: {}\n")
 
-	// KubeadmConfigTemplate
+	// KubeadmConfig (MachinePools reference a config, not a config template)
 	sb.WriteString("---\n")
 	sb.WriteString("apiVersion: bootstrap.cluster.x-k8s.io/v1beta1\n")
-	sb.WriteString("kind: KubeadmConfigTemplate\n")
+	sb.WriteString("kind: KubeadmConfig\n")
 	sb.WriteString("metadata:\n")
-	sb.WriteString(fmt.Sprintf("  name: %s-md-0\n", clusterName))
+	sb.WriteString(fmt.Sprintf("  name: %s\n", workerName))
 	sb.WriteString(nsLine)
 	sb.WriteString("spec:\n")
-	sb.WriteString("  template:\n")
-	sb.WriteString("    spec:\n")
-	sb.WriteString("      joinConfiguration:\n")
-	sb.WriteString("        nodeRegistration:\n")
-	sb.WriteString("          kubeletExtraArgs: {}\n")
+	sb.WriteString("  joinConfiguration:\n")
+	sb.WriteString("    nodeRegistration:\n")
+	sb.WriteString("      kubeletExtraArgs: {}\n")
+}
 
-	return sb.String()
+// overlayEnv describes one kustomize overlay. Replicas are derived from the
+// base: dev runs a single control plane node and one node per worker, staging
+// keeps the base workers with at most three control plane nodes, and prod
+// keeps the base with at least three control plane nodes.
+type overlayEnv struct {
+	Name      string
+	CPReplica func(base int) int
+	Workers   func(base int) int
+}
+
+var overlayEnvs = []overlayEnv{
+	{"dev", func(int) int { return 1 }, func(int) int { return 1 }},
+	{"staging", func(b int) int { return minInt(b, 3) }, func(b int) int { return b }},
+	{"prod", func(b int) int { return maxInt(b, 3) }, func(b int) int { return b }},
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// kustomizePatch is a JSON 6902 patch for one object of the base.
+type kustomizePatch struct {
+	Group, Version, Kind, Name string
+	Ops                        []patchOp
+}
+
+type patchOp struct {
+	Path  string
+	Value interface{}
+	Base  int  // base replica count, for replica ops
+	CP    bool // control plane replicas (vs. worker replicas)
+}
+
+// replicaCount reads an int replica value; templated values (${VAR}) count as 1.
+func replicaCount(v interface{}) int {
+	if n, ok := v.(int); ok {
+		return n
+	}
+	return 1
+}
+
+// appendVersionOp adds a version replace op when the base sets a version; a
+// replace on a missing field would fail, and a nil Value marks replica ops.
+func appendVersionOp(ops []patchOp, path string, version interface{}) []patchOp {
+	if version == nil {
+		return ops
+	}
+	return append(ops, patchOp{Path: path, Value: version})
+}
+
+// basePatches finds the replica and version fields of the generated objects:
+// the topology of a ClusterClass-based Cluster, or the KubeadmControlPlane and
+// worker MachineDeployments/MachinePools of a from-scratch template.
+func basePatches(manifest string) ([]kustomizePatch, error) {
+	var patches []kustomizePatch
+	dec := yaml.NewDecoder(strings.NewReader(manifest))
+	for {
+		var obj map[string]interface{}
+		if err := dec.Decode(&obj); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parsing generated template: %w", err)
+		}
+		if obj == nil {
+			continue
+		}
+		apiVersion, _ := obj["apiVersion"].(string)
+		group, version := "", apiVersion
+		if i := strings.Index(apiVersion, "/"); i > 0 {
+			group, version = apiVersion[:i], apiVersion[i+1:]
+		}
+		patch := kustomizePatch{
+			Group:   group,
+			Version: version,
+			Kind:    kubectl.GetString(obj, "kind"),
+			Name:    kubectl.GetString(obj, "metadata.name"),
+		}
+		spec := kubectl.GetMap(obj, "spec")
+
+		switch patch.Kind {
+		case "Cluster":
+			topology, ok := spec["topology"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			patch.Ops = appendVersionOp(patch.Ops, "/spec/topology/version", topology["version"])
+			if cp, ok := topology["controlPlane"].(map[string]interface{}); ok {
+				patch.Ops = append(patch.Ops, patchOp{Path: "/spec/topology/controlPlane/replicas", Base: replicaCount(cp["replicas"]), CP: true})
+			}
+			mds, _ := kubectl.GetNested(topology, "workers.machineDeployments").([]interface{})
+			for i, md := range mds {
+				mdMap, _ := md.(map[string]interface{})
+				patch.Ops = append(patch.Ops, patchOp{Path: fmt.Sprintf("/spec/topology/workers/machineDeployments/%d/replicas", i), Base: replicaCount(mdMap["replicas"])})
+			}
+		case "KubeadmControlPlane":
+			patch.Ops = appendVersionOp(patch.Ops, "/spec/version", spec["version"])
+			patch.Ops = append(patch.Ops, patchOp{Path: "/spec/replicas", Base: replicaCount(spec["replicas"]), CP: true})
+		case "MachineDeployment", "MachinePool":
+			patch.Ops = appendVersionOp(patch.Ops, "/spec/template/spec/version", kubectl.GetNested(spec, "template.spec.version"))
+			patch.Ops = append(patch.Ops, patchOp{Path: "/spec/replicas", Base: replicaCount(spec["replicas"])})
+		default:
+			continue
+		}
+		patches = append(patches, patch)
+	}
+	return patches, nil
+}
+
+// writeKustomize lays out the template as a kustomize base plus dev, staging
+// and prod overlays that patch replica counts and the Kubernetes version, so
+// each environment can be scaled and upgraded on its own.
+func writeKustomize(dir, manifest string) error {
+	patches, err := basePatches(manifest)
+	if err != nil {
+		return err
+	}
+
+	files := map[string]string{
+		"base/cluster.yaml":       manifest,
+		"base/kustomization.yaml": "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n- cluster.yaml\n",
+	}
+	for _, env := range overlayEnvs {
+		var sb strings.Builder
+		sb.WriteString("apiVersion: kustomize.config.k8s.io/v1beta1\n")
+		sb.WriteString("kind: Kustomization\n")
+		sb.WriteString("resources:\n")
+		sb.WriteString("- ../../base\n")
+		if len(patches) > 0 {
+			sb.WriteString("patches:\n")
+		}
+		for _, p := range patches {
+			sb.WriteString("- target:\n")
+			if p.Group != "" {
+				sb.WriteString(fmt.Sprintf("    group: %s\n", p.Group))
+			}
+			sb.WriteString(fmt.Sprintf("    version: %s\n", p.Version))
+			sb.WriteString(fmt.Sprintf("    kind: %s\n", p.Kind))
+			// Target names are regular expressions; templated names contain ${}.
+			sb.WriteString(fmt.Sprintf("    name: %s\n", regexp.QuoteMeta(p.Name)))
+			sb.WriteString("  patch: |-\n")
+			for _, op := range p.Ops {
+				value := op.Value
+				if value == nil {
+					if op.CP {
+						value = env.CPReplica(op.Base)
+					} else {
+						value = env.Workers(op.Base)
+					}
+				}
+				sb.WriteString("    - op: replace\n")
+				sb.WriteString(fmt.Sprintf("      path: %s\n", op.Path))
+				sb.WriteString(fmt.Sprintf("      value: %v\n", value))
+			}
+		}
+		files[filepath.Join("overlays", env.Name, "kustomization.yaml")] = sb.String()
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(full, []byte(files[path]), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "  %s\n", full)
+	}
+	return nil
 }
 
 func main() {
@@ -413,13 +1687,25 @@ func main() {
 	kubeconfig := flag.String("kubeconfig", "", "Path to kubeconfig")
 	k8sVersion := flag.String("k8s-version", "v1.28.0", "Kubernetes version")
 	cpReplicas := flag.Int("cp-replicas", 3, "Control plane replicas")
-	workerReplicas := flag.Int("worker-replicas", 3, "Worker replicas")
+	workerReplicas := flag.Int("worker-replicas", 3, "Worker replicas for workers that do not set replicas")
+	var mdFlags workerFlags
+	flag.Var(&mdFlags, "md", "Worker as name=gpu,replicas=2,class=gpu-worker (repeatable)")
+	workersSpec := flag.String("workers-spec", "", "YAML file listing workers (name, class, replicas)")
 	infraProvider := flag.String("infra", "docker", "Infrastructure provider (for --from-scratch)")
+	infraCustom := flag.String("infra-custom", "", "Kinds of an unlisted --infra provider as kind=FooCluster,group=...,version=...[,machine=,template=,machinepool=]")
 	fromScratch := flag.Bool("from-scratch", false, "Generate without ClusterClass")
+	useClusterctl := flag.Bool("use-clusterctl", false, "Render the provider template with 'clusterctl generate cluster', falling back to --from-scratch")
+	flavor := flag.String("flavor", "", "clusterctl template flavor (for --use-clusterctl)")
+	fromExisting := flag.String("from-existing", "", "Export a live Cluster (and referenced objects) as a parameterized template")
+	machinePool := flag.Bool("machinepool", false, "Use MachinePool workers instead of MachineDeployment (for --from-scratch)")
 	listClasses := flag.Bool("list-classes", false, "List available ClusterClasses")
 	showInfo := flag.Bool("info", false, "Show ClusterClass info (requires --class)")
-	output := flag.String("o", "", "Output file (default: stdout)")
-	varsStr := flag.String("vars", "", "ClusterClass variables as key=value,key=value")
+	output := flag.String("o", "", "Output file (default: stdout), or directory with --output-format kustomize")
+	outputFormat := flag.String("output-format", "yaml", "Output format: yaml or kustomize (base plus dev/staging/prod overlays)")
+	varsStr := flag.String("vars", "", "ClusterClass (or clusterctl template) variables as key=value,key=value")
+	withMHC := flag.Bool("with-mhc", false, "Append MachineHealthChecks for the control plane and workers (for --class/--from-scratch)")
+	withCRS := flag.String("with-crs", "", "Append ClusterResourceSet add-ons as name=flavor,... e.g. cni=calico (for --class/--from-scratch)")
+	interactive := flag.Bool("interactive", false, "Prompt for required ClusterClass variables missing from --vars")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "CAPI Cluster Template Generator\nUsage: %s [flags]\n\nFlags:\n", os.Args[0])
@@ -446,26 +1732,142 @@ func main() {
 		return
 	}
 
+	workers := []workerSpec(mdFlags)
+	if *workersSpec != "" {
+		fromFile, err := loadWorkersSpec(*workersSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		workers = append(workers, fromFile...)
+	}
+	if *infraCustom != "" {
+		kinds, err := parseInfraCustom(*infraCustom)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --infra-custom: %v\n", err)
+			os.Exit(1)
+		}
+		infraProviderTemplates[*infraProvider] = kinds
+	}
+
+	scratch := *fromScratch || *useClusterctl
+	if scratch {
+		for _, w := range workers {
+			if w.Class != "" {
+				fmt.Fprintf(os.Stderr, "Warning: worker %s: class %q is ignored without --class; each worker gets its own templates\n", w.Name, w.Class)
+			}
+		}
+	}
+	if *machinePool && !scratch && *fromExisting == "" {
+		fmt.Fprintln(os.Stderr, "Warning: --machinepool only applies to --from-scratch and --use-clusterctl; generating MachineDeployments")
+	}
+	workers, err := resolveWorkers(workers, *workerReplicas, scratch && *machinePool)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var addons []addon
+	if *withCRS != "" {
+		if addons, err = parseAddons(*withCRS); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	labels := addonLabels(*clusterName, addons)
+
+	vars := map[string]string{}
+	if *varsStr != "" {
+		vars = parseVars(*varsStr)
+	}
+
 	var result string
-	if *fromScratch {
-		result = generateFromScratch(*clusterName, *infraProvider, *namespace, *k8sVersion, *cpReplicas, *workerReplicas)
+	if *fromExisting != "" {
+		result, err = generateFromExisting(*fromExisting, *namespace, *kubeconfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if *useClusterctl {
+		if len(workers) > 1 {
+			fmt.Fprintln(os.Stderr, "Warning: clusterctl templates have a single worker group; using the first worker's replicas")
+		}
+		f := *flavor
+		if f == "" && *machinePool {
+			f = "machinepool"
+		}
+		result, err = generateWithClusterctl(*clusterName, *infraProvider, f, *namespace, *k8sVersion, *kubeconfig, *cpReplicas, workers[0].Replicas, vars)
+		if err == nil {
+			var missing []string
+			result, missing, err = postProcessClusterctl(result, *namespace, vars, labels)
+			if len(missing) > 0 {
+				fmt.Fprintf(os.Stderr, "Warning: unresolved template variables (set them with --vars): %s\n", strings.Join(missing, ", "))
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\nFalling back to the built-in generator\n", err)
+			result = generateFromScratch(*clusterName, *infraProvider, *namespace, *k8sVersion, *cpReplicas, workers, *machinePool, labels)
+		}
+	} else if *fromScratch {
+		result = generateFromScratch(*clusterName, *infraProvider, *namespace, *k8sVersion, *cpReplicas, workers, *machinePool, labels)
 	} else if *className != "" {
-		vars := map[string]string{}
-		if *varsStr != "" {
-			for _, pair := range strings.Split(*varsStr, ",") {
-				kv := strings.SplitN(pair, "=", 2)
-				if len(kv) == 2 {
-					vars[kv[0]] = kv[1]
+		info := getClusterClassInfo(*className, *namespace, *kubeconfig)
+		if info == nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not read ClusterClass '%s'; variables are not validated\n", *className)
+		} else {
+			if *interactive {
+				promptMissingVars(info, vars)
+			}
+			if errs := validateVars(info, vars); len(errs) > 0 {
+				fmt.Fprintf(os.Stderr, "Error: invalid variables for ClusterClass %s:\n", *className)
+				for _, e := range errs {
+					fmt.Fprintf(os.Stderr, "  - %s\n", e)
 				}
+				os.Exit(1)
 			}
 		}
-		result = generateFromClass(*clusterName, *className, *namespace, *k8sVersion, *cpReplicas, *workerReplicas, vars)
+		result = generateFromClass(*clusterName, *className, *namespace, *k8sVersion, *cpReplicas, workers, vars, labels, info)
 	} else {
-		fmt.Fprintln(os.Stderr, "Error: specify --class or --from-scratch")
+		fmt.Fprintln(os.Stderr, "Error: specify --class, --from-scratch, --use-clusterctl or --from-existing")
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	if scratch && *machinePool && *fromExisting == "" {
+		fmt.Fprintln(os.Stderr, "Note: MachinePools require the MachinePool feature gate (EXP_MACHINE_POOL=true)")
+	}
+
+	if *fromExisting == "" {
+		if *withMHC {
+			result += generateMHCs(*clusterName, *namespace, workers, !scratch, scratch && *machinePool)
+			if scratch && *machinePool {
+				fmt.Fprintln(os.Stderr, "Note: only the control plane gets a MachineHealthCheck; MachinePool instances are remediated by the provider")
+			}
+		}
+		if len(addons) > 0 {
+			result += generateCRS(*clusterName, *namespace, addons)
+			fmt.Fprintln(os.Stderr, "Note: fill in the generated add-on ConfigMaps before applying the template")
+		}
+	}
+
+	switch *outputFormat {
+	case "yaml":
+	case "kustomize":
+		if *output == "" {
+			fmt.Fprintln(os.Stderr, "Error: --output-format kustomize requires -o <directory>")
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Kustomize layout written to %s:\n", *output)
+		if err := writeKustomize(*output, result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing kustomize layout: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown --output-format %q (expected yaml or kustomize)\n", *outputFormat)
+		os.Exit(1)
+	}
+
 	if *output != "" {
 		dir := filepath.Dir(*output)
 		if dir != "." {
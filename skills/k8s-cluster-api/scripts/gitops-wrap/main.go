@@ -0,0 +1,634 @@
+// gitops-wrap packages cluster manifests for delivery through Flux or Argo CD.
+//
+// It reads generated cluster templates or export-cluster-state bundles,
+// strips runtime fields, drops objects that controllers create themselves
+// (Machines, MachineSets, KubeadmConfigs, generated Secrets, objects the
+// topology controller generates for ClusterClass-based clusters, ...) and
+// orders the rest into waves:
+//
+//	prereqs   Namespaces, Secrets, ConfigMaps, ClusterResourceSets, identities
+//	classes   ClusterClasses and *Template objects
+//	cluster   Cluster, infrastructure cluster, control plane
+//	workers   MachineDeployments, MachinePools, MachineHealthChecks
+//
+// Flux output is one Kustomization per wave chained with dependsOn and a
+// health check on the Cluster (or a HelmRelease over a generated chart).
+// Argo CD output is an Application with sync-wave annotations on every
+// object plus the argocd-cm health checks CAPI resources need.
+//
+// Usage:
+//
+//	go run ./gitops-wrap [flags] <file-or-directory>
+//
+// Examples:
+//
+//	go run ./gitops-wrap --tool flux --repo-url https://github.com/org/fleet --out ./clusters/my-cluster ./my-cluster.yaml
+//	go run ./gitops-wrap --tool flux --flux-kind helmrelease --out ./clusters/my-cluster ./my-cluster.yaml
+//	go run ./gitops-wrap --tool argo --repo-url https://github.com/org/fleet --path clusters/my-cluster --out ./clusters/my-cluster ./backup/
+//	go run ./gitops-wrap --tool argo ./my-cluster.yaml > wrapped.yaml
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type wave struct {
+	Name  string
+	Index int // Argo CD sync wave
+}
+
+var waves = []wave{
+	{"prereqs", -2},
+	{"classes", -1},
+	{"cluster", 0},
+	{"workers", 1},
+}
+
+type options struct {
+	tool        string
+	fluxKind    string
+	name        string
+	repoURL     string
+	revision    string
+	repoPath    string
+	gitopsNS    string
+	destination string
+	interval    string
+	prune       bool
+}
+
+type object struct {
+	doc  map[string]interface{}
+	kind string
+	name string
+	wave string
+}
+
+func (o object) String() string { return o.kind + "/" + o.name }
+
+// controllerOwned are kinds created and managed by CAPI controllers; putting
+// them under GitOps control makes the GitOps tool fight the controllers.
+var controllerOwned = map[string]bool{
+	"Machine":                   true,
+	"MachineSet":                true,
+	"KubeadmConfig":             true,
+	"ClusterResourceSetBinding": true,
+	"IPAddress":                 true,
+	"IPAddressClaim":            true,
+	"MachinePoolMachine":        true,
+	"CustomResourceDefinition":  true,
+}
+
+var generatedSecretSuffixes = []string{"-kubeconfig", "-ca", "-etcd", "-proxy", "-sa"}
+
+func findYAMLFiles(root string) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+	var files []string
+	err = filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := filepath.Ext(path); !fi.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+func loadDocs(root string) ([]map[string]interface{}, error) {
+	files, err := findYAMLFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	var docs []map[string]interface{}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var doc map[string]interface{}
+			if err := decoder.Decode(&doc); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if doc == nil {
+				continue
+			}
+			if kind, _ := doc["kind"].(string); strings.HasSuffix(kind, "List") {
+				items, _ := doc["items"].([]interface{})
+				for _, item := range items {
+					if m, ok := item.(map[string]interface{}); ok {
+						docs = append(docs, m)
+					}
+				}
+				continue
+			}
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+func metadata(doc map[string]interface{}) map[string]interface{} {
+	m, _ := doc["metadata"].(map[string]interface{})
+	if m == nil {
+		m = map[string]interface{}{}
+		doc["metadata"] = m
+	}
+	return m
+}
+
+// clean removes fields set by the API server or controllers.
+func clean(doc map[string]interface{}) {
+	delete(doc, "status")
+	meta := metadata(doc)
+	for _, k := range []string{"uid", "resourceVersion", "creationTimestamp", "generation", "managedFields", "ownerReferences", "selfLink", "deletionTimestamp", "deletionGracePeriodSeconds"} {
+		delete(meta, k)
+	}
+	if ann, ok := meta["annotations"].(map[string]interface{}); ok {
+		delete(ann, "kubectl.kubernetes.io/last-applied-configuration")
+		if len(ann) == 0 {
+			delete(meta, "annotations")
+		}
+	}
+}
+
+// classify returns the wave of a kind, or "" if the object is skipped.
+func classify(kind, name, clusterName string) string {
+	if controllerOwned[kind] {
+		return ""
+	}
+	switch {
+	case kind == "Secret":
+		for _, suffix := range generatedSecretSuffixes {
+			if clusterName != "" && name == clusterName+suffix {
+				return ""
+			}
+		}
+		return "prereqs"
+	case kind == "Namespace", kind == "ConfigMap", kind == "ClusterResourceSet",
+		strings.HasSuffix(kind, "Identity"), strings.HasSuffix(kind, "IdentityRef"):
+		return "prereqs"
+	case kind == "ClusterClass", strings.HasSuffix(kind, "Template"):
+		return "classes"
+	case kind == "MachineDeployment", kind == "MachineHealthCheck", strings.HasSuffix(kind, "MachinePool"):
+		return "workers"
+	case strings.HasSuffix(kind, "Machine"):
+		// infrastructure machines belong to Machines, which controllers own
+		return ""
+	}
+	return "cluster"
+}
+
+func collect(docs []map[string]interface{}) ([]object, []string, string) {
+	clusterName := ""
+	for _, doc := range docs {
+		if kind, _ := doc["kind"].(string); kind == "Cluster" {
+			clusterName, _ = metadata(doc)["name"].(string)
+			break
+		}
+	}
+
+	var objs []object
+	var skipped []string
+	for _, doc := range docs {
+		kind, _ := doc["kind"].(string)
+		name, _ := metadata(doc)["name"].(string)
+		o := object{doc: doc, kind: kind, name: name, wave: classify(kind, name, clusterName)}
+		// The topology controller owns what it generates from a ClusterClass;
+		// only the Cluster and the class templates belong in Git.
+		labels, _ := metadata(doc)["labels"].(map[string]interface{})
+		if _, owned := labels["topology.cluster.x-k8s.io/owned"]; owned {
+			o.wave = ""
+		}
+		if o.wave == "" {
+			skipped = append(skipped, o.String())
+			continue
+		}
+		clean(doc)
+		objs = append(objs, o)
+	}
+	return objs, skipped, clusterName
+}
+
+func marshalDocs(docs []map[string]interface{}) string {
+	var b bytes.Buffer
+	for i, doc := range docs {
+		if i > 0 {
+			b.WriteString("---\n")
+		}
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		enc.Encode(doc)
+		enc.Close()
+	}
+	return b.String()
+}
+
+func waveDocs(objs []object, w string) []map[string]interface{} {
+	var docs []map[string]interface{}
+	for _, o := range objs {
+		if o.wave == w {
+			docs = append(docs, o.doc)
+		}
+	}
+	return docs
+}
+
+func gitRepository(opts options) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "source.toolkit.fluxcd.io/v1",
+		"kind":       "GitRepository",
+		"metadata":   map[string]interface{}{"name": opts.name, "namespace": opts.gitopsNS},
+		"spec": map[string]interface{}{
+			"interval": opts.interval,
+			"url":      opts.repoURL,
+			"ref":      map[string]interface{}{"branch": opts.revision},
+		},
+	}
+}
+
+func fluxKustomizations(opts options, objs []object, clusterName, namespace string) []map[string]interface{} {
+	var docs []map[string]interface{}
+	prev := ""
+	for _, w := range waves {
+		if len(waveDocs(objs, w.Name)) == 0 {
+			continue
+		}
+		name := opts.name + "-" + w.Name
+		spec := map[string]interface{}{
+			"interval":  opts.interval,
+			"path":      "./" + filepath.ToSlash(filepath.Join(opts.repoPath, "manifests", w.Name)),
+			"prune":     opts.prune,
+			"sourceRef": map[string]interface{}{"kind": "GitRepository", "name": opts.name},
+			"timeout":   "5m",
+		}
+		if prev != "" {
+			spec["dependsOn"] = []interface{}{map[string]interface{}{"name": prev}}
+		}
+		if w.Name == "cluster" && clusterName != "" {
+			// Cluster reports Ready once the control plane and infrastructure
+			// are up, which kstatus understands.
+			spec["timeout"] = "30m"
+			spec["healthChecks"] = []interface{}{map[string]interface{}{
+				"apiVersion": "cluster.x-k8s.io/v1beta1",
+				"kind":       "Cluster",
+				"name":       clusterName,
+				"namespace":  namespace,
+			}}
+		}
+		docs = append(docs, map[string]interface{}{
+			"apiVersion": "kustomize.toolkit.fluxcd.io/v1",
+			"kind":       "Kustomization",
+			"metadata":   map[string]interface{}{"name": name, "namespace": opts.gitopsNS},
+			"spec":       spec,
+		})
+		prev = name
+	}
+	return docs
+}
+
+func fluxHelmRelease(opts options, namespace string) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "helm.toolkit.fluxcd.io/v2",
+		"kind":       "HelmRelease",
+		"metadata":   map[string]interface{}{"name": opts.name, "namespace": opts.gitopsNS},
+		"spec": map[string]interface{}{
+			"interval":        opts.interval,
+			"targetNamespace": namespace,
+			"timeout":         "30m",
+			"chart": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"chart":     "./" + filepath.ToSlash(filepath.Join(opts.repoPath, "chart")),
+					"sourceRef": map[string]interface{}{"kind": "GitRepository", "name": opts.name},
+				},
+			},
+			// keep the cluster when the release is removed by accident
+			"uninstall": map[string]interface{}{"keepHistory": true},
+			"install":   map[string]interface{}{"disableWait": false},
+		},
+	}
+}
+
+// helmEscape protects Go template braces in manifests (e.g. cloud-init
+// Jinja such as {{ ds.meta_data.hostname }}) from Helm rendering.
+func helmEscape(s string) string {
+	s = strings.ReplaceAll(s, "{{", "\x00")
+	s = strings.ReplaceAll(s, "}}", `{{ "}}" }}`)
+	return strings.ReplaceAll(s, "\x00", `{{ "{{" }}`)
+}
+
+func argoApplication(opts options, namespace string) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata":   map[string]interface{}{"name": opts.name, "namespace": opts.gitopsNS},
+		"spec": map[string]interface{}{
+			"project": "default",
+			"source": map[string]interface{}{
+				"repoURL":        opts.repoURL,
+				"targetRevision": opts.revision,
+				"path":           filepath.ToSlash(filepath.Join(opts.repoPath, "manifests")),
+			},
+			"destination": map[string]interface{}{"server": opts.destination, "namespace": namespace},
+			"syncPolicy": map[string]interface{}{
+				"automated":   map[string]interface{}{"prune": opts.prune, "selfHeal": true},
+				"syncOptions": []interface{}{"ServerSideApply=true", "CreateNamespace=true"},
+				"retry": map[string]interface{}{
+					"limit":   5,
+					"backoff": map[string]interface{}{"duration": "30s", "factor": 2, "maxDuration": "10m"},
+				},
+			},
+			// controllers fill these in after creation
+			"ignoreDifferences": []interface{}{
+				map[string]interface{}{"group": "cluster.x-k8s.io", "kind": "Cluster", "jsonPointers": []interface{}{"/spec/controlPlaneEndpoint"}},
+			},
+		},
+	}
+}
+
+// argoHealthChecks are Lua health checks for argocd-cm; Argo CD has none
+// for CAPI kinds out of the box.
+var argoHealthChecks = map[string]string{
+	"cluster.x-k8s.io_Cluster": `hs = {status = "Progressing", message = "Waiting for cluster"}
+if obj.status ~= nil then
+  if obj.status.phase == "Failed" then
+    hs.status = "Degraded"
+    hs.message = obj.status.failureMessage or "Cluster failed"
+    return hs
+  end
+  if obj.status.conditions ~= nil then
+    for _, c in ipairs(obj.status.conditions) do
+      if c.type == "Ready" and c.status == "True" then
+        hs.status = "Healthy"
+        hs.message = "Cluster is ready"
+      elseif c.type == "Ready" then
+        hs.message = c.reason or hs.message
+      end
+    end
+  end
+end
+return hs
+`,
+	"controlplane.cluster.x-k8s.io_KubeadmControlPlane": `hs = {status = "Progressing", message = "Waiting for control plane"}
+if obj.status ~= nil and obj.status.conditions ~= nil then
+  for _, c in ipairs(obj.status.conditions) do
+    if c.type == "Ready" and c.status == "True" then
+      hs.status = "Healthy"
+      hs.message = "Control plane is ready"
+    end
+  end
+end
+return hs
+`,
+	"cluster.x-k8s.io_MachineDeployment": `hs = {status = "Progressing", message = "Waiting for machines"}
+if obj.status ~= nil and obj.status.phase == "Running" and (obj.status.readyReplicas or 0) >= (obj.spec.replicas or 0) then
+  hs.status = "Healthy"
+  hs.message = "All replicas ready"
+elseif obj.status ~= nil and obj.status.phase == "Failed" then
+  hs.status = "Degraded"
+  hs.message = "MachineDeployment failed"
+end
+return hs
+`,
+}
+
+func argoHealthConfigMap(gitopsNS string) map[string]interface{} {
+	data := map[string]interface{}{}
+	for key, script := range argoHealthChecks {
+		data["resource.customizations.health."+key] = script
+	}
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      "argocd-cm",
+			"namespace": gitopsNS,
+			"labels":    map[string]interface{}{"app.kubernetes.io/part-of": "argocd"},
+		},
+		"data": data,
+	}
+}
+
+func annotateWaves(objs []object) {
+	index := map[string]int{}
+	for _, w := range waves {
+		index[w.Name] = w.Index
+	}
+	for _, o := range objs {
+		meta := metadata(o.doc)
+		ann, _ := meta["annotations"].(map[string]interface{})
+		if ann == nil {
+			ann = map[string]interface{}{}
+			meta["annotations"] = ann
+		}
+		ann["argocd.argoproj.io/sync-wave"] = fmt.Sprintf("%d", index[o.wave])
+		if o.kind == "Cluster" {
+			// deleting the Cluster tears down the workload cluster; never
+			// let an accidental prune do that
+			ann["argocd.argoproj.io/sync-options"] = "Prune=false,Delete=false"
+		}
+	}
+}
+
+func writeFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0o644)
+}
+
+func render(opts options, objs []object, clusterName, namespace, outDir string) (map[string]string, error) {
+	files := map[string]string{}
+	var wrappers []map[string]interface{}
+	if opts.tool == "flux" && opts.repoURL != "" {
+		wrappers = append(wrappers, gitRepository(opts))
+	}
+
+	switch {
+	case opts.tool == "argo":
+		annotateWaves(objs)
+		var docs []map[string]interface{}
+		for _, w := range waves {
+			docs = append(docs, waveDocs(objs, w.Name)...)
+		}
+		files["manifests/resources.yaml"] = marshalDocs(docs)
+		files["manifests/kustomization.yaml"] = "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n  - resources.yaml\n"
+		files["argo/"+opts.name+"-application.yaml"] = marshalDocs([]map[string]interface{}{argoApplication(opts, namespace)})
+		files["argo/argocd-cm-capi-health.yaml"] = marshalDocs([]map[string]interface{}{argoHealthConfigMap(opts.gitopsNS)})
+	case opts.fluxKind == "helmrelease":
+		files["chart/Chart.yaml"] = fmt.Sprintf("apiVersion: v2\nname: %s\ndescription: Cluster API cluster %s\ntype: application\nversion: 0.1.0\n", opts.name, clusterName)
+		for i, w := range waves {
+			if docs := waveDocs(objs, w.Name); len(docs) > 0 {
+				files[fmt.Sprintf("chart/templates/%d-%s.yaml", i, w.Name)] = helmEscape(marshalDocs(docs))
+			}
+		}
+		wrappers = append(wrappers, fluxHelmRelease(opts, namespace))
+		files["flux/"+opts.name+".yaml"] = marshalDocs(wrappers)
+	default:
+		for _, w := range waves {
+			if docs := waveDocs(objs, w.Name); len(docs) > 0 {
+				files["manifests/"+w.Name+"/resources.yaml"] = marshalDocs(docs)
+			}
+		}
+		wrappers = append(wrappers, fluxKustomizations(opts, objs, clusterName, namespace)...)
+		files["flux/"+opts.name+".yaml"] = marshalDocs(wrappers)
+	}
+
+	if outDir == "" {
+		return files, nil
+	}
+	for name, content := range files {
+		if err := writeFile(filepath.Join(outDir, name), content); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func main() {
+	tool := flag.String("tool", "flux", "GitOps tool: flux, argo")
+	fluxKind := flag.String("flux-kind", "kustomization", "Flux wrapper: kustomization, helmrelease")
+	name := flag.String("name", "", "Application name (default: cluster name)")
+	repoURL := flag.String("repo-url", "", "Git repository URL holding the output")
+	revision := flag.String("revision", "main", "Git branch or revision")
+	repoPath := flag.String("path", "", "Path of the output directory inside the repository (default: clusters/<name>)")
+	gitopsNS := flag.String("gitops-namespace", "", "Namespace of the GitOps objects (default: flux-system or argocd)")
+	namespace := flag.String("n", "", "Namespace of the CAPI objects (default: from the manifests or default)")
+	destination := flag.String("destination", "https://kubernetes.default.svc", "Argo CD destination server (the management cluster)")
+	interval := flag.String("interval", "5m", "Flux reconcile interval")
+	prune := flag.Bool("prune", false, "Let the GitOps tool prune removed objects (the Cluster itself is always protected in Argo CD)")
+	outDir := flag.String("out", "", "Write files to this directory instead of stdout")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <file-or-directory>\n\nWrap cluster manifests in Flux Kustomizations/HelmRelease or an Argo CD Application.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *tool != "flux" && *tool != "argo" {
+		fmt.Fprintf(os.Stderr, "Error: unknown tool %q (use flux or argo)\n", *tool)
+		os.Exit(1)
+	}
+	if *fluxKind != "kustomization" && *fluxKind != "helmrelease" {
+		fmt.Fprintf(os.Stderr, "Error: unknown flux kind %q\n", *fluxKind)
+		os.Exit(1)
+	}
+
+	docs, err := loadDocs(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	objs, skipped, clusterName := collect(docs)
+	if len(objs) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no manifests to wrap")
+		os.Exit(1)
+	}
+
+	opts := options{
+		tool: *tool, fluxKind: *fluxKind, name: *name, repoURL: *repoURL, revision: *revision,
+		repoPath: *repoPath, gitopsNS: *gitopsNS, destination: *destination, interval: *interval, prune: *prune,
+	}
+	if opts.name == "" {
+		opts.name = clusterName
+	}
+	if opts.name == "" {
+		opts.name = strings.TrimSuffix(filepath.Base(flag.Arg(0)), filepath.Ext(flag.Arg(0)))
+	}
+	if opts.repoPath == "" {
+		opts.repoPath = "clusters/" + opts.name
+	}
+	if opts.gitopsNS == "" {
+		opts.gitopsNS = "flux-system"
+		if opts.tool == "argo" {
+			opts.gitopsNS = "argocd"
+		}
+	}
+	if opts.tool == "flux" && opts.repoURL == "" {
+		fmt.Fprintf(os.Stderr, "Warning: --repo-url not set; a GitRepository named %s/%s must already exist\n", opts.gitopsNS, opts.name)
+	}
+	if opts.tool == "argo" && opts.repoURL == "" {
+		opts.repoURL = "https://example.com/REPLACE-ME.git"
+		fmt.Fprintln(os.Stderr, "Warning: --repo-url not set; the Application uses a placeholder URL")
+	}
+
+	ns := *namespace
+	if ns == "" {
+		for _, o := range objs {
+			if n, _ := metadata(o.doc)["namespace"].(string); n != "" {
+				ns = n
+				break
+			}
+		}
+	}
+	if ns == "" {
+		ns = "default"
+	}
+
+	files, err := render(opts, objs, clusterName, ns, *outDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	summary := os.Stdout
+	if *outDir == "" {
+		summary = os.Stderr
+		names := make([]string, 0, len(files))
+		for n := range files {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Printf("# --- %s\n%s", n, files[n])
+			if !strings.HasSuffix(files[n], "\n") {
+				fmt.Println()
+			}
+		}
+	}
+
+	fmt.Fprintf(summary, "\nWrapped %d objects for %s (%s)\n", len(objs), opts.tool, opts.name)
+	for _, w := range waves {
+		var names []string
+		for _, o := range objs {
+			if o.wave == w.Name {
+				names = append(names, o.String())
+			}
+		}
+		if len(names) > 0 {
+			fmt.Fprintf(summary, "  %-8s %s\n", w.Name+":", strings.Join(names, ", "))
+		}
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(summary, "  Skipped (controller-managed): %s\n", strings.Join(skipped, ", "))
+	}
+	if *outDir != "" {
+		fmt.Fprintf(summary, "Files written to: %s\n", *outDir)
+	}
+}
@@ -0,0 +1,345 @@
+// graph exports the ownership and reference graph of a cluster as DOT or Mermaid.
+//
+// Nodes are every object belonging to the cluster (Cluster, control plane,
+// MachineDeployments, MachineSets, Machines, infrastructure and bootstrap
+// objects, templates and Secrets). Solid edges are ownerReferences (owner →
+// owned); dashed edges are object references found in spec, such as
+// infrastructureRef, configRef or dataSecretName. Nodes are colored by their
+// Ready condition.
+//
+// Usage:
+//
+//	go run ./graph [flags] <cluster-name>
+//
+// Examples:
+//
+//	go run ./graph -n default my-cluster > my-cluster.dot
+//	go run ./graph --format mermaid -o my-cluster.mmd my-cluster
+//	go run ./graph --no-secrets my-cluster | dot -Tsvg > my-cluster.svg
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+type node struct {
+	ID     string
+	Kind   string
+	Name   string
+	UID    string
+	Status string // ready, notready, unknown, deleting, none
+	Reason string
+	item   map[string]interface{}
+}
+
+type edge struct {
+	From, To string
+	Ref      bool   // spec reference rather than ownerReference
+	Label    string // reference field
+}
+
+type graph struct {
+	nodes []*node
+	edges []edge
+}
+
+var idChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func nodeID(kind, name string) string {
+	return idChars.ReplaceAllString(kind+"_"+name, "_")
+}
+
+func resources(secrets bool) []string {
+	var res []string
+	crds, _ := kubectl.RunJSON("customresourcedefinitions", "", "", false)
+	for _, crd := range crds {
+		group := kubectl.GetString(crd, "spec.group")
+		if strings.HasSuffix(group, "cluster.x-k8s.io") && kubectl.GetString(crd, "spec.scope") == "Namespaced" {
+			res = append(res, kubectl.GetString(crd, "metadata.name"))
+		}
+	}
+	sort.Strings(res)
+	if secrets {
+		res = append(res, "secrets")
+	}
+	return res
+}
+
+func status(item map[string]interface{}) (string, string) {
+	if kubectl.GetString(item, "metadata.deletionTimestamp") != "" {
+		return "deleting", "Deleting"
+	}
+	for _, c := range kubectl.GetSlice(kubectl.GetMap(item, "status"), "conditions") {
+		cm, _ := c.(map[string]interface{})
+		if t, _ := cm["type"].(string); t != "Ready" {
+			continue
+		}
+		reason, _ := cm["reason"].(string)
+		switch s, _ := cm["status"].(string); s {
+		case "True":
+			return "ready", reason
+		case "False":
+			return "notready", reason
+		default:
+			return "unknown", reason
+		}
+	}
+	return "none", ""
+}
+
+// specRefs finds object references anywhere under spec: maps carrying kind
+// and name, and bootstrap dataSecretName fields.
+func specRefs(v interface{}, path string, out map[string]string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		kind, _ := t["kind"].(string)
+		name, _ := t["name"].(string)
+		if kind != "" && name != "" && path != "" {
+			out[nodeID(kind, name)] = path
+		}
+		if s, _ := t["dataSecretName"].(string); s != "" {
+			out[nodeID("Secret", s)] = path + ".dataSecretName"
+		}
+		for k, child := range t {
+			specRefs(child, strings.TrimPrefix(path+"."+k, "."), out)
+		}
+	case []interface{}:
+		for _, child := range t {
+			specRefs(child, path, out)
+		}
+	}
+}
+
+func build(cluster, namespace string, secrets, refs bool) (*graph, error) {
+	var all []*node
+	byID := map[string]*node{}
+	byUID := map[string]*node{}
+	for _, res := range resources(secrets) {
+		items, _ := kubectl.RunJSON(res, namespace, "", false)
+		for _, item := range items {
+			n := &node{
+				Kind: kubectl.GetString(item, "kind"),
+				Name: kubectl.GetString(item, "metadata.name"),
+				UID:  kubectl.GetString(item, "metadata.uid"),
+				item: item,
+			}
+			n.ID = nodeID(n.Kind, n.Name)
+			n.Status, n.Reason = status(item)
+			all = append(all, n)
+			byID[n.ID] = n
+			byUID[n.UID] = n
+		}
+	}
+
+	member := map[string]bool{}
+	for _, n := range all {
+		if (n.Kind == "Cluster" && n.Name == cluster) ||
+			kubectl.Labels(n.item)["cluster.x-k8s.io/cluster-name"] == cluster ||
+			kubectl.GetString(n.item, "spec.clusterName") == cluster {
+			member[n.ID] = true
+		}
+	}
+	if !member[nodeID("Cluster", cluster)] {
+		return nil, fmt.Errorf("cluster %s/%s not found", namespace, cluster)
+	}
+
+	g := &graph{}
+	seenEdge := map[string]bool{}
+	addEdge := func(e edge) {
+		key := e.From + ">" + e.To
+		if e.From == e.To || seenEdge[key] {
+			return
+		}
+		seenEdge[key] = true
+		g.edges = append(g.edges, e)
+	}
+
+	// Grow the member set through owner references and spec references
+	// until it stops changing.
+	for changed := true; changed; {
+		changed = false
+		for _, n := range all {
+			for _, r := range kubectl.GetSlice(kubectl.GetMap(n.item, "metadata"), "ownerReferences") {
+				rm, _ := r.(map[string]interface{})
+				uid, _ := rm["uid"].(string)
+				owner, ok := byUID[uid]
+				if !ok {
+					continue
+				}
+				if member[owner.ID] && !member[n.ID] {
+					member[n.ID] = true
+					changed = true
+				}
+			}
+			if !refs || !member[n.ID] {
+				continue
+			}
+			targets := map[string]string{}
+			specRefs(kubectl.GetMap(n.item, "spec"), "", targets)
+			for id := range targets {
+				if _, ok := byID[id]; ok && !member[id] {
+					member[id] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	for _, n := range all {
+		if !member[n.ID] {
+			continue
+		}
+		g.nodes = append(g.nodes, n)
+		for _, r := range kubectl.GetSlice(kubectl.GetMap(n.item, "metadata"), "ownerReferences") {
+			rm, _ := r.(map[string]interface{})
+			uid, _ := rm["uid"].(string)
+			if owner, ok := byUID[uid]; ok && member[owner.ID] {
+				addEdge(edge{From: owner.ID, To: n.ID})
+			}
+		}
+	}
+	if refs {
+		for _, n := range g.nodes {
+			targets := map[string]string{}
+			specRefs(kubectl.GetMap(n.item, "spec"), "", targets)
+			ids := make([]string, 0, len(targets))
+			for id := range targets {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			for _, id := range ids {
+				if member[id] {
+					addEdge(edge{From: n.ID, To: id, Ref: true, Label: lastField(targets[id])})
+				}
+			}
+		}
+	}
+	sort.Slice(g.nodes, func(i, j int) bool { return g.nodes[i].ID < g.nodes[j].ID })
+	return g, nil
+}
+
+func lastField(path string) string {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+var colors = map[string]string{
+	"ready":    "#c8e6c9",
+	"notready": "#ffcdd2",
+	"unknown":  "#fff9c4",
+	"deleting": "#e0e0e0",
+	"none":     "#ffffff",
+}
+
+func (n *node) label() string {
+	l := n.Kind + "\\n" + n.Name
+	if n.Status != "none" && n.Status != "ready" && n.Reason != "" {
+		l += "\\n(" + n.Reason + ")"
+	}
+	return l
+}
+
+func renderDOT(g *graph, title string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", title)
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\", fontsize=10];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\", fontsize=8];\n")
+	for _, n := range g.nodes {
+		style := ""
+		if n.Status == "deleting" {
+			style = ", style=\"rounded,filled,dashed\""
+		}
+		fmt.Fprintf(&b, "  %s [label=\"%s\", fillcolor=\"%s\"%s];\n", n.ID, n.label(), colors[n.Status], style)
+	}
+	for _, e := range g.edges {
+		if e.Ref {
+			fmt.Fprintf(&b, "  %s -> %s [style=dashed, label=%q];\n", e.From, e.To, e.Label)
+		} else {
+			fmt.Fprintf(&b, "  %s -> %s;\n", e.From, e.To)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func renderMermaid(g *graph) string {
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	for _, n := range g.nodes {
+		fmt.Fprintf(&b, "  %s[\"%s\"]:::%s\n", n.ID, strings.ReplaceAll(n.label(), "\\n", "<br/>"), n.Status)
+	}
+	for _, e := range g.edges {
+		if e.Ref {
+			fmt.Fprintf(&b, "  %s -.->|%s| %s\n", e.From, e.Label, e.To)
+		} else {
+			fmt.Fprintf(&b, "  %s --> %s\n", e.From, e.To)
+		}
+	}
+	for _, s := range []string{"ready", "notready", "unknown", "deleting", "none"} {
+		extra := ""
+		if s == "deleting" {
+			extra = ",stroke-dasharray: 5 5"
+		}
+		fmt.Fprintf(&b, "  classDef %s fill:%s,stroke:#555%s\n", s, colors[s], extra)
+	}
+	return b.String()
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace of the cluster")
+	format := flag.String("format", "dot", "Output format: dot, mermaid")
+	output := flag.String("o", "", "Write graph to file")
+	noSecrets := flag.Bool("no-secrets", false, "Leave Secrets out of the graph")
+	noRefs := flag.Bool("no-refs", false, "Only follow ownerReferences, not spec references")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <cluster-name>\n\nExport a cluster's ownership/reference graph as Graphviz DOT or Mermaid.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *format != "dot" && *format != "mermaid" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (use dot or mermaid)\n", *format)
+		os.Exit(1)
+	}
+	cluster := flag.Arg(0)
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	g, err := build(cluster, *namespace, !*noSecrets, !*noRefs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := renderDOT(g, *namespace+"/"+cluster)
+	if *format == "mermaid" {
+		out = renderMermaid(g)
+	}
+	if *output != "" {
+		if err := os.WriteFile(*output, []byte(out), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Graph written to: %s (%d nodes, %d edges)\n", *output, len(g.nodes), len(g.edges))
+		return
+	}
+	fmt.Print(out)
+}
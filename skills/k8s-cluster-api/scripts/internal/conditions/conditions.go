@@ -0,0 +1,246 @@
+// Package conditions collects status conditions from CAPI resources and
+// classifies them as healthy or unhealthy.
+package conditions
+
+import (
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+// Condition flavors. v1beta1 conditions all have positive polarity and carry
+// a severity when False; v1beta2 conditions follow metav1.Condition, where a
+// few types such as Deleting and Paused are abnormal when True.
+const (
+	V1Beta1 = "v1beta1"
+	V1Beta2 = "v1beta2"
+)
+
+// Info is a single condition of a CAPI resource.
+type Info struct {
+	ResourceKind      string
+	ResourceName      string
+	ResourceNamespace string
+	ClusterName       string
+	ConditionType     string
+	Status            string
+	Reason            string
+	Message           string
+	Severity          string
+	LastTransition    string
+	Version           string
+}
+
+// negative lists condition types that are abnormal when True, in either
+// flavor.
+var negative = map[string]bool{"Stalled": true, "Deleting": true, "Paused": true, "Remediating": true}
+
+// informational lists v1beta2 condition types that report progress and are
+// never unhealthy by themselves.
+var informational = map[string]bool{"ScalingUp": true, "ScalingDown": true, "RollingOut": true}
+
+// IsHealthy classifies the condition by its flavor. v1beta1 conditions are
+// healthy when True or when False with Info severity; v1beta2 conditions are
+// healthy when True, except negative types, which are healthy when not True,
+// and informational types, which always are.
+func (c *Info) IsHealthy() bool {
+	if negative[c.ConditionType] {
+		return c.Status != "True"
+	}
+	if c.Version == V1Beta2 {
+		return informational[c.ConditionType] || c.Status == "True"
+	}
+	return c.Status == "True" || (c.Status == "False" && c.Severity == "Info")
+}
+
+// Resources are the CAPI resource types conditions are collected from.
+var Resources = []string{
+	"clusters.cluster.x-k8s.io",
+	"machines.cluster.x-k8s.io",
+	"machinesets.cluster.x-k8s.io",
+	"machinedeployments.cluster.x-k8s.io",
+	"machinepools.cluster.x-k8s.io",
+	"machinehealthchecks.cluster.x-k8s.io",
+	"kubeadmconfigs.bootstrap.cluster.x-k8s.io",
+	"kubeadmcontrolplanes.controlplane.cluster.x-k8s.io",
+}
+
+// Extract returns the conditions of a resource in the given flavor, or in
+// the flavor the resource reports when version is empty: status.conditions
+// of a v1beta2 API object, status.v1beta2.conditions when the top-level list
+// is empty, and status.conditions otherwise. Forcing a flavor reads the list
+// CAPI keeps for it (status.v1beta2 on v1beta1 objects,
+// status.deprecated.v1beta1 on v1beta2 objects) when present.
+func Extract(item map[string]interface{}, version string) []Info {
+	kind := getString(item, "kind", "Unknown")
+	metadata := getMap(item, "metadata")
+	name := getString(metadata, "name", "unknown")
+	namespace := getString(metadata, "namespace", "default")
+	cluster := getString(getMap(metadata, "labels"), "cluster.x-k8s.io/cluster-name", "")
+	if cluster == "" && kind == "Cluster" {
+		cluster = name
+	}
+	status := getMap(item, "status")
+
+	native := V1Beta1
+	if strings.HasSuffix(getString(item, "apiVersion", ""), "/v1beta2") {
+		native = V1Beta2
+	}
+	conds := getSlice(status, "conditions")
+	flavor := native
+	switch {
+	case version == V1Beta2 && native == V1Beta1:
+		if v1b2 := getSlice(getMap(status, "v1beta2"), "conditions"); len(v1b2) > 0 {
+			conds = v1b2
+		}
+		flavor = V1Beta2
+	case version == V1Beta1 && native == V1Beta2:
+		if v1b1 := getSlice(getMap(getMap(status, "deprecated"), "v1beta1"), "conditions"); len(v1b1) > 0 {
+			conds = v1b1
+		}
+		flavor = V1Beta1
+	case len(conds) == 0:
+		conds = getSlice(getMap(status, "v1beta2"), "conditions")
+		flavor = V1Beta2
+	}
+
+	var result []Info
+	for _, c := range conds {
+		cm, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		result = append(result, Info{
+			ResourceKind:      kind,
+			ResourceName:      name,
+			ResourceNamespace: namespace,
+			ClusterName:       cluster,
+			ConditionType:     getString(cm, "type", ""),
+			Status:            getString(cm, "status", "Unknown"),
+			Reason:            getString(cm, "reason", ""),
+			Message:           getString(cm, "message", ""),
+			Severity:          getString(cm, "severity", ""),
+			LastTransition:    getString(cm, "lastTransitionTime", ""),
+			Version:           flavor,
+		})
+	}
+	return result
+}
+
+// Resource is a CAPI object with its conditions and controlling owner.
+type Resource struct {
+	Kind        string
+	Name        string
+	Namespace   string
+	ClusterName string
+	OwnerKind   string
+	OwnerName   string
+	Conditions  []Info
+}
+
+// owner returns the controller ownerReference of an object, or its first
+// ownerReference when none is marked as controller.
+func owner(metadata map[string]interface{}) (kind, name string) {
+	refs := getSlice(metadata, "ownerReferences")
+	for _, r := range refs {
+		ref, _ := r.(map[string]interface{})
+		if ref["controller"] == true {
+			return getString(ref, "kind", ""), getString(ref, "name", "")
+		}
+	}
+	if len(refs) > 0 {
+		ref, _ := refs[0].(map[string]interface{})
+		return getString(ref, "kind", ""), getString(ref, "name", "")
+	}
+	return "", ""
+}
+
+// CollectResources gathers all CAPI resources in a namespace (or all
+// namespaces), optionally limited to one cluster, with their conditions.
+// Resources without conditions are included. See Extract for version.
+func CollectResources(namespace, clusterName string, allNamespaces bool, version string) []Resource {
+	labelSel := ""
+	if clusterName != "" {
+		labelSel = "cluster.x-k8s.io/cluster-name=" + clusterName
+	}
+
+	var all []Resource
+	seen := map[string]bool{}
+	ns := namespace
+	allNS := allNamespaces && namespace == ""
+	add := func(item map[string]interface{}) {
+		metadata := getMap(item, "metadata")
+		r := Resource{
+			Kind:        getString(item, "kind", "Unknown"),
+			Name:        getString(metadata, "name", "unknown"),
+			Namespace:   getString(metadata, "namespace", "default"),
+			ClusterName: getString(getMap(metadata, "labels"), "cluster.x-k8s.io/cluster-name", ""),
+			Conditions:  Extract(item, version),
+		}
+		if r.ClusterName == "" && r.Kind == "Cluster" {
+			r.ClusterName = r.Name
+		}
+		r.OwnerKind, r.OwnerName = owner(metadata)
+		key := r.Kind + "/" + r.Namespace + "/" + r.Name
+		if !seen[key] {
+			seen[key] = true
+			all = append(all, r)
+		}
+	}
+
+	for _, res := range Resources {
+		items, err := kubectl.RunJSON(res, ns, labelSel, allNS)
+		if err != nil {
+			continue
+		}
+		for _, item := range items {
+			add(item)
+		}
+	}
+
+	// Also get Cluster directly if filtering
+	if clusterName != "" {
+		items, err := kubectl.RunJSON("clusters.cluster.x-k8s.io/"+clusterName, ns, "", false)
+		if err == nil {
+			for _, item := range items {
+				if getString(item, "kind", "") == "Cluster" {
+					add(item)
+				}
+			}
+		}
+	}
+
+	return all
+}
+
+// Collect gathers the conditions of all CAPI resources in a namespace (or all
+// namespaces), optionally limited to one cluster. See Extract for version.
+func Collect(namespace, clusterName string, allNamespaces bool, version string) []Info {
+	var all []Info
+	for _, r := range CollectResources(namespace, clusterName, allNamespaces, version) {
+		all = append(all, r.Conditions...)
+	}
+	return all
+}
+
+// helpers
+func getString(m map[string]interface{}, key, def string) string {
+	if v, ok := m[key].(string); ok {
+		return v
+	}
+	return def
+}
+
+func getMap(m map[string]interface{}, key string) map[string]interface{} {
+	if v, ok := m[key].(map[string]interface{}); ok {
+		return v
+	}
+	return map[string]interface{}{}
+}
+
+func getSlice(m map[string]interface{}, key string) []interface{} {
+	if v, ok := m[key].([]interface{}); ok {
+		return v
+	}
+	return nil
+}
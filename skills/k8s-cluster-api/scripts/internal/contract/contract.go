@@ -0,0 +1,487 @@
+// Package contract checks provider CRD schemas against the Cluster API
+// provider contracts. It works on parsed CRD objects, so callers can feed it
+// CRDs fetched from a cluster or read from rendered manifests.
+package contract
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+// Spec lists the fields and behaviors a provider contract requires.
+type Spec struct {
+	RequiredSpec   []string
+	RequiredStatus []string
+	OptionalSpec   []string
+	OptionalStatus []string
+	Behaviors      []string
+	Reasons        map[string]string // field path (e.g. "status.ready") -> requirement text
+}
+
+var InfraCluster = Spec{
+	RequiredSpec:   []string{"controlPlaneEndpoint"},
+	RequiredStatus: []string{"ready", "failureReason", "failureMessage"},
+	Reasons: map[string]string{
+		"spec.controlPlaneEndpoint": "Contract requires spec.controlPlaneEndpoint",
+		"status.ready":              "Contract requires status.ready",
+	},
+	Behaviors: []string{
+		"Must set OwnerReference to Cluster",
+		"Must set status.ready=true when infrastructure is ready",
+		"Must populate spec.controlPlaneEndpoint when available",
+		"Must report failureReason/failureMessage on terminal errors",
+	},
+}
+
+var InfraMachine = Spec{
+	RequiredSpec:   []string{"providerID"},
+	RequiredStatus: []string{"ready", "addresses"},
+	Reasons: map[string]string{
+		"spec.providerID":  "Contract requires spec.providerID for node correlation",
+		"status.addresses": "Contract requires status.addresses for node registration",
+	},
+	Behaviors: []string{
+		"Must set spec.providerID for node correlation",
+		"Must set status.ready=true when machine is provisioned",
+		"Must report status.addresses for node registration",
+	},
+}
+
+var BootstrapConfig = Spec{
+	RequiredStatus: []string{"ready", "dataSecretName"},
+	Reasons: map[string]string{
+		"status.dataSecretName": "Contract requires status.dataSecretName pointing to bootstrap data Secret",
+	},
+	Behaviors: []string{
+		"Must set status.ready=true when bootstrap data is generated",
+		"Must populate status.dataSecretName pointing to Secret",
+	},
+}
+
+var ControlPlane = Spec{
+	RequiredSpec:   []string{"replicas", "version", "machineTemplate"},
+	RequiredStatus: []string{"ready", "initialized", "replicas", "updatedReplicas", "readyReplicas", "conditions"},
+	Behaviors: []string{
+		"Must set OwnerReference to Cluster",
+		"Must manage control plane Machines",
+		"Must report initialized=true after first control plane node",
+		"Must populate kubeconfig Secret",
+		"Must support rolling updates",
+	},
+}
+
+// The v1beta2 contract (Cluster API v1.11+) replaces status.ready with
+// status.initialization fields, drops failureReason/failureMessage and expects
+// status.conditions to use metav1.Condition.
+var InfraClusterV1Beta2 = Spec{
+	RequiredSpec:   []string{"controlPlaneEndpoint"},
+	RequiredStatus: []string{"initialization.provisioned", "conditions"},
+	Behaviors: []string{
+		"Must set OwnerReference to Cluster",
+		"Must set status.initialization.provisioned=true when infrastructure is ready",
+		"Must populate spec.controlPlaneEndpoint when available",
+		"Must report Ready and Provisioned conditions",
+	},
+	Reasons: map[string]string{
+		"spec.controlPlaneEndpoint":         "Contract requires spec.controlPlaneEndpoint",
+		"status.initialization.provisioned": "v1beta2 contract reads status.initialization.provisioned instead of status.ready",
+	},
+}
+
+var InfraMachineV1Beta2 = Spec{
+	RequiredSpec:   []string{"providerID"},
+	RequiredStatus: []string{"initialization.provisioned", "addresses", "conditions"},
+	Behaviors: []string{
+		"Must set spec.providerID for node correlation",
+		"Must set status.initialization.provisioned=true when machine is provisioned",
+		"Must report status.addresses for node registration",
+	},
+	Reasons: map[string]string{
+		"spec.providerID":                   "Contract requires spec.providerID for node correlation",
+		"status.initialization.provisioned": "v1beta2 contract reads status.initialization.provisioned instead of status.ready",
+		"status.addresses":                  "Contract requires status.addresses for node registration",
+	},
+}
+
+var BootstrapConfigV1Beta2 = Spec{
+	RequiredStatus: []string{"initialization.dataSecretCreated", "dataSecretName", "conditions"},
+	Behaviors: []string{
+		"Must set status.initialization.dataSecretCreated=true when bootstrap data is generated",
+		"Must populate status.dataSecretName pointing to Secret",
+	},
+	Reasons: map[string]string{
+		"status.initialization.dataSecretCreated": "v1beta2 contract reads status.initialization.dataSecretCreated instead of status.ready",
+		"status.dataSecretName":                   "Contract requires status.dataSecretName pointing to bootstrap data Secret",
+	},
+}
+
+var ControlPlaneV1Beta2 = Spec{
+	RequiredSpec: []string{"replicas", "version", "machineTemplate"},
+	RequiredStatus: []string{"initialization.controlPlaneInitialized", "replicas", "readyReplicas",
+		"availableReplicas", "upToDateReplicas", "conditions"},
+	Behaviors: []string{
+		"Must set OwnerReference to Cluster",
+		"Must manage control plane Machines",
+		"Must report initialization.controlPlaneInitialized=true after first control plane node",
+		"Must populate kubeconfig Secret",
+		"Must report Available and UpToDate replica counters",
+	},
+	Reasons: map[string]string{
+		"status.initialization.controlPlaneInitialized": "v1beta2 contract reads status.initialization.controlPlaneInitialized instead of status.initialized",
+		"status.upToDateReplicas":                       "v1beta2 contract replaces updatedReplicas with upToDateReplicas",
+	},
+}
+
+// Contract is the rule set of one provider contract version.
+type Contract struct {
+	Version         string
+	InfraCluster    Spec
+	InfraMachine    Spec
+	BootstrapConfig Spec
+	ControlPlane    Spec
+}
+
+// Contracts are the supported contract versions, keyed by version.
+var Contracts = map[string]Contract{
+	"v1beta1": {"v1beta1", InfraCluster, InfraMachine, BootstrapConfig, ControlPlane},
+	"v1beta2": {"v1beta2", InfraClusterV1Beta2, InfraMachineV1Beta2, BootstrapConfigV1Beta2, ControlPlaneV1Beta2},
+}
+
+// APIGroups are the provider API group suffixes covered by the contracts.
+var APIGroups = []string{
+	"infrastructure.cluster.x-k8s.io",
+	"bootstrap.cluster.x-k8s.io",
+	"controlplane.cluster.x-k8s.io",
+}
+
+// Violation is a single contract requirement a CRD fails to meet.
+type Violation struct {
+	Severity    string `json:"severity"`
+	Category    string `json:"category"`
+	CRD         string `json:"crd"`
+	Message     string `json:"message"`
+	Requirement string `json:"requirement,omitempty"`
+}
+
+// Report collects the violations found for one provider CRD.
+type Report struct {
+	Provider     string      `json:"provider"`
+	ProviderType string      `json:"type"`
+	Violations   []Violation `json:"violations"`
+	CheckedCRDs  []string    `json:"crds"`
+}
+
+func (r *Report) AddViolation(sev, cat, crd, msg, req string) {
+	r.Violations = append(r.Violations, Violation{sev, cat, crd, msg, req})
+}
+
+func (r *Report) ErrorCount() int {
+	n := 0
+	for _, v := range r.Violations {
+		if v.Severity == "error" {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Report) IsCompliant() bool {
+	return r.ErrorCount() == 0
+}
+
+// InGroup reports whether crd belongs to an API group ending in apiGroup.
+func InGroup(crd map[string]interface{}, apiGroup string) bool {
+	group, _ := kubectl.GetMap(crd, "spec")["group"].(string)
+	return strings.HasSuffix(group, apiGroup)
+}
+
+// Schema returns the openAPIV3Schema of the first served version of crd.
+func Schema(crd map[string]interface{}) map[string]interface{} {
+	spec := kubectl.GetMap(crd, "spec")
+	versions := kubectl.GetSlice(spec, "versions")
+	for _, v := range versions {
+		vm, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if served, _ := vm["served"].(bool); served {
+			schema := kubectl.GetMap(vm, "schema")
+			return kubectl.GetMap(schema, "openAPIV3Schema")
+		}
+	}
+	return nil
+}
+
+// MissingFields returns the entries of required that are not properties of
+// the schema object found at the dot-separated path.
+func MissingFields(schema map[string]interface{}, required []string, path string) []string {
+	current := schema
+	if path != "" {
+		for _, part := range strings.Split(path, ".") {
+			if part == "" {
+				continue
+			}
+			props := kubectl.GetMap(current, "properties")
+			next, ok := props[part].(map[string]interface{})
+			if !ok {
+				return required // path not found
+			}
+			current = next
+		}
+	}
+
+	var missing []string
+	for _, field := range required {
+		node := current
+		for _, part := range strings.Split(field, ".") {
+			next, ok := kubectl.GetMap(node, "properties")[part].(map[string]interface{})
+			if !ok {
+				missing = append(missing, field)
+				break
+			}
+			node = next
+		}
+	}
+	return missing
+}
+
+func properties(schema map[string]interface{}, field string) map[string]interface{} {
+	return kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(schema, "properties"), field), "properties")
+}
+
+// checkRequired reports the required spec and status fields of spec that the
+// CRD schema lacks.
+func checkRequired(schema map[string]interface{}, spec Spec, crdName string, report *Report) {
+	for _, section := range []struct {
+		path, category string
+		fields         []string
+	}{
+		{"spec", "Spec", spec.RequiredSpec},
+		{"status", "Status", spec.RequiredStatus},
+	} {
+		for _, f := range MissingFields(schema, section.fields, section.path) {
+			field := section.path + "." + f
+			report.AddViolation("error", section.category, crdName, "Missing required "+section.path+" field: "+f, spec.Reasons[field])
+		}
+	}
+}
+
+// checkConditionsType flags v1beta1-style conditions (with severity) in a
+// CRD checked against the v1beta2 contract, which expects metav1.Condition.
+func checkConditionsType(conditions map[string]interface{}, crdName string, report *Report) {
+	items := kubectl.GetMap(kubectl.GetMap(conditions, "items"), "properties")
+	if _, ok := items["severity"]; ok {
+		report.AddViolation("warning", "Conditions", crdName, "status.conditions uses the v1beta1 Condition type",
+			"v1beta2 contract expects []metav1.Condition in status.conditions; move v1beta1 conditions to status.deprecated.v1beta1.conditions")
+	}
+}
+
+func checkSchema(crd map[string]interface{}, spec Spec, c Contract, report *Report) map[string]interface{} {
+	crdName, _ := kubectl.GetMap(crd, "metadata")["name"].(string)
+	schema := Schema(crd)
+	if schema == nil {
+		report.AddViolation("error", "Schema", crdName, "No OpenAPI schema found in CRD", "")
+		return nil
+	}
+	checkRequired(schema, spec, crdName, report)
+	if conditions, ok := properties(schema, "status")["conditions"].(map[string]interface{}); ok && c.Version == "v1beta2" {
+		checkConditionsType(conditions, crdName, report)
+	}
+	return schema
+}
+
+func CheckInfraCluster(crd map[string]interface{}, c Contract, report *Report) {
+	schema := checkSchema(crd, c.InfraCluster, c, report)
+	if schema == nil || c.Version != "v1beta1" {
+		return
+	}
+	if _, ok := properties(schema, "status")["conditions"]; !ok {
+		crdName, _ := kubectl.GetMap(crd, "metadata")["name"].(string)
+		report.AddViolation("warning", "Conditions", crdName, "No conditions field in status", "Conditions recommended for observability")
+	}
+}
+
+func CheckInfraMachine(crd map[string]interface{}, c Contract, report *Report) {
+	checkSchema(crd, c.InfraMachine, c, report)
+}
+
+func CheckBootstrap(crd map[string]interface{}, c Contract, report *Report) {
+	checkSchema(crd, c.BootstrapConfig, c, report)
+}
+
+func CheckControlPlane(crd map[string]interface{}, c Contract, report *Report) {
+	checkSchema(crd, c.ControlPlane, c, report)
+}
+
+// certManagerInjectCA is the annotation cert-manager's CA injector uses to
+// populate caBundle fields.
+const certManagerInjectCA = "cert-manager.io/inject-ca-from"
+
+// ConversionService returns the namespace and name of the Service serving the
+// CRD's conversion webhook, or empty strings if it has none.
+func ConversionService(crd map[string]interface{}) (string, string) {
+	svc := kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(crd, "spec"), "conversion"), "webhook"), "clientConfig")
+	svc = kubectl.GetMap(svc, "service")
+	ns, _ := svc["namespace"].(string)
+	name, _ := svc["name"].(string)
+	return ns, name
+}
+
+// CheckConversion verifies that a CRD serving more than one version declares a
+// conversion webhook and gets a CA bundle, either already populated or
+// injected by cert-manager.
+func CheckConversion(crd map[string]interface{}, report *Report) {
+	crdName := kubectl.GetString(crd, "metadata.name")
+	spec := kubectl.GetMap(crd, "spec")
+	served := 0
+	for _, v := range kubectl.GetSlice(spec, "versions") {
+		if vm, ok := v.(map[string]interface{}); ok {
+			if s, _ := vm["served"].(bool); s {
+				served++
+			}
+		}
+	}
+	if served < 2 {
+		return
+	}
+
+	conversion := kubectl.GetMap(spec, "conversion")
+	strategy, _ := conversion["strategy"].(string)
+	if strategy == "" {
+		strategy = "None" // API server default
+	}
+	if strategy != "Webhook" {
+		report.AddViolation("error", "Conversion", crdName,
+			fmt.Sprintf("%d versions are served but conversion strategy is %s", served, strategy),
+			"Multi-version CRDs need strategy: Webhook so objects convert between API versions")
+		return
+	}
+	clientConfig := kubectl.GetMap(kubectl.GetMap(conversion, "webhook"), "clientConfig")
+	if _, name := ConversionService(crd); name == "" {
+		if url, _ := clientConfig["url"].(string); url == "" {
+			report.AddViolation("error", "Conversion", crdName, "Conversion webhook has no service or url", "")
+		}
+	}
+	caBundle, _ := clientConfig["caBundle"].(string)
+	_, injected := kubectl.GetMap(kubectl.GetMap(crd, "metadata"), "annotations")[certManagerInjectCA]
+	if caBundle == "" && !injected {
+		report.AddViolation("error", "Conversion", crdName,
+			"Conversion webhook has no caBundle and no "+certManagerInjectCA+" annotation",
+			"The API server cannot call the webhook without a trusted CA bundle")
+	}
+}
+
+// CheckContractLabel verifies the cluster.x-k8s.io/<contract> label clusterctl
+// and the core controllers use to pick the CRD version implementing a
+// contract. Its value lists API versions separated by "_", each of which must
+// be served.
+func CheckContractLabel(crd map[string]interface{}, contractVersion string, report *Report) {
+	crdName := kubectl.GetString(crd, "metadata.name")
+	label := "cluster.x-k8s.io/" + contractVersion
+	value, ok := kubectl.Labels(crd)[label]
+	if !ok {
+		report.AddViolation("error", "Labels", crdName, "Missing contract label "+label,
+			"clusterctl and the core controllers resolve the provider API version from this label")
+		return
+	}
+	served := map[string]bool{}
+	for _, v := range kubectl.GetSlice(kubectl.GetMap(crd, "spec"), "versions") {
+		vm, _ := v.(map[string]interface{})
+		if s, _ := vm["served"].(bool); s {
+			name, _ := vm["name"].(string)
+			served[name] = true
+		}
+	}
+	for _, version := range strings.Split(value, "_") {
+		if !served[version] {
+			report.AddViolation("error", "Labels", crdName,
+				fmt.Sprintf("Contract label %s=%s names version %s, which the CRD does not serve", label, value, version), "")
+		}
+	}
+}
+
+// DetectType classifies a CRD by name into a provider contract type. Only the
+// plural resource name is matched for cluster/machine, since every provider
+// group itself ends in cluster.x-k8s.io.
+func DetectType(crdName string) string {
+	lower := strings.ToLower(crdName)
+	plural := strings.SplitN(lower, ".", 2)[0]
+	switch {
+	case strings.Contains(plural, "machine") && strings.Contains(lower, "infrastructure"):
+		return "infrastructure-machine"
+	case strings.Contains(plural, "cluster") && strings.Contains(lower, "infrastructure"):
+		return "infrastructure-cluster"
+	case strings.Contains(lower, "bootstrap"):
+		return "bootstrap"
+	case strings.Contains(lower, "controlplane"):
+		return "controlplane"
+	}
+	return "unknown"
+}
+
+// CheckCRDs runs the v1beta1 contract checks for every provider CRD in crds,
+// optionally filtered by provider name and contract type.
+func CheckCRDs(crds []map[string]interface{}, providerFilter, typeFilter string) []Report {
+	return CheckCRDsAgainst(Contracts["v1beta1"], crds, providerFilter, typeFilter)
+}
+
+// CheckCRDsAgainst is CheckCRDs for an explicit contract version.
+func CheckCRDsAgainst(c Contract, crds []map[string]interface{}, providerFilter, typeFilter string) []Report {
+	var reports []Report
+
+	// Bucket CRDs by API group in a single pass over the list.
+	byGroup := map[string][]map[string]interface{}{}
+	for _, crd := range crds {
+		for _, group := range APIGroups {
+			if InGroup(crd, group) {
+				byGroup[group] = append(byGroup[group], crd)
+			}
+		}
+	}
+
+	for _, group := range APIGroups {
+		for _, crd := range byGroup[group] {
+			crdName, _ := kubectl.GetMap(crd, "metadata")["name"].(string)
+			spec := kubectl.GetMap(crd, "spec")
+			names := kubectl.GetMap(spec, "names")
+			kind, _ := names["kind"].(string)
+
+			providerName := strings.ToLower(kind)
+			for _, s := range []string{"cluster", "machine", "config", "controlplane"} {
+				providerName = strings.ReplaceAll(providerName, s, "")
+			}
+			if providerFilter != "" && !strings.Contains(providerName, strings.ToLower(providerFilter)) {
+				continue
+			}
+
+			crdType := DetectType(crdName)
+			if typeFilter != "" && !strings.Contains(crdType, typeFilter) {
+				continue
+			}
+
+			report := Report{
+				Provider:     providerName,
+				ProviderType: crdType,
+				CheckedCRDs:  []string{crdName},
+			}
+
+			switch crdType {
+			case "infrastructure-cluster":
+				CheckInfraCluster(crd, c, &report)
+			case "infrastructure-machine":
+				CheckInfraMachine(crd, c, &report)
+			case "bootstrap":
+				CheckBootstrap(crd, c, &report)
+			case "controlplane":
+				CheckControlPlane(crd, c, &report)
+			}
+			CheckConversion(crd, &report)
+			CheckContractLabel(crd, c.Version, &report)
+
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
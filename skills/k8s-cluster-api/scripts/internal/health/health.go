@@ -0,0 +1,211 @@
+// Package health analyzes CAPI resource conditions and summarizes the health
+// of a workload cluster's object graph.
+package health
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+// Issue is a single unhealthy condition found on a CAPI resource.
+type Issue struct {
+	Resource      string `json:"resource"`
+	Name          string `json:"name"`
+	ConditionType string `json:"condition_type"`
+	Status        string `json:"status"`
+	Reason        string `json:"reason"`
+	Message       string `json:"message"`
+	Severity      string `json:"severity"`
+}
+
+func (h Issue) String() string {
+	icon := "⚠️"
+	if h.Severity == "error" {
+		icon = "❌"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [%s] %s/%s\n", icon, h.Severity, h.Resource, h.Name)
+	fmt.Fprintf(&b, "  Condition: %s = %s\n", h.ConditionType, h.Status)
+	if h.Reason != "" {
+		fmt.Fprintf(&b, "  Reason: %s\n", h.Reason)
+	}
+	if h.Message != "" {
+		fmt.Fprintf(&b, "  Message: %s\n", h.Message)
+	}
+	return b.String()
+}
+
+var criticalConditions = map[string]string{
+	"Ready":               "error",
+	"Available":           "error",
+	"InfrastructureReady": "error",
+	"ControlPlaneReady":   "error",
+	"BootstrapReady":      "warning",
+	"Provisioned":         "error",
+	"Initialized":         "warning",
+}
+
+var expectedTrue = []string{
+	"Ready", "Available", "InfrastructureReady", "ControlPlaneReady",
+	"BootstrapReady", "Provisioned", "Initialized", "UpToDate",
+}
+
+var errorReasons = map[string]bool{
+	"ProvisioningFailed":       true,
+	"InvalidConfiguration":     true,
+	"WaitingForInfrastructure": true,
+	"WaitingForControlPlane":   true,
+	"ScalingDown":              true,
+	"Deleting":                 true,
+	"Failed":                   true,
+	"ProviderError":            true,
+}
+
+// AnalyzeConditions returns the issues found in a resource's conditions.
+func AnalyzeConditions(resourceType, name string, conditions []interface{}) []Issue {
+	var issues []Issue
+	expectedSet := map[string]bool{}
+	for _, e := range expectedTrue {
+		expectedSet[e] = true
+	}
+
+	for _, c := range conditions {
+		cm, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		condType, _ := cm["type"].(string)
+		status, _ := cm["status"].(string)
+		reason, _ := cm["reason"].(string)
+		message, _ := cm["message"].(string)
+
+		if expectedSet[condType] && status != "True" {
+			sev := criticalConditions[condType]
+			if sev == "" {
+				sev = "warning"
+			}
+			issues = append(issues, Issue{
+				Resource: resourceType, Name: name,
+				ConditionType: condType, Status: status,
+				Reason: reason, Message: message, Severity: sev,
+			})
+		}
+
+		if errorReasons[reason] {
+			issues = append(issues, Issue{
+				Resource: resourceType, Name: name,
+				ConditionType: condType, Status: status,
+				Reason: reason, Message: message, Severity: "warning",
+			})
+		}
+	}
+	return issues
+}
+
+// GetConditions returns status.conditions, falling back to the v1beta2 list.
+func GetConditions(item map[string]interface{}) []interface{} {
+	status := kubectl.GetMap(item, "status")
+	conds := kubectl.GetSlice(status, "conditions")
+	if len(conds) == 0 {
+		v1b2 := kubectl.GetMap(status, "v1beta2")
+		conds = kubectl.GetSlice(v1b2, "conditions")
+	}
+	return conds
+}
+
+// GetClusterResources fetches the Cluster and its core owned resources,
+// keyed by kind.
+func GetClusterResources(clusterName, namespace string) map[string][]map[string]interface{} {
+	resources := map[string][]map[string]interface{}{}
+	ns := namespace
+	if ns == "" {
+		ns = "default"
+	}
+
+	// Cluster
+	items, _ := kubectl.RunJSON("clusters.cluster.x-k8s.io/"+clusterName, ns, "", false)
+	if len(items) > 0 {
+		resources["Cluster"] = items
+	}
+
+	label := "cluster.x-k8s.io/cluster-name=" + clusterName
+	for _, rt := range []struct{ name, resource string }{
+		{"Machine", "machines.cluster.x-k8s.io"},
+		{"MachineSet", "machinesets.cluster.x-k8s.io"},
+		{"MachineDeployment", "machinedeployments.cluster.x-k8s.io"},
+	} {
+		items, _ := kubectl.RunJSON(rt.resource, ns, label, false)
+		if len(items) > 0 {
+			resources[rt.name] = items
+		}
+	}
+
+	// KubeadmControlPlane
+	if len(resources["Cluster"]) > 0 {
+		cluster := resources["Cluster"][0]
+		spec := kubectl.GetMap(cluster, "spec")
+		cpRef := kubectl.GetMap(spec, "controlPlaneRef")
+		if kind, _ := cpRef["kind"].(string); kind == "KubeadmControlPlane" {
+			if cpName, _ := cpRef["name"].(string); cpName != "" {
+				items, _ := kubectl.RunJSON("kubeadmcontrolplanes.controlplane.cluster.x-k8s.io/"+cpName, ns, "", false)
+				if len(items) > 0 {
+					resources["KubeadmControlPlane"] = items
+				}
+			}
+		}
+	}
+
+	return resources
+}
+
+// Check collects the cluster's resources and returns a summary map together
+// with every issue found. The summary carries "errors" and "warnings" counts.
+func Check(clusterName, namespace string) (map[string]interface{}, []Issue) {
+	resources := GetClusterResources(clusterName, namespace)
+	var allIssues []Issue
+
+	ns := namespace
+	if ns == "" {
+		ns = "default"
+	}
+	summary := map[string]interface{}{
+		"cluster_name": clusterName,
+		"namespace":    ns,
+		"timestamp":    time.Now().Format(time.RFC3339),
+		"resources":    map[string]int{},
+	}
+
+	resCount := summary["resources"].(map[string]int)
+	for rt, items := range resources {
+		resCount[rt] = len(items)
+		for _, item := range items {
+			name := kubectl.GetString(item, "metadata.name")
+			if name == "" {
+				name = "unknown"
+			}
+			conds := GetConditions(item)
+			if len(conds) > 0 {
+				issues := AnalyzeConditions(rt, name, conds)
+				allIssues = append(allIssues, issues...)
+			}
+		}
+	}
+
+	errors := 0
+	warnings := 0
+	for _, i := range allIssues {
+		if i.Severity == "error" {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	summary["total_issues"] = len(allIssues)
+	summary["errors"] = errors
+	summary["warnings"] = warnings
+
+	return summary, allIssues
+}
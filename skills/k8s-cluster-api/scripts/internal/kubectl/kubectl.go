@@ -3,10 +3,12 @@
 package kubectl
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 )
 
@@ -76,12 +78,18 @@ func RunJSON(resource string, namespace string, labelSelector string, allNamespa
 		return nil, nil // Resource not found is not an error
 	}
 
+	return ParseItems(stdout)
+}
+
+// ParseItems parses kubectl JSON output. If the output is a List, returns the
+// items. If it's a single resource, wraps it.
+func ParseItems(stdout string) ([]map[string]interface{}, error) {
 	var raw map[string]interface{}
 	if err := json.Unmarshal([]byte(stdout), &raw); err != nil {
 		return nil, fmt.Errorf("JSON parse error: %w", err)
 	}
 
-	if kind, _ := raw["kind"].(string); kind != "" && len(kind) > 4 && kind[len(kind)-4:] == "List" {
+	if kind, _ := raw["kind"].(string); strings.HasSuffix(kind, "List") {
 		items, _ := raw["items"].([]interface{})
 		result := make([]map[string]interface{}, 0, len(items))
 		for _, item := range items {
@@ -118,6 +126,14 @@ func GetString(data map[string]interface{}, path string) string {
 	return ""
 }
 
+// GetInt retrieves a JSON number from a nested map as an int, or 0.
+func GetInt(data map[string]interface{}, path string) int {
+	if f, ok := GetNested(data, path).(float64); ok {
+		return int(f)
+	}
+	return 0
+}
+
 // GetMap retrieves a sub-map from a nested map.
 func GetMap(data map[string]interface{}, key string) map[string]interface{} {
 	v, _ := data[key].(map[string]interface{})
@@ -156,3 +172,27 @@ func splitDotPath(path string) []string {
 	}
 	return parts
 }
+
+// WorkloadKubeconfig writes the admin kubeconfig of a workload cluster,
+// read from its <cluster>-kubeconfig secret, to a temporary file and returns
+// its path. Callers should remove the file when done.
+func WorkloadKubeconfig(cluster, namespace string) (string, error) {
+	ok, out, errMsg := Run([]string{"get", "secret", cluster + "-kubeconfig", "-n", namespace,
+		"-o", "jsonpath={.data.value}"}, DefaultTimeout)
+	if !ok {
+		return "", fmt.Errorf("read kubeconfig secret: %s", strings.TrimSpace(errMsg))
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out))
+	if err != nil {
+		return "", fmt.Errorf("decode kubeconfig: %w", err)
+	}
+	f, err := os.CreateTemp("", cluster+"-*.kubeconfig")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,53 @@
+package kubectl
+
+// Labels returns metadata.labels of a resource as a string map.
+func Labels(item map[string]interface{}) map[string]string {
+	out := map[string]string{}
+	for k, v := range GetMap(GetMap(item, "metadata"), "labels") {
+		if s, ok := v.(string); ok {
+			out[k] = s
+		}
+	}
+	return out
+}
+
+// MatchesSelector evaluates a metav1.LabelSelector (matchLabels and
+// matchExpressions) against a label set. An empty selector matches everything.
+func MatchesSelector(selector map[string]interface{}, labels map[string]string) bool {
+	for k, v := range GetMap(selector, "matchLabels") {
+		if s, _ := v.(string); labels[k] != s {
+			return false
+		}
+	}
+	for _, e := range GetSlice(selector, "matchExpressions") {
+		em, _ := e.(map[string]interface{})
+		key, _ := em["key"].(string)
+		op, _ := em["operator"].(string)
+		val, has := labels[key]
+		in := false
+		for _, v := range GetSlice(em, "values") {
+			if s, _ := v.(string); has && s == val {
+				in = true
+			}
+		}
+		switch op {
+		case "In":
+			if !in {
+				return false
+			}
+		case "NotIn":
+			if in {
+				return false
+			}
+		case "Exists":
+			if !has {
+				return false
+			}
+		case "DoesNotExist":
+			if has {
+				return false
+			}
+		}
+	}
+	return true
+}
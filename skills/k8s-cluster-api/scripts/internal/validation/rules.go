@@ -0,0 +1,172 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+// The rules below are shared by both tools. Their IDs are part of the
+// lint-cluster-templates registry, so configs and reports refer to them the
+// same way in either tool.
+var (
+	RequiredFields = Rule{ID: "CAPI001", Name: "required-fields", Severity: Error,
+		Description: "Documents must set apiVersion, kind, metadata and metadata.name", Document: requiredFields}
+	DeprecatedAPIVersion = Rule{ID: "CAPI002", Name: "deprecated-api-version", Severity: Warning,
+		Description: "CAPI API versions that are deprecated or removed", Document: deprecatedAPIVersion}
+	RequiredSpecFields = Rule{ID: "CAPI003", Name: "required-spec-fields", Severity: Error,
+		Description: "Spec fields each CAPI kind requires", Document: requiredSpecFields}
+	DeprecatedFields = Rule{ID: "CAPI004", Name: "deprecated-field", Severity: Warning,
+		Description: "Fields deprecated in recent CAPI releases", Document: deprecatedFields}
+	HardcodedCredentials = Rule{ID: "CAPI006", Name: "hardcoded-credential", Severity: Warning,
+		Description: "Passwords, secrets and tokens written inline", Content: hardcodedCredentials}
+	// AlphaAPIVersion catches any v1alpha version DeprecatedAPIVersions does
+	// not list, e.g. provider v1alpha1 kinds, so it never repeats a CAPI002 hit.
+	AlphaAPIVersion = Rule{ID: "CAPI013", Name: "alpha-api-version", Severity: Warning,
+		Description: "Any v1alpha API version", Document: alphaAPIVersion}
+)
+
+// CRDSchema validates documents against the schemas in s, which may be
+// loaded after the rule is created.
+func CRDSchema(s *Schemas) Rule {
+	return Rule{ID: "CAPI012", Name: "crd-schema", Severity: Error,
+		Description: "Documents that do not match their CRD schema (--crd-dir or live CRDs)",
+		Document:    func(doc map[string]interface{}) []Hit { return s.Validate(doc) }}
+}
+
+// DeprecatedAPIVersions maps removed CAPI API versions to their replacement.
+var DeprecatedAPIVersions = map[string]string{
+	"cluster.x-k8s.io/v1alpha3":                "cluster.x-k8s.io/v1beta1",
+	"cluster.x-k8s.io/v1alpha4":                "cluster.x-k8s.io/v1beta1",
+	"infrastructure.cluster.x-k8s.io/v1alpha3": "infrastructure.cluster.x-k8s.io/v1beta1",
+	"infrastructure.cluster.x-k8s.io/v1alpha4": "infrastructure.cluster.x-k8s.io/v1beta1",
+	"bootstrap.cluster.x-k8s.io/v1alpha3":      "bootstrap.cluster.x-k8s.io/v1beta1",
+	"bootstrap.cluster.x-k8s.io/v1alpha4":      "bootstrap.cluster.x-k8s.io/v1beta1",
+	"controlplane.cluster.x-k8s.io/v1alpha3":   "controlplane.cluster.x-k8s.io/v1beta1",
+	"controlplane.cluster.x-k8s.io/v1alpha4":   "controlplane.cluster.x-k8s.io/v1beta1",
+	"addons.cluster.x-k8s.io/v1alpha3":         "addons.cluster.x-k8s.io/v1beta1",
+	"addons.cluster.x-k8s.io/v1alpha4":         "addons.cluster.x-k8s.io/v1beta1",
+}
+
+// SpecFields lists the spec fields each CAPI kind requires. Fields marked
+// ":opt" are documented but optional.
+var SpecFields = map[string][]string{
+	"Cluster":            {"clusterName:opt", "infrastructureRef", "controlPlaneRef"},
+	"Machine":            {"clusterName", "bootstrap"},
+	"MachineDeployment":  {"clusterName", "template"},
+	"MachineSet":         {"clusterName", "template"},
+	"ClusterClass":       {"infrastructure", "controlPlane"},
+	"MachineHealthCheck": {"clusterName", "selector", "unhealthyConditions"},
+	"MachinePool":        {"clusterName", "template"},
+}
+
+// DeprecatedFieldsByKind lists fields deprecated in recent CAPI releases.
+var DeprecatedFieldsByKind = map[string]map[string]struct {
+	Since   string
+	Message string
+}{
+	"Cluster": {
+		"spec.paused": {"v1.4.0", "Use spec.topology.controlPlane/workers for managed clusters"},
+	},
+	"Machine": {
+		"spec.version": {"v1.5.0", "Version is now inherited from control plane or topology"},
+	},
+}
+
+var credentialPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)password:\s*['"]?[^${\s'"]+['"]?`),
+	regexp.MustCompile(`(?i)secret:\s*['"]?[^${\s'"]+['"]?`),
+	regexp.MustCompile(`(?i)token:\s*['"]?[a-zA-Z0-9+/=]{20,}['"]?`),
+}
+
+// TemplateVarPattern matches clusterctl placeholders: ${VAR}, ${VAR:=default}
+// and ${VAR=default}.
+var TemplateVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::?=([^}]*))?\}`)
+
+func requiredFields(doc map[string]interface{}) []Hit {
+	var hits []Hit
+	for _, f := range []string{"apiVersion", "kind", "metadata"} {
+		if _, ok := doc[f]; !ok {
+			hits = append(hits, Hit{Field: f, Message: "Missing required field"})
+		}
+	}
+	if metadata, ok := doc["metadata"].(map[string]interface{}); ok {
+		if _, ok := metadata["name"]; !ok {
+			hits = append(hits, Hit{Field: "metadata.name", Message: "Missing required field"})
+		}
+	}
+	return hits
+}
+
+func deprecatedAPIVersion(doc map[string]interface{}) []Hit {
+	av, _ := doc["apiVersion"].(string)
+	if repl, ok := DeprecatedAPIVersions[av]; ok {
+		return []Hit{{Field: "apiVersion", Message: "Deprecated API version " + av, Suggestion: "Use " + repl}}
+	}
+	return nil
+}
+
+func alphaAPIVersion(doc map[string]interface{}) []Hit {
+	av, _ := doc["apiVersion"].(string)
+	if _, listed := DeprecatedAPIVersions[av]; listed || !strings.Contains(av, "v1alpha") {
+		return nil
+	}
+	return []Hit{{Field: "apiVersion", Message: "v1alpha API versions are deprecated: " + av}}
+}
+
+func requiredSpecFields(doc map[string]interface{}) []Hit {
+	kind, _ := doc["kind"].(string)
+	fields, ok := SpecFields[kind]
+	if !ok {
+		return nil
+	}
+	spec, _ := doc["spec"].(map[string]interface{})
+	_, hasTopo := spec["topology"]
+	var hits []Hit
+	for _, field := range fields {
+		if strings.HasSuffix(field, ":opt") {
+			continue
+		}
+		// Topology-based clusters get their refs from the ClusterClass.
+		if kind == "Cluster" && hasTopo && (field == "infrastructureRef" || field == "controlPlaneRef") {
+			continue
+		}
+		if _, ok := spec[field]; !ok {
+			hits = append(hits, Hit{Field: "spec." + field, Message: fmt.Sprintf("Missing required %s field", kind)})
+		}
+	}
+	return hits
+}
+
+func deprecatedFields(doc map[string]interface{}) []Hit {
+	kind, _ := doc["kind"].(string)
+	paths := make([]string, 0, len(DeprecatedFieldsByKind[kind]))
+	for path := range DeprecatedFieldsByKind[kind] {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var hits []Hit
+	for _, path := range paths {
+		if kubectl.GetNested(doc, path) != nil {
+			info := DeprecatedFieldsByKind[kind][path]
+			hits = append(hits, Hit{Field: path, Message: "Deprecated since " + info.Since, Suggestion: info.Message})
+		}
+	}
+	return hits
+}
+
+func hardcodedCredentials(lines []string) []Hit {
+	var hits []Hit
+	for i, line := range lines {
+		line = TemplateVarPattern.ReplaceAllString(line, "")
+		for _, pat := range credentialPatterns {
+			if pat.MatchString(line) {
+				hits = append(hits, Hit{Message: "Possible hardcoded credential detected", Line: i + 1})
+			}
+		}
+	}
+	return hits
+}
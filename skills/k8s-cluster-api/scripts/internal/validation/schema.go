@@ -0,0 +1,296 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schemas maps "group/version Kind" to the openAPIV3Schema of that CRD
+// version. A nil Schemas validates nothing.
+type Schemas map[string]map[string]interface{}
+
+// AddCRD registers every version of crd that carries a schema.
+func (s Schemas) AddCRD(crd map[string]interface{}) {
+	if kind, _ := crd["kind"].(string); kind != "CustomResourceDefinition" {
+		return
+	}
+	group := kubectl.GetString(crd, "spec.group")
+	kind := kubectl.GetString(crd, "spec.names.kind")
+	versions, _ := kubectl.GetNested(crd, "spec.versions").([]interface{})
+	for _, item := range versions {
+		v, _ := item.(map[string]interface{})
+		name, _ := v["name"].(string)
+		if schema, ok := kubectl.GetNested(v, "schema.openAPIV3Schema").(map[string]interface{}); ok {
+			s[group+"/"+name+" "+kind] = schema
+		}
+	}
+}
+
+// LoadDir reads CRD manifests from dir and its subdirectories.
+func (s Schemas) LoadDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !IsYAMLFile(path) {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		for {
+			var doc map[string]interface{}
+			if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			s.AddCRD(doc)
+		}
+	})
+}
+
+// LoadLive reads CRDs from the cluster of the current kubeconfig.
+func (s Schemas) LoadLive() error {
+	ok, out, errMsg := kubectl.Run([]string{"get", "crd", "-o", "json"}, 2*kubectl.DefaultTimeout)
+	if !ok {
+		return fmt.Errorf("kubectl get crd: %s", strings.TrimSpace(errMsg))
+	}
+	crds, err := kubectl.ParseItems(out)
+	if err != nil {
+		return err
+	}
+	for _, crd := range crds {
+		s.AddCRD(crd)
+	}
+	return nil
+}
+
+// For returns the schema of the document's group, version and kind.
+func (s Schemas) For(doc map[string]interface{}) (map[string]interface{}, bool) {
+	av, _ := doc["apiVersion"].(string)
+	kind, _ := doc["kind"].(string)
+	schema, ok := s[av+" "+kind]
+	return schema, ok
+}
+
+// Validate checks everything but apiVersion, kind and metadata, which are
+// left to the API server, against the document's schema.
+func (s Schemas) Validate(doc map[string]interface{}) []Hit {
+	schema, ok := s.For(doc)
+	if !ok {
+		return nil
+	}
+	body := map[string]interface{}{}
+	for k, v := range doc {
+		if k != "apiVersion" && k != "kind" && k != "metadata" {
+			body[k] = v
+		}
+	}
+	props := map[string]interface{}{}
+	for k, v := range kubectl.GetMap(schema, "properties") {
+		if k != "apiVersion" && k != "kind" && k != "metadata" {
+			props[k] = v
+		}
+	}
+	return ValidateValue(body, map[string]interface{}{"type": "object", "properties": props,
+		"required": schema["required"]}, "")
+}
+
+func schemaTypeOK(v interface{}, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "integer":
+		switch n := v.(type) {
+		case int, int64, uint64:
+			return true
+		case float64:
+			return n == float64(int64(n))
+		}
+		return false
+	case "number":
+		switch v.(type) {
+		case int, int64, uint64, float64:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// closestField suggests the schema property a misspelled field was meant
+// to be, or "" when none is close.
+func closestField(field string, props map[string]interface{}) string {
+	best, bestDist := "", 3
+	for p := range props {
+		d := editDistance(strings.ToLower(field), strings.ToLower(p))
+		if d < bestDist || (d == bestDist && best != "" && p < best) {
+			best, bestDist = p, d
+		}
+	}
+	return best
+}
+
+func joinField(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// ValidateValue checks v against a structural CRD schema: types, enums,
+// patterns, bounds, required and unknown fields. Unresolved ${VAR}
+// placeholders are accepted for any type.
+func ValidateValue(v interface{}, schema map[string]interface{}, path string) []Hit {
+	if v == nil {
+		return nil
+	}
+	if s, ok := v.(string); ok && TemplateVarPattern.MatchString(s) {
+		return nil
+	}
+	fail := func(format string, args ...interface{}) []Hit {
+		return []Hit{{Field: path, Message: fmt.Sprintf(format, args...)}}
+	}
+	if schema["x-kubernetes-int-or-string"] == true {
+		if !schemaTypeOK(v, "integer") && !schemaTypeOK(v, "string") {
+			return fail("Expected integer or string")
+		}
+		return nil
+	}
+	if typ, _ := schema["type"].(string); typ != "" && !schemaTypeOK(v, typ) {
+		return fail("Expected %s, got %T", typ, v)
+	}
+
+	var hits []Hit
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			found = found || fmt.Sprint(e) == fmt.Sprint(v)
+		}
+		if !found {
+			hits = append(hits, fail("Value %v is not one of %v", v, enum)...)
+		}
+	}
+	if n, ok := toFloat(v); ok {
+		if lo, ok := toFloat(schema["minimum"]); ok && n < lo {
+			hits = append(hits, fail("Value %v is below the minimum %v", v, lo)...)
+		}
+		if hi, ok := toFloat(schema["maximum"]); ok && n > hi {
+			hits = append(hits, fail("Value %v is above the maximum %v", v, hi)...)
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(val) {
+				hits = append(hits, fail("Value %q does not match pattern %s", val, p)...)
+			}
+		}
+		if n, ok := toFloat(schema["minLength"]); ok && float64(len(val)) < n {
+			hits = append(hits, fail("Value is shorter than %v characters", n)...)
+		}
+		if n, ok := toFloat(schema["maxLength"]); ok && float64(len(val)) > n {
+			hits = append(hits, fail("Value is longer than %v characters", n)...)
+		}
+	case map[string]interface{}:
+		props, hasProps := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		preserve := schema["x-kubernetes-preserve-unknown-fields"] == true
+		required, _ := schema["required"].([]interface{})
+		for _, item := range required {
+			if r, _ := item.(string); r != "" {
+				if _, ok := val[r]; !ok {
+					hits = append(hits, Hit{Field: joinField(path, r), Message: "Missing required field"})
+				}
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := joinField(path, k)
+			if sub, ok := props[k].(map[string]interface{}); ok {
+				hits = append(hits, ValidateValue(val[k], sub, child)...)
+			} else if additional != nil {
+				hits = append(hits, ValidateValue(val[k], additional, child)...)
+			} else if hasProps && !preserve {
+				h := Hit{Field: child, Message: "Unknown field"}
+				if hint := closestField(k, props); hint != "" {
+					h.Suggestion = "Did you mean " + joinField(path, hint) + "?"
+				}
+				hits = append(hits, h)
+			}
+		}
+	case []interface{}:
+		if n, ok := toFloat(schema["minItems"]); ok && float64(len(val)) < n {
+			hits = append(hits, fail("Expected at least %v items", n)...)
+		}
+		if n, ok := toFloat(schema["maxItems"]); ok && float64(len(val)) > n {
+			hits = append(hits, fail("Expected at most %v items", n)...)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range val {
+				hits = append(hits, ValidateValue(item, items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return hits
+}
@@ -0,0 +1,229 @@
+// Package validation holds the document model, issue type and rules shared
+// by validate-manifests and lint-cluster-templates.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity ranks an issue. Errors fail a run, warnings fail it in strict
+// mode and info is never fatal.
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Info
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Info:
+		return "info"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the severity by name in JSON and YAML reports.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Icon is the marker text reports print in front of an issue.
+func (s Severity) Icon() string {
+	switch s {
+	case Error:
+		return "❌"
+	case Warning:
+		return "⚠️"
+	}
+	return "ℹ️"
+}
+
+// ParseSeverity parses "error", "warning" or "info".
+func ParseSeverity(s string) (Severity, bool) {
+	switch s {
+	case "error":
+		return Error, true
+	case "warning":
+		return Warning, true
+	case "info":
+		return Info, true
+	}
+	return 0, false
+}
+
+// Issue is a single problem found in a file.
+type Issue struct {
+	Rule       string   `json:"rule,omitempty"`
+	Severity   Severity `json:"severity"`
+	File       string   `json:"file,omitempty"`
+	Line       int      `json:"line,omitempty"`
+	Field      string   `json:"field,omitempty"`
+	Message    string   `json:"message"`
+	Suggestion string   `json:"suggestion,omitempty"`
+}
+
+// Text is the message prefixed with the field it concerns, if any.
+func (i Issue) Text() string {
+	if i.Field != "" {
+		return i.Field + ": " + i.Message
+	}
+	return i.Message
+}
+
+func (i Issue) String() string {
+	loc := i.File
+	if i.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", i.File, i.Line)
+	}
+	s := fmt.Sprintf("%s %s %s", i.Severity.Icon(), loc, i.Text())
+	if i.Rule != "" {
+		s = fmt.Sprintf("%s %s [%s] %s", i.Severity.Icon(), loc, i.Rule, i.Text())
+	}
+	if i.Suggestion != "" {
+		s += " → " + i.Suggestion
+	}
+	return s
+}
+
+// Count returns the number of errors and warnings among issues.
+func Count(issues []Issue) (errors, warnings int) {
+	for _, i := range issues {
+		switch i.Severity {
+		case Error:
+			errors++
+		case Warning:
+			warnings++
+		}
+	}
+	return errors, warnings
+}
+
+// Document is one parsed YAML document. Line is the line of its first key
+// in File.
+type Document struct {
+	File string
+	Line int
+	Obj  map[string]interface{}
+}
+
+// Parse splits content into its YAML documents, skipping empty ones and
+// documents that are not mappings. On a syntax error it returns the
+// documents read so far with the error.
+func Parse(file, content string) ([]Document, error) {
+	var docs []Document
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); errors.Is(err, io.EOF) {
+			return docs, nil
+		} else if err != nil {
+			return docs, err
+		}
+		var obj map[string]interface{}
+		if err := node.Decode(&obj); err != nil || obj == nil {
+			continue
+		}
+		line := node.Line
+		if len(node.Content) > 0 {
+			line = node.Content[0].Line
+		}
+		docs = append(docs, Document{file, line, obj})
+	}
+}
+
+// IsYAMLFile reports whether path has a .yaml or .yml extension.
+func IsYAMLFile(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// Hit is one violation reported by a rule. Line is relative to the document
+// start for document rules and absolute for content rules; 0 means the
+// document line.
+type Hit struct {
+	Field      string
+	Message    string
+	Suggestion string
+	Line       int
+}
+
+// SetHit is a violation a set rule reports against one of its documents.
+type SetHit struct {
+	Doc *Document
+	Hit
+}
+
+// Rule is a named check. Document rules see each parsed YAML document;
+// content rules see the raw lines of a file; set rules see every document of
+// the run, so objects can be checked against each other across files.
+type Rule struct {
+	ID          string
+	Name        string
+	Description string
+	Severity    Severity
+	Document    func(doc map[string]interface{}) []Hit
+	Content     func(lines []string) []Hit
+	Set         func(docs []*Document) []SetHit
+}
+
+func (r Rule) issue(h Hit, file string, line int) Issue {
+	return Issue{Rule: r.ID, Severity: r.Severity, File: file, Line: line,
+		Field: h.Field, Message: h.Message, Suggestion: h.Suggestion}
+}
+
+// Check runs a document rule against doc.
+func (r Rule) Check(doc *Document) []Issue {
+	if r.Document == nil {
+		return nil
+	}
+	var issues []Issue
+	for _, h := range r.Document(doc.Obj) {
+		line := doc.Line
+		if h.Line > 0 {
+			line = doc.Line + h.Line - 1
+		}
+		issues = append(issues, r.issue(h, doc.File, line))
+	}
+	return issues
+}
+
+// Scan runs a content rule against the lines of file.
+func (r Rule) Scan(file string, lines []string) []Issue {
+	if r.Content == nil {
+		return nil
+	}
+	var issues []Issue
+	for _, h := range r.Content(lines) {
+		issues = append(issues, r.issue(h, file, h.Line))
+	}
+	return issues
+}
+
+// CheckSet runs a set rule against docs. Each issue carries the file of the
+// document it was reported against.
+func (r Rule) CheckSet(docs []*Document) []Issue {
+	if r.Set == nil {
+		return nil
+	}
+	var issues []Issue
+	for _, h := range r.Set(docs) {
+		line := h.Doc.Line
+		if h.Line > 0 {
+			line = h.Doc.Line + h.Line - 1
+		}
+		issues = append(issues, r.issue(h.Hit, h.Doc.File, line))
+	}
+	return issues
+}
@@ -0,0 +1,503 @@
+// inventory-images aggregates node image and OS versions across the fleet.
+//
+// For every machine pool (KubeadmControlPlane, MachineDeployment, MachinePool)
+// it collects the image/AMI/VM template referenced by the machine template and
+// by each infrastructure machine, and optionally the OS image, kernel, kubelet
+// and container runtime reported by the workload nodes. Pools running mixed
+// images or kubelet versions and images older than --max-age are flagged.
+//
+// Image age is taken from --image-dates (a YAML map of image → build date) or
+// from a date embedded in the image name (YYYYMMDD, YYYY-MM-DD or a Unix
+// timestamp), as produced by image-builder.
+//
+// Usage:
+//
+//	go run ./inventory-images [flags]
+//
+// Examples:
+//
+//	go run ./inventory-images -A
+//	go run ./inventory-images -n default -c my-cluster --nodes
+//	go run ./inventory-images -A --max-age 60d --image-dates ./image-dates.yaml
+//	go run ./inventory-images -A --format json -o images.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+// imageFields lists, per infrastructure machine (template) kind, the spec
+// paths that identify the node image. Paths are relative to the machine spec.
+var imageFields = map[string][]string{
+	"AWSMachine":        {"ami.id", "imageLookupBaseOS", "imageLookupFormat"},
+	"AzureMachine":      {"image.id", "image.marketplace.offer", "image.marketplace.sku", "image.marketplace.version", "image.computeGallery.name", "image.computeGallery.version"},
+	"GCPMachine":        {"image", "imageFamily"},
+	"VSphereMachine":    {"template"},
+	"OpenStackMachine":  {"image.id", "image.filter.name", "image"},
+	"DockerMachine":     {"customImage"},
+	"HCloudMachine":     {"imageName"},
+	"DOMachine":         {"image"},
+	"Metal3Machine":     {"image.url"},
+	"NutanixMachine":    {"image.name", "image.uuid"},
+	"IBMPowerVSMachine": {"image.name", "imageRef.name"},
+	"OCIMachine":        {"imageId"},
+	"CloudStackMachine": {"template.name", "template.id"},
+	"LinodeMachine":     {"image"},
+	"ProxmoxMachine":    {"templateID"},
+	"OutscaleMachine":   {"node.image.name"},
+	"VCDMachine":        {"template"},
+}
+
+// fallbackKeys are tried when the kind is unknown.
+var fallbackKeys = []string{"image", "ami", "customImage", "imageName", "template", "imageId"}
+
+var datePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(20\d{2})-?(0[1-9]|1[0-2])-?(0[1-9]|[12]\d|3[01])`),
+	regexp.MustCompile(`\b(1[5-9]\d{8})\b`),
+}
+
+type poolInventory struct {
+	Kind          string         `json:"kind"`
+	Name          string         `json:"name"`
+	Template      string         `json:"template,omitempty"`
+	TemplateImage string         `json:"template_image,omitempty"`
+	MachineImages map[string]int `json:"machine_images"`
+	OSImages      map[string]int `json:"os_images,omitempty"`
+	Kubelets      map[string]int `json:"kubelet_versions,omitempty"`
+	Runtimes      map[string]int `json:"container_runtimes,omitempty"`
+	Kernels       map[string]int `json:"kernels,omitempty"`
+	ImageAge      string         `json:"image_age,omitempty"`
+	Flags         []string       `json:"flags,omitempty"`
+}
+
+type clusterInventory struct {
+	Cluster   string           `json:"cluster"`
+	Namespace string           `json:"namespace"`
+	NodesNote string           `json:"nodes_note,omitempty"`
+	Pools     []*poolInventory `json:"pools"`
+}
+
+// imageOf extracts a human-readable image reference from an infrastructure
+// machine or machine template object.
+func imageOf(obj map[string]interface{}) string {
+	kind := strings.TrimSuffix(kubectl.GetString(obj, "kind"), "Template")
+	spec := kubectl.GetMap(obj, "spec")
+	if tmpl := kubectl.GetMap(kubectl.GetMap(spec, "template"), "spec"); len(tmpl) > 0 {
+		spec = tmpl
+	}
+
+	var parts []string
+	paths, known := imageFields[kind]
+	if !known {
+		paths = fallbackKeys
+	}
+	for _, p := range paths {
+		v := kubectl.GetNested(spec, p)
+		switch val := v.(type) {
+		case string:
+			if val != "" {
+				parts = append(parts, val)
+			}
+		case float64:
+			parts = append(parts, strconv.FormatFloat(val, 'f', -1, 64))
+		}
+		if !known && len(parts) > 0 {
+			break
+		}
+	}
+	return strings.Join(parts, ":")
+}
+
+// imageDate finds a build date embedded in an image reference.
+func imageDate(image string) (time.Time, bool) {
+	if m := datePatterns[0].FindStringSubmatch(image); m != nil {
+		t, err := time.Parse("20060102", m[1]+m[2]+m[3])
+		return t, err == nil
+	}
+	if m := datePatterns[1].FindStringSubmatch(image); m != nil {
+		sec, _ := strconv.ParseInt(m[1], 10, 64)
+		return time.Unix(sec, 0), true
+	}
+	return time.Time{}, false
+}
+
+// parseAge accepts Go durations plus a "d" (days) suffix.
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func loadImageDates(path string) (map[string]time.Time, error) {
+	out := map[string]time.Time{}
+	if path == "" {
+		return out, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]string
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for image, date := range raw {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil, fmt.Errorf("%s: image %s: %w", path, image, err)
+		}
+		out[image] = t
+	}
+	return out, nil
+}
+
+type collector struct {
+	nodes      bool
+	maxAge     time.Duration
+	imageDates map[string]time.Time
+	cache      map[string]map[string]interface{}
+}
+
+func (c *collector) getRef(ref map[string]interface{}, namespace string) map[string]interface{} {
+	kind, _ := ref["kind"].(string)
+	name, _ := ref["name"].(string)
+	apiVersion, _ := ref["apiVersion"].(string)
+	if kind == "" || name == "" {
+		return nil
+	}
+	resource := strings.ToLower(kind)
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		resource += "." + apiVersion[:i]
+	} else if group, _ := ref["apiGroup"].(string); group != "" {
+		resource += "." + group
+	}
+	key := resource + "/" + namespace + "/" + name
+	if obj, ok := c.cache[key]; ok {
+		return obj
+	}
+	items, _ := kubectl.RunJSON(resource+"/"+name, namespace, "", false)
+	var obj map[string]interface{}
+	if len(items) > 0 {
+		obj = items[0]
+	}
+	c.cache[key] = obj
+	return obj
+}
+
+func poolOf(machine map[string]interface{}) (string, string) {
+	labels := kubectl.Labels(machine)
+	switch {
+	case labels["cluster.x-k8s.io/control-plane-name"] != "":
+		return "KubeadmControlPlane", labels["cluster.x-k8s.io/control-plane-name"]
+	case labels["cluster.x-k8s.io/deployment-name"] != "":
+		return "MachineDeployment", labels["cluster.x-k8s.io/deployment-name"]
+	case labels["cluster.x-k8s.io/pool-name"] != "":
+		return "MachinePool", labels["cluster.x-k8s.io/pool-name"]
+	}
+	return "Machine", "standalone"
+}
+
+func workloadNodes(cluster, namespace string) (map[string]map[string]interface{}, error) {
+	kubeconfig, err := kubectl.WorkloadKubeconfig(cluster, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(kubeconfig)
+	ok, out, errMsg := kubectl.Run([]string{"--kubeconfig", kubeconfig, "get", "nodes", "-o", "json"}, 0)
+	if !ok {
+		return nil, fmt.Errorf("list nodes: %s", strings.TrimSpace(errMsg))
+	}
+	items, err := kubectl.ParseItems(out)
+	if err != nil {
+		return nil, err
+	}
+	nodes := map[string]map[string]interface{}{}
+	for _, n := range items {
+		nodes[kubectl.GetString(n, "metadata.name")] = kubectl.GetMap(kubectl.GetMap(n, "status"), "nodeInfo")
+	}
+	return nodes, nil
+}
+
+func (c *collector) cluster(cluster map[string]interface{}) clusterInventory {
+	name := kubectl.GetString(cluster, "metadata.name")
+	ns := kubectl.GetString(cluster, "metadata.namespace")
+	inv := clusterInventory{Cluster: name, Namespace: ns}
+	pools := map[string]*poolInventory{}
+	pool := func(kind, poolName string) *poolInventory {
+		key := kind + "/" + poolName
+		if p := pools[key]; p != nil {
+			return p
+		}
+		p := &poolInventory{Kind: kind, Name: poolName, MachineImages: map[string]int{}}
+		pools[key] = p
+		return p
+	}
+
+	label := "cluster.x-k8s.io/cluster-name=" + name
+	cpRef := kubectl.GetMap(kubectl.GetMap(cluster, "spec"), "controlPlaneRef")
+	if kind, _ := cpRef["kind"].(string); kind == "KubeadmControlPlane" {
+		if kcp := c.getRef(cpRef, ns); kcp != nil {
+			p := pool("KubeadmControlPlane", kubectl.GetString(kcp, "metadata.name"))
+			machineTemplate := kubectl.GetMap(kubectl.GetMap(kcp, "spec"), "machineTemplate")
+			ref := kubectl.GetMap(machineTemplate, "infrastructureRef")
+			if len(ref) == 0 {
+				ref = kubectl.GetMap(kubectl.GetMap(machineTemplate, "spec"), "infrastructureRef")
+			}
+			p.Template, _ = ref["name"].(string)
+			if tmpl := c.getRef(ref, ns); tmpl != nil {
+				p.TemplateImage = imageOf(tmpl)
+			}
+		}
+	}
+	for _, w := range []struct{ kind, resource, path string }{
+		{"MachineDeployment", "machinedeployments.cluster.x-k8s.io", "spec.template.spec.infrastructureRef"},
+		{"MachinePool", "machinepools.cluster.x-k8s.io", "spec.template.spec.infrastructureRef"},
+	} {
+		items, _ := kubectl.RunJSON(w.resource, ns, label, false)
+		for _, item := range items {
+			p := pool(w.kind, kubectl.GetString(item, "metadata.name"))
+			ref, _ := kubectl.GetNested(item, w.path).(map[string]interface{})
+			p.Template, _ = ref["name"].(string)
+			if tmpl := c.getRef(ref, ns); tmpl != nil {
+				p.TemplateImage = imageOf(tmpl)
+			}
+		}
+	}
+
+	var nodes map[string]map[string]interface{}
+	if c.nodes {
+		var err error
+		nodes, err = workloadNodes(name, ns)
+		if err != nil {
+			inv.NodesNote = "node info unavailable: " + err.Error()
+		}
+	}
+
+	machines, _ := kubectl.RunJSON("machines.cluster.x-k8s.io", ns, label, false)
+	for _, m := range machines {
+		p := pool(poolOf(m))
+		if infra := c.getRef(kubectl.GetMap(kubectl.GetMap(m, "spec"), "infrastructureRef"), ns); infra != nil {
+			if img := imageOf(infra); img != "" {
+				p.MachineImages[img]++
+			}
+		}
+		info := nodes[kubectl.GetString(m, "status.nodeRef.name")]
+		if info == nil {
+			continue
+		}
+		if p.OSImages == nil {
+			p.OSImages, p.Kubelets, p.Runtimes, p.Kernels = map[string]int{}, map[string]int{}, map[string]int{}, map[string]int{}
+		}
+		p.OSImages[kubectl.GetString(info, "osImage")]++
+		p.Kubelets[kubectl.GetString(info, "kubeletVersion")]++
+		p.Runtimes[kubectl.GetString(info, "containerRuntimeVersion")]++
+		p.Kernels[kubectl.GetString(info, "kernelVersion")]++
+	}
+
+	keys := make([]string, 0, len(pools))
+	for k := range pools {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := pools[k]
+		c.flag(p)
+		inv.Pools = append(inv.Pools, p)
+	}
+	if inv.Pools == nil {
+		inv.Pools = []*poolInventory{}
+	}
+	return inv
+}
+
+func (c *collector) flag(p *poolInventory) {
+	if len(p.MachineImages) > 1 {
+		p.Flags = append(p.Flags, fmt.Sprintf("mixed machine images (%d distinct)", len(p.MachineImages)))
+	}
+	if p.TemplateImage != "" && len(p.MachineImages) > 0 && p.MachineImages[p.TemplateImage] == 0 {
+		p.Flags = append(p.Flags, "no machine runs the current template image (rollout pending?)")
+	}
+	if len(p.Kubelets) > 1 {
+		p.Flags = append(p.Flags, fmt.Sprintf("mixed kubelet versions (%d distinct)", len(p.Kubelets)))
+	}
+	if len(p.OSImages) > 1 {
+		p.Flags = append(p.Flags, fmt.Sprintf("mixed OS images (%d distinct)", len(p.OSImages)))
+	}
+
+	// Age is judged on the oldest image actually running in the pool.
+	images := []string{p.TemplateImage}
+	for img := range p.MachineImages {
+		images = append(images, img)
+	}
+	var oldest time.Time
+	for _, img := range images {
+		if img == "" {
+			continue
+		}
+		t, ok := c.imageDates[img]
+		if !ok {
+			t, ok = imageDate(img)
+		}
+		if ok && (oldest.IsZero() || t.Before(oldest)) {
+			oldest = t
+		}
+	}
+	if oldest.IsZero() {
+		return
+	}
+	age := time.Since(oldest)
+	p.ImageAge = fmt.Sprintf("%dd", int(age.Hours()/24))
+	if c.maxAge > 0 && age > c.maxAge {
+		p.Flags = append(p.Flags, fmt.Sprintf("image is %s old (built %s), exceeds max age", p.ImageAge, oldest.Format("2006-01-02")))
+	}
+}
+
+func summarize(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if len(counts) == 1 {
+			parts = append(parts, k)
+		} else {
+			parts = append(parts, fmt.Sprintf("%s ×%d", k, counts[k]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func printInventory(inventories []clusterInventory) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("%s\nNODE IMAGE INVENTORY\n%s\n", sep, sep)
+	flagged := 0
+	for _, inv := range inventories {
+		fmt.Printf("\n🖥️  %s/%s\n", inv.Namespace, inv.Cluster)
+		if inv.NodesNote != "" {
+			fmt.Printf("   ⚠️  %s\n", inv.NodesNote)
+		}
+		for _, p := range inv.Pools {
+			icon := "✅"
+			if len(p.Flags) > 0 {
+				icon = "⚠️"
+				flagged++
+			}
+			fmt.Printf("   %s %s/%s\n", icon, p.Kind, p.Name)
+			if p.Template != "" {
+				fmt.Printf("      Template:  %s → %s\n", p.Template, orDash(p.TemplateImage))
+			}
+			fmt.Printf("      Machines:  %s\n", summarize(p.MachineImages))
+			if p.ImageAge != "" {
+				fmt.Printf("      Image age: %s\n", p.ImageAge)
+			}
+			if len(p.OSImages) > 0 {
+				fmt.Printf("      OS:        %s\n", summarize(p.OSImages))
+				fmt.Printf("      Kernel:    %s\n", summarize(p.Kernels))
+				fmt.Printf("      Kubelet:   %s\n", summarize(p.Kubelets))
+				fmt.Printf("      Runtime:   %s\n", summarize(p.Runtimes))
+			}
+			for _, f := range p.Flags {
+				fmt.Printf("      ⚠️  %s\n", f)
+			}
+		}
+	}
+	fmt.Printf("\n%s\nClusters: %d, flagged pools: %d\n", sep, len(inventories), flagged)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func main() {
+	namespace := flag.String("n", "", "Namespace to inventory")
+	allNS := flag.Bool("A", false, "Inventory all namespaces")
+	cluster := flag.String("c", "", "Only inventory this cluster")
+	nodes := flag.Bool("nodes", false, "Read OS/kubelet/containerd versions from workload nodes")
+	maxAge := flag.String("max-age", "90d", "Flag images older than this (e.g. 90d, 720h; 0 disables)")
+	imageDates := flag.String("image-dates", "", "YAML file mapping image references to build dates (YYYY-MM-DD)")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nInventory node images and OS versions across CAPI clusters.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	age := time.Duration(0)
+	if *maxAge != "0" {
+		var err error
+		if age, err = parseAge(*maxAge); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --max-age: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	dates, err := loadImageDates(*imageDates)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	c := &collector{nodes: *nodes, maxAge: age, imageDates: dates, cache: map[string]map[string]interface{}{}}
+	clusters, err := kubectl.RunJSON("clusters.cluster.x-k8s.io", *namespace, "", *allNS)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var inventories []clusterInventory
+	for _, cl := range clusters {
+		if *cluster != "" && kubectl.GetString(cl, "metadata.name") != *cluster {
+			continue
+		}
+		inventories = append(inventories, c.cluster(cl))
+	}
+	if len(inventories) == 0 {
+		fmt.Println("No clusters found")
+		os.Exit(0)
+	}
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(inventories, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printInventory(inventories)
+	}
+}
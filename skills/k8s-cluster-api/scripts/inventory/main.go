@@ -0,0 +1,330 @@
+// inventory exports a flat fleet inventory for CMDBs and chargeback systems.
+//
+// Every Cluster becomes one row: namespace, name, phase, Kubernetes version,
+// infrastructure and control plane providers, ClusterClass, control plane and
+// worker machine counts, instance types (read from the infrastructure
+// machines), API endpoint, creation time and selected owner labels. Output is
+// CSV, JSON, a SQL script, or a SQLite database (written with the sqlite3
+// CLI).
+//
+// Usage:
+//
+//	go run ./inventory [flags]
+//
+// Examples:
+//
+//	go run ./inventory -A > fleet.csv
+//	go run ./inventory -A --format json -o fleet.json
+//	go run ./inventory -A --format sqlite -o fleet.db
+//	go run ./inventory -A --labels team,cost-center,env --format sql > fleet.sql
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+// instanceTypeFields are spec fields that name a machine size across providers.
+var instanceTypeFields = []string{"instanceType", "vmSize", "machineType", "flavor", "serverType", "size", "type"}
+
+type row struct {
+	Namespace         string            `json:"namespace"`
+	Cluster           string            `json:"cluster"`
+	Phase             string            `json:"phase"`
+	KubernetesVersion string            `json:"kubernetes_version"`
+	Infrastructure    string            `json:"infrastructure_provider"`
+	ControlPlane      string            `json:"control_plane_provider"`
+	ClusterClass      string            `json:"cluster_class,omitempty"`
+	CPMachines        int               `json:"control_plane_machines"`
+	WorkerMachines    int               `json:"worker_machines"`
+	InstanceTypes     string            `json:"instance_types"`
+	Endpoint          string            `json:"endpoint"`
+	Created           string            `json:"created"`
+	Labels            map[string]string `json:"labels,omitempty"`
+}
+
+func providerName(kind, suffix string) string {
+	if kind == "" {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(kind, suffix))
+}
+
+func instanceType(infra map[string]interface{}) string {
+	spec := kubectl.GetMap(infra, "spec")
+	for _, f := range instanceTypeFields {
+		switch v := spec[f].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case map[string]interface{}:
+			if name, _ := v["name"].(string); name != "" {
+				return name
+			}
+		}
+	}
+	// vSphere-style sizing
+	cpus, _ := spec["numCPUs"].(float64)
+	mem, _ := spec["memoryMiB"].(float64)
+	if cpus > 0 {
+		return fmt.Sprintf("%dcpu-%dMiB", int(cpus), int(mem))
+	}
+	if kind := kubectl.GetString(infra, "kind"); kind != "" {
+		return providerName(kind, "Machine")
+	}
+	return "unknown"
+}
+
+func collect(namespace string, allNS bool, labelKeys []string) ([]*row, error) {
+	clusters, err := kubectl.RunJSON("clusters.cluster.x-k8s.io", namespace, "", allNS)
+	if err != nil {
+		return nil, err
+	}
+	machines, _ := kubectl.RunJSON("machines.cluster.x-k8s.io", namespace, "", allNS)
+	cps, _ := kubectl.RunJSON("kubeadmcontrolplanes", namespace, "", allNS)
+
+	cpVersion := map[string]string{}
+	for _, cp := range cps {
+		cpVersion[kubectl.GetString(cp, "metadata.namespace")+"/"+kubectl.GetString(cp, "metadata.name")] = kubectl.GetString(cp, "spec.version")
+	}
+
+	// Infrastructure machines, keyed by kind/namespace/name.
+	infra := map[string]map[string]interface{}{}
+	kinds := map[string]bool{}
+	for _, m := range machines {
+		if k := kubectl.GetString(m, "spec.infrastructureRef.kind"); k != "" {
+			kinds[k] = true
+		}
+	}
+	for k := range kinds {
+		items, _ := kubectl.RunJSON(strings.ToLower(k), namespace, "", allNS)
+		for _, item := range items {
+			infra[k+"/"+kubectl.GetString(item, "metadata.namespace")+"/"+kubectl.GetString(item, "metadata.name")] = item
+		}
+	}
+
+	var rows []*row
+	for _, c := range clusters {
+		r := &row{
+			Namespace:      kubectl.GetString(c, "metadata.namespace"),
+			Cluster:        kubectl.GetString(c, "metadata.name"),
+			Phase:          kubectl.GetString(c, "status.phase"),
+			Infrastructure: providerName(kubectl.GetString(c, "spec.infrastructureRef.kind"), "Cluster"),
+			ControlPlane:   providerName(kubectl.GetString(c, "spec.controlPlaneRef.kind"), "ControlPlane"),
+			ClusterClass:   kubectl.GetString(c, "spec.topology.class"),
+			Created:        kubectl.GetString(c, "metadata.creationTimestamp"),
+		}
+		if host := kubectl.GetString(c, "spec.controlPlaneEndpoint.host"); host != "" {
+			port, _ := kubectl.GetNested(c, "spec.controlPlaneEndpoint.port").(float64)
+			r.Endpoint = fmt.Sprintf("%s:%d", host, int(port))
+		}
+		r.KubernetesVersion = kubectl.GetString(c, "spec.topology.version")
+		if r.KubernetesVersion == "" {
+			r.KubernetesVersion = cpVersion[r.Namespace+"/"+kubectl.GetString(c, "spec.controlPlaneRef.name")]
+		}
+		labels := kubectl.Labels(c)
+		for _, k := range labelKeys {
+			if v, ok := labels[k]; ok {
+				if r.Labels == nil {
+					r.Labels = map[string]string{}
+				}
+				r.Labels[k] = v
+			}
+		}
+
+		types := map[string]int{}
+		for _, m := range machines {
+			if kubectl.GetString(m, "metadata.namespace") != r.Namespace || kubectl.GetString(m, "spec.clusterName") != r.Cluster {
+				continue
+			}
+			if _, ok := kubectl.Labels(m)["cluster.x-k8s.io/control-plane"]; ok {
+				r.CPMachines++
+			} else {
+				r.WorkerMachines++
+			}
+			if r.KubernetesVersion == "" {
+				r.KubernetesVersion = kubectl.GetString(m, "spec.version")
+			}
+			key := kubectl.GetString(m, "spec.infrastructureRef.kind") + "/" + r.Namespace + "/" + kubectl.GetString(m, "spec.infrastructureRef.name")
+			if item, ok := infra[key]; ok {
+				types[instanceType(item)]++
+			}
+		}
+		names := make([]string, 0, len(types))
+		for t := range types {
+			names = append(names, t)
+		}
+		sort.Strings(names)
+		var parts []string
+		for _, t := range names {
+			parts = append(parts, fmt.Sprintf("%s x%d", t, types[t]))
+		}
+		r.InstanceTypes = strings.Join(parts, "; ")
+		rows = append(rows, r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Namespace != rows[j].Namespace {
+			return rows[i].Namespace < rows[j].Namespace
+		}
+		return rows[i].Cluster < rows[j].Cluster
+	})
+	return rows, nil
+}
+
+var baseColumns = []string{"namespace", "cluster", "phase", "kubernetes_version", "infrastructure_provider",
+	"control_plane_provider", "cluster_class", "control_plane_machines", "worker_machines", "instance_types", "endpoint", "created"}
+
+func labelColumn(key string) string {
+	return "label_" + strings.NewReplacer(".", "_", "/", "_", "-", "_").Replace(key)
+}
+
+func (r *row) values(labelKeys []string) []string {
+	v := []string{r.Namespace, r.Cluster, r.Phase, r.KubernetesVersion, r.Infrastructure, r.ControlPlane, r.ClusterClass,
+		strconv.Itoa(r.CPMachines), strconv.Itoa(r.WorkerMachines), r.InstanceTypes, r.Endpoint, r.Created}
+	for _, k := range labelKeys {
+		v = append(v, r.Labels[k])
+	}
+	return v
+}
+
+func renderCSV(rows []*row, labelKeys []string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	header := append([]string{}, baseColumns...)
+	for _, k := range labelKeys {
+		header = append(header, labelColumn(k))
+	}
+	_ = w.Write(header)
+	for _, r := range rows {
+		_ = w.Write(r.values(labelKeys))
+	}
+	w.Flush()
+	return b.String()
+}
+
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func renderSQL(rows []*row, labelKeys []string) string {
+	var b strings.Builder
+	cols := append([]string{}, baseColumns...)
+	for _, k := range labelKeys {
+		cols = append(cols, labelColumn(k))
+	}
+	b.WriteString("DROP TABLE IF EXISTS clusters;\nCREATE TABLE clusters (\n")
+	for i, c := range cols {
+		typ := "TEXT"
+		if c == "control_plane_machines" || c == "worker_machines" {
+			typ = "INTEGER"
+		}
+		sep := ","
+		if i == len(cols)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, "  %s %s%s\n", c, typ, sep)
+	}
+	b.WriteString(");\nBEGIN;\n")
+	for _, r := range rows {
+		vals := r.values(labelKeys)
+		quoted := make([]string, len(vals))
+		for i, v := range vals {
+			if cols[i] == "control_plane_machines" || cols[i] == "worker_machines" {
+				quoted[i] = v
+			} else {
+				quoted[i] = sqlQuote(v)
+			}
+		}
+		fmt.Fprintf(&b, "INSERT INTO clusters (%s) VALUES (%s);\n", strings.Join(cols, ", "), strings.Join(quoted, ", "))
+	}
+	b.WriteString("COMMIT;\n")
+	return b.String()
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace")
+	allNS := flag.Bool("A", false, "All namespaces")
+	labelList := flag.String("labels", "owner,team,cost-center", "Comma-separated Cluster labels to export as columns")
+	format := flag.String("format", "csv", "Output format: csv, json, sql, sqlite")
+	output := flag.String("o", "", "Write inventory to file (required for sqlite)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nExport a flat cluster inventory as CSV, JSON, SQL or SQLite.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	switch *format {
+	case "csv", "json", "sql":
+	case "sqlite":
+		if *output == "" {
+			fmt.Fprintln(os.Stderr, "Error: --format sqlite needs -o <file.db>")
+			os.Exit(1)
+		}
+		if _, err := exec.LookPath("sqlite3"); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: sqlite3 not found in PATH (use --format sql and load it yourself)")
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		os.Exit(1)
+	}
+	var labelKeys []string
+	for _, k := range strings.Split(*labelList, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			labelKeys = append(labelKeys, k)
+		}
+	}
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	rows, err := collect(*namespace, *allNS, labelKeys)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var out string
+	switch *format {
+	case "csv":
+		out = renderCSV(rows, labelKeys)
+	case "json":
+		data, _ := json.MarshalIndent(rows, "", "  ")
+		out = string(data) + "\n"
+	case "sql", "sqlite":
+		out = renderSQL(rows, labelKeys)
+	}
+
+	if *format == "sqlite" {
+		cmd := exec.Command("sqlite3", *output)
+		cmd.Stdin = strings.NewReader(out)
+		if msg, err := cmd.CombinedOutput(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: sqlite3: %v: %s\n", err, strings.TrimSpace(string(msg)))
+			os.Exit(1)
+		}
+		fmt.Printf("Inventory written to: %s (%d clusters, table clusters)\n", *output, len(rows))
+		return
+	}
+	if *output != "" {
+		if err := os.WriteFile(*output, []byte(out), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Inventory written to: %s (%d clusters)\n", *output, len(rows))
+		return
+	}
+	fmt.Print(out)
+}
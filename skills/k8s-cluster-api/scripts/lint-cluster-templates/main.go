@@ -2,272 +2,711 @@
 //
 // Usage:
 //
-//	go run ./lint-cluster-templates [files...] [flags]
+//	go run ./lint-cluster-templates [flags] [files|dirs|-...]
 //
 // Examples:
 //
 //	go run ./lint-cluster-templates manifest.yaml
 //	go run ./lint-cluster-templates -d ./manifests/ --strict
 //	go run ./lint-cluster-templates --assets
+//	go run ./lint-cluster-templates --list-rules
+//	go run ./lint-cluster-templates --config .capilint.yaml -d ./templates/
+//	go run ./lint-cluster-templates --format sarif -d ./templates/ > lint.sarif
+//	go run ./lint-cluster-templates --format github -d ./templates/
+//	go run ./lint-cluster-templates --var-file clusterctl-vars.yaml cluster-template.yaml
+//	go run ./lint-cluster-templates -r ./clusters/
+//	go run ./lint-cluster-templates --crd-dir ./vendor/crds -d ./templates/
+//	go run ./lint-cluster-templates --live-schema cluster.yaml
+//	kustomize build overlays/prod | go run ./lint-cluster-templates --stdin-name prod.yaml -
 package main
 
 import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+	"k8s-cluster-api-tools/internal/validation"
 
 	"gopkg.in/yaml.v3"
 )
 
-type severity int
+type lintResult struct {
+	File   string             `json:"file"`
+	Issues []validation.Issue `json:"issues"`
+	docs   []validation.Document
+	vars   []varRef
+}
 
-const (
-	sevError severity = iota
-	sevWarning
-	sevInfo
-)
+func (r lintResult) hasErrors() bool {
+	for _, i := range r.Issues {
+		if i.Severity == validation.Error {
+			return true
+		}
+	}
+	return false
+}
 
-func (s severity) String() string {
-	switch s {
-	case sevError:
-		return "error"
-	case sevWarning:
-		return "warning"
-	case sevInfo:
-		return "info"
+func (r lintResult) hasWarnings() bool {
+	for _, i := range r.Issues {
+		if i.Severity == validation.Warning {
+			return true
+		}
 	}
-	return "unknown"
+	return false
 }
 
-type lintIssue struct {
-	Sev        severity `json:"-"`
-	SevStr     string   `json:"severity"`
-	Message    string   `json:"message"`
-	File       string   `json:"file"`
-	Line       int      `json:"line,omitempty"`
-	Suggestion string   `json:"suggestion,omitempty"`
+// templateVars holds the variables loaded with --var-file; nil when no file
+// was given.
+var templateVars map[string]string
+
+// varRef is one placeholder occurrence in a template.
+type varRef struct {
+	Name       string
+	Line       int
+	HasDefault bool
 }
 
-func (i lintIssue) String() string {
-	icon := map[severity]string{sevError: "❌", sevWarning: "⚠️", sevInfo: "ℹ️"}[i.Sev]
-	loc := i.File
-	if i.Line > 0 {
-		loc = fmt.Sprintf("%s:%d", i.File, i.Line)
+func findVarRefs(content string) []varRef {
+	var refs []varRef
+	for i, line := range strings.Split(content, "\n") {
+		for _, m := range validation.TemplateVarPattern.FindAllStringSubmatchIndex(line, -1) {
+			refs = append(refs, varRef{line[m[2]:m[3]], i + 1, m[4] >= 0})
+		}
+	}
+	return refs
+}
+
+// substituteVars resolves placeholders the way clusterctl does: values from
+// --var-file first, then inline defaults. Unresolved placeholders are kept so
+// rules see them as template values rather than missing fields.
+func substituteVars(content string) string {
+	return validation.TemplateVarPattern.ReplaceAllStringFunc(content, func(m string) string {
+		sub := validation.TemplateVarPattern.FindStringSubmatch(m)
+		if v, ok := templateVars[sub[1]]; ok && v != "" {
+			return v
+		}
+		if strings.Contains(m, "=") {
+			return sub[2]
+		}
+		return m
+	})
+}
+
+// loadVarFile reads a clusterctl-style YAML map (KEY: value) or a KEY=VALUE
+// env file. It also returns the line each variable is declared on.
+func loadVarFile(path string) (map[string]string, map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
 	}
-	s := fmt.Sprintf("%s %s %s", icon, loc, i.Message)
-	if i.Suggestion != "" {
-		s += " → " + i.Suggestion
+	vars, lines := map[string]string{}, map[string]int{}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err == nil && len(node.Content) > 0 && node.Content[0].Kind == yaml.MappingNode {
+		m := node.Content[0]
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			vars[m.Content[i].Value] = m.Content[i+1].Value
+			lines[m.Content[i].Value] = m.Content[i].Line
+		}
+		return vars, lines, nil
 	}
-	return s
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "export "))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, i+1)
+		}
+		k = strings.TrimSpace(k)
+		vars[k] = strings.Trim(strings.TrimSpace(v), `"'`)
+		lines[k] = i + 1
+	}
+	return vars, lines, nil
 }
 
-type lintResult struct {
-	File   string      `json:"file"`
-	Issues []lintIssue `json:"issues"`
+// parseErrorRule tags files that could not be read or parsed. It is not a
+// registered rule and cannot be disabled.
+const parseErrorRule = "CAPI000"
+
+// ruleRegistry lists every rule in ID order. Add new rules here with the next
+// free ID; IDs are never reused so configs stay valid. Rules shared with
+// validate-manifests live in internal/validation.
+var ruleRegistry = []validation.Rule{
+	validation.RequiredFields,
+	validation.DeprecatedAPIVersion,
+	validation.RequiredSpecFields,
+	validation.DeprecatedFields,
+	{ID: "CAPI005", Name: "missing-namespace", Severity: validation.Info,
+		Description: "Objects without metadata.namespace land in the default namespace", Document: ruleMissingNamespace},
+	validation.HardcodedCredentials,
+	{ID: "CAPI007", Name: "clusterclass-undefined-variable", Severity: validation.Error,
+		Description: "ClusterClass patches referencing variables the class does not define", Document: ruleUndefinedVariables},
+	{ID: "CAPI008", Name: "clusterclass-variable-schema", Severity: validation.Warning,
+		Description: "ClusterClass variables without an openAPIV3Schema type", Document: ruleVariableSchema},
+	{ID: "CAPI009", Name: "clusterclass-missing-class", Severity: validation.Error,
+		Description: "Cluster topologies using worker classes their ClusterClass does not define", Set: ruleMissingWorkerClass},
+	{ID: "CAPI010", Name: "clusterclass-deprecated-patch", Severity: validation.Warning,
+		Description: "Deprecated or conflicting ClusterClass patch definitions", Document: ruleDeprecatedPatches},
+	{ID: "CAPI011", Name: "template-variables", Severity: validation.Warning,
+		Description: "Template variables missing from --var-file (unused ones are reported against the var file)", Content: ruleUndeclaredVariables},
+	validation.CRDSchema(&crdSchemas),
+	validation.AlphaAPIVersion,
 }
 
-func (r lintResult) hasErrors() bool {
-	for _, i := range r.Issues {
-		if i.Sev == sevError {
-			return true
+// crdSchemas holds the CRD schemas loaded with --crd-dir or --live-schema;
+// nil when neither is set.
+var crdSchemas validation.Schemas
+
+func ruleMissingNamespace(doc map[string]interface{}) []validation.Hit {
+	if metadata, ok := doc["metadata"].(map[string]interface{}); ok {
+		if _, ok := metadata["namespace"]; !ok {
+			return []validation.Hit{{Message: "No namespace specified - will use default"}}
 		}
 	}
-	return false
+	return nil
 }
 
-func (r lintResult) hasWarnings() bool {
-	for _, i := range r.Issues {
-		if i.Sev == sevWarning {
-			return true
+// ruleUndeclaredVariables flags placeholders without an inline default that
+// the var file does not set. It only runs with --var-file.
+func ruleUndeclaredVariables(lines []string) []validation.Hit {
+	if templateVars == nil {
+		return nil
+	}
+	var hits []validation.Hit
+	for _, ref := range findVarRefs(strings.Join(lines, "\n")) {
+		if _, ok := templateVars[ref.Name]; !ok && !ref.HasDefault {
+			hits = append(hits, validation.Hit{Message: fmt.Sprintf("Variable ${%s} is not declared in the var file", ref.Name),
+				Suggestion: fmt.Sprintf("Add %s to the var file or give it a default: ${%s:=value}", ref.Name, ref.Name),
+				Line:       ref.Line})
 		}
 	}
-	return false
+	return hits
 }
 
-var capiAPIVersions = map[string]struct {
-	deprecated  bool
-	replacement string
-}{
-	"cluster.x-k8s.io/v1alpha3":              {true, "v1beta1"},
-	"cluster.x-k8s.io/v1alpha4":              {true, "v1beta1"},
-	"infrastructure.cluster.x-k8s.io/v1alpha3": {true, "v1beta1"},
-	"infrastructure.cluster.x-k8s.io/v1alpha4": {true, "v1beta1"},
-	"bootstrap.cluster.x-k8s.io/v1alpha3":      {true, "v1beta1"},
-	"bootstrap.cluster.x-k8s.io/v1alpha4":      {true, "v1beta1"},
-	"controlplane.cluster.x-k8s.io/v1alpha3":   {true, "v1beta1"},
-	"controlplane.cluster.x-k8s.io/v1alpha4":   {true, "v1beta1"},
-}
-
-var capiKinds = map[string][]string{
-	"Cluster":            {"clusterName:opt", "infrastructureRef", "controlPlaneRef"},
-	"Machine":            {"clusterName", "bootstrap"},
-	"MachineDeployment":  {"clusterName", "template"},
-	"MachineSet":         {"clusterName", "template"},
-	"ClusterClass":       {"infrastructure", "controlPlane"},
-	"MachineHealthCheck": {"clusterName", "selector", "unhealthyConditions"},
-	"MachinePool":        {"clusterName", "template"},
-}
-
-var deprecatedFieldsMap = map[string]map[string]struct {
+// unusedVariables reports var file entries no linted template references.
+// They are always info: an unused variable is harmless, so severity overrides
+// of CAPI011 only apply to undeclared ones.
+func unusedVariables(results []lintResult, varFile string, lines map[string]int, cfg *lintConfig) lintResult {
+	result := lintResult{File: varFile}
+	var rule validation.Rule
+	for _, r := range ruleRegistry {
+		if r.ID == "CAPI011" {
+			rule = r
+		}
+	}
+	_, ok := cfg.active(rule, varFile)
+	if !ok {
+		return result
+	}
+	used := map[string]bool{}
+	for _, r := range results {
+		for _, ref := range r.vars {
+			used[ref.Name] = true
+		}
+	}
+	var names []string
+	for name := range templateVars {
+		if !used[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return lines[names[i]] < lines[names[j]] })
+	for _, name := range names {
+		result.Issues = append(result.Issues, validation.Issue{Rule: rule.ID, Severity: validation.Info, File: varFile,
+			Line: lines[name], Message: fmt.Sprintf("Variable %s is not used by any template", name)})
+	}
+	return result
+}
+
+// patchVariablePattern matches Go template references such as
+// {{ .podSecurityStandard.enforce }} inside patch templates and enabledIf.
+var patchVariablePattern = regexp.MustCompile(`\.([A-Za-z_][A-Za-z0-9_]*)`)
+var templateActionPattern = regexp.MustCompile(`\{\{(.*?)\}\}`)
+
+// deprecatedBuiltins lists builtin variables deprecated for patches.
+var deprecatedBuiltins = map[string]struct {
 	since   string
 	message string
 }{
-	"Cluster": {
-		"spec.paused": {"v1.4.0", "Use spec.topology.controlPlane/workers for managed clusters"},
-	},
-	"Machine": {
-		"spec.version": {"v1.5.0", "Version is now inherited from control plane or topology"},
-	},
+	"builtin.cluster.network.ipFamily": {"v1.5.0", "Derive the IP family from cluster.network pods/services CIDRs"},
 }
 
-var credentialPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`(?i)password:\s*['"]?[^${\s]+['"]?`),
-	regexp.MustCompile(`(?i)secret:\s*['"]?[^${\s]+['"]?`),
-	regexp.MustCompile(`(?i)token:\s*['"]?[a-zA-Z0-9+/=]{20,}['"]?`),
+func asMaps(v interface{}) []map[string]interface{} {
+	items, _ := v.([]interface{})
+	var out []map[string]interface{}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out
 }
 
-func lintDocument(doc map[string]interface{}, filePath string, startLine int) []lintIssue {
-	var issues []lintIssue
-
-	// Required top-level fields
-	if _, ok := doc["apiVersion"]; !ok {
-		issues = append(issues, lintIssue{sevError, "error", "Missing required field: apiVersion", filePath, startLine, ""})
+// patchVariableRefs returns the variables a patch reads, in order of
+// appearance: valueFrom.variable names plus references inside enabledIf and
+// valueFrom.template.
+func patchVariableRefs(patch map[string]interface{}) []string {
+	var refs []string
+	fromTemplate := func(tmpl string) {
+		for _, action := range templateActionPattern.FindAllStringSubmatch(tmpl, -1) {
+			for _, m := range patchVariablePattern.FindAllStringSubmatchIndex(action[1], -1) {
+				// Skip field accesses chained on an earlier reference.
+				if m[0] > 0 && isIdentChar(action[1][m[0]-1]) {
+					continue
+				}
+				refs = append(refs, action[1][m[2]:m[3]])
+			}
+		}
 	}
-	if _, ok := doc["kind"]; !ok {
-		issues = append(issues, lintIssue{sevError, "error", "Missing required field: kind", filePath, startLine, ""})
+	if s, ok := patch["enabledIf"].(string); ok {
+		fromTemplate(s)
 	}
-	metadata, _ := doc["metadata"].(map[string]interface{})
-	if metadata == nil {
-		issues = append(issues, lintIssue{sevError, "error", "Missing required field: metadata", filePath, startLine, ""})
-	} else if _, ok := metadata["name"]; !ok {
-		issues = append(issues, lintIssue{sevError, "error", "Missing required field: metadata.name", filePath, startLine, ""})
+	for _, def := range asMaps(patch["definitions"]) {
+		for _, jp := range asMaps(def["jsonPatches"]) {
+			vf, _ := jp["valueFrom"].(map[string]interface{})
+			if v, ok := vf["variable"].(string); ok {
+				refs = append(refs, v)
+			}
+			if t, ok := vf["template"].(string); ok {
+				fromTemplate(t)
+			}
+		}
 	}
+	return refs
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == ']' || c == ')' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
 
-	// Check API version
-	av, _ := doc["apiVersion"].(string)
-	if info, ok := capiAPIVersions[av]; ok && info.deprecated {
-		issues = append(issues, lintIssue{sevWarning, "warning",
-			fmt.Sprintf("Deprecated API version: %s", av), filePath, startLine,
-			fmt.Sprintf("Use cluster.x-k8s.io/%s", info.replacement)})
+func classSpec(doc map[string]interface{}) map[string]interface{} {
+	if kind, _ := doc["kind"].(string); kind != "ClusterClass" {
+		return nil
 	}
+	spec, _ := doc["spec"].(map[string]interface{})
+	return spec
+}
 
-	// Kind-specific checks
-	kind, _ := doc["kind"].(string)
-	if fields, ok := capiKinds[kind]; ok {
-		spec, _ := doc["spec"].(map[string]interface{})
-		if spec == nil {
-			spec = map[string]interface{}{}
+func ruleUndefinedVariables(doc map[string]interface{}) []validation.Hit {
+	spec := classSpec(doc)
+	if spec == nil {
+		return nil
+	}
+	defined := map[string]bool{}
+	for _, v := range asMaps(spec["variables"]) {
+		if name, ok := v["name"].(string); ok {
+			defined[name] = true
 		}
-		for _, field := range fields {
-			if strings.HasSuffix(field, ":opt") {
+	}
+	var hits []validation.Hit
+	for _, patch := range asMaps(spec["patches"]) {
+		name, _ := patch["name"].(string)
+		seen := map[string]bool{}
+		for _, ref := range patchVariableRefs(patch) {
+			root := strings.SplitN(ref, ".", 2)[0]
+			if root == "builtin" || defined[root] || seen[root] {
 				continue
 			}
-			if kind == "Cluster" {
-				if _, hasTopo := spec["topology"]; hasTopo {
-					if field == "infrastructureRef" || field == "controlPlaneRef" {
-						continue
-					}
+			seen[root] = true
+			hits = append(hits, validation.Hit{Message: fmt.Sprintf("Patch '%s' references undefined variable '%s'", name, root),
+				Suggestion: "Add it to spec.variables or fix the reference"})
+		}
+	}
+	return hits
+}
+
+func ruleVariableSchema(doc map[string]interface{}) []validation.Hit {
+	spec := classSpec(doc)
+	if spec == nil {
+		return nil
+	}
+	var hits []validation.Hit
+	for _, v := range asMaps(spec["variables"]) {
+		name, _ := v["name"].(string)
+		schema, _ := kubectl.GetNested(v, "schema.openAPIV3Schema").(map[string]interface{})
+		switch {
+		case schema == nil:
+			hits = append(hits, validation.Hit{Message: fmt.Sprintf("Variable '%s' has no schema.openAPIV3Schema", name),
+				Suggestion: "Define a schema so Cluster values are validated"})
+		case schema["type"] == nil:
+			hits = append(hits, validation.Hit{Message: fmt.Sprintf("Variable '%s' schema has no type", name),
+				Suggestion: "Set schema.openAPIV3Schema.type"})
+		}
+	}
+	return hits
+}
+
+func ruleDeprecatedPatches(doc map[string]interface{}) []validation.Hit {
+	spec := classSpec(doc)
+	if spec == nil {
+		return nil
+	}
+	var hits []validation.Hit
+	for _, patch := range asMaps(spec["patches"]) {
+		name, _ := patch["name"].(string)
+		_, hasDefs := patch["definitions"]
+		_, hasExternal := patch["external"]
+		if hasDefs && hasExternal {
+			hits = append(hits, validation.Hit{Message: fmt.Sprintf("Patch '%s' sets both definitions and external", name),
+				Suggestion: "Use either inline definitions or an external patch extension"})
+		}
+		seen := map[string]bool{}
+		for _, ref := range patchVariableRefs(patch) {
+			for builtin, info := range deprecatedBuiltins {
+				if (ref == builtin || strings.HasPrefix(ref, builtin+".")) && !seen[builtin] {
+					seen[builtin] = true
+					hits = append(hits, validation.Hit{Message: fmt.Sprintf("Patch '%s' uses deprecated variable '%s' (since %s)", name, builtin, info.since),
+						Suggestion: info.message})
 				}
 			}
-			if _, ok := spec[field]; !ok {
-				issues = append(issues, lintIssue{sevError, "error",
-					fmt.Sprintf("Missing required spec field for %s: %s", kind, field),
-					filePath, startLine, ""})
+		}
+		for _, def := range asMaps(patch["definitions"]) {
+			if mr, ok := kubectl.GetNested(def, "selector.matchResources").(map[string]interface{}); ok && len(mr) == 0 {
+				hits = append(hits, validation.Hit{Message: fmt.Sprintf("Patch '%s' has a definition whose selector matches no resources", name),
+					Suggestion: "Set matchResources.infrastructureCluster, controlPlane or a worker class"})
 			}
 		}
 	}
+	return hits
+}
 
-	// Deprecated fields
-	if depFields, ok := deprecatedFieldsMap[kind]; ok {
-		for fieldPath, info := range depFields {
-			if getNestedValue(doc, fieldPath) != nil {
-				issues = append(issues, lintIssue{sevWarning, "warning",
-					fmt.Sprintf("Deprecated field '%s' (since %s)", fieldPath, info.since),
-					filePath, startLine, info.message})
+// ruleMissingWorkerClass checks Cluster topologies against ClusterClasses
+// found among the linted documents. Clusters whose class is not linted are
+// skipped.
+func ruleMissingWorkerClass(docs []*validation.Document) []validation.SetHit {
+	type classes struct{ md, mp map[string]bool }
+	byName := map[string]classes{}
+	for _, d := range docs {
+		spec := classSpec(d.Obj)
+		if spec == nil {
+			continue
+		}
+		name, _ := kubectl.GetNested(d.Obj, "metadata.name").(string)
+		c := classes{map[string]bool{}, map[string]bool{}}
+		for _, md := range asMaps(kubectl.GetNested(spec, "workers.machineDeployments")) {
+			if n, ok := md["class"].(string); ok {
+				c.md[n] = true
+			}
+		}
+		for _, mp := range asMaps(kubectl.GetNested(spec, "workers.machinePools")) {
+			if n, ok := mp["class"].(string); ok {
+				c.mp[n] = true
 			}
 		}
+		byName[name] = c
 	}
 
-	// Namespace check
-	if metadata != nil {
-		if _, ok := metadata["namespace"]; !ok {
-			issues = append(issues, lintIssue{sevInfo, "info",
-				"No namespace specified - will use default", filePath, startLine, ""})
+	var hits []validation.SetHit
+	for _, d := range docs {
+		if kind, _ := d.Obj["kind"].(string); kind != "Cluster" {
+			continue
+		}
+		className, _ := kubectl.GetNested(d.Obj, "spec.topology.class").(string)
+		c, ok := byName[className]
+		if !ok {
+			continue
+		}
+		check := func(field string, defined map[string]bool) {
+			for _, w := range asMaps(kubectl.GetNested(d.Obj, "spec.topology.workers."+field)) {
+				if n, _ := w["class"].(string); n != "" && !defined[n] {
+					hits = append(hits, validation.SetHit{Doc: d, Hit: validation.Hit{
+						Message:    fmt.Sprintf("Worker class '%s' is not defined in ClusterClass '%s' (%s)", n, className, field),
+						Suggestion: fmt.Sprintf("Add it to spec.workers.%s of the ClusterClass", field)}})
+				}
+			}
 		}
+		check("machineDeployments", c.md)
+		check("machinePools", c.mp)
 	}
+	return hits
+}
 
-	return issues
+// ruleConfig overrides one rule in .capilint.yaml.
+type ruleConfig struct {
+	Enabled  *bool  `yaml:"enabled"`
+	Severity string `yaml:"severity"`
 }
 
-func getNestedValue(data map[string]interface{}, path string) interface{} {
-	parts := strings.Split(path, ".")
-	var current interface{} = data
-	for _, p := range parts {
-		m, ok := current.(map[string]interface{})
-		if !ok {
-			return nil
+// lintConfig is the .capilint.yaml file:
+//
+//	rules:
+//	  CAPI005: {enabled: false}
+//	  CAPI006: {severity: error}
+//	exclude:
+//	  - path: examples/**
+//	    rules: [CAPI006]
+//
+// An exclusion without rules excludes the path from every rule.
+type lintConfig struct {
+	Rules   map[string]ruleConfig `yaml:"rules"`
+	Exclude []struct {
+		Path  string   `yaml:"path"`
+		Rules []string `yaml:"rules"`
+	} `yaml:"exclude"`
+}
+
+func loadConfig(path string) (*lintConfig, error) {
+	cfg := &lintConfig{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	known := map[string]bool{}
+	for _, r := range ruleRegistry {
+		known[r.ID] = true
+	}
+	for id, rc := range cfg.Rules {
+		if !known[id] {
+			return nil, fmt.Errorf("%s: unknown rule %s", path, id)
+		}
+		if _, ok := validation.ParseSeverity(rc.Severity); rc.Severity != "" && !ok {
+			return nil, fmt.Errorf("%s: rule %s: invalid severity %q", path, id, rc.Severity)
 		}
-		current = m[p]
 	}
-	return current
+	return cfg, nil
 }
 
-func lintContent(content, filePath string) lintResult {
-	result := lintResult{File: filePath}
-
-	// Best practice: credential detection
-	lines := strings.Split(content, "\n")
-	for i, line := range lines {
-		for _, pat := range credentialPatterns {
-			if pat.MatchString(line) {
-				result.Issues = append(result.Issues, lintIssue{
-					sevWarning, "warning", "Possible hardcoded credential detected",
-					filePath, i + 1, "",
-				})
+// globMatch matches a slash-separated path against a glob where ** spans
+// directories and * stays within one.
+func globMatch(pattern, path string) bool {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			re.WriteString(".*")
+			i++
+			if i+1 < len(pattern) && pattern[i+1] == '/' {
+				i++
+				re.WriteString("/?")
 			}
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
 		}
 	}
+	re.WriteString("$")
+	matched, _ := regexp.MatchString(re.String(), filepath.ToSlash(filepath.Clean(path)))
+	return matched
+}
 
-	// Parse YAML documents
-	decoder := yaml.NewDecoder(strings.NewReader(content))
-	docIndex := 0
-	for {
-		var doc map[string]interface{}
-		if err := decoder.Decode(&doc); err != nil {
-			if err.Error() != "EOF" {
-				result.Issues = append(result.Issues, lintIssue{
-					sevError, "error", fmt.Sprintf("YAML syntax error: %v", err),
-					filePath, 0, "",
-				})
-			}
-			break
+// active reports whether rule runs for filePath and at which severity.
+func (c *lintConfig) active(r validation.Rule, filePath string) (validation.Severity, bool) {
+	sev := r.Severity
+	if c == nil {
+		return sev, true
+	}
+	if rc, ok := c.Rules[r.ID]; ok {
+		if rc.Enabled != nil && !*rc.Enabled {
+			return sev, false
 		}
-		if doc == nil {
-			docIndex++
+		if s, ok := validation.ParseSeverity(rc.Severity); ok {
+			sev = s
+		}
+	}
+	for _, ex := range c.Exclude {
+		if !globMatch(ex.Path, filePath) {
 			continue
 		}
-		docIndex++
+		if len(ex.Rules) == 0 {
+			return sev, false
+		}
+		for _, id := range ex.Rules {
+			if id == r.ID {
+				return sev, false
+			}
+		}
+	}
+	return sev, true
+}
+
+// withSeverity applies the severity configured for a rule to its issues.
+func withSeverity(issues []validation.Issue, sev validation.Severity) []validation.Issue {
+	for i := range issues {
+		issues[i].Severity = sev
+	}
+	return issues
+}
+
+func lintDocument(doc *validation.Document, cfg *lintConfig) []validation.Issue {
+	var issues []validation.Issue
+	for _, r := range ruleRegistry {
+		if sev, ok := cfg.active(r, doc.File); ok {
+			issues = append(issues, withSeverity(r.Check(doc), sev)...)
+		}
+	}
+	return issues
+}
 
-		issues := lintDocument(doc, filePath, 0)
-		result.Issues = append(result.Issues, issues...)
+// lintSet runs set rules over the documents of all results and appends each
+// violation to the file its document came from.
+func lintSet(results []lintResult, cfg *lintConfig) {
+	var docs []*validation.Document
+	owner := map[string]int{}
+	for ri := range results {
+		owner[results[ri].File] = ri
+		for di := range results[ri].docs {
+			docs = append(docs, &results[ri].docs[di])
+		}
 	}
+	for _, r := range ruleRegistry {
+		for _, issue := range r.CheckSet(docs) {
+			sev, ok := cfg.active(r, issue.File)
+			if !ok {
+				continue
+			}
+			issue.Severity = sev
+			res := &results[owner[issue.File]]
+			res.Issues = append(res.Issues, issue)
+		}
+	}
+}
+
+func lintContent(content, filePath string, cfg *lintConfig) lintResult {
+	result := lintResult{File: filePath}
 
+	lines := strings.Split(content, "\n")
+	for _, r := range ruleRegistry {
+		if sev, ok := cfg.active(r, filePath); ok {
+			result.Issues = append(result.Issues, withSeverity(r.Scan(filePath, lines), sev)...)
+		}
+	}
+
+	result.vars = findVarRefs(content)
+	docs, err := validation.Parse(filePath, substituteVars(content))
+	for i := range docs {
+		result.Issues = append(result.Issues, lintDocument(&docs[i], cfg)...)
+	}
+	result.docs = docs
+	if err != nil {
+		result.Issues = append(result.Issues, validation.Issue{Rule: parseErrorRule, Severity: validation.Error,
+			File: filePath, Message: fmt.Sprintf("YAML syntax error: %v", err)})
+	}
 	return result
 }
 
-func lintFile(filePath string) lintResult {
+func lintFile(filePath string, cfg *lintConfig) lintResult {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return lintResult{
 			File: filePath,
-			Issues: []lintIssue{{sevError, "error", fmt.Sprintf("File error: %v", err), filePath, 0, ""}},
+			Issues: []validation.Issue{{Rule: parseErrorRule, Severity: validation.Error, File: filePath,
+				Message: fmt.Sprintf("File error: %v", err)}},
+		}
+	}
+	return lintContent(string(data), filePath, cfg)
+}
+
+// ignorePatterns holds .capilintignore entries, in file order.
+var ignorePatterns []string
+
+// loadIgnorePatterns reads a gitignore-style file: one glob per line, '#'
+// comments, a trailing '/' for directories only and a leading '!' to
+// re-include a path.
+func loadIgnorePatterns(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
 		}
 	}
-	return lintContent(string(data), filePath)
+	return patterns, nil
+}
+
+// ignored reports whether path matches .capilintignore. Like .gitignore,
+// patterns without a slash match at any depth and the last match wins.
+func ignored(path string, isDir bool) bool {
+	rel := relPath(path)
+	result := false
+	for _, p := range ignorePatterns {
+		negate := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		if strings.HasSuffix(p, "/") {
+			if !isDir {
+				continue
+			}
+			p = strings.TrimSuffix(p, "/")
+		}
+		var match bool
+		if strings.Contains(p, "/") {
+			match = globMatch(strings.TrimPrefix(p, "/"), rel)
+		} else {
+			match = globMatch("**/"+p, rel)
+		}
+		if match {
+			result = !negate
+		}
+	}
+	return result
+}
+
+// dirFiles lists the YAML files in dir, descending into subdirectories when
+// recursive is set. Ignored files and directories are skipped.
+func dirFiles(dir string, recursive bool) []string {
+	var files []string
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir && (!recursive || ignored(path, true)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if validation.IsYAMLFile(path) && !ignored(path, false) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// lintFiles lints files with a pool of workers, keeping results in input
+// order. YAML decoding dominates, so this scales with the number of CPUs.
+func lintFiles(files []string, workers int, lint func(path string) lintResult) []lintResult {
+	results := make([]lintResult, len(files))
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(files); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = lint(files[i])
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
 }
 
 func getAssetsDir() string {
@@ -287,15 +726,9 @@ func getAssetsDir() string {
 	return filepath.Join(filepath.Dir(scriptDir), "assets")
 }
 
-func lintAssets() []lintResult {
-	var results []lintResult
-	assetsDir := getAssetsDir()
-
-	matches, _ := filepath.Glob(filepath.Join(assetsDir, "*.yaml"))
-	for _, f := range matches {
-		results = append(results, lintFile(f))
-	}
-	return results
+func assetFiles() []string {
+	matches, _ := filepath.Glob(filepath.Join(getAssetsDir(), "*.yaml"))
+	return matches
 }
 
 func printResults(results []lintResult, verbose bool) (int, int) {
@@ -304,9 +737,9 @@ func printResults(results []lintResult, verbose bool) (int, int) {
 	for _, r := range results {
 		errors, warnings := 0, 0
 		for _, i := range r.Issues {
-			if i.Sev == sevError {
+			if i.Severity == validation.Error {
 				errors++
-			} else if i.Sev == sevWarning {
+			} else if i.Severity == validation.Warning {
 				warnings++
 			}
 		}
@@ -326,66 +759,274 @@ func printResults(results []lintResult, verbose bool) (int, int) {
 	return totalErrors, totalWarnings
 }
 
+// relPath returns path relative to the working directory when it lies below
+// it, so annotations resolve against the repository checkout.
+func relPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				return filepath.ToSlash(rel)
+			}
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+var sarifLevels = map[validation.Severity]string{validation.Error: "error", validation.Warning: "warning", validation.Info: "note"}
+
+func exportSARIF(results []lintResult) string {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region *struct {
+				StartLine int `json:"startLine"`
+			} `json:"region,omitempty"`
+		} `json:"physicalLocation"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+	type rule struct {
+		ID                   string            `json:"id"`
+		Name                 string            `json:"name"`
+		ShortDescription     message           `json:"shortDescription"`
+		DefaultConfiguration map[string]string `json:"defaultConfiguration"`
+	}
+
+	rules := []rule{{parseErrorRule, "parse-error", message{"Files must be readable, valid YAML"},
+		map[string]string{"level": "error"}}}
+	for _, r := range ruleRegistry {
+		rules = append(rules, rule{r.ID, r.Name, message{r.Description},
+			map[string]string{"level": sarifLevels[r.Severity]}})
+	}
+
+	out := []result{}
+	for _, r := range results {
+		for _, i := range r.Issues {
+			var loc location
+			loc.PhysicalLocation.ArtifactLocation.URI = relPath(i.File)
+			if i.Line > 0 {
+				loc.PhysicalLocation.Region = &struct {
+					StartLine int `json:"startLine"`
+				}{i.Line}
+			}
+			text := i.Text()
+			if i.Suggestion != "" {
+				text += ". " + i.Suggestion
+			}
+			out = append(out, result{i.Rule, sarifLevels[i.Severity], message{text}, []location{loc}})
+		}
+	}
+
+	doc := map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{map[string]interface{}{
+			"tool": map[string]interface{}{"driver": map[string]interface{}{
+				"name":           "lint-cluster-templates",
+				"informationUri": "https://cluster-api.sigs.k8s.io/",
+				"rules":          rules,
+			}},
+			"results": out,
+		}},
+	}
+	data, _ := json.MarshalIndent(doc, "", "  ")
+	return string(data)
+}
+
+// ghEscape escapes a GitHub workflow command value; properties additionally
+// escape ':' and ','.
+func ghEscape(s string, property bool) string {
+	s = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+	if property {
+		s = strings.NewReplacer(":", "%3A", ",", "%2C").Replace(s)
+	}
+	return s
+}
+
+// printGitHub prints issues as workflow command annotations, which GitHub
+// Actions shows inline on pull requests.
+func printGitHub(results []lintResult) {
+	commands := map[validation.Severity]string{validation.Error: "error", validation.Warning: "warning", validation.Info: "notice"}
+	for _, r := range results {
+		for _, i := range r.Issues {
+			props := "file=" + ghEscape(relPath(i.File), true)
+			if i.Line > 0 {
+				props += fmt.Sprintf(",line=%d", i.Line)
+			}
+			props += ",title=" + ghEscape(i.Rule, true)
+			text := i.Text()
+			if i.Suggestion != "" {
+				text += ". " + i.Suggestion
+			}
+			fmt.Printf("::%s %s::%s\n", commands[i.Severity], props, ghEscape(text, false))
+		}
+	}
+}
+
 func main() {
 	dir := flag.String("d", "", "Directory to lint (*.yaml files)")
 	assets := flag.Bool("assets", false, "Lint all asset templates")
 	strict := flag.Bool("strict", false, "Treat warnings as errors")
 	verbose := flag.Bool("v", false, "Show passed files")
-	format := flag.String("format", "text", "Output format: text, json")
+	format := flag.String("format", "text", "Output format: text, json, sarif, github")
+	configPath := flag.String("config", "", "Lint config file (default: .capilint.yaml in the current directory, if present)")
+	listRules := flag.Bool("list-rules", false, "List all rules and exit")
+	recursive := flag.Bool("r", false, "Recurse into directories given as arguments")
+	concurrency := flag.Int("concurrency", runtime.NumCPU(), "Number of files linted in parallel")
+	stdinName := flag.String("stdin-name", "<stdin>", "File name reported for input read from - (stdin)")
+	crdDir := flag.String("crd-dir", "", "Validate documents against CRD schemas vendored in this directory")
+	liveSchema := flag.Bool("live-schema", false, "Validate documents against CRD schemas from the current cluster")
+	varFile := flag.String("var-file", "", "clusterctl variables (YAML KEY: value or KEY=VALUE) to substitute and check against")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [files...] [flags]\n\nLint Cluster API manifests.\n\nFlags:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [files|dirs|-...]\n\nLint Cluster API manifests. Use - to read from stdin.\n\nFlags:\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
+	switch *format {
+	case "text", "json", "sarif", "github":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (want text, json, sarif or github)\n", *format)
+		os.Exit(1)
+	}
+
+	if *listRules {
+		for _, r := range ruleRegistry {
+			fmt.Printf("%s  %-24s %-8s %s\n", r.ID, r.Name, r.Severity, r.Description)
+		}
+		os.Exit(0)
+	}
+
+	var cfg *lintConfig
+	if *configPath == "" {
+		if _, err := os.Stat(".capilint.yaml"); err == nil {
+			*configPath = ".capilint.yaml"
+		}
+	}
+	if *configPath != "" {
+		var err error
+		if cfg, err = loadConfig(*configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if _, err := os.Stat(".capilintignore"); err == nil {
+		var err error
+		if ignorePatterns, err = loadIgnorePatterns(".capilintignore"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *crdDir != "" || *liveSchema {
+		crdSchemas = validation.Schemas{}
+		if *crdDir != "" {
+			if err := crdSchemas.LoadDir(*crdDir); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: loading CRDs: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if *liveSchema {
+			if err := crdSchemas.LoadLive(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: loading CRDs: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	var varLines map[string]int
+	if *varFile != "" {
+		var err error
+		if templateVars, varLines, err = loadVarFile(*varFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	files := flag.Args()
 	if len(files) == 0 && *dir == "" && !*assets {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	var results []lintResult
+	var paths []string
 
 	if *assets {
-		results = append(results, lintAssets()...)
+		paths = append(paths, assetFiles()...)
 	}
 
 	if *dir != "" {
 		if info, err := os.Stat(*dir); err == nil && info.IsDir() {
-			_ = filepath.Walk(*dir, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return nil
-				}
-				if filepath.Ext(path) == ".yaml" {
-					results = append(results, lintFile(path))
-				}
-				return nil
-			})
+			paths = append(paths, dirFiles(*dir, true)...)
 		} else {
 			fmt.Fprintf(os.Stderr, "Directory not found: %s\n", *dir)
 			os.Exit(1)
 		}
 	}
 
+	var stdin string
 	for _, f := range files {
+		if f == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: reading stdin: %v\n", err)
+				os.Exit(1)
+			}
+			stdin = string(data)
+			paths = append(paths, f)
+			continue
+		}
 		if strings.Contains(f, "*") {
 			matches, _ := filepath.Glob(f)
 			for _, m := range matches {
-				results = append(results, lintFile(m))
+				if !ignored(m, false) {
+					paths = append(paths, m)
+				}
 			}
+		} else if info, err := os.Stat(f); err == nil && info.IsDir() {
+			paths = append(paths, dirFiles(f, *recursive)...)
 		} else {
-			results = append(results, lintFile(f))
+			paths = append(paths, f)
 		}
 	}
 
+	results := lintFiles(paths, *concurrency, func(path string) lintResult {
+		if path == "-" {
+			return lintContent(stdin, *stdinName, cfg)
+		}
+		return lintFile(path, cfg)
+	})
+
 	if len(results) == 0 {
 		fmt.Fprintln(os.Stderr, "No files to lint")
 		os.Exit(1)
 	}
+	lintSet(results, cfg)
+	if templateVars != nil {
+		if r := unusedVariables(results, *varFile, varLines, cfg); len(r.Issues) > 0 {
+			results = append(results, r)
+		}
+	}
 
-	if *format == "json" {
+	switch *format {
+	case "sarif":
+		fmt.Println(exportSARIF(results))
+	case "github":
+		printGitHub(results)
+	case "json":
 		type jsonIssue struct {
+			Rule       string `json:"rule,omitempty"`
 			Severity   string `json:"severity"`
 			Message    string `json:"message"`
 			Line       int    `json:"line,omitempty"`
@@ -399,7 +1040,7 @@ func main() {
 		for _, r := range results {
 			jr := jsonResult{File: r.File}
 			for _, i := range r.Issues {
-				jr.Issues = append(jr.Issues, jsonIssue{i.Sev.String(), i.Message, i.Line, i.Suggestion})
+				jr.Issues = append(jr.Issues, jsonIssue{i.Rule, i.Severity.String(), i.Text(), i.Line, i.Suggestion})
 			}
 			if jr.Issues == nil {
 				jr.Issues = []jsonIssue{}
@@ -408,7 +1049,7 @@ func main() {
 		}
 		data, _ := json.MarshalIndent(output, "", "  ")
 		fmt.Println(string(data))
-	} else {
+	default:
 		errors, warnings := printResults(results, *verbose)
 
 		totalFiles := len(results)
@@ -0,0 +1,508 @@
+// mhc-simulate shows MachineHealthCheck coverage and predicts remediations.
+//
+// It lists which machines are covered by which MachineHealthChecks, evaluates
+// each check's node startup timeout and unhealthy conditions against the
+// current machine and node state, and reports machines that are already
+// unhealthy or will be remediated soon, taking maxUnhealthy into account.
+// With --simulate it answers "what would MHC do" if a node condition changed.
+//
+// Usage:
+//
+//	go run ./mhc-simulate [flags] <cluster-name>
+//
+// Examples:
+//
+//	go run ./mhc-simulate -n default my-cluster
+//	go run ./mhc-simulate --simulate Ready=Unknown --for 6m my-cluster
+//	go run ./mhc-simulate --simulate Ready=False --node my-cluster-md-0-abcde my-cluster
+//	go run ./mhc-simulate --format json my-cluster
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const defaultNodeStartupTimeout = 10 * time.Minute
+
+type unhealthyCondition struct {
+	Type    string        `json:"type"`
+	Status  string        `json:"status"`
+	Timeout time.Duration `json:"-"`
+}
+
+type healthCheck struct {
+	Name               string
+	Selector           map[string]interface{}
+	NodeStartupTimeout time.Duration
+	Conditions         []unhealthyCondition
+	MaxUnhealthy       string
+	UnhealthyRange     string
+	External           bool
+}
+
+type nodeCondition struct {
+	Status string
+	Since  time.Time
+}
+
+type verdict struct {
+	Machine   string `json:"machine"`
+	Node      string `json:"node,omitempty"`
+	State     string `json:"state"` // healthy, imminent, unhealthy, unknown
+	Reason    string `json:"reason,omitempty"`
+	Remaining string `json:"remaining,omitempty"`
+}
+
+type checkReport struct {
+	Name          string    `json:"name"`
+	MaxUnhealthy  string    `json:"max_unhealthy,omitempty"`
+	Covered       int       `json:"covered"`
+	Unhealthy     int       `json:"unhealthy"`
+	Blocked       bool      `json:"remediation_blocked"`
+	BlockedReason string    `json:"blocked_reason,omitempty"`
+	External      bool      `json:"external_remediation"`
+	Machines      []verdict `json:"machines"`
+}
+
+type report struct {
+	Cluster    string              `json:"cluster"`
+	Namespace  string              `json:"namespace"`
+	Simulation string              `json:"simulation,omitempty"`
+	NodeState  string              `json:"node_state"`
+	Checks     []checkReport       `json:"checks"`
+	Uncovered  []string            `json:"uncovered_machines"`
+	Overlaps   map[string][]string `json:"overlapping_checks,omitempty"`
+}
+
+func parseDuration(v interface{}) time.Duration {
+	switch val := v.(type) {
+	case string:
+		d, _ := time.ParseDuration(val)
+		return d
+	case float64:
+		return time.Duration(val) * time.Second
+	}
+	return 0
+}
+
+// parseCheck reads both the v1beta1 (spec.unhealthyConditions) and v1beta2
+// (spec.checks.unhealthyNodeConditions) layouts.
+func parseCheck(mhc map[string]interface{}) healthCheck {
+	spec := kubectl.GetMap(mhc, "spec")
+	checks := kubectl.GetMap(spec, "checks")
+	hc := healthCheck{
+		Name:               kubectl.GetString(mhc, "metadata.name"),
+		Selector:           kubectl.GetMap(spec, "selector"),
+		NodeStartupTimeout: defaultNodeStartupTimeout,
+	}
+	if d := parseDuration(spec["nodeStartupTimeout"]); d > 0 {
+		hc.NodeStartupTimeout = d
+	}
+	if d := parseDuration(checks["nodeStartupTimeoutSeconds"]); d > 0 {
+		hc.NodeStartupTimeout = d
+	}
+
+	conds := kubectl.GetSlice(spec, "unhealthyConditions")
+	if len(conds) == 0 {
+		conds = kubectl.GetSlice(checks, "unhealthyNodeConditions")
+	}
+	for _, c := range conds {
+		cm, _ := c.(map[string]interface{})
+		uc := unhealthyCondition{}
+		uc.Type, _ = cm["type"].(string)
+		uc.Status, _ = cm["status"].(string)
+		uc.Timeout = parseDuration(cm["timeout"])
+		if uc.Timeout == 0 {
+			uc.Timeout = parseDuration(cm["timeoutSeconds"])
+		}
+		hc.Conditions = append(hc.Conditions, uc)
+	}
+
+	hc.MaxUnhealthy = fmt.Sprint(spec["maxUnhealthy"])
+	if spec["maxUnhealthy"] == nil {
+		hc.MaxUnhealthy = ""
+	}
+	hc.UnhealthyRange, _ = spec["unhealthyRange"].(string)
+	triggerIf := kubectl.GetMap(kubectl.GetMap(spec, "remediation"), "triggerIf")
+	if v, ok := triggerIf["unhealthyLessThanOrEqualTo"]; ok {
+		hc.MaxUnhealthy = fmt.Sprint(v)
+	}
+	if r, ok := triggerIf["unhealthyInRange"].(string); ok {
+		hc.UnhealthyRange = r
+	}
+	_, hc.External = spec["remediationTemplate"]
+	if len(kubectl.GetMap(kubectl.GetMap(spec, "remediation"), "templateRef")) > 0 {
+		hc.External = true
+	}
+	return hc
+}
+
+// remediationAllowed mirrors the MHC short-circuit: remediation stops when
+// more machines are unhealthy than maxUnhealthy (or outside unhealthyRange).
+func remediationAllowed(hc healthCheck, total, unhealthy int) (bool, string) {
+	if hc.UnhealthyRange != "" {
+		r := strings.Trim(hc.UnhealthyRange, "[]")
+		lo, hi, ok := strings.Cut(r, "-")
+		min, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		max, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if ok && err1 == nil && err2 == nil && (unhealthy < min || unhealthy > max) {
+			return false, fmt.Sprintf("%d unhealthy is outside unhealthyRange %s", unhealthy, hc.UnhealthyRange)
+		}
+		return true, ""
+	}
+	if hc.MaxUnhealthy == "" {
+		return true, ""
+	}
+	limit := 0
+	if strings.HasSuffix(hc.MaxUnhealthy, "%") {
+		pct, _ := strconv.Atoi(strings.TrimSuffix(hc.MaxUnhealthy, "%"))
+		limit = int(math.Floor(float64(total) * float64(pct) / 100))
+	} else {
+		limit, _ = strconv.Atoi(hc.MaxUnhealthy)
+	}
+	if unhealthy > limit {
+		return false, fmt.Sprintf("%d unhealthy exceeds maxUnhealthy %s (%d of %d)", unhealthy, hc.MaxUnhealthy, limit, total)
+	}
+	return true, ""
+}
+
+// loadNodes reads node conditions from the workload cluster. A nil map means
+// the workload cluster could not be reached.
+func loadNodes(cluster, namespace string) (map[string]map[string]nodeCondition, error) {
+	kubeconfig, err := kubectl.WorkloadKubeconfig(cluster, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(kubeconfig)
+
+	ok, out, errMsg := kubectl.Run([]string{"--kubeconfig", kubeconfig, "get", "nodes", "-o", "json"}, 0)
+	if !ok {
+		return nil, fmt.Errorf("list workload nodes: %s", strings.TrimSpace(errMsg))
+	}
+	var list map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		return nil, err
+	}
+	nodes := map[string]map[string]nodeCondition{}
+	for _, item := range kubectl.GetSlice(list, "items") {
+		node, _ := item.(map[string]interface{})
+		conds := map[string]nodeCondition{}
+		for _, c := range kubectl.GetSlice(kubectl.GetMap(node, "status"), "conditions") {
+			cm, _ := c.(map[string]interface{})
+			t, _ := cm["type"].(string)
+			s, _ := cm["status"].(string)
+			ltt, _ := cm["lastTransitionTime"].(string)
+			since, _ := time.Parse(time.RFC3339, ltt)
+			conds[t] = nodeCondition{s, since}
+		}
+		nodes[kubectl.GetString(node, "metadata.name")] = conds
+	}
+	return nodes, nil
+}
+
+type simulation struct {
+	Type     string
+	Status   string
+	Duration time.Duration
+	Node     string
+}
+
+func (s *simulation) appliesTo(node string) bool {
+	return s != nil && (s.Node == "" || s.Node == node)
+}
+
+func machineCondition(m map[string]interface{}, condType string) (string, string) {
+	status := kubectl.GetMap(m, "status")
+	conds := kubectl.GetSlice(status, "conditions")
+	conds = append(conds, kubectl.GetSlice(kubectl.GetMap(status, "v1beta2"), "conditions")...)
+	for _, c := range conds {
+		cm, _ := c.(map[string]interface{})
+		if t, _ := cm["type"].(string); t == condType {
+			s, _ := cm["status"].(string)
+			r, _ := cm["reason"].(string)
+			return s, r
+		}
+	}
+	return "", ""
+}
+
+func evaluate(m map[string]interface{}, hc healthCheck, nodes map[string]map[string]nodeCondition, sim *simulation, now time.Time) verdict {
+	v := verdict{
+		Machine: kubectl.GetString(m, "metadata.name"),
+		Node:    kubectl.GetString(m, "status.nodeRef.name"),
+		State:   "healthy",
+	}
+
+	if s, r := machineCondition(m, "HealthCheckSucceeded"); s == "False" && sim == nil {
+		v.State, v.Reason = "unhealthy", "already marked by MHC: "+r
+		return v
+	}
+	if s, _ := machineCondition(m, "OwnerRemediated"); s == "False" && sim == nil {
+		v.State, v.Reason = "unhealthy", "remediation in progress"
+		return v
+	}
+
+	if v.Node == "" {
+		start, _ := time.Parse(time.RFC3339, kubectl.GetString(m, "metadata.creationTimestamp"))
+		if ltt := infraReadySince(m); !ltt.IsZero() {
+			start = ltt
+		}
+		elapsed := now.Sub(start)
+		if elapsed >= hc.NodeStartupTimeout {
+			v.State, v.Reason = "unhealthy", fmt.Sprintf("no node after nodeStartupTimeout %s", hc.NodeStartupTimeout)
+		} else {
+			v.State, v.Reason = "imminent", "waiting for node to join"
+			v.Remaining = (hc.NodeStartupTimeout - elapsed).Round(time.Second).String()
+		}
+		return v
+	}
+
+	var conds map[string]nodeCondition
+	if nodes != nil {
+		conds = nodes[v.Node]
+		if conds == nil {
+			v.State, v.Reason = "unhealthy", "node not found in workload cluster"
+			return v
+		}
+	} else if !sim.appliesTo(v.Node) {
+		v.State, v.Reason = "unknown", "node state unavailable"
+		return v
+	}
+
+	var soonest time.Duration = -1
+	for _, uc := range hc.Conditions {
+		nc, ok := conds[uc.Type]
+		elapsed := now.Sub(nc.Since)
+		if sim.appliesTo(v.Node) && sim.Type == uc.Type {
+			nc, ok, elapsed = nodeCondition{Status: sim.Status}, true, sim.Duration
+		}
+		if !ok || nc.Status != uc.Status {
+			continue
+		}
+		if elapsed >= uc.Timeout {
+			v.State = "unhealthy"
+			v.Reason = fmt.Sprintf("%s=%s for %s (timeout %s)", uc.Type, uc.Status, elapsed.Round(time.Second), uc.Timeout)
+			return v
+		}
+		if remaining := uc.Timeout - elapsed; soonest < 0 || remaining < soonest {
+			soonest = remaining
+			v.State = "imminent"
+			v.Reason = fmt.Sprintf("%s=%s", uc.Type, uc.Status)
+			v.Remaining = remaining.Round(time.Second).String()
+		}
+	}
+	return v
+}
+
+func infraReadySince(m map[string]interface{}) time.Time {
+	for _, c := range kubectl.GetSlice(kubectl.GetMap(m, "status"), "conditions") {
+		cm, _ := c.(map[string]interface{})
+		if t, _ := cm["type"].(string); t == "InfrastructureReady" {
+			if s, _ := cm["status"].(string); s == "True" {
+				ltt, _ := cm["lastTransitionTime"].(string)
+				ts, _ := time.Parse(time.RFC3339, ltt)
+				return ts
+			}
+		}
+	}
+	return time.Time{}
+}
+
+func analyze(cluster, namespace string, nodes map[string]map[string]nodeCondition, sim *simulation) report {
+	rep := report{Cluster: cluster, Namespace: namespace, Overlaps: map[string][]string{}}
+	now := time.Now()
+
+	mhcs, _ := kubectl.RunJSON("machinehealthchecks.cluster.x-k8s.io", namespace, "", false)
+	machines, _ := kubectl.RunJSON("machines.cluster.x-k8s.io", namespace, "cluster.x-k8s.io/cluster-name="+cluster, false)
+	sort.Slice(machines, func(i, j int) bool {
+		return kubectl.GetString(machines[i], "metadata.name") < kubectl.GetString(machines[j], "metadata.name")
+	})
+
+	coverage := map[string][]string{}
+	for _, mhc := range mhcs {
+		if kubectl.GetString(mhc, "spec.clusterName") != cluster {
+			continue
+		}
+		hc := parseCheck(mhc)
+		cr := checkReport{Name: hc.Name, MaxUnhealthy: hc.MaxUnhealthy, External: hc.External}
+		for _, m := range machines {
+			if !kubectl.MatchesSelector(hc.Selector, kubectl.Labels(m)) {
+				continue
+			}
+			v := evaluate(m, hc, nodes, sim, now)
+			coverage[v.Machine] = append(coverage[v.Machine], hc.Name)
+			cr.Machines = append(cr.Machines, v)
+			if v.State == "unhealthy" {
+				cr.Unhealthy++
+			}
+		}
+		cr.Covered = len(cr.Machines)
+		if ok, why := remediationAllowed(hc, cr.Covered, cr.Unhealthy); !ok {
+			cr.Blocked, cr.BlockedReason = true, why
+		}
+		if cr.Machines == nil {
+			cr.Machines = []verdict{}
+		}
+		rep.Checks = append(rep.Checks, cr)
+	}
+
+	rep.Uncovered = []string{}
+	for _, m := range machines {
+		name := kubectl.GetString(m, "metadata.name")
+		switch len(coverage[name]) {
+		case 0:
+			rep.Uncovered = append(rep.Uncovered, name)
+		case 1:
+		default:
+			rep.Overlaps[name] = coverage[name]
+		}
+	}
+	if rep.Checks == nil {
+		rep.Checks = []checkReport{}
+	}
+	return rep
+}
+
+func printReport(rep report) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("%s\nMACHINEHEALTHCHECK SIMULATION: %s/%s\n%s\n", sep, rep.Namespace, rep.Cluster, sep)
+	if rep.Simulation != "" {
+		fmt.Printf("Simulating: %s\n", rep.Simulation)
+	}
+	fmt.Printf("Node state: %s\n", rep.NodeState)
+
+	if len(rep.Checks) == 0 {
+		fmt.Println("\n❌ No MachineHealthChecks target this cluster")
+	}
+	icons := map[string]string{"healthy": "✅", "imminent": "⏳", "unhealthy": "❌", "unknown": "❓"}
+	for _, c := range rep.Checks {
+		fmt.Printf("\n📋 %s (%d machines", c.Name, c.Covered)
+		if c.MaxUnhealthy != "" {
+			fmt.Printf(", maxUnhealthy %s", c.MaxUnhealthy)
+		}
+		if c.External {
+			fmt.Print(", external remediation")
+		}
+		fmt.Println(")")
+		for _, v := range c.Machines {
+			line := fmt.Sprintf("  %s %-45s %-10s", icons[v.State], v.Machine, v.State)
+			if v.Reason != "" {
+				line += " " + v.Reason
+			}
+			if v.Remaining != "" {
+				line += " — remediation in " + v.Remaining
+			}
+			fmt.Println(line)
+		}
+		switch {
+		case c.Blocked:
+			fmt.Printf("  🛑 Remediation blocked: %s\n", c.BlockedReason)
+		case c.Unhealthy > 0:
+			fmt.Printf("  🔧 MHC would remediate %d machine(s)\n", c.Unhealthy)
+		}
+	}
+
+	if len(rep.Uncovered) > 0 {
+		fmt.Printf("\n⚠️  Machines not covered by any MachineHealthCheck (%d):\n", len(rep.Uncovered))
+		for _, m := range rep.Uncovered {
+			fmt.Printf("  - %s\n", m)
+		}
+	}
+	if len(rep.Overlaps) > 0 {
+		fmt.Println("\n⚠️  Machines covered by multiple MachineHealthChecks:")
+		names := make([]string, 0, len(rep.Overlaps))
+		for m := range rep.Overlaps {
+			names = append(names, m)
+		}
+		sort.Strings(names)
+		for _, m := range names {
+			fmt.Printf("  - %s: %s\n", m, strings.Join(rep.Overlaps[m], ", "))
+		}
+	}
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace of the cluster")
+	simulate := flag.String("simulate", "", "Node condition to simulate, e.g. Ready=Unknown")
+	simFor := flag.Duration("for", 0, "How long the simulated condition has been present (default: longer than any timeout)")
+	node := flag.String("node", "", "Restrict the simulation to this node (default: all nodes)")
+	skipNodes := flag.Bool("skip-nodes", false, "Do not read node state from the workload cluster")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <cluster-name>\n\nShow MachineHealthCheck coverage and predict or simulate remediations.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	cluster := flag.Arg(0)
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	var sim *simulation
+	if *simulate != "" {
+		t, s, ok := strings.Cut(*simulate, "=")
+		if !ok || t == "" || s == "" {
+			fmt.Fprintln(os.Stderr, "Error: --simulate must be <ConditionType>=<Status>")
+			os.Exit(1)
+		}
+		sim = &simulation{Type: t, Status: s, Duration: *simFor, Node: *node}
+		if sim.Duration == 0 {
+			sim.Duration = 24 * time.Hour
+		}
+	}
+
+	nodeState := "skipped"
+	var nodes map[string]map[string]nodeCondition
+	if !*skipNodes {
+		var err error
+		nodes, err = loadNodes(cluster, *namespace)
+		if err != nil {
+			nodeState = "unavailable (" + err.Error() + ")"
+		} else {
+			nodeState = fmt.Sprintf("%d nodes from workload cluster", len(nodes))
+		}
+	}
+
+	rep := analyze(cluster, *namespace, nodes, sim)
+	rep.NodeState = nodeState
+	if sim != nil {
+		rep.Simulation = fmt.Sprintf("%s=%s for %s", sim.Type, sim.Status, sim.Duration)
+		if sim.Node != "" {
+			rep.Simulation += " on node " + sim.Node
+		}
+	}
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(rep, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(rep)
+	}
+}
@@ -9,15 +9,27 @@
 //	go run ./migration-checker -f manifest.yaml
 //	go run ./migration-checker -d ./manifests/ -r
 //	go run ./migration-checker --live -n clusters
+//	go run ./migration-checker --live --format json   # includes per-cluster readiness scores
+//	go run ./migration-checker -d ./manifests/ --rules extra-rules.yaml
+//	go run ./migration-checker -d ./manifests/ --target v1beta1
+//	go run ./migration-checker --src ../provider/...
+//	go run ./migration-checker -d ./manifests/ -r --format sarif -o migration.sarif --fail-on none
 package main
 
 import (
+	_ "embed"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"k8s-cluster-api-tools/internal/kubectl"
 
@@ -30,6 +42,11 @@ type migrationIssue struct {
 	Reason   string `json:"reason"`
 	Action   string `json:"action"`
 	Severity string `json:"severity"`
+	Rule     string `json:"rule,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Cluster  string `json:"cluster,omitempty"`
+	Risk     string `json:"risk,omitempty"`
+	live     bool   // Path names a cluster object rather than a file
 }
 
 func (m migrationIssue) String() string {
@@ -37,160 +54,292 @@ func (m migrationIssue) String() string {
 	if m.Severity == "info" {
 		icon = "ℹ️"
 	}
-	return fmt.Sprintf("%s %s\n   Reason: %s\n   Action: %s", icon, m.Field, m.Reason, m.Action)
-}
-
-type deprecatedField struct {
-	Reason string
-	Action string
-}
-
-var deprecatedFields = map[string]map[string]deprecatedField{
-	"Cluster": {
-		"spec.paused": {
-			Reason: "Replaced by .spec.topology.controlPlane and .spec.topology.workers",
-			Action: "Remove spec.paused and use topology-level pause",
-		},
-	},
-	"Machine": {
-		"status.phase": {
-			Reason: "Phase deprecated in v1beta2; use conditions instead",
-			Action: "Migrate to reading status.conditions for machine state",
-		},
-		"spec.version": {
-			Reason: "Version is now inherited from control plane or topology",
-			Action: "Remove spec.version if using topology-based cluster",
-		},
-	},
-	"MachineDeployment": {
-		"spec.template.spec.version": {
-			Reason: "Version now inherited from topology or control plane",
-			Action: "Remove if using ClusterClass topology",
-		},
-	},
-	"MachineSet": {
-		"spec.template.spec.version": {
-			Reason: "Version now inherited from owning MachineDeployment",
-			Action: "Remove and let MachineDeployment propagate version",
-		},
-	},
-	"KubeadmControlPlane": {
-		"spec.kubeadmConfigSpec.clusterConfiguration.clusterName": {
-			Reason: "Inferred from top level, removed to avoid confusion",
-			Action: "Remove this field",
-		},
-	},
-}
-
-var objectRefFields = []string{
-	"spec.infrastructureRef",
-	"spec.controlPlaneRef",
-	"spec.bootstrap.configRef",
-	"spec.template.spec.infrastructureRef",
-	"spec.template.spec.bootstrap.configRef",
-}
-
-func getNested(data map[string]interface{}, path string) interface{} {
-	keys := strings.Split(path, ".")
-	var current interface{} = data
-	for _, key := range keys {
-		m, ok := current.(map[string]interface{})
-		if !ok {
-			return nil
+	field := m.Field
+	if m.Line > 0 {
+		field = fmt.Sprintf("line %d: %s", m.Line, m.Field)
+	}
+	return fmt.Sprintf("%s %s\n   Reason: %s\n   Action: %s", icon, field, m.Reason, m.Action)
+}
+
+//go:embed rules.yaml
+var embeddedRules []byte
+
+// conversionRule describes one field change between two API versions. See
+// rules.yaml for the meaning of each field.
+type conversionRule struct {
+	ID       string   `yaml:"id"`
+	Kinds    []string `yaml:"kinds"`
+	Scope    string   `yaml:"scope"`
+	Old      string   `yaml:"old"`
+	New      string   `yaml:"new"`
+	Change   string   `yaml:"change"`
+	Severity string   `yaml:"severity"`
+	Reason   string   `yaml:"reason"`
+	Action   string   `yaml:"action"`
+	Risk     string   `yaml:"risk"`
+	Disabled bool     `yaml:"disabled"`
+}
+
+type conversion struct {
+	From  string           `yaml:"from"`
+	To    string           `yaml:"to"`
+	Rules []conversionRule `yaml:"rules"`
+}
+
+type ruleset struct {
+	Scopes      map[string]map[string]string `yaml:"scopes"`
+	Conversions []conversion                 `yaml:"conversions"`
+}
+
+var changeTypes = map[string]bool{"rename": true, "remove": true, "add": true, "duration": true, "mapToList": true}
+
+// loadRuleset parses the embedded rules and merges an override file on top:
+// scopes are merged by name, conversions by from/to and rules by id. A rule
+// with disabled: true drops the embedded rule of the same id.
+func loadRuleset(override string) (*ruleset, error) {
+	rs := &ruleset{}
+	if err := yaml.Unmarshal(embeddedRules, rs); err != nil {
+		return nil, fmt.Errorf("embedded rules: %w", err)
+	}
+	if override != "" {
+		data, err := os.ReadFile(override)
+		if err != nil {
+			return nil, err
+		}
+		var extra ruleset
+		if err := yaml.Unmarshal(data, &extra); err != nil {
+			return nil, fmt.Errorf("%s: %w", override, err)
+		}
+		for name, scope := range extra.Scopes {
+			rs.Scopes[name] = scope
+		}
+		for _, ec := range extra.Conversions {
+			idx := -1
+			for i, c := range rs.Conversions {
+				if c.From == ec.From && c.To == ec.To {
+					idx = i
+				}
+			}
+			if idx < 0 {
+				rs.Conversions = append(rs.Conversions, conversion{From: ec.From, To: ec.To})
+				idx = len(rs.Conversions) - 1
+			}
+			c := &rs.Conversions[idx]
+			for _, r := range ec.Rules {
+				replaced := false
+				for i := range c.Rules {
+					if c.Rules[i].ID == r.ID {
+						c.Rules[i] = r
+						replaced = true
+					}
+				}
+				if !replaced {
+					c.Rules = append(c.Rules, r)
+				}
+			}
+		}
+	}
+	for _, c := range rs.Conversions {
+		for _, r := range c.Rules {
+			if r.Disabled {
+				continue
+			}
+			switch {
+			case r.ID == "":
+				return nil, fmt.Errorf("%s->%s: rule without id", c.From, c.To)
+			case !changeTypes[r.Change]:
+				return nil, fmt.Errorf("rule %s: unknown change %q", r.ID, r.Change)
+			case r.Risk != "" && riskWeights[r.Risk] == 0:
+				return nil, fmt.Errorf("rule %s: unknown risk %q", r.ID, r.Risk)
+			case r.Scope != "" && rs.Scopes[r.Scope] == nil:
+				return nil, fmt.Errorf("rule %s: unknown scope %q", r.ID, r.Scope)
+			case r.Old == "" && r.Change != "add", r.New == "" && (r.Change == "add" || r.Change == "rename" || r.Change == "duration"):
+				return nil, fmt.Errorf("rule %s: missing old or new path for %s", r.ID, r.Change)
+			}
 		}
-		current = m[key]
 	}
-	return current
+	return rs, nil
 }
 
-func checkDeprecatedFields(doc map[string]interface{}, filePath string) []migrationIssue {
-	var issues []migrationIssue
-	kind, _ := doc["kind"].(string)
+// fieldMatch is a concrete field found for a rule path.
+type fieldMatch struct {
+	Path  string
+	Value interface{}
+}
 
-	fields, ok := deprecatedFields[kind]
+// findFields resolves a dot path in which a "[]" suffix walks every item of
+// a list, e.g. spec.workers.machineDeployments[].strategy.
+func findFields(data interface{}, path, prefix string) []fieldMatch {
+	if path == "" {
+		if data == nil {
+			return nil
+		}
+		return []fieldMatch{{prefix, data}}
+	}
+	key, rest, _ := strings.Cut(path, ".")
+	list := strings.HasSuffix(key, "[]")
+	key = strings.TrimSuffix(key, "[]")
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	v, ok := m[key]
 	if !ok {
-		return issues
+		return nil
+	}
+	p := key
+	if prefix != "" {
+		p = prefix + "." + key
+	}
+	if !list {
+		return findFields(v, rest, p)
 	}
+	items, _ := v.([]interface{})
+	var out []fieldMatch
+	for i, item := range items {
+		out = append(out, findFields(item, rest, fmt.Sprintf("%s[%d]", p, i))...)
+	}
+	return out
+}
 
-	for field, info := range fields {
-		if getNested(doc, field) != nil {
-			issues = append(issues, migrationIssue{
-				Path:     filePath,
-				Field:    field,
-				Reason:   info.Reason,
-				Action:   info.Action,
-				Severity: "warning",
-			})
-		}
+// rulePrefixes returns the path prefix for each kind a rule applies to.
+func (rs *ruleset) rulePrefixes(r conversionRule) map[string]string {
+	if r.Scope != "" {
+		return rs.Scopes[r.Scope]
 	}
-	return issues
+	prefixes := map[string]string{}
+	for _, k := range r.Kinds {
+		prefixes[k] = ""
+	}
+	return prefixes
 }
 
-func checkObjectRefs(doc map[string]interface{}, filePath string) []migrationIssue {
-	var issues []migrationIssue
+func joinPath(prefix, path string) string {
+	if prefix == "" {
+		return path
+	}
+	return prefix + "." + path
+}
 
-	for _, refPath := range objectRefFields {
-		ref := getNested(doc, refPath)
-		rm, ok := ref.(map[string]interface{})
-		if !ok {
-			continue
+func hasAlpha(s string) bool {
+	for _, c := range s {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			return true
 		}
-		if _, hasAV := rm["apiVersion"]; hasAV {
-			if _, hasAG := rm["apiGroup"]; !hasAG {
-				issues = append(issues, migrationIssue{
-					Path:     filePath,
-					Field:    refPath + ".apiVersion",
-					Reason:   "v1beta2 uses apiGroup instead of apiVersion in object references",
-					Action:   "Replace apiVersion with apiGroup (e.g., 'infrastructure.cluster.x-k8s.io')",
-					Severity: "info",
-				})
-			}
+	}
+	return false
+}
+
+// describe fills in the reason and action for a rule that does not set them.
+func describe(r conversionRule, from, to string, forward bool) (string, string) {
+	reason, action := r.Reason, r.Action
+	src, dst := r.Old, r.New
+	if !forward {
+		src, dst = r.New, r.Old
+	}
+	var defReason, defAction string
+	switch r.Change {
+	case "rename":
+		defReason = fmt.Sprintf("Field renamed in %s", to)
+		if !forward {
+			defReason = fmt.Sprintf("Field is named %s in %s", dst, from)
 		}
-		if _, hasNS := rm["namespace"]; hasNS {
-			issues = append(issues, migrationIssue{
-				Path:     filePath,
-				Field:    refPath + ".namespace",
-				Reason:   "namespace field removed from object references in v1beta2",
-				Action:   "Remove namespace field from object reference",
-				Severity: "warning",
-			})
+		defAction = fmt.Sprintf("Move %s to %s", src, dst)
+	case "remove":
+		defReason = fmt.Sprintf("Field removed in %s", to)
+		defAction = fmt.Sprintf("Remove %s", src)
+	case "add":
+		defReason = fmt.Sprintf("Field has no %s equivalent and only survives in the conversion annotation", from)
+		defAction = fmt.Sprintf("Remove %s or keep the object at %s", src, to)
+	case "duration":
+		if forward {
+			defReason = "Duration fields changed from string to int32 seconds"
+			defAction = fmt.Sprintf("Convert to integer seconds and rename to %s", dst)
+		} else {
+			defReason = fmt.Sprintf("%s uses duration strings instead of int32 seconds", from)
+			defAction = fmt.Sprintf("Convert to a duration string (e.g. 10m) at %s", dst)
+		}
+	case "mapToList":
+		if forward {
+			defReason = "Extra args changed from a map to a list of {name, value}"
+			defAction = "Convert each key: value entry to - name: key, value: value"
+		} else {
+			defReason = fmt.Sprintf("%s uses a map for extra args", from)
+			defAction = "Convert each - name: key, value: value entry to key: value"
 		}
 	}
-	return issues
+	if !forward || reason == "" {
+		reason = defReason
+	}
+	if !forward || action == "" {
+		action = defAction
+	}
+	return reason, action
 }
 
-func checkDurationFields(doc map[string]interface{}, filePath string) []migrationIssue {
-	var issues []migrationIssue
-
-	type durationPair struct{ old, new string }
-	pairs := []durationPair{
-		{"spec.nodeDeletionTimeout", "spec.deletion.nodeDeletionTimeoutSeconds"},
-		{"spec.nodeDrainTimeout", "spec.deletion.nodeDrainTimeoutSeconds"},
-		{"spec.nodeVolumeDetachTimeout", "spec.deletion.nodeVolumeDetachTimeoutSeconds"},
-		{"spec.template.spec.nodeDeletionTimeout", "spec.template.spec.deletion.nodeDeletionTimeoutSeconds"},
-		{"spec.topology.controlPlane.nodeDeletionTimeout", "spec.topology.controlPlane.deletion.nodeDeletionTimeoutSeconds"},
+// apiVersionOf returns the version part of an apiVersion (group/version).
+func apiVersionOf(doc map[string]interface{}) string {
+	av, _ := doc["apiVersion"].(string)
+	if i := strings.LastIndex(av, "/"); i >= 0 {
+		return av[i+1:]
 	}
+	return av
+}
+
+// checkConversionRules applies every conversion that leads to target.
+// Migrating forward (target == to) checks old fields on objects not yet at
+// target; migrating back (target == from) checks new fields on objects at the
+// newer version.
+func checkConversionRules(rs *ruleset, target string, doc map[string]interface{}, filePath string) []migrationIssue {
+	var issues []migrationIssue
+	kind, _ := doc["kind"].(string)
+	version := apiVersionOf(doc)
 
-	for _, p := range pairs {
-		val := getNested(doc, p.old)
-		if val == nil {
+	for _, c := range rs.Conversions {
+		var forward bool
+		switch {
+		case target == c.To && version != c.To:
+			forward = true
+		case target == c.From && version == c.To:
+			forward = false
+		default:
 			continue
 		}
-		if s, ok := val.(string); ok {
-			hasAlpha := false
-			for _, c := range s {
-				if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
-					hasAlpha = true
-					break
-				}
+		for _, r := range c.Rules {
+			if r.Disabled {
+				continue
+			}
+			prefix, ok := rs.rulePrefixes(r)[kind]
+			if !ok {
+				continue
+			}
+			src, dst := r.Old, r.New
+			if !forward {
+				src, dst = r.New, r.Old
+			}
+			if src == "" || (!forward && r.Change == "remove") || (forward && r.Change == "add") {
+				continue
 			}
-			if hasAlpha {
+			for _, f := range findFields(doc, joinPath(prefix, src), "") {
+				if !conversionNeeded(r.Change, forward, f.Value) {
+					continue
+				}
+				if r.Change == "rename" && dst != "" && len(findFields(doc, joinPath(prefix, dst), "")) > 0 {
+					continue
+				}
+				reason, action := describe(r, c.From, c.To, forward)
+				sev := r.Severity
+				if sev == "" {
+					sev = "warning"
+				}
 				issues = append(issues, migrationIssue{
 					Path:     filePath,
-					Field:    p.old,
-					Reason:   "Duration fields changed from string to int32 seconds",
-					Action:   fmt.Sprintf("Convert to integer seconds and rename to %s", p.new),
-					Severity: "warning",
+					Field:    f.Path,
+					Reason:   reason,
+					Action:   action,
+					Severity: sev,
+					Rule:     r.ID,
+					Risk:     r.Risk,
 				})
 			}
 		}
@@ -198,6 +347,28 @@ func checkDurationFields(doc map[string]interface{}, filePath string) []migratio
 	return issues
 }
 
+// conversionNeeded reports whether a value still has the shape of the source
+// version: duration strings like "10m" going forward, integer seconds going
+// back, and maps or lists of extra args.
+func conversionNeeded(change string, forward bool, v interface{}) bool {
+	switch change {
+	case "duration":
+		s, isString := v.(string)
+		if forward {
+			return isString && hasAlpha(s)
+		}
+		return !isString
+	case "mapToList":
+		if forward {
+			_, ok := v.(map[string]interface{})
+			return ok
+		}
+		_, ok := v.([]interface{})
+		return ok
+	}
+	return true
+}
+
 func checkAPIVersion(doc map[string]interface{}, filePath string) []migrationIssue {
 	var issues []migrationIssue
 	av, _ := doc["apiVersion"].(string)
@@ -209,6 +380,7 @@ func checkAPIVersion(doc map[string]interface{}, filePath string) []migrationIss
 			Reason:   "v1beta1 is deprecated, will be removed in August 2026",
 			Action:   "Migrate to v1beta2 API version",
 			Severity: "warning",
+			Rule:     "api-version",
 		})
 	} else if strings.Contains(av, "v1alpha") {
 		issues = append(issues, migrationIssue{
@@ -217,21 +389,22 @@ func checkAPIVersion(doc map[string]interface{}, filePath string) []migrationIss
 			Reason:   "v1alpha versions are deprecated",
 			Action:   "Migrate to v1beta2 API version",
 			Severity: "warning",
+			Rule:     "api-version",
 		})
 	}
 	return issues
 }
 
-func analyzeDocument(doc map[string]interface{}, filePath string) []migrationIssue {
+func analyzeDocument(rs *ruleset, target string, doc map[string]interface{}, filePath string) []migrationIssue {
 	var issues []migrationIssue
-	issues = append(issues, checkAPIVersion(doc, filePath)...)
-	issues = append(issues, checkDeprecatedFields(doc, filePath)...)
-	issues = append(issues, checkObjectRefs(doc, filePath)...)
-	issues = append(issues, checkDurationFields(doc, filePath)...)
+	if target == "v1beta2" {
+		issues = append(issues, checkAPIVersion(doc, filePath)...)
+	}
+	issues = append(issues, checkConversionRules(rs, target, doc, filePath)...)
 	return issues
 }
 
-func analyzeFile(path string) []migrationIssue {
+func analyzeFile(rs *ruleset, target, path string) []migrationIssue {
 	var allIssues []migrationIssue
 
 	data, err := os.ReadFile(path)
@@ -249,16 +422,20 @@ func analyzeFile(path string) []migrationIssue {
 		if doc == nil {
 			continue
 		}
-		allIssues = append(allIssues, analyzeDocument(doc, path)...)
+		allIssues = append(allIssues, analyzeDocument(rs, target, doc, path)...)
 	}
 	return allIssues
 }
 
-func analyzeLiveResources(namespace string) []migrationIssue {
+// analyzeLiveResources checks CAPI objects in the cluster. It also returns
+// the namespace/name of every Cluster so clean clusters appear in the
+// readiness report.
+func analyzeLiveResources(rs *ruleset, target, namespace string) ([]migrationIssue, []string) {
 	if kubectl.Find() == "" {
 		fmt.Fprintln(os.Stderr, "kubectl not found, skipping live analysis")
-		return nil
+		return nil, nil
 	}
+	var clusters []string
 
 	var allIssues []migrationIssue
 	resourceTypes := []string{
@@ -288,10 +465,460 @@ func analyzeLiveResources(namespace string) []migrationIssue {
 				ns = "default"
 			}
 			path := fmt.Sprintf("%s/%s/%s", rt, ns, name)
-			allIssues = append(allIssues, analyzeDocument(item, path)...)
+			cluster := kubectl.GetString(item, "spec.clusterName")
+			if c := kubectl.Labels(item)["cluster.x-k8s.io/cluster-name"]; c != "" {
+				cluster = c
+			}
+			if kind, _ := item["kind"].(string); kind == "Cluster" {
+				cluster = name
+				clusters = append(clusters, ns+"/"+name)
+			}
+			for _, issue := range analyzeDocument(rs, target, item, path) {
+				issue.live = true
+				if cluster != "" {
+					issue.Cluster = ns + "/" + cluster
+				}
+				allIssues = append(allIssues, issue)
+			}
 		}
 	}
-	return allIssues
+	return allIssues, clusters
+}
+
+// riskWeights orders risk classes and sets how many points one warning of
+// that class costs in the readiness score; info issues cost a fifth.
+var riskWeights = map[string]float64{"manifest": 2, "rollout": 8, "downtime": 20}
+
+var riskOrder = []string{"manifest", "rollout", "downtime"}
+
+var riskTitles = map[string]string{
+	"manifest": "Manifest-only changes (API server converts live objects)",
+	"rollout":  "Changes that roll out Machines",
+	"downtime": "Changes that need a maintenance window",
+}
+
+func issueRisk(i migrationIssue) string {
+	if i.Risk == "" {
+		return "manifest"
+	}
+	return i.Risk
+}
+
+// clusterReadiness summarizes the live issues of one workload cluster.
+type clusterReadiness struct {
+	Cluster  string              `json:"cluster"`
+	Score    int                 `json:"score"`
+	Status   string              `json:"status"`
+	Warnings int                 `json:"warnings"`
+	Info     int                 `json:"info"`
+	Plan     map[string][]string `json:"plan"`
+}
+
+// readinessByCluster scores each cluster from 100 down by the weight of its
+// issues and groups the fixes into a plan ordered by risk. Clusters with the
+// lowest score come first.
+func readinessByCluster(issues []migrationIssue, clusters []string) []clusterReadiness {
+	byCluster := map[string]*clusterReadiness{}
+	var order []string
+	for _, c := range clusters {
+		byCluster[c] = &clusterReadiness{Cluster: c, Plan: map[string][]string{}}
+		order = append(order, c)
+	}
+	penalty := map[string]float64{}
+	seen := map[string]bool{}
+	for _, i := range issues {
+		if i.Cluster == "" {
+			continue
+		}
+		cr, ok := byCluster[i.Cluster]
+		if !ok {
+			cr = &clusterReadiness{Cluster: i.Cluster, Plan: map[string][]string{}}
+			byCluster[i.Cluster] = cr
+			order = append(order, i.Cluster)
+		}
+		risk := issueRisk(i)
+		w := riskWeights[risk]
+		if i.Severity == "warning" {
+			cr.Warnings++
+		} else {
+			cr.Info++
+			w /= 5
+		}
+		penalty[i.Cluster] += w
+		step := fmt.Sprintf("%s %s: %s", i.Path, i.Field, i.Action)
+		if !seen[i.Cluster+step] {
+			seen[i.Cluster+step] = true
+			cr.Plan[risk] = append(cr.Plan[risk], step)
+		}
+	}
+
+	var out []clusterReadiness
+	for _, name := range order {
+		cr := byCluster[name]
+		cr.Score = int(100 - penalty[name] + 0.5)
+		if cr.Score < 0 {
+			cr.Score = 0
+		}
+		switch {
+		case cr.Score >= 90:
+			cr.Status = "ready"
+		case cr.Score >= 60:
+			cr.Status = "needs work"
+		default:
+			cr.Status = "at risk"
+		}
+		out = append(out, *cr)
+	}
+	sort.SliceStable(out, func(a, b int) bool { return out[a].Score < out[b].Score })
+	return out
+}
+
+func printReadiness(w io.Writer, clusters []clusterReadiness) {
+	if len(clusters) == 0 {
+		return
+	}
+	sep := strings.Repeat("=", 60)
+	fmt.Fprintf(w, "\n%s\nPER-CLUSTER READINESS\n%s\n", sep, sep)
+	for _, c := range clusters {
+		fmt.Fprintf(w, "\n%s: %d/100 (%s) - %d warning(s), %d info\n", c.Cluster, c.Score, c.Status, c.Warnings, c.Info)
+		step := 1
+		for _, risk := range riskOrder {
+			if len(c.Plan[risk]) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "  %s:\n", riskTitles[risk])
+			for _, s := range c.Plan[risk] {
+				fmt.Fprintf(w, "    %d. %s\n", step, s)
+				step++
+			}
+		}
+	}
+}
+
+// storageStatus is the stored-version state of one Cluster API CRD.
+type storageStatus struct {
+	CRD            string   `json:"crd"`
+	StorageVersion string   `json:"storageVersion"`
+	StoredVersions []string `json:"storedVersions"`
+	Objects        int      `json:"objects"`
+	// NotRewritten counts objects not written since the CRD was last
+	// updated; they are likely still encoded at an older stored version.
+	NotRewritten int `json:"notRewritten"`
+}
+
+// lastWrite returns the latest managedFields timestamp of an object.
+func lastWrite(obj map[string]interface{}) time.Time {
+	var latest time.Time
+	for _, mf := range kubectl.GetSlice(kubectl.GetMap(obj, "metadata"), "managedFields") {
+		m, _ := mf.(map[string]interface{})
+		ts, _ := m["time"].(string)
+		if t, err := time.Parse(time.RFC3339, ts); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// analyzeStoredVersions reports CAPI CRDs whose status.storedVersions still
+// lists versions other than the current storage version. The API does not
+// expose the encoding of individual objects, so objects last written before
+// the CRD itself changed are counted as likely stored at an old version.
+func analyzeStoredVersions(namespace string) ([]storageStatus, []migrationIssue) {
+	crds, err := kubectl.RunJSON("customresourcedefinitions", "", "", false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Listing CRDs: %v\n", err)
+		return nil, nil
+	}
+
+	var statuses []storageStatus
+	var issues []migrationIssue
+	for _, crd := range crds {
+		if !strings.HasSuffix(kubectl.GetString(crd, "spec.group"), "cluster.x-k8s.io") {
+			continue
+		}
+		st := storageStatus{CRD: kubectl.GetString(crd, "metadata.name")}
+		for _, v := range kubectl.GetSlice(kubectl.GetMap(crd, "spec"), "versions") {
+			vm, _ := v.(map[string]interface{})
+			if storage, _ := vm["storage"].(bool); storage {
+				st.StorageVersion, _ = vm["name"].(string)
+			}
+		}
+		var stale []string
+		for _, v := range kubectl.GetSlice(kubectl.GetMap(crd, "status"), "storedVersions") {
+			if s, ok := v.(string); ok {
+				st.StoredVersions = append(st.StoredVersions, s)
+				if s != st.StorageVersion {
+					stale = append(stale, s)
+				}
+			}
+		}
+		if len(stale) == 0 {
+			continue
+		}
+
+		crdUpdated := lastWrite(crd)
+		items, err := kubectl.RunJSON(st.CRD, namespace, "", namespace == "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Listing %s: %v\n", st.CRD, err)
+		}
+		st.Objects = len(items)
+		for _, item := range items {
+			if lastWrite(item).Before(crdUpdated) {
+				st.NotRewritten++
+			}
+		}
+		statuses = append(statuses, st)
+
+		issues = append(issues, migrationIssue{
+			Path:  "crd/" + st.CRD,
+			Field: "status.storedVersions",
+			Reason: fmt.Sprintf("Stored versions %s include %s; %d of %d objects not rewritten since the CRD changed",
+				strings.Join(st.StoredVersions, ","), strings.Join(stale, ","), st.NotRewritten, st.Objects),
+			Action:   fmt.Sprintf("Rewrite objects at %s and trim storedVersions before %s is removed", st.StorageVersion, strings.Join(stale, ",")),
+			Severity: "warning",
+			Rule:     "stored-versions",
+			live:     true,
+		})
+	}
+	return statuses, issues
+}
+
+// printStorageMigration prints the steps that move stored objects to the
+// current storage version and drop old versions from the CRDs.
+func printStorageMigration(w io.Writer, statuses []storageStatus) {
+	if len(statuses) == 0 {
+		return
+	}
+	sep := strings.Repeat("=", 60)
+	fmt.Fprintf(w, "\n%s\nSTORAGE MIGRATION STEPS\n%s\n", sep, sep)
+	fmt.Fprintln(w, "clusterctl upgrade apply migrates stored versions of provider CRDs automatically.")
+	fmt.Fprintln(w, "To migrate by hand:")
+	fmt.Fprintln(w, "\n1. Rewrite every object so it is stored at the current storage version:")
+	for _, st := range statuses {
+		fmt.Fprintf(w, "   kubectl get %s -A -o json | kubectl replace -f -\n", st.CRD)
+	}
+	fmt.Fprintln(w, "\n2. Drop the old versions from each CRD status:")
+	for _, st := range statuses {
+		fmt.Fprintf(w, "   kubectl patch crd %s --subresource=status --type=merge -p '{\"status\":{\"storedVersions\":[\"%s\"]}}'\n",
+			st.CRD, st.StorageVersion)
+	}
+	fmt.Fprintln(w, "\n3. Update manifests in Git (kubectl-convert only handles built-in types, not CRDs):")
+	fmt.Fprintln(w, "   go run ./migration-checker -d ./manifests/ -r")
+}
+
+// movedPackages maps Cluster API v1beta1 API packages to their v1beta2
+// locations (CAPI v1.11 moved every API group under sigs.k8s.io/cluster-api/api).
+var movedPackages = map[string]string{
+	"sigs.k8s.io/cluster-api/api/v1beta1":                      "sigs.k8s.io/cluster-api/api/core/v1beta2",
+	"sigs.k8s.io/cluster-api/api/core/v1beta1":                 "sigs.k8s.io/cluster-api/api/core/v1beta2",
+	"sigs.k8s.io/cluster-api/exp/api/v1beta1":                  "sigs.k8s.io/cluster-api/api/core/v1beta2",
+	"sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1beta1":    "sigs.k8s.io/cluster-api/api/bootstrap/kubeadm/v1beta2",
+	"sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1": "sigs.k8s.io/cluster-api/api/controlplane/kubeadm/v1beta2",
+	"sigs.k8s.io/cluster-api/exp/addons/api/v1beta1":           "sigs.k8s.io/cluster-api/api/addons/v1beta2",
+	"sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1":             "sigs.k8s.io/cluster-api/api/ipam/v1beta2",
+	"sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1":   "sigs.k8s.io/cluster-api/api/runtime/hooks/v1alpha1",
+	"sigs.k8s.io/cluster-api/util/conditions/v1beta2":          "sigs.k8s.io/cluster-api/util/conditions",
+}
+
+const conditionsPkg = "sigs.k8s.io/cluster-api/util/conditions"
+
+// v1beta1ConditionHelpers are util/conditions functions that only exist for
+// v1beta1 clusterv1.Conditions; v1beta2 code uses metav1.Condition helpers.
+var v1beta1ConditionHelpers = map[string]bool{
+	"MarkTrue": true, "MarkFalse": true, "MarkUnknown": true, "SetSummary": true,
+	"SetMirror": true, "SetAggregate": true, "WithStepCounter": true, "WithStepCounterIf": true,
+	"WithConditions": true, "WithStepCounterIfOnly": true, "TrueCondition": true,
+	"FalseCondition": true, "UnknownCondition": true, "IsFalse": true, "GetReason": true,
+	"GetSeverity": true,
+}
+
+// goFieldName converts a JSON field name to its Go struct field name.
+func goFieldName(s string) string {
+	if strings.HasPrefix(s, "api") {
+		return "API" + s[3:]
+	}
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// sourceFieldRule is a removed or renamed field as a Go selector chain.
+type sourceFieldRule struct {
+	Chain []string
+	Rule  conversionRule
+}
+
+// sourceFieldRules turns forward rules into Go selector chains, e.g.
+// status.phase becomes Status.Phase; scoped rules get one chain per kind
+// prefix. Paths through lists keep only the part after the last [] because
+// list items are usually ranged over in code.
+func sourceFieldRules(rs *ruleset, target string) []sourceFieldRule {
+	var out []sourceFieldRule
+	seen := map[string]bool{}
+	for _, c := range rs.Conversions {
+		if c.To != target {
+			continue
+		}
+		for _, r := range c.Rules {
+			if r.Disabled || r.Old == "" || r.Change == "mapToList" {
+				continue
+			}
+			for _, prefix := range rs.rulePrefixes(r) {
+				path := joinPath(prefix, r.Old)
+				if i := strings.LastIndex(path, "[]."); i >= 0 {
+					path = path[i+3:]
+				}
+				var chain []string
+				for _, p := range strings.Split(path, ".") {
+					chain = append(chain, goFieldName(p))
+				}
+				key := strings.Join(chain, ".")
+				if len(chain) < 2 || seen[key] {
+					continue
+				}
+				seen[key] = true
+				out = append(out, sourceFieldRule{chain, r})
+			}
+		}
+	}
+	return out
+}
+
+// selectorChain flattens a.B.C into [a B C].
+func selectorChain(e ast.Expr) []string {
+	switch x := e.(type) {
+	case *ast.Ident:
+		return []string{x.Name}
+	case *ast.SelectorExpr:
+		return append(selectorChain(x.X), x.Sel.Name)
+	case *ast.CallExpr:
+		return selectorChain(x.Fun)
+	case *ast.IndexExpr:
+		return selectorChain(x.X)
+	case *ast.ParenExpr:
+		return selectorChain(x.X)
+	case *ast.StarExpr:
+		return selectorChain(x.X)
+	}
+	return nil
+}
+
+func hasSuffixChain(chain, suffix []string) bool {
+	if len(chain) < len(suffix) {
+		return false
+	}
+	for i := range suffix {
+		if chain[len(chain)-len(suffix)+i] != suffix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// findGoFiles lists .go files below pattern. A trailing /... walks
+// subdirectories, skipping vendor, testdata and hidden directories.
+func findGoFiles(pattern string) []string {
+	root, recursive := pattern, false
+	if strings.HasSuffix(pattern, "...") {
+		root = strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+		recursive = true
+		if root == "" {
+			root = "."
+		}
+	}
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		return []string{root}
+	}
+	var files []string
+	_ = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (!recursive || name == "vendor" || name == "testdata" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".go") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// analyzeSource scans Go code for what the v1beta2 migration changes beyond
+// manifests: moved API packages, v1beta1 condition helpers and fields the
+// conversion rules remove or rename. Field matches are by name only, since
+// the scan does not type-check, so they are reported as info.
+func analyzeSource(rs *ruleset, target, pattern string) []migrationIssue {
+	var issues []migrationIssue
+	fieldRules := sourceFieldRules(rs, target)
+	fset := token.NewFileSet()
+
+	for _, path := range findGoFiles(pattern) {
+		f, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Parse error %s: %v\n", path, err)
+			continue
+		}
+		add := func(pos token.Pos, field, reason, action, sev, rule string) {
+			issues = append(issues, migrationIssue{
+				Path: path, Line: fset.Position(pos).Line, Field: field,
+				Reason: reason, Action: action, Severity: sev, Rule: rule,
+			})
+		}
+
+		conditionsAliases := map[string]bool{}
+		for _, imp := range f.Imports {
+			ipath := strings.Trim(imp.Path.Value, `"`)
+			if target == "v1beta2" {
+				if dst, ok := movedPackages[ipath]; ok {
+					add(imp.Pos(), ipath, "Package moved or replaced in the v1beta2 API layout",
+						fmt.Sprintf("Import %s instead", dst), "warning", "src-import")
+				}
+			}
+			if ipath == conditionsPkg {
+				alias := "conditions"
+				if imp.Name != nil {
+					alias = imp.Name.Name
+				}
+				conditionsAliases[alias] = true
+			}
+		}
+
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.CallExpr:
+				sel, ok := x.Fun.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				if pkg, ok := sel.X.(*ast.Ident); ok && conditionsAliases[pkg.Name] && v1beta1ConditionHelpers[sel.Sel.Name] {
+					add(x.Pos(), pkg.Name+"."+sel.Sel.Name, "v1beta1 condition helper; v1beta2 objects use metav1.Condition",
+						"Use conditions.Set/IsTrue with metav1.Condition or import sigs.k8s.io/cluster-api/util/deprecated/v1beta1/conditions",
+						"warning", "src-conditions")
+				}
+			case *ast.SelectorExpr:
+				chain := selectorChain(x)
+				for _, fr := range fieldRules {
+					if !hasSuffixChain(chain, fr.Chain) || len(chain) == len(fr.Chain) {
+						continue
+					}
+					reason, action := describe(fr.Rule, "v1beta1", target, true)
+					add(x.Pos(), strings.Join(chain, "."), reason, action, "info", fr.Rule.ID)
+					// Report the longest chain once, not each prefix.
+					return false
+				}
+			}
+			return true
+		})
+	}
+	return issues
 }
 
 func findYAMLFiles(root string, recursive bool) []string {
@@ -330,7 +957,7 @@ func findYAMLFiles(root string, recursive bool) []string {
 	return files
 }
 
-func printMigrationSummary(issues []migrationIssue) {
+func printMigrationSummary(w io.Writer, issues []migrationIssue) {
 	warnings := 0
 	info := 0
 	for _, i := range issues {
@@ -342,26 +969,162 @@ func printMigrationSummary(issues []migrationIssue) {
 	}
 
 	sep := strings.Repeat("=", 60)
-	fmt.Printf("\n%s\nMIGRATION READINESS SUMMARY\n%s\n", sep, sep)
-	fmt.Printf("Total issues: %d\n", len(issues))
-	fmt.Printf("  Warnings: %d\n", warnings)
-	fmt.Printf("  Info: %d\n", info)
+	fmt.Fprintf(w, "\n%s\nMIGRATION READINESS SUMMARY\n%s\n", sep, sep)
+	fmt.Fprintf(w, "Total issues: %d\n", len(issues))
+	fmt.Fprintf(w, "  Warnings: %d\n", warnings)
+	fmt.Fprintf(w, "  Info: %d\n", info)
 
 	if warnings > 0 {
-		fmt.Println("\nRequired changes before v1beta2 migration:")
+		fmt.Fprintln(w, "\nRequired changes before v1beta2 migration:")
 		seen := map[string]bool{}
 		for _, i := range issues {
 			if i.Severity == "warning" && !seen[i.Field] {
-				fmt.Printf("  - %s\n", i.Field)
+				fmt.Fprintf(w, "  - %s\n", i.Field)
 				seen[i.Field] = true
 			}
 		}
 	}
 
-	fmt.Println("\nDeadlines:")
-	fmt.Println("  - v1beta1 deprecated: NOW")
-	fmt.Println("  - v1beta1 removal: August 2026")
-	fmt.Println("  - Contract compatibility removal: August 2026")
+	fmt.Fprintln(w, "\nDeadlines:")
+	fmt.Fprintln(w, "  - v1beta1 deprecated: NOW")
+	fmt.Fprintln(w, "  - v1beta1 removal: August 2026")
+	fmt.Fprintln(w, "  - Contract compatibility removal: August 2026")
+}
+
+var sarifLevels = map[string]string{"warning": "warning", "info": "note"}
+
+func exportSARIF(issues []migrationIssue) string {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type location struct {
+		PhysicalLocation *struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region *struct {
+				StartLine int `json:"startLine"`
+			} `json:"region,omitempty"`
+		} `json:"physicalLocation,omitempty"`
+		LogicalLocations []map[string]string `json:"logicalLocations,omitempty"`
+	}
+	type result struct {
+		RuleID     string            `json:"ruleId"`
+		Level      string            `json:"level"`
+		Message    message           `json:"message"`
+		Locations  []location        `json:"locations"`
+		Properties map[string]string `json:"properties"`
+	}
+	type rule struct {
+		ID               string  `json:"id"`
+		ShortDescription message `json:"shortDescription"`
+	}
+
+	var rules []rule
+	seen := map[string]bool{}
+	results := []result{}
+	for _, i := range issues {
+		if !seen[i.Rule] {
+			seen[i.Rule] = true
+			rules = append(rules, rule{i.Rule, message{i.Reason}})
+		}
+		var loc location
+		if i.live {
+			loc.LogicalLocations = []map[string]string{{"fullyQualifiedName": i.Path + "#" + i.Field, "kind": "resource"}}
+		} else {
+			loc.PhysicalLocation = &struct {
+				ArtifactLocation struct {
+					URI string `json:"uri"`
+				} `json:"artifactLocation"`
+				Region *struct {
+					StartLine int `json:"startLine"`
+				} `json:"region,omitempty"`
+			}{}
+			loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(i.Path)
+			if i.Line > 0 {
+				loc.PhysicalLocation.Region = &struct {
+					StartLine int `json:"startLine"`
+				}{i.Line}
+			}
+			loc.LogicalLocations = []map[string]string{{"fullyQualifiedName": i.Field, "kind": "member"}}
+		}
+		results = append(results, result{
+			RuleID:     i.Rule,
+			Level:      sarifLevels[i.Severity],
+			Message:    message{fmt.Sprintf("%s: %s. %s", i.Field, i.Reason, i.Action)},
+			Locations:  []location{loc},
+			Properties: map[string]string{"field": i.Field, "severity": i.Severity},
+		})
+	}
+
+	doc := map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{map[string]interface{}{
+			"tool": map[string]interface{}{"driver": map[string]interface{}{
+				"name":           "migration-checker",
+				"informationUri": "https://cluster-api.sigs.k8s.io/",
+				"rules":          rules,
+			}},
+			"results": results,
+		}},
+	}
+	data, _ := json.MarshalIndent(doc, "", "  ")
+	return string(data)
+}
+
+func exportJSON(target string, issues []migrationIssue, clusters []clusterReadiness, storage []storageStatus) string {
+	warnings, info := 0, 0
+	for _, i := range issues {
+		if i.Severity == "warning" {
+			warnings++
+		} else {
+			info++
+		}
+	}
+	if issues == nil {
+		issues = []migrationIssue{}
+	}
+	out := struct {
+		Target         string             `json:"target"`
+		Warnings       int                `json:"warnings"`
+		Info           int                `json:"info"`
+		Issues         []migrationIssue   `json:"issues"`
+		Clusters       []clusterReadiness `json:"clusters,omitempty"`
+		StoredVersions []storageStatus    `json:"storedVersions,omitempty"`
+	}{target, warnings, info, issues, clusters, storage}
+	data, _ := json.MarshalIndent(out, "", "  ")
+	return string(data)
+}
+
+func printText(w io.Writer, issues []migrationIssue, clusters []clusterReadiness, storage []storageStatus) {
+	// Group by path
+	byPath := map[string][]migrationIssue{}
+	var paths []string
+	for _, issue := range issues {
+		if _, ok := byPath[issue.Path]; !ok {
+			paths = append(paths, issue.Path)
+		}
+		byPath[issue.Path] = append(byPath[issue.Path], issue)
+	}
+
+	for _, path := range paths {
+		fmt.Fprintf(w, "\n%s:\n", path)
+		for _, issue := range byPath[path] {
+			fmt.Fprintf(w, "  %s\n", issue.String())
+		}
+	}
+
+	printMigrationSummary(w, issues)
+	printReadiness(w, clusters)
+	printStorageMigration(w, storage)
+}
+
+// failThresholds maps --fail-on to the severities that fail the run.
+var failThresholds = map[string][]string{
+	"warning": {"warning"},
+	"info":    {"warning", "info"},
+	"none":    nil,
 }
 
 func main() {
@@ -370,6 +1133,12 @@ func main() {
 	recursive := flag.Bool("r", false, "Search directories recursively")
 	live := flag.Bool("live", false, "Analyze live cluster resources")
 	namespace := flag.String("n", "", "Namespace for live analysis (default: all)")
+	rulesFile := flag.String("rules", "", "YAML file of conversion rules merged over the embedded ones (same format as rules.yaml)")
+	src := flag.String("src", "", "Scan Go source for v1beta2 code changes (a directory or ./... pattern)")
+	format := flag.String("format", "text", "Output format: text, json, sarif")
+	output := flag.String("o", "", "Write the report to a file instead of stdout")
+	failOn := flag.String("fail-on", "warning", "Exit 1 when issues at or above this severity are found: warning, info, none")
+	target := flag.String("target", "v1beta2", "API version to migrate to (v1beta1 checks a rollback from v1beta2)")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nCheck v1beta1 to v1beta2 migration readiness.\n\nFlags:\n", os.Args[0])
@@ -377,54 +1146,99 @@ func main() {
 	}
 	flag.Parse()
 
+	if *format != "text" && *format != "json" && *format != "sarif" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (want text, json or sarif)\n", *format)
+		os.Exit(1)
+	}
+	if _, ok := failThresholds[*failOn]; !ok {
+		fmt.Fprintf(os.Stderr, "Error: invalid --fail-on %q (want warning, info or none)\n", *failOn)
+		os.Exit(1)
+	}
+
+	rs, err := loadRuleset(*rulesFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	knownTarget := false
+	for _, c := range rs.Conversions {
+		if c.From == *target || c.To == *target {
+			knownTarget = true
+		}
+	}
+	if !knownTarget {
+		fmt.Fprintf(os.Stderr, "Error: no conversion rules for target %s\n", *target)
+		os.Exit(1)
+	}
+
 	var allIssues []migrationIssue
+	var storage []storageStatus
+	var readiness []clusterReadiness
 
 	if *file != "" {
-		allIssues = append(allIssues, analyzeFile(*file)...)
+		allIssues = append(allIssues, analyzeFile(rs, *target, *file)...)
 	} else if *dir != "" {
 		files := findYAMLFiles(*dir, *recursive)
 		for _, f := range files {
-			allIssues = append(allIssues, analyzeFile(f)...)
+			allIssues = append(allIssues, analyzeFile(rs, *target, f)...)
 		}
 	}
 
 	if *live {
-		fmt.Println("Analyzing live cluster resources...")
-		allIssues = append(allIssues, analyzeLiveResources(*namespace)...)
+		fmt.Fprintln(os.Stderr, "Analyzing live cluster resources...")
+		issues, clusters := analyzeLiveResources(rs, *target, *namespace)
+		allIssues = append(allIssues, issues...)
+		readiness = readinessByCluster(issues, clusters)
+		if kubectl.Find() != "" {
+			var crdIssues []migrationIssue
+			storage, crdIssues = analyzeStoredVersions(*namespace)
+			allIssues = append(allIssues, crdIssues...)
+		}
+	}
+
+	if *src != "" {
+		allIssues = append(allIssues, analyzeSource(rs, *target, *src)...)
 	}
 
-	if len(allIssues) == 0 && !*live && *file == "" && *dir == "" {
+	if len(allIssues) == 0 && !*live && *file == "" && *dir == "" && *src == "" {
 		flag.Usage()
 		os.Exit(0)
 	}
 
-	// Group by path
-	byPath := map[string][]migrationIssue{}
-	var paths []string
-	for _, issue := range allIssues {
-		if _, ok := byPath[issue.Path]; !ok {
-			paths = append(paths, issue.Path)
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
-		byPath[issue.Path] = append(byPath[issue.Path], issue)
+		defer f.Close()
+		w = f
 	}
-
-	for _, path := range paths {
-		fmt.Printf("\n%s:\n", path)
-		for _, issue := range byPath[path] {
-			fmt.Printf("  %s\n", issue.String())
-		}
+	switch *format {
+	case "json":
+		fmt.Fprintln(w, exportJSON(*target, allIssues, readiness, storage))
+	case "sarif":
+		fmt.Fprintln(w, exportSARIF(allIssues))
+	default:
+		printText(w, allIssues, readiness, storage)
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Report written to %s\n", *output)
 	}
 
-	printMigrationSummary(allIssues)
-
-	warnings := 0
+	failing := 0
 	for _, i := range allIssues {
-		if i.Severity == "warning" {
-			warnings++
+		for _, sev := range failThresholds[*failOn] {
+			if i.Severity == sev {
+				failing++
+			}
 		}
 	}
-	if warnings > 0 {
+	if failing > 0 {
+		if f, ok := w.(*os.File); ok && f != os.Stdout {
+			f.Close()
+		}
 		os.Exit(1)
 	}
-	_ = json.Marshal // keep import for potential future use
 }
@@ -0,0 +1,506 @@
+// move-preflight checks whether a cluster is safe to pivot with clusterctl move.
+//
+// It walks the same object graph clusterctl move discovers (CRDs labelled
+// clusterctl.cluster.x-k8s.io plus Secrets and ConfigMaps) and detects the
+// usual causes of failed moves: dangling owner references, referenced
+// Secrets that would be left behind, objects still provisioning or being
+// deleted, rollouts in progress, missing kubeconfig/CA secrets and providers
+// that are missing or older on the target management cluster.
+//
+// Usage:
+//
+//	go run ./move-preflight [flags] <cluster-name>
+//
+// Examples:
+//
+//	go run ./move-preflight -n default my-cluster
+//	go run ./move-preflight -n default --to-kubeconfig ./target.kubeconfig my-cluster
+//	go run ./move-preflight --format json -o preflight.json my-cluster
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const (
+	clusterctlLabel     = "clusterctl.cluster.x-k8s.io"
+	moveLabel           = "clusterctl.cluster.x-k8s.io/move"
+	moveHierarchyLabel  = "clusterctl.cluster.x-k8s.io/move-hierarchy"
+	clusterNameLabel    = "cluster.x-k8s.io/cluster-name"
+	providerResource    = "providers.clusterctl.cluster.x-k8s.io"
+	clusterResourceName = "clusters.cluster.x-k8s.io"
+)
+
+type check struct {
+	Name    string   `json:"name"`
+	Status  string   `json:"status"` // pass, warn, fail
+	Details []string `json:"details,omitempty"`
+}
+
+func (c *check) fail(format string, args ...interface{}) {
+	c.Status = "fail"
+	c.Details = append(c.Details, fmt.Sprintf(format, args...))
+}
+
+func (c *check) warn(format string, args ...interface{}) {
+	if c.Status != "fail" {
+		c.Status = "warn"
+	}
+	c.Details = append(c.Details, fmt.Sprintf(format, args...))
+}
+
+type object struct {
+	Kind string
+	Name string
+	UID  string
+	Item map[string]interface{}
+}
+
+func (o object) String() string { return o.Kind + "/" + o.Name }
+
+type graph struct {
+	objects []object
+	byUID   map[string]object
+	// moved holds the UIDs clusterctl move would carry along with the cluster.
+	moved map[string]bool
+	crds  []string
+}
+
+type preflight struct {
+	cluster      string
+	namespace    string
+	toKubeconfig string
+	checks       []*check
+}
+
+func (p *preflight) newCheck(name string) *check {
+	c := &check{Name: name, Status: "pass"}
+	p.checks = append(p.checks, c)
+	return c
+}
+
+func ownerRefs(item map[string]interface{}) []map[string]interface{} {
+	var refs []map[string]interface{}
+	for _, r := range kubectl.GetSlice(kubectl.GetMap(item, "metadata"), "ownerReferences") {
+		if m, ok := r.(map[string]interface{}); ok {
+			refs = append(refs, m)
+		}
+	}
+	return refs
+}
+
+// discover lists every object of the move-discoverable CRDs in the namespace
+// and computes which of them belong to the cluster's move graph.
+func (p *preflight) discover(crdCheck *check) graph {
+	g := graph{byUID: map[string]object{}, moved: map[string]bool{}}
+
+	crds, _ := kubectl.RunJSON("customresourcedefinitions", "", "", false)
+	for _, crd := range crds {
+		group := kubectl.GetString(crd, "spec.group")
+		if !strings.HasSuffix(group, "cluster.x-k8s.io") || kubectl.GetString(crd, "spec.scope") != "Namespaced" {
+			continue
+		}
+		name := kubectl.GetString(crd, "metadata.name")
+		if _, ok := kubectl.Labels(crd)[clusterctlLabel]; !ok {
+			crdCheck.warn("CRD %s lacks the %s label; clusterctl move will not discover its objects", name, clusterctlLabel)
+			continue
+		}
+		g.crds = append(g.crds, name)
+	}
+	sort.Strings(g.crds)
+
+	for _, res := range append(g.crds, "secrets", "configmaps") {
+		items, _ := kubectl.RunJSON(res, p.namespace, "", false)
+		for _, item := range items {
+			o := object{
+				Kind: kubectl.GetString(item, "kind"),
+				Name: kubectl.GetString(item, "metadata.name"),
+				UID:  kubectl.GetString(item, "metadata.uid"),
+				Item: item,
+			}
+			g.objects = append(g.objects, o)
+			g.byUID[o.UID] = o
+		}
+	}
+
+	// Seed with objects directly tied to the cluster, then follow owner
+	// references until the set stops growing.
+	for _, o := range g.objects {
+		labels := kubectl.Labels(o.Item)
+		switch {
+		case o.Kind == "Cluster" && o.Name == p.cluster,
+			labels[clusterNameLabel] == p.cluster,
+			kubectl.GetString(o.Item, "spec.clusterName") == p.cluster,
+			(o.Kind == "Secret" || o.Kind == "ConfigMap") && strings.HasPrefix(o.Name, p.cluster+"-"):
+			g.moved[o.UID] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, o := range g.objects {
+			if g.moved[o.UID] {
+				continue
+			}
+			for _, ref := range ownerRefs(o.Item) {
+				if uid, _ := ref["uid"].(string); g.moved[uid] {
+					g.moved[o.UID] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return g
+}
+
+func (p *preflight) checkCluster() map[string]interface{} {
+	c := p.newCheck("Cluster state")
+	items, err := kubectl.RunJSON(clusterResourceName+"/"+p.cluster, p.namespace, "", false)
+	if err != nil || len(items) == 0 {
+		c.fail("cluster %s/%s not found", p.namespace, p.cluster)
+		return nil
+	}
+	cluster := items[0]
+	if phase := kubectl.GetString(cluster, "status.phase"); phase != "Provisioned" {
+		c.fail("cluster phase is %q; move requires a fully provisioned cluster", phase)
+	}
+	if kubectl.GetString(cluster, "metadata.deletionTimestamp") != "" {
+		c.fail("cluster is being deleted")
+	}
+	if paused, _ := kubectl.GetNested(cluster, "spec.paused").(bool); paused {
+		c.warn("cluster is already paused; clusterctl move will unpause it on the target")
+	}
+	if kubectl.GetNested(cluster, "status.controlPlaneReady") == false {
+		c.fail("control plane is not ready")
+	}
+	if kubectl.GetNested(cluster, "status.infrastructureReady") == false {
+		c.fail("infrastructure is not ready")
+	}
+	return cluster
+}
+
+func (p *preflight) checkOwnership(g graph) {
+	c := p.newCheck("Owner references")
+	for _, o := range g.objects {
+		if !g.moved[o.UID] {
+			continue
+		}
+		for _, ref := range ownerRefs(o.Item) {
+			uid, _ := ref["uid"].(string)
+			kind, _ := ref["kind"].(string)
+			name, _ := ref["name"].(string)
+			owner, ok := g.byUID[uid]
+			switch {
+			case !ok:
+				c.fail("%s references missing owner %s/%s (uid %s)", o, kind, name, uid)
+			case owner.Name != name || owner.Kind != kind:
+				c.fail("%s owner reference %s/%s has stale uid pointing to %s", o, kind, name, owner)
+			}
+		}
+	}
+
+	// A move label on an object outside the cluster's graph is harmless, but
+	// labelled hierarchies are worth listing so the operator knows they move.
+	for _, o := range g.objects {
+		labels := kubectl.Labels(o.Item)
+		_, move := labels[moveLabel]
+		_, hierarchy := labels[moveHierarchyLabel]
+		if (move || hierarchy) && !g.moved[o.UID] {
+			c.Details = append(c.Details, fmt.Sprintf("%s is not owned by the cluster but will be moved via its move label", o))
+		}
+	}
+}
+
+// referencedSecrets finds Secret names referenced anywhere in an object:
+// {kind: Secret, name: x} refs and *SecretName / secretName fields.
+func referencedSecrets(v interface{}, out map[string]bool) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if kind, _ := val["kind"].(string); kind == "Secret" {
+			if name, _ := val["name"].(string); name != "" {
+				out[name] = true
+			}
+		}
+		for k, child := range val {
+			if s, ok := child.(string); ok && s != "" && (k == "secretName" || strings.HasSuffix(k, "SecretName")) {
+				out[s] = true
+				continue
+			}
+			referencedSecrets(child, out)
+		}
+	case []interface{}:
+		for _, child := range val {
+			referencedSecrets(child, out)
+		}
+	}
+}
+
+func (p *preflight) checkSecrets(g graph, cluster map[string]interface{}) {
+	c := p.newCheck("Secrets")
+
+	secrets := map[string]object{}
+	for _, o := range g.objects {
+		if o.Kind == "Secret" {
+			secrets[o.Name] = o
+		}
+	}
+
+	if _, ok := secrets[p.cluster+"-kubeconfig"]; !ok {
+		c.fail("kubeconfig secret %s-kubeconfig is missing", p.cluster)
+	}
+	cpRef := kubectl.GetMap(kubectl.GetMap(cluster, "spec"), "controlPlaneRef")
+	if kind, _ := cpRef["kind"].(string); kind == "KubeadmControlPlane" {
+		for _, suffix := range []string{"ca", "etcd", "sa", "proxy"} {
+			if _, ok := secrets[p.cluster+"-"+suffix]; !ok {
+				c.fail("certificate secret %s-%s is missing; KCP would regenerate it on the target and break the cluster", p.cluster, suffix)
+			}
+		}
+	}
+
+	refs := map[string]bool{}
+	for _, o := range g.objects {
+		if g.moved[o.UID] && o.Kind != "Secret" && o.Kind != "ConfigMap" {
+			referencedSecrets(kubectl.GetMap(o.Item, "spec"), refs)
+		}
+	}
+	names := make([]string, 0, len(refs))
+	for n := range refs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		s, ok := secrets[n]
+		if !ok {
+			c.warn("referenced Secret %s does not exist in namespace %s (may be cluster-scoped or in another namespace)", n, p.namespace)
+			continue
+		}
+		labels := kubectl.Labels(s.Item)
+		_, move := labels[moveLabel]
+		if !g.moved[s.UID] && !move {
+			c.fail("Secret %s is referenced by the cluster but has no owner reference or %s label; it will be left behind", n, moveLabel)
+		}
+	}
+}
+
+func (p *preflight) checkProvisioning(g graph) {
+	c := p.newCheck("Provisioning and deletion")
+	for _, o := range g.objects {
+		if !g.moved[o.UID] {
+			continue
+		}
+		if kubectl.GetString(o.Item, "metadata.deletionTimestamp") != "" {
+			c.fail("%s is being deleted", o)
+			continue
+		}
+		switch o.Kind {
+		case "Machine":
+			if phase := kubectl.GetString(o.Item, "status.phase"); phase != "Running" {
+				c.fail("Machine %s is in phase %q", o.Name, phase)
+			}
+		case "MachineDeployment", "KubeadmControlPlane", "MachineSet":
+			desired := kubectl.GetNested(o.Item, "spec.replicas")
+			for _, field := range []string{"replicas", "updatedReplicas", "readyReplicas"} {
+				if v := kubectl.GetNested(o.Item, "status."+field); v != nil && desired != nil && v != desired {
+					if o.Kind == "MachineSet" && field == "updatedReplicas" {
+						continue
+					}
+					c.fail("%s is not settled: status.%s=%v, spec.replicas=%v", o, field, v, desired)
+					break
+				}
+			}
+		case "MachinePool":
+			if phase := kubectl.GetString(o.Item, "status.phase"); phase != "" && phase != "Running" {
+				c.fail("MachinePool %s is in phase %q", o.Name, phase)
+			}
+		}
+	}
+}
+
+type providerInfo struct {
+	Key     string
+	Version string
+}
+
+func providerList(items []map[string]interface{}) map[string]providerInfo {
+	out := map[string]providerInfo{}
+	for _, item := range items {
+		name := kubectl.GetString(item, "providerName")
+		typ := kubectl.GetString(item, "type")
+		key := strings.TrimSuffix(typ, "Provider") + "/" + name
+		out[key] = providerInfo{key, kubectl.GetString(item, "version")}
+	}
+	return out
+}
+
+func parseMinor(v string) (int, int) {
+	parts := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	if len(parts) < 2 {
+		return 0, 0
+	}
+	major, _ := strconv.Atoi(parts[0])
+	minor, _ := strconv.Atoi(parts[1])
+	return major, minor
+}
+
+func (p *preflight) checkProviders() {
+	c := p.newCheck("Target providers")
+	sourceItems, err := kubectl.RunJSON(providerResource, "", "", true)
+	if err != nil || len(sourceItems) == 0 {
+		c.warn("no clusterctl provider inventory found on the source management cluster")
+		return
+	}
+	source := providerList(sourceItems)
+
+	if p.toKubeconfig == "" {
+		c.warn("target not checked; pass --to-kubeconfig to compare provider versions")
+		return
+	}
+	ok, out, errMsg := kubectl.Run([]string{"--kubeconfig", p.toKubeconfig, "get", providerResource, "--all-namespaces", "-o", "json"}, 0)
+	if !ok {
+		c.fail("cannot read providers from target: %s", strings.TrimSpace(errMsg))
+		return
+	}
+	targetItems, err := kubectl.ParseItems(out)
+	if err != nil {
+		c.fail("cannot parse target providers: %v", err)
+		return
+	}
+	target := providerList(targetItems)
+
+	keys := make([]string, 0, len(source))
+	for k := range source {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := source[k]
+		t, ok := target[k]
+		if !ok {
+			c.fail("provider %s %s is not installed on the target", k, s.Version)
+			continue
+		}
+		sMaj, sMin := parseMinor(s.Version)
+		tMaj, tMin := parseMinor(t.Version)
+		switch {
+		case tMaj != sMaj || tMin < sMin:
+			c.fail("provider %s is %s on the target but %s on the source; the target must not be older", k, t.Version, s.Version)
+		case t.Version != s.Version:
+			c.warn("provider %s version differs: source %s, target %s", k, s.Version, t.Version)
+		}
+	}
+}
+
+func (p *preflight) checkClusterClass(cluster map[string]interface{}, g graph) {
+	class := kubectl.GetString(cluster, "spec.topology.class")
+	if class == "" {
+		return
+	}
+	c := p.newCheck("ClusterClass")
+	for _, o := range g.objects {
+		if o.Kind == "ClusterClass" && o.Name == class {
+			return
+		}
+	}
+	c.fail("ClusterClass %s is not in namespace %s; it must be moved (or already exist) on the target", class, p.namespace)
+}
+
+func (p *preflight) run() {
+	crdCheck := p.newCheck("Move discovery")
+	cluster := p.checkCluster()
+	if cluster == nil {
+		return
+	}
+	g := p.discover(crdCheck)
+	crdCheck.Details = append(crdCheck.Details, fmt.Sprintf("%d object(s) across %d CRD types would move with the cluster", len(g.moved), len(g.crds)))
+
+	p.checkOwnership(g)
+	p.checkProvisioning(g)
+	p.checkSecrets(g, cluster)
+	p.checkClusterClass(cluster, g)
+	p.checkProviders()
+}
+
+func printReport(p *preflight) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("%s\nMOVE PREFLIGHT: %s/%s\n%s\n", sep, p.namespace, p.cluster, sep)
+	icons := map[string]string{"pass": "✅", "warn": "⚠️", "fail": "❌"}
+	for _, c := range p.checks {
+		fmt.Printf("\n%s %s\n", icons[c.Status], c.Name)
+		for _, d := range c.Details {
+			fmt.Printf("   - %s\n", d)
+		}
+	}
+	fmt.Println()
+	if p.failed() {
+		fmt.Println("❌ Cluster is NOT safe to move")
+	} else {
+		fmt.Println("✅ Cluster is ready for clusterctl move")
+	}
+}
+
+func (p *preflight) failed() bool {
+	for _, c := range p.checks {
+		if c.Status == "fail" {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace of the cluster")
+	toKubeconfig := flag.String("to-kubeconfig", "", "Kubeconfig of the target management cluster")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <cluster-name>\n\nCheck that a cluster is safe to pivot with clusterctl move.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	p := &preflight{cluster: flag.Arg(0), namespace: *namespace, toKubeconfig: *toKubeconfig}
+	p.run()
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(map[string]interface{}{
+			"cluster":   p.cluster,
+			"namespace": p.namespace,
+			"safe":      !p.failed(),
+			"checks":    p.checks,
+		}, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(p)
+	}
+
+	if p.failed() {
+		os.Exit(1)
+	}
+}
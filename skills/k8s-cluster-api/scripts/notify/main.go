@@ -0,0 +1,505 @@
+// notify watches CAPI resources and sends alerts when they become unhealthy.
+//
+// It polls conditions (using the same collection as analyze-conditions),
+// failed Machines, control plane certificate expiry and Warning events on
+// CAPI objects, and sends an alert when something starts firing, re-sends it
+// every --repeat while it keeps firing or as soon as its severity changes, and
+// sends a resolved notice when it clears. Alerts are routed per severity
+// (critical, warning, info) to Slack, a generic JSON webhook and/or email.
+//
+// Email uses SMTP; credentials are read from SMTP_USERNAME and SMTP_PASSWORD.
+//
+// Usage:
+//
+//	go run ./notify [flags]
+//
+// Examples:
+//
+//	go run ./notify -A --slack-webhook https://hooks.slack.com/services/XXX
+//	go run ./notify -n prod --webhook https://alerts.example.com/capi --route-warning webhook
+//	go run ./notify -A --smtp smtp.example.com:587 --email-from capi@example.com --email-to oncall@example.com --route-critical email,slack --slack-webhook https://hooks.slack.com/services/XXX
+//	go run ./notify -c my-cluster --once --dry-run
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"k8s-cluster-api-tools/internal/conditions"
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+type alert struct {
+	Key      string    `json:"key"`
+	Severity string    `json:"severity"` // critical, warning, info
+	Source   string    `json:"source"`   // condition, machine, certificate, event
+	Resource string    `json:"resource"`
+	Summary  string    `json:"summary"`
+	Detail   string    `json:"detail,omitempty"`
+	Resolved bool      `json:"resolved"`
+	Time     time.Time `json:"time"`
+}
+
+func (a alert) text() string {
+	icon := map[string]string{"critical": "🔴", "warning": "⚠️", "info": "ℹ️"}[a.Severity]
+	if a.Resolved {
+		icon = "✅"
+	}
+	s := fmt.Sprintf("%s [%s] %s: %s", icon, strings.ToUpper(a.Severity), a.Resource, a.Summary)
+	if a.Resolved {
+		s = fmt.Sprintf("%s [RESOLVED] %s: %s", icon, a.Resource, a.Summary)
+	}
+	if a.Detail != "" && !a.Resolved {
+		s += "\n" + a.Detail
+	}
+	return s
+}
+
+type config struct {
+	namespace    string
+	cluster      string
+	allNS        bool
+	certWarn     int
+	certCritical int
+	slack        string
+	webhook      string
+	smtpAddr     string
+	emailFrom    string
+	emailTo      []string
+	routes       map[string][]string
+	dryRun       bool
+}
+
+// tracked remembers when an alert was first seen and last sent.
+type tracked struct {
+	alert
+	lastSent time.Time
+}
+
+type notifier struct {
+	cfg       config
+	repeat    time.Duration
+	active    map[string]*tracked
+	lastEvent time.Time
+}
+
+var criticalKinds = map[string]bool{"Cluster": true, "KubeadmControlPlane": true}
+
+func resourceName(kind, ns, name string) string {
+	return fmt.Sprintf("%s %s/%s", kind, ns, name)
+}
+
+func (n *notifier) conditionAlerts() []alert {
+	var out []alert
+	for _, c := range conditions.Collect(n.cfg.namespace, n.cfg.cluster, n.cfg.allNS, "") {
+		if c.IsHealthy() {
+			continue
+		}
+		sev := "warning"
+		if criticalKinds[c.ResourceKind] && c.ConditionType == "Ready" {
+			sev = "critical"
+		}
+		res := resourceName(c.ResourceKind, c.ResourceNamespace, c.ResourceName)
+		summary := fmt.Sprintf("%s=%s", c.ConditionType, c.Status)
+		if c.Reason != "" {
+			summary += " (" + c.Reason + ")"
+		}
+		out = append(out, alert{
+			Key:      "condition/" + res + "/" + c.ConditionType,
+			Severity: sev,
+			Source:   "condition",
+			Resource: res,
+			Summary:  summary,
+			Detail:   c.Message,
+		})
+	}
+	return out
+}
+
+func (n *notifier) listMachines() []map[string]interface{} {
+	sel := ""
+	if n.cfg.cluster != "" {
+		sel = "cluster.x-k8s.io/cluster-name=" + n.cfg.cluster
+	}
+	items, _ := kubectl.RunJSON("machines.cluster.x-k8s.io", n.cfg.namespace, sel, n.cfg.allNS && n.cfg.namespace == "")
+	return items
+}
+
+func (n *notifier) machineAlerts(machines []map[string]interface{}) []alert {
+	var out []alert
+	for _, m := range machines {
+		phase := kubectl.GetString(m, "status.phase")
+		reason := kubectl.GetString(m, "status.failureReason")
+		if phase != "Failed" && reason == "" {
+			continue
+		}
+		res := resourceName("Machine", kubectl.GetString(m, "metadata.namespace"), kubectl.GetString(m, "metadata.name"))
+		summary := "machine failed"
+		if reason != "" {
+			summary += " (" + reason + ")"
+		}
+		out = append(out, alert{
+			Key:      "machine/" + res,
+			Severity: "critical",
+			Source:   "machine",
+			Resource: res,
+			Summary:  summary,
+			Detail:   kubectl.GetString(m, "status.failureMessage"),
+		})
+	}
+	return out
+}
+
+// certAlerts uses the certificate expiry KubeadmControlPlane records on
+// control plane Machines.
+func (n *notifier) certAlerts(machines []map[string]interface{}) []alert {
+	var out []alert
+	for _, m := range machines {
+		expiry := kubectl.GetString(m, "status.certificatesExpiryDate")
+		if expiry == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, expiry)
+		if err != nil {
+			continue
+		}
+		days := int(time.Until(t).Hours() / 24)
+		sev := ""
+		switch {
+		case days <= n.cfg.certCritical:
+			sev = "critical"
+		case days <= n.cfg.certWarn:
+			sev = "warning"
+		default:
+			continue
+		}
+		res := resourceName("Machine", kubectl.GetString(m, "metadata.namespace"), kubectl.GetString(m, "metadata.name"))
+		out = append(out, alert{
+			Key:      "certificate/" + res,
+			Severity: sev,
+			Source:   "certificate",
+			Resource: res,
+			Summary:  fmt.Sprintf("control plane certificates expire in %d days (%s)", days, t.Format("2006-01-02")),
+			Detail:   "Rotate with: kubectl patch kcp <name> --type merge -p '{\"spec\":{\"rolloutAfter\":\"" + time.Now().UTC().Format(time.RFC3339) + "\"}}'",
+		})
+	}
+	return out
+}
+
+// eventAlerts returns Warning events on CAPI objects newer than the previous
+// poll. Events are one-shot: they never resolve. Failure events are warnings,
+// everything else is info.
+func (n *notifier) eventAlerts() []alert {
+	events, _ := kubectl.RunJSON("events", n.cfg.namespace, "", n.cfg.allNS && n.cfg.namespace == "")
+	since := n.lastEvent
+	owners := map[string]string{}
+	var out []alert
+	for _, e := range events {
+		if kubectl.GetString(e, "type") != "Warning" {
+			continue
+		}
+		if !strings.Contains(kubectl.GetString(e, "involvedObject.apiVersion"), "cluster.x-k8s.io") {
+			continue
+		}
+		ts := kubectl.GetString(e, "lastTimestamp")
+		if ts == "" {
+			ts = kubectl.GetString(e, "eventTime")
+		}
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil || !t.After(since) {
+			continue
+		}
+		if t.After(n.lastEvent) {
+			n.lastEvent = t
+		}
+		kind := kubectl.GetString(e, "involvedObject.kind")
+		name := kubectl.GetString(e, "involvedObject.name")
+		if n.cfg.cluster != "" && !n.inCluster(e, owners) {
+			continue
+		}
+		res := resourceName(kind, kubectl.GetString(e, "involvedObject.namespace"), name)
+		sev := "info"
+		if strings.Contains(kubectl.GetString(e, "reason"), "Fail") {
+			sev = "warning"
+		}
+		out = append(out, alert{
+			Key:      "event/" + res + "/" + kubectl.GetString(e, "reason") + "/" + ts,
+			Severity: sev,
+			Source:   "event",
+			Resource: res,
+			Summary:  kubectl.GetString(e, "reason"),
+			Detail:   kubectl.GetString(e, "message"),
+		})
+	}
+	return out
+}
+
+// inCluster reports whether the object an event is about belongs to the
+// --cluster cluster: the Cluster itself, or an object whose
+// cluster.x-k8s.io/cluster-name label names it. Labels are looked up once per
+// object and poll in owners.
+func (n *notifier) inCluster(e map[string]interface{}, owners map[string]string) bool {
+	kind := kubectl.GetString(e, "involvedObject.kind")
+	name := kubectl.GetString(e, "involvedObject.name")
+	if kind == "Cluster" {
+		return name == n.cfg.cluster
+	}
+	resource := strings.ToLower(kind)
+	if av := kubectl.GetString(e, "involvedObject.apiVersion"); strings.Contains(av, "/") {
+		resource += "." + av[:strings.Index(av, "/")]
+	}
+	key := resource + "/" + name
+	ns := kubectl.GetString(e, "involvedObject.namespace")
+	owner, ok := owners[ns+"/"+key]
+	if !ok {
+		if items, _ := kubectl.RunJSON(key, ns, "", false); len(items) > 0 {
+			owner = kubectl.Labels(items[0])["cluster.x-k8s.io/cluster-name"]
+		}
+		owners[ns+"/"+key] = owner
+	}
+	return owner == n.cfg.cluster
+}
+
+// evaluate collects the currently firing alerts and returns the
+// notifications to send after deduplication.
+func (n *notifier) evaluate() []alert {
+	machines := n.listMachines()
+	var firing []alert
+	firing = append(firing, n.conditionAlerts()...)
+	firing = append(firing, n.machineAlerts(machines)...)
+	firing = append(firing, n.certAlerts(machines)...)
+	events := n.eventAlerts()
+
+	now := time.Now()
+	var send []alert
+	seen := map[string]bool{}
+	for _, a := range firing {
+		a.Time = now
+		seen[a.Key] = true
+		t, ok := n.active[a.Key]
+		if !ok {
+			n.active[a.Key] = &tracked{alert: a, lastSent: now}
+			send = append(send, a)
+			continue
+		}
+		changed := t.alert.Severity != a.Severity
+		t.alert.Severity, t.alert.Summary, t.alert.Detail = a.Severity, a.Summary, a.Detail
+		if changed || (n.repeat > 0 && now.Sub(t.lastSent) >= n.repeat) {
+			t.lastSent = now
+			send = append(send, a)
+		}
+	}
+	for key, t := range n.active {
+		if seen[key] {
+			continue
+		}
+		resolved := t.alert
+		resolved.Resolved = true
+		resolved.Time = now
+		send = append(send, resolved)
+		delete(n.active, key)
+	}
+	for _, e := range events {
+		e.Time = now
+		send = append(send, e)
+	}
+	sort.SliceStable(send, func(i, j int) bool { return rank(send[i]) < rank(send[j]) })
+	return send
+}
+
+func rank(a alert) int {
+	if a.Resolved {
+		return 3
+	}
+	return map[string]int{"critical": 0, "warning": 1, "info": 2}[a.Severity]
+}
+
+func postJSON(url string, payload interface{}) error {
+	body, _ := json.Marshal(payload)
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+func (n *notifier) sendEmail(a alert) error {
+	host := n.cfg.smtpAddr
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	subject := fmt.Sprintf("[CAPI %s] %s: %s", strings.ToUpper(a.Severity), a.Resource, a.Summary)
+	if a.Resolved {
+		subject = fmt.Sprintf("[CAPI RESOLVED] %s: %s", a.Resource, a.Summary)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n",
+		n.cfg.emailFrom, strings.Join(n.cfg.emailTo, ", "), subject, a.text())
+	return smtp.SendMail(n.cfg.smtpAddr, auth, n.cfg.emailFrom, n.cfg.emailTo, []byte(msg))
+}
+
+func (n *notifier) dispatch(a alert) {
+	fmt.Printf("%s %s\n", a.Time.Format("15:04:05"), strings.ReplaceAll(a.text(), "\n", "\n           "))
+	if n.cfg.dryRun {
+		return
+	}
+	// resolved notices keep their severity, so they follow the original route
+	for _, sink := range n.cfg.routes[a.Severity] {
+		var err error
+		switch sink {
+		case "slack":
+			err = postJSON(n.cfg.slack, map[string]string{"text": a.text()})
+		case "webhook":
+			err = postJSON(n.cfg.webhook, a)
+		case "email":
+			err = n.sendEmail(a)
+		}
+		if err != nil {
+			kubectl.Errorf("Error: %s notification failed: %v", sink, err)
+		}
+	}
+}
+
+func parseRoute(value string, configured map[string]bool) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var sinks []string
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "none" {
+			return nil, nil
+		}
+		if !configured[s] {
+			return nil, fmt.Errorf("sink %q is not configured (use slack, webhook, email with their flags)", s)
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+func main() {
+	namespace := flag.String("n", "", "Namespace to watch")
+	cluster := flag.String("c", "", "Only watch this cluster")
+	allNS := flag.Bool("A", false, "Watch all namespaces")
+	interval := flag.Duration("interval", time.Minute, "Polling interval")
+	repeat := flag.Duration("repeat", 4*time.Hour, "Re-send firing alerts after this long (0 to disable)")
+	certWarn := flag.Int("cert-warn-days", 30, "Warn when control plane certificates expire within N days")
+	certCritical := flag.Int("cert-critical-days", 7, "Critical when control plane certificates expire within N days")
+	slack := flag.String("slack-webhook", "", "Slack incoming webhook URL")
+	webhook := flag.String("webhook", "", "Generic webhook URL (receives alert JSON)")
+	smtpAddr := flag.String("smtp", "", "SMTP server host:port for email alerts")
+	emailFrom := flag.String("email-from", "", "Email sender address")
+	emailTo := flag.String("email-to", "", "Comma-separated email recipients")
+	routeCritical := flag.String("route-critical", "", "Sinks for critical alerts (default: all configured)")
+	routeWarning := flag.String("route-warning", "", "Sinks for warning alerts (default: all configured)")
+	routeInfo := flag.String("route-info", "none", "Sinks for info alerts")
+	once := flag.Bool("once", false, "Evaluate once and exit (for cron)")
+	dryRun := flag.Bool("dry-run", false, "Print alerts without sending them")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nWatch CAPI conditions, machines, certificates and events and send alerts.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg := config{
+		namespace: *namespace, cluster: *cluster, allNS: *allNS,
+		certWarn: *certWarn, certCritical: *certCritical,
+		slack: *slack, webhook: *webhook, smtpAddr: *smtpAddr, emailFrom: *emailFrom,
+		dryRun: *dryRun, routes: map[string][]string{},
+	}
+	for _, to := range strings.Split(*emailTo, ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			cfg.emailTo = append(cfg.emailTo, to)
+		}
+	}
+
+	configured := map[string]bool{}
+	var all []string
+	if cfg.slack != "" {
+		configured["slack"] = true
+		all = append(all, "slack")
+	}
+	if cfg.webhook != "" {
+		configured["webhook"] = true
+		all = append(all, "webhook")
+	}
+	if cfg.smtpAddr != "" {
+		if cfg.emailFrom == "" || len(cfg.emailTo) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: --smtp requires --email-from and --email-to")
+			os.Exit(1)
+		}
+		configured["email"] = true
+		all = append(all, "email")
+	}
+	if len(all) == 0 && !cfg.dryRun {
+		fmt.Fprintln(os.Stderr, "Error: configure at least one sink (--slack-webhook, --webhook, --smtp) or use --dry-run")
+		os.Exit(1)
+	}
+	for sev, value := range map[string]string{"critical": *routeCritical, "warning": *routeWarning, "info": *routeInfo} {
+		if value == "" {
+			cfg.routes[sev] = all
+			continue
+		}
+		sinks, err := parseRoute(value, configured)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --route-%s: %v\n", sev, err)
+			os.Exit(1)
+		}
+		cfg.routes[sev] = sinks
+	}
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	n := &notifier{cfg: cfg, repeat: *repeat, active: map[string]*tracked{}, lastEvent: time.Now().Add(-*interval)}
+
+	scope := "namespace " + cfg.namespace
+	switch {
+	case cfg.cluster != "":
+		scope = "cluster " + cfg.cluster
+	case cfg.allNS:
+		scope = "all namespaces"
+	case cfg.namespace == "":
+		scope = "current namespace"
+	}
+	fmt.Printf("Watching %s every %s (sinks: %s)\n", scope, *interval, strings.Join(all, ", "))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	for {
+		for _, a := range n.evaluate() {
+			n.dispatch(a)
+		}
+		if *once {
+			return
+		}
+		select {
+		case <-stop:
+			fmt.Println("Stopping")
+			return
+		case <-time.After(*interval):
+		}
+	}
+}
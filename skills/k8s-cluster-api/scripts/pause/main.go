@@ -0,0 +1,425 @@
+// pause lists paused CAPI resources and bulk pauses or unpauses clusters.
+//
+// The list action finds Clusters with spec.paused=true and every CAPI object
+// carrying the cluster.x-k8s.io/paused annotation, and reports how long each
+// has been paused and by whom (from pause.capi-tools/* annotations written by
+// this tool, falling back to the managedFields entry that set the field).
+//
+// The pause and unpause actions act on a cluster's whole object graph: the
+// Cluster's spec.paused plus the paused annotation on every CAPI object that
+// belongs to the cluster (by cluster-name label, spec.clusterName or owner
+// references). Clusters can be named or selected with -l.
+//
+// Usage:
+//
+//	go run ./pause [flags] [list]
+//	go run ./pause [flags] pause|unpause [cluster-name]
+//
+// Examples:
+//
+//	go run ./pause -A
+//	go run ./pause -n default --dry-run pause my-cluster
+//	go run ./pause -n default --reason "etcd maintenance" --yes pause my-cluster
+//	go run ./pause -A -l env=staging --yes unpause
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const (
+	pausedAnnotation = "cluster.x-k8s.io/paused"
+	byAnnotation     = "pause.capi-tools/by"
+	atAnnotation     = "pause.capi-tools/at"
+	reasonAnnotation = "pause.capi-tools/reason"
+)
+
+type pausedObject struct {
+	Kind      string `json:"kind"`
+	Resource  string `json:"-"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster,omitempty"`
+	Via       string `json:"via"` // spec.paused, annotation
+	Since     string `json:"since,omitempty"`
+	Duration  string `json:"paused_for,omitempty"`
+	By        string `json:"by,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+var titles = map[string]string{"pause": "Pause", "unpause": "Unpause"}
+
+type object struct {
+	resource string
+	item     map[string]interface{}
+}
+
+func (o object) name() string { return kubectl.GetString(o.item, "metadata.name") }
+func (o object) kind() string { return kubectl.GetString(o.item, "kind") }
+
+func annotations(item map[string]interface{}) map[string]string {
+	result := map[string]string{}
+	m, _ := kubectl.GetNested(item, "metadata.annotations").(map[string]interface{})
+	for k, v := range m {
+		result[k], _ = v.(string)
+	}
+	return result
+}
+
+func capiResources() []string {
+	var res []string
+	crds, _ := kubectl.RunJSON("customresourcedefinitions", "", "", false)
+	for _, crd := range crds {
+		if strings.HasSuffix(kubectl.GetString(crd, "spec.group"), "cluster.x-k8s.io") &&
+			kubectl.GetString(crd, "spec.scope") == "Namespaced" {
+			res = append(res, kubectl.GetString(crd, "metadata.name"))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func loadObjects(namespace string, allNS bool) []object {
+	var objects []object
+	for _, res := range capiResources() {
+		items, _ := kubectl.RunJSON(res, namespace, "", allNS)
+		for _, item := range items {
+			objects = append(objects, object{res, item})
+		}
+	}
+	return objects
+}
+
+// managedBy finds the manager and time of the managedFields entry that owns
+// the given field path (e.g. f:spec, f:paused).
+func managedBy(item map[string]interface{}, path ...string) (string, string) {
+	for _, e := range kubectl.GetSlice(kubectl.GetMap(item, "metadata"), "managedFields") {
+		em, _ := e.(map[string]interface{})
+		var cur interface{} = kubectl.GetMap(em, "fieldsV1")
+		for _, p := range path {
+			m, _ := cur.(map[string]interface{})
+			cur = m[p]
+		}
+		if cur != nil {
+			manager, _ := em["manager"].(string)
+			at, _ := em["time"].(string)
+			return manager, at
+		}
+	}
+	return "", ""
+}
+
+func describe(o object, via string) pausedObject {
+	ann := annotations(o.item)
+	p := pausedObject{
+		Kind:      o.kind(),
+		Resource:  o.resource,
+		Namespace: kubectl.GetString(o.item, "metadata.namespace"),
+		Name:      o.name(),
+		Cluster:   kubectl.Labels(o.item)["cluster.x-k8s.io/cluster-name"],
+		Via:       via,
+		By:        ann[byAnnotation],
+		Since:     ann[atAnnotation],
+		Reason:    ann[reasonAnnotation],
+	}
+	if p.Kind == "Cluster" {
+		p.Cluster = p.Name
+	}
+	if p.By == "" || p.Since == "" {
+		var manager, at string
+		if via == "spec.paused" {
+			manager, at = managedBy(o.item, "f:spec", "f:paused")
+		} else {
+			manager, at = managedBy(o.item, "f:metadata", "f:annotations", "f:"+pausedAnnotation)
+		}
+		if p.By == "" {
+			p.By = manager
+		}
+		if p.Since == "" {
+			p.Since = at
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, p.Since); err == nil {
+		p.Duration = time.Since(t).Round(time.Minute).String()
+	}
+	return p
+}
+
+func listPaused(objects []object) []pausedObject {
+	var result []pausedObject
+	for _, o := range objects {
+		if o.kind() == "Cluster" {
+			if paused, _ := kubectl.GetNested(o.item, "spec.paused").(bool); paused {
+				result = append(result, describe(o, "spec.paused"))
+				continue
+			}
+		}
+		if _, ok := annotations(o.item)[pausedAnnotation]; ok {
+			result = append(result, describe(o, "annotation"))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Namespace+a.Cluster != b.Namespace+b.Cluster {
+			return a.Namespace+a.Cluster < b.Namespace+b.Cluster
+		}
+		if (a.Kind == "Cluster") != (b.Kind == "Cluster") {
+			return a.Kind == "Cluster"
+		}
+		return a.Kind+a.Name < b.Kind+b.Name
+	})
+	return result
+}
+
+// clusterGraph returns the cluster object followed by every CAPI object that
+// belongs to it.
+func clusterGraph(cluster object, objects []object) []object {
+	ns := kubectl.GetString(cluster.item, "metadata.namespace")
+	name := cluster.name()
+	member := map[string]bool{kubectl.GetString(cluster.item, "metadata.uid"): true}
+	var inNS []object
+	for _, o := range objects {
+		if kubectl.GetString(o.item, "metadata.namespace") != ns {
+			continue
+		}
+		inNS = append(inNS, o)
+		if kubectl.Labels(o.item)["cluster.x-k8s.io/cluster-name"] == name || kubectl.GetString(o.item, "spec.clusterName") == name {
+			member[kubectl.GetString(o.item, "metadata.uid")] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, o := range inNS {
+			uid := kubectl.GetString(o.item, "metadata.uid")
+			if member[uid] {
+				continue
+			}
+			for _, r := range kubectl.GetSlice(kubectl.GetMap(o.item, "metadata"), "ownerReferences") {
+				rm, _ := r.(map[string]interface{})
+				if owner, _ := rm["uid"].(string); member[owner] {
+					member[uid] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	graph := []object{cluster}
+	for _, o := range inNS {
+		if o.kind() != "Cluster" && member[kubectl.GetString(o.item, "metadata.uid")] {
+			graph = append(graph, o)
+		}
+	}
+	return graph
+}
+
+func setPaused(o object, pause, clusterOnly bool, by, reason string) error {
+	ns := kubectl.GetString(o.item, "metadata.namespace")
+	var args []string
+	if o.kind() == "Cluster" {
+		ann := map[string]interface{}{byAnnotation: nil, atAnnotation: nil, reasonAnnotation: nil}
+		if pause {
+			ann = map[string]interface{}{byAnnotation: by, atAnnotation: time.Now().UTC().Format(time.RFC3339)}
+			if reason != "" {
+				ann[reasonAnnotation] = reason
+			}
+		}
+		patch := map[string]interface{}{
+			"spec":     map[string]interface{}{"paused": pause},
+			"metadata": map[string]interface{}{"annotations": ann},
+		}
+		if !clusterOnly && !pause {
+			ann[pausedAnnotation] = nil
+		}
+		data, _ := json.Marshal(patch)
+		args = []string{"patch", o.resource, o.name(), "-n", ns, "--type", "merge", "-p", string(data)}
+	} else if pause {
+		args = []string{"annotate", o.resource, o.name(), "-n", ns, "--overwrite",
+			pausedAnnotation + "=", byAnnotation + "=" + by, atAnnotation + "=" + time.Now().UTC().Format(time.RFC3339)}
+		if reason != "" {
+			args = append(args, reasonAnnotation+"="+reason)
+		}
+	} else {
+		args = []string{"annotate", o.resource, o.name(), "-n", ns, pausedAnnotation + "-", byAnnotation + "-", atAnnotation + "-", reasonAnnotation + "-"}
+	}
+	if ok, _, errMsg := kubectl.Run(args, kubectl.DefaultTimeout); !ok {
+		return fmt.Errorf("%s/%s: %s", o.kind(), o.name(), strings.TrimSpace(errMsg))
+	}
+	return nil
+}
+
+func printList(list []pausedObject) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nPAUSED RESOURCES\n%s\n", sep, sep)
+	if len(list) == 0 {
+		fmt.Println("\n✅ Nothing is paused")
+		return
+	}
+	cluster := ""
+	for _, p := range list {
+		if key := p.Namespace + "/" + p.Cluster; key != cluster {
+			cluster = key
+			fmt.Printf("\n⏸️  Cluster %s\n", key)
+		}
+		fmt.Printf("   %-24s %-40s %-12s", p.Kind, p.Name, p.Via)
+		if p.Duration != "" {
+			fmt.Printf(" for %s", p.Duration)
+		}
+		if p.By != "" {
+			fmt.Printf(" by %s", p.By)
+		}
+		fmt.Println()
+		if p.Reason != "" {
+			fmt.Printf("      Reason: %s\n", p.Reason)
+		}
+	}
+	fmt.Printf("\nTotal: %d paused objects\n", len(list))
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace")
+	allNS := flag.Bool("A", false, "All namespaces")
+	selector := flag.String("l", "", "Label selector for clusters to pause/unpause")
+	clusterOnly := flag.Bool("cluster-only", false, "Only toggle Cluster.spec.paused, not the per-object annotation")
+	reason := flag.String("reason", "", "Reason recorded on paused objects")
+	by := flag.String("by", os.Getenv("USER"), "Who is pausing (recorded on paused objects)")
+	dryRun := flag.Bool("dry-run", false, "Show affected objects without changing them")
+	yes := flag.Bool("yes", false, "Run without confirmation")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [list | pause|unpause [cluster-name]]\n\nList paused CAPI resources, or pause/unpause a cluster's whole object graph.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	action := "list"
+	if flag.NArg() > 0 {
+		action = flag.Arg(0)
+	}
+	if action != "list" && action != "pause" && action != "unpause" {
+		fmt.Fprintf(os.Stderr, "Error: unknown action %q\n", action)
+		os.Exit(1)
+	}
+	if action != "list" && (flag.NArg() < 2) == (*selector == "") {
+		fmt.Fprintln(os.Stderr, "Error: pause/unpause need either a cluster name or -l <selector>")
+		os.Exit(1)
+	}
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	objects := loadObjects(*namespace, *allNS)
+
+	if action == "list" {
+		list := listPaused(objects)
+		if *format == "json" || *output != "" {
+			data, _ := json.MarshalIndent(list, "", "  ")
+			if *output != "" {
+				if err := os.WriteFile(*output, data, 0o644); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Report written to: %s\n", *output)
+			} else {
+				fmt.Println(string(data))
+			}
+		} else {
+			printList(list)
+		}
+		return
+	}
+
+	selected := map[string]bool{}
+	if *selector != "" {
+		items, err := kubectl.RunJSON("clusters.cluster.x-k8s.io", *namespace, *selector, *allNS)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, item := range items {
+			selected[kubectl.GetString(item, "metadata.uid")] = true
+		}
+	}
+	var clusters []object
+	for _, o := range objects {
+		if o.kind() != "Cluster" {
+			continue
+		}
+		if (flag.NArg() >= 2 && o.name() == flag.Arg(1)) || selected[kubectl.GetString(o.item, "metadata.uid")] {
+			clusters = append(clusters, o)
+		}
+	}
+	if len(clusters) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no matching clusters found")
+		os.Exit(1)
+	}
+
+	pause := action == "pause"
+	var targets []object
+	for _, c := range clusters {
+		graph := clusterGraph(c, objects)
+		if *clusterOnly {
+			graph = graph[:1]
+		}
+		fmt.Printf("\n%s %s/%s (%d objects)\n", titles[action], kubectl.GetString(c.item, "metadata.namespace"), c.name(), len(graph))
+		for _, o := range graph {
+			_, annotated := annotations(o.item)[pausedAnnotation]
+			paused, _ := kubectl.GetNested(o.item, "spec.paused").(bool)
+			state := "running"
+			if annotated || paused {
+				state = "paused"
+			}
+			fmt.Printf("   %-24s %-40s (%s)\n", o.kind(), o.name(), state)
+		}
+		targets = append(targets, graph...)
+	}
+
+	if *dryRun {
+		fmt.Println("\nDry run: no changes made")
+		return
+	}
+	if !*yes {
+		fmt.Printf("\n%s %d objects in %d clusters? [y/N]: ", titles[action], len(targets), len(clusters))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Aborted")
+			os.Exit(1)
+		}
+	}
+
+	// Pause the Cluster first so controllers stop before objects are touched;
+	// unpause it last so objects are released before reconciliation resumes.
+	order := targets
+	if !pause {
+		order = make([]object, len(targets))
+		for i, o := range targets {
+			order[len(targets)-1-i] = o
+		}
+	}
+	failed := 0
+	for _, o := range order {
+		if err := setPaused(o, pause, *clusterOnly, *by, *reason); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			failed++
+		}
+	}
+	fmt.Printf("\n✅ %sd %d objects", action, len(order)-failed)
+	if failed > 0 {
+		fmt.Printf(", ❌ %d failed\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println()
+}
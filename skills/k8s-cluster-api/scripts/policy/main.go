@@ -0,0 +1,480 @@
+// policy exports lint-cluster-templates and audit-security rules as admission policies.
+//
+// Selected checks that lint-cluster-templates and audit-security run at review
+// time are re-expressed as Gatekeeper ConstraintTemplates/Constraints or
+// Kyverno ClusterPolicies targeting CAPI kinds, so the management cluster can
+// enforce them at admission time. Error/high rules deny by default and
+// warning/medium/low rules only warn (Gatekeeper enforcementAction: warn,
+// Kyverno Audit); --enforcement overrides this for all rules.
+//
+// Usage:
+//
+//	go run ./policy [flags] list
+//	go run ./policy [flags] export
+//
+// Examples:
+//
+//	go run ./policy list
+//	go run ./policy --engine gatekeeper export > capi-gatekeeper.yaml
+//	go run ./policy --engine kyverno --rules audit-anonymous-auth,audit-pss-enforce export
+//	go run ./policy --engine kyverno --enforcement warn --out policies/ export
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type kindMatch struct {
+	Group string
+	Kinds []string
+}
+
+type rule struct {
+	ID          string
+	Source      string // lint-cluster-templates, audit-security
+	Severity    string // severity in the source tool
+	Title       string
+	Description string
+	Match       []kindMatch
+	// Rego holds the body of the Gatekeeper template after the package line.
+	Rego string
+	// Kyverno holds the validate block(s) of the Kyverno rule(s), one per match.
+	Kyverno []map[string]interface{}
+}
+
+const kcpExtraArgs = "request.object.spec.kubeadmConfigSpec.clusterConfiguration.apiServer.extraArgs"
+
+var capiGroups = []string{
+	"cluster.x-k8s.io", "infrastructure.cluster.x-k8s.io",
+	"bootstrap.cluster.x-k8s.io", "controlplane.cluster.x-k8s.io",
+}
+
+var kcpMatch = []kindMatch{{"controlplane.cluster.x-k8s.io", []string{"KubeadmControlPlane"}}}
+
+func condition(key, operator string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"key": key, "operator": operator, "value": value}
+}
+
+func deny(message string, conditions ...map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"message": message,
+		"deny":    map[string]interface{}{"conditions": map[string]interface{}{"any": conditions}},
+	}
+}
+
+var rules = []rule{
+	{
+		ID: "lint-deprecated-api-version", Source: "lint-cluster-templates", Severity: "warning",
+		Title:       "Deprecated CAPI API version",
+		Description: "Objects must not use the removed v1alpha3/v1alpha4 CAPI API versions.",
+		Match:       []kindMatch{{"*", []string{"*"}}},
+		Rego: `violation[{"msg": msg}] {
+  av := input.review.object.apiVersion
+  regex.match("cluster\\.x-k8s\\.io/v1alpha[34]$", av)
+  msg := sprintf("%v %v uses deprecated API version %v; use v1beta1", [input.review.object.kind, input.review.object.metadata.name, av])
+}`,
+		Kyverno: []map[string]interface{}{deny("{{ request.object.kind }} uses a deprecated API version; use v1beta1",
+			condition("{{ request.object.apiVersion }}", "AnyIn", []string{
+				"cluster.x-k8s.io/v1alpha3", "cluster.x-k8s.io/v1alpha4",
+				"infrastructure.cluster.x-k8s.io/v1alpha3", "infrastructure.cluster.x-k8s.io/v1alpha4",
+				"bootstrap.cluster.x-k8s.io/v1alpha3", "bootstrap.cluster.x-k8s.io/v1alpha4",
+				"controlplane.cluster.x-k8s.io/v1alpha3", "controlplane.cluster.x-k8s.io/v1alpha4",
+			}))},
+	},
+	{
+		ID: "lint-cluster-name", Source: "lint-cluster-templates", Severity: "error",
+		Title:       "Missing spec.clusterName",
+		Description: "Machines, MachineSets, MachineDeployments, MachinePools and MachineHealthChecks must set spec.clusterName.",
+		Match:       []kindMatch{{"cluster.x-k8s.io", []string{"Machine", "MachineSet", "MachineDeployment", "MachinePool", "MachineHealthCheck"}}},
+		Rego: `violation[{"msg": msg}] {
+  not input.review.object.spec.clusterName
+  msg := sprintf("%v %v: missing required spec field clusterName", [input.review.object.kind, input.review.object.metadata.name])
+}`,
+		Kyverno: []map[string]interface{}{{
+			"message": "{{ request.object.kind }}: missing required spec field clusterName",
+			"pattern": map[string]interface{}{"spec": map[string]interface{}{"clusterName": "?*"}},
+		}},
+	},
+	{
+		ID: "audit-pss-enforce", Source: "audit-security", Severity: "high",
+		Title:       "Pod Security Standard enforce level",
+		Description: "ClusterClass-based Clusters must set the podSecurityStandard variable with enforce baseline or restricted.",
+		Match:       []kindMatch{{"cluster.x-k8s.io", []string{"Cluster"}}},
+		Rego: `allowed := {"baseline", "restricted"}
+
+enforce_level(obj) = level {
+  v := obj.spec.topology.variables[_]
+  v.name == "podSecurityStandard"
+  level := object.get(v.value, "enforce", "")
+}
+
+violation[{"msg": msg}] {
+  obj := input.review.object
+  obj.spec.topology
+  level := enforce_level(obj)
+  not allowed[level]
+  msg := sprintf("Cluster %v: PSS enforce level is '%v' (should be baseline or restricted)", [obj.metadata.name, level])
+}
+
+violation[{"msg": msg}] {
+  obj := input.review.object
+  obj.spec.topology
+  not enforce_level(obj)
+  msg := sprintf("Cluster %v: no podSecurityStandard variable configured", [obj.metadata.name])
+}`,
+		Kyverno: []map[string]interface{}{{
+			"message": "Cluster {{ request.object.metadata.name }}: PSS enforce level must be baseline or restricted",
+			"deny": map[string]interface{}{"conditions": map[string]interface{}{"all": []map[string]interface{}{
+				condition("{{ request.object.spec.topology.class || '' }}", "NotEquals", ""),
+				condition("{{ request.object.spec.topology.variables[?name=='podSecurityStandard'] | [0].value.enforce || '' }}", "AnyNotIn", []string{"baseline", "restricted"}),
+			}}},
+		}},
+	},
+	{
+		ID: "audit-anonymous-auth", Source: "audit-security", Severity: "high",
+		Title:       "Anonymous API server authentication",
+		Description: "KubeadmControlPlanes must not set apiServer extraArgs anonymous-auth=true.",
+		Match:       kcpMatch,
+		Rego: `violation[{"msg": msg}] {
+  args := input.review.object.spec.kubeadmConfigSpec.clusterConfiguration.apiServer.extraArgs
+  args["anonymous-auth"] == "true"
+  msg := sprintf("KubeadmControlPlane %v: anonymous authentication is enabled", [input.review.object.metadata.name])
+}`,
+		Kyverno: []map[string]interface{}{deny("KubeadmControlPlane {{ request.object.metadata.name }}: anonymous authentication is enabled",
+			condition("{{ "+kcpExtraArgs+".\"anonymous-auth\" || '' }}", "Equals", "true"))},
+	},
+	{
+		ID: "audit-rbac-authorization", Source: "audit-security", Severity: "high",
+		Title:       "RBAC authorization mode",
+		Description: "When a KubeadmControlPlane sets apiServer authorization-mode it must include RBAC (unset keeps the kubeadm default Node,RBAC).",
+		Match:       kcpMatch,
+		Rego: `violation[{"msg": msg}] {
+  mode := input.review.object.spec.kubeadmConfigSpec.clusterConfiguration.apiServer.extraArgs["authorization-mode"]
+  not contains(mode, "RBAC")
+  msg := sprintf("KubeadmControlPlane %v: authorization-mode %v does not include RBAC", [input.review.object.metadata.name, mode])
+}`,
+		Kyverno: []map[string]interface{}{{
+			"message": "KubeadmControlPlane {{ request.object.metadata.name }}: authorization-mode does not include RBAC",
+			"deny": map[string]interface{}{"conditions": map[string]interface{}{"all": []map[string]interface{}{
+				condition("{{ "+kcpExtraArgs+".\"authorization-mode\" || '' }}", "NotEquals", ""),
+				condition("{{ split("+kcpExtraArgs+".\"authorization-mode\" || '', ',') }}", "AllNotIn", []string{"RBAC"}),
+			}}},
+		}},
+	},
+	{
+		ID: "audit-encryption-at-rest", Source: "audit-security", Severity: "medium",
+		Title:       "Secret encryption at rest",
+		Description: "KubeadmControlPlanes should configure apiServer encryption-provider-config.",
+		Match:       kcpMatch,
+		Rego: `violation[{"msg": msg}] {
+  args := object.get(input.review.object.spec.kubeadmConfigSpec.clusterConfiguration.apiServer, "extraArgs", {})
+  not args["encryption-provider-config"]
+  msg := sprintf("KubeadmControlPlane %v: etcd encryption at rest not configured", [input.review.object.metadata.name])
+}`,
+		Kyverno: []map[string]interface{}{deny("KubeadmControlPlane {{ request.object.metadata.name }}: etcd encryption at rest not configured",
+			condition("{{ "+kcpExtraArgs+".\"encryption-provider-config\" || '' }}", "Equals", ""))},
+	},
+	{
+		ID: "audit-audit-policy", Source: "audit-security", Severity: "medium",
+		Title:       "API audit policy",
+		Description: "KubeadmControlPlanes should configure apiServer audit-policy-file.",
+		Match:       kcpMatch,
+		Rego: `violation[{"msg": msg}] {
+  args := object.get(input.review.object.spec.kubeadmConfigSpec.clusterConfiguration.apiServer, "extraArgs", {})
+  not args["audit-policy-file"]
+  msg := sprintf("KubeadmControlPlane %v: Kubernetes audit policy not configured", [input.review.object.metadata.name])
+}`,
+		Kyverno: []map[string]interface{}{deny("KubeadmControlPlane {{ request.object.metadata.name }}: Kubernetes audit policy not configured",
+			condition("{{ "+kcpExtraArgs+".\"audit-policy-file\" || '' }}", "Equals", ""))},
+	},
+	{
+		ID: "audit-control-plane-ha", Source: "audit-security", Severity: "medium",
+		Title:       "Highly available control plane",
+		Description: "Control planes should run an odd number of at least 3 replicas.",
+		Match: []kindMatch{
+			{"cluster.x-k8s.io", []string{"Cluster"}},
+			{"controlplane.cluster.x-k8s.io", []string{"KubeadmControlPlane"}},
+		},
+		Rego: `replicas(obj) = r {
+  obj.kind == "KubeadmControlPlane"
+  r := object.get(obj.spec, "replicas", 1)
+}
+
+replicas(obj) = r {
+  obj.kind == "Cluster"
+  obj.spec.topology
+  r := object.get(object.get(obj.spec.topology, "controlPlane", {}), "replicas", 1)
+}
+
+violation[{"msg": msg}] {
+  r := replicas(input.review.object)
+  r < 3
+  msg := sprintf("%v %v: control plane has %v replica(s) (recommend 3 for HA)", [input.review.object.kind, input.review.object.metadata.name, r])
+}
+
+violation[{"msg": msg}] {
+  r := replicas(input.review.object)
+  r % 2 == 0
+  msg := sprintf("%v %v: control plane has even number of replicas (%v)", [input.review.object.kind, input.review.object.metadata.name, r])
+}`,
+		Kyverno: []map[string]interface{}{
+			{
+				"message": "Cluster {{ request.object.metadata.name }}: control plane should have an odd number of at least 3 replicas",
+				"deny": map[string]interface{}{"conditions": map[string]interface{}{"all": []map[string]interface{}{
+					condition("{{ request.object.spec.topology.class || '' }}", "NotEquals", ""),
+				}, "any": []map[string]interface{}{
+					condition("{{ request.object.spec.topology.controlPlane.replicas || `1` }}", "LessThan", 3),
+					condition("{{ modulo(request.object.spec.topology.controlPlane.replicas || `1`, `2`) }}", "Equals", 0),
+				}}},
+			},
+			{
+				"message": "KubeadmControlPlane {{ request.object.metadata.name }}: control plane should have an odd number of at least 3 replicas",
+				"deny": map[string]interface{}{"conditions": map[string]interface{}{"any": []map[string]interface{}{
+					condition("{{ request.object.spec.replicas || `1` }}", "LessThan", 3),
+					condition("{{ modulo(request.object.spec.replicas || `1`, `2`) }}", "Equals", 0),
+				}}},
+			},
+		},
+	},
+}
+
+// denies reports whether a rule blocks admission under --enforcement auto.
+func (r rule) denies() bool {
+	return r.Severity == "error" || r.Severity == "high"
+}
+
+// templateName is the Gatekeeper ConstraintTemplate name, which must be the
+// lowercase Constraint kind.
+func (r rule) templateName() string {
+	return "capi" + strings.ReplaceAll(r.ID, "-", "")
+}
+
+func (r rule) constraintKind() string {
+	var b strings.Builder
+	b.WriteString("Capi")
+	for _, part := range strings.Split(r.ID, "-") {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func gatekeeper(r rule, deny bool) []interface{} {
+	template := map[string]interface{}{
+		"apiVersion": "templates.gatekeeper.sh/v1",
+		"kind":       "ConstraintTemplate",
+		"metadata": map[string]interface{}{
+			"name": r.templateName(),
+			"annotations": map[string]interface{}{
+				"description":                   r.Description,
+				"policy.capi-tools/source":      r.Source,
+				"policy.capi-tools/source-rule": r.ID,
+			},
+		},
+		"spec": map[string]interface{}{
+			"crd": map[string]interface{}{"spec": map[string]interface{}{"names": map[string]interface{}{"kind": r.constraintKind()}}},
+			"targets": []interface{}{map[string]interface{}{
+				"target": "admission.k8s.gatekeeper.sh",
+				"rego":   "package " + r.templateName() + "\n\n" + r.Rego + "\n",
+			}},
+		},
+	}
+	var kinds []interface{}
+	for _, m := range r.Match {
+		groups := []string{m.Group}
+		if m.Group == "*" {
+			groups = capiGroups
+		}
+		kinds = append(kinds, map[string]interface{}{"apiGroups": groups, "kinds": m.Kinds})
+	}
+	action := "warn"
+	if deny {
+		action = "deny"
+	}
+	constraint := map[string]interface{}{
+		"apiVersion": "constraints.gatekeeper.sh/v1beta1",
+		"kind":       r.constraintKind(),
+		"metadata":   map[string]interface{}{"name": r.ID},
+		"spec": map[string]interface{}{
+			"enforcementAction": action,
+			"match":             map[string]interface{}{"kinds": kinds},
+		},
+	}
+	return []interface{}{template, constraint}
+}
+
+func kyverno(r rule, deny bool) []interface{} {
+	action := "Audit"
+	if deny {
+		action = "Enforce"
+	}
+	var kyvernoRules []interface{}
+	for i, m := range r.Match {
+		var kinds []string
+		for _, k := range m.Kinds {
+			if m.Group == "*" {
+				for _, g := range capiGroups {
+					kinds = append(kinds, g+"/*/*")
+				}
+				continue
+			}
+			kinds = append(kinds, m.Group+"/*/"+k)
+		}
+		validate := r.Kyverno[0]
+		name := r.ID
+		if len(r.Kyverno) > 1 {
+			validate = r.Kyverno[i]
+			name = fmt.Sprintf("%s-%s", r.ID, strings.ToLower(m.Kinds[0]))
+		}
+		kyvernoRules = append(kyvernoRules, map[string]interface{}{
+			"name":     name,
+			"match":    map[string]interface{}{"any": []interface{}{map[string]interface{}{"resources": map[string]interface{}{"kinds": kinds}}}},
+			"validate": validate,
+		})
+	}
+	severity := map[string]string{"error": "high", "warning": "medium"}[r.Severity]
+	if severity == "" {
+		severity = r.Severity
+	}
+	return []interface{}{map[string]interface{}{
+		"apiVersion": "kyverno.io/v1",
+		"kind":       "ClusterPolicy",
+		"metadata": map[string]interface{}{
+			"name": "capi-" + r.ID,
+			"annotations": map[string]interface{}{
+				"policies.kyverno.io/title":       r.Title,
+				"policies.kyverno.io/category":    "Cluster API",
+				"policies.kyverno.io/severity":    severity,
+				"policies.kyverno.io/description": r.Description,
+				"policy.capi-tools/source":        r.Source,
+			},
+		},
+		"spec": map[string]interface{}{
+			"validationFailureAction": action,
+			"background":              true,
+			"rules":                   kyvernoRules,
+		},
+	}}
+}
+
+func render(objects []interface{}) (string, error) {
+	var b bytes.Buffer
+	for i, o := range objects {
+		if i > 0 {
+			b.WriteString("---\n")
+		}
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		if err := enc.Encode(o); err != nil {
+			return "", err
+		}
+		enc.Close()
+	}
+	return b.String(), nil
+}
+
+func selectRules(list string) ([]rule, error) {
+	if list == "" {
+		return rules, nil
+	}
+	byID := map[string]rule{}
+	for _, r := range rules {
+		byID[r.ID] = r
+	}
+	var selected []rule
+	for _, id := range strings.Split(list, ",") {
+		id = strings.TrimSpace(id)
+		r, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown rule %q (see: policy list)", id)
+		}
+		selected = append(selected, r)
+	}
+	return selected, nil
+}
+
+func listRules() {
+	sorted := append([]rule{}, rules...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	fmt.Printf("%-30s %-24s %-9s %s\n", "RULE", "SOURCE", "SEVERITY", "DESCRIPTION")
+	for _, r := range sorted {
+		fmt.Printf("%-30s %-24s %-9s %s\n", r.ID, r.Source, r.Severity, r.Description)
+	}
+}
+
+func main() {
+	engine := flag.String("engine", "gatekeeper", "Policy engine: gatekeeper, kyverno")
+	ruleList := flag.String("rules", "", "Comma-separated rule IDs to export (default: all)")
+	enforcement := flag.String("enforcement", "auto", "auto (deny error/high, warn others), deny, warn")
+	outDir := flag.String("out", "", "Write one file per rule to this directory instead of stdout")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] list|export\n\nExport lint-cluster-templates and audit-security rules as Gatekeeper or Kyverno admission policies.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	action := flag.Arg(0)
+	switch action {
+	case "list":
+		listRules()
+		return
+	case "export":
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *engine != "gatekeeper" && *engine != "kyverno" {
+		fmt.Fprintf(os.Stderr, "Error: unknown engine %q\n", *engine)
+		os.Exit(1)
+	}
+	if *enforcement != "auto" && *enforcement != "deny" && *enforcement != "warn" {
+		fmt.Fprintf(os.Stderr, "Error: unknown enforcement %q\n", *enforcement)
+		os.Exit(1)
+	}
+	selected, err := selectRules(*ruleList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var all []string
+	for _, r := range selected {
+		deny := *enforcement == "deny" || (*enforcement == "auto" && r.denies())
+		objects := gatekeeper(r, deny)
+		if *engine == "kyverno" {
+			objects = kyverno(r, deny)
+		}
+		out, err := render(objects)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", r.ID, err)
+			os.Exit(1)
+		}
+		if *outDir == "" {
+			all = append(all, out)
+			continue
+		}
+		path := filepath.Join(*outDir, *engine+"-"+r.ID+".yaml")
+		if err := os.WriteFile(path, []byte(out), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Written: %s\n", path)
+	}
+	if *outDir == "" {
+		fmt.Print(strings.Join(all, "---\n"))
+	}
+}
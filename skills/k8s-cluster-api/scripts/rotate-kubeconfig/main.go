@@ -0,0 +1,630 @@
+// rotate-kubeconfig regenerates workload cluster admin kubeconfig secrets.
+//
+// Two rotation methods are supported:
+//   - kcp: delete the <cluster>-kubeconfig secret so KubeadmControlPlane
+//     regenerates it with a fresh client certificate (the old secret is
+//     restored if regeneration does not happen in time)
+//   - mint: sign a new admin client certificate with the cluster CA from the
+//     <cluster>-ca secret and write a new kubeconfig into the secret
+//
+// The default, auto, uses kcp for KubeadmControlPlane clusters and mint for
+// everything else. New credentials are verified against the workload API
+// server, then copied into consumer secrets: those listed with --consumers
+// and those annotated with kubeconfig-rotate.capi-tools/source=<ns>/<cluster>
+// (the target key defaults to "value" and can be set with the
+// kubeconfig-rotate.capi-tools/key annotation).
+//
+// In fleet mode (-A) every cluster whose client certificate is older than
+// --older-than days is rotated.
+//
+// Usage:
+//
+//	go run ./rotate-kubeconfig [flags] <cluster-name>
+//	go run ./rotate-kubeconfig -A --older-than 90 [flags]
+//
+// Examples:
+//
+//	go run ./rotate-kubeconfig -n default my-cluster
+//	go run ./rotate-kubeconfig --method mint --consumers argocd/cluster-my-cluster:config my-cluster
+//	go run ./rotate-kubeconfig -A --older-than 180 --dry-run
+//	go run ./rotate-kubeconfig -A --older-than 180 --yes --format json -o rotation.json
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const (
+	sourceAnnotation = "kubeconfig-rotate.capi-tools/source"
+	keyAnnotation    = "kubeconfig-rotate.capi-tools/key"
+)
+
+type target struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Method    string `json:"method"`
+	Issued    string `json:"issued,omitempty"`
+	Expires   string `json:"expires,omitempty"`
+	AgeDays   int    `json:"age_days"`
+}
+
+type rotation struct {
+	target
+	Rotated   bool     `json:"rotated"`
+	Verified  bool     `json:"verified"`
+	NewExpiry string   `json:"new_expiry,omitempty"`
+	Consumers []string `json:"consumers_updated,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+type consumer struct {
+	Namespace string
+	Name      string
+	Key       string
+}
+
+func (c consumer) String() string {
+	return fmt.Sprintf("%s/%s:%s", c.Namespace, c.Name, c.Key)
+}
+
+func readSecret(name, namespace string) (map[string]interface{}, error) {
+	items, err := kubectl.RunJSON("secret/"+name, namespace, "", false)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("secret %s/%s not found", namespace, name)
+	}
+	return items[0], nil
+}
+
+func secretData(secret map[string]interface{}, key string) ([]byte, error) {
+	enc, _ := kubectl.GetMap(secret, "data")[key].(string)
+	if enc == "" {
+		return nil, fmt.Errorf("secret has no %q key", key)
+	}
+	return base64.StdEncoding.DecodeString(enc)
+}
+
+// clientCert returns the first client certificate embedded in a kubeconfig.
+func clientCert(kubeconfig []byte) (*x509.Certificate, error) {
+	var cfg map[string]interface{}
+	if err := yaml.Unmarshal(kubeconfig, &cfg); err != nil {
+		return nil, err
+	}
+	for _, u := range kubectl.GetSlice(cfg, "users") {
+		um, _ := u.(map[string]interface{})
+		enc, _ := kubectl.GetMap(um, "user")["client-certificate-data"].(string)
+		if enc == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(raw)
+		if block == nil {
+			return nil, errors.New("client-certificate-data is not PEM")
+		}
+		return x509.ParseCertificate(block.Bytes)
+	}
+	return nil, errors.New("kubeconfig has no embedded client certificate")
+}
+
+func describe(cluster map[string]interface{}, method string) target {
+	t := target{
+		Cluster:   kubectl.GetString(cluster, "metadata.name"),
+		Namespace: kubectl.GetString(cluster, "metadata.namespace"),
+		Method:    method,
+	}
+	if t.Method == "auto" {
+		t.Method = "mint"
+		if kubectl.GetString(cluster, "spec.controlPlaneRef.kind") == "KubeadmControlPlane" {
+			t.Method = "kcp"
+		}
+	}
+
+	t.AgeDays = -1
+	secret, err := readSecret(t.Cluster+"-kubeconfig", t.Namespace)
+	if err != nil {
+		return t
+	}
+	if data, err := secretData(secret, "value"); err == nil {
+		if cert, err := clientCert(data); err == nil {
+			t.Issued = cert.NotBefore.Format(time.RFC3339)
+			t.Expires = cert.NotAfter.Format(time.RFC3339)
+			t.AgeDays = int(time.Since(cert.NotBefore).Hours() / 24)
+			return t
+		}
+	}
+	// token or exec based kubeconfig: fall back to the secret's age
+	if created, err := time.Parse(time.RFC3339, kubectl.GetString(secret, "metadata.creationTimestamp")); err == nil {
+		t.Issued = created.Format(time.RFC3339)
+		t.AgeDays = int(time.Since(created).Hours() / 24)
+	}
+	return t
+}
+
+func verify(kubeconfig []byte) error {
+	f, err := os.CreateTemp("", "rotated-*.kubeconfig")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(kubeconfig); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	ok, _, errMsg := kubectl.Run([]string{"--kubeconfig", f.Name(), "get", "--raw", "/version"}, 30*time.Second)
+	if !ok {
+		return fmt.Errorf("new credentials rejected: %s", strings.TrimSpace(errMsg))
+	}
+	return nil
+}
+
+func patchSecretKey(name, namespace, key string, value []byte) error {
+	patch, _ := json.Marshal(map[string]interface{}{
+		"data": map[string]string{key: base64.StdEncoding.EncodeToString(value)},
+	})
+	ok, _, errMsg := kubectl.Run([]string{"patch", "secret", name, "-n", namespace, "--type", "merge", "-p", string(patch)}, 0)
+	if !ok {
+		return fmt.Errorf("patch secret %s/%s: %s", namespace, name, strings.TrimSpace(errMsg))
+	}
+	return nil
+}
+
+// restoreSecret re-creates a secret from a previously read copy.
+func restoreSecret(secret map[string]interface{}) error {
+	meta := kubectl.GetMap(secret, "metadata")
+	for _, k := range []string{"resourceVersion", "uid", "creationTimestamp", "managedFields"} {
+		delete(meta, k)
+	}
+	data, _ := json.Marshal(secret)
+	f, err := os.CreateTemp("", "secret-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	f.Write(data)
+	f.Close()
+	ok, _, errMsg := kubectl.Run([]string{"create", "-f", f.Name()}, 0)
+	if !ok {
+		return fmt.Errorf("restore secret: %s", strings.TrimSpace(errMsg))
+	}
+	return nil
+}
+
+// rotateKCP deletes the kubeconfig secret and waits for KubeadmControlPlane
+// to regenerate it.
+func rotateKCP(cluster, namespace string, timeout time.Duration) ([]byte, error) {
+	name := cluster + "-kubeconfig"
+	old, err := readSecret(name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	oldUID := kubectl.GetString(old, "metadata.uid")
+
+	ok, _, errMsg := kubectl.Run([]string{"delete", "secret", name, "-n", namespace}, 0)
+	if !ok {
+		return nil, fmt.Errorf("delete secret: %s", strings.TrimSpace(errMsg))
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(5 * time.Second)
+		secret, err := readSecret(name, namespace)
+		if err != nil || kubectl.GetString(secret, "metadata.uid") == oldUID {
+			continue
+		}
+		if data, err := secretData(secret, "value"); err == nil {
+			return data, nil
+		}
+	}
+
+	if err := restoreSecret(old); err != nil {
+		return nil, fmt.Errorf("kubeconfig was not regenerated within %s and %v", timeout, err)
+	}
+	return nil, fmt.Errorf("kubeconfig was not regenerated within %s; previous secret restored", timeout)
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("CA key is not PEM")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported CA key type")
+	}
+	return signer, nil
+}
+
+// mintKubeconfig signs a new admin client certificate with the cluster CA
+// and renders a kubeconfig for it.
+func mintKubeconfig(cluster, namespace string, validity time.Duration) ([]byte, error) {
+	caSecret, err := readSecret(cluster+"-ca", namespace)
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := secretData(caSecret, "tls.crt")
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := secretData(caSecret, "tls.key")
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(caPEM)
+	if block == nil {
+		return nil, errors.New("CA certificate is not PEM")
+	}
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	caKey, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := apiServer(cluster, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "kubernetes-admin", Organization: []string{"system:masters"}},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if _, ok := caKey.(*ecdsa.PrivateKey); ok {
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	clientKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	user := cluster + "-admin"
+	b64 := base64.StdEncoding.EncodeToString
+	return []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: %[1]s
+  cluster:
+    server: %[2]s
+    certificate-authority-data: %[3]s
+contexts:
+- name: %[4]s@%[1]s
+  context:
+    cluster: %[1]s
+    user: %[4]s
+current-context: %[4]s@%[1]s
+users:
+- name: %[4]s
+  user:
+    client-certificate-data: %[5]s
+    client-key-data: %[6]s
+`, cluster, server, b64(caPEM), user, b64(certPEM), b64(clientKeyPEM))), nil
+}
+
+// apiServer returns the workload API server URL, preferring the one in the
+// existing kubeconfig over the Cluster's controlPlaneEndpoint.
+func apiServer(cluster, namespace string) (string, error) {
+	if secret, err := readSecret(cluster+"-kubeconfig", namespace); err == nil {
+		if data, err := secretData(secret, "value"); err == nil {
+			var cfg map[string]interface{}
+			if yaml.Unmarshal(data, &cfg) == nil {
+				for _, c := range kubectl.GetSlice(cfg, "clusters") {
+					cm, _ := c.(map[string]interface{})
+					if s, _ := kubectl.GetMap(cm, "cluster")["server"].(string); s != "" {
+						return s, nil
+					}
+				}
+			}
+		}
+	}
+	items, err := kubectl.RunJSON("clusters.cluster.x-k8s.io/"+cluster, namespace, "", false)
+	if err != nil || len(items) == 0 {
+		return "", fmt.Errorf("cluster %s/%s not found", namespace, cluster)
+	}
+	host := kubectl.GetString(items[0], "spec.controlPlaneEndpoint.host")
+	port, _ := kubectl.GetNested(items[0], "spec.controlPlaneEndpoint.port").(float64)
+	if host == "" {
+		return "", errors.New("cluster has no controlPlaneEndpoint")
+	}
+	if port == 0 {
+		port = 6443
+	}
+	return fmt.Sprintf("https://%s:%d", host, int(port)), nil
+}
+
+func parseConsumers(list string) ([]consumer, error) {
+	var out []consumer
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		c := consumer{Key: "value"}
+		if i := strings.LastIndex(entry, ":"); i >= 0 {
+			entry, c.Key = entry[:i], entry[i+1:]
+		}
+		parts := strings.SplitN(entry, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid consumer %q (want namespace/name[:key])", entry)
+		}
+		c.Namespace, c.Name = parts[0], parts[1]
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// annotatedConsumers finds secrets that declare themselves copies of the
+// cluster's kubeconfig.
+func annotatedConsumers(secrets []map[string]interface{}, cluster, namespace string) []consumer {
+	var out []consumer
+	for _, s := range secrets {
+		ann := kubectl.GetMap(kubectl.GetMap(s, "metadata"), "annotations")
+		if src, _ := ann[sourceAnnotation].(string); src != namespace+"/"+cluster {
+			continue
+		}
+		c := consumer{
+			Namespace: kubectl.GetString(s, "metadata.namespace"),
+			Name:      kubectl.GetString(s, "metadata.name"),
+			Key:       "value",
+		}
+		if k, _ := ann[keyAnnotation].(string); k != "" {
+			c.Key = k
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func rotate(t target, consumers []consumer, validity, timeout time.Duration) rotation {
+	r := rotation{target: t}
+	var kubeconfig []byte
+	var err error
+
+	switch t.Method {
+	case "kcp":
+		kubeconfig, err = rotateKCP(t.Cluster, t.Namespace, timeout)
+		if err == nil {
+			r.Rotated = true
+			err = verify(kubeconfig)
+		}
+	case "mint":
+		// verify before writing, so a bad CA or endpoint never replaces
+		// working credentials
+		kubeconfig, err = mintKubeconfig(t.Cluster, t.Namespace, validity)
+		if err == nil {
+			err = verify(kubeconfig)
+		}
+		if err == nil {
+			err = patchSecretKey(t.Cluster+"-kubeconfig", t.Namespace, "value", kubeconfig)
+			r.Rotated = err == nil
+		}
+	default:
+		err = fmt.Errorf("unknown method %q", t.Method)
+	}
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Verified = true
+	if cert, err := clientCert(kubeconfig); err == nil {
+		r.NewExpiry = cert.NotAfter.Format(time.RFC3339)
+	}
+
+	for _, c := range consumers {
+		if err := patchSecretKey(c.Name, c.Namespace, c.Key, kubeconfig); err != nil {
+			r.Error = err.Error()
+			continue
+		}
+		r.Consumers = append(r.Consumers, c.String())
+	}
+	return r
+}
+
+func printTargets(w io.Writer, targets []target) {
+	fmt.Fprintf(w, "\n%-35s %-8s %-10s %s\n", "CLUSTER", "METHOD", "AGE", "EXPIRES")
+	for _, t := range targets {
+		age := "unknown"
+		if t.AgeDays >= 0 {
+			age = fmt.Sprintf("%dd", t.AgeDays)
+		}
+		expires := t.Expires
+		if expires == "" {
+			expires = "-"
+		}
+		fmt.Fprintf(w, "%-35s %-8s %-10s %s\n", t.Namespace+"/"+t.Cluster, t.Method, age, expires)
+	}
+}
+
+func printResults(results []rotation) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nKUBECONFIG ROTATION\n%s\n", sep, sep)
+	failed := 0
+	for _, r := range results {
+		icon := "✅"
+		if r.Error != "" {
+			icon = "❌"
+			failed++
+		}
+		fmt.Printf("\n%s %s/%s (%s)\n", icon, r.Namespace, r.Cluster, r.Method)
+		fmt.Printf("  Rotated: %v  Verified: %v\n", r.Rotated, r.Verified)
+		if r.NewExpiry != "" {
+			fmt.Printf("  New expiry: %s\n", r.NewExpiry)
+		}
+		for _, c := range r.Consumers {
+			fmt.Printf("  Updated consumer: %s\n", c)
+		}
+		if r.Error != "" {
+			fmt.Printf("  Error: %s\n", r.Error)
+		}
+	}
+	fmt.Printf("\nRotated %d of %d cluster(s)\n", len(results)-failed, len(results))
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace of the cluster")
+	allNS := flag.Bool("A", false, "Fleet mode: consider clusters in all namespaces")
+	olderThan := flag.Int("older-than", 0, "Fleet mode: only rotate credentials older than N days")
+	method := flag.String("method", "auto", "Rotation method: auto, kcp, mint")
+	validity := flag.Duration("validity", 365*24*time.Hour, "Validity of minted client certificates")
+	consumersFlag := flag.String("consumers", "", "Comma-separated secrets to update: namespace/name[:key]")
+	timeout := flag.Duration("timeout", 2*time.Minute, "Time to wait for KCP to regenerate a kubeconfig")
+	dryRun := flag.Bool("dry-run", false, "Show what would be rotated and exit")
+	yes := flag.Bool("yes", false, "Run without confirmation")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <cluster-name>\n       %s -A --older-than N [flags]\n\nRegenerate workload cluster kubeconfig secrets, verify them and update consumers.\n\nFlags:\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if (flag.NArg() < 1) != *allNS {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *method != "auto" && *method != "kcp" && *method != "mint" {
+		fmt.Fprintf(os.Stderr, "Error: unknown method %q\n", *method)
+		os.Exit(1)
+	}
+	extra, err := parseConsumers(*consumersFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	// Progress goes to stderr unless printing text, so the report can be piped.
+	progress := os.Stdout
+	if *format != "text" {
+		progress = os.Stderr
+	}
+
+	var clusters []map[string]interface{}
+	if *allNS {
+		clusters, err = kubectl.RunJSON("clusters.cluster.x-k8s.io", "", "", true)
+	} else {
+		clusters, err = kubectl.RunJSON("clusters.cluster.x-k8s.io/"+flag.Arg(0), *namespace, "", false)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var targets []target
+	for _, c := range clusters {
+		t := describe(c, *method)
+		if *allNS && t.AgeDays >= 0 && t.AgeDays < *olderThan {
+			continue
+		}
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(progress, "No clusters need rotation")
+		return
+	}
+	if *allNS && len(extra) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: --consumers applies to a single cluster; annotate consumer secrets for fleet mode")
+		os.Exit(1)
+	}
+
+	printTargets(progress, targets)
+	if *dryRun {
+		fmt.Fprintln(progress, "\nDry run: no changes made")
+		return
+	}
+	if !*yes {
+		fmt.Fprintf(progress, "\nRotate kubeconfig for %d cluster(s)? [y/N]: ", len(targets))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Fprintln(progress, "Aborted")
+			os.Exit(1)
+		}
+	}
+
+	secrets, _ := kubectl.RunJSON("secrets", "", "", true)
+	var results []rotation
+	for _, t := range targets {
+		consumers := append(annotatedConsumers(secrets, t.Cluster, t.Namespace), extra...)
+		fmt.Fprintf(progress, "Rotating %s/%s via %s...\n", t.Namespace, t.Cluster, t.Method)
+		results = append(results, rotate(t, consumers, *validity, *timeout))
+	}
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printResults(results)
+	}
+
+	for _, r := range results {
+		if r.Error != "" {
+			os.Exit(1)
+		}
+	}
+}
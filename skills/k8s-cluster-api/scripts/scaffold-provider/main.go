@@ -3,34 +3,78 @@
 // Usage:
 //
 //	go run ./scaffold-provider [flags]
+//	go run ./scaffold-provider [flags] update
+//
+// Every scaffold records its config and the hash of each generated file in
+// .scaffold.yaml. update re-renders the project from that config with the
+// current templates and rewrites only files that still match their recorded
+// hash, so local edits survive template changes.
 //
 // Examples:
 //
 //	go run ./scaffold-provider -n mycloud -t infrastructure
 //	go run ./scaffold-provider -n mycloud -t bootstrap --module github.com/org/cluster-api-bootstrap-provider-mycloud
 //	go run ./scaffold-provider -n mycloud -t controlplane --output-dir ./capi-provider-mycloud
+//	go run ./scaffold-provider -n mycloud -t ipam
+//	go run ./scaffold-provider -n mycloud -t infrastructure --with-webhooks
+//	go run ./scaffold-provider -n mycloud -t infrastructure --with-machinepool
+//	go run ./scaffold-provider -n mycloud -t infrastructure --cloud-client
+//	go run ./scaffold-provider -n mycloud -t infrastructure --render-crds
+//	go run ./scaffold-provider -n mycloud --output-dir ./cluster-api-provider-mycloud --dry-run --diff
+//	go run ./scaffold-provider --output-dir ./cluster-api-provider-mycloud --diff update
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+
+	"gopkg.in/yaml.v3"
 )
 
 type providerConfig struct {
-	Name         string
-	Type         string // infrastructure, bootstrap, controlplane
-	Module       string
-	OutputDir    string
-	APIGroup     string
-	APIVersion   string
-	ClusterKind  string
-	MachineKind  string
-	TemplateKind string
-	ExtraKinds   []string
+	Name            string   `yaml:"name"`
+	Type            string   `yaml:"type"` // infrastructure, bootstrap, controlplane, ipam
+	Module          string   `yaml:"module"`
+	OutputDir       string   `yaml:"-"`
+	APIGroup        string   `yaml:"apiGroup"`
+	APIVersion      string   `yaml:"apiVersion"`
+	ClusterKind     string   `yaml:"clusterKind,omitempty"`
+	MachineKind     string   `yaml:"machineKind,omitempty"`
+	TemplateKind    string   `yaml:"templateKind,omitempty"`
+	MachinePoolKind string   `yaml:"machinePoolKind,omitempty"` // set by --with-machinepool (infrastructure only)
+	PoolKind        string   `yaml:"poolKind,omitempty"`        // IP pool kind (ipam only)
+	ExtraKinds      []string `yaml:"extraKinds,omitempty"`
+	WithWebhooks    bool     `yaml:"withWebhooks,omitempty"`
+	WithCloudClient bool     `yaml:"withCloudClient,omitempty"` // generate pkg/cloud (infrastructure only)
+	RenderCRDs      bool     `yaml:"renderCRDs,omitempty"`      // pre-render config/crd/bases without controller-gen
+}
+
+// Kinds returns the distinct API kinds generated for the provider.
+func (c *providerConfig) Kinds() []string {
+	var kinds []string
+	seen := map[string]bool{}
+	for _, k := range []string{c.ClusterKind, c.MachineKind, c.TemplateKind, c.MachinePoolKind, c.PoolKind} {
+		if k != "" && !seen[k] {
+			seen[k] = true
+			kinds = append(kinds, k)
+		}
+	}
+	return kinds
 }
 
 func (c *providerConfig) CapName() string {
@@ -38,6 +82,9 @@ func (c *providerConfig) CapName() string {
 }
 
 func (c *providerConfig) TypeCap() string {
+	if c.Type == "ipam" {
+		return "IPAM"
+	}
 	return strings.ToUpper(c.Type[:1]) + c.Type[1:]
 }
 
@@ -67,52 +114,126 @@ func defaultConfig(name, provType string) *providerConfig {
 		cfg.ClusterKind = capName + "ControlPlane"
 		cfg.MachineKind = capName + "ControlPlane"
 		cfg.TemplateKind = capName + "ControlPlaneTemplate"
+	case "ipam":
+		// v1beta1 of ipam.cluster.x-k8s.io is owned by CAPI (IPAddress/IPAddressClaim)
+		cfg.APIGroup = "ipam.cluster.x-k8s.io"
+		cfg.APIVersion = "v1alpha1"
+		cfg.PoolKind = capName + "IPPool"
 	}
 
 	if cfg.Module == "" {
-		var prefix string
-		switch provType {
-		case "infrastructure":
-			prefix = "cluster-api-provider-"
-		case "bootstrap":
-			prefix = "cluster-api-bootstrap-provider-"
-		case "controlplane":
-			prefix = "cluster-api-controlplane-provider-"
-		}
-		cfg.Module = "github.com/example/" + prefix + name
+		cfg.Module = "github.com/example/" + repoPrefix(provType) + name
 	}
 
 	return cfg
 }
 
+// repoPrefix returns the conventional repository name prefix for a provider type.
+func repoPrefix(provType string) string {
+	switch provType {
+	case "bootstrap":
+		return "cluster-api-bootstrap-provider-"
+	case "controlplane":
+		return "cluster-api-controlplane-provider-"
+	case "ipam":
+		return "cluster-api-ipam-provider-"
+	}
+	return "cluster-api-provider-"
+}
+
+// initialRelease is the version the scaffold's release artifacts are cut for.
+const initialRelease = "v0.1.0"
+
 // Template data struct for Go templates
 type templateData struct {
-	Name         string
-	CapName      string
-	Type         string
-	TypeCap      string
-	Module       string
-	APIGroup     string
-	APIVersion   string
-	ClusterKind  string
-	MachineKind  string
-	TemplateKind string
-	ExtraKinds   []string
+	Name            string
+	CapName         string
+	Type            string
+	TypeCap         string
+	Module          string
+	APIGroup        string
+	APIVersion      string
+	ClusterKind     string
+	MachineKind     string
+	TemplateKind    string
+	MachinePoolKind string
+	PoolKind        string
+	ExtraKinds      []string
+	WithWebhooks    bool
+	WithCloudClient bool
+	RenderCRDs      bool
+	Kinds           []string
+	ReleaseVersion  string
+
+	// Kind is set when rendering a per-kind template (e.g. webhooks).
+	Kind string
+}
+
+// KindLower returns the lowercase kind, as used in webhook paths and names.
+func (d templateData) KindLower() string {
+	return strings.ToLower(d.Kind)
+}
+
+// Plural returns the lowercase plural resource name of Kind.
+func (d templateData) Plural() string {
+	return strings.ToLower(d.Kind) + "s"
+}
+
+// GroupPath returns the API group in the dashed form used by webhook paths.
+func (d templateData) GroupPath() string {
+	return strings.ReplaceAll(d.APIGroup, ".", "-")
+}
+
+// ClusterctlPrefix returns the provider type as clusterctl spells it in
+// provider names, init flags and components file names.
+func (d templateData) ClusterctlPrefix() string {
+	if d.Type == "controlplane" {
+		return "control-plane"
+	}
+	return d.Type
+}
+
+// ClusterctlType returns the clusterctl provider type (e.g. InfrastructureProvider).
+func (d templateData) ClusterctlType() string {
+	switch d.Type {
+	case "controlplane":
+		return "ControlPlaneProvider"
+	case "ipam":
+		return "IPAMProvider"
+	}
+	return d.TypeCap + "Provider"
+}
+
+// Image returns the default controller image repository derived from the module path.
+func (d templateData) Image() string {
+	return strings.Replace(d.Module, "github.com/", "ghcr.io/", 1)
+}
+
+func (d templateData) forKind(kind string) templateData {
+	d.Kind = kind
+	return d
 }
 
 func newTemplateData(cfg *providerConfig) templateData {
 	return templateData{
-		Name:         cfg.Name,
-		CapName:      cfg.CapName(),
-		Type:         cfg.Type,
-		TypeCap:      cfg.TypeCap(),
-		Module:       cfg.Module,
-		APIGroup:     cfg.APIGroup,
-		APIVersion:   cfg.APIVersion,
-		ClusterKind:  cfg.ClusterKind,
-		MachineKind:  cfg.MachineKind,
-		TemplateKind: cfg.TemplateKind,
-		ExtraKinds:   cfg.ExtraKinds,
+		Name:            cfg.Name,
+		CapName:         cfg.CapName(),
+		Type:            cfg.Type,
+		TypeCap:         cfg.TypeCap(),
+		Module:          cfg.Module,
+		APIGroup:        cfg.APIGroup,
+		APIVersion:      cfg.APIVersion,
+		ClusterKind:     cfg.ClusterKind,
+		MachineKind:     cfg.MachineKind,
+		TemplateKind:    cfg.TemplateKind,
+		MachinePoolKind: cfg.MachinePoolKind,
+		PoolKind:        cfg.PoolKind,
+		ReleaseVersion:  initialRelease,
+		ExtraKinds:      cfg.ExtraKinds,
+		WithWebhooks:    cfg.WithWebhooks,
+		WithCloudClient: cfg.WithCloudClient,
+		RenderCRDs:      cfg.RenderCRDs,
+		Kinds:           cfg.Kinds(),
 	}
 }
 
@@ -124,8 +245,181 @@ func writeFile(path, content string) error {
 	return os.WriteFile(path, []byte(content), 0644)
 }
 
+// fileAction is what scaffolding does to a file in the output directory.
+type fileAction string
+
+const (
+	actionCreate    fileAction = "create"
+	actionOverwrite fileAction = "overwrite"
+	actionUnchanged fileAction = "unchanged"
+	actionPreserve  fileAction = "preserve" // modified since last scaffold, left alone by update
+)
+
+var actionIcons = map[fileAction]string{
+	actionCreate:    "+",
+	actionOverwrite: "~",
+	actionUnchanged: "=",
+	actionPreserve:  "!",
+}
+
+// planFile compares rendered content with the file on disk.
+func planFile(path, content string) (fileAction, string) {
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		return actionCreate, ""
+	}
+	if string(existing) == content {
+		return actionUnchanged, string(existing)
+	}
+	return actionOverwrite, string(existing)
+}
+
+// toolVersion is recorded in .scaffold.yaml; bump it when templates change.
+const toolVersion = "v0.2.0"
+
+// manifestFile records how a scaffold was generated so update can regenerate it.
+const manifestFile = ".scaffold.yaml"
+
+type scaffoldManifest struct {
+	ToolVersion string            `yaml:"toolVersion"`
+	Config      providerConfig    `yaml:"config"`
+	Files       map[string]string `yaml:"files"` // path -> sha256 of the content as generated
+}
+
+func hashContent(content string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+}
+
+func loadManifest(dir string) (*scaffoldManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m scaffoldManifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", manifestFile, err)
+	}
+	if m.Config.Name == "" || m.Config.Type == "" {
+		return nil, fmt.Errorf("%s has no provider name/type", manifestFile)
+	}
+	m.Config.OutputDir = dir
+	return &m, nil
+}
+
+func writeManifest(dir string, m *scaffoldManifest) error {
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by scaffold-provider. Used by 'scaffold-provider update' to tell\n")
+	buf.WriteString("# generated files from edited ones; do not edit the hashes by hand.\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	enc.Close()
+	return writeFile(filepath.Join(dir, manifestFile), buf.String())
+}
+
+type diffOp struct {
+	kind byte // ' ', '-', '+'
+	line string
+	a, b int // positions in old and new before this op
+}
+
+// unifiedDiff returns a unified diff (3 lines of context) between oldText and newText.
+func unifiedDiff(path, oldText, newText string) string {
+	x := splitLines(oldText)
+	y := splitLines(newText)
+
+	// Longest common subsequence over suffixes
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			ops = append(ops, diffOp{' ', x[i], i, j})
+			i++
+			j++
+		case j >= len(y) || (i < len(x) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', x[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', y[j], i, j})
+			j++
+		}
+	}
+
+	const context = 3
+	var changes []int
+	for k, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, k)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", path, path)
+	for c := 0; c < len(changes); {
+		// Extend the hunk while the next change is within 2*context lines
+		last := c
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*context {
+			last++
+		}
+		start := max(changes[c]-context, 0)
+		end := min(changes[last]+context+1, len(ops))
+
+		oldCount, newCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		oldStart, newStart := ops[start].a+1, ops[start].b+1
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			sb.WriteByte('\n')
+		}
+		c = last + 1
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
 func renderTemplate(name, tmplStr string, data templateData) string {
-	t, err := template.New(name).Parse(tmplStr)
+	t, err := template.New(name).Funcs(template.FuncMap{"lower": strings.ToLower}).Parse(tmplStr)
 	if err != nil {
 		panic(fmt.Sprintf("template %s parse error: %v", name, err))
 	}
@@ -151,21 +445,39 @@ with {{.CapName}}.
 
 1. Initialize the management cluster:
 ` + "```bash" + `
-clusterctl init --{{.Type}} {{.Name}}
+clusterctl init --{{.ClusterctlPrefix}} {{.Name}}:{{.ReleaseVersion}}
 ` + "```" + `
 
+{{if .PoolKind -}}
+2. Create an IP pool and claim an address from it:
+` + "```bash" + `
+kubectl apply -f examples/ippool.yaml
+` + "```" + `
+{{- else -}}
 2. Create a workload cluster:
 ` + "```bash" + `
 kubectl apply -f templates/cluster-template.yaml
 ` + "```" + `
+{{- end}}
 
 ## API Reference
 
 | Kind | API Group | Description |
 |------|-----------|-------------|
+{{- if .PoolKind}}
+| {{.PoolKind}} | {{.APIGroup}} | Pool of addresses for IPAddressClaims |
+| IPAddressClaim | ipam.cluster.x-k8s.io | Request for an address (CAPI core) |
+| IPAddress | ipam.cluster.x-k8s.io | Allocated address (CAPI core) |
+{{- else}}
 | {{.ClusterKind}} | {{.APIGroup}} | Cluster-level configuration |
+{{- if ne .MachineKind .ClusterKind}}
 | {{.MachineKind}} | {{.APIGroup}} | Machine-level configuration |
+{{- end}}
 | {{.TemplateKind}} | {{.APIGroup}} | Reusable machine template |
+{{- end}}
+{{- if .MachinePoolKind}}
+| {{.MachinePoolKind}} | {{.APIGroup}} | Machine pool (MachinePool contract) |
+{{- end}}
 
 ## Development
 
@@ -174,6 +486,20 @@ make generate    # Generate code
 make manifests   # Generate CRD manifests
 make test        # Run tests
 make docker-build # Build container image
+make tilt-up     # Run against a local kind cluster with Tilt
+` + "```" + `
+
+## Release
+
+` + "`make release-manifests`" + ` writes ` + "`{{.ClusterctlPrefix}}-components.yaml`" + `, ` + "`metadata.yaml`" + ` and the
+cluster templates to ` + "`out/{{.ClusterctlPrefix}}-{{.Name}}/{{.ReleaseVersion}}/`" + `. To install that build with
+clusterctl, register it in ` + "`~/.cluster-api/clusterctl.yaml`" + `:
+
+` + "```yaml" + `
+providers:
+- name: {{.Name}}
+  type: {{.ClusterctlType}}
+  url: file://<path-to-repo>/out/{{.ClusterctlPrefix}}-{{.Name}}/{{.ReleaseVersion}}/{{.ClusterctlPrefix}}-components.yaml
 ` + "```" + `
 `
 
@@ -235,11 +561,11 @@ docker-push: ## Push docker image
 
 ##@ Deployment
 .PHONY: install
-install: manifests ## Install CRDs
+install: {{if not .RenderCRDs}}manifests {{end}}## Install CRDs
 	kubectl apply -f config/crd/bases/
 
 .PHONY: uninstall
-uninstall: manifests ## Uninstall CRDs
+uninstall: {{if not .RenderCRDs}}manifests {{end}}## Uninstall CRDs
 	kubectl delete -f config/crd/bases/
 
 .PHONY: deploy
@@ -250,6 +576,30 @@ deploy: manifests ## Deploy controller
 undeploy: ## Undeploy controller
 	kubectl delete -k config/default
 
+##@ Local development
+KIND_CLUSTER_NAME ?= capi-{{.Name}}
+
+.PHONY: kind-cluster
+kind-cluster: ## Create a kind management cluster with a local registry
+	go run ./hack/kind-with-registry --name $(KIND_CLUSTER_NAME)
+
+.PHONY: tilt-up
+tilt-up: kind-cluster ## Start the Tilt dev loop against the kind cluster
+	tilt up
+
+##@ Release
+RELEASE_TAG ?= {{.ReleaseVersion}}
+RELEASE_DIR ?= out/{{.ClusterctlPrefix}}-{{.Name}}/$(RELEASE_TAG)
+
+.PHONY: release-manifests
+release-manifests: manifests ## Assemble clusterctl release artifacts into $(RELEASE_DIR)
+	mkdir -p $(RELEASE_DIR)
+	kubectl kustomize config/release > $(RELEASE_DIR)/{{.ClusterctlPrefix}}-components.yaml
+	cp metadata.yaml $(RELEASE_DIR)/metadata.yaml
+{{- if not .PoolKind}}
+	cp templates/cluster-template*.yaml $(RELEASE_DIR)/
+{{- end}}
+
 ##@ Tools
 CONTROLLER_GEN = $(GOBIN)/controller-gen
 .PHONY: controller-gen
@@ -295,9 +645,15 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+{{- if .PoolKind}}
+	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
+{{- end}}
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+{{- if .WithWebhooks}}
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+{{- end}}
 
 	{{.APIVersion}} "{{.Module}}/api/{{.APIVersion}}"
 	"{{.Module}}/controllers"
@@ -311,16 +667,25 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must({{.APIVersion}}.AddToScheme(scheme))
+{{- if .PoolKind}}
+	utilruntime.Must(ipamv1.AddToScheme(scheme))
+{{- end}}
 }
 
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+{{- if .WithWebhooks}}
+	var webhookPort int
+{{- end}}
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address for metrics endpoint.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address for health probes.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election.")
+{{- if .WithWebhooks}}
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "The port the webhook server listens on.")
+{{- end}}
 
 	opts := zap.Options{Development: true}
 	opts.BindFlags(flag.CommandLine)
@@ -334,11 +699,24 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "{{.Name}}-provider-leader-election",
+{{- if .WithWebhooks}}
+		WebhookServer:          webhook.NewServer(webhook.Options{Port: webhookPort}),
+{{- end}}
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+{{- if .PoolKind}}
+
+	if err = (&controllers.IPAddressClaimReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "IPAddressClaim")
+		os.Exit(1)
+	}
+{{- else}}
 
 	if err = (&controllers.{{.ClusterKind}}Reconciler{
 		Client: mgr.GetClient(),
@@ -347,6 +725,7 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "{{.ClusterKind}}")
 		os.Exit(1)
 	}
+{{- if ne .MachineKind .ClusterKind}}
 
 	if err = (&controllers.{{.MachineKind}}Reconciler{
 		Client: mgr.GetClient(),
@@ -355,6 +734,30 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "{{.MachineKind}}")
 		os.Exit(1)
 	}
+{{- end}}
+{{- end}}
+{{- if .MachinePoolKind}}
+
+	if err = (&controllers.{{.MachinePoolKind}}Reconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "{{.MachinePoolKind}}")
+		os.Exit(1)
+	}
+{{- end}}
+{{- if .WithWebhooks}}
+
+	// Set ENABLE_WEBHOOKS=false to run the manager locally without certificates.
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+{{- range .Kinds}}
+		if err = (&{{$.APIVersion}}.{{.}}{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "{{.}}")
+			os.Exit(1)
+		}
+{{- end}}
+	}
+{{- end}}
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
@@ -376,6 +779,9 @@ func main() {
 const clusterTypeTmpl = `package {{.APIVersion}}
 
 import (
+{{- if .WithCloudClient}}
+	corev1 "k8s.io/api/core/v1"
+{{- end}}
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
@@ -385,6 +791,13 @@ type {{.ClusterKind}}Spec struct {
 	// ControlPlaneEndpoint represents the endpoint for the cluster control plane.
 	// +optional
 	ControlPlaneEndpoint clusterv1.APIEndpoint ` + "`" + `json:"controlPlaneEndpoint,omitempty"` + "`" + `
+{{- if .WithCloudClient}}
+
+	// CredentialsRef references the Secret holding the {{.CapName}} API credentials.
+	// Defaults to <name>-credentials in the same namespace.
+	// +optional
+	CredentialsRef *corev1.SecretReference ` + "`" + `json:"credentialsRef,omitempty"` + "`" + `
+{{- end}}
 
 	// TODO: Add provider-specific fields here
 }
@@ -751,6 +1164,12 @@ resources:
 - ../crd
 - ../rbac
 - ../manager
+{{- if .WithWebhooks}}
+- ../webhook
+
+patches:
+- path: manager_webhook_patch.yaml
+{{- end}}
 
 namePrefix: {{.Name}}-
 `
@@ -834,7 +1253,7 @@ rules:
   resources: ["*"]
   verbs: ["get", "list", "watch", "create", "update", "patch", "delete"]
 - apiGroups: ["cluster.x-k8s.io"]
-  resources: ["clusters", "machines"]
+  resources: ["clusters", "machines"{{if .MachinePoolKind}}, "machinepools"{{end}}]
   verbs: ["get", "list", "watch"]
 - apiGroups: [""]
   resources: ["secrets"]
@@ -858,8 +1277,11 @@ subjects:
 const crdKustomizeTmpl = `apiVersion: kustomize.config.k8s.io/v1beta1
 kind: Kustomization
 
+# CRD bases generated by "make manifests" (controller-gen names them <group>_<plural>.yaml).
 resources:
-- bases/
+{{- range .Kinds}}
+- bases/{{$.APIGroup}}_{{lower .}}s.yaml
+{{- end}}
 `
 
 const boilerplateTmpl = `/*
@@ -919,108 +1341,2164 @@ spec:
         kubeletExtraArgs: {}
 `
 
-func scaffold(cfg *providerConfig) {
-	data := newTemplateData(cfg)
-	dir := cfg.OutputDir
+const tiltfileTmpl = `# -*- mode: Python -*-
+# Local development loop against a kind management cluster (see "make tilt-up").
 
-	// Files to generate
-	files := map[string]string{
-		"README.md":                               renderTemplate("readme", readmeTmpl, data),
-		"Makefile":                                 renderTemplate("makefile", makefileTmpl, data),
-		"Dockerfile":                               renderTemplate("dockerfile", dockerfileTmpl, data),
-		"go.mod":                                   renderTemplate("go.mod", goModTmpl, data),
-		"main.go":                                  renderTemplate("main.go", mainGoTmpl, data),
-		"api/" + cfg.APIVersion + "/groupversion_info.go":   renderTemplate("gv", groupVersionInfoTmpl, data),
-		"api/" + cfg.APIVersion + "/cluster_types.go":       renderTemplate("cluster_types", clusterTypeTmpl, data),
-		"api/" + cfg.APIVersion + "/machine_types.go":       renderTemplate("machine_types", machineTypeTmpl, data),
-		"api/" + cfg.APIVersion + "/template_types.go":      renderTemplate("template_types", templateTypeTmpl, data),
-		"controllers/cluster_controller.go":         renderTemplate("cluster_ctrl", clusterControllerTmpl, data),
-		"controllers/machine_controller.go":         renderTemplate("machine_ctrl", machineControllerTmpl, data),
-		"config/default/kustomization.yaml":         renderTemplate("kustomize", kustomizationTmpl, data),
-		"config/manager/kustomization.yaml":         renderTemplate("mgr_kust", managerKustomizeTmpl, data),
-		"config/manager/manager.yaml":               renderTemplate("mgr_deploy", managerDeploymentTmpl, data),
-		"config/rbac/kustomization.yaml":            renderTemplate("rbac_kust", rbacKustomizeTmpl, data),
-		"config/rbac/service_account.yaml":           renderTemplate("sa", serviceAccountTmpl, data),
-		"config/rbac/role.yaml":                     renderTemplate("role", clusterRoleTmpl, data),
-		"config/rbac/role_binding.yaml":              renderTemplate("role_binding", clusterRoleBindingTmpl, data),
-		"config/crd/kustomization.yaml":             renderTemplate("crd_kust", crdKustomizeTmpl, data),
-		"hack/boilerplate.go.txt":                   renderTemplate("boilerplate", boilerplateTmpl, data),
-		"templates/cluster-template.yaml":           renderTemplate("cluster_tmpl", clusterTemplateTmpl, data),
+settings = {
+    "kind_cluster_name": "capi-{{.Name}}",
+    "default_registry": "localhost:5001",
+    "capi_version": "v1.6.0",
+    "extra_args": [],
+}
+
+# Local overrides, see tilt-settings.example.json
+settings.update(read_json("tilt-settings.json", default = {}))
+
+allow_k8s_contexts("kind-" + settings.get("kind_cluster_name"))
+default_registry(settings.get("default_registry"))
+
+load("ext://restart_process", "docker_build_with_restart")
+
+# Install CAPI core{{if eq .Type "infrastructure"}} and the kubeadm bootstrap/control plane providers{{end}} (and cert-manager)
+local_resource(
+    "capi",
+    cmd = "clusterctl init --core cluster-api:{v}{{if eq .Type "infrastructure"}} --bootstrap kubeadm:{v} --control-plane kubeadm:{v}{{end}} || true".format(v = settings.get("capi_version")),
+{{- if .MachinePoolKind}}
+    env = {"EXP_MACHINE_POOL": "true"},
+{{- end}}
+    labels = ["capi"],
+)
+
+local_resource(
+    "manager-binary",
+    cmd = "mkdir -p .tiltbuild && CGO_ENABLED=0 GOOS=linux go build -o .tiltbuild/manager main.go",
+    deps = ["main.go", "go.mod", "go.sum", "api", "controllers"{{if .WithCloudClient}}, "pkg"{{end}}],
+    labels = ["{{.Name}}"],
+)
+
+docker_build_with_restart(
+    "controller",
+    context = ".tiltbuild",
+    dockerfile_contents = """FROM gcr.io/distroless/static:nonroot
+WORKDIR /
+COPY manager /manager
+USER 65532:65532
+""",
+    entrypoint = ["/manager", "--leader-elect"] + settings.get("extra_args"),
+    only = ["manager"],
+    live_update = [sync(".tiltbuild/manager", "/manager")],
+)
+
+k8s_yaml(kustomize("config/default"))
+
+k8s_resource(
+    workload = "{{.Name}}-controller-manager",
+    resource_deps = ["capi", "manager-binary"],
+    labels = ["{{.Name}}"],
+)
+`
+
+const tiltSettingsTmpl = `{
+  "kind_cluster_name": "capi-{{.Name}}",
+  "default_registry": "localhost:5001",
+  "capi_version": "v1.6.0",
+  "extra_args": ["--v=4"]
+}
+`
+
+const kindWithRegistryTmpl = `// kind-with-registry creates a kind management cluster wired to a local
+// image registry, so Tilt can push controller images without a remote registry.
+//
+// Usage:
+//
+//	go run ./hack/kind-with-registry [--name capi-{{.Name}}] [--registry-port 5001]
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const registryName = "kind-registry"
+
+func run(stdin string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
 	}
+	err := cmd.Run()
+	return strings.TrimSpace(out.String()), err
+}
 
-	created := 0
-	for relPath, content := range files {
-		fullPath := filepath.Join(dir, relPath)
-		if err := writeFile(fullPath, content); err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", relPath, err)
-			continue
+func ensureRegistry(port int) error {
+	running, _ := run("", "docker", "ps", "-q", "--filter", "name=^"+registryName+"$")
+	if running != "" {
+		fmt.Printf("Registry %s already running\n", registryName)
+		return nil
+	}
+	fmt.Printf("Starting registry %s on localhost:%d\n", registryName, port)
+	_, err := run("", "docker", "run", "-d", "--restart=always",
+		"-p", fmt.Sprintf("127.0.0.1:%d:5000", port), "--name", registryName, "registry:2")
+	return err
+}
+
+func ensureCluster(name string, port int) error {
+	clusters, err := run("", "kind", "get", "clusters")
+	if err != nil {
+		return err
+	}
+	for _, c := range strings.Fields(clusters) {
+		if c == name {
+			fmt.Printf("kind cluster %s already exists\n", name)
+			return nil
 		}
-		created++
 	}
 
-	fmt.Printf("\n✅ Provider scaffold created: %s\n", dir)
-	fmt.Printf("   Files created: %d\n", created)
-	fmt.Printf("   Module: %s\n", cfg.Module)
-	fmt.Printf("   API Group: %s\n", cfg.APIGroup)
-	fmt.Printf("   Types: %s, %s, %s\n", cfg.ClusterKind, cfg.MachineKind, cfg.TemplateKind)
+	config := fmt.Sprintf(` + "`" + `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+containerdConfigPatches:
+- |-
+  [plugins."io.containerd.grpc.v1.cri".registry.mirrors."localhost:%d"]
+    endpoint = ["http://%s:5000"]
+` + "`" + `, port, registryName)
+	fmt.Printf("Creating kind cluster %s\n", name)
+	_, err = run(config, "kind", "create", "cluster", "--name", name, "--config", "-")
+	return err
+}
 
-	fmt.Println("\nNext steps:")
-	fmt.Println("  1. cd", dir)
-	fmt.Println("  2. go mod tidy")
-	fmt.Println("  3. make generate  # Generate DeepCopy methods")
-	fmt.Println("  4. make manifests # Generate CRD YAML")
-	fmt.Println("  5. Implement TODO sections in controllers/")
+func connectRegistry() {
+	// Fails harmlessly when the registry is already connected
+	run("", "docker", "network", "connect", "kind", registryName)
+}
+
+func documentRegistry(name string, port int) error {
+	configMap := fmt.Sprintf(` + "`" + `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: local-registry-hosting
+  namespace: kube-public
+data:
+  localRegistryHosting.v1: |
+    host: "localhost:%d"
+    help: "https://kind.sigs.k8s.io/docs/user/local-registry/"
+` + "`" + `, port)
+	_, err := run(configMap, "kubectl", "--context", "kind-"+name, "apply", "-f", "-")
+	return err
 }
 
 func main() {
-	name := flag.String("n", "", "Provider name (e.g., 'mycloud')")
-	provType := flag.String("t", "infrastructure", "Provider type: infrastructure, bootstrap, controlplane")
-	module := flag.String("module", "", "Go module path (default: auto-generated)")
-	outputDir := flag.String("output-dir", "", "Output directory (default: auto-generated)")
-	apiVersion := flag.String("api-version", "v1beta1", "API version")
+	name := flag.String("name", "capi-{{.Name}}", "kind cluster name")
+	port := flag.Int("registry-port", 5001, "Host port of the local registry")
+	flag.Parse()
 
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "CAPI Provider Scaffolding Tool\nUsage: %s [flags]\n\nFlags:\n", os.Args[0])
-		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nExamples:\n")
-		fmt.Fprintf(os.Stderr, "  %s -n mycloud -t infrastructure\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -n mycloud -t bootstrap --module github.com/org/capi-bootstrap-mycloud\n", os.Args[0])
+	for _, tool := range []string{"docker", "kind", "kubectl"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s not found in PATH\n", tool)
+			os.Exit(1)
+		}
 	}
-	flag.Parse()
 
-	if *name == "" {
-		fmt.Fprintln(os.Stderr, "Error: -n (provider name) is required")
-		flag.Usage()
+	if err := ensureRegistry(*port); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: starting registry: %v\n", err)
 		os.Exit(1)
 	}
-
-	validTypes := map[string]bool{"infrastructure": true, "bootstrap": true, "controlplane": true}
-	if !validTypes[*provType] {
-		fmt.Fprintf(os.Stderr, "Error: invalid provider type: %s\n", *provType)
+	if err := ensureCluster(*name, *port); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: creating kind cluster: %v\n", err)
+		os.Exit(1)
+	}
+	connectRegistry()
+	if err := documentRegistry(*name, *port); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: publishing registry config: %v\n", err)
 		os.Exit(1)
 	}
 
-	cfg := defaultConfig(*name, *provType)
-	cfg.APIVersion = *apiVersion
+	fmt.Printf("kind cluster %s ready, push images to localhost:%d\n", *name, *port)
+}
+`
 
-	if *module != "" {
-		cfg.Module = *module
-	}
+const metadataTmpl = `# clusterctl uses this file to map provider release series to CAPI contracts.
+apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3
+kind: Metadata
+releaseSeries:
+- major: 0
+  minor: 1
+  contract: v1beta1
+`
 
-	if *outputDir != "" {
-		cfg.OutputDir = *outputDir
-	} else {
-		var prefix string
-		switch *provType {
-		case "infrastructure":
-			prefix = "cluster-api-provider-"
-		case "bootstrap":
-			prefix = "cluster-api-bootstrap-provider-"
-		case "controlplane":
-			prefix = "cluster-api-controlplane-provider-"
-		}
-		cfg.OutputDir = prefix + *name
+const clusterctlSettingsTmpl = `{
+  "name": "{{.ClusterctlPrefix}}-{{.Name}}",
+  "config": {
+    "componentsFile": "{{.ClusterctlPrefix}}-components.yaml",
+    "nextVersion": "{{.ReleaseVersion}}"
+  }
+}
+`
+
+const releaseKustomizeTmpl = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- ../default
+
+images:
+- name: controller
+  newName: {{.Image}}
+  newTag: {{.ReleaseVersion}}
+
+labels:
+- pairs:
+    cluster.x-k8s.io/provider: {{.ClusterctlPrefix}}-{{.Name}}
+  includeSelectors: false
+`
+
+const machinePoolTypeTmpl = `package {{.APIVersion}}
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// {{.MachinePoolKind}}Spec defines the desired state of {{.MachinePoolKind}}.
+type {{.MachinePoolKind}}Spec struct {
+	// ProviderID is the identification ID of the pool (e.g. instance group ID).
+	// +optional
+	ProviderID string ` + "`" + `json:"providerID,omitempty"` + "`" + `
+
+	// ProviderIDList are the identification IDs of the instances backing the pool.
+	// +optional
+	ProviderIDList []string ` + "`" + `json:"providerIDList,omitempty"` + "`" + `
+
+	// Template describes the instances created by the pool.
+	Template {{.MachineKind}}Spec ` + "`" + `json:"template"` + "`" + `
+
+	// TODO: Add provider-specific fields here
+}
+
+// {{.MachinePoolKind}}Status defines the observed state of {{.MachinePoolKind}}.
+type {{.MachinePoolKind}}Status struct {
+	// Ready denotes that the machine pool infrastructure is ready.
+	// +optional
+	Ready bool ` + "`" + `json:"ready"` + "`" + `
+
+	// Replicas is the most recently observed number of replicas.
+	// +optional
+	Replicas int32 ` + "`" + `json:"replicas"` + "`" + `
+
+	// FailureReason indicates a fatal error on the machine pool.
+	// +optional
+	FailureReason *string ` + "`" + `json:"failureReason,omitempty"` + "`" + `
+
+	// FailureMessage describes the FailureReason.
+	// +optional
+	FailureMessage *string ` + "`" + `json:"failureMessage,omitempty"` + "`" + `
+
+	// Conditions defines current service state.
+	// +optional
+	Conditions clusterv1.Conditions ` + "`" + `json:"conditions,omitempty"` + "`" + `
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready"
+// +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas"
+
+// {{.MachinePoolKind}} is the Schema for the {{.Name}} machine pool API.
+type {{.MachinePoolKind}} struct {
+	metav1.TypeMeta   ` + "`" + `json:",inline"` + "`" + `
+	metav1.ObjectMeta ` + "`" + `json:"metadata,omitempty"` + "`" + `
+
+	Spec   {{.MachinePoolKind}}Spec   ` + "`" + `json:"spec,omitempty"` + "`" + `
+	Status {{.MachinePoolKind}}Status ` + "`" + `json:"status,omitempty"` + "`" + `
+}
+
+// +kubebuilder:object:root=true
+
+// {{.MachinePoolKind}}List contains a list of {{.MachinePoolKind}}.
+type {{.MachinePoolKind}}List struct {
+	metav1.TypeMeta ` + "`" + `json:",inline"` + "`" + `
+	metav1.ListMeta ` + "`" + `json:"metadata,omitempty"` + "`" + `
+	Items           []{{.MachinePoolKind}} ` + "`" + `json:"items"` + "`" + `
+}
+
+func init() {
+	SchemeBuilder.Register(&{{.MachinePoolKind}}{}, &{{.MachinePoolKind}}List{})
+}
+`
+
+const machinePoolControllerTmpl = `package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	exputil "sigs.k8s.io/cluster-api/exp/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	{{.APIVersion}} "{{.Module}}/api/{{.APIVersion}}"
+)
+
+// {{.MachinePoolKind}}Reconciler reconciles a {{.MachinePoolKind}} object.
+type {{.MachinePoolKind}}Reconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups={{.APIGroup}},resources={{lower .MachinePoolKind}}s,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups={{.APIGroup}},resources={{lower .MachinePoolKind}}s/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinepools;machinepools/status,verbs=get;list;watch
+
+func (r *{{.MachinePoolKind}}Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// Fetch the {{.MachinePoolKind}} instance
+	{{.Name}}MachinePool := &{{.APIVersion}}.{{.MachinePoolKind}}{}
+	if err := r.Get(ctx, req.NamespacedName, {{.Name}}MachinePool); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Wait for the owning MachinePool to set the owner reference
+	machinePool, err := exputil.GetOwnerMachinePool(ctx, r.Client, {{.Name}}MachinePool.ObjectMeta)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if machinePool == nil {
+		log.Info("Waiting for MachinePool controller to set OwnerRef on {{.MachinePoolKind}}")
+		return ctrl.Result{}, nil
+	}
+
+	log.Info("Reconciling {{.MachinePoolKind}}", "name", {{.Name}}MachinePool.Name, "machinePool", machinePool.Name)
+
+	// Add finalizer
+	if !controllerutil.ContainsFinalizer({{.Name}}MachinePool, "{{.APIGroup}}/machinepool") {
+		controllerutil.AddFinalizer({{.Name}}MachinePool, "{{.APIGroup}}/machinepool")
+		if err := r.Update(ctx, {{.Name}}MachinePool); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Handle deletion
+	if !{{.Name}}MachinePool.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, {{.Name}}MachinePool)
+	}
+
+	return r.reconcileNormal(ctx, machinePool, {{.Name}}MachinePool)
+}
+
+func (r *{{.MachinePoolKind}}Reconciler) reconcileNormal(ctx context.Context, machinePool *expv1.MachinePool, pool *{{.APIVersion}}.{{.MachinePoolKind}}) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.Info("Reconciling {{.MachinePoolKind}} (normal)")
+
+	// Bootstrap data must be available before instances can be created
+	if machinePool.Spec.Template.Spec.Bootstrap.DataSecretName == nil {
+		log.Info("Waiting for bootstrap data to be available")
+		return ctrl.Result{}, nil
+	}
+
+	// TODO: Implement provider-specific machine pool logic
+	// 1. Create/ensure the instance group with *machinePool.Spec.Replicas instances
+	// 2. Set Spec.ProviderID and Spec.ProviderIDList from the running instances
+	// 3. Report Status.Replicas and mark as ready
+
+	if machinePool.Spec.Replicas != nil {
+		pool.Status.Replicas = *machinePool.Spec.Replicas
+	}
+	pool.Status.Ready = true
+	if err := r.Status().Update(ctx, pool); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *{{.MachinePoolKind}}Reconciler) reconcileDelete(ctx context.Context, pool *{{.APIVersion}}.{{.MachinePoolKind}}) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.Info("Reconciling {{.MachinePoolKind}} (delete)")
+
+	// TODO: Implement provider-specific instance group deletion logic
+
+	controllerutil.RemoveFinalizer(pool, "{{.APIGroup}}/machinepool")
+	if err := r.Update(ctx, pool); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *{{.MachinePoolKind}}Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&{{.APIVersion}}.{{.MachinePoolKind}}{}).
+		Complete(r)
+}
+`
+
+const machinePoolTemplateTmpl = `apiVersion: cluster.x-k8s.io/v1beta1
+kind: MachinePool
+metadata:
+  name: ${CLUSTER_NAME}-mp-0
+  namespace: ${NAMESPACE}
+spec:
+  clusterName: ${CLUSTER_NAME}
+  replicas: ${WORKER_MACHINE_COUNT}
+  template:
+    spec:
+      clusterName: ${CLUSTER_NAME}
+      version: ${KUBERNETES_VERSION}
+      bootstrap:
+        configRef:
+          apiVersion: bootstrap.cluster.x-k8s.io/v1beta1
+          kind: KubeadmConfig
+          name: ${CLUSTER_NAME}-mp-0
+      infrastructureRef:
+        apiVersion: {{.APIGroup}}/{{.APIVersion}}
+        kind: {{.MachinePoolKind}}
+        name: ${CLUSTER_NAME}-mp-0
+---
+apiVersion: {{.APIGroup}}/{{.APIVersion}}
+kind: {{.MachinePoolKind}}
+metadata:
+  name: ${CLUSTER_NAME}-mp-0
+  namespace: ${NAMESPACE}
+spec:
+  template: {}
+---
+apiVersion: bootstrap.cluster.x-k8s.io/v1beta1
+kind: KubeadmConfig
+metadata:
+  name: ${CLUSTER_NAME}-mp-0
+  namespace: ${NAMESPACE}
+spec:
+  joinConfiguration:
+    nodeRegistration:
+      kubeletExtraArgs: {}
+`
+
+const ipPoolTypeTmpl = `package {{.APIVersion}}
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// {{.PoolKind}}Spec defines the desired state of {{.PoolKind}}.
+type {{.PoolKind}}Spec struct {
+	// Addresses is the list of IP addresses available for allocation.
+	// +kubebuilder:validation:MinItems=1
+	Addresses []string ` + "`" + `json:"addresses"` + "`" + `
+
+	// Prefix is the network prefix length of the allocated addresses.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=128
+	Prefix int ` + "`" + `json:"prefix"` + "`" + `
+
+	// Gateway is the gateway address handed out with allocated addresses.
+	// +optional
+	Gateway string ` + "`" + `json:"gateway,omitempty"` + "`" + `
+
+	// TODO: Add provider-specific fields here (e.g. CIDR ranges, excluded addresses)
+}
+
+// {{.PoolKind}}Status defines the observed state of {{.PoolKind}}.
+type {{.PoolKind}}Status struct {
+	// Total is the number of addresses in the pool.
+	// +optional
+	Total int ` + "`" + `json:"total"` + "`" + `
+
+	// Used is the number of allocated addresses.
+	// +optional
+	Used int ` + "`" + `json:"used"` + "`" + `
+
+	// Free is the number of addresses still available.
+	// +optional
+	Free int ` + "`" + `json:"free"` + "`" + `
+
+	// Conditions defines current service state.
+	// +optional
+	Conditions clusterv1.Conditions ` + "`" + `json:"conditions,omitempty"` + "`" + `
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Total",type="integer",JSONPath=".status.total"
+// +kubebuilder:printcolumn:name="Free",type="integer",JSONPath=".status.free"
+// +kubebuilder:printcolumn:name="Used",type="integer",JSONPath=".status.used"
+
+// {{.PoolKind}} is the Schema for the {{.Name}} IP pool API.
+type {{.PoolKind}} struct {
+	metav1.TypeMeta   ` + "`" + `json:",inline"` + "`" + `
+	metav1.ObjectMeta ` + "`" + `json:"metadata,omitempty"` + "`" + `
+
+	Spec   {{.PoolKind}}Spec   ` + "`" + `json:"spec,omitempty"` + "`" + `
+	Status {{.PoolKind}}Status ` + "`" + `json:"status,omitempty"` + "`" + `
+}
+
+// +kubebuilder:object:root=true
+
+// {{.PoolKind}}List contains a list of {{.PoolKind}}.
+type {{.PoolKind}}List struct {
+	metav1.TypeMeta ` + "`" + `json:",inline"` + "`" + `
+	metav1.ListMeta ` + "`" + `json:"metadata,omitempty"` + "`" + `
+	Items           []{{.PoolKind}} ` + "`" + `json:"items"` + "`" + `
+}
+
+func init() {
+	SchemeBuilder.Register(&{{.PoolKind}}{}, &{{.PoolKind}}List{})
+}
+`
+
+const ipClaimControllerTmpl = `package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	{{.APIVersion}} "{{.Module}}/api/{{.APIVersion}}"
+)
+
+// IPAddressClaimReconciler allocates IPAddresses from {{.PoolKind}}s for
+// IPAddressClaims that reference them.
+type IPAddressClaimReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=ipam.cluster.x-k8s.io,resources=ipaddressclaims,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=ipam.cluster.x-k8s.io,resources=ipaddressclaims/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=ipam.cluster.x-k8s.io,resources=ipaddresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups={{.APIGroup}},resources={{lower .PoolKind}}s,verbs=get;list;watch
+// +kubebuilder:rbac:groups={{.APIGroup}},resources={{lower .PoolKind}}s/status,verbs=get;update;patch
+
+func (r *IPAddressClaimReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// Fetch the IPAddressClaim instance
+	claim := &ipamv1.IPAddressClaim{}
+	if err := r.Get(ctx, req.NamespacedName, claim); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Only handle claims for our pool kind
+	ref := claim.Spec.PoolRef
+	if ref.APIGroup == nil || *ref.APIGroup != {{.APIVersion}}.GroupVersion.Group || ref.Kind != "{{.PoolKind}}" {
+		return ctrl.Result{}, nil
+	}
+
+	log.Info("Reconciling IPAddressClaim", "name", claim.Name, "pool", ref.Name)
+
+	// Handle deletion
+	if !claim.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, claim)
+	}
+
+	// Add finalizer
+	if !controllerutil.ContainsFinalizer(claim, "{{.APIGroup}}/ip-claim-protection") {
+		controllerutil.AddFinalizer(claim, "{{.APIGroup}}/ip-claim-protection")
+		if err := r.Update(ctx, claim); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	pool := &{{.APIVersion}}.{{.PoolKind}}{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: claim.Namespace, Name: ref.Name}, pool); err != nil {
+		return ctrl.Result{}, fmt.Errorf("fetching pool %s: %w", ref.Name, err)
+	}
+
+	return r.reconcileNormal(ctx, claim, pool)
+}
+
+func (r *IPAddressClaimReconciler) reconcileNormal(ctx context.Context, claim *ipamv1.IPAddressClaim, pool *{{.APIVersion}}.{{.PoolKind}}) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if claim.Status.AddressRef.Name != "" {
+		return ctrl.Result{}, nil
+	}
+
+	addresses, err := r.poolAddresses(ctx, pool)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	used := map[string]bool{}
+	for _, a := range addresses {
+		used[a.Spec.Address] = true
+	}
+
+	// TODO: Replace with provider-specific allocation (e.g. call an external IPAM API)
+	var free string
+	for _, a := range pool.Spec.Addresses {
+		if !used[a] {
+			free = a
+			break
+		}
+	}
+	if free == "" {
+		return ctrl.Result{}, fmt.Errorf("pool %s has no free addresses", pool.Name)
+	}
+
+	address := &ipamv1.IPAddress{
+		ObjectMeta: metav1.ObjectMeta{Name: claim.Name, Namespace: claim.Namespace},
+		Spec: ipamv1.IPAddressSpec{
+			ClaimRef: corev1.LocalObjectReference{Name: claim.Name},
+			PoolRef:  claim.Spec.PoolRef,
+			Address:  free,
+			Prefix:   pool.Spec.Prefix,
+			Gateway:  pool.Spec.Gateway,
+		},
+	}
+	if err := controllerutil.SetControllerReference(claim, address, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, address); err != nil && !apierrors.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+	log.Info("Allocated address", "address", free)
+
+	claim.Status.AddressRef = corev1.LocalObjectReference{Name: address.Name}
+	if err := r.Status().Update(ctx, claim); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	pool.Status.Total = len(pool.Spec.Addresses)
+	pool.Status.Used = len(addresses) + 1
+	pool.Status.Free = pool.Status.Total - pool.Status.Used
+	if err := r.Status().Update(ctx, pool); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *IPAddressClaimReconciler) reconcileDelete(ctx context.Context, claim *ipamv1.IPAddressClaim) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.Info("Releasing address for IPAddressClaim", "name", claim.Name)
+
+	address := &ipamv1.IPAddress{ObjectMeta: metav1.ObjectMeta{Name: claim.Name, Namespace: claim.Namespace}}
+	if err := r.Delete(ctx, address); err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	controllerutil.RemoveFinalizer(claim, "{{.APIGroup}}/ip-claim-protection")
+	if err := r.Update(ctx, claim); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// poolAddresses returns the IPAddresses allocated from pool.
+func (r *IPAddressClaimReconciler) poolAddresses(ctx context.Context, pool *{{.APIVersion}}.{{.PoolKind}}) ([]ipamv1.IPAddress, error) {
+	list := &ipamv1.IPAddressList{}
+	if err := r.List(ctx, list, client.InNamespace(pool.Namespace)); err != nil {
+		return nil, err
+	}
+	var addresses []ipamv1.IPAddress
+	for _, a := range list.Items {
+		ref := a.Spec.PoolRef
+		if ref.APIGroup != nil && *ref.APIGroup == {{.APIVersion}}.GroupVersion.Group && ref.Kind == "{{.PoolKind}}" && ref.Name == pool.Name {
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses, nil
+}
+
+func (r *IPAddressClaimReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ipamv1.IPAddressClaim{}).
+		Owns(&ipamv1.IPAddress{}).
+		Complete(r)
+}
+`
+
+const ipPoolExampleTmpl = `apiVersion: {{.APIGroup}}/{{.APIVersion}}
+kind: {{.PoolKind}}
+metadata:
+  name: ${CLUSTER_NAME}-pool
+  namespace: ${NAMESPACE}
+spec:
+  addresses:
+  - 10.0.0.10
+  - 10.0.0.11
+  - 10.0.0.12
+  prefix: 24
+  gateway: 10.0.0.1
+---
+# Claims are normally created by infrastructure providers for their machines.
+apiVersion: ipam.cluster.x-k8s.io/v1beta1
+kind: IPAddressClaim
+metadata:
+  name: ${CLUSTER_NAME}-example
+  namespace: ${NAMESPACE}
+spec:
+  poolRef:
+    apiGroup: {{.APIGroup}}
+    kind: {{.PoolKind}}
+    name: ${CLUSTER_NAME}-pool
+`
+
+const cloudInterfacesTmpl = `// Package cloud contains the client used by the controllers to talk to the
+// {{.CapName}} API. Controllers only depend on the Client interface, so tests
+// can substitute the in-memory implementation from pkg/cloud/fake.
+package cloud
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when a cloud resource does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Client is the interface to the {{.CapName}} API used by the controllers.
+type Client interface {
+	// CreateInstance creates an instance and returns it.
+	CreateInstance(ctx context.Context, spec InstanceSpec) (*Instance, error)
+	// GetInstance returns the instance with the given ID, or ErrNotFound.
+	GetInstance(ctx context.Context, id string) (*Instance, error)
+	// DeleteInstance deletes an instance; deleting a missing instance is not an error.
+	DeleteInstance(ctx context.Context, id string) error
+	// EnsureLoadBalancer creates or returns the API server load balancer of a cluster.
+	EnsureLoadBalancer(ctx context.Context, name string) (*LoadBalancer, error)
+	// DeleteLoadBalancer deletes a load balancer; deleting a missing one is not an error.
+	DeleteLoadBalancer(ctx context.Context, name string) error
+}
+
+// InstanceSpec describes an instance to create.
+type InstanceSpec struct {
+	Name        string
+	ClusterName string
+	UserData    []byte
+	Labels      map[string]string
+}
+
+// InstanceState is the lifecycle state of an instance.
+type InstanceState string
+
+const (
+	InstanceStatePending    InstanceState = "pending"
+	InstanceStateRunning    InstanceState = "running"
+	InstanceStateTerminated InstanceState = "terminated"
+)
+
+// Instance is a compute instance backing a {{.MachineKind}}.
+type Instance struct {
+	ID        string
+	Name      string
+	State     InstanceState
+	Addresses []string
+}
+
+// LoadBalancer fronts the API servers of a cluster.
+type LoadBalancer struct {
+	Name string
+	Host string
+	Port int32
+}
+`
+
+const cloudCredentialsTmpl = `package cloud
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Keys read from the credentials Secret.
+const (
+	EndpointKey  = "endpoint"
+	RegionKey    = "region"
+	AccessKeyKey = "accessKey"
+	SecretKeyKey = "secretKey"
+)
+
+// Credentials holds what is needed to authenticate against the {{.CapName}} API.
+type Credentials struct {
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// CredentialsFromSecret loads Credentials from the Secret identified by key.
+func CredentialsFromSecret(ctx context.Context, c client.Reader, key client.ObjectKey) (*Credentials, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, key, secret); err != nil {
+		return nil, fmt.Errorf("getting credentials secret %s: %w", key, err)
+	}
+
+	creds := &Credentials{
+		Endpoint:  string(secret.Data[EndpointKey]),
+		Region:    string(secret.Data[RegionKey]),
+		AccessKey: string(secret.Data[AccessKeyKey]),
+		SecretKey: string(secret.Data[SecretKeyKey]),
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return nil, fmt.Errorf("credentials secret %s must set %q and %q", key, AccessKeyKey, SecretKeyKey)
+	}
+	return creds, nil
+}
+`
+
+const cloudClientTmpl = `package cloud
+
+import (
+	"context"
+	"errors"
+)
+
+// errNotImplemented is returned until the SDK calls are filled in.
+var errNotImplemented = errors.New("{{.Name}} cloud client: not implemented")
+
+// sdkClient implements Client on top of the {{.CapName}} SDK.
+type sdkClient struct {
+	creds *Credentials
+	// TODO: Add the SDK client(s) here
+}
+
+// NewClient returns a Client authenticated with creds.
+func NewClient(creds *Credentials) (Client, error) {
+	// TODO: Construct the {{.CapName}} SDK client from creds
+	return &sdkClient{creds: creds}, nil
+}
+
+func (c *sdkClient) CreateInstance(ctx context.Context, spec InstanceSpec) (*Instance, error) {
+	return nil, errNotImplemented
+}
+
+func (c *sdkClient) GetInstance(ctx context.Context, id string) (*Instance, error) {
+	return nil, errNotImplemented
+}
+
+func (c *sdkClient) DeleteInstance(ctx context.Context, id string) error {
+	return errNotImplemented
+}
+
+func (c *sdkClient) EnsureLoadBalancer(ctx context.Context, name string) (*LoadBalancer, error) {
+	return nil, errNotImplemented
+}
+
+func (c *sdkClient) DeleteLoadBalancer(ctx context.Context, name string) error {
+	return errNotImplemented
+}
+`
+
+const cloudFakeTmpl = `// Package fake provides an in-memory cloud.Client for tests.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"{{.Module}}/pkg/cloud"
+)
+
+// Client is an in-memory cloud.Client. Instances start in the running state.
+type Client struct {
+	mu            sync.Mutex
+	nextID        int
+	Instances     map[string]*cloud.Instance
+	LoadBalancers map[string]*cloud.LoadBalancer
+}
+
+var _ cloud.Client = &Client{}
+
+// NewClient returns an empty fake Client.
+func NewClient() *Client {
+	return &Client{
+		Instances:     map[string]*cloud.Instance{},
+		LoadBalancers: map[string]*cloud.LoadBalancer{},
+	}
+}
+
+func (c *Client) CreateInstance(_ context.Context, spec cloud.InstanceSpec) (*cloud.Instance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	instance := &cloud.Instance{
+		ID:        fmt.Sprintf("i-%05d", c.nextID),
+		Name:      spec.Name,
+		State:     cloud.InstanceStateRunning,
+		Addresses: []string{fmt.Sprintf("10.0.%d.%d", c.nextID/250, c.nextID%250+1)},
+	}
+	c.Instances[instance.ID] = instance
+	return instance, nil
+}
+
+func (c *Client) GetInstance(_ context.Context, id string) (*cloud.Instance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	instance, ok := c.Instances[id]
+	if !ok {
+		return nil, cloud.ErrNotFound
+	}
+	return instance, nil
+}
+
+func (c *Client) DeleteInstance(_ context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.Instances, id)
+	return nil
+}
+
+func (c *Client) EnsureLoadBalancer(_ context.Context, name string) (*cloud.LoadBalancer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if lb, ok := c.LoadBalancers[name]; ok {
+		return lb, nil
+	}
+	lb := &cloud.LoadBalancer{Name: name, Host: name + ".lb.example.com", Port: 6443}
+	c.LoadBalancers[name] = lb
+	return lb, nil
+}
+
+func (c *Client) DeleteLoadBalancer(_ context.Context, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.LoadBalancers, name)
+	return nil
+}
+`
+
+const clusterScopeTmpl = `// Package scope bundles the objects a reconcile loop works on, and patches
+// them back when the loop is done.
+package scope
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	{{.APIVersion}} "{{.Module}}/api/{{.APIVersion}}"
+	"{{.Module}}/pkg/cloud"
+)
+
+// ClusterScopeParams defines the input parameters used to create a ClusterScope.
+type ClusterScopeParams struct {
+	Client       client.Client
+	Cluster      *clusterv1.Cluster
+	InfraCluster *{{.APIVersion}}.{{.ClusterKind}}
+	// CloudClient overrides the client built from the credentials Secret (e.g. a fake in tests).
+	CloudClient cloud.Client
+}
+
+// ClusterScope holds the state of a {{.ClusterKind}} reconciliation.
+type ClusterScope struct {
+	client      client.Client
+	patchHelper *patch.Helper
+
+	Cluster      *clusterv1.Cluster
+	InfraCluster *{{.APIVersion}}.{{.ClusterKind}}
+	CloudClient  cloud.Client
+}
+
+// NewClusterScope creates a ClusterScope, loading cloud credentials from the
+// Secret referenced by spec.credentialsRef (default: <name>-credentials).
+func NewClusterScope(ctx context.Context, params ClusterScopeParams) (*ClusterScope, error) {
+	if params.Cluster == nil {
+		return nil, errors.New("cluster is required when creating a ClusterScope")
+	}
+	if params.InfraCluster == nil {
+		return nil, errors.New("{{.ClusterKind}} is required when creating a ClusterScope")
+	}
+
+	helper, err := patch.NewHelper(params.InfraCluster, params.Client)
+	if err != nil {
+		return nil, fmt.Errorf("initializing patch helper: %w", err)
+	}
+
+	cloudClient := params.CloudClient
+	if cloudClient == nil {
+		creds, err := cloud.CredentialsFromSecret(ctx, params.Client, credentialsKey(params.InfraCluster))
+		if err != nil {
+			return nil, err
+		}
+		if cloudClient, err = cloud.NewClient(creds); err != nil {
+			return nil, fmt.Errorf("creating cloud client: %w", err)
+		}
+	}
+
+	return &ClusterScope{
+		client:       params.Client,
+		patchHelper:  helper,
+		Cluster:      params.Cluster,
+		InfraCluster: params.InfraCluster,
+		CloudClient:  cloudClient,
+	}, nil
+}
+
+func credentialsKey(infraCluster *{{.APIVersion}}.{{.ClusterKind}}) client.ObjectKey {
+	key := client.ObjectKey{Namespace: infraCluster.Namespace, Name: infraCluster.Name + "-credentials"}
+	if ref := infraCluster.Spec.CredentialsRef; ref != nil {
+		key.Name = ref.Name
+		if ref.Namespace != "" {
+			key.Namespace = ref.Namespace
+		}
+	}
+	return key
+}
+
+// Name returns the CAPI Cluster name.
+func (s *ClusterScope) Name() string {
+	return s.Cluster.Name
+}
+
+// Namespace returns the CAPI Cluster namespace.
+func (s *ClusterScope) Namespace() string {
+	return s.Cluster.Namespace
+}
+
+// Close patches the {{.ClusterKind}} with the changes made during reconciliation.
+func (s *ClusterScope) Close(ctx context.Context) error {
+	return s.patchHelper.Patch(ctx, s.InfraCluster)
+}
+`
+
+const machineScopeTmpl = `package scope
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	{{.APIVersion}} "{{.Module}}/api/{{.APIVersion}}"
+)
+
+// MachineScopeParams defines the input parameters used to create a MachineScope.
+type MachineScopeParams struct {
+	Client       client.Client
+	ClusterScope *ClusterScope
+	Machine      *clusterv1.Machine
+	InfraMachine *{{.APIVersion}}.{{.MachineKind}}
+}
+
+// MachineScope holds the state of a {{.MachineKind}} reconciliation.
+type MachineScope struct {
+	*ClusterScope
+
+	client      client.Client
+	patchHelper *patch.Helper
+
+	Machine      *clusterv1.Machine
+	InfraMachine *{{.APIVersion}}.{{.MachineKind}}
+}
+
+// NewMachineScope creates a MachineScope sharing the cloud client of its ClusterScope.
+func NewMachineScope(params MachineScopeParams) (*MachineScope, error) {
+	if params.ClusterScope == nil {
+		return nil, errors.New("cluster scope is required when creating a MachineScope")
+	}
+	if params.Machine == nil {
+		return nil, errors.New("machine is required when creating a MachineScope")
+	}
+	if params.InfraMachine == nil {
+		return nil, errors.New("{{.MachineKind}} is required when creating a MachineScope")
+	}
+
+	helper, err := patch.NewHelper(params.InfraMachine, params.Client)
+	if err != nil {
+		return nil, fmt.Errorf("initializing patch helper: %w", err)
+	}
+
+	return &MachineScope{
+		ClusterScope: params.ClusterScope,
+		client:       params.Client,
+		patchHelper:  helper,
+		Machine:      params.Machine,
+		InfraMachine: params.InfraMachine,
+	}, nil
+}
+
+// Name returns the {{.MachineKind}} name.
+func (m *MachineScope) Name() string {
+	return m.InfraMachine.Name
+}
+
+// IsControlPlane reports whether the machine is a control plane member.
+func (m *MachineScope) IsControlPlane() bool {
+	return util.IsControlPlaneMachine(m.Machine)
+}
+
+// ProviderID returns the provider ID, or "" when not yet set.
+func (m *MachineScope) ProviderID() string {
+	if m.InfraMachine.Spec.ProviderID == nil {
+		return ""
+	}
+	return *m.InfraMachine.Spec.ProviderID
+}
+
+// SetProviderID sets the provider ID from the cloud instance ID.
+func (m *MachineScope) SetProviderID(instanceID string) {
+	providerID := "{{.Name}}://" + instanceID
+	m.InfraMachine.Spec.ProviderID = &providerID
+}
+
+// SetReady marks the {{.MachineKind}} as ready.
+func (m *MachineScope) SetReady() {
+	m.InfraMachine.Status.Ready = true
+}
+
+// SetFailure records a terminal failure on the {{.MachineKind}}.
+func (m *MachineScope) SetFailure(reason, message string) {
+	m.InfraMachine.Status.FailureReason = &reason
+	m.InfraMachine.Status.FailureMessage = &message
+}
+
+// BootstrapData returns the bootstrap data from the Machine's bootstrap Secret.
+func (m *MachineScope) BootstrapData(ctx context.Context) ([]byte, error) {
+	if m.Machine.Spec.Bootstrap.DataSecretName == nil {
+		return nil, errors.New("bootstrap data secret is not available yet")
+	}
+
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: m.Machine.Namespace, Name: *m.Machine.Spec.Bootstrap.DataSecretName}
+	if err := m.client.Get(ctx, key, secret); err != nil {
+		return nil, fmt.Errorf("getting bootstrap data secret %s: %w", key, err)
+	}
+
+	value, ok := secret.Data["value"]
+	if !ok {
+		return nil, fmt.Errorf("bootstrap data secret %s has no value key", key)
+	}
+	return value, nil
+}
+
+// Close patches the {{.MachineKind}} with the changes made during reconciliation.
+func (m *MachineScope) Close(ctx context.Context) error {
+	return m.patchHelper.Patch(ctx, m.InfraMachine)
+}
+`
+
+const webhookTmpl = `package {{.APIVersion}}
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupWebhookWithManager registers the {{.Kind}} webhooks with the manager.
+func (r *{{.Kind}}) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	w := &{{.Kind}}Webhook{}
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/mutate-{{.GroupPath}}-{{.APIVersion}}-{{.KindLower}},mutating=true,failurePolicy=fail,matchPolicy=Equivalent,groups={{.APIGroup}},resources={{.Plural}},versions={{.APIVersion}},name=default.{{.KindLower}}.{{.APIGroup}},sideEffects=None,admissionReviewVersions=v1
+// +kubebuilder:webhook:verbs=create;update,path=/validate-{{.GroupPath}}-{{.APIVersion}}-{{.KindLower}},mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups={{.APIGroup}},resources={{.Plural}},versions={{.APIVersion}},name=validation.{{.KindLower}}.{{.APIGroup}},sideEffects=None,admissionReviewVersions=v1
+
+// {{.Kind}}Webhook implements defaulting and validation for {{.Kind}}.
+type {{.Kind}}Webhook struct{}
+
+var (
+	_ webhook.CustomDefaulter = &{{.Kind}}Webhook{}
+	_ webhook.CustomValidator = &{{.Kind}}Webhook{}
+)
+
+// Default sets default values on a {{.Kind}}.
+func (w *{{.Kind}}Webhook) Default(_ context.Context, obj runtime.Object) error {
+	if _, ok := obj.(*{{.Kind}}); !ok {
+		return fmt.Errorf("expected a {{.Kind}} but got %T", obj)
+	}
+
+	// TODO: Set provider-specific defaults
+
+	return nil
+}
+
+// ValidateCreate validates a {{.Kind}} on creation.
+func (w *{{.Kind}}Webhook) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	if _, ok := obj.(*{{.Kind}}); !ok {
+		return nil, fmt.Errorf("expected a {{.Kind}} but got %T", obj)
+	}
+
+	// TODO: Validate provider-specific fields
+
+	return nil, nil
+}
+
+// ValidateUpdate validates a {{.Kind}} on update.
+func (w *{{.Kind}}Webhook) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	if _, ok := oldObj.(*{{.Kind}}); !ok {
+		return nil, fmt.Errorf("expected a {{.Kind}} but got %T", oldObj)
+	}
+	if _, ok := newObj.(*{{.Kind}}); !ok {
+		return nil, fmt.Errorf("expected a {{.Kind}} but got %T", newObj)
+	}
+
+	// TODO: Reject changes to immutable fields
+
+	return nil, nil
+}
+
+// ValidateDelete validates a {{.Kind}} on deletion.
+func (w *{{.Kind}}Webhook) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+`
+
+const conversionTmpl = `package {{.APIVersion}}
+
+// {{.APIVersion}} is the conversion hub: older API versions implement
+// conversion.Convertible to and from these types.
+{{range .Kinds}}
+// Hub marks {{.}} as a conversion hub.
+func (*{{.}}) Hub() {}
+
+// Hub marks {{.}}List as a conversion hub.
+func (*{{.}}List) Hub() {}
+{{end -}}
+`
+
+const webhookKustomizeTmpl = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- manifests.yaml
+- service.yaml
+- certificate.yaml
+
+# Let cert-manager's CA injector fill in the caBundle of the webhook configurations.
+patches:
+- target:
+    kind: MutatingWebhookConfiguration
+  patch: |-
+    - op: add
+      path: /metadata/annotations
+      value:
+        cert-manager.io/inject-ca-from: {{.Name}}-system/{{.Name}}-serving-cert
+- target:
+    kind: ValidatingWebhookConfiguration
+  patch: |-
+    - op: add
+      path: /metadata/annotations
+      value:
+        cert-manager.io/inject-ca-from: {{.Name}}-system/{{.Name}}-serving-cert
+
+configurations:
+- kustomizeconfig.yaml
+`
+
+const webhookKustomizeConfigTmpl = `# Update the service name and namespace in the webhook configurations
+# when kustomize applies namePrefix and namespace.
+nameReference:
+- kind: Service
+  version: v1
+  fieldSpecs:
+  - kind: MutatingWebhookConfiguration
+    group: admissionregistration.k8s.io
+    path: webhooks/clientConfig/service/name
+  - kind: ValidatingWebhookConfiguration
+    group: admissionregistration.k8s.io
+    path: webhooks/clientConfig/service/name
+
+namespace:
+- kind: MutatingWebhookConfiguration
+  group: admissionregistration.k8s.io
+  path: webhooks/clientConfig/service/namespace
+  create: true
+- kind: ValidatingWebhookConfiguration
+  group: admissionregistration.k8s.io
+  path: webhooks/clientConfig/service/namespace
+  create: true
+`
+
+const webhookServiceTmpl = `apiVersion: v1
+kind: Service
+metadata:
+  name: webhook-service
+  namespace: system
+spec:
+  ports:
+  - port: 443
+    targetPort: webhook-server
+  selector:
+    control-plane: controller-manager
+`
+
+const webhookCertificateTmpl = `# Self-signed serving certificate for the webhook server, issued by cert-manager.
+apiVersion: cert-manager.io/v1
+kind: Issuer
+metadata:
+  name: selfsigned-issuer
+  namespace: system
+spec:
+  selfSigned: {}
+---
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  name: serving-cert
+  namespace: system
+spec:
+  dnsNames:
+  - {{.Name}}-webhook-service.{{.Name}}-system.svc
+  - {{.Name}}-webhook-service.{{.Name}}-system.svc.cluster.local
+  issuerRef:
+    kind: Issuer
+    name: {{.Name}}-selfsigned-issuer
+  secretName: {{.Name}}-webhook-service-cert
+`
+
+const managerWebhookPatchTmpl = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: controller-manager
+  namespace: system
+spec:
+  template:
+    spec:
+      containers:
+      - name: manager
+        ports:
+        - containerPort: 9443
+          name: webhook-server
+          protocol: TCP
+        volumeMounts:
+        - mountPath: /tmp/k8s-webhook-server/serving-certs
+          name: cert
+          readOnly: true
+      volumes:
+      - name: cert
+        secret:
+          secretName: {{.Name}}-webhook-service-cert
+`
+
+// --- CRD rendering ---
+
+// externalSchemas are OpenAPI schemas for the non-local types used by the
+// type templates, so CRDs can be rendered without controller-gen.
+var externalSchemas = map[string]map[string]interface{}{
+	"clusterv1.APIEndpoint": {
+		"type": "object",
+		"properties": map[string]interface{}{
+			"host": map[string]interface{}{"type": "string"},
+			"port": map[string]interface{}{"type": "integer", "format": "int32"},
+		},
+		"required": []string{"host", "port"},
+	},
+	"clusterv1.MachineAddress": {
+		"type": "object",
+		"properties": map[string]interface{}{
+			"type":    map[string]interface{}{"type": "string"},
+			"address": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"address", "type"},
+	},
+	"clusterv1.Conditions": {
+		"type": "array",
+		"items": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type":               map[string]interface{}{"type": "string"},
+				"status":             map[string]interface{}{"type": "string"},
+				"severity":           map[string]interface{}{"type": "string"},
+				"lastTransitionTime": map[string]interface{}{"type": "string", "format": "date-time"},
+				"reason":             map[string]interface{}{"type": "string"},
+				"message":            map[string]interface{}{"type": "string"},
+			},
+			"required": []string{"lastTransitionTime", "status", "type"},
+		},
+	},
+	"corev1.SecretReference": {
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":      map[string]interface{}{"type": "string"},
+			"namespace": map[string]interface{}{"type": "string"},
+		},
+		"x-kubernetes-map-type": "atomic",
+	},
+	"metav1.Time": {"type": "string", "format": "date-time"},
+}
+
+var printColumnAttr = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// goType is a struct type declared in the rendered API package.
+type goType struct {
+	doc     string
+	markers []string
+	fields  *ast.FieldList
+}
+
+// parseAPITypes parses the rendered api/<version>/*_types.go files.
+func parseAPITypes(files map[string]string, apiDir string) (map[string]goType, []string, error) {
+	types := map[string]goType{}
+	var roots []string
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		if strings.HasPrefix(p, apiDir) && strings.HasSuffix(p, "_types.go") {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	fset := token.NewFileSet()
+	for _, p := range paths {
+		f, err := parser.ParseFile(fset, p, files[p], parser.ParseComments)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing %s: %w", p, err)
+		}
+		prevEnd := f.Name.End()
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				prevEnd = decl.End()
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				if _, seen := types[ts.Name.Name]; seen {
+					continue
+				}
+				t := goType{fields: st.Fields}
+				start := gen.Pos()
+				if gen.Doc != nil {
+					t.doc, t.markers = splitComment(gen.Doc.Text())
+					start = gen.Doc.Pos()
+				}
+				// Markers are usually in a separate comment block right above the doc
+				for _, cg := range f.Comments {
+					if cg.Pos() > prevEnd && cg.End() < start {
+						_, markers := splitComment(cg.Text())
+						t.markers = append(t.markers, markers...)
+					}
+				}
+				types[ts.Name.Name] = t
+				for _, m := range t.markers {
+					if m == "+kubebuilder:object:root=true" && !strings.HasSuffix(ts.Name.Name, "List") {
+						roots = append(roots, ts.Name.Name)
+					}
+				}
+			}
+			prevEnd = decl.End()
+		}
+	}
+	return types, roots, nil
+}
+
+// splitComment separates description lines from +marker lines.
+func splitComment(text string) (string, []string) {
+	var desc, markers []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "+"):
+			markers = append(markers, line)
+		case line != "" && !strings.HasPrefix(line, "TODO"):
+			desc = append(desc, line)
+		}
+	}
+	return strings.Join(desc, " "), markers
+}
+
+// fieldSchema converts a Go type expression to an OpenAPI schema.
+func fieldSchema(expr ast.Expr, types map[string]goType, seen map[string]bool) map[string]interface{} {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return fieldSchema(e.X, types, seen)
+	case *ast.ArrayType:
+		if id, ok := e.Elt.(*ast.Ident); ok && id.Name == "byte" {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": fieldSchema(e.Elt, types, seen)}
+	case *ast.MapType:
+		return map[string]interface{}{"type": "object", "additionalProperties": fieldSchema(e.Value, types, seen)}
+	case *ast.SelectorExpr:
+		if pkg, ok := e.X.(*ast.Ident); ok {
+			if schema, ok := externalSchemas[pkg.Name+"."+e.Sel.Name]; ok {
+				return schema
+			}
+		}
+	case *ast.Ident:
+		switch e.Name {
+		case "string":
+			return map[string]interface{}{"type": "string"}
+		case "bool":
+			return map[string]interface{}{"type": "boolean"}
+		case "int", "int64":
+			return map[string]interface{}{"type": "integer", "format": "int64"}
+		case "int32":
+			return map[string]interface{}{"type": "integer", "format": "int32"}
+		case "float32", "float64":
+			return map[string]interface{}{"type": "number"}
+		}
+		if t, ok := types[e.Name]; ok && !seen[e.Name] {
+			seen[e.Name] = true
+			defer delete(seen, e.Name)
+			return structSchema(t, types, seen)
+		}
+	}
+	return map[string]interface{}{"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+}
+
+// structSchema converts a struct to an object schema, honouring json tags,
+// +optional and a subset of +kubebuilder:validation markers.
+func structSchema(t goType, types map[string]goType, seen map[string]bool) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	for _, field := range t.fields.List {
+		tag := ""
+		if field.Tag != nil {
+			tag = reflect.StructTag(strings.Trim(field.Tag.Value, "`")).Get("json")
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" || len(field.Names) == 0 && name == "" {
+			continue
+		}
+		if name == "" {
+			name = field.Names[0].Name
+		}
+
+		schema := map[string]interface{}{}
+		for k, v := range fieldSchema(field.Type, types, seen) {
+			schema[k] = v
+		}
+		optional := strings.Contains(opts, "omitempty")
+		if field.Doc != nil {
+			desc, markers := splitComment(field.Doc.Text())
+			if desc != "" {
+				schema["description"] = desc
+			}
+			for _, m := range markers {
+				key, value, _ := strings.Cut(strings.TrimPrefix(m, "+kubebuilder:validation:"), "=")
+				switch key {
+				case "+optional":
+					optional = true
+				case "Minimum", "Maximum", "MinItems", "MaxItems", "MinLength", "MaxLength":
+					if n, err := strconv.Atoi(value); err == nil {
+						schema[strings.ToLower(key[:1])+key[1:]] = n
+					}
+				case "Enum":
+					schema["enum"] = strings.Split(value, ";")
+				}
+			}
+		}
+		props[name] = schema
+		if !optional {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": props}
+	if t.doc != "" {
+		schema["description"] = t.doc
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// renderCRDs builds CRD manifests for the root kinds in the rendered API
+// types, named like controller-gen output (<group>_<plural>.yaml).
+func renderCRDs(cfg *providerConfig, files map[string]string) (map[string]string, error) {
+	apiDir := "api/" + cfg.APIVersion + "/"
+	types, roots, err := parseAPITypes(files, apiDir)
+	if err != nil {
+		return nil, err
+	}
+
+	crds := map[string]string{}
+	for _, kind := range roots {
+		t := types[kind]
+		plural := strings.ToLower(kind) + "s"
+
+		rootSchema := structSchema(t, types, map[string]bool{kind: true})
+		props := rootSchema["properties"].(map[string]interface{})
+		props["apiVersion"] = map[string]interface{}{"type": "string", "description": "APIVersion defines the versioned schema of this representation of an object."}
+		props["kind"] = map[string]interface{}{"type": "string", "description": "Kind is a string value representing the REST resource this object represents."}
+		props["metadata"] = map[string]interface{}{"type": "object"}
+		delete(rootSchema, "required")
+
+		version := map[string]interface{}{
+			"name":    cfg.APIVersion,
+			"served":  true,
+			"storage": true,
+			"schema":  map[string]interface{}{"openAPIV3Schema": rootSchema},
+		}
+		var columns []interface{}
+		for _, m := range t.markers {
+			if m == "+kubebuilder:subresource:status" {
+				version["subresources"] = map[string]interface{}{"status": map[string]interface{}{}}
+			}
+			if strings.HasPrefix(m, "+kubebuilder:printcolumn:") {
+				column := map[string]interface{}{}
+				for _, attr := range printColumnAttr.FindAllStringSubmatch(m, -1) {
+					key := attr[1]
+					if key == "JSONPath" {
+						key = "jsonPath"
+					}
+					column[key] = attr[2]
+				}
+				columns = append(columns, column)
+			}
+		}
+		if len(columns) > 0 {
+			version["additionalPrinterColumns"] = columns
+		}
+
+		crd := map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind":       "CustomResourceDefinition",
+			"metadata": map[string]interface{}{
+				"name": plural + "." + cfg.APIGroup,
+				// Contract label CAPI uses to find the version serving its contract
+				"labels": map[string]interface{}{"cluster.x-k8s.io/v1beta1": cfg.APIVersion},
+			},
+			"spec": map[string]interface{}{
+				"group": cfg.APIGroup,
+				"names": map[string]interface{}{
+					"kind":       kind,
+					"listKind":   kind + "List",
+					"plural":     plural,
+					"singular":   strings.ToLower(kind),
+					"categories": []string{"cluster-api"},
+				},
+				"scope":    "Namespaced",
+				"versions": []interface{}{version},
+			},
+		}
+
+		var b bytes.Buffer
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		if err := enc.Encode(crd); err != nil {
+			return nil, fmt.Errorf("encoding CRD for %s: %w", kind, err)
+		}
+		enc.Close()
+		crds["config/crd/bases/"+cfg.APIGroup+"_"+plural+".yaml"] = "---\n" + b.String()
+	}
+	return crds, nil
+}
+
+// --- Post-generation validation ---
+
+var (
+	goModRequire = regexp.MustCompile(`(?m)^\s*([a-z0-9.\-]+\.[a-z]+/\S+)\s+v\S+`)
+	majorVersion = regexp.MustCompile(`^v\d+$`)
+	gopkgVersion = regexp.MustCompile(`\.v\d+$`)
+)
+
+// importName returns the identifier an unaliased import is referenced by, or
+// "" when it cannot be derived from the path.
+func importName(path string) string {
+	parts := strings.Split(path, "/")
+	name := parts[len(parts)-1]
+	if len(parts) > 1 && majorVersion.MatchString(name) && !strings.HasSuffix(path, "/api/"+name) {
+		name = parts[len(parts)-2]
+	}
+	name = gopkgVersion.ReplaceAllString(name, "")
+	if !token.IsIdentifier(name) {
+		return ""
+	}
+	return name
+}
+
+// validateFiles checks the rendered files the way a build would: Go files
+// must parse, agree on package names per directory, declare nothing twice
+// and only import packages that resolve against go.mod or the scaffold
+// itself; YAML and JSON files must decode.
+func validateFiles(cfg *providerConfig, files map[string]string) []string {
+	var problems []string
+	requires := goModRequire.FindAllStringSubmatch(files["go.mod"], -1)
+
+	localPkgs := map[string]bool{}
+	for p := range files {
+		if strings.HasSuffix(p, ".go") {
+			localPkgs[filepath.Dir(p)] = true
+		}
+	}
+
+	pkgNames := map[string]string{}
+	decls := map[string]string{}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	fset := token.NewFileSet()
+	for _, p := range paths {
+		content := files[p]
+		switch filepath.Ext(p) {
+		case ".go":
+			f, err := parser.ParseFile(fset, p, content, parser.ParseComments)
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			dir := filepath.Dir(p)
+			if name, ok := pkgNames[dir]; ok && name != f.Name.Name {
+				problems = append(problems, fmt.Sprintf("%s: package %s, but %s/ is package %s", p, f.Name.Name, dir, name))
+			}
+			pkgNames[dir] = f.Name.Name
+
+			for _, decl := range f.Decls {
+				var names []*ast.Ident
+				switch d := decl.(type) {
+				case *ast.FuncDecl:
+					if d.Recv == nil && d.Name.Name != "init" {
+						names = append(names, d.Name)
+					}
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						switch s := spec.(type) {
+						case *ast.TypeSpec:
+							names = append(names, s.Name)
+						case *ast.ValueSpec:
+							names = append(names, s.Names...)
+						}
+					}
+				}
+				for _, n := range names {
+					if n.Name == "_" {
+						continue
+					}
+					key := dir + "." + n.Name
+					if prev, ok := decls[key]; ok {
+						problems = append(problems, fmt.Sprintf("%s: %s redeclared (also in %s)", fset.Position(n.Pos()), n.Name, prev))
+						continue
+					}
+					decls[key] = p
+				}
+			}
+
+			used := map[string]bool{}
+			ast.Inspect(f, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if id, ok := sel.X.(*ast.Ident); ok {
+						used[id.Name] = true
+					}
+				}
+				return true
+			})
+			for _, imp := range f.Imports {
+				path, _ := strconv.Unquote(imp.Path.Value)
+				if !importResolves(path, cfg.Module, localPkgs, requires) {
+					problems = append(problems, fmt.Sprintf("%s: import %q does not resolve against go.mod", fset.Position(imp.Pos()), path))
+				}
+				name := importName(path)
+				if imp.Name != nil {
+					name = imp.Name.Name
+				}
+				if name != "" && name != "_" && name != "." && !used[name] {
+					problems = append(problems, fmt.Sprintf("%s: import %q is unused", fset.Position(imp.Pos()), path))
+				}
+			}
+		case ".yaml", ".yml":
+			dec := yaml.NewDecoder(strings.NewReader(content))
+			for {
+				var doc interface{}
+				err := dec.Decode(&doc)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%s: invalid YAML: %v", p, err))
+					break
+				}
+			}
+		case ".json":
+			if !json.Valid([]byte(content)) {
+				problems = append(problems, fmt.Sprintf("%s: invalid JSON", p))
+			}
+		}
+	}
+	return problems
+}
+
+func importResolves(path, module string, localPkgs map[string]bool, requires [][]string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	if !strings.Contains(first, ".") {
+		return true // standard library
+	}
+	if strings.HasPrefix(path, module+"/") {
+		return localPkgs[strings.TrimPrefix(path, module+"/")]
+	}
+	for _, req := range requires {
+		if path == req[1] || strings.HasPrefix(path, req[1]+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// scaffoldOptions control how rendered files are applied to the output directory.
+type scaffoldOptions struct {
+	DryRun     bool // report the plan without writing
+	Diff       bool // print unified diffs for overwritten files
+	NoValidate bool // skip post-generation validation
+
+	// Previous is the manifest of an earlier scaffold (update only). Files whose
+	// content no longer matches its hash were edited and are preserved.
+	Previous *scaffoldManifest
+}
+
+// generateFiles renders every file of the scaffold, keyed by relative path.
+func generateFiles(cfg *providerConfig) (map[string]string, error) {
+	data := newTemplateData(cfg)
+
+	// Files to generate
+	files := map[string]string{
+		"README.md":                               renderTemplate("readme", readmeTmpl, data),
+		"Makefile":                                 renderTemplate("makefile", makefileTmpl, data),
+		"Dockerfile":                               renderTemplate("dockerfile", dockerfileTmpl, data),
+		"go.mod":                                   renderTemplate("go.mod", goModTmpl, data),
+		"main.go":                                  renderTemplate("main.go", mainGoTmpl, data),
+		"api/" + cfg.APIVersion + "/groupversion_info.go":   renderTemplate("gv", groupVersionInfoTmpl, data),
+		"config/default/kustomization.yaml":         renderTemplate("kustomize", kustomizationTmpl, data),
+		"config/manager/kustomization.yaml":         renderTemplate("mgr_kust", managerKustomizeTmpl, data),
+		"config/manager/manager.yaml":               renderTemplate("mgr_deploy", managerDeploymentTmpl, data),
+		"config/rbac/kustomization.yaml":            renderTemplate("rbac_kust", rbacKustomizeTmpl, data),
+		"config/rbac/service_account.yaml":           renderTemplate("sa", serviceAccountTmpl, data),
+		"config/rbac/role.yaml":                     renderTemplate("role", clusterRoleTmpl, data),
+		"config/rbac/role_binding.yaml":              renderTemplate("role_binding", clusterRoleBindingTmpl, data),
+		"config/crd/kustomization.yaml":             renderTemplate("crd_kust", crdKustomizeTmpl, data),
+		"hack/boilerplate.go.txt":                   renderTemplate("boilerplate", boilerplateTmpl, data),
+	}
+
+	if cfg.Type == "ipam" {
+		files["api/"+cfg.APIVersion+"/ippool_types.go"] = renderTemplate("ippool_types", ipPoolTypeTmpl, data)
+		files["controllers/ipaddressclaim_controller.go"] = renderTemplate("ipclaim_ctrl", ipClaimControllerTmpl, data)
+		files["examples/ippool.yaml"] = renderTemplate("ippool_example", ipPoolExampleTmpl, data)
+	} else {
+		files["api/"+cfg.APIVersion+"/cluster_types.go"] = renderTemplate("cluster_types", clusterTypeTmpl, data)
+		files["api/"+cfg.APIVersion+"/template_types.go"] = renderTemplate("template_types", templateTypeTmpl, data)
+		files["controllers/cluster_controller.go"] = renderTemplate("cluster_ctrl", clusterControllerTmpl, data)
+		// Bootstrap and control plane providers use a single kind for both
+		if cfg.MachineKind != cfg.ClusterKind {
+			files["api/"+cfg.APIVersion+"/machine_types.go"] = renderTemplate("machine_types", machineTypeTmpl, data)
+			files["controllers/machine_controller.go"] = renderTemplate("machine_ctrl", machineControllerTmpl, data)
+		}
+		files["templates/cluster-template.yaml"] = renderTemplate("cluster_tmpl", clusterTemplateTmpl, data)
+	}
+
+	files["Tiltfile"] = renderTemplate("tiltfile", tiltfileTmpl, data)
+	files["tilt-settings.example.json"] = renderTemplate("tilt_settings", tiltSettingsTmpl, data)
+	files["hack/kind-with-registry/main.go"] = renderTemplate("kind_registry", kindWithRegistryTmpl, data)
+	files["metadata.yaml"] = renderTemplate("metadata", metadataTmpl, data)
+	files["clusterctl-settings.json"] = renderTemplate("clusterctl_settings", clusterctlSettingsTmpl, data)
+	files["config/release/kustomization.yaml"] = renderTemplate("release_kust", releaseKustomizeTmpl, data)
+
+	if cfg.MachinePoolKind != "" {
+		files["api/"+cfg.APIVersion+"/machinepool_types.go"] = renderTemplate("machinepool_types", machinePoolTypeTmpl, data)
+		files["controllers/machinepool_controller.go"] = renderTemplate("machinepool_ctrl", machinePoolControllerTmpl, data)
+		files["templates/cluster-template-machinepool.yaml"] = renderTemplate("machinepool_tmpl", machinePoolTemplateTmpl, data)
+	}
+
+	if cfg.WithCloudClient {
+		files["pkg/cloud/interfaces.go"] = renderTemplate("cloud_interfaces", cloudInterfacesTmpl, data)
+		files["pkg/cloud/credentials.go"] = renderTemplate("cloud_credentials", cloudCredentialsTmpl, data)
+		files["pkg/cloud/client.go"] = renderTemplate("cloud_client", cloudClientTmpl, data)
+		files["pkg/cloud/fake/client.go"] = renderTemplate("cloud_fake", cloudFakeTmpl, data)
+		files["pkg/cloud/scope/cluster.go"] = renderTemplate("cluster_scope", clusterScopeTmpl, data)
+		files["pkg/cloud/scope/machine.go"] = renderTemplate("machine_scope", machineScopeTmpl, data)
+	}
+
+	if cfg.WithWebhooks {
+		apiDir := "api/" + cfg.APIVersion + "/"
+		for _, kind := range cfg.Kinds() {
+			files[apiDir+strings.ToLower(kind)+"_webhook.go"] = renderTemplate("webhook", webhookTmpl, data.forKind(kind))
+		}
+		files[apiDir+"conversion.go"] = renderTemplate("conversion", conversionTmpl, data)
+		files["config/webhook/kustomization.yaml"] = renderTemplate("webhook_kust", webhookKustomizeTmpl, data)
+		files["config/webhook/kustomizeconfig.yaml"] = renderTemplate("webhook_kustconfig", webhookKustomizeConfigTmpl, data)
+		files["config/webhook/service.yaml"] = renderTemplate("webhook_svc", webhookServiceTmpl, data)
+		files["config/webhook/certificate.yaml"] = renderTemplate("webhook_cert", webhookCertificateTmpl, data)
+		files["config/default/manager_webhook_patch.yaml"] = renderTemplate("mgr_webhook_patch", managerWebhookPatchTmpl, data)
+	}
+
+	if cfg.RenderCRDs {
+		crds, err := renderCRDs(cfg, files)
+		if err != nil {
+			return nil, fmt.Errorf("rendering CRDs: %w", err)
+		}
+		for relPath, content := range crds {
+			files[relPath] = content
+		}
+	}
+	return files, nil
+}
+
+func scaffold(cfg *providerConfig, opts scaffoldOptions) {
+	dir := cfg.OutputDir
+	files, err := generateFiles(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	update := opts.Previous != nil
+
+	paths := make([]string, 0, len(files))
+	for relPath := range files {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+
+	manifest := &scaffoldManifest{ToolVersion: toolVersion, Config: *cfg, Files: map[string]string{}}
+	counts := map[fileAction]int{}
+	for _, relPath := range paths {
+		content := files[relPath]
+		fullPath := filepath.Join(dir, relPath)
+		action, existing := planFile(fullPath, content)
+		manifest.Files[relPath] = hashContent(content)
+		if update && action == actionOverwrite {
+			// Only files still matching the recorded hash are regenerated;
+			// untracked files that now collide with a template are the user's.
+			if prev, ok := opts.Previous.Files[relPath]; !ok || prev != hashContent(existing) {
+				action = actionPreserve
+				if ok {
+					manifest.Files[relPath] = prev
+				} else {
+					delete(manifest.Files, relPath)
+				}
+			}
+		}
+
+		if opts.DryRun || opts.Diff {
+			fmt.Printf("  %s %-10s %s\n", actionIcons[action], action, relPath)
+			if opts.Diff && (action == actionOverwrite || action == actionPreserve) {
+				fmt.Print(unifiedDiff(relPath, existing, content))
+			}
+			counts[action]++
+			continue
+		}
+		if action == actionUnchanged || action == actionPreserve {
+			if action == actionPreserve {
+				fmt.Printf("  %s %-10s %s (modified locally)\n", actionIcons[action], action, relPath)
+			}
+			counts[action]++
+			continue
+		}
+		if err := writeFile(fullPath, content); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", relPath, err)
+			continue
+		}
+		counts[action]++
+	}
+
+	var obsolete []string
+	if update {
+		for relPath := range opts.Previous.Files {
+			if _, ok := files[relPath]; !ok {
+				obsolete = append(obsolete, relPath)
+			}
+		}
+		sort.Strings(obsolete)
+	}
+
+	summary := fmt.Sprintf("%d to create, %d to overwrite, %d unchanged",
+		counts[actionCreate], counts[actionOverwrite], counts[actionUnchanged])
+	if update {
+		summary += fmt.Sprintf(", %d preserved", counts[actionPreserve])
+	}
+	if opts.DryRun || opts.Diff {
+		fmt.Printf("\n🔍 Dry run for %s: %s\n", dir, summary)
+	}
+
+	if !opts.NoValidate {
+		if problems := validateFiles(cfg, files); len(problems) > 0 {
+			fmt.Fprintf(os.Stderr, "\n❌ Generated files failed validation (template drift):\n")
+			for _, p := range problems {
+				fmt.Fprintf(os.Stderr, "   %s\n", p)
+			}
+			os.Exit(1)
+		}
+	}
+	if len(obsolete) > 0 {
+		fmt.Printf("\n⚠️  No longer generated (left in place, remove if unused):\n")
+		for _, relPath := range obsolete {
+			fmt.Printf("   %s\n", relPath)
+		}
+	}
+	if opts.DryRun || opts.Diff {
+		return
+	}
+
+	if err := writeManifest(dir, manifest); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", manifestFile, err)
+		os.Exit(1)
+	}
+	if update {
+		fmt.Printf("\n✅ Provider scaffold updated: %s (%s -> %s)\n", dir, opts.Previous.ToolVersion, toolVersion)
+		fmt.Printf("   Files: %d created, %d overwritten, %d unchanged, %d preserved\n",
+			counts[actionCreate], counts[actionOverwrite], counts[actionUnchanged], counts[actionPreserve])
+		if counts[actionPreserve] > 0 {
+			fmt.Println("   Preserved files were edited since the last scaffold; run with --diff to compare them with the templates.")
+		}
+		return
+	}
+
+	fmt.Printf("\n✅ Provider scaffold created: %s\n", dir)
+	fmt.Printf("   Files: %d created, %d overwritten, %d unchanged\n",
+		counts[actionCreate], counts[actionOverwrite], counts[actionUnchanged])
+	fmt.Printf("   Module: %s\n", cfg.Module)
+	fmt.Printf("   API Group: %s\n", cfg.APIGroup)
+	fmt.Printf("   Types: %s\n", strings.Join(cfg.Kinds(), ", "))
+	if cfg.MachinePoolKind != "" {
+		fmt.Printf("   Machine pool: %s (requires EXP_MACHINE_POOL=true on the management cluster)\n", cfg.MachinePoolKind)
+	}
+	if cfg.WithWebhooks {
+		fmt.Printf("   Webhooks: %s (cert-manager required)\n", strings.Join(cfg.Kinds(), ", "))
+	}
+
+	fmt.Println("\nNext steps:")
+	fmt.Println("  1. cd", dir)
+	fmt.Println("  2. go mod tidy")
+	fmt.Println("  3. make generate  # Generate DeepCopy methods")
+	if cfg.RenderCRDs {
+		fmt.Println("  4. make install   # Install the pre-rendered CRDs (make manifests regenerates them)")
+	} else {
+		fmt.Println("  4. make manifests # Generate CRD YAML")
+	}
+	fmt.Println("  5. Implement TODO sections in controllers/")
+	if cfg.WithCloudClient {
+		fmt.Println("  6. Implement pkg/cloud/client.go with the cloud SDK and build scopes in controllers/")
+	}
+}
+
+func main() {
+	name := flag.String("n", "", "Provider name (e.g., 'mycloud')")
+	provType := flag.String("t", "infrastructure", "Provider type: infrastructure, bootstrap, controlplane, ipam")
+	module := flag.String("module", "", "Go module path (default: auto-generated)")
+	outputDir := flag.String("output-dir", "", "Output directory (default: auto-generated)")
+	apiVersion := flag.String("api-version", "v1beta1", "API version (ipam providers default to v1alpha1)")
+	withMachinePool := flag.Bool("with-machinepool", false, "Generate a MachinePool infrastructure type and controller (infrastructure only)")
+	dryRun := flag.Bool("dry-run", false, "Show which files would be created, overwritten or left unchanged without writing")
+	showDiff := flag.Bool("diff", false, "Print unified diffs for files that would be overwritten (implies --dry-run)")
+	cloudClient := flag.Bool("cloud-client", false, "Generate pkg/cloud with client interface, fake, scopes and Secret credentials (infrastructure only)")
+	renderCRDsFlag := flag.Bool("render-crds", false, "Pre-render CRD YAML into config/crd/bases so make install works without controller-gen")
+	noValidate := flag.Bool("no-validate", false, "Skip parsing and import/YAML validation of the generated files")
+	withWebhooks := flag.Bool("with-webhooks", false, "Generate defaulting/validating webhooks, conversion hub and cert-manager manifests")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "CAPI Provider Scaffolding Tool\nUsage: %s [flags] [update]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s -n mycloud -t infrastructure\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -n mycloud -t bootstrap --module github.com/org/capi-bootstrap-mycloud\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --output-dir ./cluster-api-provider-mycloud update\n", os.Args[0])
+	}
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "":
+	case "update":
+		// Regenerate from the recorded config; files edited since the last
+		// scaffold are preserved.
+		dir := *outputDir
+		if dir == "" {
+			dir = "."
+		}
+		prev, err := loadManifest(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "Error: no %s in %s (was it generated by scaffold-provider?)\n", manifestFile, dir)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			os.Exit(1)
+		}
+		scaffold(&prev.Config, scaffoldOptions{DryRun: *dryRun, Diff: *showDiff, NoValidate: *noValidate, Previous: prev})
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown command: %s (expected update)\n", flag.Arg(0))
+		os.Exit(1)
+	}
+
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "Error: -n (provider name) is required")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	validTypes := map[string]bool{"infrastructure": true, "bootstrap": true, "controlplane": true, "ipam": true}
+	if !validTypes[*provType] {
+		fmt.Fprintf(os.Stderr, "Error: invalid provider type: %s\n", *provType)
+		os.Exit(1)
+	}
+
+	cfg := defaultConfig(*name, *provType)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "api-version" {
+			cfg.APIVersion = *apiVersion
+		}
+	})
+	cfg.WithWebhooks = *withWebhooks
+	cfg.RenderCRDs = *renderCRDsFlag
+	if *cloudClient {
+		if *provType != "infrastructure" {
+			fmt.Fprintln(os.Stderr, "Error: --cloud-client is only supported for infrastructure providers")
+			os.Exit(1)
+		}
+		cfg.WithCloudClient = true
+	}
+	if *withMachinePool {
+		if *provType != "infrastructure" {
+			fmt.Fprintln(os.Stderr, "Error: --with-machinepool is only supported for infrastructure providers")
+			os.Exit(1)
+		}
+		cfg.MachinePoolKind = cfg.CapName() + "MachinePool"
+	}
+
+	if *module != "" {
+		cfg.Module = *module
+	}
+
+	if *outputDir != "" {
+		cfg.OutputDir = *outputDir
+	} else {
+		cfg.OutputDir = repoPrefix(*provType) + *name
 	}
 
-	scaffold(cfg)
+	scaffold(cfg, scaffoldOptions{DryRun: *dryRun, Diff: *showDiff, NoValidate: *noValidate})
 }
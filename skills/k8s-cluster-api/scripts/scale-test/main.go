@@ -0,0 +1,537 @@
+// scale-test measures how a management cluster copes with many workload clusters.
+//
+// It generates N synthetic clusters, applies them in batches, and measures
+// provisioning throughput, controller queue latency (time from creation until
+// a controller first observes the object) and API server load sampled from
+// the /metrics endpoint, then tears everything down.
+//
+// Two providers are supported:
+//   - docker: ClusterClass-based CAPD clusters (requires the CAPD quick-start
+//     ClusterClass); clusters count as provisioned when Ready.
+//   - dry: Clusters and MachineDeployments without infrastructure; nothing is
+//     provisioned, so only controller and API server load is measured.
+//
+// Usage:
+//
+//	go run ./scale-test [flags]
+//
+// Examples:
+//
+//	go run ./scale-test --count 50 --provider dry
+//	go run ./scale-test --count 10 --provider docker --class quick-start --k8s-version v1.30.0
+//	go run ./scale-test --count 100 --batch 20 --batch-interval 30s --provider dry --format json -o scale.json
+//	go run ./scale-test --count 5 --provider docker --keep
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+const runLabel = "scale-test.capi-tools/run"
+
+type config struct {
+	count         int
+	provider      string
+	namespace     string
+	class         string
+	version       string
+	workers       int
+	batch         int
+	batchInterval time.Duration
+	timeout       time.Duration
+	interval      time.Duration
+	keep          bool
+	runID         string
+	progress      io.Writer
+}
+
+type latencyStats struct {
+	Samples int    `json:"samples"`
+	P50     string `json:"p50,omitempty"`
+	P90     string `json:"p90,omitempty"`
+	Max     string `json:"max,omitempty"`
+}
+
+type apiLoad struct {
+	Samples             int     `json:"samples"`
+	RequestsPerSecond   float64 `json:"requests_per_second"`
+	MaxInflightMutating int     `json:"max_inflight_mutating"`
+	MaxInflightReadOnly int     `json:"max_inflight_read_only"`
+	Note                string  `json:"note,omitempty"`
+}
+
+type result struct {
+	RunID            string       `json:"run_id"`
+	Provider         string       `json:"provider"`
+	Namespace        string       `json:"namespace"`
+	Requested        int          `json:"requested"`
+	Created          int          `json:"created"`
+	Provisioned      int          `json:"provisioned"`
+	ApplyDuration    string       `json:"apply_duration"`
+	TotalDuration    string       `json:"total_duration"`
+	ThroughputPerMin float64      `json:"throughput_per_minute"`
+	Provisioning     latencyStats `json:"provisioning_time"`
+	QueueLatency     latencyStats `json:"queue_latency"`
+	APIServer        apiLoad      `json:"api_server"`
+	Teardown         string       `json:"teardown_duration,omitempty"`
+	TimedOut         bool         `json:"timed_out"`
+}
+
+func clusterName(cfg config, i int) string {
+	return fmt.Sprintf("st-%s-%03d", cfg.runID, i)
+}
+
+func manifest(cfg config, i int) string {
+	name := clusterName(cfg, i)
+	meta := fmt.Sprintf(`  namespace: %s
+  labels:
+    %s: "%s"`, cfg.namespace, runLabel, cfg.runID)
+
+	if cfg.provider == "docker" {
+		return fmt.Sprintf(`apiVersion: cluster.x-k8s.io/v1beta1
+kind: Cluster
+metadata:
+  name: %s
+%s
+spec:
+  clusterNetwork:
+    pods:
+      cidrBlocks: ["192.168.0.0/16"]
+    services:
+      cidrBlocks: ["10.128.0.0/12"]
+    serviceDomain: cluster.local
+  topology:
+    class: %s
+    version: %s
+    controlPlane:
+      replicas: 1
+    workers:
+      machineDeployments:
+        - class: default-worker
+          name: md-0
+          replicas: %d
+`, name, meta, cfg.class, cfg.version, cfg.workers)
+	}
+
+	// dry: no infrastructure or control plane provider is involved. The
+	// MachineDeployment has zero replicas, so no Machines are created.
+	return fmt.Sprintf(`apiVersion: cluster.x-k8s.io/v1beta1
+kind: Cluster
+metadata:
+  name: %[1]s
+%[2]s
+spec:
+  clusterNetwork:
+    pods:
+      cidrBlocks: ["192.168.0.0/16"]
+---
+apiVersion: cluster.x-k8s.io/v1beta1
+kind: MachineDeployment
+metadata:
+  name: %[1]s-md-0
+%[2]s
+    cluster.x-k8s.io/cluster-name: %[1]s
+spec:
+  clusterName: %[1]s
+  replicas: 0
+  selector:
+    matchLabels:
+      %[3]s: "%[4]s"
+      cluster.x-k8s.io/cluster-name: %[1]s
+  template:
+    metadata:
+      labels:
+        %[3]s: "%[4]s"
+        cluster.x-k8s.io/cluster-name: %[1]s
+    spec:
+      clusterName: %[1]s
+      version: %[5]s
+      bootstrap:
+        dataSecretName: %[1]s-bootstrap
+      infrastructureRef:
+        apiVersion: infrastructure.cluster.x-k8s.io/v1beta1
+        kind: DockerMachineTemplate
+        name: %[1]s-dry
+`, name, meta, runLabel, cfg.runID, cfg.version)
+}
+
+func apply(docs []string) error {
+	f, err := os.CreateTemp("", "scale-test-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(strings.Join(docs, "---\n")); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	ok, _, errMsg := kubectl.Run([]string{"apply", "-f", f.Name()}, 5*time.Minute)
+	if !ok {
+		return fmt.Errorf("kubectl apply: %s", strings.TrimSpace(errMsg))
+	}
+	return nil
+}
+
+// metricsSample holds the API server counters used to derive load.
+type metricsSample struct {
+	at               time.Time
+	requests         float64
+	inflightMutating int
+	inflightReadOnly int
+}
+
+func sampleMetrics() (metricsSample, bool) {
+	ok, out, _ := kubectl.Run([]string{"get", "--raw", "/metrics"}, 0)
+	if !ok {
+		return metricsSample{}, false
+	}
+	s := metricsSample{at: time.Now()}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "apiserver_request_total{"):
+			s.requests += v
+		case strings.HasPrefix(line, "apiserver_current_inflight_requests{") && strings.Contains(line, `request_kind="mutating"`):
+			s.inflightMutating = int(v)
+		case strings.HasPrefix(line, "apiserver_current_inflight_requests{") && strings.Contains(line, `request_kind="readOnly"`):
+			s.inflightReadOnly = int(v)
+		}
+	}
+	return s, true
+}
+
+func stats(durations []time.Duration) latencyStats {
+	st := latencyStats{Samples: len(durations)}
+	if len(durations) == 0 {
+		return st
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	pct := func(p float64) time.Duration {
+		idx := int(math.Ceil(p*float64(len(durations)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return durations[idx]
+	}
+	st.P50 = pct(0.5).Round(time.Second).String()
+	st.P90 = pct(0.9).Round(time.Second).String()
+	st.Max = durations[len(durations)-1].Round(time.Second).String()
+	return st
+}
+
+func conditionTime(item map[string]interface{}, condType string) (time.Time, bool) {
+	for _, c := range kubectl.GetSlice(kubectl.GetMap(item, "status"), "conditions") {
+		cm, _ := c.(map[string]interface{})
+		if t, _ := cm["type"].(string); t == condType {
+			if s, _ := cm["status"].(string); s == "True" {
+				ltt, _ := cm["lastTransitionTime"].(string)
+				ts, err := time.Parse(time.RFC3339, ltt)
+				return ts, err == nil
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// queueLatency approximates controller queue latency as the time between
+// object creation and the earliest condition a controller wrote on it.
+func queueLatency(item map[string]interface{}) (time.Duration, bool) {
+	created, err := time.Parse(time.RFC3339, kubectl.GetString(item, "metadata.creationTimestamp"))
+	if err != nil {
+		return 0, false
+	}
+	var first time.Time
+	for _, c := range kubectl.GetSlice(kubectl.GetMap(item, "status"), "conditions") {
+		cm, _ := c.(map[string]interface{})
+		ltt, _ := cm["lastTransitionTime"].(string)
+		if ts, err := time.Parse(time.RFC3339, ltt); err == nil && (first.IsZero() || ts.Before(first)) {
+			first = ts
+		}
+	}
+	if first.IsZero() {
+		return 0, false
+	}
+	return first.Sub(created), true
+}
+
+func provisioned(cfg config, item map[string]interface{}) (time.Duration, bool) {
+	created, _ := time.Parse(time.RFC3339, kubectl.GetString(item, "metadata.creationTimestamp"))
+	if cfg.provider == "dry" {
+		gen, _ := kubectl.GetNested(item, "metadata.generation").(float64)
+		observed, _ := kubectl.GetNested(item, "status.observedGeneration").(float64)
+		if observed >= gen && observed > 0 {
+			if d, ok := queueLatency(item); ok {
+				return d, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	if t, ok := conditionTime(item, "Ready"); ok && kubectl.GetString(item, "status.phase") == "Provisioned" {
+		return t.Sub(created), true
+	}
+	return 0, false
+}
+
+// run applies the synthetic clusters, waits for them and tears them down.
+// Teardown only deletes the namespace when this run created it; an existing
+// namespace keeps everything but the objects labelled with the run ID.
+func run(cfg config) (result, error) {
+	res := result{RunID: cfg.runID, Provider: cfg.provider, Namespace: cfg.namespace, Requested: cfg.count}
+	start := time.Now()
+
+	createdNamespace, _, errMsg := kubectl.Run([]string{"create", "namespace", cfg.namespace}, 0)
+	if !createdNamespace && !strings.Contains(errMsg, "AlreadyExists") {
+		return res, fmt.Errorf("create namespace %s: %s", cfg.namespace, strings.TrimSpace(errMsg))
+	}
+
+	var samples []metricsSample
+	sample := func() {
+		if s, ok := sampleMetrics(); ok {
+			samples = append(samples, s)
+		}
+	}
+	sample()
+
+	for i := 0; i < cfg.count; i += cfg.batch {
+		var docs []string
+		for j := i; j < i+cfg.batch && j < cfg.count; j++ {
+			docs = append(docs, manifest(cfg, j))
+		}
+		if err := apply(docs); err != nil {
+			kubectl.Errorf("Error: %v", err)
+			break
+		}
+		res.Created += len(docs)
+		fmt.Fprintf(cfg.progress, "  applied %d/%d clusters\n", res.Created, cfg.count)
+		sample()
+		if i+cfg.batch < cfg.count {
+			time.Sleep(cfg.batchInterval)
+		}
+	}
+	res.ApplyDuration = time.Since(start).Round(time.Second).String()
+
+	deadline := start.Add(cfg.timeout)
+	var provTimes, queueTimes []time.Duration
+	var clusters []map[string]interface{}
+	selector := runLabel + "=" + cfg.runID
+	for {
+		clusters, _ = kubectl.RunJSON("clusters.cluster.x-k8s.io", cfg.namespace, selector, false)
+		provTimes = provTimes[:0]
+		for _, c := range clusters {
+			if d, ok := provisioned(cfg, c); ok {
+				provTimes = append(provTimes, d)
+			}
+		}
+		res.Provisioned = len(provTimes)
+		sample()
+		fmt.Fprintf(cfg.progress, "  %s provisioned %d/%d\n", time.Now().Format("15:04:05"), res.Provisioned, res.Created)
+		if res.Provisioned >= res.Created {
+			break
+		}
+		if time.Now().After(deadline) {
+			res.TimedOut = true
+			break
+		}
+		time.Sleep(cfg.interval)
+	}
+	total := time.Since(start)
+	res.TotalDuration = total.Round(time.Second).String()
+	if total > 0 {
+		res.ThroughputPerMin = math.Round(float64(res.Provisioned)/total.Minutes()*100) / 100
+	}
+	res.Provisioning = stats(provTimes)
+
+	// Topology-generated MachineDeployments and Machines do not carry the run
+	// label, so they are selected by the run's cluster names instead.
+	var names []string
+	for _, c := range clusters {
+		names = append(names, kubectl.GetString(c, "metadata.name"))
+	}
+	owned := clusters
+	if len(names) > 0 {
+		byCluster := "cluster.x-k8s.io/cluster-name in (" + strings.Join(names, ",") + ")"
+		for _, resource := range []string{"machinedeployments.cluster.x-k8s.io", "machines.cluster.x-k8s.io"} {
+			items, _ := kubectl.RunJSON(resource, cfg.namespace, byCluster, false)
+			owned = append(owned, items...)
+		}
+	}
+	for _, item := range owned {
+		if d, ok := queueLatency(item); ok {
+			queueTimes = append(queueTimes, d)
+		}
+	}
+	res.QueueLatency = stats(queueTimes)
+	res.APIServer = summarizeLoad(samples)
+
+	if !cfg.keep {
+		fmt.Fprintln(cfg.progress, "  tearing down...")
+		tdStart := time.Now()
+		kubectl.Run([]string{"delete", "clusters.cluster.x-k8s.io", "-n", cfg.namespace, "-l", selector, "--wait=true"}, cfg.timeout)
+		kubectl.Run([]string{"delete", "machinedeployments.cluster.x-k8s.io", "-n", cfg.namespace, "-l", selector, "--wait=true"}, cfg.timeout)
+		if createdNamespace {
+			kubectl.Run([]string{"delete", "namespace", cfg.namespace, "--wait=true"}, cfg.timeout)
+		}
+		res.Teardown = time.Since(tdStart).Round(time.Second).String()
+	}
+	return res, nil
+}
+
+func summarizeLoad(samples []metricsSample) apiLoad {
+	load := apiLoad{Samples: len(samples)}
+	if len(samples) < 2 {
+		load.Note = "API server /metrics not readable; grant get on nonResourceURL /metrics to measure load"
+		return load
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	if elapsed := last.at.Sub(first.at).Seconds(); elapsed > 0 {
+		load.RequestsPerSecond = math.Round((last.requests-first.requests)/elapsed*100) / 100
+	}
+	for _, s := range samples {
+		if s.inflightMutating > load.MaxInflightMutating {
+			load.MaxInflightMutating = s.inflightMutating
+		}
+		if s.inflightReadOnly > load.MaxInflightReadOnly {
+			load.MaxInflightReadOnly = s.inflightReadOnly
+		}
+	}
+	return load
+}
+
+func printResult(r result) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nSCALE TEST RESULTS (run %s, provider %s)\n%s\n", sep, r.RunID, r.Provider, sep)
+	fmt.Printf("  Clusters:       %d requested, %d created, %d provisioned\n", r.Requested, r.Created, r.Provisioned)
+	fmt.Printf("  Apply time:     %s\n", r.ApplyDuration)
+	fmt.Printf("  Total time:     %s\n", r.TotalDuration)
+	fmt.Printf("  Throughput:     %.2f clusters/min\n", r.ThroughputPerMin)
+	fmt.Printf("  Provisioning:   p50=%s p90=%s max=%s (%d samples)\n", orDash(r.Provisioning.P50), orDash(r.Provisioning.P90), orDash(r.Provisioning.Max), r.Provisioning.Samples)
+	fmt.Printf("  Queue latency:  p50=%s p90=%s max=%s (%d samples)\n", orDash(r.QueueLatency.P50), orDash(r.QueueLatency.P90), orDash(r.QueueLatency.Max), r.QueueLatency.Samples)
+	if r.APIServer.Note != "" {
+		fmt.Printf("  API server:     %s\n", r.APIServer.Note)
+	} else {
+		fmt.Printf("  API server:     %.2f req/s, max inflight mutating=%d readOnly=%d\n",
+			r.APIServer.RequestsPerSecond, r.APIServer.MaxInflightMutating, r.APIServer.MaxInflightReadOnly)
+	}
+	if r.Teardown != "" {
+		fmt.Printf("  Teardown:       %s\n", r.Teardown)
+	}
+	if r.TimedOut {
+		fmt.Println("\n⚠️  Timed out before all clusters were provisioned")
+	} else {
+		fmt.Println("\n✅ All clusters provisioned")
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func main() {
+	count := flag.Int("count", 10, "Number of synthetic clusters")
+	provider := flag.String("provider", "dry", "Provider: docker, dry")
+	namespace := flag.String("n", "", "Namespace for the test clusters (default: scale-test-<run-id>); only a namespace created by the run is deleted on teardown")
+	class := flag.String("class", "quick-start", "ClusterClass for the docker provider")
+	version := flag.String("k8s-version", "v1.30.0", "Kubernetes version")
+	workers := flag.Int("workers", 1, "Worker replicas per cluster (docker provider)")
+	batch := flag.Int("batch", 10, "Clusters applied per batch")
+	batchInterval := flag.Duration("batch-interval", 10*time.Second, "Pause between batches")
+	timeout := flag.Duration("timeout", 30*time.Minute, "Maximum time to wait for provisioning")
+	interval := flag.Duration("interval", 15*time.Second, "Polling interval")
+	keep := flag.Bool("keep", false, "Keep the clusters instead of tearing down")
+	dryRun := flag.Bool("dry-run", false, "Print the generated manifests and exit")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nCreate synthetic clusters and measure management cluster throughput and load.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *provider != "docker" && *provider != "dry" {
+		fmt.Fprintf(os.Stderr, "Error: unknown provider %q (use docker or dry)\n", *provider)
+		os.Exit(1)
+	}
+	if *count < 1 || *batch < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --count and --batch must be positive")
+		os.Exit(1)
+	}
+
+	cfg := config{
+		count: *count, provider: *provider, namespace: *namespace, class: *class,
+		version: *version, workers: *workers, batch: *batch, batchInterval: *batchInterval,
+		timeout: *timeout, interval: *interval, keep: *keep,
+		runID:    strconv.FormatInt(time.Now().Unix()%100000, 10),
+		progress: os.Stdout,
+	}
+	if *format != "text" {
+		cfg.progress = os.Stderr
+	}
+	if cfg.namespace == "" {
+		cfg.namespace = "scale-test-" + cfg.runID
+	}
+
+	if *dryRun {
+		for i := 0; i < cfg.count; i++ {
+			fmt.Print("---\n" + manifest(cfg, i))
+		}
+		return
+	}
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(cfg.progress, "Scale test %s: %d %s clusters in namespace %s\n", cfg.runID, cfg.count, cfg.provider, cfg.namespace)
+	res, err := run(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(res, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printResult(res)
+	}
+
+	if res.TimedOut {
+		os.Exit(1)
+	}
+}
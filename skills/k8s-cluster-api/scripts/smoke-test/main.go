@@ -0,0 +1,520 @@
+// smoke-test checks that a provisioned workload cluster actually works.
+//
+// It reads the cluster's kubeconfig from the management cluster and runs a
+// battery of checks against the workload cluster in a throwaway namespace:
+// API server readiness, Node readiness, scheduling a pod, reaching a pod
+// through a ClusterIP Service, in-cluster DNS, dynamic PVC provisioning and
+// LoadBalancer Service creation. Every check is recorded with pass/fail and
+// its duration; the namespace is deleted afterwards unless --keep is set.
+//
+// Usage:
+//
+//	go run ./smoke-test [flags] <cluster-name>
+//
+// Examples:
+//
+//	go run ./smoke-test -n default my-cluster
+//	go run ./smoke-test --checks api,nodes,pod,dns my-cluster
+//	go run ./smoke-test --storage-class standard --timeout 5m my-cluster
+//	go run ./smoke-test --format json -o smoke.json my-cluster
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+var checks = map[string]string{
+	"api":          "API server /readyz responds",
+	"nodes":        "All Nodes are Ready",
+	"pod":          "A pod is scheduled and becomes Ready",
+	"service":      "The pod is reachable through a ClusterIP Service",
+	"dns":          "kubernetes.default resolves from a pod",
+	"pvc":          "A PersistentVolumeClaim is provisioned and writable",
+	"loadbalancer": "A LoadBalancer Service gets an external address",
+}
+
+// checkOrder is the execution order; later checks reuse pods from earlier ones.
+var checkOrder = []string{"api", "nodes", "pod", "service", "dns", "pvc", "loadbalancer"}
+
+// requires lists checks that need another check's objects.
+var requires = map[string][]string{
+	"service":      {"pod"},
+	"dns":          {"pod"},
+	"loadbalancer": {"service"},
+}
+
+type result struct {
+	Check    string `json:"check"`
+	Passed   bool   `json:"passed"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	Duration string `json:"duration"`
+	Message  string `json:"message"`
+}
+
+type report struct {
+	Cluster       string    `json:"cluster"`
+	Namespace     string    `json:"namespace"`
+	TestNamespace string    `json:"test_namespace"`
+	StartedAt     string    `json:"started_at"`
+	Duration      string    `json:"duration"`
+	Results       []*result `json:"results"`
+	Passed        bool      `json:"passed"`
+}
+
+type runner struct {
+	kubeconfig   string
+	ns           string
+	image        string
+	storageClass string
+	timeout      time.Duration
+	interval     time.Duration
+}
+
+func (r *runner) kubectl(args ...string) (bool, string, string) {
+	return kubectl.Run(append([]string{"--kubeconfig", r.kubeconfig}, args...), r.timeout+30*time.Second)
+}
+
+func (r *runner) apply(manifest string) error {
+	f, err := os.CreateTemp("", "smoke-test-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(manifest); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	if ok, _, errMsg := r.kubectl("apply", "-n", r.ns, "-f", f.Name()); !ok {
+		return fmt.Errorf("apply: %s", strings.TrimSpace(errMsg))
+	}
+	return nil
+}
+
+func (r *runner) wait(resource, condition string) error {
+	ok, _, errMsg := r.kubectl("wait", "-n", r.ns, resource, "--for="+condition, "--timeout="+r.timeout.String())
+	if !ok {
+		return fmt.Errorf("%s not %s: %s", resource, strings.TrimPrefix(condition, "condition="), strings.TrimSpace(errMsg))
+	}
+	return nil
+}
+
+func (r *runner) exec(pod string, command ...string) (string, error) {
+	args := append([]string{"exec", "-n", r.ns, pod, "--"}, command...)
+	ok, out, errMsg := r.kubectl(args...)
+	if !ok {
+		return out, fmt.Errorf("%s", strings.TrimSpace(errMsg+" "+out))
+	}
+	return out, nil
+}
+
+func podManifest(name, image, command string, labels map[string]string, extra string) string {
+	var l strings.Builder
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&l, "\n    %s: %s", k, labels[k])
+	}
+	return fmt.Sprintf(`apiVersion: v1
+kind: Pod
+metadata:
+  name: %s
+  labels:
+    app.kubernetes.io/managed-by: smoke-test%s
+spec:
+  restartPolicy: Never
+  terminationGracePeriodSeconds: 0
+  tolerations:
+  - operator: Exists
+    effect: NoSchedule
+  containers:
+  - name: main
+    image: %s
+    command: ["sh", "-c", %q]%s
+`, name, l.String(), image, command, extra)
+}
+
+func (r *runner) checkAPI() (string, error) {
+	ok, out, errMsg := r.kubectl("get", "--raw", "/readyz")
+	if !ok {
+		return "", fmt.Errorf("/readyz: %s", strings.TrimSpace(errMsg))
+	}
+	return "/readyz: " + strings.TrimSpace(out), nil
+}
+
+func (r *runner) checkNodes() (string, error) {
+	ok, out, errMsg := r.kubectl("get", "nodes", "-o", "json")
+	if !ok {
+		return "", fmt.Errorf("list nodes: %s", strings.TrimSpace(errMsg))
+	}
+	nodes, err := kubectl.ParseItems(out)
+	if err != nil {
+		return "", err
+	}
+	if len(nodes) == 0 {
+		return "", fmt.Errorf("no nodes registered")
+	}
+	var notReady []string
+	for _, n := range nodes {
+		ready := false
+		for _, c := range kubectl.GetSlice(kubectl.GetMap(n, "status"), "conditions") {
+			cm, _ := c.(map[string]interface{})
+			if cm["type"] == "Ready" && cm["status"] == "True" {
+				ready = true
+			}
+		}
+		if !ready {
+			notReady = append(notReady, kubectl.GetString(n, "metadata.name"))
+		}
+	}
+	if len(notReady) > 0 {
+		return "", fmt.Errorf("%d/%d nodes not Ready: %s", len(notReady), len(nodes), strings.Join(notReady, ", "))
+	}
+	return fmt.Sprintf("%d nodes Ready", len(nodes)), nil
+}
+
+func (r *runner) checkPod() (string, error) {
+	if err := r.apply(podManifest("smoke-client", r.image, "sleep 3600", nil, "")); err != nil {
+		return "", err
+	}
+	if err := r.wait("pod/smoke-client", "condition=Ready"); err != nil {
+		return "", err
+	}
+	ok, node, _ := r.kubectl("get", "pod", "smoke-client", "-n", r.ns, "-o", "jsonpath={.spec.nodeName}")
+	if !ok {
+		node = "unknown node"
+	}
+	return "smoke-client Ready on " + node, nil
+}
+
+func (r *runner) checkService() (string, error) {
+	server := podManifest("smoke-server", r.image, "echo smoke-ok > /tmp/index.html && httpd -f -p 8080 -h /tmp",
+		map[string]string{"smoke-test/role": "server"}, "\n    ports:\n    - containerPort: 8080")
+	service := `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: smoke-server
+spec:
+  selector:
+    smoke-test/role: server
+  ports:
+  - port: 80
+    targetPort: 8080
+`
+	if err := r.apply(server + service); err != nil {
+		return "", err
+	}
+	if err := r.wait("pod/smoke-server", "condition=Ready"); err != nil {
+		return "", err
+	}
+	var lastErr error
+	deadline := time.Now().Add(r.timeout)
+	for time.Now().Before(deadline) {
+		out, err := r.exec("smoke-client", "wget", "-q", "-O-", "-T", "5", "http://smoke-server."+r.ns+".svc")
+		if err == nil && strings.Contains(out, "smoke-ok") {
+			return "smoke-client reached smoke-server via ClusterIP", nil
+		}
+		lastErr = err
+		time.Sleep(r.interval)
+	}
+	return "", fmt.Errorf("service not reachable within %s: %v", r.timeout, lastErr)
+}
+
+func (r *runner) checkDNS() (string, error) {
+	var lastErr error
+	deadline := time.Now().Add(r.timeout)
+	for time.Now().Before(deadline) {
+		out, err := r.exec("smoke-client", "nslookup", "kubernetes.default.svc.cluster.local")
+		if err == nil {
+			for _, line := range strings.Split(out, "\n") {
+				if strings.HasPrefix(strings.TrimSpace(line), "Address") && !strings.Contains(line, "#53") {
+					return "kubernetes.default resolved: " + strings.TrimSpace(line), nil
+				}
+			}
+		}
+		lastErr = err
+		time.Sleep(r.interval)
+	}
+	return "", fmt.Errorf("DNS lookup failed within %s: %v", r.timeout, lastErr)
+}
+
+func (r *runner) checkPVC() (string, error) {
+	class := ""
+	if r.storageClass != "" {
+		class = "\n  storageClassName: " + r.storageClass
+	} else {
+		ok, out, _ := r.kubectl("get", "storageclasses", "-o", "json")
+		items, _ := kubectl.ParseItems(out)
+		found := false
+		for _, sc := range items {
+			annotations, _ := kubectl.GetNested(sc, "metadata.annotations").(map[string]interface{})
+			if annotations["storageclass.kubernetes.io/is-default-class"] == "true" {
+				found = true
+			}
+		}
+		if !ok || !found {
+			return "", fmt.Errorf("no default StorageClass; pass --storage-class")
+		}
+	}
+	pvc := fmt.Sprintf(`apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: smoke-pvc
+spec:
+  accessModes: ["ReadWriteOnce"]
+  resources:
+    requests:
+      storage: 1Gi%s
+---
+`, class)
+	writer := podManifest("smoke-pvc-writer", r.image, "echo smoke-ok > /data/probe && cat /data/probe", nil,
+		"\n    volumeMounts:\n    - name: data\n      mountPath: /data\n  volumes:\n  - name: data\n    persistentVolumeClaim:\n      claimName: smoke-pvc")
+	if err := r.apply(pvc + writer); err != nil {
+		return "", err
+	}
+	if err := r.wait("pod/smoke-pvc-writer", "jsonpath={.status.phase}=Succeeded"); err != nil {
+		return "", err
+	}
+	_, pv, _ := r.kubectl("get", "pvc", "smoke-pvc", "-n", r.ns, "-o", "jsonpath={.spec.volumeName}")
+	return "smoke-pvc bound to " + pv + " and written", nil
+}
+
+func (r *runner) checkLoadBalancer() (string, error) {
+	service := `apiVersion: v1
+kind: Service
+metadata:
+  name: smoke-lb
+spec:
+  type: LoadBalancer
+  selector:
+    smoke-test/role: server
+  ports:
+  - port: 80
+    targetPort: 8080
+`
+	if err := r.apply(service); err != nil {
+		return "", err
+	}
+	deadline := time.Now().Add(r.timeout)
+	for time.Now().Before(deadline) {
+		ok, out, _ := r.kubectl("get", "service", "smoke-lb", "-n", r.ns,
+			"-o", "jsonpath={.status.loadBalancer.ingress[0].ip}{.status.loadBalancer.ingress[0].hostname}")
+		if ok && strings.TrimSpace(out) != "" {
+			return "smoke-lb address " + strings.TrimSpace(out), nil
+		}
+		time.Sleep(r.interval)
+	}
+	return "", fmt.Errorf("no LoadBalancer address within %s (is a cloud provider or LB controller installed?)", r.timeout)
+}
+
+func (r *runner) run(name string) (string, error) {
+	switch name {
+	case "api":
+		return r.checkAPI()
+	case "nodes":
+		return r.checkNodes()
+	case "pod":
+		return r.checkPod()
+	case "service":
+		return r.checkService()
+	case "dns":
+		return r.checkDNS()
+	case "pvc":
+		return r.checkPVC()
+	case "loadbalancer":
+		return r.checkLoadBalancer()
+	}
+	return "", fmt.Errorf("unknown check %q", name)
+}
+
+// selectChecks resolves the requested checks plus their dependencies, in
+// execution order.
+func selectChecks(list string) ([]string, error) {
+	want := map[string]bool{}
+	var add func(string)
+	add = func(c string) {
+		want[c] = true
+		for _, dep := range requires[c] {
+			add(dep)
+		}
+	}
+	for _, c := range strings.Split(list, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if _, ok := checks[c]; !ok {
+			return nil, fmt.Errorf("unknown check %q", c)
+		}
+		add(c)
+	}
+	var selected []string
+	for _, c := range checkOrder {
+		if want[c] {
+			selected = append(selected, c)
+		}
+	}
+	return selected, nil
+}
+
+func printReport(rep *report) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nSMOKE TEST: %s/%s\n%s\n", sep, rep.Namespace, rep.Cluster, sep)
+	fmt.Printf("  Test namespace: %s\n", rep.TestNamespace)
+	fmt.Printf("  Started:        %s\n\n", rep.StartedAt)
+	for _, res := range rep.Results {
+		icon := "✅"
+		if res.Skipped {
+			icon = "⏭️"
+		} else if !res.Passed {
+			icon = "❌"
+		}
+		fmt.Printf("  %s %-13s %8s  %s\n", icon, res.Check, res.Duration, res.Message)
+	}
+	if rep.Passed {
+		fmt.Printf("\n✅ PASS: all checks passed in %s\n", rep.Duration)
+	} else {
+		fmt.Printf("\n❌ FAIL: cluster is not fully functional\n")
+	}
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace of the cluster")
+	checkList := flag.String("checks", strings.Join(checkOrder, ","), "Comma-separated checks to run")
+	image := flag.String("image", "busybox:1.36", "Image for test pods (needs sh, httpd, wget, nslookup)")
+	storageClass := flag.String("storage-class", "", "StorageClass for the pvc check (default: cluster default)")
+	timeout := flag.Duration("timeout", 3*time.Minute, "Timeout per check")
+	interval := flag.Duration("interval", 5*time.Second, "Polling interval")
+	keep := flag.Bool("keep", false, "Keep the test namespace after the run")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <cluster-name>\n\nRun functional smoke checks against a workload cluster.\n\nChecks:\n", os.Args[0])
+		for _, c := range checkOrder {
+			fmt.Fprintf(os.Stderr, "  %-13s %s\n", c, checks[c])
+		}
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	cluster := flag.Arg(0)
+	selected, err := selectChecks(*checkList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	kubeconfig, err := kubectl.WorkloadKubeconfig(cluster, *namespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer os.Remove(kubeconfig)
+
+	start := time.Now()
+	r := &runner{
+		kubeconfig:   kubeconfig,
+		ns:           fmt.Sprintf("capi-smoke-%d", start.Unix()),
+		image:        *image,
+		storageClass: *storageClass,
+		timeout:      *timeout,
+		interval:     *interval,
+	}
+	rep := &report{
+		Cluster:       cluster,
+		Namespace:     *namespace,
+		TestNamespace: r.ns,
+		StartedAt:     start.Format(time.RFC3339),
+		Passed:        true,
+	}
+
+	needsNamespace := false
+	for _, c := range selected {
+		if c != "api" && c != "nodes" {
+			needsNamespace = true
+		}
+	}
+	if needsNamespace {
+		if ok, _, errMsg := r.kubectl("create", "namespace", r.ns); !ok {
+			fmt.Fprintf(os.Stderr, "Error: create namespace %s: %s\n", r.ns, strings.TrimSpace(errMsg))
+			os.Exit(1)
+		}
+		if !*keep {
+			defer r.kubectl("delete", "namespace", r.ns, "--wait=false")
+		}
+	}
+
+	failed := map[string]bool{}
+	for _, c := range selected {
+		res := &result{Check: c}
+		for _, dep := range requires[c] {
+			if failed[dep] {
+				res.Skipped = true
+				res.Message = "skipped: " + dep + " failed"
+			}
+		}
+		if !res.Skipped {
+			fmt.Fprintf(os.Stderr, "Running %s...\n", c)
+			t := time.Now()
+			msg, err := r.run(c)
+			res.Duration = time.Since(t).Round(100 * time.Millisecond).String()
+			res.Passed = err == nil
+			res.Message = msg
+			if err != nil {
+				res.Message = err.Error()
+			}
+		}
+		if !res.Passed {
+			failed[c] = true
+			rep.Passed = false
+		}
+		rep.Results = append(rep.Results, res)
+	}
+	rep.Duration = time.Since(start).Round(time.Second).String()
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(rep, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(rep)
+	}
+
+	if !rep.Passed {
+		if needsNamespace && !*keep {
+			r.kubectl("delete", "namespace", r.ns, "--wait=false")
+		}
+		os.Remove(kubeconfig)
+		os.Exit(1)
+	}
+}
@@ -8,12 +8,20 @@
 //
 //	go run ./timeline-events my-cluster -n default
 //	go run ./timeline-events my-cluster --since 1h --format json
+//	go run ./timeline-events --slo 15m my-cluster
+//	go run ./timeline-events --all-clusters -n team-a
+//	go run ./timeline-events -A --slo 20m --format json
+//	go run ./timeline-events --format mermaid -o timeline.mmd my-cluster
+//	go run ./timeline-events --format html -o timeline.html my-cluster
+//	go run ./timeline-events --record events.json -A
+//	go run ./timeline-events --from-record events.json my-cluster
 package main
 
 import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"html"
 	"os"
 	"regexp"
 	"sort"
@@ -87,19 +95,28 @@ func parseTimestamp(s string) (time.Time, bool) {
 	return time.Time{}, false
 }
 
-func getEvents(clusterName, namespace string, since time.Duration) []timelineEvent {
-	var events []timelineEvent
+// eventItems caches the events of each namespace, so --all-clusters reads
+// them once per namespace rather than once per cluster.
+var eventItems = map[string][]interface{}{}
 
-	ok, stdout, _ := kubectl.Run([]string{"get", "events", "-n", namespace, "-o", "json"}, 0)
-	if !ok {
-		return events
+func namespaceEvents(namespace string) []interface{} {
+	if items, ok := eventItems[namespace]; ok {
+		return items
 	}
-
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(stdout), &data); err != nil {
-		return events
+	var items []interface{}
+	if ok, stdout, _ := kubectl.Run([]string{"get", "events", "-n", namespace, "-o", "json"}, 0); ok {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(stdout), &data); err == nil {
+			items, _ = data["items"].([]interface{})
+		}
 	}
-	items, _ := data["items"].([]interface{})
+	eventItems[namespace] = items
+	return items
+}
+
+func getEvents(clusterName, namespace string, since time.Duration) []timelineEvent {
+	var events []timelineEvent
+	items := namespaceEvents(namespace)
 
 	var cutoff time.Time
 	if since > 0 {
@@ -205,6 +222,20 @@ func getConditionEvents(clusterName, namespace string, cutoff time.Time) []timel
 				name = "unknown"
 			}
 
+			// Creation starts the provisioning phases of the Cluster and the
+			// bars of the Gantt export.
+			created, _ := meta["creationTimestamp"].(string)
+			if ts, ok := parseTimestamp(created); ok && (cutoff.IsZero() || !ts.Before(cutoff)) {
+				events = append(events, timelineEvent{
+					Timestamp: ts,
+					Kind:      kind,
+					Name:      name,
+					EventType: "Normal",
+					Reason:    "Created",
+					Message:   kind + " created",
+				})
+			}
+
 			status := kubectl.GetMap(item, "status")
 			conds := kubectl.GetSlice(status, "conditions")
 			if len(conds) == 0 {
@@ -256,6 +287,292 @@ func getConditionEvents(clusterName, namespace string, cutoff time.Time) []timel
 	return events
 }
 
+// milestones are the provisioning steps phases are measured between, in
+// order. Each is reached by the first matching event of the timeline.
+var milestones = []struct {
+	name  string
+	kind  string
+	match func(reason string) bool
+}{
+	{"Created", "Cluster", func(r string) bool { return r == "Created" }},
+	{"InfrastructureReady", "Cluster", func(r string) bool { return r == "InfrastructureReady=True" }},
+	{"ControlPlaneInitialized", "Cluster", func(r string) bool { return r == "ControlPlaneInitialized=True" }},
+	{"FirstMachineReady", "Machine", func(r string) bool { return r == "Ready=True" }},
+	// v1beta2 Clusters report Available instead of Ready.
+	{"ClusterReady", "Cluster", func(r string) bool { return r == "Ready=True" || r == "Available=True" }},
+}
+
+type phase struct {
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Seconds  float64       `json:"duration_seconds"`
+	Duration time.Duration `json:"-"`
+}
+
+// phaseReport breaks provisioning down into the time between milestones.
+// Total runs from creation to ClusterReady, or to now while the cluster is
+// still provisioning.
+type phaseReport struct {
+	Reached      map[string]time.Time `json:"milestones"`
+	Phases       []phase              `json:"phases"`
+	Complete     bool                 `json:"complete"`
+	Total        time.Duration        `json:"-"`
+	TotalSeconds float64              `json:"total_seconds"`
+	SLO          time.Duration        `json:"-"`
+	SLOSeconds   float64              `json:"slo_seconds,omitempty"`
+	SLOMet       *bool                `json:"slo_met,omitempty"`
+}
+
+func buildPhases(events []timelineEvent, clusterName string, slo time.Duration, now time.Time) phaseReport {
+	report := phaseReport{Reached: map[string]time.Time{}}
+	for _, m := range milestones {
+		for _, e := range events {
+			if e.Kind != m.kind || !m.match(e.Reason) {
+				continue
+			}
+			if m.kind == "Cluster" && e.Name != clusterName {
+				continue
+			}
+			if t, ok := report.Reached[m.name]; !ok || e.Timestamp.Before(t) {
+				report.Reached[m.name] = e.Timestamp
+			}
+		}
+	}
+	for i := 1; i < len(milestones); i++ {
+		from, ok1 := report.Reached[milestones[i-1].name]
+		to, ok2 := report.Reached[milestones[i].name]
+		if !ok1 || !ok2 {
+			continue
+		}
+		d := to.Sub(from)
+		if d < 0 {
+			d = 0
+		}
+		report.Phases = append(report.Phases, phase{milestones[i-1].name, milestones[i].name, d.Seconds(), d})
+	}
+	created, hasCreated := report.Reached["Created"]
+	ready, hasReady := report.Reached["ClusterReady"]
+	report.Complete = hasReady
+	switch {
+	case hasCreated && hasReady:
+		report.Total = ready.Sub(created)
+	case hasCreated:
+		report.Total = now.Sub(created)
+	}
+	report.TotalSeconds = report.Total.Seconds()
+	if slo > 0 && hasCreated {
+		met := report.Total <= slo
+		report.SLO, report.SLOSeconds, report.SLOMet = slo, slo.Seconds(), &met
+	}
+	return report
+}
+
+func printPhases(report phaseReport, slo time.Duration) {
+	sep := strings.Repeat("=", 50)
+	fmt.Printf("\n%s\nPROVISIONING PHASES\n%s\n", sep, sep)
+	if _, ok := report.Reached["Created"]; !ok {
+		fmt.Println("Cluster creation time unknown (outside --since window or cluster not found)")
+	}
+	for _, p := range report.Phases {
+		fmt.Printf("  %-48s %s\n", p.From+" → "+p.To, p.Duration.Round(time.Second))
+	}
+	for _, m := range milestones {
+		if _, ok := report.Reached[m.name]; !ok {
+			fmt.Printf("  %-48s pending\n", m.name)
+		}
+	}
+	if report.Complete {
+		fmt.Printf("\nTotal provisioning: %s\n", report.Total.Round(time.Second))
+	} else if report.Total > 0 {
+		fmt.Printf("\nStill provisioning after %s\n", report.Total.Round(time.Second))
+	}
+	if slo > 0 {
+		switch {
+		case report.SLOMet == nil:
+			fmt.Printf("SLO %s: unknown\n", slo)
+		case *report.SLOMet:
+			fmt.Printf("SLO %s: ✓ met\n", slo)
+		default:
+			fmt.Printf("SLO %s: ✗ exceeded by %s\n", slo, (report.Total - slo).Round(time.Second))
+		}
+	}
+}
+
+// ganttBar is one row of the Gantt export. A bar that is not done is still
+// running and ends now.
+type ganttBar struct {
+	Section string
+	Label   string
+	Start   time.Time
+	End     time.Time
+	Done    bool
+}
+
+// ganttBars lays out the cluster's provisioning phases, followed by a bar per
+// KubeadmControlPlane and Machine from creation to Ready. Machines named after
+// a KubeadmControlPlane are shown with the control plane.
+func ganttBars(t clusterTimeline, now time.Time) []ganttBar {
+	var bars []ganttBar
+	for _, p := range t.Phases.Phases {
+		bars = append(bars, ganttBar{"Cluster", p.From + " → " + p.To, t.Phases.Reached[p.From], t.Phases.Reached[p.To], true})
+	}
+	if !t.Phases.Complete {
+		for i := len(milestones) - 2; i >= 0; i-- {
+			if from, ok := t.Phases.Reached[milestones[i].name]; ok {
+				bars = append(bars, ganttBar{"Cluster", milestones[i].name + " → " + milestones[len(milestones)-1].name, from, now, false})
+				break
+			}
+		}
+	}
+
+	type object struct {
+		kind, name string
+	}
+	var objects []object
+	first := map[object]time.Time{}
+	ready := map[object]time.Time{}
+	var controlPlanes []string
+	for _, e := range t.Events {
+		if e.Kind != "Machine" && e.Kind != "KubeadmControlPlane" {
+			continue
+		}
+		o := object{e.Kind, e.Name}
+		if _, ok := first[o]; !ok {
+			objects = append(objects, o)
+			first[o] = e.Timestamp
+			if e.Kind == "KubeadmControlPlane" {
+				controlPlanes = append(controlPlanes, e.Name)
+			}
+		}
+		if e.Reason == "Created" {
+			first[o] = e.Timestamp
+		}
+		if _, ok := ready[o]; !ok && (e.Reason == "Ready=True" || e.Reason == "Available=True") {
+			ready[o] = e.Timestamp
+		}
+	}
+	for _, o := range objects {
+		section := "Machines"
+		if o.kind == "KubeadmControlPlane" {
+			section = "Control plane"
+		}
+		for _, cp := range controlPlanes {
+			if strings.HasPrefix(o.name, cp+"-") {
+				section = "Control plane"
+			}
+		}
+		bar := ganttBar{section, o.name, first[o], now, false}
+		if end, ok := ready[o]; ok && !end.Before(bar.Start) {
+			bar.End, bar.Done = end, true
+		}
+		bars = append(bars, bar)
+	}
+	sort.SliceStable(bars, func(i, j int) bool {
+		order := map[string]int{"Cluster": 0, "Control plane": 1, "Machines": 2}
+		return order[bars[i].Section] < order[bars[j].Section]
+	})
+	return bars
+}
+
+// exportMermaid renders a Mermaid gantt chart with one group of sections per
+// cluster.
+func exportMermaid(timelines []clusterTimeline, now time.Time) string {
+	var b strings.Builder
+	b.WriteString("gantt\n")
+	if len(timelines) == 1 {
+		fmt.Fprintf(&b, "  title Provisioning timeline for %s\n", timelines[0].key())
+	} else {
+		b.WriteString("  title Provisioning timelines\n")
+	}
+	b.WriteString("  dateFormat YYYY-MM-DD HH:mm:ss\n  axisFormat %H:%M\n")
+	// Colons and semicolons separate task fields in Mermaid.
+	clean := strings.NewReplacer(":", " ", ";", " ", "#", " ")
+	const layout = "2006-01-02 15:04:05"
+	for _, t := range timelines {
+		section := ""
+		for _, bar := range ganttBars(t, now) {
+			if bar.Section != section {
+				section = bar.Section
+				name := section
+				if len(timelines) > 1 {
+					name = t.key() + " " + section
+				}
+				fmt.Fprintf(&b, "  section %s\n", clean.Replace(name))
+			}
+			status := "active"
+			if bar.Done {
+				status = "done"
+			}
+			fmt.Fprintf(&b, "  %s :%s, %s, %s\n", clean.Replace(bar.Label), status,
+				bar.Start.UTC().Format(layout), bar.End.UTC().Format(layout))
+		}
+	}
+	return b.String()
+}
+
+// exportHTML renders a self-contained HTML page with a CSS Gantt chart per
+// cluster; it needs no scripts or assets.
+func exportHTML(timelines []clusterTimeline, now time.Time) string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Provisioning Timeline</title>
+<style>
+body{font-family:sans-serif;margin:2em;color:#24292e}
+table{border-collapse:collapse;width:100%;margin-bottom:2em}
+th,td{border-bottom:1px solid #e1e4e8;padding:4px 8px;text-align:left;white-space:nowrap}
+td.track{width:60%;position:relative}
+.bar{position:absolute;top:25%;height:50%;min-width:2px;border-radius:3px}
+.done{background:#28a745}
+.active{background:repeating-linear-gradient(45deg,#dbab09,#dbab09 6px,#f1d56b 6px,#f1d56b 12px)}
+</style></head><body>
+<h1>Provisioning Timeline</h1>
+`)
+	fmt.Fprintf(&b, "<p>Generated %s</p>\n", now.Format("2006-01-02 15:04:05 UTC"))
+	for _, t := range timelines {
+		fmt.Fprintf(&b, "<h2>%s</h2>\n", html.EscapeString(t.key()))
+		bars := ganttBars(t, now)
+		if len(bars) == 0 {
+			b.WriteString("<p>No provisioning phases found.</p>\n")
+			continue
+		}
+		start, end := bars[0].Start, bars[0].End
+		for _, bar := range bars {
+			if bar.Start.Before(start) {
+				start = bar.Start
+			}
+			if bar.End.After(end) {
+				end = bar.End
+			}
+		}
+		span := end.Sub(start).Seconds()
+		if span <= 0 {
+			span = 1
+		}
+		switch {
+		case t.Phases.Complete:
+			fmt.Fprintf(&b, "<p>Total provisioning: %s</p>\n", t.Phases.Total.Round(time.Second))
+		case t.Phases.Total > 0:
+			fmt.Fprintf(&b, "<p>Still provisioning after %s</p>\n", t.Phases.Total.Round(time.Second))
+		}
+		fmt.Fprintf(&b, "<table><tr><th>Section</th><th>Phase</th><th>%s – %s</th><th>Duration</th></tr>\n",
+			start.UTC().Format("15:04:05"), end.UTC().Format("15:04:05"))
+		for _, bar := range bars {
+			status := "active"
+			if bar.Done {
+				status = "done"
+			}
+			d := bar.End.Sub(bar.Start).Round(time.Second)
+			fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td class=\"track\"><span class=\"bar %s\" style=\"left:%.1f%%;width:%.1f%%\" title=\"%s – %s\"></span></td><td>%s</td></tr>\n",
+				html.EscapeString(bar.Section), html.EscapeString(bar.Label), status,
+				bar.Start.Sub(start).Seconds()*100/span, d.Seconds()*100/span,
+				bar.Start.UTC().Format("15:04:05"), bar.End.UTC().Format("15:04:05"), d)
+		}
+		b.WriteString("</table>\n")
+	}
+	b.WriteString("</body></html>\n")
+	return b.String()
+}
+
 func printTimeline(events []timelineEvent, verbose bool) {
 	if len(events) == 0 {
 		fmt.Println("No events found")
@@ -328,18 +645,19 @@ func printSummary(events []timelineEvent) {
 	}
 }
 
-func exportJSON(events []timelineEvent) string {
-	type entry struct {
-		Timestamp string `json:"timestamp"`
-		Kind      string `json:"kind"`
-		Name      string `json:"name"`
-		Type      string `json:"type"`
-		Reason    string `json:"reason"`
-		Message   string `json:"message"`
-	}
-	var out []entry
+type eventEntry struct {
+	Timestamp string `json:"timestamp"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+}
+
+func eventEntries(events []timelineEvent) []eventEntry {
+	out := []eventEntry{}
 	for _, e := range events {
-		out = append(out, entry{
+		out = append(out, eventEntry{
 			Timestamp: e.Timestamp.Format(time.RFC3339),
 			Kind:      e.Kind,
 			Name:      e.Name,
@@ -348,55 +666,405 @@ func exportJSON(events []timelineEvent) string {
 			Message:   e.Message,
 		})
 	}
+	return out
+}
+
+func exportJSON(events []timelineEvent, phases phaseReport) string {
+	out := struct {
+		Events []eventEntry `json:"events"`
+		Phases phaseReport  `json:"phases"`
+	}{eventEntries(events), phases}
+	data, _ := json.MarshalIndent(out, "", "  ")
+	return string(data)
+}
+
+// recordedEvent is a timeline event kept in a --record file, tagged with the
+// cluster it belongs to.
+type recordedEvent struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	eventEntry
+}
+
+// eventRecord is the --record file. Kubernetes drops events after about an
+// hour, so each run merges what it sees into the record and timelines can be
+// rebuilt from it with --from-record long after the events are gone.
+type eventRecord struct {
+	Events []recordedEvent `json:"events"`
+}
+
+// loadRecord reads a record file. A missing file is an empty record unless
+// mustExist is set.
+func loadRecord(path string, mustExist bool) (*eventRecord, error) {
+	rec := &eventRecord{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !mustExist {
+		return rec, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rec, nil
+}
+
+// add merges the events of a cluster into the record and returns how many
+// were new.
+func (r *eventRecord) add(namespace, cluster string, events []timelineEvent) int {
+	seen := map[recordedEvent]bool{}
+	for _, e := range r.Events {
+		seen[e] = true
+	}
+	added := 0
+	for _, e := range eventEntries(events) {
+		re := recordedEvent{cluster, namespace, e}
+		if !seen[re] {
+			seen[re] = true
+			r.Events = append(r.Events, re)
+			added++
+		}
+	}
+	return added
+}
+
+// events returns the recorded timeline of a cluster, oldest first.
+func (r *eventRecord) events(namespace, cluster string, since time.Duration) []timelineEvent {
+	var cutoff time.Time
+	if since > 0 {
+		cutoff = time.Now().UTC().Add(-since)
+	}
+	var events []timelineEvent
+	for _, e := range r.Events {
+		if e.Cluster != cluster || e.Namespace != namespace {
+			continue
+		}
+		ts, ok := parseTimestamp(e.Timestamp)
+		if !ok || (!cutoff.IsZero() && ts.Before(cutoff)) {
+			continue
+		}
+		events = append(events, timelineEvent{ts, e.Kind, e.Name, e.Type, e.Reason, e.Message})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+	return events
+}
+
+// clusters lists the recorded clusters of a namespace, or of all namespaces.
+func (r *eventRecord) clusters(namespace string, allNS bool) []clusterTimeline {
+	seen := map[string]bool{}
+	var out []clusterTimeline
+	for _, e := range r.Events {
+		t := clusterTimeline{Namespace: e.Namespace, Name: e.Cluster}
+		if (allNS || e.Namespace == namespace) && !seen[t.key()] {
+			seen[t.key()] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (r *eventRecord) save(path string) error {
+	sort.SliceStable(r.Events, func(i, j int) bool { return r.Events[i].Timestamp < r.Events[j].Timestamp })
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// clusterTimeline is the timeline of one cluster in --all-clusters mode.
+type clusterTimeline struct {
+	Namespace string
+	Name      string
+	Events    []timelineEvent
+	Phases    phaseReport
+}
+
+func (t clusterTimeline) key() string {
+	return t.Namespace + "/" + t.Name
+}
+
+// fleetSummary aggregates the timelines of --all-clusters mode. Provisioning
+// times only cover clusters that reached ClusterReady.
+type fleetSummary struct {
+	Clusters     int     `json:"clusters"`
+	Ready        int     `json:"ready"`
+	Events       int     `json:"events"`
+	Warnings     int     `json:"warnings"`
+	AvgSeconds   float64 `json:"avg_provisioning_seconds,omitempty"`
+	MaxSeconds   float64 `json:"max_provisioning_seconds,omitempty"`
+	Slowest      string  `json:"slowest,omitempty"`
+	SLOMet       int     `json:"slo_met,omitempty"`
+	SLOExceeded  int     `json:"slo_exceeded,omitempty"`
+	SLOUnknown   int     `json:"slo_unknown,omitempty"`
+	avg, maximum time.Duration
+}
+
+func summarizeFleet(timelines []clusterTimeline, slo time.Duration) fleetSummary {
+	s := fleetSummary{Clusters: len(timelines)}
+	var total time.Duration
+	for _, t := range timelines {
+		s.Events += len(t.Events)
+		for _, e := range t.Events {
+			if e.EventType == "Warning" {
+				s.Warnings++
+			}
+		}
+		if t.Phases.Complete {
+			s.Ready++
+			total += t.Phases.Total
+			if t.Phases.Total > s.maximum {
+				s.maximum, s.Slowest = t.Phases.Total, t.key()
+			}
+		}
+		if slo > 0 {
+			switch {
+			case t.Phases.SLOMet == nil:
+				s.SLOUnknown++
+			case *t.Phases.SLOMet:
+				s.SLOMet++
+			default:
+				s.SLOExceeded++
+			}
+		}
+	}
+	if s.Ready > 0 {
+		s.avg = total / time.Duration(s.Ready)
+	}
+	s.AvgSeconds, s.MaxSeconds = s.avg.Seconds(), s.maximum.Seconds()
+	return s
+}
+
+func printFleetSummary(timelines []clusterTimeline, s fleetSummary, slo time.Duration) {
+	sep := strings.Repeat("=", 50)
+	fmt.Printf("\n%s\nCROSS-CLUSTER SUMMARY\n%s\n", sep, sep)
+	fmt.Printf("%-32s %7s %9s %13s  %s\n", "CLUSTER", "EVENTS", "WARNINGS", "PROVISIONING", "STATUS")
+	for _, t := range timelines {
+		warnings := 0
+		for _, e := range t.Events {
+			if e.EventType == "Warning" {
+				warnings++
+			}
+		}
+		took, status := "-", "Unknown"
+		if t.Phases.Total > 0 {
+			took = t.Phases.Total.Round(time.Second).String()
+		}
+		if t.Phases.Complete {
+			status = "Ready"
+		} else if _, ok := t.Phases.Reached["Created"]; ok {
+			status = "Provisioning"
+		}
+		if t.Phases.SLOMet != nil && !*t.Phases.SLOMet {
+			status += " (SLO exceeded)"
+		}
+		fmt.Printf("%-32s %7d %9d %13s  %s\n", t.key(), len(t.Events), warnings, took, status)
+	}
+	fmt.Printf("\nClusters: %d (%d ready)\n", s.Clusters, s.Ready)
+	fmt.Printf("Events: %d (%d warnings)\n", s.Events, s.Warnings)
+	if s.Ready > 0 {
+		fmt.Printf("Provisioning time: avg %s, max %s (%s)\n", s.avg.Round(time.Second), s.maximum.Round(time.Second), s.Slowest)
+	}
+	if slo > 0 {
+		fmt.Printf("SLO %s: %d met, %d exceeded, %d unknown\n", slo, s.SLOMet, s.SLOExceeded, s.SLOUnknown)
+	}
+}
+
+func exportFleetJSON(timelines []clusterTimeline, s fleetSummary) string {
+	type clusterEntry struct {
+		Namespace string       `json:"namespace"`
+		Name      string       `json:"name"`
+		Events    []eventEntry `json:"events"`
+		Phases    phaseReport  `json:"phases"`
+	}
+	out := struct {
+		Clusters []clusterEntry `json:"clusters"`
+		Summary  fleetSummary   `json:"summary"`
+	}{Clusters: []clusterEntry{}, Summary: s}
+	for _, t := range timelines {
+		out.Clusters = append(out.Clusters, clusterEntry{t.Namespace, t.Name, eventEntries(t.Events), t.Phases})
+	}
 	data, _ := json.MarshalIndent(out, "", "  ")
 	return string(data)
 }
 
+// writeOutput writes JSON to the -o file, or prints it.
+func writeOutput(out, path string) {
+	if path == "" {
+		fmt.Println(out)
+		return
+	}
+	if err := os.WriteFile(path, []byte(out), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Timeline written to: %s\n", path)
+}
+
 func main() {
 	namespace := flag.String("n", "default", "Namespace")
 	sinceStr := flag.String("since", "", "Show events since duration (e.g., 1h, 30m, 2d)")
 	verbose := flag.Bool("v", false, "Show full event messages")
-	format := flag.String("format", "text", "Output format: text, json")
+	format := flag.String("format", "text", "Output format: text, json, html, mermaid")
 	output := flag.String("o", "", "Write output to file")
+	sloStr := flag.String("slo", "", "Fail when provisioning took, or has been running, longer than this (e.g., 15m)")
+	allClusters := flag.Bool("all-clusters", false, "Build timelines for every cluster in the namespace")
+	allNS := flag.Bool("A", false, "Build timelines for every cluster in all namespaces")
+	recordPath := flag.String("record", "", "Merge the events seen into this file and build timelines from its history")
+	fromRecord := flag.String("from-record", "", "Build timelines from a --record file instead of the cluster")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s <cluster-name> [flags]\n\nBuild provisioning event timeline.\n\nFlags:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <cluster-name>\n       %s [flags] --all-clusters | -A\n\nBuild provisioning event timeline.\n\nFlags:\n", os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	if flag.NArg() < 1 {
+	fleet := *allClusters || *allNS
+	if (flag.NArg() < 1) != fleet {
 		flag.Usage()
 		os.Exit(1)
 	}
-	clusterName := flag.Arg(0)
 
-	if kubectl.Find() == "" {
+	if *recordPath != "" && *fromRecord != "" {
+		fmt.Fprintln(os.Stderr, "Error: --record and --from-record are mutually exclusive")
+		os.Exit(1)
+	}
+	if *fromRecord == "" && kubectl.Find() == "" {
 		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
 		os.Exit(1)
 	}
 
+	switch *format {
+	case "text", "json", "html", "mermaid":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown --format %q (expected text, json, html or mermaid)\n", *format)
+		os.Exit(1)
+	}
+	// Progress goes to stderr unless printing text, so exports can be piped.
+	progress := os.Stdout
+	if *format != "text" {
+		progress = os.Stderr
+	}
+
 	var since time.Duration
 	if *sinceStr != "" {
 		since = parseDuration(*sinceStr)
 	}
 
-	fmt.Printf("Building timeline for cluster '%s'...\n", clusterName)
-	events := getEvents(clusterName, *namespace, since)
+	var slo time.Duration
+	if *sloStr != "" {
+		if slo = parseDuration(*sloStr); slo == 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid --slo %q (e.g., 15m, 1h)\n", *sloStr)
+			os.Exit(1)
+		}
+	}
 
-	if *format == "json" || *output != "" {
-		out := exportJSON(events)
-		if *output != "" {
-			if err := os.WriteFile(*output, []byte(out), 0o644); err != nil {
+	var rec *eventRecord
+	if path := *recordPath + *fromRecord; path != "" {
+		var err error
+		if rec, err = loadRecord(path, *fromRecord != ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	added := 0
+	// collect reads a cluster's events from the cluster, the record, or the
+	// cluster merged into the record.
+	collect := func(namespace, name string) []timelineEvent {
+		if *fromRecord != "" {
+			return rec.events(namespace, name, since)
+		}
+		events := getEvents(name, namespace, since)
+		if rec == nil {
+			return events
+		}
+		added += rec.add(namespace, name, events)
+		return rec.events(namespace, name, since)
+	}
+	saveRecord := func() {
+		if *recordPath == "" {
+			return
+		}
+		if err := rec.save(*recordPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(progress, "Recorded %d new event(s) to %s\n", added, *recordPath)
+	}
+
+	if fleet {
+		var timelines []clusterTimeline
+		if *fromRecord != "" {
+			timelines = rec.clusters(*namespace, *allNS)
+		} else {
+			clusters, err := kubectl.RunJSON("clusters.cluster.x-k8s.io", *namespace, "", *allNS)
+			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("Timeline written to: %s\n", *output)
-		} else {
-			fmt.Println(out)
+			for _, c := range clusters {
+				timelines = append(timelines, clusterTimeline{Namespace: kubectl.GetString(c, "metadata.namespace"), Name: kubectl.GetString(c, "metadata.name")})
+			}
 		}
-	} else {
+		if len(timelines) == 0 {
+			fmt.Println("No clusters found")
+			return
+		}
+		fmt.Fprintf(progress, "Building timelines for %d cluster(s)...\n", len(timelines))
+		now := time.Now().UTC()
+		for i := range timelines {
+			t := &timelines[i]
+			t.Events = collect(t.Namespace, t.Name)
+			t.Phases = buildPhases(t.Events, t.Name, slo, now)
+		}
+		saveRecord()
+		sort.Slice(timelines, func(i, j int) bool { return timelines[i].key() < timelines[j].key() })
+		summary := summarizeFleet(timelines, slo)
+
+		switch {
+		case *format == "html":
+			writeOutput(exportHTML(timelines, now), *output)
+		case *format == "mermaid":
+			writeOutput(exportMermaid(timelines, now), *output)
+		case *format == "json" || *output != "":
+			writeOutput(exportFleetJSON(timelines, summary), *output)
+		default:
+			for _, t := range timelines {
+				fmt.Printf("\n%s\nCluster %s\n%s\n", strings.Repeat("#", 50), t.key(), strings.Repeat("#", 50))
+				printTimeline(t.Events, *verbose)
+				printSummary(t.Events)
+				printPhases(t.Phases, slo)
+			}
+			printFleetSummary(timelines, summary, slo)
+		}
+		if slo > 0 && summary.SLOMet < summary.Clusters {
+			os.Exit(1)
+		}
+		return
+	}
+
+	clusterName := flag.Arg(0)
+	fmt.Fprintf(progress, "Building timeline for cluster '%s'...\n", clusterName)
+	now := time.Now().UTC()
+	events := collect(*namespace, clusterName)
+	phases := buildPhases(events, clusterName, slo, now)
+	saveRecord()
+	single := []clusterTimeline{{*namespace, clusterName, events, phases}}
+
+	switch {
+	case *format == "html":
+		writeOutput(exportHTML(single, now), *output)
+	case *format == "mermaid":
+		writeOutput(exportMermaid(single, now), *output)
+	case *format == "json" || *output != "":
+		writeOutput(exportJSON(events, phases), *output)
+	default:
 		printTimeline(events, *verbose)
 		printSummary(events)
+		printPhases(phases, slo)
+	}
+
+	if slo > 0 && (phases.SLOMet == nil || !*phases.SLOMet) {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,550 @@
+// upgrade-cluster plans and executes a Kubernetes version upgrade of a CAPI cluster.
+//
+// The control plane is upgraded first, then each MachineDeployment and
+// MachinePool in turn. Every step waits for the rollout to finish and for the
+// cluster to pass the check-cluster-health gate before moving on. For
+// ClusterClass-based clusters only spec.topology.version is bumped and the
+// tool follows the rollout performed by the topology controller.
+//
+// Usage:
+//
+//	go run ./upgrade-cluster [flags] <cluster-name>
+//
+// Examples:
+//
+//	go run ./upgrade-cluster --to v1.30.2 --plan my-cluster
+//	go run ./upgrade-cluster -n clusters --to v1.30.2 --yes my-cluster
+//	go run ./upgrade-cluster --pause my-cluster
+//	go run ./upgrade-cluster --resume --to v1.30.2 --yes my-cluster
+//	go run ./upgrade-cluster --abort my-cluster
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s-cluster-api-tools/internal/health"
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+// abortAnnotation asks a running upgrade-cluster process to stop before the
+// next step. It is set by --abort and removed once the process has stopped;
+// a new run clears one left over from an --abort with nothing to stop.
+const abortAnnotation = "upgrade-cluster.capi-tools/abort"
+
+type upgradeStep struct {
+	Kind        string `json:"kind"`
+	Resource    string `json:"resource"`
+	Name        string `json:"name"`
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+	// Patch is the merge patch applied for this step. Steps without a patch
+	// only observe a rollout driven by the topology controller.
+	Patch string `json:"patch,omitempty"`
+}
+
+func (s upgradeStep) String() string {
+	action := "bump"
+	if s.Patch == "" {
+		action = "wait"
+	}
+	return fmt.Sprintf("%-5s %s/%s %s → %s", action, s.Kind, s.Name, s.FromVersion, s.ToVersion)
+}
+
+func parseVersion(v string) [3]int {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.SplitN(v, ".", 3)
+	var r [3]int
+	for i, p := range parts {
+		r[i], _ = strconv.Atoi(p)
+	}
+	return r
+}
+
+func versionLess(a, b string) bool {
+	av, bv := parseVersion(a), parseVersion(b)
+	for i := 0; i < 3; i++ {
+		if av[i] != bv[i] {
+			return av[i] < bv[i]
+		}
+	}
+	return false
+}
+
+func getCluster(name, namespace string) (map[string]interface{}, error) {
+	items, err := kubectl.RunJSON("clusters.cluster.x-k8s.io/"+name, namespace, "", false)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("cluster %s/%s not found", namespace, name)
+	}
+	return items[0], nil
+}
+
+func patch(resource, name, namespace, body string) error {
+	ok, _, errMsg := kubectl.Run([]string{"patch", resource, name, "-n", namespace, "--type", "merge", "-p", body}, 0)
+	if !ok {
+		return fmt.Errorf("patch %s/%s: %s", resource, name, strings.TrimSpace(errMsg))
+	}
+	return nil
+}
+
+func versionPatch(path []string, version string) string {
+	var v interface{} = version
+	for i := len(path) - 1; i >= 0; i-- {
+		v = map[string]interface{}{path[i]: v}
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// buildPlan computes the remaining upgrade steps from the live state, so a
+// re-run after a pause, abort or failure resumes where the upgrade stopped.
+func buildPlan(cluster map[string]interface{}, namespace, target string) ([]upgradeStep, error) {
+	name := kubectl.GetString(cluster, "metadata.name")
+	spec := kubectl.GetMap(cluster, "spec")
+	topo := kubectl.GetMap(spec, "topology")
+	topologyManaged := len(topo) > 0
+
+	var steps []upgradeStep
+
+	if topologyManaged {
+		current, _ := topo["version"].(string)
+		if versionLess(target, current) {
+			return nil, fmt.Errorf("target %s is older than topology version %s", target, current)
+		}
+		if err := checkMinorSkew(current, target); err != nil {
+			return nil, err
+		}
+		if current != target {
+			steps = append(steps, upgradeStep{
+				Kind: "Cluster", Resource: "clusters.cluster.x-k8s.io", Name: name,
+				FromVersion: current, ToVersion: target,
+				Patch: versionPatch([]string{"spec", "topology", "version"}, target),
+			})
+		}
+	}
+
+	cpRef := kubectl.GetMap(spec, "controlPlaneRef")
+	if kind, _ := cpRef["kind"].(string); kind == "KubeadmControlPlane" {
+		cpName, _ := cpRef["name"].(string)
+		items, _ := kubectl.RunJSON("kubeadmcontrolplanes.controlplane.cluster.x-k8s.io/"+cpName, namespace, "", false)
+		if len(items) > 0 {
+			current := kubectl.GetString(items[0], "spec.version")
+			if !topologyManaged {
+				if versionLess(target, current) {
+					return nil, fmt.Errorf("target %s is older than control plane version %s", target, current)
+				}
+				if err := checkMinorSkew(current, target); err != nil {
+					return nil, err
+				}
+			}
+			if current != target || kubectl.GetString(items[0], "status.version") != target {
+				step := upgradeStep{
+					Kind: "KubeadmControlPlane", Resource: "kubeadmcontrolplanes.controlplane.cluster.x-k8s.io",
+					Name: cpName, FromVersion: current, ToVersion: target,
+				}
+				if !topologyManaged && current != target {
+					step.Patch = versionPatch([]string{"spec", "version"}, target)
+				}
+				steps = append(steps, step)
+			}
+		}
+	}
+
+	label := "cluster.x-k8s.io/cluster-name=" + name
+	for _, w := range []struct{ kind, resource string }{
+		{"MachineDeployment", "machinedeployments.cluster.x-k8s.io"},
+		{"MachinePool", "machinepools.cluster.x-k8s.io"},
+	} {
+		items, _ := kubectl.RunJSON(w.resource, namespace, label, false)
+		for _, item := range items {
+			current := kubectl.GetString(item, "spec.template.spec.version")
+			if current == target && rolledOutDone(w.kind, item, target) {
+				continue
+			}
+			step := upgradeStep{
+				Kind: w.kind, Resource: w.resource, Name: kubectl.GetString(item, "metadata.name"),
+				FromVersion: current, ToVersion: target,
+			}
+			if !topologyManaged && current != target {
+				step.Patch = versionPatch([]string{"spec", "template", "spec", "version"}, target)
+			}
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// checkMinorSkew enforces the Kubernetes rule that control planes cannot skip
+// minor versions.
+func checkMinorSkew(current, target string) error {
+	if current == "" {
+		return nil
+	}
+	c, t := parseVersion(current), parseVersion(target)
+	if t[0] != c[0] || t[1]-c[1] > 1 {
+		return fmt.Errorf("cannot upgrade %s → %s: control plane must be upgraded one minor version at a time", current, target)
+	}
+	return nil
+}
+
+func rolledOutDone(kind string, item map[string]interface{}, target string) bool {
+	done, _ := rolledOut(kind, item, target)
+	return done
+}
+
+// rolledOut reports whether a control plane or worker pool has finished
+// rolling out the target version, with a short progress description.
+func rolledOut(kind string, item map[string]interface{}, target string) (bool, string) {
+	desired := kubectl.GetInt(item, "spec.replicas")
+	replicas := kubectl.GetInt(item, "status.replicas")
+	ready := kubectl.GetInt(item, "status.readyReplicas")
+	updated := kubectl.GetInt(item, "status.updatedReplicas")
+	observed := kubectl.GetInt(item, "status.observedGeneration")
+	generation := kubectl.GetInt(item, "metadata.generation")
+
+	progress := fmt.Sprintf("replicas=%d/%d updated=%d ready=%d", replicas, desired, updated, ready)
+	if observed < generation {
+		return false, progress + " (generation not observed yet)"
+	}
+
+	switch kind {
+	case "KubeadmControlPlane":
+		version := kubectl.GetString(item, "status.version")
+		progress += " version=" + version
+		return version == target && updated == desired && ready == desired && replicas == desired, progress
+	case "MachinePool":
+		return ready == desired && replicas == desired, progress
+	default:
+		return updated == desired && ready == desired && replicas == desired, progress
+	}
+}
+
+type runOptions struct {
+	cluster     string
+	namespace   string
+	target      string
+	timeout     time.Duration
+	interval    time.Duration
+	healthGate  bool
+	healthGrace time.Duration
+}
+
+type stopError struct {
+	code int
+	msg  string
+}
+
+func (e stopError) Error() string { return e.msg }
+
+// checkControl honours --pause and --abort issued from another terminal. A
+// paused cluster suspends the wait without consuming the step timeout.
+func checkControl(opts runOptions, deadline *time.Time) error {
+	for {
+		cluster, err := getCluster(opts.cluster, opts.namespace)
+		if err != nil {
+			return err
+		}
+		annotations := kubectl.GetMap(kubectl.GetMap(cluster, "metadata"), "annotations")
+		if _, ok := annotations[abortAnnotation]; ok {
+			_ = clearAbort(opts)
+			return stopError{3, "upgrade aborted via " + abortAnnotation}
+		}
+		if paused, _ := kubectl.GetNested(cluster, "spec.paused").(bool); !paused {
+			return nil
+		}
+		fmt.Println("   ⏸  cluster is paused; waiting for --resume")
+		time.Sleep(opts.interval)
+		*deadline = deadline.Add(opts.interval)
+	}
+}
+
+// clearAbort removes the abort annotation from the cluster.
+func clearAbort(opts runOptions) error {
+	return patch("clusters.cluster.x-k8s.io", opts.cluster, opts.namespace,
+		fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, abortAnnotation))
+}
+
+// topologyReconciled reports whether the topology controller has reconciled
+// the current generation of the cluster. A TopologyReconciled=True condition
+// left over from before the version bump does not count: its observedGeneration
+// (or status.observedGeneration for v1beta1 conditions) must have caught up
+// with metadata.generation.
+func topologyReconciled(cluster map[string]interface{}) (bool, string) {
+	generation := kubectl.GetInt(cluster, "metadata.generation")
+	for _, c := range health.GetConditions(cluster) {
+		cm, _ := c.(map[string]interface{})
+		if t, _ := cm["type"].(string); t != "TopologyReconciled" {
+			continue
+		}
+		status, _ := cm["status"].(string)
+		reason, _ := cm["reason"].(string)
+		progress := "TopologyReconciled=" + status
+		if reason != "" {
+			progress += " (" + reason + ")"
+		}
+		observed := kubectl.GetInt(cm, "observedGeneration")
+		if observed == 0 {
+			observed = kubectl.GetInt(cluster, "status.observedGeneration")
+		}
+		if observed < generation {
+			return false, progress + " (generation not observed yet)"
+		}
+		return status == "True", progress
+	}
+	return false, "waiting for topology controller"
+}
+
+func waitForStep(step upgradeStep, opts runOptions) error {
+	deadline := time.Now().Add(opts.timeout)
+	lastProgress := ""
+	for {
+		if err := checkControl(opts, &deadline); err != nil {
+			return err
+		}
+
+		var done bool
+		var progress string
+		if step.Kind == "Cluster" {
+			cluster, err := getCluster(opts.cluster, opts.namespace)
+			if err != nil {
+				return err
+			}
+			done, progress = topologyReconciled(cluster)
+		} else {
+			items, err := kubectl.RunJSON(step.Resource+"/"+step.Name, opts.namespace, "", false)
+			if err != nil {
+				return err
+			}
+			if len(items) == 0 {
+				return fmt.Errorf("%s/%s disappeared during upgrade", step.Kind, step.Name)
+			}
+			done, progress = rolledOut(step.Kind, items[0], step.ToVersion)
+		}
+
+		if progress != lastProgress {
+			fmt.Printf("   %s %s\n", time.Now().Format("15:04:05"), progress)
+			lastProgress = progress
+		}
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return stopError{2, fmt.Sprintf("timed out after %s waiting for %s/%s rollout", opts.timeout, step.Kind, step.Name)}
+		}
+		time.Sleep(opts.interval)
+	}
+}
+
+// healthGate waits until check-cluster-health reports no errors, allowing
+// transient conditions to settle for up to healthGrace.
+func healthGate(opts runOptions) error {
+	deadline := time.Now().Add(opts.healthGrace)
+	for {
+		summary, issues := health.Check(opts.cluster, opts.namespace)
+		errors, _ := summary["errors"].(int)
+		if errors == 0 {
+			fmt.Println("   ✅ health gate passed")
+			return nil
+		}
+		if time.Now().After(deadline) {
+			fmt.Printf("   ❌ health gate failed with %d error(s):\n", errors)
+			for _, i := range issues {
+				if i.Severity == "error" {
+					fmt.Print(indent(i.String(), "      "))
+				}
+			}
+			return stopError{2, "health gate failed"}
+		}
+		time.Sleep(opts.interval)
+	}
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	return prefix + strings.Join(lines, "\n"+prefix) + "\n"
+}
+
+func execute(steps []upgradeStep, opts runOptions) error {
+	for i, step := range steps {
+		fmt.Printf("\n[%d/%d] %s\n", i+1, len(steps), step)
+		deadline := time.Now().Add(opts.timeout)
+		if err := checkControl(opts, &deadline); err != nil {
+			return err
+		}
+		if step.Patch != "" {
+			if err := patch(step.Resource, step.Name, opts.namespace, step.Patch); err != nil {
+				return err
+			}
+		}
+		if err := waitForStep(step, opts); err != nil {
+			return err
+		}
+		if opts.healthGate {
+			if err := healthGate(opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func printPlan(cluster, target string, steps []upgradeStep) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("%s\nUPGRADE PLAN: %s → %s\n%s\n", sep, cluster, target, sep)
+	if len(steps) == 0 {
+		fmt.Println("✅ Cluster is already at the target version")
+		return
+	}
+	for i, s := range steps {
+		fmt.Printf("  %d. %s\n", i+1, s)
+	}
+}
+
+func confirm(prompt string) bool {
+	fmt.Printf("\n%s [y/N]: ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func main() {
+	namespace := flag.String("n", "default", "Namespace of the cluster")
+	target := flag.String("to", "", "Target Kubernetes version (e.g., v1.30.2)")
+	planOnly := flag.Bool("plan", false, "Print the upgrade plan and exit")
+	yes := flag.Bool("yes", false, "Execute without confirmation")
+	timeout := flag.Duration("timeout", 30*time.Minute, "Timeout for each rollout step")
+	interval := flag.Duration("interval", 15*time.Second, "Polling interval")
+	skipHealth := flag.Bool("skip-health", false, "Disable the health gate between steps")
+	healthGrace := flag.Duration("health-grace", 5*time.Minute, "How long the health gate may wait for conditions to settle")
+	pause := flag.Bool("pause", false, "Pause the cluster (halts in-flight rollouts) and exit")
+	resume := flag.Bool("resume", false, "Unpause the cluster; continues the upgrade when --to is set")
+	abort := flag.Bool("abort", false, "Ask a running upgrade to stop before its next step")
+	jsonOut := flag.Bool("json", false, "Print the plan as JSON (implies --plan)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <cluster-name>\n\nPlan and execute a Kubernetes version upgrade of a CAPI cluster.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	clusterName := flag.Arg(0)
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	const clusterResource = "clusters.cluster.x-k8s.io"
+	switch {
+	case *pause:
+		if err := patch(clusterResource, clusterName, *namespace, `{"spec":{"paused":true}}`); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("⏸  Cluster %s/%s paused\n", *namespace, clusterName)
+		return
+	case *abort:
+		body := fmt.Sprintf(`{"metadata":{"annotations":{%q:"true"}}}`, abortAnnotation)
+		if err := patch(clusterResource, clusterName, *namespace, body); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("🛑 Abort requested for %s/%s\n", *namespace, clusterName)
+		return
+	case *resume:
+		if err := patch(clusterResource, clusterName, *namespace, `{"spec":{"paused":false}}`); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("▶️  Cluster %s/%s resumed\n", *namespace, clusterName)
+		if *target == "" {
+			return
+		}
+	}
+
+	if *target == "" {
+		fmt.Fprintln(os.Stderr, "Error: --to (target version) is required")
+		os.Exit(1)
+	}
+	if !strings.HasPrefix(*target, "v") {
+		*target = "v" + *target
+	}
+
+	cluster, err := getCluster(clusterName, *namespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	steps, err := buildPlan(cluster, *namespace, *target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOut {
+		if steps == nil {
+			steps = []upgradeStep{}
+		}
+		data, _ := json.MarshalIndent(map[string]interface{}{
+			"cluster": *namespace + "/" + clusterName,
+			"target":  *target,
+			"steps":   steps,
+		}, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	printPlan(*namespace+"/"+clusterName, *target, steps)
+	if *planOnly || len(steps) == 0 {
+		return
+	}
+
+	if !*yes && !confirm("Proceed with upgrade?") {
+		fmt.Println("Aborted")
+		os.Exit(1)
+	}
+
+	opts := runOptions{
+		cluster:     clusterName,
+		namespace:   *namespace,
+		target:      *target,
+		timeout:     *timeout,
+		interval:    *interval,
+		healthGate:  !*skipHealth,
+		healthGrace: *healthGrace,
+	}
+	// An abort annotation left behind by --abort when no upgrade was running
+	// would stop this run before its first step.
+	if _, ok := kubectl.GetMap(kubectl.GetMap(cluster, "metadata"), "annotations")[abortAnnotation]; ok {
+		if err := clearAbort(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: clearing stale %s: %v\n", abortAnnotation, err)
+			os.Exit(1)
+		}
+		fmt.Printf("ℹ️  Cleared stale %s annotation from an earlier --abort\n", abortAnnotation)
+	}
+	if err := execute(steps, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "\n❌ %v\n", err)
+		fmt.Fprintln(os.Stderr, "Re-run the same command to resume; completed steps are skipped.")
+		if se, ok := err.(stopError); ok {
+			os.Exit(se.code)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("\n✅ Cluster %s/%s upgraded to %s\n", *namespace, clusterName, *target)
+}
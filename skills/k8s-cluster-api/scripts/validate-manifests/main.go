@@ -1,4 +1,6 @@
 // validate-manifests validates CAPI YAML manifests against schema requirements.
+// Deprecation, required field, credential and CRD schema checks are shared
+// with lint-cluster-templates through internal/validation.
 //
 // Usage:
 //
@@ -8,30 +10,55 @@
 //
 //	go run ./validate-manifests manifest.yaml
 //	go run ./validate-manifests -d ./manifests/ -r
+//	go run ./validate-manifests --strict cluster-template.yaml
+//	go run ./validate-manifests --crd-dir ./config/crd -d ./manifests/
+//	go run ./validate-manifests --live cluster.yaml
+//	go run ./validate-manifests --format json -o report.json -d ./manifests/
+//	go run ./validate-manifests --format junit -o junit.xml -d ./manifests/ -r
+//	go run ./validate-manifests --kustomize overlays/prod --crd-dir ./config/crd
+//	go run ./validate-manifests --helm ./charts/cluster --values values-prod.yaml
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
-	"gopkg.in/yaml.v3"
+	"k8s-cluster-api-tools/internal/kubectl"
+	"k8s-cluster-api-tools/internal/validation"
 )
 
-type validationError struct {
-	Field    string `json:"field"`
-	Message  string `json:"message"`
-	Severity string `json:"severity"`
+func errorf(field, format string, args ...interface{}) validation.Issue {
+	return validation.Issue{Severity: validation.Error, Field: field, Message: fmt.Sprintf(format, args...)}
 }
 
-func (e validationError) String() string {
-	icon := "❌"
-	if e.Severity == "warning" {
-		icon = "⚠️"
+func warnf(field, format string, args ...interface{}) validation.Issue {
+	return validation.Issue{Severity: validation.Warning, Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// issueText renders an issue for the text and JUnit reports. Issues not tied
+// to a field are located by line.
+func issueText(i validation.Issue) string {
+	loc := i.Field
+	if loc == "" && i.Line > 0 {
+		loc = fmt.Sprintf("line %d", i.Line)
+	}
+	s := fmt.Sprintf("[%s] %s", i.Severity, i.Message)
+	if loc != "" {
+		s = fmt.Sprintf("[%s] %s: %s", i.Severity, loc, i.Message)
 	}
-	return fmt.Sprintf("  %s [%s] %s: %s", icon, e.Severity, e.Field, e.Message)
+	if i.Suggestion != "" {
+		s += " → " + i.Suggestion
+	}
+	return s
 }
 
 var capiResources = map[string]string{
@@ -53,18 +80,8 @@ var capiResources = map[string]string{
 	"MachinePoolMachine":    "cluster.x-k8s.io",
 }
 
-var requiredFields = map[string][]string{
-	"Cluster":            {"clusterName:false", "infrastructureRef", "controlPlaneRef"},
-	"Machine":            {"clusterName", "bootstrap"},
-	"MachineDeployment":  {"clusterName", "template"},
-	"MachineSet":         {"clusterName", "template"},
-	"ClusterClass":       {"infrastructure", "controlPlane"},
-	"MachineHealthCheck": {"clusterName", "selector", "unhealthyConditions"},
-	"MachinePool":        {"clusterName", "template"},
-}
-
-func validateAPIVersion(doc map[string]interface{}) []validationError {
-	var errs []validationError
+func validateAPIVersion(doc map[string]interface{}) []validation.Issue {
+	var errs []validation.Issue
 	av, _ := doc["apiVersion"].(string)
 	kind, _ := doc["kind"].(string)
 
@@ -74,28 +91,19 @@ func validateAPIVersion(doc map[string]interface{}) []validationError {
 
 	if group, ok := capiResources[kind]; ok {
 		if !strings.HasPrefix(av, group) {
-			errs = append(errs, validationError{"apiVersion", fmt.Sprintf("Expected group '%s', got '%s'", group, av), "warning"})
+			errs = append(errs, warnf("apiVersion", "Expected group '%s', got '%s'", group, av))
 		}
 	}
-
-	if strings.Contains(av, "v1alpha") {
-		errs = append(errs, validationError{"apiVersion", fmt.Sprintf("v1alpha API versions are deprecated: %s", av), "warning"})
-	}
 	return errs
 }
 
-func validateMetadata(doc map[string]interface{}) []validationError {
-	var errs []validationError
+func validateMetadata(doc map[string]interface{}) []validation.Issue {
+	var errs []validation.Issue
 	metadata, ok := doc["metadata"].(map[string]interface{})
 	if !ok || metadata == nil {
-		errs = append(errs, validationError{"metadata", "Missing metadata field", "error"})
 		return errs
 	}
 
-	if name, _ := metadata["name"].(string); name == "" {
-		errs = append(errs, validationError{"metadata.name", "Missing name field", "error"})
-	}
-
 	kind, _ := doc["kind"].(string)
 	labels, _ := metadata["labels"].(map[string]interface{})
 
@@ -105,41 +113,26 @@ func validateMetadata(doc map[string]interface{}) []validationError {
 			spec, _ := doc["spec"].(map[string]interface{})
 			clusterName, _ := spec["clusterName"].(string)
 			if clusterName == "" {
-				errs = append(errs, validationError{"metadata.labels", "Missing cluster.x-k8s.io/cluster-name label", "warning"})
+				errs = append(errs, warnf("metadata.labels", "Missing cluster.x-k8s.io/cluster-name label"))
 			}
 		}
 	}
 	return errs
 }
 
-func validateSpec(doc map[string]interface{}) []validationError {
-	var errs []validationError
-	kind, _ := doc["kind"].(string)
-	spec, _ := doc["spec"].(map[string]interface{})
+func validateSpec(doc *validation.Document) []validation.Issue {
+	var errs []validation.Issue
+	kind, _ := doc.Obj["kind"].(string)
+	spec, _ := doc.Obj["spec"].(map[string]interface{})
 
 	if spec == nil {
-		errs = append(errs, validationError{"spec", "Missing spec field", "error"})
+		errs = append(errs, errorf("spec", "Missing spec field"))
 		return errs
 	}
 
-	if fields, ok := requiredFields[kind]; ok {
-		for _, field := range fields {
-			// topology-based clusters don't need some fields
-			if kind == "Cluster" {
-				if _, hasTopo := spec["topology"]; hasTopo {
-					if field == "infrastructureRef" || field == "controlPlaneRef" {
-						continue
-					}
-				}
-			}
-			if _, ok := spec[field]; !ok {
-				errs = append(errs, validationError{
-					"spec." + field,
-					fmt.Sprintf("Missing required field: %s", field),
-					"error",
-				})
-			}
-		}
+	// A loaded CRD schema replaces the built-in required field list.
+	if _, hasSchema := crdSchemas.For(doc.Obj); !hasSchema {
+		errs = append(errs, validation.RequiredSpecFields.Check(doc)...)
 	}
 
 	// Kind-specific validations
@@ -156,108 +149,431 @@ func validateSpec(doc map[string]interface{}) []validationError {
 	return errs
 }
 
-func validateClusterSpec(spec map[string]interface{}) []validationError {
-	var errs []validationError
+func validateClusterSpec(spec map[string]interface{}) []validation.Issue {
+	var errs []validation.Issue
 	if ref, ok := spec["infrastructureRef"].(map[string]interface{}); ok {
 		if _, ok := ref["kind"].(string); !ok {
-			errs = append(errs, validationError{"spec.infrastructureRef.kind", "Missing kind in infrastructureRef", "error"})
+			errs = append(errs, errorf("spec.infrastructureRef.kind", "Missing kind in infrastructureRef"))
 		}
 		if _, ok := ref["name"].(string); !ok {
-			errs = append(errs, validationError{"spec.infrastructureRef.name", "Missing name in infrastructureRef", "error"})
+			errs = append(errs, errorf("spec.infrastructureRef.name", "Missing name in infrastructureRef"))
 		}
 	}
 	if ref, ok := spec["controlPlaneRef"].(map[string]interface{}); ok {
 		if _, ok := ref["kind"].(string); !ok {
-			errs = append(errs, validationError{"spec.controlPlaneRef.kind", "Missing kind in controlPlaneRef", "error"})
+			errs = append(errs, errorf("spec.controlPlaneRef.kind", "Missing kind in controlPlaneRef"))
 		}
 	}
 	return errs
 }
 
-func validateMachineSpec(spec map[string]interface{}) []validationError {
-	var errs []validationError
+func validateMachineSpec(spec map[string]interface{}) []validation.Issue {
+	var errs []validation.Issue
 	if bootstrap, ok := spec["bootstrap"].(map[string]interface{}); ok {
 		if bootstrap["configRef"] == nil && bootstrap["dataSecretName"] == nil {
-			errs = append(errs, validationError{"spec.bootstrap", "Must have either configRef or dataSecretName", "error"})
+			errs = append(errs, errorf("spec.bootstrap", "Must have either configRef or dataSecretName"))
 		}
 	}
 	return errs
 }
 
-func validateMDSpec(spec map[string]interface{}) []validationError {
-	var errs []validationError
+func validateMDSpec(spec map[string]interface{}) []validation.Issue {
+	var errs []validation.Issue
 	if tmpl, ok := spec["template"].(map[string]interface{}); ok {
 		tmplSpec, _ := tmpl["spec"].(map[string]interface{})
 		if tmplSpec != nil {
 			if tmplSpec["bootstrap"] == nil {
-				errs = append(errs, validationError{"spec.template.spec.bootstrap", "Missing bootstrap in template", "error"})
+				errs = append(errs, errorf("spec.template.spec.bootstrap", "Missing bootstrap in template"))
 			}
 			if tmplSpec["infrastructureRef"] == nil {
-				errs = append(errs, validationError{"spec.template.spec.infrastructureRef", "Missing infrastructureRef in template", "error"})
+				errs = append(errs, errorf("spec.template.spec.infrastructureRef", "Missing infrastructureRef in template"))
 			}
 		}
 	}
 	return errs
 }
 
-func validateCCSpec(spec map[string]interface{}) []validationError {
-	var errs []validationError
+func validateCCSpec(spec map[string]interface{}) []validation.Issue {
+	var errs []validation.Issue
 	if infra, ok := spec["infrastructure"].(map[string]interface{}); ok {
 		if infra["ref"] == nil {
-			errs = append(errs, validationError{"spec.infrastructure.ref", "Missing ref in infrastructure", "error"})
+			errs = append(errs, errorf("spec.infrastructure.ref", "Missing ref in infrastructure"))
 		}
 	}
 	if cp, ok := spec["controlPlane"].(map[string]interface{}); ok {
 		if cp["ref"] == nil {
-			errs = append(errs, validationError{"spec.controlPlane.ref", "Missing ref in controlPlane", "error"})
+			errs = append(errs, errorf("spec.controlPlane.ref", "Missing ref in controlPlane"))
 		}
 	}
 	return errs
 }
 
-func validateDocument(doc map[string]interface{}, filePath string) []validationError {
-	var errs []validationError
+// crdSchemas holds the CRD schemas loaded with --crd-dir or --live; nil
+// when neither is set.
+var crdSchemas validation.Schemas
 
-	kind, _ := doc["kind"].(string)
-	if kind == "" {
-		errs = append(errs, validationError{"kind", "Missing kind field", "error"})
-	}
+// sharedRules are lint-cluster-templates rules run after the built-in
+// checks. Required fields run first and required spec fields in
+// validateSpec, since a loaded CRD schema replaces them.
+var sharedRules = []validation.Rule{validation.DeprecatedAPIVersion, validation.AlphaAPIVersion,
+	validation.DeprecatedFields, validation.CRDSchema(&crdSchemas)}
 
-	errs = append(errs, validateAPIVersion(doc)...)
-	errs = append(errs, validateMetadata(doc)...)
+func validateDocument(doc *validation.Document) []validation.Issue {
+	errs := validation.RequiredFields.Check(doc)
+	errs = append(errs, validateAPIVersion(doc.Obj)...)
+	errs = append(errs, validateMetadata(doc.Obj)...)
 	errs = append(errs, validateSpec(doc)...)
+	for _, r := range sharedRules {
+		errs = append(errs, r.Check(doc)...)
+	}
+	for i := range errs {
+		errs[i].File = doc.File
+		if errs[i].Line == 0 {
+			errs[i].Line = doc.Line
+		}
+	}
 	return errs
 }
 
-func validateFile(filePath string) (int, int, []validationError) {
-	var allErrs []validationError
-	docCount := 0
+// documents collects every document validateFile reads, for the
+// cross-resource checks run once all files are loaded.
+var documents []validation.Document
+
+// refFields lists object references checked by crossValidate, by kind.
+var refFields = map[string][]string{
+	"Cluster":                     {"spec.infrastructureRef", "spec.controlPlaneRef"},
+	"Machine":                     {"spec.infrastructureRef", "spec.bootstrap.configRef"},
+	"MachineSet":                  {"spec.template.spec.infrastructureRef", "spec.template.spec.bootstrap.configRef"},
+	"MachineDeployment":           {"spec.template.spec.infrastructureRef", "spec.template.spec.bootstrap.configRef"},
+	"MachinePool":                 {"spec.template.spec.infrastructureRef", "spec.template.spec.bootstrap.configRef"},
+	"KubeadmControlPlane":         {"spec.machineTemplate.infrastructureRef", "spec.machineTemplate.spec.infrastructureRef"},
+	"KubeadmControlPlaneTemplate": {"spec.template.spec.machineTemplate.infrastructureRef"},
+	"ClusterClass": {"spec.infrastructure.ref", "spec.infrastructure.templateRef", "spec.controlPlane.ref",
+		"spec.controlPlane.templateRef", "spec.controlPlane.machineInfrastructure.ref",
+		"spec.controlPlane.machineInfrastructure.templateRef"},
+}
+
+// clusterScopedKinds carry spec.clusterName.
+var clusterScopedKinds = map[string]bool{
+	"Machine": true, "MachineSet": true, "MachineDeployment": true, "MachinePool": true, "MachineHealthCheck": true,
+}
+
+func docNamespace(doc map[string]interface{}) string {
+	if ns := kubectl.GetString(doc, "metadata.namespace"); ns != "" {
+		return ns
+	}
+	return "default"
+}
+
+func docKey(kind, namespace, name string) string {
+	return kind + "/" + templateName(namespace) + "/" + templateName(name)
+}
+
+// templateName reduces clusterctl placeholders to their variable, so
+// ${CLUSTER_NAME:=dev} and ${CLUSTER_NAME} name the same object.
+func templateName(s string) string {
+	return validation.TemplateVarPattern.ReplaceAllString(s, "$${$1}")
+}
+
+// classRefs returns the worker class template references of a ClusterClass
+// with their field paths.
+func classRefs(doc map[string]interface{}) map[string]map[string]interface{} {
+	refs := map[string]map[string]interface{}{}
+	for _, pool := range []string{"machineDeployments", "machinePools"} {
+		classes, _ := kubectl.GetNested(doc, "spec.workers."+pool).([]interface{})
+		for i, c := range classes {
+			cm, _ := c.(map[string]interface{})
+			for _, path := range []string{"template.bootstrap.ref", "template.infrastructure.ref",
+				"bootstrap.templateRef", "infrastructure.templateRef"} {
+				if ref, ok := kubectl.GetNested(cm, path).(map[string]interface{}); ok {
+					refs[fmt.Sprintf("spec.workers.%s[%d].%s", pool, i, path)] = ref
+				}
+			}
+		}
+	}
+	for _, path := range refFields["ClusterClass"] {
+		if ref, ok := kubectl.GetNested(doc, path).(map[string]interface{}); ok {
+			refs[path] = ref
+		}
+	}
+	return refs
+}
+
+// crossValidate checks that the documents agree with each other: clusterName
+// fields and cluster-name labels name a Cluster in the set and match, and
+// every object reference resolves to a document of that kind and name.
+// Infrastructure, bootstrap and control plane objects nothing references are
+// reported as orphaned. The checks only run when the set contains a Cluster
+// or ClusterClass; otherwise it is assumed to be a partial set of manifests.
+// Names are compared with clusterctl placeholders reduced to their variable.
+func crossValidate(docs []validation.Document) []validation.Issue {
+	var out []validation.Issue
+	exists := map[string]bool{}
+	kinds := map[string]bool{}
+	complete := false
+	for _, d := range docs {
+		kind, _ := d.Obj["kind"].(string)
+		exists[docKey(kind, docNamespace(d.Obj), kubectl.GetString(d.Obj, "metadata.name"))] = true
+		kinds[kind] = true
+		complete = complete || kind == "Cluster" || kind == "ClusterClass"
+	}
+	if !complete {
+		return out
+	}
+	// found reports whether a reference resolves. A templated reference to a
+	// kind the set has no document of, such as a ClusterClass installed
+	// separately, is left to resolve once the variables are substituted.
+	found := func(kind, ns, name string) bool {
+		if exists[docKey(kind, ns, name)] {
+			return true
+		}
+		return !kinds[kind] && validation.TemplateVarPattern.MatchString(ns+name)
+	}
+
+	referenced := map[string]bool{}
+	for _, d := range docs {
+		doc := d.Obj
+		kind, _ := doc["kind"].(string)
+		name := kubectl.GetString(doc, "metadata.name")
+		ns := docNamespace(doc)
+		report := func(field, format string, args ...interface{}) {
+			issue := errorf(field, "%s %s: %s", kind, name, fmt.Sprintf(format, args...))
+			issue.File, issue.Line = d.File, d.Line
+			out = append(out, issue)
+		}
 
+		label := kubectl.Labels(doc)["cluster.x-k8s.io/cluster-name"]
+		clusterName := kubectl.GetString(doc, "spec.clusterName")
+		if clusterScopedKinds[kind] {
+			if clusterName != "" && !found("Cluster", ns, clusterName) {
+				report("spec.clusterName", "Cluster %s not found in the validated files", clusterName)
+			}
+			if tmpl := kubectl.GetString(doc, "spec.template.spec.clusterName"); tmpl != "" && clusterName != "" && templateName(tmpl) != templateName(clusterName) {
+				report("spec.template.spec.clusterName", "%s does not match spec.clusterName %s", tmpl, clusterName)
+			}
+		}
+		if label != "" {
+			if clusterName != "" && templateName(label) != templateName(clusterName) {
+				report("metadata.labels", "cluster.x-k8s.io/cluster-name label %s does not match spec.clusterName %s", label, clusterName)
+			} else if clusterName == "" && !found("Cluster", ns, label) {
+				report("metadata.labels", "cluster.x-k8s.io/cluster-name label names Cluster %s, not found in the validated files", label)
+			}
+		}
+
+		refs := map[string]map[string]interface{}{}
+		if kind == "ClusterClass" {
+			refs = classRefs(doc)
+		} else {
+			for _, path := range refFields[kind] {
+				if ref, ok := kubectl.GetNested(doc, path).(map[string]interface{}); ok {
+					refs[path] = ref
+				}
+			}
+		}
+		if kind == "Cluster" {
+			class := kubectl.GetString(doc, "spec.topology.class")
+			if class == "" {
+				class = kubectl.GetString(doc, "spec.topology.classRef.name")
+			}
+			if class != "" {
+				refs["spec.topology.class"] = map[string]interface{}{"kind": "ClusterClass", "name": class,
+					"namespace": kubectl.GetString(doc, "spec.topology.classNamespace") + kubectl.GetString(doc, "spec.topology.classRef.namespace")}
+			}
+		}
+		paths := make([]string, 0, len(refs))
+		for path := range refs {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			ref := refs[path]
+			refKind, _ := ref["kind"].(string)
+			refName, _ := ref["name"].(string)
+			refNS, _ := ref["namespace"].(string)
+			if refNS == "" {
+				refNS = ns
+			}
+			if refKind == "" || refName == "" {
+				continue
+			}
+			referenced[docKey(refKind, refNS, refName)] = true
+			if !found(refKind, refNS, refName) {
+				report(path, "references %s %s, not found in the validated files", refKind, refName)
+			}
+		}
+	}
+
+	for _, d := range docs {
+		av, _ := d.Obj["apiVersion"].(string)
+		kind, _ := d.Obj["kind"].(string)
+		if !strings.HasPrefix(av, "infrastructure.cluster.x-k8s.io/") && !strings.HasPrefix(av, "bootstrap.cluster.x-k8s.io/") &&
+			!strings.HasPrefix(av, "controlplane.cluster.x-k8s.io/") {
+			continue
+		}
+		// Machine-level instances are created by controllers and are
+		// referenced by Machines that may not be part of the set.
+		if kind == "KubeadmConfig" || (strings.HasSuffix(kind, "Machine") && !strings.HasSuffix(kind, "Template")) {
+			continue
+		}
+		name := kubectl.GetString(d.Obj, "metadata.name")
+		if !referenced[docKey(kind, docNamespace(d.Obj), name)] {
+			issue := errorf("metadata.name", "%s %s: orphaned, not referenced by any object in the validated files", kind, name)
+			issue.File, issue.Line = d.File, d.Line
+			out = append(out, issue)
+		}
+	}
+	return out
+}
+
+func validateFile(filePath string) (int, []validation.Issue) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		return 0, 1, []validationError{{filePath, fmt.Sprintf("File read error: %v", err), "error"}}
+		return 0, []validation.Issue{{Severity: validation.Error, File: filePath,
+			Message: fmt.Sprintf("File read error: %v", err)}}
 	}
 
-	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
-	for {
-		var doc map[string]interface{}
-		if err := decoder.Decode(&doc); err != nil {
-			break
+	return validateContent(filePath, string(data))
+}
+
+// validateContent validates the manifests in content, reporting them as
+// name. Rendered kustomize and helm output goes through here as well.
+func validateContent(name, content string) (int, []validation.Issue) {
+	allErrs := validation.HardcodedCredentials.Scan(name, strings.Split(content, "\n"))
+	docs, err := validation.Parse(name, content)
+	for i := range docs {
+		documents = append(documents, docs[i])
+		allErrs = append(allErrs, validateDocument(&docs[i])...)
+	}
+	if err != nil {
+		allErrs = append(allErrs, validation.Issue{Severity: validation.Error, File: name,
+			Message: fmt.Sprintf("YAML syntax error: %v", err)})
+	}
+	return len(docs), allErrs
+}
+
+// render runs a manifest renderer and returns what it prints.
+func render(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
 		}
-		if doc == nil {
-			continue
+		return "", fmt.Errorf("%s: %s", filepath.Base(name), msg)
+	}
+	return string(out), nil
+}
+
+// renderKustomize builds dir with kustomize, or with the kustomize built
+// into kubectl when the standalone binary is not installed.
+func renderKustomize(dir string) (string, error) {
+	if _, err := exec.LookPath("kustomize"); err == nil {
+		return render("kustomize", "build", dir)
+	}
+	if path := kubectl.Find(); path != "" {
+		return render(path, "kustomize", dir)
+	}
+	return "", fmt.Errorf("neither kustomize nor kubectl found in PATH")
+}
+
+// renderHelm renders chart with helm template and the given values files.
+func renderHelm(chart string, values []string) (string, error) {
+	if _, err := exec.LookPath("helm"); err != nil {
+		return "", fmt.Errorf("helm not found in PATH")
+	}
+	args := []string{"template", chart}
+	for _, v := range values {
+		args = append(args, "--values", v)
+	}
+	return render("helm", args...)
+}
+
+// fileList collects a repeatable flag.
+type fileList []string
+
+func (f *fileList) String() string     { return strings.Join(*f, ",") }
+func (f *fileList) Set(v string) error { *f = append(*f, v); return nil }
+
+type fileResult struct {
+	File      string             `json:"file"`
+	Documents int                `json:"documents"`
+	Issues    []validation.Issue `json:"issues"`
+}
+
+func exportJSON(results []fileResult, docs, errors, warnings int, strict bool) string {
+	files := make([]fileResult, len(results))
+	for i, r := range results {
+		files[i] = r
+		if files[i].Issues == nil {
+			files[i].Issues = []validation.Issue{}
 		}
-		docCount++
-		allErrs = append(allErrs, validateDocument(doc, filePath)...)
 	}
+	report := map[string]interface{}{
+		"files": files,
+		"summary": map[string]interface{}{
+			"files":     len(results),
+			"documents": docs,
+			"errors":    errors,
+			"warnings":  warnings,
+		},
+		"valid": errors == 0 && !(strict && warnings > 0),
+	}
+	data, _ := json.MarshalIndent(report, "", "  ")
+	return string(data)
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
 
-	errorCount := 0
-	for _, e := range allErrs {
-		if e.Severity == "error" {
-			errorCount++
+// exportJUnit reports one test case per file. Errors fail the case, and so
+// do warnings in strict mode; other warnings go to system-out.
+func exportJUnit(results []fileResult, strict bool) string {
+	suite := junitSuite{Name: "validate-manifests", Tests: len(results)}
+	for _, r := range results {
+		tc := junitCase{Name: r.File, Classname: "validate-manifests"}
+		var failed, other []string
+		for _, e := range r.Issues {
+			line := issueText(e)
+			if e.Severity == validation.Error || (strict && e.Severity == validation.Warning) {
+				failed = append(failed, line)
+			} else {
+				other = append(other, line)
+			}
 		}
+		if len(failed) > 0 {
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d issue(s)", len(failed)),
+				Type:    "validation",
+				Text:    strings.Join(failed, "\n"),
+			}
+		}
+		tc.SystemOut = strings.Join(other, "\n")
+		suite.Cases = append(suite.Cases, tc)
 	}
-	return docCount, errorCount, allErrs
+	data, _ := xml.MarshalIndent(suite, "", "  ")
+	return xml.Header + string(data)
 }
 
 func findYAMLFiles(root string, recursive bool) []string {
@@ -298,6 +614,15 @@ func main() {
 	dir := flag.String("d", "", "Directory containing manifests")
 	recursive := flag.Bool("r", false, "Search directories recursively")
 	strict := flag.Bool("s", false, "Treat warnings as errors")
+	flag.BoolVar(strict, "strict", false, "Treat warnings as errors (same as -s)")
+	crdDir := flag.String("crd-dir", "", "Validate against the CRD schemas in this directory")
+	live := flag.Bool("live", false, "Validate against the CRD schemas installed in the current cluster")
+	format := flag.String("format", "text", "Output format: text, json, junit")
+	output := flag.String("o", "", "Write report to file")
+	kustomizeDir := flag.String("kustomize", "", "Render this kustomization with kustomize build and validate the output")
+	helmChart := flag.String("helm", "", "Render this chart with helm template and validate the output")
+	var values fileList
+	flag.Var(&values, "values", "Values file for --helm (repeatable)")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [paths...] [flags]\n\nValidate Cluster API YAML manifests.\n\nFlags:\n", os.Args[0])
@@ -310,51 +635,132 @@ func main() {
 		paths = []string{*dir}
 	} else if flag.NArg() > 0 {
 		paths = flag.Args()
-	} else {
+	} else if *kustomizeDir == "" && *helmChart == "" {
 		paths = []string{"."}
 	}
+	if len(values) > 0 && *helmChart == "" {
+		fmt.Fprintln(os.Stderr, "Error: --values requires --helm")
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "text", "json", "junit":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown --format %q (expected text, json or junit)\n", *format)
+		os.Exit(1)
+	}
+
+	if *crdDir != "" || *live {
+		crdSchemas = validation.Schemas{}
+		if *crdDir != "" {
+			if err := crdSchemas.LoadDir(*crdDir); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: loading CRDs: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if *live {
+			if err := crdSchemas.LoadLive(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: loading CRDs: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
 
 	var allFiles []string
 	for _, p := range paths {
 		allFiles = append(allFiles, findYAMLFiles(p, *recursive)...)
 	}
 
-	if len(allFiles) == 0 {
+	if len(allFiles) == 0 && len(paths) > 0 {
 		fmt.Fprintln(os.Stderr, "No YAML files found")
 		os.Exit(1)
 	}
 
 	totalDocs, totalErrors, totalWarnings := 0, 0, 0
+	var results []fileResult
+
+	// Rendered sources are reported as kustomize:<dir> and helm:<chart>.
+	if *kustomizeDir != "" {
+		out, err := renderKustomize(*kustomizeDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: rendering %s: %v\n", *kustomizeDir, err)
+			os.Exit(1)
+		}
+		name := "kustomize:" + *kustomizeDir
+		docs, errs := validateContent(name, out)
+		totalDocs += docs
+		results = append(results, fileResult{File: name, Documents: docs, Issues: errs})
+	}
+	if *helmChart != "" {
+		out, err := renderHelm(*helmChart, values)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: rendering %s: %v\n", *helmChart, err)
+			os.Exit(1)
+		}
+		name := "helm:" + *helmChart
+		docs, errs := validateContent(name, out)
+		totalDocs += docs
+		results = append(results, fileResult{File: name, Documents: docs, Issues: errs})
+	}
 
 	for _, f := range allFiles {
-		docs, errCount, errs := validateFile(f)
+		docs, errs := validateFile(f)
 		totalDocs += docs
-		totalErrors += errCount
-		for _, e := range errs {
-			if e.Severity == "warning" {
-				totalWarnings++
-			}
-		}
+		results = append(results, fileResult{File: f, Documents: docs, Issues: errs})
+	}
 
-		if len(errs) > 0 {
-			fmt.Printf("\n%s:\n", f)
-			for _, e := range errs {
-				fmt.Println(e.String())
+	cross := crossValidate(documents)
+	for i := range results {
+		for _, e := range cross {
+			if e.File == results[i].File {
+				results[i].Issues = append(results[i].Issues, e)
 			}
 		}
+		errCount, warnCount := validation.Count(results[i].Issues)
+		totalErrors += errCount
+		totalWarnings += warnCount
 	}
 
-	sep := strings.Repeat("=", 50)
-	fmt.Printf("\n%s\n", sep)
-	fmt.Printf("Files scanned: %d\n", len(allFiles))
-	fmt.Printf("Documents validated: %d\n", totalDocs)
-	fmt.Printf("Errors: %d\n", totalErrors)
-	fmt.Printf("Warnings: %d\n", totalWarnings)
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "json":
+		fmt.Fprintln(w, exportJSON(results, totalDocs, totalErrors, totalWarnings, *strict))
+	case "junit":
+		fmt.Fprintln(w, exportJUnit(results, *strict))
+	default:
+		for _, r := range results {
+			if len(r.Issues) > 0 {
+				fmt.Fprintf(w, "\n%s:\n", r.File)
+				for _, e := range r.Issues {
+					fmt.Fprintf(w, "  %s %s\n", e.Severity.Icon(), issueText(e))
+				}
+			}
+		}
 
-	if totalErrors > 0 {
-		os.Exit(1)
+		sep := strings.Repeat("=", 50)
+		fmt.Fprintf(w, "\n%s\n", sep)
+		fmt.Fprintf(w, "Files scanned: %d\n", len(results))
+		fmt.Fprintf(w, "Documents validated: %d\n", totalDocs)
+		fmt.Fprintf(w, "Errors: %d\n", totalErrors)
+		fmt.Fprintf(w, "Warnings: %d\n", totalWarnings)
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Report written to %s\n", *output)
 	}
-	if *strict && totalWarnings > 0 {
+
+	if totalErrors > 0 || (*strict && totalWarnings > 0) {
+		if f, ok := w.(*os.File); ok && f != os.Stdout {
+			f.Close()
+		}
 		os.Exit(1)
 	}
 }
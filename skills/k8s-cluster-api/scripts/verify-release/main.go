@@ -0,0 +1,765 @@
+// verify-release checks a provider's release artifacts before they are published.
+//
+// It reads infrastructure-components.yaml (or any provider components file)
+// and metadata.yaml from a local path or URL and verifies that:
+//   - container image references resolve in their registries
+//   - CRDs parse and pass the provider contract schema checks
+//   - RBAC is self-consistent (bindings, roles and service accounts match up)
+//   - metadata.yaml covers the released version and its contract matches
+//     the contract labels on the CRDs
+//
+// No cluster access is needed. When metadata.yaml is not given, it is looked
+// up next to the components file.
+//
+// Usage:
+//
+//	go run ./verify-release [flags] <components.yaml|URL> [metadata.yaml|URL]
+//
+// Examples:
+//
+//	go run ./verify-release ./out/infrastructure-components.yaml ./metadata.yaml
+//	go run ./verify-release https://github.com/kubernetes-sigs/cluster-api-provider-aws/releases/download/v2.5.0/infrastructure-components.yaml
+//	go run ./verify-release --skip-images --version v2.5.0 ./out/infrastructure-components.yaml
+//	go run ./verify-release --format json -o release.json ./out/infrastructure-components.yaml
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"k8s-cluster-api-tools/internal/contract"
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+type finding struct {
+	Severity string `json:"severity"`
+	Category string `json:"category"`
+	Object   string `json:"object,omitempty"`
+	Message  string `json:"message"`
+}
+
+type imageResult struct {
+	Image  string `json:"image"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type report struct {
+	Components string            `json:"components"`
+	Metadata   string            `json:"metadata,omitempty"`
+	Version    string            `json:"version,omitempty"`
+	Provider   string            `json:"provider,omitempty"`
+	Objects    int               `json:"objects"`
+	Images     []imageResult     `json:"images"`
+	Contract   []contract.Report `json:"contract"`
+	Findings   []finding         `json:"findings"`
+}
+
+func (r *report) add(sev, cat, obj, msg string) {
+	r.Findings = append(r.Findings, finding{sev, cat, obj, msg})
+}
+
+func (r *report) errorCount() int {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Severity == "error" {
+			n++
+		}
+	}
+	for _, c := range r.Contract {
+		n += c.ErrorCount()
+	}
+	return n
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+func load(src string) ([]byte, error) {
+	if !isURL(src) {
+		return os.ReadFile(src)
+	}
+	resp, err := httpClient.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", src, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// siblingMetadata returns the metadata.yaml location next to src.
+func siblingMetadata(src string) string {
+	if isURL(src) {
+		i := strings.LastIndex(src, "/")
+		return src[:i+1] + "metadata.yaml"
+	}
+	return filepath.Join(filepath.Dir(src), "metadata.yaml")
+}
+
+func parseDocs(data []byte) ([]map[string]interface{}, error) {
+	var docs []map[string]interface{}
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	for {
+		var doc map[string]interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return docs, err
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+func objectName(doc map[string]interface{}) string {
+	kind, _ := doc["kind"].(string)
+	name := kubectl.GetString(doc, "metadata.name")
+	if ns := kubectl.GetString(doc, "metadata.namespace"); ns != "" {
+		return fmt.Sprintf("%s %s/%s", kind, ns, name)
+	}
+	return kind + " " + name
+}
+
+// clusterctl variables: ${VAR}, ${VAR:=default} and ${VAR:-default}.
+var varPattern = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)(?::[=-]([^}]*))?\}`)
+
+// substituteDefaults replaces variables that have defaults and reports
+// whether unresolved variables remain.
+func substituteDefaults(s string) (string, bool) {
+	unresolved := false
+	out := varPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := varPattern.FindStringSubmatch(m)
+		if strings.Contains(m, ":=") || strings.Contains(m, ":-") {
+			return sub[2]
+		}
+		unresolved = true
+		return m
+	})
+	return out, unresolved
+}
+
+func podSpec(doc map[string]interface{}) map[string]interface{} {
+	switch kind, _ := doc["kind"].(string); kind {
+	case "Deployment", "DaemonSet", "StatefulSet", "Job", "ReplicaSet":
+		return kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(doc, "spec"), "template"), "spec")
+	case "Pod":
+		return kubectl.GetMap(doc, "spec")
+	}
+	return nil
+}
+
+func collectImages(docs []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var images []string
+	for _, doc := range docs {
+		spec := podSpec(doc)
+		if spec == nil {
+			continue
+		}
+		for _, key := range []string{"initContainers", "containers"} {
+			for _, c := range kubectl.GetSlice(spec, key) {
+				cm, _ := c.(map[string]interface{})
+				if img, _ := cm["image"].(string); img != "" && !seen[img] {
+					seen[img] = true
+					images = append(images, img)
+				}
+			}
+		}
+	}
+	sort.Strings(images)
+	return images
+}
+
+// splitImage splits an image reference into registry, repository and
+// tag-or-digest, applying Docker Hub defaults.
+func splitImage(image string) (string, string, string) {
+	ref := "latest"
+	if i := strings.Index(image, "@"); i >= 0 {
+		image, ref = image[:i], image[i+1:]
+	} else if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image, ref = image[:i], image[i+1:]
+	}
+	registry := "registry-1.docker.io"
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		registry, image = parts[0], parts[1]
+	} else if !strings.Contains(image, "/") {
+		image = "library/" + image
+	}
+	if registry == "docker.io" {
+		registry = "registry-1.docker.io"
+	}
+	return registry, image, ref
+}
+
+var manifestAccept = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+var authParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// anonymousToken requests a pull token from the registry's token service,
+// as advertised by a Bearer WWW-Authenticate challenge.
+func anonymousToken(challenge, repo string) string {
+	params := map[string]string{}
+	for _, m := range authParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	realm := params["realm"]
+	if realm == "" {
+		return ""
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + repo + ":pull"
+	}
+	url := fmt.Sprintf("%s?service=%s&scope=%s", realm, params["service"], scope)
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&tok) != nil {
+		return ""
+	}
+	if tok.Token != "" {
+		return tok.Token
+	}
+	return tok.AccessToken
+}
+
+func resolveImage(image string) imageResult {
+	res := imageResult{Image: image}
+	resolved, unresolved := substituteDefaults(image)
+	if unresolved {
+		res.Status = "skipped"
+		res.Detail = "contains variables without defaults"
+		return res
+	}
+	registry, repo, ref := splitImage(resolved)
+	url := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repo, ref)
+
+	head := func(token string) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodHead, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", manifestAccept)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return httpClient.Do(req)
+	}
+
+	resp, err := head("")
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		if token := anonymousToken(resp.Header.Get("WWW-Authenticate"), repo); token != "" {
+			resp, err = head(token)
+		}
+	}
+	if err != nil {
+		res.Status = "unknown"
+		res.Detail = err.Error()
+		return res
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		res.Status = "ok"
+	case resp.StatusCode == http.StatusNotFound:
+		res.Status = "missing"
+		res.Detail = "manifest not found in " + registry
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		res.Status = "unknown"
+		res.Detail = "registry requires credentials (" + resp.Status + ")"
+	default:
+		res.Status = "unknown"
+		res.Detail = resp.Status
+	}
+	return res
+}
+
+func checkImages(r *report, docs []map[string]interface{}) {
+	for _, img := range collectImages(docs) {
+		res := resolveImage(img)
+		r.Images = append(r.Images, res)
+		switch res.Status {
+		case "missing":
+			r.add("error", "Images", img, "Image does not resolve: "+res.Detail)
+		case "unknown":
+			r.add("warning", "Images", img, "Could not verify image: "+res.Detail)
+		}
+	}
+}
+
+func checkCRDs(r *report, docs []map[string]interface{}) []map[string]interface{} {
+	var crds []map[string]interface{}
+	for _, doc := range docs {
+		if kind, _ := doc["kind"].(string); kind != "CustomResourceDefinition" {
+			continue
+		}
+		crds = append(crds, doc)
+		name := kubectl.GetString(doc, "metadata.name")
+		spec := kubectl.GetMap(doc, "spec")
+		if g, _ := spec["group"].(string); g == "" {
+			r.add("error", "CRD", name, "spec.group is missing")
+		}
+		if kubectl.GetString(spec, "names.kind") == "" || kubectl.GetString(spec, "names.plural") == "" {
+			r.add("error", "CRD", name, "spec.names.kind/plural are missing")
+		}
+		versions := kubectl.GetSlice(spec, "versions")
+		if len(versions) == 0 {
+			r.add("error", "CRD", name, "No versions defined")
+			continue
+		}
+		storage := 0
+		for _, v := range versions {
+			vm, _ := v.(map[string]interface{})
+			if s, _ := vm["storage"].(bool); s {
+				storage++
+			}
+			if kubectl.GetMap(kubectl.GetMap(vm, "schema"), "openAPIV3Schema") == nil {
+				vname, _ := vm["name"].(string)
+				r.add("error", "CRD", name, "Version "+vname+" has no openAPIV3Schema")
+			}
+		}
+		if storage != 1 {
+			r.add("error", "CRD", name, fmt.Sprintf("Expected exactly one storage version, found %d", storage))
+		}
+	}
+	if len(crds) == 0 {
+		r.add("error", "CRD", "", "No CustomResourceDefinitions found in components")
+	}
+	r.Contract = contract.CheckCRDs(crds, "", "")
+	return crds
+}
+
+var builtinClusterRoles = map[string]bool{"cluster-admin": true, "admin": true, "edit": true, "view": true}
+
+func checkRBAC(r *report, docs []map[string]interface{}, crds []map[string]interface{}) {
+	roles := map[string]map[string]interface{}{}
+	serviceAccounts := map[string]bool{}
+	var bindings []map[string]interface{}
+	for _, doc := range docs {
+		kind, _ := doc["kind"].(string)
+		ns := kubectl.GetString(doc, "metadata.namespace")
+		name := kubectl.GetString(doc, "metadata.name")
+		switch kind {
+		case "ClusterRole":
+			roles["ClusterRole/"+name] = doc
+		case "Role":
+			roles["Role/"+ns+"/"+name] = doc
+		case "ServiceAccount":
+			serviceAccounts[ns+"/"+name] = true
+		case "ClusterRoleBinding", "RoleBinding":
+			bindings = append(bindings, doc)
+		}
+	}
+
+	// roles granted to each service account, used for the CRD coverage check
+	granted := map[string][]map[string]interface{}{}
+	for _, b := range bindings {
+		kind, _ := b["kind"].(string)
+		ns := kubectl.GetString(b, "metadata.namespace")
+		roleRef := kubectl.GetMap(b, "roleRef")
+		refKind, _ := roleRef["kind"].(string)
+		refName, _ := roleRef["name"].(string)
+
+		key := "ClusterRole/" + refName
+		if refKind == "Role" {
+			key = "Role/" + ns + "/" + refName
+		}
+		role, ok := roles[key]
+		if !ok && !(refKind == "ClusterRole" && (builtinClusterRoles[refName] || strings.HasPrefix(refName, "system:"))) {
+			r.add("error", "RBAC", objectName(b), fmt.Sprintf("roleRef %s %s is not defined in the components", refKind, refName))
+		}
+
+		for _, s := range kubectl.GetSlice(b, "subjects") {
+			sm, _ := s.(map[string]interface{})
+			if k, _ := sm["kind"].(string); k != "ServiceAccount" {
+				continue
+			}
+			sname, _ := sm["name"].(string)
+			sns, _ := sm["namespace"].(string)
+			if sns == "" && kind == "RoleBinding" {
+				sns = ns
+			}
+			if !serviceAccounts[sns+"/"+sname] {
+				r.add("error", "RBAC", objectName(b), fmt.Sprintf("Subject ServiceAccount %s/%s is not defined in the components", sns, sname))
+			}
+			if role != nil {
+				granted[sns+"/"+sname] = append(granted[sns+"/"+sname], role)
+			}
+		}
+	}
+
+	var groups []string
+	for _, crd := range crds {
+		if g := kubectl.GetString(crd, "spec.group"); g != "" && !contains(groups, g) {
+			groups = append(groups, g)
+		}
+	}
+
+	for _, doc := range docs {
+		spec := podSpec(doc)
+		if spec == nil {
+			continue
+		}
+		ns := kubectl.GetString(doc, "metadata.namespace")
+		sa, _ := spec["serviceAccountName"].(string)
+		if sa == "" {
+			r.add("warning", "RBAC", objectName(doc), "Uses the default ServiceAccount")
+			continue
+		}
+		if !serviceAccounts[ns+"/"+sa] {
+			r.add("error", "RBAC", objectName(doc), fmt.Sprintf("ServiceAccount %s/%s is not defined in the components", ns, sa))
+			continue
+		}
+		if len(granted[ns+"/"+sa]) == 0 {
+			r.add("warning", "RBAC", objectName(doc), fmt.Sprintf("ServiceAccount %s/%s is not bound to any role", ns, sa))
+			continue
+		}
+		for _, g := range groups {
+			if !grantsGroup(granted[ns+"/"+sa], g) {
+				r.add("warning", "RBAC", objectName(doc), fmt.Sprintf("No role bound to %s/%s grants access to API group %s", ns, sa, g))
+			}
+		}
+	}
+}
+
+func grantsGroup(roles []map[string]interface{}, group string) bool {
+	for _, role := range roles {
+		for _, rule := range kubectl.GetSlice(role, "rules") {
+			rm, _ := rule.(map[string]interface{})
+			for _, g := range kubectl.GetSlice(rm, "apiGroups") {
+				if s, _ := g.(string); s == group || s == "*" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var semverTag = regexp.MustCompile(`^v(\d+)\.(\d+)\.\d+`)
+
+// inferVersion takes the release version from the controller image tags.
+func inferVersion(images []string) string {
+	for _, img := range images {
+		resolved, _ := substituteDefaults(img)
+		_, _, ref := splitImage(resolved)
+		if m := semverTag.FindString(ref); m != "" {
+			return m
+		}
+	}
+	return ""
+}
+
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return -1
+}
+
+func checkMetadata(r *report, meta map[string]interface{}, crds []map[string]interface{}) {
+	if kind, _ := meta["kind"].(string); kind != "Metadata" {
+		r.add("error", "Metadata", r.Metadata, fmt.Sprintf("Expected kind Metadata, got %q", kind))
+	}
+	series := kubectl.GetSlice(meta, "releaseSeries")
+	if len(series) == 0 {
+		r.add("error", "Metadata", r.Metadata, "releaseSeries is empty")
+		return
+	}
+
+	seen := map[string]bool{}
+	var current map[string]interface{}
+	m := semverTag.FindStringSubmatch(r.Version)
+	for _, s := range series {
+		sm, _ := s.(map[string]interface{})
+		key := fmt.Sprintf("v%d.%d", toInt(sm["major"]), toInt(sm["minor"]))
+		if seen[key] {
+			r.add("warning", "Metadata", r.Metadata, "Duplicate releaseSeries entry for "+key)
+		}
+		seen[key] = true
+		if c, _ := sm["contract"].(string); c == "" {
+			r.add("error", "Metadata", r.Metadata, "releaseSeries "+key+" has no contract")
+		}
+		if m != nil && strconv.Itoa(toInt(sm["major"])) == m[1] && strconv.Itoa(toInt(sm["minor"])) == m[2] {
+			current = sm
+		}
+	}
+
+	if r.Version == "" {
+		r.add("warning", "Metadata", r.Metadata, "Release version unknown; pass --version to check releaseSeries coverage")
+		return
+	}
+	if m == nil {
+		r.add("error", "Metadata", r.Metadata, fmt.Sprintf("Release version %s is not of the form vMAJOR.MINOR.PATCH", r.Version))
+		return
+	}
+	if current == nil {
+		r.add("error", "Metadata", r.Metadata, fmt.Sprintf("No releaseSeries entry for v%s.%s (release %s)", m[1], m[2], r.Version))
+		return
+	}
+
+	contractVersion, _ := current["contract"].(string)
+	label := "cluster.x-k8s.io/" + contractVersion
+	for _, crd := range crds {
+		if !isProviderCRD(crd) {
+			continue
+		}
+		if _, ok := kubectl.Labels(crd)[label]; !ok {
+			r.add("error", "Metadata", objectName(crd), fmt.Sprintf("Missing contract label %s required by releaseSeries v%s.%s", label, m[1], m[2]))
+		}
+	}
+}
+
+func isProviderCRD(crd map[string]interface{}) bool {
+	for _, g := range contract.APIGroups {
+		if contract.InGroup(crd, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProviderLabel verifies every object carries the same
+// cluster.x-k8s.io/provider label, which clusterctl relies on.
+func checkProviderLabel(r *report, docs []map[string]interface{}) {
+	values := map[string]int{}
+	missing := 0
+	for _, doc := range docs {
+		v, ok := kubectl.Labels(doc)["cluster.x-k8s.io/provider"]
+		if !ok {
+			missing++
+			continue
+		}
+		values[v]++
+	}
+	if missing > 0 {
+		r.add("warning", "Labels", "", fmt.Sprintf("%d object(s) lack the cluster.x-k8s.io/provider label", missing))
+	}
+	if len(values) > 1 {
+		var names []string
+		for v := range values {
+			names = append(names, v)
+		}
+		sort.Strings(names)
+		r.add("error", "Labels", "", "Inconsistent cluster.x-k8s.io/provider labels: "+strings.Join(names, ", "))
+	}
+	for v := range values {
+		r.Provider = v
+	}
+}
+
+func printReport(r report) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nRELEASE VERIFICATION\n%s\n", sep, sep)
+	fmt.Printf("Components: %s (%d objects)\n", r.Components, r.Objects)
+	if r.Metadata != "" {
+		fmt.Printf("Metadata:   %s\n", r.Metadata)
+	}
+	if r.Provider != "" {
+		fmt.Printf("Provider:   %s\n", r.Provider)
+	}
+	if r.Version != "" {
+		fmt.Printf("Version:    %s\n", r.Version)
+	}
+
+	if len(r.Images) > 0 {
+		fmt.Println("\nImages:")
+		icons := map[string]string{"ok": "✅", "missing": "❌", "unknown": "⚠️", "skipped": "⏭️"}
+		for _, img := range r.Images {
+			fmt.Printf("  %s %s", icons[img.Status], img.Image)
+			if img.Detail != "" {
+				fmt.Printf(" (%s)", img.Detail)
+			}
+			fmt.Println()
+		}
+	}
+
+	if len(r.Contract) > 0 {
+		fmt.Println("\nContract checks:")
+		for _, c := range r.Contract {
+			status := "✅"
+			if !c.IsCompliant() {
+				status = "❌"
+			}
+			fmt.Printf("  %s %s (%s)\n", status, strings.Join(c.CheckedCRDs, ", "), c.ProviderType)
+			for _, v := range c.Violations {
+				fmt.Printf("      [%s] %s\n", v.Severity, v.Message)
+			}
+		}
+	}
+
+	icons := map[string]string{"error": "🔴", "warning": "⚠️"}
+	for _, sev := range []string{"error", "warning"} {
+		var filtered []finding
+		for _, f := range r.Findings {
+			if f.Severity == sev {
+				filtered = append(filtered, f)
+			}
+		}
+		if len(filtered) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s %s (%d)\n", icons[sev], strings.ToUpper(sev), len(filtered))
+		for _, f := range filtered {
+			if f.Object != "" {
+				fmt.Printf("  [%s] %s: %s\n", f.Category, f.Object, f.Message)
+			} else {
+				fmt.Printf("  [%s] %s\n", f.Category, f.Message)
+			}
+		}
+	}
+
+	if n := r.errorCount(); n > 0 {
+		fmt.Printf("\n❌ Release verification failed with %d error(s)\n", n)
+	} else {
+		fmt.Println("\n✅ Release artifacts look good")
+	}
+}
+
+func main() {
+	version := flag.String("version", "", "Release version (default: inferred from image tags)")
+	skipImages := flag.Bool("skip-images", false, "Do not resolve image references against registries")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <components.yaml|URL> [metadata.yaml|URL]\n\nVerify provider release artifacts: images, CRDs, RBAC and metadata.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	releaseVersion := *version
+	if releaseVersion != "" && !strings.HasPrefix(releaseVersion, "v") {
+		releaseVersion = "v" + releaseVersion
+	}
+	if releaseVersion != "" && !semverTag.MatchString(releaseVersion) {
+		fmt.Fprintf(os.Stderr, "Error: invalid --version %q (expected vMAJOR.MINOR.PATCH)\n", *version)
+		os.Exit(1)
+	}
+
+	r := report{Components: flag.Arg(0), Version: releaseVersion}
+	data, err := load(r.Components)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	docs, err := parseDocs(data)
+	if err != nil {
+		r.add("error", "YAML", r.Components, "Parse error: "+err.Error())
+	}
+	r.Objects = len(docs)
+
+	images := collectImages(docs)
+	if r.Version == "" {
+		r.Version = inferVersion(images)
+	}
+	if !*skipImages {
+		checkImages(&r, docs)
+	}
+	crds := checkCRDs(&r, docs)
+	checkRBAC(&r, docs, crds)
+	checkProviderLabel(&r, docs)
+
+	metaSrc := flag.Arg(1)
+	explicit := metaSrc != ""
+	if !explicit {
+		metaSrc = siblingMetadata(r.Components)
+	}
+	if metaData, err := load(metaSrc); err != nil {
+		sev := "warning"
+		if explicit {
+			sev = "error"
+		}
+		r.add(sev, "Metadata", path.Base(metaSrc), "Could not read metadata.yaml: "+err.Error())
+	} else {
+		r.Metadata = metaSrc
+		var meta map[string]interface{}
+		if err := yaml.Unmarshal(metaData, &meta); err != nil {
+			r.add("error", "Metadata", metaSrc, "Parse error: "+err.Error())
+		} else {
+			checkMetadata(&r, meta, crds)
+		}
+	}
+
+	if r.Images == nil {
+		r.Images = []imageResult{}
+	}
+	if r.Findings == nil {
+		r.Findings = []finding{}
+	}
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(r, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(r)
+	}
+
+	if r.errorCount() > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,505 @@
+// version-skew reports Kubernetes, contract and provider version skew across the fleet.
+//
+// It collects the management cluster's Kubernetes version, the installed
+// providers (clusterctl Provider objects, falling back to controller image
+// tags) with the CAPI contracts their CRDs declare, and for every workload
+// cluster the control plane and worker Kubernetes versions. Combinations
+// outside the supported policies are flagged:
+//
+//   - workers newer than the control plane, or more minors behind than the
+//     Kubernetes version skew policy allows (3 since v1.28, 2 before)
+//   - cluster or management cluster versions outside the range supported by
+//     the installed Cluster API release
+//   - providers that do not declare the core contract, or kubeadm providers
+//     on a different minor than core Cluster API
+//
+// Clusters are then ranked into a prioritized upgrade list.
+//
+// Usage:
+//
+//	go run ./version-skew [flags]
+//
+// Examples:
+//
+//	go run ./version-skew
+//	go run ./version-skew -n team-a
+//	go run ./version-skew --format json -o skew.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s-cluster-api-tools/internal/kubectl"
+)
+
+// supportedKubernetes is the workload/management Kubernetes range per
+// Cluster API minor release.
+var supportedKubernetes = map[string][2]string{
+	"v1.6":  {"v1.26", "v1.30"},
+	"v1.7":  {"v1.27", "v1.31"},
+	"v1.8":  {"v1.28", "v1.32"},
+	"v1.9":  {"v1.29", "v1.33"},
+	"v1.10": {"v1.30", "v1.34"},
+	"v1.11": {"v1.30", "v1.34"},
+	"v1.12": {"v1.31", "v1.35"},
+}
+
+type finding struct {
+	Severity string `json:"severity"`
+	Scope    string `json:"scope"`
+	Message  string `json:"message"`
+}
+
+type provider struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Namespace string   `json:"namespace"`
+	Version   string   `json:"version"`
+	Contracts []string `json:"contracts,omitempty"`
+}
+
+type clusterVersions struct {
+	Namespace      string   `json:"namespace"`
+	Name           string   `json:"name"`
+	ControlPlane   string   `json:"control_plane_version"`
+	Workers        []string `json:"worker_versions,omitempty"`
+	Priority       int      `json:"priority"`
+	Recommendation string   `json:"recommendation,omitempty"`
+}
+
+type report struct {
+	Management   string             `json:"management_version"`
+	CoreVersion  string             `json:"core_version,omitempty"`
+	CoreContract string             `json:"core_contract,omitempty"`
+	Providers    []*provider        `json:"providers"`
+	Clusters     []*clusterVersions `json:"clusters"`
+	Findings     []finding          `json:"findings"`
+}
+
+func (r *report) add(sev, scope, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, finding{sev, scope, fmt.Sprintf(format, args...)})
+}
+
+func parseVersion(v string) [3]int {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.SplitN(v, ".", 3)
+	var r [3]int
+	for i, p := range parts {
+		r[i], _ = strconv.Atoi(p)
+	}
+	return r
+}
+
+func versionLess(a, b string) bool {
+	av, bv := parseVersion(a), parseVersion(b)
+	if av[0] != bv[0] {
+		return av[0] < bv[0]
+	}
+	if av[1] != bv[1] {
+		return av[1] < bv[1]
+	}
+	return av[2] < bv[2]
+}
+
+func minor(v string) string {
+	p := parseVersion(v)
+	return fmt.Sprintf("v%d.%d", p[0], p[1])
+}
+
+// minorDiff returns how many minors a is ahead of b (same major assumed).
+func minorDiff(a, b string) int {
+	return parseVersion(a)[1] - parseVersion(b)[1]
+}
+
+// maxKubeletSkew is the number of minors a kubelet may lag the API server.
+func maxKubeletSkew(apiserver string) int {
+	if parseVersion(apiserver)[1] >= 28 {
+		return 3
+	}
+	return 2
+}
+
+func managementVersion() string {
+	ok, out, _ := kubectl.Run([]string{"version", "-o", "json"}, kubectl.DefaultTimeout)
+	if !ok {
+		return ""
+	}
+	var v map[string]interface{}
+	if json.Unmarshal([]byte(out), &v) != nil {
+		return ""
+	}
+	return kubectl.GetString(v, "serverVersion.gitVersion")
+}
+
+// providerContracts maps provider label values to the contract labels
+// declared on their CRDs, and returns the core storage version.
+func providerContracts() (map[string][]string, string) {
+	contracts := map[string][]string{}
+	core := ""
+	crds, _ := kubectl.RunJSON("customresourcedefinitions", "", "", false)
+	for _, crd := range crds {
+		if !strings.HasSuffix(kubectl.GetString(crd, "spec.group"), "cluster.x-k8s.io") {
+			continue
+		}
+		if kubectl.GetString(crd, "metadata.name") == "clusters.cluster.x-k8s.io" {
+			for _, v := range kubectl.GetSlice(kubectl.GetMap(crd, "spec"), "versions") {
+				vm, _ := v.(map[string]interface{})
+				if s, _ := vm["storage"].(bool); s {
+					core, _ = vm["name"].(string)
+				}
+			}
+		}
+		labels := kubectl.Labels(crd)
+		name := labels["cluster.x-k8s.io/provider"]
+		if name == "" {
+			continue
+		}
+		for k := range labels {
+			if c := strings.TrimPrefix(k, "cluster.x-k8s.io/"); c != k && strings.HasPrefix(c, "v1") && !containsString(contracts[name], c) {
+				contracts[name] = append(contracts[name], c)
+			}
+		}
+	}
+	return contracts, core
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func imageTag(image string) string {
+	if i := strings.LastIndex(image, ":"); i >= 0 && !strings.Contains(image[i:], "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
+func findProviders() []*provider {
+	var providers []*provider
+	items, _ := kubectl.RunJSON("providers.clusterctl.cluster.x-k8s.io", "", "", true)
+	for _, p := range items {
+		providers = append(providers, &provider{
+			Name:      kubectl.GetString(p, "metadata.name"),
+			Type:      kubectl.GetString(p, "type"),
+			Namespace: kubectl.GetString(p, "metadata.namespace"),
+			Version:   kubectl.GetString(p, "version"),
+		})
+	}
+	if len(providers) > 0 {
+		return providers
+	}
+	deployments, _ := kubectl.RunJSON("deployments", "", "cluster.x-k8s.io/provider", true)
+	for _, d := range deployments {
+		p := &provider{
+			Name:      kubectl.Labels(d)["cluster.x-k8s.io/provider"],
+			Namespace: kubectl.GetString(d, "metadata.namespace"),
+		}
+		for _, c := range kubectl.GetSlice(kubectl.GetMap(kubectl.GetMap(kubectl.GetMap(d, "spec"), "template"), "spec"), "containers") {
+			cm, _ := c.(map[string]interface{})
+			if image, _ := cm["image"].(string); strings.Contains(image, "manager") || p.Version == "" {
+				p.Version = imageTag(image)
+			}
+		}
+		switch {
+		case p.Name == "cluster-api":
+			p.Type = "CoreProvider"
+		case strings.HasPrefix(p.Name, "infrastructure-"):
+			p.Type = "InfrastructureProvider"
+		case strings.HasPrefix(p.Name, "bootstrap-"):
+			p.Type = "BootstrapProvider"
+		case strings.HasPrefix(p.Name, "control-plane-"):
+			p.Type = "ControlPlaneProvider"
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
+// providerLabel returns the cluster.x-k8s.io/provider label value for a Provider.
+func providerLabel(p *provider) string {
+	if p.Name == "cluster-api" {
+		return p.Name
+	}
+	prefix := map[string]string{
+		"InfrastructureProvider":   "infrastructure-",
+		"BootstrapProvider":        "bootstrap-",
+		"ControlPlaneProvider":     "control-plane-",
+		"IPAMProvider":             "ipam-",
+		"AddonProvider":            "addon-",
+		"RuntimeExtensionProvider": "runtime-extension-",
+	}[p.Type]
+	if strings.HasPrefix(p.Name, prefix) {
+		return p.Name
+	}
+	return prefix + p.Name
+}
+
+func collectClusters(namespace string) []*clusterVersions {
+	allNS := namespace == ""
+	clusters, _ := kubectl.RunJSON("clusters", namespace, "", allNS)
+	cps, _ := kubectl.RunJSON("kubeadmcontrolplanes", namespace, "", allNS)
+	machines, _ := kubectl.RunJSON("machines", namespace, "", allNS)
+
+	cpVersion := map[string]string{}
+	for _, cp := range cps {
+		key := kubectl.GetString(cp, "metadata.namespace") + "/" + kubectl.GetString(cp, "metadata.name")
+		if v := kubectl.GetString(cp, "status.version"); v != "" {
+			cpVersion[key] = v
+		} else {
+			cpVersion[key] = kubectl.GetString(cp, "spec.version")
+		}
+	}
+
+	var result []*clusterVersions
+	for _, c := range clusters {
+		cv := &clusterVersions{
+			Namespace: kubectl.GetString(c, "metadata.namespace"),
+			Name:      kubectl.GetString(c, "metadata.name"),
+		}
+		cv.ControlPlane = cpVersion[cv.Namespace+"/"+kubectl.GetString(c, "spec.controlPlaneRef.name")]
+		if cv.ControlPlane == "" {
+			cv.ControlPlane = kubectl.GetString(c, "spec.topology.version")
+		}
+		seen := map[string]bool{}
+		for _, m := range machines {
+			if kubectl.GetString(m, "metadata.namespace") != cv.Namespace || kubectl.GetString(m, "spec.clusterName") != cv.Name {
+				continue
+			}
+			v := kubectl.GetString(m, "spec.version")
+			if _, isCP := kubectl.Labels(m)["cluster.x-k8s.io/control-plane"]; isCP {
+				// A managed control plane without a KCP reports its version on machines.
+				if cv.ControlPlane == "" || (v != "" && versionLess(v, cv.ControlPlane)) {
+					cv.ControlPlane = v
+				}
+				continue
+			}
+			if v != "" && !seen[v] {
+				seen[v] = true
+				cv.Workers = append(cv.Workers, v)
+			}
+		}
+		sort.Slice(cv.Workers, func(i, j int) bool { return versionLess(cv.Workers[i], cv.Workers[j]) })
+		result = append(result, cv)
+	}
+	return result
+}
+
+func analyze(namespace string) *report {
+	r := &report{Management: managementVersion(), Providers: findProviders()}
+	contracts, core := providerContracts()
+	r.CoreContract = core
+
+	for _, p := range r.Providers {
+		p.Contracts = contracts[providerLabel(p)]
+		sort.Strings(p.Contracts)
+		if p.Type == "CoreProvider" {
+			r.CoreVersion = p.Version
+		}
+	}
+	supported, haveRange := supportedKubernetes[minor(r.CoreVersion)]
+	if r.CoreVersion == "" {
+		r.add("warning", "management", "Core Cluster API provider not found; provider and Kubernetes support checks skipped")
+	} else if !haveRange {
+		r.add("info", "management", "No support matrix known for Cluster API %s", r.CoreVersion)
+	}
+
+	if r.Management != "" && haveRange {
+		if versionLess(minor(r.Management), supported[0]) || versionLess(supported[1], minor(r.Management)) {
+			r.add("error", "management", "Management cluster Kubernetes %s outside the range %s–%s supported by Cluster API %s",
+				r.Management, supported[0], supported[1], r.CoreVersion)
+		}
+	}
+
+	for _, p := range r.Providers {
+		if p.Type == "CoreProvider" || r.CoreVersion == "" {
+			continue
+		}
+		if core != "" && len(p.Contracts) > 0 && !containsString(p.Contracts, core) {
+			r.add("error", "provider "+p.Name, "%s %s declares contracts %s but core Cluster API uses %s",
+				p.Name, p.Version, strings.Join(p.Contracts, ", "), core)
+		}
+		if strings.Contains(p.Name, "kubeadm") && p.Version != "" && minor(p.Version) != minor(r.CoreVersion) {
+			r.add("warning", "provider "+p.Name, "%s %s is on a different minor than core Cluster API %s; kubeadm providers ship with core",
+				p.Name, p.Version, r.CoreVersion)
+		}
+	}
+
+	r.Clusters = collectClusters(namespace)
+	newest := ""
+	for _, c := range r.Clusters {
+		if c.ControlPlane != "" && (newest == "" || versionLess(newest, c.ControlPlane)) {
+			newest = c.ControlPlane
+		}
+	}
+	for _, c := range r.Clusters {
+		scope := "cluster " + c.Namespace + "/" + c.Name
+		c.Priority = 4
+		if c.ControlPlane == "" {
+			r.add("warning", scope, "Control plane version unknown")
+			continue
+		}
+		if newest != "" && minor(c.ControlPlane) != minor(newest) {
+			c.Priority = 3
+			c.Recommendation = fmt.Sprintf("Upgrade control plane towards %s (behind the newest fleet cluster)", minor(newest))
+		}
+		if haveRange {
+			cp := minor(c.ControlPlane)
+			if versionLess(cp, supported[0]) {
+				r.add("error", scope, "Kubernetes %s is below the minimum %s supported by Cluster API %s", c.ControlPlane, supported[0], r.CoreVersion)
+				c.Priority = 1
+				c.Recommendation = fmt.Sprintf("Upgrade control plane one minor at a time to at least %s", supported[0])
+			} else if versionLess(supported[1], cp) {
+				r.add("warning", scope, "Kubernetes %s is above the maximum %s supported by Cluster API %s", c.ControlPlane, supported[1], r.CoreVersion)
+			} else if cp == supported[0] && c.Priority > 2 {
+				c.Priority = 2
+				c.Recommendation = fmt.Sprintf("Upgrade control plane to %s before the next Cluster API upgrade drops %s", bumpMinor(cp), cp)
+			}
+		}
+		limit := maxKubeletSkew(c.ControlPlane)
+		for _, w := range c.Workers {
+			d := minorDiff(c.ControlPlane, w)
+			switch {
+			case d < 0:
+				r.add("error", scope, "Workers on %s are newer than the control plane %s", w, c.ControlPlane)
+				c.Priority = 1
+				c.Recommendation = fmt.Sprintf("Upgrade control plane to %s or roll workers back", minor(w))
+			case d > limit:
+				r.add("error", scope, "Workers on %s are %d minors behind control plane %s (policy allows %d)", w, d, c.ControlPlane, limit)
+				c.Priority = 1
+				c.Recommendation = fmt.Sprintf("Upgrade workers to %s before any control plane upgrade", minor(c.ControlPlane))
+			case d == limit:
+				r.add("warning", scope, "Workers on %s are at the skew limit behind %s; the next control plane upgrade will break policy", w, c.ControlPlane)
+				if c.Priority > 2 {
+					c.Priority = 2
+					c.Recommendation = fmt.Sprintf("Upgrade workers to %s", minor(c.ControlPlane))
+				}
+			}
+		}
+		if len(c.Workers) > 1 {
+			r.add("info", scope, "Workers run %d Kubernetes versions: %s", len(c.Workers), strings.Join(c.Workers, ", "))
+		}
+	}
+
+	sort.SliceStable(r.Clusters, func(i, j int) bool {
+		a, b := r.Clusters[i], r.Clusters[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return versionLess(a.ControlPlane, b.ControlPlane)
+	})
+	return r
+}
+
+func bumpMinor(v string) string {
+	p := parseVersion(v)
+	return fmt.Sprintf("v%d.%d", p[0], p[1]+1)
+}
+
+func printReport(r *report) {
+	sep := strings.Repeat("=", 60)
+	fmt.Printf("\n%s\nFLEET VERSION SKEW\n%s\n", sep, sep)
+	fmt.Printf("\nManagement cluster: Kubernetes %s\n", orUnknown(r.Management))
+	fmt.Printf("Core contract:      %s\n", orUnknown(r.CoreContract))
+
+	fmt.Println("\nProviders:")
+	for _, p := range r.Providers {
+		fmt.Printf("  %-32s %-24s %-10s %s\n", p.Name, p.Type, orUnknown(p.Version), strings.Join(p.Contracts, ","))
+	}
+
+	fmt.Println("\nClusters:")
+	fmt.Printf("  %-36s %-12s %s\n", "CLUSTER", "CONTROL", "WORKERS")
+	for _, c := range r.Clusters {
+		fmt.Printf("  %-36s %-12s %s\n", c.Namespace+"/"+c.Name, orUnknown(c.ControlPlane), strings.Join(c.Workers, ", "))
+	}
+
+	icons := map[string]string{"error": "🔴", "warning": "⚠️", "info": "ℹ️"}
+	for _, sev := range []string{"error", "warning", "info"} {
+		var filtered []finding
+		for _, f := range r.Findings {
+			if f.Severity == sev {
+				filtered = append(filtered, f)
+			}
+		}
+		if len(filtered) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s %s (%d)\n", icons[sev], strings.ToUpper(sev), len(filtered))
+		for _, f := range filtered {
+			fmt.Printf("  [%s] %s\n", f.Scope, f.Message)
+		}
+	}
+
+	fmt.Println("\n📋 Upgrade priority:")
+	n := 0
+	for _, c := range r.Clusters {
+		if c.Recommendation == "" {
+			continue
+		}
+		n++
+		fmt.Printf("  %d. [P%d] %s/%s (%s): %s\n", n, c.Priority, c.Namespace, c.Name, c.ControlPlane, c.Recommendation)
+	}
+	if n == 0 {
+		fmt.Println("  ✅ No upgrades needed")
+	}
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+func main() {
+	namespace := flag.String("n", "", "Only report clusters in this namespace (default: all)")
+	format := flag.String("format", "text", "Output format: text, json")
+	output := flag.String("o", "", "Write JSON report to file")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nReport Kubernetes, contract and provider version skew across the fleet with an upgrade priority list.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if kubectl.Find() == "" {
+		fmt.Fprintln(os.Stderr, "Error: kubectl not found in PATH")
+		os.Exit(1)
+	}
+
+	r := analyze(*namespace)
+
+	if *format == "json" || *output != "" {
+		data, _ := json.MarshalIndent(r, "", "  ")
+		if *output != "" {
+			if err := os.WriteFile(*output, data, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to: %s\n", *output)
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		printReport(r)
+	}
+
+	for _, f := range r.Findings {
+		if f.Severity == "error" {
+			os.Exit(1)
+		}
+	}
+}